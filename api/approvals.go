@@ -0,0 +1,250 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/auth"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+)
+
+// approvalDB is the part of db.CuttleDB which manual runs and their approvals are recorded in.
+type approvalDB interface {
+	approval.Store
+	audit.Recorder
+	history.Recorder
+}
+
+// runRequest is the body of a manual run. TTL is how long a run which requires approval waits for
+// an approver. ("30m") It defaults to approval.DefaultTTL.
+type runRequest struct {
+	Tile  string `json:"tile"`
+	Group string `json:"group"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+// approvalErrorStatus returns the HTTP status for an error from an approval.
+func approvalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, scheduler.ErrNoProfile):
+		return http.StatusNotFound
+	case errors.Is(err, profiles.ErrNotPermitted), errors.Is(err, approval.ErrSelfApproval):
+		return http.StatusForbidden
+	case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrExpired),
+		errors.Is(err, profiles.ErrUnderMaintenance):
+		return http.StatusConflict
+	case errors.Is(err, approval.ErrInvalidRequest), errors.Is(err, profiles.ErrGroupNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sessionUser returns the signed in user and their permissions. Writes a 401 response and returns
+// false if there is no session.
+// INCOMPLETE: User group permissions are not loaded for API requests yet so only admins can
+// approve runs.
+func sessionUser(logger *core.Logger, w http.ResponseWriter, r *http.Request) (string, auth.Permissions, bool) {
+	perms := auth.NewPermissions()
+	claims, ok := r.Context().Value(router.ClaimsKey).(*db.Claims)
+	if !ok || claims.Username == "" {
+		renderError(logger, w, http.StatusUnauthorized, "you need to login")
+		return "", perms, false
+	}
+
+	if claims.IsAdmin {
+		perms.AllowAll()
+	}
+
+	return claims.Username, perms, true
+}
+
+// handleProfileRun runs a Tile of the profile now and returns the run. A run of a Tile which
+// requires approval is held instead and the approval request is returned with a 202. Any user can
+// ask for an approval but running now needs the EXECUTE permission, else a 403 is returned.
+// Returns a 409 listing the servers in maintenance unless the force query parameter is true. A run
+// which fails is still returned with a 200 since it was recorded in the history.
+func handleProfileRun(logger *core.Logger, source scheduler.ProfileSource, adb approvalDB, windows maintenance.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, perms, ok := sessionUser(logger, w, r)
+			if !ok {
+				return
+			}
+
+			body, err := router.ReadJSON[runRequest](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			var ttl time.Duration
+			if body.TTL != "" {
+				if ttl, err = time.ParseDuration(body.TTL); err != nil || ttl < 0 {
+					renderError(logger, w, http.StatusBadRequest, "invalid ttl: "+body.TTL)
+					return
+				}
+			}
+
+			p, err := source.GetProfile(r.PathValue("profile"))
+			if err != nil {
+				renderError(logger, w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			tile, err := p.GetTile(body.Tile)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if tile.RequireApproval {
+				req, err := p.RequestRun(body.Tile, body.Group, user, ttl, adb, adb)
+				if err != nil {
+					renderError(logger, w, approvalErrorStatus(err), err.Error())
+					return
+				}
+
+				if err := router.RenderJSON(w, http.StatusAccepted, req); err != nil {
+					logger.Printf("profile run: %v\n", err)
+				}
+				return
+			}
+
+			if !perms.CanExecute() {
+				renderError(logger, w, http.StatusForbidden, user+" cannot run tiles")
+				return
+			}
+
+			if windows != nil && r.URL.Query().Get("force") != "true" {
+				active, err := maintenance.Active(windows, p.Name)
+				if err != nil {
+					logger.Printf("profile run: %v\n", err)
+				}
+
+				p.Silence(active, time.Now())
+				if err := p.CheckMaintenance(body.Group); err != nil {
+					renderError(logger, w, approvalErrorStatus(err), err.Error())
+					return
+				}
+			}
+
+			run, err := p.ExecuteRecorded(body.Tile, body.Group, history.Run{Trigger: history.TriggerManual, User: user}, adb)
+			if err != nil && run.ID == 0 {
+				renderError(logger, w, approvalErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, run); err != nil {
+				logger.Printf("profile run: %v\n", err)
+			}
+		})
+}
+
+// handleApprovalList returns the approval requests, newest first. Requests can be filtered with the
+// profile and status query parameters.
+func handleApprovalList(logger *core.Logger, store approval.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			list, err := store.ApprovalList(approval.Filter{Profile: q.Get("profile"), Status: q.Get("status")})
+			if err != nil {
+				logger.Printf("approval list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the approval requests")
+				return
+			}
+
+			if list == nil {
+				list = []approval.Request{}
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, list); err != nil {
+				logger.Printf("approval list: %v\n", err)
+			}
+		})
+}
+
+// handleApprovalDecide approves or rejects the request. An approved request runs and the run is
+// returned. A run which fails is still returned with a 200 since it was recorded in the history.
+// Approving returns a 409 listing the servers in maintenance unless the force query parameter is
+// true. A rejected request returns the request.
+func handleApprovalDecide(logger *core.Logger, source scheduler.ProfileSource, adb approvalDB, windows maintenance.Store, approve bool) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, perms, ok := sessionUser(logger, w, r)
+			if !ok {
+				return
+			}
+
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil || id < 1 {
+				renderError(logger, w, http.StatusBadRequest, "invalid approval id: "+r.PathValue("id"))
+				return
+			}
+
+			req, err := adb.ApprovalGet(id)
+			if err != nil {
+				renderError(logger, w, approvalErrorStatus(err), err.Error())
+				return
+			}
+
+			p, err := source.GetProfile(req.Profile)
+			if err != nil {
+				renderError(logger, w, approvalErrorStatus(err), err.Error())
+				return
+			}
+
+			force := r.URL.Query().Get("force") == "true"
+			if approve && windows != nil && !force {
+				active, err := maintenance.Active(windows, p.Name)
+				if err != nil {
+					logger.Printf("approval decide: %v\n", err)
+				}
+
+				p.Silence(active, time.Now())
+			}
+
+			decision := profiles.ApproveRequest{
+				User:              user,
+				Perms:             perms,
+				Approvals:         adb,
+				Audit:             adb,
+				History:           adb,
+				IgnoreMaintenance: force,
+			}
+
+			var out any
+			if approve {
+				run, err := p.Approve(id, decision)
+				if err != nil && run.ID == 0 {
+					renderError(logger, w, approvalErrorStatus(err), err.Error())
+					return
+				}
+
+				out = run
+			} else {
+				req, err := p.Reject(id, decision)
+				if err != nil {
+					renderError(logger, w, approvalErrorStatus(err), err.Error())
+					return
+				}
+
+				out = req
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, out); err != nil {
+				logger.Printf("approval decide: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuditLog lets testApprovalDB embed both Logs.
+type testAuditLog = audit.Log
+
+// testApprovalDB keeps approvals, audit entries, and runs in memory.
+type testApprovalDB struct {
+	*approval.List
+	*testAuditLog
+	*history.Log
+}
+
+// testAs serves the request as the user and returns the response.
+func testAs(t *testing.T, mux *http.ServeMux, claims *db.Claims, method, path string, body io.Reader, code int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if claims != nil {
+		req = req.WithContext(context.WithValue(req.Context(), router.ClaimsKey, claims))
+	}
+
+	resp := httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	require.Equal(t, code, resp.Code, "%s %s status did not match: %s", method, path, resp.Body.String())
+	return resp
+}
+
+// testTokens is an AuthDB which only looks up tokens.
+type testTokens struct {
+	db.AuthDB
+	claims map[string]*db.Claims
+}
+
+func (t testTokens) TokenGet(bearer string) (*db.Claims, error) {
+	claims, ok := t.claims[bearer]
+	if !ok {
+		return &db.Claims{}, db.ErrTokenNotFound
+	}
+
+	return claims, nil
+}
+
+func TestRoutesHandleApprovals(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+	restart := profiles.NewTile("Restart", tests.Test{Name: "Pass", Tester: testPass{}})
+	restart.RequireApproval = true
+	source := scheduler.Profiles{"Web": {
+		Name: "Web",
+		Tiles: map[string]profiles.Tile{
+			"Restart": restart,
+			"Nginx":   profiles.NewTile("Nginx", tests.Test{Name: "Pass", Tester: testPass{}}),
+		},
+		Groups: map[string]profiles.Group{"Prod": profiles.NewGroup("Prod", server)},
+	}}
+
+	adb := testApprovalDB{approval.NewList(), audit.NewLog(), history.NewLog()}
+	windows := maintenance.NewList()
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/profiles/{profile}/runs", handleProfileRun(logger, source, adb, windows))
+	mux.Handle("GET /v1/approvals", handleApprovalList(logger, adb))
+	mux.Handle("POST /v1/approvals/{id}/approve", handleApprovalDecide(logger, source, adb, windows, true))
+	mux.Handle("POST /v1/approvals/{id}/reject", handleApprovalDecide(logger, source, adb, windows, false))
+
+	alice := &db.Claims{Username: "alice"}
+	admin := &db.Claims{Username: "bob", IsAdmin: true}
+	body := func(tile string) io.Reader { return strings.NewReader(`{"tile":"` + tile + `","group":"Prod"}`) }
+
+	t.Run("run", func(t *testing.T) {
+		resp := testAs(t, mux, admin, "POST", "/v1/profiles/Web/runs", body("Nginx"), http.StatusOK)
+		got, err := router.ReadJSON[history.Run](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.True(got.Passed, "run did not pass")
+		require.Equal("bob", got.User, "User did not match")
+
+		testAs(t, mux, nil, "POST", "/v1/profiles/Web/runs", body("Nginx"), http.StatusUnauthorized)
+		testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", body("Nginx"), http.StatusForbidden)
+		testAs(t, mux, alice, "POST", "/v1/profiles/DB/runs", body("Nginx"), http.StatusNotFound)
+		testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", body("Missing"), http.StatusBadRequest)
+		testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", strings.NewReader(`{"tile":"Restart","group":"Prod","ttl":"soon"}`), http.StatusBadRequest)
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		// The claims come from APIAuthMiddleware in a real request.
+		h := router.APIAuthMiddleware(logger, testTokens{claims: map[string]*db.Claims{"bob-token": admin}})(mux)
+		req := httptest.NewRequest("POST", "/v1/profiles/Web/runs", body("Nginx"))
+		req.Header.Set("Authorization", "Bearer bob-token")
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		require.Equal(http.StatusOK, resp.Code, "status did not match: %s", resp.Body.String())
+	})
+
+	t.Run("run under maintenance", func(t *testing.T) {
+		w, err := windows.MaintenanceCreate(maintenance.Window{
+			Kind:   maintenance.KindServer,
+			Target: "host1",
+			Start:  time.Now().Add(-time.Minute),
+			End:    time.Now().Add(time.Hour),
+		})
+		require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+		t.Cleanup(func() { _ = windows.MaintenanceDelete(w.ID) })
+
+		resp := testAs(t, mux, admin, "POST", "/v1/profiles/Web/runs", body("Nginx"), http.StatusConflict)
+		require.Contains(resp.Body.String(), "host1", "warning did not name the server")
+		testAs(t, mux, admin, "POST", "/v1/profiles/Web/runs?force=true", body("Nginx"), http.StatusOK)
+	})
+
+	t.Run("request", func(t *testing.T) {
+		resp := testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", body("Restart"), http.StatusAccepted)
+		got, err := router.ReadJSON[approval.Request](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal(int64(1), got.ID, "ID was not set")
+		require.Equal(approval.StatusPending, got.Status, "Status did not match")
+
+		resp = test_helpers.TestHandler(t, mux, "GET", "/v1/approvals?status=pending", nil, http.StatusOK)
+		list, err := router.ReadJSON[[]approval.Request](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(list, 1, "pending request was not listed")
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		testAs(t, mux, alice, "POST", "/v1/approvals/1/approve", nil, http.StatusForbidden)
+		testAs(t, mux, &db.Claims{Username: "alice", IsAdmin: true}, "POST", "/v1/approvals/1/approve", nil, http.StatusForbidden)
+		testAs(t, mux, admin, "POST", "/v1/approvals/99/approve", nil, http.StatusNotFound)
+		testAs(t, mux, admin, "POST", "/v1/approvals/x/approve", nil, http.StatusBadRequest)
+
+		resp := testAs(t, mux, admin, "POST", "/v1/approvals/1/approve", nil, http.StatusOK)
+		got, err := router.ReadJSON[history.Run](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.True(got.Passed, "run did not pass")
+		require.Equal("alice", got.User, "run was not recorded for the requester")
+
+		testAs(t, mux, admin, "POST", "/v1/approvals/1/approve", nil, http.StatusConflict)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", body("Restart"), http.StatusAccepted)
+		resp := testAs(t, mux, admin, "POST", "/v1/approvals/2/reject", nil, http.StatusOK)
+		got, err := router.ReadJSON[approval.Request](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal(approval.StatusRejected, got.Status, "Status did not match")
+	})
+
+	t.Run("approve under maintenance", func(t *testing.T) {
+		testAs(t, mux, alice, "POST", "/v1/profiles/Web/runs", body("Restart"), http.StatusAccepted)
+		w, err := windows.MaintenanceCreate(maintenance.Window{
+			Kind:   maintenance.KindServer,
+			Target: "host1",
+			Start:  time.Now().Add(-time.Minute),
+			End:    time.Now().Add(time.Hour),
+		})
+		require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+		t.Cleanup(func() { _ = windows.MaintenanceDelete(w.ID) })
+
+		resp := testAs(t, mux, admin, "POST", "/v1/approvals/3/approve", nil, http.StatusConflict)
+		require.Contains(resp.Body.String(), "host1", "warning did not name the server")
+		testAs(t, mux, admin, "POST", "/v1/approvals/3/approve?force=true", nil, http.StatusOK)
+	})
+}
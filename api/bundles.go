@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+// maxBundleSize is the largest profile bundle which can be uploaded.
+const maxBundleSize = 10 << 20
+
+// bundleImport is the response of handleBundleImport.
+type bundleImport struct {
+	Profile string         `json:"profile"`
+	Applied bool           `json:"applied"`
+	Changes bundle.Changes `json:"changes"`
+}
+
+// handleBundleExport writes the profile as a bundle. The format query parameter is yaml, the
+// default, or json.
+func handleBundleExport(logger *core.Logger, source scheduler.ProfileSource) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			profile, err := source.GetProfile(r.PathValue("profile"))
+			if err != nil {
+				renderError(logger, w, profileErrorStatus(err), err.Error())
+				return
+			}
+
+			b, err := bundle.Export(profile)
+			if err != nil {
+				renderError(logger, w, http.StatusConflict, err.Error())
+				return
+			}
+
+			format := r.URL.Query().Get("format")
+			var buf bytes.Buffer
+			if err := b.Encode(&buf, format); err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			contentType := "application/yaml"
+			if format == bundle.FormatJSON {
+				contentType = "application/json"
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				logger.Printf("bundle export: %v\n", err)
+			}
+		})
+}
+
+// handleBundleImport reads a YAML or JSON bundle from the request body and returns the changes
+// importing it makes to the profile of the same name. The changes are only applied when the apply
+// query parameter is true. Credentials are looked up in creds. Returns a 501 if the profiles cannot
+// be saved.
+func handleBundleImport(logger *core.Logger, source scheduler.ProfileSource, creds bundle.Credentials) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			b, err := bundle.Decode(http.MaxBytesReader(w, r.Body, maxBundleSize))
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			normalized, err := b.Normalize()
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			apply := r.URL.Query().Get("apply") == "true"
+			if apply {
+				profileMu.Lock()
+				defer profileMu.Unlock()
+			}
+
+			var current bundle.Bundle
+			profile, err := source.GetProfile(b.Name)
+			switch {
+			case errors.Is(err, scheduler.ErrNoProfile):
+			case err != nil:
+				renderError(logger, w, profileErrorStatus(err), err.Error())
+				return
+			default:
+				if current, err = bundle.Export(profile); err != nil {
+					renderError(logger, w, http.StatusConflict, err.Error())
+					return
+				}
+			}
+
+			resp := bundleImport{Profile: b.Name, Changes: bundle.Diff(current, normalized)}
+			if !apply {
+				if err := router.RenderJSON(w, http.StatusOK, resp); err != nil {
+					logger.Printf("bundle import: %v\n", err)
+				}
+				return
+			}
+
+			saver, ok := source.(profileSaver)
+			if !ok {
+				renderError(logger, w, http.StatusNotImplemented, "profiles cannot be changed")
+				return
+			}
+
+			// INCOMPLETE: Servers get their own buffers until run output is routed per run.
+			// Existing servers keep their IDs so their history and maintenance windows still match.
+			next, err := b.KeepIDs(current).Profile(creds, &bytes.Buffer{}, &bytes.Buffer{})
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err := saver.SaveProfile(next); err != nil {
+				renderError(logger, w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			resp.Applied = true
+			if err := router.RenderJSON(w, http.StatusOK, resp); err != nil {
+				logger.Printf("bundle import: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundle = `version: 1
+name: Web
+servers:
+  - name: web01
+    hostname: web01.example.com
+    labels: {env: prod}
+groups:
+  - name: prod
+    selector: env=prod
+tiles:
+  - name: Nginx
+    tests:
+      - type: tcp_open
+        name: http
+        args: {port: 80}
+`
+
+func TestRoutesHandleBundleExport(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	b, err := bundle.Decode(strings.NewReader(testBundle))
+	require.NoError(err, "Decode() returned an error: %s", err)
+	web, err := b.Profile(nil, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "Profile() returned an error: %s", err)
+
+	mock, err := profiles.NewProfile("Mock")
+	require.NoError(err, "NewProfile() returned an error: %s", err)
+	mock.Tiles["Mock"] = profiles.NewTile("Mock", tests.Test{Name: "mock", Tester: &tests.MockTest{}})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/profiles/{profile}/export", handleBundleExport(logger, scheduler.NewMemoryProfiles(web, mock)))
+
+	t.Run("yaml", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Web/export", nil, http.StatusOK)
+		require.Equal("application/yaml", resp.Header().Get("Content-Type"), "Content-Type did not match")
+		got, err := bundle.Decode(resp.Body)
+		require.NoError(err, "Decode() returned an error: %s", err)
+		want, err := b.Normalize()
+		require.NoError(err, "Normalize() returned an error: %s", err)
+		require.Empty(bundle.Diff(want, got), "exported bundle did not match")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Web/export?format=json", nil, http.StatusOK)
+		require.Equal("application/json", resp.Header().Get("Content-Type"), "Content-Type did not match")
+		require.Contains(resp.Body.String(), `"selector": "env=prod"`, "body was not json")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Web/export?format=xml", nil, http.StatusBadRequest)
+	})
+
+	t.Run("not exportable", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Mock/export", nil, http.StatusConflict)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Bogus/export", nil, http.StatusNotFound)
+	})
+}
+
+func TestRoutesHandleBundleImport(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	source := scheduler.NewMemoryProfiles()
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/profiles", handleBundleImport(logger, source, nil))
+	readOnly := http.NewServeMux()
+	readOnly.Handle("POST /v1/profiles", handleBundleImport(logger, scheduler.Profiles{}, nil))
+
+	read := func(resp interface{ Result() *http.Response }) bundleImport {
+		got, err := router.ReadJSON[bundleImport](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		return got
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader(testBundle), http.StatusOK)
+		got := read(resp)
+		require.False(got.Applied, "Applied was true")
+		require.Equal("Web", got.Profile, "Profile did not match")
+		require.Equal(4, got.Changes.Count(bundle.OpAdd), "Changes did not match")
+
+		_, err := source.GetProfile("Web")
+		require.ErrorIs(err, scheduler.ErrNoProfile, "dry run saved the profile")
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		test_helpers.TestHandler(t, readOnly, "POST", "/v1/profiles?apply=true", strings.NewReader(testBundle), http.StatusNotImplemented)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/profiles?apply=true", strings.NewReader(testBundle), http.StatusOK)
+		require.True(read(resp).Applied, "Applied was false")
+
+		p, err := source.GetProfile("Web")
+		require.NoError(err, "GetProfile() returned an error: %s", err)
+		require.Len(p.Servers, 1, "Servers did not match")
+
+		// Nothing changes the second time.
+		resp = test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader(testBundle), http.StatusOK)
+		require.Empty(read(resp).Changes, "Changes was not empty")
+
+		changed := strings.Replace(testBundle, "port: 80", "port: 8080", 1)
+		resp = test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader(changed), http.StatusOK)
+		require.Equal(bundle.Changes{{Op: bundle.OpUpdate, Kind: "tile", Name: "Nginx"}}, read(resp).Changes, "Changes did not match")
+	})
+
+	t.Run("missing credential", func(t *testing.T) {
+		body := "version: 1\nname: Auth\nconnectors: [{name: c, protocol: ssh, user: u, auth: [key]}]\n"
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader(body), http.StatusOK)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles?apply=true", strings.NewReader(body), http.StatusBadRequest)
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		t.Setenv("TEST_CUTTLE_KEY", "secret")
+		creds, err := bundle.LoadCredentials(strings.NewReader("credentials: [{name: key, type: ssh_password, env: TEST_CUTTLE_KEY}]"))
+		require.NoError(err, "LoadCredentials() returned an error: %s", err)
+		withCreds := http.NewServeMux()
+		withCreds.Handle("POST /v1/profiles", handleBundleImport(logger, source, creds))
+
+		body := "version: 1\nname: Auth\nconnectors: [{name: c, protocol: ssh, user: u, auth: [key]}]\n"
+		resp := test_helpers.TestHandler(t, withCreds, "POST", "/v1/profiles?apply=true", strings.NewReader(body), http.StatusOK)
+		require.True(read(resp).Applied, "Applied was false")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader("version: 2\nname: Web\n"), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles", strings.NewReader("name: [Web]"), http.StatusBadRequest)
+	})
+}
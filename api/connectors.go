@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/binding"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+// connectorDB is the part of db.CuttleDB which stores Connectors and their bindings.
+type connectorDB interface {
+	ConnectorCreate(data db.ConnectorData) (db.ConnectorData, error)
+	ConnectorGetByName(name string) (db.ConnectorData, error)
+	ConnectorList() ([]db.ConnectorData, error)
+	ConnectorDelete(name string) error
+	BindingSet(data db.BindingData) (db.BindingData, error)
+	BindingList(profile string) ([]db.BindingData, error)
+	BindingDelete(id int64) error
+}
+
+// connectorErrorStatus returns the HTTP status for an error from the connector store.
+func connectorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrRecordExists):
+		return http.StatusConflict
+	case errors.Is(err, core.ErrParamEmpty):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func handleConnectorList(logger *core.Logger, cdb connectorDB) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			list, err := cdb.ConnectorList()
+			if err != nil {
+				logger.Printf("connector list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the connectors")
+				return
+			}
+
+			if list == nil {
+				list = []db.ConnectorData{}
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, list); err != nil {
+				logger.Printf("connector list: %v\n", err)
+			}
+		})
+}
+
+// handleConnectorCreate stores a named Connector. Auth names stored AuthMethods, which are looked
+// up each time the Connector is used.
+func handleConnectorCreate(logger *core.Logger, cdb connectorDB) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			data, err := router.ReadJSON[db.ConnectorData](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err := binding.ConnectorFromData(data).Validate(); err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			data, err = cdb.ConnectorCreate(data)
+			if err != nil {
+				renderError(logger, w, connectorErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusCreated, data); err != nil {
+				logger.Printf("connector create: %v\n", err)
+			}
+		})
+}
+
+// handleConnectorDelete deletes the Connector and every binding to it.
+func handleConnectorDelete(logger *core.Logger, cdb connectorDB) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if err := cdb.ConnectorDelete(r.PathValue("name")); err != nil {
+				renderError(logger, w, connectorErrorStatus(err), err.Error())
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+func handleBindingList(logger *core.Logger, cdb connectorDB) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			list, err := cdb.BindingList(r.PathValue("profile"))
+			if err != nil {
+				logger.Printf("binding list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the bindings")
+				return
+			}
+
+			if list == nil {
+				list = []db.BindingData{}
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, list); err != nil {
+				logger.Printf("binding list: %v\n", err)
+			}
+		})
+}
+
+// handleBindingSet binds a stored Connector to a Group of the profile, or to one Tile of the Group.
+// A binding for the same Group and Tile is replaced. The Group is checked if source is not nil.
+func handleBindingSet(logger *core.Logger, cdb connectorDB, source scheduler.ProfileSource) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			data, err := router.ReadJSON[db.BindingData](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			// The path decides which profile is bound.
+			data.Profile = r.PathValue("profile")
+			if _, err := cdb.ConnectorGetByName(data.Connector); err != nil {
+				status := connectorErrorStatus(err)
+				if status == http.StatusNotFound {
+					status = http.StatusBadRequest
+				}
+
+				renderError(logger, w, status, "connector not found: "+data.Connector)
+				return
+			}
+
+			if source != nil {
+				p, err := source.GetProfile(data.Profile)
+				if err != nil {
+					renderError(logger, w, http.StatusNotFound, err.Error())
+					return
+				}
+
+				if _, err := p.GetGroup(data.Group); err != nil {
+					renderError(logger, w, http.StatusBadRequest, err.Error())
+					return
+				}
+			}
+
+			data, err = cdb.BindingSet(data)
+			if err != nil {
+				renderError(logger, w, connectorErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, data); err != nil {
+				logger.Printf("binding set: %v\n", err)
+			}
+		})
+}
+
+func handleBindingDelete(logger *core.Logger, cdb connectorDB) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil || id < 1 {
+				renderError(logger, w, http.StatusBadRequest, "invalid binding id: "+r.PathValue("id"))
+				return
+			}
+
+			if err := cdb.BindingDelete(id); err != nil {
+				renderError(logger, w, connectorErrorStatus(err), err.Error())
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
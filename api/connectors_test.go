@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+// testConnectorDB is a connectorDB kept in memory.
+type testConnectorDB struct {
+	connectors []db.ConnectorData
+	bindings   []db.BindingData
+}
+
+func (t *testConnectorDB) ConnectorCreate(data db.ConnectorData) (db.ConnectorData, error) {
+	if _, err := t.ConnectorGetByName(data.Name); err == nil {
+		return data, db.ErrRecordExists
+	}
+
+	data.ID = int64(len(t.connectors) + 1)
+	t.connectors = append(t.connectors, data)
+	return data, nil
+}
+
+func (t *testConnectorDB) ConnectorGetByName(name string) (db.ConnectorData, error) {
+	for _, c := range t.connectors {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+
+	return db.ConnectorData{}, sql.ErrNoRows
+}
+
+func (t *testConnectorDB) ConnectorList() ([]db.ConnectorData, error) { return t.connectors, nil }
+
+func (t *testConnectorDB) ConnectorDelete(name string) error {
+	for i, c := range t.connectors {
+		if c.Name == name {
+			t.connectors = append(t.connectors[:i], t.connectors[i+1:]...)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (t *testConnectorDB) BindingSet(data db.BindingData) (db.BindingData, error) {
+	data.ID = int64(len(t.bindings) + 1)
+	t.bindings = append(t.bindings, data)
+	return data, nil
+}
+
+func (t *testConnectorDB) BindingList(profile string) ([]db.BindingData, error) {
+	var list []db.BindingData
+	for _, b := range t.bindings {
+		if b.Profile == profile {
+			list = append(list, b)
+		}
+	}
+
+	return list, nil
+}
+
+func (t *testConnectorDB) BindingDelete(id int64) error {
+	for i, b := range t.bindings {
+		if b.ID == id {
+			t.bindings = append(t.bindings[:i], t.bindings[i+1:]...)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func TestRoutesHandleConnectors(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+	server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+	web, err := profiles.NewProfile("Web", profiles.NewGroup("prod", server))
+	require.NoError(err, "NewProfile() returned an error: %s", err)
+
+	cdb := &testConnectorDB{}
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/connectors", handleConnectorList(logger, cdb))
+	mux.Handle("POST /v1/connectors", handleConnectorCreate(logger, cdb))
+	mux.Handle("DELETE /v1/connectors/{name}", handleConnectorDelete(logger, cdb))
+	mux.Handle("GET /v1/profiles/{profile}/bindings", handleBindingList(logger, cdb))
+	mux.Handle("PUT /v1/profiles/{profile}/bindings", handleBindingSet(logger, cdb, scheduler.NewMemoryProfiles(web)))
+	mux.Handle("DELETE /v1/profiles/{profile}/bindings/{id}", handleBindingDelete(logger, cdb))
+
+	t.Run("empty list", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/connectors", nil, http.StatusOK)
+		require.Equal("[]\n", resp.Body.String(), "handler did not return an empty list")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		body := `{"name":"deploy","protocol":"ssh","user":"deploy","auth":["deploy-key"]}`
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/connectors", strings.NewReader(body), http.StatusCreated)
+		got, err := router.ReadJSON[db.ConnectorData](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal([]string{"deploy-key"}, got.Auth, "Auth did not match")
+
+		test_helpers.TestHandler(t, mux, "POST", "/v1/connectors", strings.NewReader(body), http.StatusConflict)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/connectors", strings.NewReader(`{"name":"c","protocol":"rdp","user":"u"}`), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/connectors", strings.NewReader(`{`), http.StatusBadRequest)
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		body := `{"group":"prod","tile":"Backup","connector":"deploy"}`
+		resp := test_helpers.TestHandler(t, mux, "PUT", "/v1/profiles/Web/bindings", strings.NewReader(body), http.StatusOK)
+		got, err := router.ReadJSON[db.BindingData](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal("Web", got.Profile, "Profile was not set from the path")
+
+		resp = test_helpers.TestHandler(t, mux, "GET", "/v1/profiles/Web/bindings", nil, http.StatusOK)
+		list, err := router.ReadJSON[[]db.BindingData](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(list, 1, "handler did not return every binding")
+	})
+
+	t.Run("bind invalid", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "PUT", "/v1/profiles/Web/bindings", strings.NewReader(`{"group":"prod","connector":"gone"}`), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "PUT", "/v1/profiles/Web/bindings", strings.NewReader(`{"group":"dev","connector":"deploy"}`), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "PUT", "/v1/profiles/Missing/bindings", strings.NewReader(`{"group":"prod","connector":"deploy"}`), http.StatusNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/profiles/Web/bindings/1", nil, http.StatusNoContent)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/profiles/Web/bindings/1", nil, http.StatusNotFound)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/profiles/Web/bindings/none", nil, http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/connectors/deploy", nil, http.StatusNoContent)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/connectors/deploy", nil, http.StatusNotFound)
+	})
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/chadeldridge/cuttle-server/core"
 	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
 )
 
 func handleTest(logger *core.Logger) http.Handler {
@@ -17,3 +20,77 @@ func handleTest(logger *core.Logger) http.Handler {
 			}
 		})
 }
+
+// handleTestSchemas returns the TestArg schema of every test type so clients can build forms.
+func handleTestSchemas(logger *core.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			err := router.RenderJSON(w, http.StatusOK, tests.DefaultRegistry.Schemas())
+			if err != nil {
+				logger.Printf("test schemas: %v\n", err)
+			}
+		})
+}
+
+// handleTestSchema returns the TestArg schema of the test type in the path.
+func handleTestSchema(logger *core.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			typ := r.PathValue("type")
+			schema, ok := tests.DefaultRegistry.Schemas()[typ]
+			if !ok {
+				err := router.RenderJSON(w, http.StatusNotFound, struct{ Error string }{Error: "unknown test type: " + typ})
+				if err != nil {
+					logger.Printf("test schema: %v\n", err)
+				}
+
+				return
+			}
+
+			err := router.RenderJSON(w, http.StatusOK, schema)
+			if err != nil {
+				logger.Printf("test schema: %v\n", err)
+			}
+		})
+}
+
+// handleAuditList returns the newest audit log entries. The optional "limit" query sets how many.
+func handleAuditList(logger *core.Logger, recorder audit.Recorder) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			limit := 100
+			if q := r.URL.Query().Get("limit"); q != "" {
+				n, err := strconv.Atoi(q)
+				if err != nil || n < 1 {
+					err := router.RenderJSON(w, http.StatusBadRequest, struct{ Error string }{Error: "invalid limit: " + q})
+					if err != nil {
+						logger.Printf("audit list: %v\n", err)
+					}
+
+					return
+				}
+
+				limit = n
+			}
+
+			entries, err := recorder.AuditList(limit)
+			if err != nil {
+				logger.Printf("audit list: %v\n", err)
+				err := router.RenderJSON(w, http.StatusInternalServerError, struct{ Error string }{Error: "failed to read the audit log"})
+				if err != nil {
+					logger.Printf("audit list: %v\n", err)
+				}
+
+				return
+			}
+
+			if entries == nil {
+				entries = []audit.Entry{}
+			}
+
+			err = router.RenderJSON(w, http.StatusOK, entries)
+			if err != nil {
+				logger.Printf("audit list: %v\n", err)
+			}
+		})
+}
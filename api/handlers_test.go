@@ -7,6 +7,8 @@ import (
 
 	"github.com/chadeldridge/cuttle-server/core"
 	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
 	"github.com/chadeldridge/cuttle-server/test_helpers"
 	"github.com/stretchr/testify/require"
 )
@@ -39,3 +41,64 @@ func TestRoutesHandleTest(t *testing.T) {
 	require.NoError(err, "decode() returned an error: %s", err)
 	require.Equal(exp, got, "handler returned wrong body")
 }
+
+func TestRoutesHandleTestSchemas(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	resp := test_helpers.TestHandler(t, handleTestSchemas(logger), "GET", "/v1/tests/schemas", nil, http.StatusOK)
+	got, err := router.ReadJSON[map[string][]map[string]any](&http.Request{Body: resp.Result().Body})
+	require.NoError(err, "decode() returned an error: %s", err)
+	require.Len(got, len(tests.DefaultRegistry.Types()), "handler did not return every schema")
+	require.Contains(got, "ping", "handler did not return the ping schema")
+}
+
+func TestRoutesHandleTestSchema(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/tests/schemas/{type}", handleTestSchema(logger))
+
+	t.Run("found", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/tests/schemas/ping", nil, http.StatusOK)
+		got, err := router.ReadJSON[tests.ArgSchema](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+
+		spec, ok := got.Find("count")
+		require.True(ok, "handler did not return the count arg")
+		require.Equal(tests.ArgInt, spec.Type, "count arg type did not match")
+		require.Equal(0, *spec.Min, "count arg min did not match")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", "/v1/tests/schemas/bogus", nil, http.StatusNotFound)
+	})
+}
+
+func TestRoutesHandleAuditList(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+	log := audit.NewLog()
+	for _, outcome := range []string{audit.OutcomeDenied, audit.OutcomeSuccess} {
+		require.NoError(log.AuditRecord(audit.Entry{User: "admin", Action: audit.ActionRemediate, Tile: "Nginx", Outcome: outcome}))
+	}
+
+	t.Run("all", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, handleAuditList(logger, log), "GET", "/v1/audit", nil, http.StatusOK)
+		got, err := router.ReadJSON[[]audit.Entry](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 2, "handler did not return every entry")
+		require.Equal(audit.OutcomeSuccess, got[0].Outcome, "entries were not newest first")
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, handleAuditList(logger, log), "GET", "/v1/audit?limit=1", nil, http.StatusOK)
+		got, err := router.ReadJSON[[]audit.Entry](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 1, "handler did not honor the limit")
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		test_helpers.TestHandler(t, handleAuditList(logger, log), "GET", "/v1/audit?limit=none", nil, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/inventory"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+// maxInventorySize is the largest inventory file which can be uploaded.
+const maxInventorySize = 10 << 20
+
+// profileSaver is a ProfileSource which can store changed Profiles.
+type profileSaver interface {
+	SaveProfile(p profiles.Profile) error
+}
+
+// profileMu is held from reading a Profile to saving it so imports applied at the same time do
+// not overwrite each other's changes.
+var profileMu sync.Mutex
+
+// inventoryImport is the response of handleInventoryImport.
+type inventoryImport struct {
+	Applied bool           `json:"applied"`
+	Plan    inventory.Plan `json:"plan"`
+}
+
+// handleInventoryImport reads the inventory file in the request body and returns the plan to import
+// it into the profile. The format query parameter is required. The plan is only applied when apply
+// is true and the plan has no conflicts. Returns a 501 if the profiles cannot be saved.
+func handleInventoryImport(logger *core.Logger, source scheduler.ProfileSource) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			apply := r.URL.Query().Get("apply") == "true"
+			if apply {
+				profileMu.Lock()
+				defer profileMu.Unlock()
+			}
+
+			profile, err := source.GetProfile(r.PathValue("profile"))
+			if err != nil {
+				renderError(logger, w, profileErrorStatus(err), err.Error())
+				return
+			}
+
+			inv, err := inventory.Parse(r.URL.Query().Get("format"), http.MaxBytesReader(w, r.Body, maxInventorySize))
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			resp := inventoryImport{Plan: inventory.NewPlan(profile, inv)}
+			if !apply {
+				if err := router.RenderJSON(w, http.StatusOK, resp); err != nil {
+					logger.Printf("inventory import: %v\n", err)
+				}
+				return
+			}
+
+			saver, ok := source.(profileSaver)
+			if !ok {
+				renderError(logger, w, http.StatusNotImplemented, "profiles cannot be changed")
+				return
+			}
+
+			if resp.Plan.HasConflicts() {
+				if err := router.RenderJSON(w, http.StatusConflict, resp); err != nil {
+					logger.Printf("inventory import: %v\n", err)
+				}
+				return
+			}
+
+			// INCOMPLETE: Imported servers get their own buffers until run output is routed per run.
+			if err := inventory.Apply(&profile, resp.Plan, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err := saver.SaveProfile(profile); err != nil {
+				renderError(logger, w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			resp.Applied = true
+			if err := router.RenderJSON(w, http.StatusOK, resp); err != nil {
+				logger.Printf("inventory import: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutesHandleInventoryImport(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	db1, err := connections.NewServer("db1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+	profile := profiles.Profile{Name: "Data"}
+	profile.AddServers(db1)
+
+	source := scheduler.NewMemoryProfiles(profile)
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/profiles/{profile}/import", handleInventoryImport(logger, source))
+	readOnly := http.NewServeMux()
+	readOnly.Handle("POST /v1/profiles/{profile}/import", handleInventoryImport(logger, scheduler.Profiles{"Data": profile}))
+
+	csv := "name,hostname,groups,env\ndb2,db2.example.com,db,prod\n"
+	path := "/v1/profiles/Data/import?format=csv"
+
+	t.Run("dry run", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", path, strings.NewReader(csv), http.StatusOK)
+		got, err := router.ReadJSON[inventoryImport](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.False(got.Applied, "Applied was true")
+		require.Len(got.Plan.Add, 1, "Add did not match")
+		require.Equal("db2", got.Plan.Add[0].Name, "Add did not match")
+
+		p, err := source.GetProfile("Data")
+		require.NoError(err, "GetProfile() returned an error: %s", err)
+		require.Len(p.Servers, 1, "dry run changed the profile")
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		body := strings.NewReader("name,hostname\nother,db1\n")
+		resp := test_helpers.TestHandler(t, mux, "POST", path+"&apply=true", body, http.StatusConflict)
+		require.Contains(resp.Body.String(), `"applied":false`, "Applied was not false")
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		test_helpers.TestHandler(t, readOnly, "POST", path+"&apply=true", strings.NewReader(csv), http.StatusNotImplemented)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", path+"&apply=true", strings.NewReader(csv), http.StatusOK)
+		require.Contains(resp.Body.String(), `"applied":true`, "Applied was not true")
+
+		p, err := source.GetProfile("Data")
+		require.NoError(err, "GetProfile() returned an error: %s", err)
+		require.Len(p.Servers, 2, "servers were not imported")
+		g, err := p.GetGroup("db")
+		require.NoError(err, "GetGroup() returned an error: %s", err)
+		require.Equal(1, g.Count(), "group was not created")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles/Data/import?format=xml", strings.NewReader(csv), http.StatusBadRequest)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "POST", "/v1/profiles/Bogus/import?format=csv", strings.NewReader(csv), http.StatusNotFound)
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+)
+
+// maintenanceErrorStatus returns the HTTP status for an error from the maintenance store.
+func maintenanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, maintenance.ErrInvalidWindow):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleMaintenanceList returns the maintenance windows. Windows can be filtered with the profile
+// query parameter, and active=true returns only the windows active now.
+func handleMaintenanceList(logger *core.Logger, store maintenance.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			filter := maintenance.Filter{Profile: q.Get("profile")}
+			if q.Get("active") == "true" {
+				filter.ActiveAt = time.Now()
+			}
+
+			list, err := store.MaintenanceList(filter)
+			if err != nil {
+				logger.Printf("maintenance list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the maintenance windows")
+				return
+			}
+
+			if list == nil {
+				list = []maintenance.Window{}
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, list); err != nil {
+				logger.Printf("maintenance list: %v\n", err)
+			}
+		})
+}
+
+// handleMaintenanceCreate stores a maintenance window. The user is taken from the session when
+// there is one.
+func handleMaintenanceCreate(logger *core.Logger, store maintenance.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			window, err := router.ReadJSON[maintenance.Window](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if claims, ok := r.Context().Value(router.ClaimsKey).(*db.Claims); ok {
+				window.User = claims.Username
+			}
+
+			window, err = store.MaintenanceCreate(window)
+			if err != nil {
+				renderError(logger, w, maintenanceErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusCreated, window); err != nil {
+				logger.Printf("maintenance create: %v\n", err)
+			}
+		})
+}
+
+// handleMaintenanceDelete ends a maintenance window early by deleting it.
+func handleMaintenanceDelete(logger *core.Logger, store maintenance.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil || id < 1 {
+				renderError(logger, w, http.StatusBadRequest, "invalid maintenance id: "+r.PathValue("id"))
+				return
+			}
+
+			if err := store.MaintenanceDelete(id); err != nil {
+				renderError(logger, w, maintenanceErrorStatus(err), err.Error())
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutesHandleMaintenance(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+	store := maintenance.NewList()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/maintenance", handleMaintenanceList(logger, store))
+	mux.Handle("POST /v1/maintenance", handleMaintenanceCreate(logger, store))
+	mux.Handle("DELETE /v1/maintenance/{id}", handleMaintenanceDelete(logger, store))
+
+	start := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `{"profile":"Web","kind":"group","target":"Prod","reason":"patching","start":"` + start + `","end":"` + end + `"}`
+
+	t.Run("create", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/maintenance", strings.NewReader(body), http.StatusCreated)
+		got, err := router.ReadJSON[maintenance.Window](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal(int64(1), got.ID, "ID was not set")
+		require.Equal("Prod", got.Target, "Target did not match")
+
+		test_helpers.TestHandler(t, mux, "POST", "/v1/maintenance", strings.NewReader(`{"kind":"rack"}`), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/maintenance", strings.NewReader(`{`), http.StatusBadRequest)
+	})
+
+	t.Run("create user", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), router.ClaimsKey, &db.Claims{Username: "admin"})
+		req := httptest.NewRequest("POST", "/v1/maintenance", strings.NewReader(body)).WithContext(ctx)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		require.Equal(http.StatusCreated, resp.Code, "status did not match")
+
+		got, err := router.ReadJSON[maintenance.Window](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal("admin", got.User, "User was not taken from the session")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		_, err := store.MaintenanceCreate(maintenance.Window{
+			Profile: "DB",
+			Kind:    maintenance.KindServer,
+			Target:  "db01",
+			Start:   time.Now().Add(time.Hour),
+			End:     time.Now().Add(2 * time.Hour),
+		})
+		require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+
+		for path, want := range map[string]int{
+			"/v1/maintenance":                         3,
+			"/v1/maintenance?profile=DB":              1,
+			"/v1/maintenance?active=true":             2,
+			"/v1/maintenance?profile=DB&active=true":  0,
+			"/v1/maintenance?profile=Web&active=true": 2,
+		} {
+			resp := test_helpers.TestHandler(t, mux, "GET", path, nil, http.StatusOK)
+			got, err := router.ReadJSON[[]maintenance.Window](&http.Request{Body: resp.Result().Body})
+			require.NoError(err, "decode() returned an error: %s", err)
+			require.Len(got, want, "%s did not match", path)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/maintenance/3", nil, http.StatusNoContent)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/maintenance/3", nil, http.StatusNotFound)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/maintenance/x", nil, http.StatusBadRequest)
+	})
+
+	t.Run("schedule run", func(t *testing.T) {
+		server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "connections.NewServer() returned an error: %s", err)
+		source := scheduler.Profiles{"Web": {
+			Name:   "Web",
+			Tiles:  map[string]profiles.Tile{"Nginx": profiles.NewTile("Nginx", tests.Test{Name: "Pass", Tester: testPass{}})},
+			Groups: map[string]profiles.Group{"Prod": profiles.NewGroup("Prod", server)},
+		}}
+
+		s, err := scheduler.New(scheduler.NewMemoryStore(), source, history.NewLog(), nil)
+		require.NoError(err, "scheduler.New() returned an error: %s", err)
+		s.SetMaintenance(store)
+		_, err = s.Create(scheduler.Schedule{Name: "Hourly", Profile: "Web", Tile: "Nginx", Group: "Prod", Cron: "@hourly"})
+		require.NoError(err, "Create() returned an error: %s", err)
+		mux.Handle("POST /v1/schedules/{id}/run", handleScheduleRun(logger, s))
+
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/1/run", nil, http.StatusConflict)
+		require.Contains(resp.Body.String(), "host1", "warning did not name the server")
+		test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/1/run?force=true", nil, http.StatusOK)
+	})
+}
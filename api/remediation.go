@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+)
+
+// remediateRequest is the body of a remediation. Confirmed must be true if the Remediation
+// requires confirmation.
+type remediateRequest struct {
+	Group     string `json:"group"`
+	Confirmed bool   `json:"confirmed"`
+}
+
+// remediateResult is the outcome of a remediation on a single server.
+type remediateResult struct {
+	Server  string `json:"server"`
+	Needed  bool   `json:"needed"`
+	Passed  bool   `json:"passed"` // The check passed, or the recheck passed after the actions.
+	Check   string `json:"check"`
+	Actions string `json:"actions,omitempty"`
+	Recheck string `json:"recheck,omitempty"`
+}
+
+func newRemediateResult(res profiles.RemediationResult) remediateResult {
+	out := remediateResult{Server: res.Check.Server, Needed: res.Needed(), Check: res.Check.String()}
+	if !out.Needed {
+		out.Passed = true
+		return out
+	}
+
+	out.Actions = res.Actions.String()
+	if len(res.Recheck.Tests) > 0 {
+		out.Passed = res.Recheck.Passed()
+		out.Recheck = res.Recheck.String()
+	}
+
+	return out
+}
+
+// remediateErrorStatus returns the HTTP status for an error from a remediation.
+func remediateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, profiles.ErrNotPermitted):
+		return http.StatusForbidden
+	case errors.Is(err, profiles.ErrConfirmationRequired), errors.Is(err, profiles.ErrUnderMaintenance),
+		errors.Is(err, profiles.ErrApprovalRequired):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// handleTileRemediate runs the Remediation of a Tile against the servers of a group and returns the
+// result for each server. Returns a 409 if the remediation was not confirmed, or listing the servers
+// in maintenance unless the force query parameter is true. Failed remediations are still returned
+// with a 200 since they were recorded in the audit log.
+func handleTileRemediate(logger *core.Logger, source scheduler.ProfileSource, rec audit.Recorder, windows maintenance.Store) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user, perms, ok := sessionUser(logger, w, r)
+			if !ok {
+				return
+			}
+
+			body, err := router.ReadJSON[remediateRequest](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			p, err := source.GetProfile(r.PathValue("profile"))
+			if err != nil {
+				renderError(logger, w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			if windows != nil {
+				active, err := maintenance.Active(windows, p.Name)
+				if err != nil {
+					logger.Printf("tile remediate: %v\n", err)
+				}
+
+				p.Silence(active, time.Now())
+			}
+
+			results, err := p.Remediate(r.Context(), r.PathValue("tile"), body.Group, profiles.RemediateRequest{
+				User:              user,
+				Perms:             perms,
+				Confirmed:         body.Confirmed,
+				IgnoreMaintenance: r.URL.Query().Get("force") == "true",
+				Audit:             rec,
+			})
+			if err != nil && len(results) == 0 {
+				renderError(logger, w, remediateErrorStatus(err), err.Error())
+				return
+			}
+
+			out := make([]remediateResult, 0, len(results))
+			for _, res := range results {
+				out = append(out, newRemediateResult(res))
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, out); err != nil {
+				logger.Printf("tile remediate: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/stretchr/testify/require"
+)
+
+// testUp fails until the restart action sets up.
+type testUp struct{ up *bool }
+
+func (t testUp) Run(server connections.Server, args ...tests.TestArg) error {
+	if !*t.up {
+		return tests.ErrTestFailed
+	}
+
+	return nil
+}
+
+// testRestart sets up.
+type testRestart struct{ up *bool }
+
+func (t testRestart) Run(server connections.Server, args ...tests.TestArg) error {
+	*t.up = true
+	return nil
+}
+
+func TestRoutesHandleTileRemediate(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	up := false
+	server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+	tile := profiles.NewTile("Nginx", tests.Test{Name: "Up", MustSucceed: true, Tester: testUp{up: &up}})
+	require.NoError(tile.SetRemediation(profiles.NewRemediation("Restart nginx", tests.Test{Name: "Restart", Tester: testRestart{up: &up}})))
+	source := scheduler.Profiles{"Web": {
+		Name:   "Web",
+		Tiles:  map[string]profiles.Tile{"Nginx": tile},
+		Groups: map[string]profiles.Group{"Prod": profiles.NewGroup("Prod", server)},
+	}}
+
+	log := audit.NewLog()
+	windows := maintenance.NewList()
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/profiles/{profile}/tiles/{tile}/remediate", handleTileRemediate(logger, source, log, windows))
+
+	alice := &db.Claims{Username: "alice"}
+	admin := &db.Claims{Username: "bob", IsAdmin: true}
+	path := "/v1/profiles/Web/tiles/Nginx/remediate"
+	body := func(confirmed bool) *strings.Reader {
+		if confirmed {
+			return strings.NewReader(`{"group":"Prod","confirmed":true}`)
+		}
+
+		return strings.NewReader(`{"group":"Prod"}`)
+	}
+
+	t.Run("denied", func(t *testing.T) {
+		testAs(t, mux, nil, "POST", path, body(true), http.StatusUnauthorized)
+		testAs(t, mux, alice, "POST", path, body(true), http.StatusForbidden)
+		testAs(t, mux, admin, "POST", path, body(false), http.StatusConflict)
+		testAs(t, mux, admin, "POST", "/v1/profiles/DB/tiles/Nginx/remediate", body(true), http.StatusNotFound)
+		testAs(t, mux, admin, "POST", "/v1/profiles/Web/tiles/Missing/remediate", body(true), http.StatusBadRequest)
+		require.False(up, "remediation ran")
+	})
+
+	t.Run("under maintenance", func(t *testing.T) {
+		w, err := windows.MaintenanceCreate(maintenance.Window{
+			Kind:   maintenance.KindServer,
+			Target: "host1",
+			Start:  time.Now().Add(-time.Minute),
+			End:    time.Now().Add(time.Hour),
+		})
+		require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+		defer func() { _ = windows.MaintenanceDelete(w.ID) }()
+
+		resp := testAs(t, mux, admin, "POST", path, body(true), http.StatusConflict)
+		require.Contains(resp.Body.String(), "host1", "warning did not name the server")
+		require.False(up, "remediation ran")
+	})
+
+	t.Run("remediate", func(t *testing.T) {
+		resp := testAs(t, mux, admin, "POST", path, body(true), http.StatusOK)
+		got, err := router.ReadJSON[[]remediateResult](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 1, "result was not returned for the server")
+		require.True(got[0].Needed, "remediation was not needed")
+		require.True(got[0].Passed, "recheck did not pass")
+		require.True(up, "action did not run")
+
+		entries, _ := log.AuditList(1)
+		require.Equal(audit.OutcomeSuccess, entries[0].Outcome, "remediation was not audited")
+		require.Equal("bob", entries[0].User, "audit user did not match")
+	})
+}
@@ -6,7 +6,8 @@ import (
 
 func AddRoutes(server *router.HTTPServer) error {
 	mwLogger := router.LoggerMiddleware(server.Logger)
-	mwAuth := router.APIAuthMiddleware(server.Logger, server.CuttleDB)
+	mwAuth := router.APIAuthMiddleware(server.Logger, server.AuthDB)
+	mwAdmin := router.APIAdminMiddleware(server.Logger)
 	root, err := router.NewRouterGroup(server.Mux, "/api")
 	if err != nil {
 		return err
@@ -18,6 +19,50 @@ func AddRoutes(server *router.HTTPServer) error {
 	// v1.GET("/test", handleTest(server.logger), AuthMiddleware(server.logger))
 	v1.GET("/metrics", router.HandleMetrics(server.Logger), mwLogger)
 	v1.GET("/test", handleTest(server.Logger), mwLogger, mwAuth)
+	v1.GET("/tests/schemas", handleTestSchemas(server.Logger), mwLogger, mwAuth)
+	v1.GET("/tests/schemas/{type}", handleTestSchema(server.Logger), mwLogger, mwAuth)
+	v1.GET("/audit", handleAuditList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+	v1.GET("/runs", handleRunList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+	v1.GET("/connectors", handleConnectorList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+	v1.POST("/connectors", handleConnectorCreate(server.Logger, server.CuttleDB), mwLogger, mwAuth, mwAdmin)
+	v1.DELETE("/connectors/{name}", handleConnectorDelete(server.Logger, server.CuttleDB), mwLogger, mwAuth, mwAdmin)
+	v1.GET("/profiles/{profile}/bindings", handleBindingList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+	v1.PUT("/profiles/{profile}/bindings", handleBindingSet(server.Logger, server.CuttleDB, server.Profiles), mwLogger, mwAuth, mwAdmin)
+	v1.DELETE("/profiles/{profile}/bindings/{id}", handleBindingDelete(server.Logger, server.CuttleDB), mwLogger, mwAuth, mwAdmin)
+	// INCOMPLETE: The web UI has no maintenance page yet so windows can only be managed here.
+	v1.GET("/maintenance", handleMaintenanceList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+	v1.POST("/maintenance", handleMaintenanceCreate(server.Logger, server.CuttleDB), mwLogger, mwAuth, mwAdmin)
+	v1.DELETE("/maintenance/{id}", handleMaintenanceDelete(server.Logger, server.CuttleDB), mwLogger, mwAuth, mwAdmin)
+	if server.Profiles != nil {
+		v1.GET("/profiles/{profile}/selector", handleSelectorPreview(server.Logger, server.Profiles), mwLogger, mwAuth)
+		v1.POST("/profiles/{profile}/import", handleInventoryImport(server.Logger, server.Profiles), mwLogger, mwAuth, mwAdmin)
+		v1.GET("/profiles/{profile}/export", handleBundleExport(server.Logger, server.Profiles), mwLogger, mwAuth)
+		v1.POST("/profiles", handleBundleImport(server.Logger, server.Profiles, server.Credentials), mwLogger, mwAuth, mwAdmin)
+		// Remediations, manual runs, and approvals check permissions themselves so denied attempts
+		// are audited. They run with the Connectors bound in cuttle.db like scheduled runs.
+		// INCOMPLETE: The web UI has no approvals page yet.
+		bound := server.BoundProfiles
+		if bound == nil {
+			bound = server.Profiles
+		}
+
+		v1.POST("/profiles/{profile}/tiles/{tile}/remediate", handleTileRemediate(server.Logger, bound, server.CuttleDB, server.CuttleDB), mwLogger, mwAuth)
+		v1.POST("/profiles/{profile}/runs", handleProfileRun(server.Logger, bound, server.CuttleDB, server.CuttleDB), mwLogger, mwAuth)
+		v1.GET("/approvals", handleApprovalList(server.Logger, server.CuttleDB), mwLogger, mwAuth)
+		v1.POST("/approvals/{id}/approve", handleApprovalDecide(server.Logger, bound, server.CuttleDB, server.CuttleDB, true), mwLogger, mwAuth)
+		v1.POST("/approvals/{id}/reject", handleApprovalDecide(server.Logger, bound, server.CuttleDB, server.CuttleDB, false), mwLogger, mwAuth)
+	}
+
+	if s := server.Scheduler; s != nil {
+		v1.GET("/schedules", handleScheduleList(server.Logger, s), mwLogger, mwAuth)
+		v1.POST("/schedules", handleScheduleCreate(server.Logger, s), mwLogger, mwAuth, mwAdmin)
+		v1.GET("/schedules/{id}", handleScheduleGet(server.Logger, s), mwLogger, mwAuth)
+		v1.PUT("/schedules/{id}", handleScheduleUpdate(server.Logger, s), mwLogger, mwAuth, mwAdmin)
+		v1.DELETE("/schedules/{id}", handleScheduleDelete(server.Logger, s), mwLogger, mwAuth, mwAdmin)
+		v1.POST("/schedules/{id}/pause", handleSchedulePause(server.Logger, s, true), mwLogger, mwAuth, mwAdmin)
+		v1.POST("/schedules/{id}/resume", handleSchedulePause(server.Logger, s, false), mwLogger, mwAuth, mwAdmin)
+		v1.POST("/schedules/{id}/run", handleScheduleRun(server.Logger, s), mwLogger, mwAuth, mwAdmin)
+	}
 	// v1.GET("/login", handleLoginGet(server.logger, server), mwLogger)
 
 	return nil
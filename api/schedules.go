@@ -0,0 +1,242 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/history"
+)
+
+// renderError writes a JSON error response and logs anything which fails.
+func renderError(logger *core.Logger, w http.ResponseWriter, status int, msg string) {
+	if err := router.RenderJSON(w, status, struct{ Error string }{Error: msg}); err != nil {
+		logger.Printf("render error: %v\n", err)
+	}
+}
+
+// scheduleErrorStatus returns the HTTP status for an error from the scheduler.
+func scheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, scheduler.ErrScheduleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		return http.StatusBadRequest
+	case errors.Is(err, scheduler.ErrAlreadyRunning), errors.Is(err, profiles.ErrUnderMaintenance):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// scheduleID parses the {id} path value. Writes a 400 response and returns false if it is invalid.
+func scheduleID(logger *core.Logger, w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		renderError(logger, w, http.StatusBadRequest, "invalid schedule id: "+r.PathValue("id"))
+		return 0, false
+	}
+
+	return id, true
+}
+
+func handleScheduleList(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			list, err := s.List()
+			if err != nil {
+				logger.Printf("schedule list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the schedules")
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, list); err != nil {
+				logger.Printf("schedule list: %v\n", err)
+			}
+		})
+}
+
+func handleScheduleGet(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, ok := scheduleID(logger, w, r)
+			if !ok {
+				return
+			}
+
+			st, err := s.Get(id)
+			if err != nil {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, st); err != nil {
+				logger.Printf("schedule get: %v\n", err)
+			}
+		})
+}
+
+func handleScheduleCreate(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			sched, err := router.ReadJSON[scheduler.Schedule](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			sched, err = s.Create(sched)
+			if err != nil {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusCreated, sched); err != nil {
+				logger.Printf("schedule create: %v\n", err)
+			}
+		})
+}
+
+func handleScheduleUpdate(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, ok := scheduleID(logger, w, r)
+			if !ok {
+				return
+			}
+
+			sched, err := router.ReadJSON[scheduler.Schedule](r)
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			// The path decides which schedule is updated.
+			sched.ID = id
+			sched, err = s.Update(sched)
+			if err != nil {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, sched); err != nil {
+				logger.Printf("schedule update: %v\n", err)
+			}
+		})
+}
+
+func handleScheduleDelete(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, ok := scheduleID(logger, w, r)
+			if !ok {
+				return
+			}
+
+			if err := s.Delete(id); err != nil {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+// handleSchedulePause pauses the schedule if pause is true and resumes it otherwise.
+func handleSchedulePause(logger *core.Logger, s *scheduler.Scheduler, pause bool) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, ok := scheduleID(logger, w, r)
+			if !ok {
+				return
+			}
+
+			var sched scheduler.Schedule
+			var err error
+			if pause {
+				sched, err = s.Pause(id)
+			} else {
+				sched, err = s.Resume(id)
+			}
+
+			if err != nil {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, sched); err != nil {
+				logger.Printf("schedule pause: %v\n", err)
+			}
+		})
+}
+
+// handleScheduleRun runs the schedule now and returns the run. A run which fails is still returned
+// with a 200 since it was recorded in the history. Returns a 409 listing the servers in maintenance
+// unless the force query parameter is true.
+func handleScheduleRun(logger *core.Logger, s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			id, ok := scheduleID(logger, w, r)
+			if !ok {
+				return
+			}
+
+			run, err := s.RunNow(id, r.URL.Query().Get("force") == "true")
+			if err != nil && run.ID == 0 {
+				renderError(logger, w, scheduleErrorStatus(err), err.Error())
+				return
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, run); err != nil {
+				logger.Printf("schedule run: %v\n", err)
+			}
+		})
+}
+
+// handleRunList returns the run history, newest first. Runs can be filtered with the profile,
+// tile, schedule_id, and limit query parameters. The limit defaults to 100.
+func handleRunList(logger *core.Logger, recorder history.Recorder) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			filter := history.Filter{Profile: q.Get("profile"), Tile: q.Get("tile"), Limit: 100}
+			if v := q.Get("schedule_id"); v != "" {
+				id, err := strconv.ParseInt(v, 10, 64)
+				if err != nil || id < 1 {
+					renderError(logger, w, http.StatusBadRequest, "invalid schedule_id: "+v)
+					return
+				}
+
+				filter.ScheduleID = id
+			}
+
+			if v := q.Get("limit"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					renderError(logger, w, http.StatusBadRequest, "invalid limit: "+v)
+					return
+				}
+
+				filter.Limit = n
+			}
+
+			runs, err := recorder.RunList(filter)
+			if err != nil {
+				logger.Printf("run list: %v\n", err)
+				renderError(logger, w, http.StatusInternalServerError, "failed to read the run history")
+				return
+			}
+
+			if runs == nil {
+				runs = []history.Run{}
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, runs); err != nil {
+				logger.Printf("run list: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+type testPass struct{}
+
+func (testPass) Run(server connections.Server, args ...tests.TestArg) error { return nil }
+
+func testScheduleMux(t *testing.T) (*http.ServeMux, *history.Log) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+
+	source := scheduler.Profiles{"Web": {
+		Name:   "Web",
+		Tiles:  map[string]profiles.Tile{"Nginx": profiles.NewTile("Nginx", tests.Test{Name: "Pass", Tester: testPass{}})},
+		Groups: map[string]profiles.Group{"Prod": profiles.NewGroup("Prod", server)},
+	}}
+
+	rec := history.NewLog()
+	s, err := scheduler.New(scheduler.NewMemoryStore(), source, rec, nil)
+	require.NoError(err, "scheduler.New() returned an error: %s", err)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/schedules", handleScheduleList(logger, s))
+	mux.Handle("POST /v1/schedules", handleScheduleCreate(logger, s))
+	mux.Handle("GET /v1/schedules/{id}", handleScheduleGet(logger, s))
+	mux.Handle("PUT /v1/schedules/{id}", handleScheduleUpdate(logger, s))
+	mux.Handle("DELETE /v1/schedules/{id}", handleScheduleDelete(logger, s))
+	mux.Handle("POST /v1/schedules/{id}/pause", handleSchedulePause(logger, s, true))
+	mux.Handle("POST /v1/schedules/{id}/resume", handleSchedulePause(logger, s, false))
+	mux.Handle("POST /v1/schedules/{id}/run", handleScheduleRun(logger, s))
+	mux.Handle("GET /v1/runs", handleRunList(logger, rec))
+	return mux, rec
+}
+
+func TestRoutesHandleSchedules(t *testing.T) {
+	require := require.New(t)
+	mux, rec := testScheduleMux(t)
+	body := `{"name":"Hourly","profile":"Web","tile":"Nginx","group":"Prod","cron":"@hourly","jitter":"30s"}`
+
+	t.Run("create", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/schedules", strings.NewReader(body), http.StatusCreated)
+		got, err := router.ReadJSON[scheduler.Schedule](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal(int64(1), got.ID, "ID was not set")
+		require.Equal("@hourly", got.Cron, "Cron did not match")
+	})
+
+	t.Run("create invalid", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "POST", "/v1/schedules", strings.NewReader(`{"name":"Bad"}`), http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "POST", "/v1/schedules", strings.NewReader(`{`), http.StatusBadRequest)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/schedules", nil, http.StatusOK)
+		got, err := router.ReadJSON[[]scheduler.Status](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 1, "handler did not return every schedule")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", "/v1/schedules/1", nil, http.StatusOK)
+		test_helpers.TestHandler(t, mux, "GET", "/v1/schedules/99", nil, http.StatusNotFound)
+		test_helpers.TestHandler(t, mux, "GET", "/v1/schedules/abc", nil, http.StatusBadRequest)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		update := strings.Replace(body, "@hourly", "@daily", 1)
+		resp := test_helpers.TestHandler(t, mux, "PUT", "/v1/schedules/1", strings.NewReader(update), http.StatusOK)
+		got, err := router.ReadJSON[scheduler.Schedule](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal("@daily", got.Cron, "Cron was not updated")
+
+		test_helpers.TestHandler(t, mux, "PUT", "/v1/schedules/99", strings.NewReader(update), http.StatusNotFound)
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/1/pause", nil, http.StatusOK)
+		got, err := router.ReadJSON[scheduler.Schedule](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.True(got.Paused, "schedule was not paused")
+
+		resp = test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/1/resume", nil, http.StatusOK)
+		got, err = router.ReadJSON[scheduler.Schedule](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.False(got.Paused, "schedule was not resumed")
+	})
+
+	t.Run("run", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/1/run", nil, http.StatusOK)
+		got, err := router.ReadJSON[history.Run](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.True(got.Passed, "run did not pass")
+		require.Equal(history.TriggerSchedule, got.Trigger, "run trigger did not match")
+
+		test_helpers.TestHandler(t, mux, "POST", "/v1/schedules/99/run", nil, http.StatusNotFound)
+	})
+
+	t.Run("runs", func(t *testing.T) {
+		_, err := rec.RunRecord(history.Run{Profile: "Web", Tile: "Disk", Group: "Prod", Trigger: history.TriggerManual, User: "admin"})
+		require.NoError(err, "RunRecord() returned an error: %s", err)
+
+		resp := test_helpers.TestHandler(t, mux, "GET", "/v1/runs", nil, http.StatusOK)
+		got, err := router.ReadJSON[[]history.Run](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 2, "manual and scheduled runs were not both returned")
+
+		resp = test_helpers.TestHandler(t, mux, "GET", "/v1/runs?schedule_id=1", nil, http.StatusOK)
+		got, err = router.ReadJSON[[]history.Run](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Len(got, 1, "runs were not filtered")
+
+		test_helpers.TestHandler(t, mux, "GET", "/v1/runs?limit=0", nil, http.StatusBadRequest)
+		test_helpers.TestHandler(t, mux, "GET", "/v1/runs?schedule_id=x", nil, http.StatusBadRequest)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/schedules/1", nil, http.StatusNoContent)
+		test_helpers.TestHandler(t, mux, "DELETE", "/v1/schedules/1", nil, http.StatusNotFound)
+	})
+}
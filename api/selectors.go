@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+// serverInfo is the API form of a connections.Server.
+type serverInfo struct {
+	Name     string            `json:"name"`
+	Hostname string            `json:"hostname"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// selectorPreview is the response of handleSelectorPreview.
+type selectorPreview struct {
+	Selector string       `json:"selector"` // The selector as it was parsed.
+	Servers  []serverInfo `json:"servers"`
+}
+
+// profileErrorStatus returns the HTTP status for an error looking up a profile.
+func profileErrorStatus(err error) int {
+	if errors.Is(err, scheduler.ErrNoProfile) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+// handleSelectorPreview returns the servers in the profile's inventory which currently match the
+// selector query parameter.
+func handleSelectorPreview(logger *core.Logger, source scheduler.ProfileSource) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			profile, err := source.GetProfile(r.PathValue("profile"))
+			if err != nil {
+				renderError(logger, w, profileErrorStatus(err), err.Error())
+				return
+			}
+
+			sel, err := profiles.ParseSelector(r.URL.Query().Get("selector"))
+			if err != nil {
+				renderError(logger, w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			preview := selectorPreview{Selector: sel.String(), Servers: []serverInfo{}}
+			for _, s := range sel.Select(profile.Servers) {
+				preview.Servers = append(preview.Servers, serverInfo{Name: s.Name, Hostname: s.Hostname, Labels: s.Labels})
+			}
+
+			if err := router.RenderJSON(w, http.StatusOK, preview); err != nil {
+				logger.Printf("selector preview: %v\n", err)
+			}
+		})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutesHandleSelectorPreview(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(nil, "cuttle: ", 0, false)
+
+	profile := profiles.Profile{Name: "Data"}
+	for host, role := range map[string]string{"db1": "db", "cache1": "cache", "web1": "web"} {
+		s, err := connections.NewServer(host, 0, &bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "connections.NewServer() returned an error: %s", err)
+		require.NoError(s.SetLabels(map[string]string{"env": "prod", "role": role}))
+		profile.AddServers(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/profiles/{profile}/selector", handleSelectorPreview(logger, scheduler.Profiles{"Data": profile}))
+	path := func(profile, selector string) string {
+		return "/v1/profiles/" + profile + "/selector?selector=" + url.QueryEscape(selector)
+	}
+
+	t.Run("match", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", path("Data", "env=prod, role in (db,cache)"), nil, http.StatusOK)
+		got, err := router.ReadJSON[selectorPreview](&http.Request{Body: resp.Result().Body})
+		require.NoError(err, "decode() returned an error: %s", err)
+		require.Equal("env=prod,role in (cache,db)", got.Selector, "selector did not match")
+		require.Len(got.Servers, 2, "servers did not match")
+		for _, s := range got.Servers {
+			require.Contains([]string{"db", "cache"}, s.Labels["role"], "server %s should not match", s.Name)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		resp := test_helpers.TestHandler(t, mux, "GET", path("Data", "env=dev"), nil, http.StatusOK)
+		require.Contains(resp.Body.String(), `"servers":[]`, "empty list was not returned")
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", path("Data", "role in (db"), nil, http.StatusBadRequest)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		test_helpers.TestHandler(t, mux, "GET", path("Bogus", "env=prod"), nil, http.StatusNotFound)
+	})
+}
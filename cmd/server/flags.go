@@ -9,6 +9,8 @@ var (
 	help    = `
 Usage:
 	cuttle [options] [args]
+	cuttle import [options] <file>	Preview importing an inventory file. See cuttle import --help.
+	cuttle profile <command>	Validate and diff profile bundles. See cuttle profile --help.
 Options:
 	--help				Print this help message.
 	--version			Print the version.
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/inventory"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+)
+
+var importHelp = `
+Usage:
+	cuttle import [options] <file>
+Options:
+	-f, --format <format>		Inventory format: ` + strings.Join(inventory.Formats(), ", ") + `.
+					Guessed from the file name when not set.
+	-p, --profile <bundle>		Profile bundle to import into. An empty profile is used when not set.
+	--apply				Write the imported servers and groups to the profile bundle.`
+
+// runImport prints the plan to import an inventory file into a profile bundle. The bundle is only
+// changed with --apply and when the plan has no conflicts.
+func runImport(out io.Writer, args []string) error {
+	var format, file, profileFile string
+	var apply bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--help":
+			fmt.Fprintln(out, importHelp)
+			return nil
+		case "--apply":
+			apply = true
+		case "-f", "--format", "-p", "--profile":
+			if i+1 >= len(args) {
+				return fmt.Errorf("import: %s requires a value", args[i])
+			}
+
+			if args[i] == "-p" || args[i] == "--profile" {
+				profileFile = args[i+1]
+			} else {
+				format = args[i+1]
+			}
+			i++
+		default:
+			if file != "" {
+				return fmt.Errorf("import: unexpected argument: %s", args[i])
+			}
+
+			file = args[i]
+		}
+	}
+
+	if file == "" {
+		return fmt.Errorf("import: an inventory file is required\n%s", importHelp)
+	}
+
+	if apply && profileFile == "" {
+		return fmt.Errorf("import: --apply requires a profile bundle\n%s", importHelp)
+	}
+
+	if format == "" {
+		format = guessFormat(file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	defer f.Close()
+
+	inv, err := inventory.Parse(format, f)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	var p profiles.Profile
+	if profileFile != "" {
+		b, err := readBundle(profileFile)
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+
+		if p, err = b.ProfileRefs(&bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			return fmt.Errorf("import: %s: %w", profileFile, err)
+		}
+	}
+
+	plan := inventory.NewPlan(p, inv)
+	if _, err := fmt.Fprint(out, plan.String()); err != nil || !apply {
+		return err
+	}
+
+	if err := inventory.Apply(&p, plan, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	b, err := bundle.Export(p)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	if err := writeBundle(profileFile, b); err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	_, err = fmt.Fprintf(out, "applied to %s\n", profileFile)
+	return err
+}
+
+// guessFormat returns the inventory format for the file name or an empty string if it is unknown.
+func guessFormat(file string) string {
+	switch base := filepath.Base(file); {
+	case strings.HasSuffix(base, ".csv"):
+		return inventory.FormatCSV
+	case strings.HasSuffix(base, ".yml"), strings.HasSuffix(base, ".yaml"):
+		return inventory.FormatAnsibleYAML
+	case strings.HasSuffix(base, ".ini"), base == "hosts":
+		return inventory.FormatAnsibleINI
+	case base == "config", base == "ssh_config":
+		return inventory.FormatSSHConfig
+	default:
+		return ""
+	}
+}
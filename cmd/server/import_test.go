@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/inventory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportRunImport(t *testing.T) {
+	require := require.New(t)
+	var buf bytes.Buffer
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hosts.csv")
+	err := os.WriteFile(file, []byte("name,hostname,groups\nweb01,web01.example.com,web\nweb02,web01.example.com,web\n"), 0o600)
+	require.NoError(err, "os.WriteFile() returned an error: %s", err)
+
+	t.Run("help", func(t *testing.T) {
+		require.NoError(runImport(&buf, []string{"--help"}), "runImport() returned an error")
+		require.Contains(buf.String(), "Usage:", "runImport() did not print the help")
+		buf.Reset()
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		err := run(context.Background(), &buf, []string{"app", "import", file}, map[string]string{})
+		require.NoError(err, "run() returned an error: %s", err)
+		require.Equal(`+ server web01 (web01.example.com)
++ group web: web01
+! conflict web02 (web01.example.com): hostname is used by another host in the import: web01
+1 to add, 0 to update, 0 unchanged, 1 conflicts
+`, buf.String(), "runImport() output did not match")
+		buf.Reset()
+	})
+
+	t.Run("format", func(t *testing.T) {
+		err := runImport(&buf, []string{"-f", inventory.FormatSSHConfig, file})
+		require.NoError(err, "runImport() returned an error: %s", err)
+		require.Contains(buf.String(), "0 to add", "runImport() did not use the format")
+		buf.Reset()
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		hosts := filepath.Join(dir, "apply.csv")
+		require.NoError(os.WriteFile(hosts, []byte("name,hostname,groups\nweb02,web02.example.com,web\n"), 0o600))
+		profile := filepath.Join(dir, "web.yaml")
+		require.NoError(os.WriteFile(profile, []byte("version: 1\nname: Web\nconnectors: [{name: deploy, protocol: ssh, user: deploy, auth: [deploy-key]}]\nservers: [{name: web01, hostname: web01.example.com, connector: deploy}]\ngroups: [{name: web, servers: [web01]}]\n"), 0o600))
+
+		err := runImport(&buf, []string{"--apply", "-p", profile, hosts})
+		require.NoError(err, "runImport() returned an error: %s", err)
+		require.Contains(buf.String(), "applied to "+profile, "runImport() did not apply the plan")
+		buf.Reset()
+
+		b, err := readBundle(profile)
+		require.NoError(err, "readBundle() returned an error: %s", err)
+		require.Len(b.Servers, 2, "server was not written to the bundle")
+		require.Equal([]string{"web01", "web02"}, b.Groups[0].Servers, "group was not written to the bundle")
+		require.Equal([]string{"deploy-key"}, b.Connectors[0].Auth, "connector auth was not kept")
+
+		// Importing again changes nothing.
+		require.NoError(runImport(&buf, []string{"-p", profile, hosts}), "runImport() returned an error")
+		require.Contains(buf.String(), "0 to add, 0 to update, 1 unchanged", "plan did not use the profile")
+		buf.Reset()
+	})
+
+	t.Run("apply conflicts", func(t *testing.T) {
+		profile := filepath.Join(dir, "conflicts.yaml")
+		require.NoError(os.WriteFile(profile, []byte("version: 1\nname: Web\n"), 0o600))
+		require.Error(runImport(&buf, []string{"--apply", "-p", profile, file}), "runImport() applied a plan with conflicts")
+		buf.Reset()
+
+		b, err := readBundle(profile)
+		require.NoError(err, "readBundle() returned an error: %s", err)
+		require.Empty(b.Servers, "bundle was changed")
+	})
+
+	for name, args := range map[string][]string{
+		"no file":         {},
+		"apply only":      {"--apply", file},
+		"missing profile": {"-p", filepath.Join(dir, "missing.yaml"), file},
+		"no format":       {"-f"},
+		"extra argument":  {file, file},
+		"unknown format":  {filepath.Join(dir, "inventory.txt")},
+		"missing file":    {"-f", inventory.FormatCSV, filepath.Join(dir, "missing.csv")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(runImport(&buf, args), "runImport() did not return an error")
+		})
+	}
+}
+
+func TestImportGuessFormat(t *testing.T) {
+	require := require.New(t)
+	for file, want := range map[string]string{
+		"servers.csv":          inventory.FormatCSV,
+		"inventory.yml":        inventory.FormatAnsibleYAML,
+		"inventory.yaml":       inventory.FormatAnsibleYAML,
+		"/etc/ansible/hosts":   inventory.FormatAnsibleINI,
+		"prod.ini":             inventory.FormatAnsibleINI,
+		"/home/me/.ssh/config": inventory.FormatSSHConfig,
+		"inventory.txt":        "",
+	} {
+		require.Equal(want, guessFormat(file), "guessFormat(%s) did not match", file)
+	}
+}
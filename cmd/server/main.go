@@ -7,16 +7,26 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/chadeldridge/cuttle-server/api"
 	"github.com/chadeldridge/cuttle-server/core"
 	"github.com/chadeldridge/cuttle-server/db"
 	"github.com/chadeldridge/cuttle-server/router"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/binding"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/chadeldridge/cuttle-server/services/notify"
 	"github.com/chadeldridge/cuttle-server/web"
 )
 
@@ -32,6 +42,9 @@ var (
 )
 */
 
+// notifyRestoreRuns is how many recent runs are replayed to rebuild the alert states at startup.
+const notifyRestoreRuns = 1000
+
 // run allows us to setup and implement in testing and production.
 func run(ctx context.Context, out io.Writer, args []string, env map[string]string) error {
 	// Capture the interrupt signal to gracefully shutdown the server.
@@ -41,6 +54,16 @@ func run(ctx context.Context, out io.Writer, args []string, env map[string]strin
 	// Setup logger.
 	logger := core.NewLogger(out, "cuttle: ", log.LstdFlags, false)
 
+	// Subcommands.
+	if len(args) > 1 {
+		switch args[1] {
+		case "import":
+			return runImport(out, args[2:])
+		case "profile":
+			return runProfile(out, args[2:])
+		}
+	}
+
 	// Get flags.
 	flags, args := parseFlags(logger, args)
 	if flags == nil && args == nil {
@@ -59,6 +82,9 @@ func run(ctx context.Context, out io.Writer, args []string, env map[string]strin
 	// Print config if in debug mode.
 	logger.Debugf("Config: %+v\n", config)
 
+	// Apply config values used by the testers.
+	tests.PingPrivileged = config.PingPrivileged
+
 	// Setup the database.
 	db.SetAuthSecret(config.Secret)
 	cuttleDB, authDB, err := openDBs(config.DBRoot)
@@ -72,6 +98,71 @@ func run(ctx context.Context, out io.Writer, args []string, env map[string]strin
 	srv := router.NewHTTPServer(logger, config)
 	srv.CuttleDB = cuttleDB
 	srv.AuthDB = authDB
+
+	// Setup notifications. Alert on failed scheduled runs.
+	var runs history.Recorder = cuttleDB
+	if config.NotifyFile != "" {
+		notifier, err := loadNotifier(config.NotifyFile, logger)
+		if err != nil {
+			return err
+		}
+
+		rec := notify.NewRecorder(cuttleDB, notifier)
+		if err := rec.Restore(notifyRestoreRuns); err != nil {
+			return err
+		}
+
+		runs = rec
+	}
+
+	// Connectors look up their AuthMethods by name in the credentials file.
+	var creds bundle.Credentials
+	if config.CredentialsFile != "" {
+		if creds, err = loadCredentials(config.CredentialsFile); err != nil {
+			return err
+		}
+	}
+	srv.Credentials = creds
+
+	// Setup the profiles. Bundles in ProfilesDir are loaded at startup and changes made through the
+	// API are written back to them. Without a ProfilesDir the API cannot change profiles.
+	// Connectors bound to Groups in cuttle.db are applied to each Profile before it runs.
+	profileSource := scheduler.NewMemoryProfiles()
+	srv.Profiles = memoryProfiles{source: profileSource}
+	if config.ProfilesDir != "" {
+		if profileSource, err = loadProfiles(config.ProfilesDir, creds); err != nil {
+			return err
+		}
+
+		srv.Profiles = &dirProfiles{MemoryProfiles: profileSource, dir: config.ProfilesDir}
+	}
+
+	bound := binding.NewSource(profileSource, cuttleDB, creds)
+	srv.BoundProfiles = bound
+
+	// Scheduled runs skip the servers in maintenance. Ended windows are removed in the background.
+	go maintenance.Expire(ctx, cuttleDB, time.Minute, logger)
+	// Approval requests nobody decided on are marked expired in the background.
+	go approval.Expire(ctx, cuttleDB, time.Minute, logger)
+
+	// Setup the scheduler. Schedules are loaded from cuttle.db and runs are recorded there too.
+	// Without ProfilesDir there are no profiles to run so scheduling is off.
+	if config.ProfilesDir == "" {
+		logger.Println("profiles_dir is not set, scheduling is disabled")
+	} else {
+		sched, err := scheduler.New(scheduler.NewDBStore(cuttleDB), bound, runs, logger)
+		if err != nil {
+			return err
+		}
+
+		sched.SetMaintenance(cuttleDB)
+		if err := sched.Start(ctx); err != nil {
+			return err
+		}
+		defer sched.Stop()
+		srv.Scheduler = sched
+	}
+
 	// Add routes and do anything else we need to do before starting the server.
 
 	// Add web routes.
@@ -90,6 +181,25 @@ func run(ctx context.Context, out io.Writer, args []string, env map[string]strin
 	return srv.Start(ctx, config.ShutdownTimeout)
 }
 
+func loadNotifier(file string, logger *core.Logger) (*notify.Notifier, error) {
+	c, err := notify.LoadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Build(logger)
+}
+
+func loadCredentials(file string) (bundle.Credentials, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+	defer f.Close()
+
+	return bundle.LoadCredentials(f)
+}
+
 func openDBs(dbRoot string) (db.CuttleDB, db.AuthDB, error) {
 	err := db.SetDBRoot(dbRoot)
 	if err != nil {
@@ -192,10 +302,25 @@ func getEnv() map[string]string {
 
 /*
 	// Create some test to add to a tile.
-	ping := tests.NewPingTest("Ping Test", false, 1, tests.Quiet())
-	tcpHalfOpen := tests.NewTCPPortHalfOpen("TCP Half Open Test", false, 22)
-	tcpOpen := tests.NewTCPPortOpen("TCP Open Test", false, 22)
-	sshTest := tests.NewSSHTest("SSH Test", false, "echo 'Hello, World!'", "Hello, World!")
+	ping, err := tests.NewPingTest("Ping Test", false, 1, tests.Quiet())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tcpHalfOpen, err := tests.NewTCPPortHalfOpen("TCP Half Open Test", false, 22)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tcpOpen, err := tests.NewTCPPortOpen("TCP Open Test", false, 22)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sshTest, err := tests.NewSSHTest("SSH Test", false, "echo 'Hello, World!'", "Hello, World!")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create a tile with the tests and add it to the profile.
 	tile := profiles.NewTile("Full Test", ping, tcpHalfOpen, tcpOpen, sshTest)
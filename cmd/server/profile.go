@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+var profileHelp = `
+Usage:
+	cuttle profile validate <file>		Check a profile bundle and print what importing it creates.
+	cuttle profile diff <from> <to>		Print the changes between two profile bundles.
+	cuttle profile import [-c <credentials>] <file> <dir>
+						Check a profile bundle and save it to the profiles directory.
+						Credentials are checked when a credentials file is given.
+	cuttle profile export <dir> <name> [file]
+						Write a profile from the profiles directory as a bundle. Writes
+						YAML to stdout when no file is given.`
+
+// runProfile checks, compares, imports, and exports profile bundles. The server loads the bundles
+// in its profiles directory at startup.
+func runProfile(out io.Writer, args []string) error {
+	if len(args) == 0 || args[0] == "--help" {
+		fmt.Fprintln(out, profileHelp)
+		return nil
+	}
+
+	switch cmd := args[0]; {
+	case cmd == "validate" && len(args) == 2:
+		b, err := readBundle(args[1])
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprint(out, bundle.Diff(bundle.Bundle{}, b).String())
+		return err
+	case cmd == "diff" && len(args) == 3:
+		from, err := readBundle(args[1])
+		if err != nil {
+			return err
+		}
+
+		to, err := readBundle(args[2])
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprint(out, bundle.Diff(from, to).String())
+		return err
+	case cmd == "import" && len(args) == 5 && args[1] == "-c":
+		creds, err := loadCredentials(args[2])
+		if err != nil {
+			return err
+		}
+
+		return importProfile(out, args[3], args[4], creds)
+	case cmd == "import" && len(args) == 3:
+		return importProfile(out, args[1], args[2], nil)
+	case cmd == "export" && (len(args) == 3 || len(args) == 4):
+		file := ""
+		if len(args) == 4 {
+			file = args[3]
+		}
+
+		return exportProfile(out, args[1], args[2], file)
+	default:
+		return fmt.Errorf("profile: unexpected arguments: %v\n%s", args, profileHelp)
+	}
+}
+
+// importProfile saves the bundle in file to dir and prints the changes to the profile. A profile
+// already in dir is replaced in its own file. Credentials are only checked if creds is not nil.
+func importProfile(out io.Writer, file, dir string, creds bundle.Credentials) error {
+	b, err := readBundle(file)
+	if err != nil {
+		return err
+	}
+
+	if creds != nil {
+		if _, err := b.Profile(creds, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			return fmt.Errorf("profile: %s: %w", file, err)
+		}
+	}
+
+	dest, current, err := bundleDest(dir, b.Name)
+	if err != nil {
+		return err
+	}
+
+	// Existing servers keep their IDs so their history and maintenance windows still match.
+	b = b.KeepIDs(current)
+	if _, err := fmt.Fprint(out, bundle.Diff(current, b).String()); err != nil {
+		return err
+	}
+
+	if err := writeBundle(dest, b); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "saved to %s\n", dest)
+	return err
+}
+
+// exportProfile writes the named profile in dir to file, or to out as YAML if file is empty.
+func exportProfile(out io.Writer, dir, name, file string) error {
+	src, b, err := findBundle(dir, name)
+	if err != nil {
+		return err
+	}
+
+	if src == "" {
+		return fmt.Errorf("profile: %w: %s", scheduler.ErrNoProfile, name)
+	}
+
+	// Build and export the profile so the bundle is written the same way the API exports it.
+	p, err := b.ProfileRefs(&bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		return fmt.Errorf("profile: %s: %w", src, err)
+	}
+
+	if b, err = bundle.Export(p); err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+
+	if file == "" {
+		return b.Encode(out, bundle.FormatYAML)
+	}
+
+	return writeBundle(file, b)
+}
+
+// readBundle reads and normalizes the bundle file.
+func readBundle(file string) (bundle.Bundle, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return bundle.Bundle{}, fmt.Errorf("profile: %w", err)
+	}
+	defer f.Close()
+
+	b, err := bundle.Decode(f)
+	if err != nil {
+		return b, fmt.Errorf("profile: %s: %w", file, err)
+	}
+
+	if b, err = b.Normalize(); err != nil {
+		return b, fmt.Errorf("profile: %s: %w", file, err)
+	}
+
+	return b, nil
+}
+
+// writeBundle writes the bundle to the file as JSON if the file name ends in .json and YAML
+// otherwise.
+func writeBundle(file string, b bundle.Bundle) error {
+	format := bundle.FormatYAML
+	if filepath.Ext(file) == ".json" {
+		format = bundle.FormatJSON
+	}
+
+	var buf bytes.Buffer
+	if err := b.Encode(&buf, format); err != nil {
+		return fmt.Errorf("profile: %s: %w", file, err)
+	}
+
+	if err := os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+
+	return nil
+}
+
+// bundleFiles returns the YAML and JSON files in dir.
+func bundleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+
+	var files []string
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+// findBundle returns the file and bundle of the named profile in dir. The file is empty if the
+// profile is not in dir.
+func findBundle(dir, name string) (string, bundle.Bundle, error) {
+	files, err := bundleFiles(dir)
+	if err != nil {
+		return "", bundle.Bundle{}, err
+	}
+
+	for _, file := range files {
+		b, err := readBundle(file)
+		if err != nil {
+			return "", bundle.Bundle{}, err
+		}
+
+		if b.Name == name {
+			return file, b, nil
+		}
+	}
+
+	return "", bundle.Bundle{}, nil
+}
+
+// bundleDest returns the file the named profile is saved to in dir and the bundle already in it.
+// A profile which is not in dir is saved to <name>.yaml.
+func bundleDest(dir, name string) (string, bundle.Bundle, error) {
+	dest, current, err := findBundle(dir, name)
+	if err != nil || dest != "" {
+		return dest, current, err
+	}
+
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", current, fmt.Errorf("profile: %s cannot be used as a file name", name)
+	}
+
+	return filepath.Join(dir, name+".yaml"), current, nil
+}
+
+// dirProfiles is a ProfileSource which writes changed Profiles back to their bundle in dir so
+// changes made through the API are kept when the server restarts.
+type dirProfiles struct {
+	*scheduler.MemoryProfiles
+	dir string
+	mu  sync.Mutex // Serializes writes to dir.
+}
+
+// SaveProfile writes the Profile to its bundle in dir and then replaces it in memory.
+func (d *dirProfiles) SaveProfile(p profiles.Profile) error {
+	b, err := bundle.Export(p)
+	if err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dest, _, err := bundleDest(d.dir, p.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := writeBundle(dest, b); err != nil {
+		return err
+	}
+
+	return d.MemoryProfiles.SaveProfile(p)
+}
+
+// memoryProfiles hides MemoryProfiles.SaveProfile so the API refuses changes it could not keep.
+type memoryProfiles struct{ source *scheduler.MemoryProfiles }
+
+func (m memoryProfiles) GetProfile(name string) (profiles.Profile, error) {
+	return m.source.GetProfile(name)
+}
+
+// loadProfiles builds the Profile of every YAML and JSON bundle in dir. Credentials are looked up
+// in creds, which may be nil if no Connector has auth.
+func loadProfiles(dir string, creds bundle.Credentials) (*scheduler.MemoryProfiles, error) {
+	files, err := bundleFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	source := scheduler.NewMemoryProfiles()
+	for _, file := range files {
+		b, err := readBundle(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// INCOMPLETE: Each run has its own buffers but its output is still added to these, which
+		// nothing reads or clears yet.
+		p, err := b.Profile(creds, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			return nil, fmt.Errorf("profiles: %s: %w", file, err)
+		}
+
+		if err := source.SaveProfile(p); err != nil {
+			return nil, fmt.Errorf("profiles: %s: %w", file, err)
+		}
+	}
+
+	return source, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileRunProfile(t *testing.T) {
+	require := require.New(t)
+	var buf bytes.Buffer
+
+	dev := `version: 1
+name: Web
+servers:
+  - name: web01
+    hostname: web01.dev.example.com
+groups:
+  - name: web
+    servers: [web01]
+`
+	dir := t.TempDir()
+	devFile := filepath.Join(dir, "dev.yaml")
+	prodFile := filepath.Join(dir, "prod.yaml")
+	badFile := filepath.Join(dir, "bad.yaml")
+	require.NoError(os.WriteFile(devFile, []byte(dev), 0o600))
+	require.NoError(os.WriteFile(prodFile, []byte(strings.ReplaceAll(dev, ".dev.", ".")), 0o600))
+	require.NoError(os.WriteFile(badFile, []byte("version: 1\nname: Web\ngroups: [{name: web, servers: [web01]}]\n"), 0o600))
+
+	t.Run("help", func(t *testing.T) {
+		require.NoError(runProfile(&buf, nil), "runProfile() returned an error")
+		require.Contains(buf.String(), "Usage:", "runProfile() did not print the help")
+		buf.Reset()
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		err := run(context.Background(), &buf, []string{"app", "profile", "validate", devFile}, map[string]string{})
+		require.NoError(err, "run() returned an error: %s", err)
+		require.Equal("+ profile Web\n+ server web01\n+ group web\n3 to add, 0 to update, 0 to remove\n", buf.String(), "output did not match")
+		buf.Reset()
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		require.NoError(runProfile(&buf, []string{"diff", devFile, prodFile}), "runProfile() returned an error")
+		require.Equal("~ server web01\n0 to add, 1 to update, 0 to remove\n", buf.String(), "output did not match")
+		buf.Reset()
+	})
+
+	for name, args := range map[string][]string{
+		"invalid":      {"validate", badFile},
+		"missing file": {"validate", filepath.Join(dir, "missing.yaml")},
+		"diff invalid": {"diff", devFile, badFile},
+		"arguments":    {"diff", devFile},
+		"command":      {"apply", devFile},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(runProfile(&buf, args), "runProfile() did not return an error")
+		})
+	}
+}
+
+func TestProfileImportExport(t *testing.T) {
+	require := require.New(t)
+	var buf bytes.Buffer
+	dir := t.TempDir()
+	profiles := filepath.Join(dir, "profiles")
+	require.NoError(os.Mkdir(profiles, 0o700))
+
+	web := "version: 1\nname: Web\nconnectors: [{name: deploy, protocol: ssh, user: deploy, auth: [deploy-pass]}]\nservers: [{name: web01, hostname: web01.example.com, connector: deploy}]\n"
+	webFile := filepath.Join(dir, "web.yaml")
+	require.NoError(os.WriteFile(webFile, []byte(web), 0o600))
+	credsFile := filepath.Join(dir, "credentials.yaml")
+	require.NoError(os.WriteFile(credsFile, []byte("credentials: [{name: deploy-pass, type: ssh_password, env: TEST_CUTTLE_DEPLOY}]\n"), 0o600))
+	t.Setenv("TEST_CUTTLE_DEPLOY", "secret")
+
+	t.Run("import", func(t *testing.T) {
+		require.NoError(runProfile(&buf, []string{"import", "-c", credsFile, webFile, profiles}), "runProfile() returned an error")
+		require.Contains(buf.String(), "+ profile Web", "changes were not printed")
+		require.FileExists(filepath.Join(profiles, "Web.yaml"), "bundle was not saved")
+		buf.Reset()
+	})
+
+	t.Run("import again", func(t *testing.T) {
+		changed := filepath.Join(dir, "changed.yaml")
+		require.NoError(os.WriteFile(changed, []byte(strings.Replace(web, "web01.example.com", "10.0.0.1", 1)), 0o600))
+		require.NoError(runProfile(&buf, []string{"import", changed, profiles}), "runProfile() returned an error")
+		require.Contains(buf.String(), "~ server web01", "changes were not printed")
+		require.Contains(buf.String(), "saved to "+filepath.Join(profiles, "Web.yaml"), "existing file was not replaced")
+		buf.Reset()
+	})
+
+	t.Run("missing credential", func(t *testing.T) {
+		empty := filepath.Join(dir, "empty.yaml")
+		require.NoError(os.WriteFile(empty, []byte("credentials: []\n"), 0o600))
+		require.Error(runProfile(&buf, []string{"import", "-c", empty, webFile, profiles}), "runProfile() did not check the credentials")
+		buf.Reset()
+	})
+
+	t.Run("export", func(t *testing.T) {
+		require.NoError(runProfile(&buf, []string{"export", profiles, "Web"}), "runProfile() returned an error")
+		require.Contains(buf.String(), "hostname: 10.0.0.1", "bundle was not written")
+		require.Contains(buf.String(), "deploy-pass", "auth reference was not written")
+		require.NotContains(buf.String(), "secret", "credential was written")
+		buf.Reset()
+
+		out := filepath.Join(dir, "out.json")
+		require.NoError(runProfile(&buf, []string{"export", profiles, "Web", out}), "runProfile() returned an error")
+		b, err := readBundle(out)
+		require.NoError(err, "readBundle() returned an error: %s", err)
+		require.Equal("Web", b.Name, "bundle did not match")
+	})
+
+	for name, args := range map[string][]string{
+		"export missing": {"export", profiles, "DB"},
+		"import bad dir": {"import", webFile, filepath.Join(dir, "missing")},
+		"bad name":       {"import", filepath.Join(dir, "bad-name.yaml"), profiles},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(os.WriteFile(filepath.Join(dir, "bad-name.yaml"), []byte("version: 1\nname: ../Web\n"), 0o600))
+			require.Error(runProfile(&buf, args), "runProfile() did not return an error")
+		})
+	}
+}
+
+func TestProfileLoadProfiles(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	bundle := "version: 1\nname: Web\nservers:\n  - name: web01\n    hostname: web01.example.com\n"
+	require.NoError(os.WriteFile(filepath.Join(dir, "web.yaml"), []byte(bundle), 0o600))
+	require.NoError(os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a bundle"), 0o600))
+
+	t.Run("good", func(t *testing.T) {
+		source, err := loadProfiles(dir, nil)
+		require.NoError(err, "loadProfiles() returned an error: %s", err)
+		p, err := source.GetProfile("Web")
+		require.NoError(err, "profile was not loaded: %s", err)
+		require.Len(p.Servers, 1, "server was not loaded")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.NoError(os.WriteFile(filepath.Join(dir, "bad.yml"), []byte("version: 1\nname: DB\ngroups: [{name: db, servers: [db01]}]\n"), 0o600))
+		_, err := loadProfiles(dir, nil)
+		require.ErrorContains(err, "bad.yml", "loadProfiles() did not name the file")
+	})
+
+	t.Run("missing dir", func(t *testing.T) {
+		_, err := loadProfiles(filepath.Join(dir, "missing"), nil)
+		require.Error(err, "loadProfiles() did not return an error")
+	})
+}
+
+func TestProfileDirProfiles(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	bundle := "version: 1\nname: Web\nservers:\n  - name: web01\n    hostname: web01.example.com\n"
+	require.NoError(os.WriteFile(filepath.Join(dir, "web.yml"), []byte(bundle), 0o600))
+
+	loaded, err := loadProfiles(dir, nil)
+	require.NoError(err, "loadProfiles() returned an error: %s", err)
+	source := &dirProfiles{MemoryProfiles: loaded, dir: dir}
+
+	p, err := source.GetProfile("Web")
+	require.NoError(err, "GetProfile() returned an error: %s", err)
+	id := p.Servers[0].ID
+	require.NoError(p.Servers[0].SetHostname("web01.example.net"))
+	require.NoError(source.SaveProfile(p), "SaveProfile() returned an error")
+
+	// The change is written to the file the profile was loaded from and kept after a restart.
+	reloaded, err := loadProfiles(dir, nil)
+	require.NoError(err, "loadProfiles() returned an error: %s", err)
+	p, err = reloaded.GetProfile("Web")
+	require.NoError(err, "GetProfile() returned an error: %s", err)
+	require.Equal("web01.example.net", p.Servers[0].Hostname, "change was not saved")
+	require.Equal(id, p.Servers[0].ID, "server ID was not saved")
+
+	p.Name = "DB"
+	require.NoError(source.SaveProfile(p), "SaveProfile() returned an error")
+	require.FileExists(filepath.Join(dir, "DB.yaml"), "new profile was not saved to its own file")
+
+	p.Name = ".."
+	require.Error(source.SaveProfile(p), "SaveProfile() did not check the file name")
+
+	var ps any = memoryProfiles{source: loaded}
+	_, ok := ps.(interface{ SaveProfile(p profiles.Profile) error })
+	require.False(ok, "memoryProfiles can save profiles")
+}
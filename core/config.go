@@ -47,6 +47,10 @@ type Config struct {
 	DocRoot         string `yaml:"doc_root,omitempty"`                     // DocRoot is the document root path for the serving static html files.
 	ShutdownTimeout int    `default:"5" yaml:"shutdown_timeout,omitempty"` // in seconds
 	Secret          string `yaml:"secret,omitempty"`
+	PingPrivileged  bool   `yaml:"ping_privileged,omitempty"`  // Use raw ICMP sockets for ping tests. Requires root or CAP_NET_RAW.
+	NotifyFile      string `yaml:"notify_file,omitempty"`      // Notification channels and routing rules. Alerts are off if empty.
+	ProfilesDir     string `yaml:"profiles_dir,omitempty"`     // Profile bundles loaded at startup. Scheduling is off if empty.
+	CredentialsFile string `yaml:"credentials_file,omitempty"` // Named AuthMethods used by Connectors. See bundle.Credential.
 }
 
 func DefaultConfig() *Config {
@@ -137,6 +141,14 @@ func (c *Config) setConfigValue(k, v string) error {
 		c.Debug = false
 	case "doc_root":
 		c.DocRoot = v
+	case "ping_privileged":
+		c.PingPrivileged = v == "true"
+	case "notify_file":
+		c.NotifyFile = v
+	case "profiles_dir":
+		c.ProfilesDir = v
+	case "credentials_file":
+		c.CredentialsFile = v
 	case "env":
 		v = strings.ToLower(v)
 		if !validateEnv(v) {
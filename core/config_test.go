@@ -229,6 +229,34 @@ func TestConfigSetConfigValue(t *testing.T) {
 		require.NoError(err, "setConfigValue() returned an error")
 		require.False(c.Debug, "setConfigValue() did not set the value")
 	})
+
+	t.Run("ping privileged", func(t *testing.T) {
+		err := c.setConfigValue("ping_privileged", "true")
+		require.NoError(err, "setConfigValue() returned an error")
+		require.True(c.PingPrivileged, "setConfigValue() did not set the value")
+
+		err = c.setConfigValue("ping_privileged", "false")
+		require.NoError(err, "setConfigValue() returned an error")
+		require.False(c.PingPrivileged, "setConfigValue() did not set the value")
+	})
+
+	t.Run("notify file", func(t *testing.T) {
+		err := c.setConfigValue("notify_file", "/etc/cuttle/notify.yaml")
+		require.NoError(err, "setConfigValue() returned an error")
+		require.Equal("/etc/cuttle/notify.yaml", c.NotifyFile, "setConfigValue() did not set the value")
+	})
+
+	t.Run("profiles dir", func(t *testing.T) {
+		err := c.setConfigValue("profiles_dir", "/etc/cuttle/profiles")
+		require.NoError(err, "setConfigValue() returned an error")
+		require.Equal("/etc/cuttle/profiles", c.ProfilesDir, "setConfigValue() did not set the value")
+	})
+
+	t.Run("credentials file", func(t *testing.T) {
+		err := c.setConfigValue("credentials_file", "/etc/cuttle/credentials.yaml")
+		require.NoError(err, "setConfigValue() returned an error")
+		require.Equal("/etc/cuttle/credentials.yaml", c.CredentialsFile, "setConfigValue() did not set the value")
+	})
 }
 
 func TestConfigParseEnvVars(t *testing.T) {
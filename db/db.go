@@ -3,8 +3,13 @@ package db
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
 )
 
 const (
@@ -35,6 +40,40 @@ type CuttleDB interface {
 	Close() error
 	// AddRepo(file, alias string, migrate migrater) error
 	// Attach(filename, alias string) error
+	// Audit Log
+	AuditRecord(entry audit.Entry) error
+	AuditStart(entry audit.Entry) (int64, error)
+	AuditFinish(id int64, outcome, detail string) error
+	AuditList(limit int) ([]audit.Entry, error)
+	// Schedules
+	ScheduleCreate(data ScheduleData) (ScheduleData, error)
+	ScheduleGet(id int64) (ScheduleData, error)
+	ScheduleList() ([]ScheduleData, error)
+	ScheduleUpdate(data ScheduleData) (ScheduleData, error)
+	ScheduleDelete(id int64) error
+	// Run History
+	RunRecord(run history.Run) (history.Run, error)
+	RunList(filter history.Filter) ([]history.Run, error)
+	// Connectors
+	ConnectorCreate(data ConnectorData) (ConnectorData, error)
+	ConnectorGetByName(name string) (ConnectorData, error)
+	ConnectorList() ([]ConnectorData, error)
+	ConnectorDelete(name string) error
+	// Connector Bindings
+	BindingSet(data BindingData) (BindingData, error)
+	BindingList(profile string) ([]BindingData, error)
+	BindingDelete(id int64) error
+	// Maintenance Windows
+	MaintenanceCreate(w maintenance.Window) (maintenance.Window, error)
+	MaintenanceList(filter maintenance.Filter) ([]maintenance.Window, error)
+	MaintenanceDelete(id int64) error
+	MaintenanceExpire(before time.Time) (int64, error)
+	// Approvals
+	ApprovalCreate(r approval.Request) (approval.Request, error)
+	ApprovalGet(id int64) (approval.Request, error)
+	ApprovalList(filter approval.Filter) ([]approval.Request, error)
+	ApprovalDecide(id int64, status, approver string, at time.Time) (approval.Request, error)
+	ApprovalExpire(before time.Time) (int64, error)
 }
 
 type AuthDB interface {
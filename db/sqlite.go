@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -12,6 +13,10 @@ import (
 	// libray has to be imported to register the driver.
 
 	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -21,6 +26,15 @@ const (
 	sqlite_tb_users       = "users"
 	sqlite_tb_user_groups = "user_groups"
 	sqlite_tb_tokens      = "tokens"
+
+	// Cuttle Tables.
+	sqlite_tb_audit_log   = "audit_log"
+	sqlite_tb_schedules   = "schedules"
+	sqlite_tb_runs        = "runs"
+	sqlite_tb_connectors  = "connectors"
+	sqlite_tb_bindings    = "connector_bindings"
+	sqlite_tb_maintenance = "maintenance_windows"
+	sqlite_tb_approvals   = "approvals"
 )
 
 // SqliteDB is a wrapper around the sqlite3 database. It also holds the db filename and context.
@@ -69,6 +83,34 @@ func (db *SqliteDB) Open() error {
 
 // CuttleMigrate runs the migrations for each table in the main cuttle database.
 func (db *SqliteDB) CuttleMigrate() error {
+	if err := AuditLogMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_audit_log, err)
+	}
+
+	if err := SchedulesMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_schedules, err)
+	}
+
+	if err := RunsMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_runs, err)
+	}
+
+	if err := ConnectorsMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_connectors, err)
+	}
+
+	if err := BindingsMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_bindings, err)
+	}
+
+	if err := MaintenanceMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_maintenance, err)
+	}
+
+	if err := ApprovalsMigrate(db); err != nil {
+		return fmt.Errorf("db.CuttleMigrate: failed to migrate %s: %w", sqlite_tb_approvals, err)
+	}
+
 	return nil
 }
 
@@ -772,3 +814,1066 @@ func (db *SqliteDB) TokenClean() error {
 
 	return nil
 }
+
+// ############################################################################################## //
+// ###################################        Audit Log        ################################## //
+// ############################################################################################## //
+
+// AuditLogMigrate creates the 'audit_log' table if it does not exist.
+func AuditLogMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_audit_log + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		username VARCHAR(255) NOT NULL,
+		action VARCHAR(32) NOT NULL,
+		profile VARCHAR(255) NOT NULL,
+		tile VARCHAR(255) NOT NULL,
+		server VARCHAR(255) NOT NULL,
+		outcome VARCHAR(32) NOT NULL,
+		detail TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON ` + sqlite_tb_audit_log + ` (created_at);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.AuditLogMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// AuditRecord validates and adds the entry to the audit log. Time is set to now if it is zero.
+// Entries are never deleted and only started entries can be updated. See AuditFinish.
+func (db *SqliteDB) AuditRecord(entry audit.Entry) error {
+	if _, err := db.auditInsert(entry); err != nil {
+		return fmt.Errorf("SqliteDB.AuditRecord: %w", err)
+	}
+
+	return nil
+}
+
+// AuditStart adds the entry to the audit log with audit.OutcomeStarted and returns its ID for
+// AuditFinish.
+func (db *SqliteDB) AuditStart(entry audit.Entry) (int64, error) {
+	entry.Outcome = audit.OutcomeStarted
+	id, err := db.auditInsert(entry)
+	if err != nil {
+		return 0, fmt.Errorf("SqliteDB.AuditStart: %w", err)
+	}
+
+	return id, nil
+}
+
+// AuditFinish sets the outcome and detail of a started entry. Returns audit.ErrNotStarted if the
+// entry does not exist or was already finished.
+func (db *SqliteDB) AuditFinish(id int64, outcome, detail string) error {
+	if err := audit.ValidateFinish(outcome); err != nil {
+		return fmt.Errorf("SqliteDB.AuditFinish: %w", err)
+	}
+
+	query := `UPDATE ` + sqlite_tb_audit_log + ` SET outcome = ?, detail = ? WHERE id = ? AND outcome = ?`
+	result, err := db.Exec(query, outcome, detail, id, audit.OutcomeStarted)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.AuditFinish: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("SqliteDB.AuditFinish: %w", err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("SqliteDB.AuditFinish: %w: %d", audit.ErrNotStarted, id)
+	}
+
+	return nil
+}
+
+func (db *SqliteDB) auditInsert(entry audit.Entry) (int64, error) {
+	if err := entry.Validate(); err != nil {
+		return 0, err
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	query := `INSERT INTO ` + sqlite_tb_audit_log + ` (created_at, username, action, profile, tile, server, outcome, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(
+		query,
+		entry.Time,
+		entry.User,
+		entry.Action,
+		entry.Profile,
+		entry.Tile,
+		entry.Server,
+		entry.Outcome,
+		entry.Detail,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// AuditList returns up to limit audit log entries, newest first. A limit of 0 or less returns every
+// entry.
+func (db *SqliteDB) AuditList(limit int) ([]audit.Entry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	query := `SELECT * FROM ` + sqlite_tb_audit_log + ` ORDER BY id DESC LIMIT ?`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.AuditList: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var e audit.Entry
+		err := rows.Scan(&e.ID, &e.Time, &e.User, &e.Action, &e.Profile, &e.Tile, &e.Server, &e.Outcome, &e.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.AuditList: %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.AuditList: %w", err)
+	}
+
+	return entries, nil
+}
+
+// ############################################################################################## //
+// ###################################        Schedules        ################################## //
+// ############################################################################################## //
+
+// ScheduleData represents a schedule in the database.
+type ScheduleData struct {
+	ID       int64
+	Name     string
+	Profile  string
+	Tile     string
+	Group    string
+	Cron     string        // Cron expression. Empty if Interval is used.
+	Interval time.Duration // Stored as nanoseconds.
+	Jitter   time.Duration // Stored as nanoseconds.
+	Paused   bool
+	Created  time.Time // Time created.
+	Updated  time.Time // Time last updated.
+}
+
+// SchedulesMigrate creates the 'schedules' table if it does not exist.
+func SchedulesMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_schedules + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL,
+		profile VARCHAR(255) NOT NULL,
+		tile VARCHAR(255) NOT NULL,
+		group_name VARCHAR(255) NOT NULL,
+		cron VARCHAR(255) NOT NULL,
+		interval INTEGER NOT NULL,
+		jitter INTEGER NOT NULL,
+		paused BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.SchedulesMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// ScheduleCreate adds the schedule to the database and returns it with its ID set.
+func (db *SqliteDB) ScheduleCreate(data ScheduleData) (ScheduleData, error) {
+	if data.Name == "" {
+		return data, fmt.Errorf("SqliteDB.ScheduleCreate: name - %w", core.ErrParamEmpty)
+	}
+
+	now := time.Now()
+	query := `INSERT INTO ` + sqlite_tb_schedules + ` (name, profile, tile, group_name, cron, interval, jitter, paused, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.Exec(
+		query,
+		data.Name,
+		data.Profile,
+		data.Tile,
+		data.Group,
+		data.Cron,
+		int64(data.Interval),
+		int64(data.Jitter),
+		data.Paused,
+		now,
+		now,
+	)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ScheduleCreate: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ScheduleCreate: %w", err)
+	}
+
+	return db.ScheduleGet(id)
+}
+
+// ScheduleGet retrieves a schedule from the database by ID. Returns sql.ErrNoRows if the schedule
+// does not exist.
+func (db *SqliteDB) ScheduleGet(id int64) (ScheduleData, error) {
+	query := `SELECT * FROM ` + sqlite_tb_schedules + ` WHERE id = ?`
+	row, err := db.QueryRow(query, id)
+	if err != nil {
+		return ScheduleData{}, fmt.Errorf("SqliteDB.ScheduleGet: %w", err)
+	}
+
+	data, err := scanSchedule(row)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ScheduleGet: %w", err)
+	}
+
+	return data, nil
+}
+
+// ScheduleList returns every schedule ordered by ID.
+func (db *SqliteDB) ScheduleList() ([]ScheduleData, error) {
+	rows, err := db.Query(`SELECT * FROM ` + sqlite_tb_schedules + ` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.ScheduleList: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ScheduleData
+	for rows.Next() {
+		data, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.ScheduleList: %w", err)
+		}
+
+		list = append(list, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.ScheduleList: %w", err)
+	}
+
+	return list, nil
+}
+
+// ScheduleUpdate updates the schedule in the database. Returns sql.ErrNoRows if the schedule does
+// not exist.
+func (db *SqliteDB) ScheduleUpdate(data ScheduleData) (ScheduleData, error) {
+	if data.ID == 0 {
+		return data, fmt.Errorf("SqliteDB.ScheduleUpdate: id - %w", core.ErrParamEmpty)
+	}
+
+	query := `UPDATE ` + sqlite_tb_schedules + ` SET name = ?, profile = ?, tile = ?, group_name = ?, cron = ?, interval = ?, jitter = ?, paused = ?, updated_at = ? WHERE id = ?`
+	res, err := db.Exec(
+		query,
+		data.Name,
+		data.Profile,
+		data.Tile,
+		data.Group,
+		data.Cron,
+		int64(data.Interval),
+		int64(data.Jitter),
+		data.Paused,
+		time.Now(),
+		data.ID,
+	)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ScheduleUpdate: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return data, fmt.Errorf("SqliteDB.ScheduleUpdate: %w", sql.ErrNoRows)
+	}
+
+	return db.ScheduleGet(data.ID)
+}
+
+// ScheduleDelete deletes the schedule from the database. Returns sql.ErrNoRows if the schedule does
+// not exist.
+func (db *SqliteDB) ScheduleDelete(id int64) error {
+	res, err := db.Exec(`DELETE FROM `+sqlite_tb_schedules+` WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.ScheduleDelete: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SqliteDB.ScheduleDelete: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row scanner) (ScheduleData, error) {
+	var data ScheduleData
+	var interval, jitter int64
+	err := row.Scan(
+		&data.ID,
+		&data.Name,
+		&data.Profile,
+		&data.Tile,
+		&data.Group,
+		&data.Cron,
+		&interval,
+		&jitter,
+		&data.Paused,
+		&data.Created,
+		&data.Updated,
+	)
+	data.Interval = time.Duration(interval)
+	data.Jitter = time.Duration(jitter)
+	return data, err
+}
+
+// ############################################################################################## //
+// ####################################        Runs         ##################################### //
+// ############################################################################################## //
+
+// RunsMigrate creates the 'runs' table if it does not exist.
+func RunsMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_runs + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		profile VARCHAR(255) NOT NULL,
+		tile VARCHAR(255) NOT NULL,
+		group_name VARCHAR(255) NOT NULL,
+		trigger VARCHAR(32) NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		schedule_id INTEGER NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		duration INTEGER NOT NULL,
+		passed BOOLEAN NOT NULL,
+		summary TEXT NOT NULL,
+		error TEXT NOT NULL,
+		skipped TEXT NOT NULL DEFAULT '[]',
+		silenced BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX IF NOT EXISTS idx_runs_profile_tile ON ` + sqlite_tb_runs + ` (profile, tile);
+	CREATE INDEX IF NOT EXISTS idx_runs_schedule_id ON ` + sqlite_tb_runs + ` (schedule_id);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.RunsMigrate: %w", err)
+	}
+
+	// Tables created before maintenance windows are missing the skipped and silenced columns.
+	err := db.addColumns(sqlite_tb_runs, [][2]string{
+		{"skipped", "TEXT NOT NULL DEFAULT '[]'"},
+		{"silenced", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	})
+	if err != nil {
+		return fmt.Errorf("SqliteDB.RunsMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// addColumns adds each {name, definition} column which the table does not have yet.
+func (db *SqliteDB) addColumns(table string, columns [][2]string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.addColumns: %w", err)
+	}
+	defer rows.Close()
+
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("SqliteDB.addColumns: %w", err)
+		}
+
+		have[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("SqliteDB.addColumns: %w", err)
+	}
+
+	for _, c := range columns {
+		if have[c[0]] {
+			continue
+		}
+
+		if _, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + c[0] + ` ` + c[1]); err != nil {
+			return fmt.Errorf("SqliteDB.addColumns: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RunRecord validates and adds the run to the history. Returns the run with its ID set.
+func (db *SqliteDB) RunRecord(run history.Run) (history.Run, error) {
+	if err := run.Validate(); err != nil {
+		return run, fmt.Errorf("SqliteDB.RunRecord: %w", err)
+	}
+
+	skipped, err := json.Marshal(run.Skipped)
+	if err != nil {
+		return run, fmt.Errorf("SqliteDB.RunRecord: %w", err)
+	}
+
+	query := `INSERT INTO ` + sqlite_tb_runs + ` (profile, tile, group_name, trigger, username, schedule_id, started_at, duration, passed, summary, error, skipped, silenced) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.Exec(
+		query,
+		run.Profile,
+		run.Tile,
+		run.Group,
+		run.Trigger,
+		run.User,
+		run.ScheduleID,
+		run.Started,
+		int64(run.Duration),
+		run.Passed,
+		run.Summary,
+		run.Err,
+		string(skipped),
+		run.Silenced,
+	)
+	if err != nil {
+		return run, fmt.Errorf("SqliteDB.RunRecord: %w", err)
+	}
+
+	if run.ID, err = res.LastInsertId(); err != nil {
+		return run, fmt.Errorf("SqliteDB.RunRecord: %w", err)
+	}
+
+	return run, nil
+}
+
+// RunList returns the runs which match filter, newest first.
+func (db *SqliteDB) RunList(filter history.Filter) ([]history.Run, error) {
+	var where []string
+	var args []any
+	if filter.Profile != "" {
+		where = append(where, "profile = ?")
+		args = append(args, filter.Profile)
+	}
+
+	if filter.Tile != "" {
+		where = append(where, "tile = ?")
+		args = append(args, filter.Tile)
+	}
+
+	if filter.ScheduleID != 0 {
+		where = append(where, "schedule_id = ?")
+		args = append(args, filter.ScheduleID)
+	}
+
+	query := `SELECT * FROM ` + sqlite_tb_runs
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	query += ` ORDER BY id DESC LIMIT ?`
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.RunList: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []history.Run
+	for rows.Next() {
+		var r history.Run
+		var duration int64
+		var skipped string
+		err := rows.Scan(
+			&r.ID,
+			&r.Profile,
+			&r.Tile,
+			&r.Group,
+			&r.Trigger,
+			&r.User,
+			&r.ScheduleID,
+			&r.Started,
+			&duration,
+			&r.Passed,
+			&r.Summary,
+			&r.Err,
+			&skipped,
+			&r.Silenced,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.RunList: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(skipped), &r.Skipped); err != nil {
+			return nil, fmt.Errorf("SqliteDB.RunList: %w", err)
+		}
+
+		r.Duration = time.Duration(duration)
+		runs = append(runs, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.RunList: %w", err)
+	}
+
+	return runs, nil
+}
+
+// ############################################################################################## //
+// #################################        Connectors         ################################## //
+// ############################################################################################## //
+
+// ConnectorData represents a named Connector in the database. Auth holds the names of stored
+// AuthMethods so no secrets are kept here.
+type ConnectorData struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Protocol string    `json:"protocol"`
+	User     string    `json:"user"`
+	Auth     []string  `json:"auth"`    // Stored as a JSON list.
+	Created  time.Time `json:"created"` // Time created.
+	Updated  time.Time `json:"updated"` // Time last updated.
+}
+
+// ConnectorsMigrate creates the 'connectors' table if it does not exist.
+func ConnectorsMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_connectors + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		protocol VARCHAR(32) NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		auth TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.ConnectorsMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// ConnectorCreate adds the connector to the database and returns it with its ID set. Names are
+// unique.
+func (db *SqliteDB) ConnectorCreate(data ConnectorData) (ConnectorData, error) {
+	if data.Name == "" {
+		return data, fmt.Errorf("SqliteDB.ConnectorCreate: name - %w", core.ErrParamEmpty)
+	}
+
+	if data.Protocol == "" {
+		return data, fmt.Errorf("SqliteDB.ConnectorCreate: protocol - %w", core.ErrParamEmpty)
+	}
+
+	auth, err := json.Marshal(data.Auth)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ConnectorCreate: %w", err)
+	}
+
+	now := time.Now()
+	query := `INSERT INTO ` + sqlite_tb_connectors + ` (name, protocol, username, auth, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, data.Name, data.Protocol, data.User, string(auth), now, now); err != nil {
+		if IsErrNotUnique(err) {
+			return data, fmt.Errorf("SqliteDB.ConnectorCreate: %w", ErrRecordExists)
+		}
+
+		return data, fmt.Errorf("SqliteDB.ConnectorCreate: %w", err)
+	}
+
+	return db.ConnectorGetByName(data.Name)
+}
+
+// ConnectorGetByName retrieves a connector from the database by name. Returns sql.ErrNoRows if
+// the connector does not exist.
+func (db *SqliteDB) ConnectorGetByName(name string) (ConnectorData, error) {
+	query := `SELECT * FROM ` + sqlite_tb_connectors + ` WHERE name = ?`
+	row, err := db.QueryRow(query, name)
+	if err != nil {
+		return ConnectorData{}, fmt.Errorf("SqliteDB.ConnectorGetByName: %w", err)
+	}
+
+	data, err := scanConnector(row)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.ConnectorGetByName: %w", err)
+	}
+
+	return data, nil
+}
+
+// ConnectorList returns every connector ordered by name.
+func (db *SqliteDB) ConnectorList() ([]ConnectorData, error) {
+	rows, err := db.Query(`SELECT * FROM ` + sqlite_tb_connectors + ` ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.ConnectorList: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ConnectorData
+	for rows.Next() {
+		data, err := scanConnector(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.ConnectorList: %w", err)
+		}
+
+		list = append(list, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.ConnectorList: %w", err)
+	}
+
+	return list, nil
+}
+
+// ConnectorDelete deletes the connector and every binding to it from the database. Returns
+// sql.ErrNoRows if the connector does not exist.
+func (db *SqliteDB) ConnectorDelete(name string) error {
+	res, err := db.Exec(`DELETE FROM `+sqlite_tb_connectors+` WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.ConnectorDelete: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SqliteDB.ConnectorDelete: %w", sql.ErrNoRows)
+	}
+
+	if _, err := db.Exec(`DELETE FROM `+sqlite_tb_bindings+` WHERE connector = ?`, name); err != nil {
+		return fmt.Errorf("SqliteDB.ConnectorDelete: %w", err)
+	}
+
+	return nil
+}
+
+func scanConnector(row scanner) (ConnectorData, error) {
+	var data ConnectorData
+	var auth string
+	err := row.Scan(
+		&data.ID,
+		&data.Name,
+		&data.Protocol,
+		&data.User,
+		&auth,
+		&data.Created,
+		&data.Updated,
+	)
+	if err != nil {
+		return data, err
+	}
+
+	return data, json.Unmarshal([]byte(auth), &data.Auth)
+}
+
+// ############################################################################################## //
+// ##################################        Bindings         ################################### //
+// ############################################################################################## //
+
+// BindingData binds a connector to a Group in a Profile. An empty Tile is the Group default.
+type BindingData struct {
+	ID        int64     `json:"id"`
+	Profile   string    `json:"profile"`
+	Group     string    `json:"group"`
+	Tile      string    `json:"tile"`
+	Connector string    `json:"connector"` // Connector name.
+	Created   time.Time `json:"created"`   // Time created.
+}
+
+// BindingsMigrate creates the 'connector_bindings' table if it does not exist.
+func BindingsMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_bindings + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		profile VARCHAR(255) NOT NULL,
+		group_name VARCHAR(255) NOT NULL,
+		tile VARCHAR(255) NOT NULL,
+		connector VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (profile, group_name, tile)
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.BindingsMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// BindingSet binds the connector to the Group and Tile of the Profile, replacing any connector
+// already bound there. Returns the binding with its ID set.
+func (db *SqliteDB) BindingSet(data BindingData) (BindingData, error) {
+	if data.Profile == "" {
+		return data, fmt.Errorf("SqliteDB.BindingSet: profile - %w", core.ErrParamEmpty)
+	}
+
+	if data.Group == "" {
+		return data, fmt.Errorf("SqliteDB.BindingSet: group - %w", core.ErrParamEmpty)
+	}
+
+	if data.Connector == "" {
+		return data, fmt.Errorf("SqliteDB.BindingSet: connector - %w", core.ErrParamEmpty)
+	}
+
+	query := `INSERT INTO ` + sqlite_tb_bindings + ` (profile, group_name, tile, connector, created_at) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (profile, group_name, tile) DO UPDATE SET connector = excluded.connector, created_at = excluded.created_at`
+	if _, err := db.Exec(query, data.Profile, data.Group, data.Tile, data.Connector, time.Now()); err != nil {
+		return data, fmt.Errorf("SqliteDB.BindingSet: %w", err)
+	}
+
+	query = `SELECT * FROM ` + sqlite_tb_bindings + ` WHERE profile = ? AND group_name = ? AND tile = ?`
+	row, err := db.QueryRow(query, data.Profile, data.Group, data.Tile)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.BindingSet: %w", err)
+	}
+
+	data, err = scanBinding(row)
+	if err != nil {
+		return data, fmt.Errorf("SqliteDB.BindingSet: %w", err)
+	}
+
+	return data, nil
+}
+
+// BindingList returns the bindings of the Profile ordered by Group then Tile.
+func (db *SqliteDB) BindingList(profile string) ([]BindingData, error) {
+	query := `SELECT * FROM ` + sqlite_tb_bindings + ` WHERE profile = ? ORDER BY group_name, tile`
+	rows, err := db.Query(query, profile)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.BindingList: %w", err)
+	}
+	defer rows.Close()
+
+	var list []BindingData
+	for rows.Next() {
+		data, err := scanBinding(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.BindingList: %w", err)
+		}
+
+		list = append(list, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.BindingList: %w", err)
+	}
+
+	return list, nil
+}
+
+// BindingDelete deletes the binding from the database. Returns sql.ErrNoRows if the binding does
+// not exist.
+func (db *SqliteDB) BindingDelete(id int64) error {
+	res, err := db.Exec(`DELETE FROM `+sqlite_tb_bindings+` WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.BindingDelete: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SqliteDB.BindingDelete: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func scanBinding(row scanner) (BindingData, error) {
+	var data BindingData
+	err := row.Scan(&data.ID, &data.Profile, &data.Group, &data.Tile, &data.Connector, &data.Created)
+	return data, err
+}
+
+// ############################################################################################## //
+// #################################        Maintenance        ################################## //
+// ############################################################################################## //
+
+// MaintenanceMigrate creates the 'maintenance_windows' table if it does not exist.
+func MaintenanceMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_maintenance + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		profile VARCHAR(255) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		target VARCHAR(255) NOT NULL,
+		reason TEXT NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		starts_at TIMESTAMP NOT NULL,
+		ends_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_maintenance_ends_at ON ` + sqlite_tb_maintenance + ` (ends_at);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.MaintenanceMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// MaintenanceCreate validates and adds the maintenance window. Returns it with its ID set.
+func (db *SqliteDB) MaintenanceCreate(w maintenance.Window) (maintenance.Window, error) {
+	if err := w.Validate(); err != nil {
+		return w, fmt.Errorf("SqliteDB.MaintenanceCreate: %w", err)
+	}
+
+	query := `INSERT INTO ` + sqlite_tb_maintenance + ` (profile, kind, target, reason, username, starts_at, ends_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	// Times are stored in UTC so they compare correctly as text.
+	res, err := db.Exec(query, w.Profile, w.Kind, w.Target, w.Reason, w.User, w.Start.UTC(), w.End.UTC())
+	if err != nil {
+		return w, fmt.Errorf("SqliteDB.MaintenanceCreate: %w", err)
+	}
+
+	if w.ID, err = res.LastInsertId(); err != nil {
+		return w, fmt.Errorf("SqliteDB.MaintenanceCreate: %w", err)
+	}
+
+	return w, nil
+}
+
+// MaintenanceList returns the maintenance windows which match filter ordered by start time.
+func (db *SqliteDB) MaintenanceList(filter maintenance.Filter) ([]maintenance.Window, error) {
+	var where []string
+	var args []any
+	if filter.Profile != "" {
+		where = append(where, "(profile = '' OR profile = ?)")
+		args = append(args, filter.Profile)
+	}
+
+	if !filter.ActiveAt.IsZero() {
+		where = append(where, "starts_at <= ? AND ends_at > ?")
+		args = append(args, filter.ActiveAt.UTC(), filter.ActiveAt.UTC())
+	}
+
+	query := `SELECT * FROM ` + sqlite_tb_maintenance
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	rows, err := db.Query(query+` ORDER BY starts_at, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.MaintenanceList: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []maintenance.Window
+	for rows.Next() {
+		var w maintenance.Window
+		err := rows.Scan(&w.ID, &w.Profile, &w.Kind, &w.Target, &w.Reason, &w.User, &w.Start, &w.End)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.MaintenanceList: %w", err)
+		}
+
+		windows = append(windows, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.MaintenanceList: %w", err)
+	}
+
+	return windows, nil
+}
+
+// MaintenanceDelete deletes the maintenance window. Returns sql.ErrNoRows if it does not exist.
+func (db *SqliteDB) MaintenanceDelete(id int64) error {
+	res, err := db.Exec(`DELETE FROM `+sqlite_tb_maintenance+` WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("SqliteDB.MaintenanceDelete: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SqliteDB.MaintenanceDelete: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// MaintenanceExpire deletes the maintenance windows which ended before the time. Returns how many
+// were deleted.
+func (db *SqliteDB) MaintenanceExpire(before time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM `+sqlite_tb_maintenance+` WHERE ends_at <= ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("SqliteDB.MaintenanceExpire: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("SqliteDB.MaintenanceExpire: %w", err)
+	}
+
+	return n, nil
+}
+
+// ############################################################################################## //
+// ##################################        Approvals        ################################### //
+// ############################################################################################## //
+
+// ApprovalsMigrate creates the 'approvals' table if it does not exist.
+func ApprovalsMigrate(db *SqliteDB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ` + sqlite_tb_approvals + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		profile VARCHAR(255) NOT NULL,
+		tile VARCHAR(255) NOT NULL,
+		group_name VARCHAR(255) NOT NULL,
+		requester VARCHAR(255) NOT NULL,
+		approver VARCHAR(255) NOT NULL DEFAULT '',
+		status VARCHAR(32) NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		decided_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_approvals_status ON ` + sqlite_tb_approvals + ` (status, expires_at);`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("SqliteDB.ApprovalsMigrate: %w", err)
+	}
+
+	return nil
+}
+
+// ApprovalCreate validates and adds the approval request. Returns it with its ID set.
+func (db *SqliteDB) ApprovalCreate(r approval.Request) (approval.Request, error) {
+	if err := r.Validate(); err != nil {
+		return r, fmt.Errorf("SqliteDB.ApprovalCreate: %w", err)
+	}
+
+	query := `INSERT INTO ` + sqlite_tb_approvals + ` (profile, tile, group_name, requester, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	// Times are stored in UTC so they compare correctly as text.
+	res, err := db.Exec(query, r.Profile, r.Tile, r.Group, r.Requester, r.Status, r.Created.UTC(), r.Expires.UTC())
+	if err != nil {
+		return r, fmt.Errorf("SqliteDB.ApprovalCreate: %w", err)
+	}
+
+	if r.ID, err = res.LastInsertId(); err != nil {
+		return r, fmt.Errorf("SqliteDB.ApprovalCreate: %w", err)
+	}
+
+	return r, nil
+}
+
+// ApprovalGet returns the approval request. Returns sql.ErrNoRows if it does not exist.
+func (db *SqliteDB) ApprovalGet(id int64) (approval.Request, error) {
+	row, err := db.QueryRow(`SELECT * FROM `+sqlite_tb_approvals+` WHERE id = ?`, id)
+	if err != nil {
+		return approval.Request{}, fmt.Errorf("SqliteDB.ApprovalGet: %w", err)
+	}
+
+	r, err := scanApproval(row)
+	if err != nil {
+		return r, fmt.Errorf("SqliteDB.ApprovalGet: %w", err)
+	}
+
+	return r, nil
+}
+
+// ApprovalList returns the approval requests which match filter, newest first.
+func (db *SqliteDB) ApprovalList(filter approval.Filter) ([]approval.Request, error) {
+	var where []string
+	var args []any
+	if filter.Profile != "" {
+		where = append(where, "profile = ?")
+		args = append(args, filter.Profile)
+	}
+
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := `SELECT * FROM ` + sqlite_tb_approvals
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	rows, err := db.Query(query+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SqliteDB.ApprovalList: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []approval.Request
+	for rows.Next() {
+		r, err := scanApproval(rows)
+		if err != nil {
+			return nil, fmt.Errorf("SqliteDB.ApprovalList: %w", err)
+		}
+
+		requests = append(requests, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SqliteDB.ApprovalList: %w", err)
+	}
+
+	return requests, nil
+}
+
+// ApprovalDecide approves or rejects a pending approval request. Only one decision can be made even
+// if two approvers race. See approval.Store.
+func (db *SqliteDB) ApprovalDecide(id int64, status, approver string, at time.Time) (approval.Request, error) {
+	if err := approval.CheckDecision(status, approver); err != nil {
+		return approval.Request{}, fmt.Errorf("SqliteDB.ApprovalDecide: %w", err)
+	}
+
+	query := `UPDATE ` + sqlite_tb_approvals + ` SET status = ?, approver = ?, decided_at = ?
+		WHERE id = ? AND status = ? AND expires_at > ?`
+	res, err := db.Exec(query, status, approver, at.UTC(), id, approval.StatusPending, at.UTC())
+	if err != nil {
+		return approval.Request{}, fmt.Errorf("SqliteDB.ApprovalDecide: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return approval.Request{}, fmt.Errorf("SqliteDB.ApprovalDecide: %w", err)
+	}
+
+	r, err := db.ApprovalGet(id)
+	if err != nil {
+		return r, fmt.Errorf("SqliteDB.ApprovalDecide: %w", err)
+	}
+
+	if n > 0 {
+		return r, nil
+	}
+
+	if r.Expired(at) {
+		if _, err := db.ApprovalExpire(at); err != nil {
+			return r, fmt.Errorf("SqliteDB.ApprovalDecide: %w", err)
+		}
+
+		r.Status, r.Decided = approval.StatusExpired, &r.Expires
+		return r, fmt.Errorf("SqliteDB.ApprovalDecide: %w", approval.ErrExpired)
+	}
+
+	return r, fmt.Errorf("SqliteDB.ApprovalDecide: %w: %s", approval.ErrNotPending, r.Status)
+}
+
+// ApprovalExpire marks the pending approval requests which expired before the time. Returns how
+// many were marked.
+func (db *SqliteDB) ApprovalExpire(before time.Time) (int64, error) {
+	query := `UPDATE ` + sqlite_tb_approvals + ` SET status = ?, decided_at = expires_at WHERE status = ? AND expires_at <= ?`
+	res, err := db.Exec(query, approval.StatusExpired, approval.StatusPending, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("SqliteDB.ApprovalExpire: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("SqliteDB.ApprovalExpire: %w", err)
+	}
+
+	return n, nil
+}
+
+func scanApproval(row scanner) (approval.Request, error) {
+	var r approval.Request
+	var decided sql.NullTime
+	err := row.Scan(&r.ID, &r.Profile, &r.Tile, &r.Group, &r.Requester, &r.Approver, &r.Status, &r.Created, &r.Expires, &decided)
+	if decided.Valid {
+		r.Decided = &decided.Time
+	}
+
+	return r, err
+}
@@ -8,6 +8,10 @@ import (
 	"time"
 
 	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
 	"github.com/stretchr/testify/require"
 )
 
@@ -1223,3 +1227,392 @@ func TestSqliteAddRepo(t *testing.T) {
 	DeleteDB(db_file)
 }
 */
+
+func TestSqliteDBAuditLog(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	t.Run("record", func(t *testing.T) {
+		for _, outcome := range []string{audit.OutcomeDenied, audit.OutcomeSuccess} {
+			err := db.AuditRecord(audit.Entry{
+				User:    "admin",
+				Action:  audit.ActionRemediate,
+				Profile: "Web",
+				Tile:    "Nginx",
+				Server:  "host1",
+				Outcome: outcome,
+				Detail:  "1 pass",
+			})
+			require.NoError(err, "AuditRecord returned an error: %s", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := db.AuditRecord(audit.Entry{Action: audit.ActionRemediate})
+		require.ErrorIs(err, audit.ErrInvalidEntry, "AuditRecord did not validate the entry")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		entries, err := db.AuditList(0)
+		require.NoError(err, "AuditList returned an error: %s", err)
+		require.Len(entries, 2, "AuditList did not return every entry")
+		require.Equal(audit.OutcomeSuccess, entries[0].Outcome, "entries were not newest first")
+		require.Equal("Nginx", entries[0].Tile, "Tile did not match")
+		require.False(entries[0].Time.IsZero(), "Time was not set")
+
+		entries, err = db.AuditList(1)
+		require.NoError(err, "AuditList returned an error: %s", err)
+		require.Len(entries, 1, "AuditList did not honor the limit")
+	})
+
+	t.Run("start and finish", func(t *testing.T) {
+		id, err := db.AuditStart(audit.Entry{User: "admin", Action: audit.ActionRemediate, Tile: "Nginx"})
+		require.NoError(err, "AuditStart returned an error: %s", err)
+		entries, err := db.AuditList(1)
+		require.NoError(err, "AuditList returned an error: %s", err)
+		require.Equal(id, entries[0].ID, "AuditStart did not return the entry ID")
+		require.Equal(audit.OutcomeStarted, entries[0].Outcome, "entry was not started")
+
+		require.NoError(db.AuditFinish(id, audit.OutcomeFailure, "restart failed"), "AuditFinish returned an error")
+		entries, err = db.AuditList(0)
+		require.NoError(err, "AuditList returned an error: %s", err)
+		require.Len(entries, 3, "AuditFinish added an entry")
+		require.Equal(audit.OutcomeFailure, entries[0].Outcome, "outcome was not updated")
+		require.Equal("restart failed", entries[0].Detail, "detail was not updated")
+
+		err = db.AuditFinish(id, audit.OutcomeSuccess, "")
+		require.ErrorIs(err, audit.ErrNotStarted, "AuditFinish changed a finished entry")
+	})
+}
+
+func TestSqliteDBSchedules(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	var sched ScheduleData
+	t.Run("create", func(t *testing.T) {
+		sched, err = db.ScheduleCreate(ScheduleData{
+			Name:     "Often",
+			Profile:  "Web",
+			Tile:     "Nginx",
+			Group:    "Prod",
+			Interval: 5 * time.Minute,
+			Jitter:   30 * time.Second,
+		})
+		require.NoError(err, "ScheduleCreate returned an error: %s", err)
+		require.NotZero(sched.ID, "ID was not set")
+		require.Equal(5*time.Minute, sched.Interval, "Interval did not match")
+		require.Equal(30*time.Second, sched.Jitter, "Jitter did not match")
+		require.False(sched.Created.IsZero(), "Created was not set")
+
+		_, err = db.ScheduleCreate(ScheduleData{})
+		require.ErrorIs(err, core.ErrParamEmpty, "ScheduleCreate did not check the name")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		sched.Paused = true
+		sched.Interval = 0
+		sched.Cron = "@hourly"
+		got, err := db.ScheduleUpdate(sched)
+		require.NoError(err, "ScheduleUpdate returned an error: %s", err)
+		require.True(got.Paused, "Paused was not updated")
+		require.Equal("@hourly", got.Cron, "Cron was not updated")
+		require.Zero(got.Interval, "Interval was not updated")
+
+		_, err = db.ScheduleUpdate(ScheduleData{ID: 99, Name: "Bogus"})
+		require.ErrorIs(err, sql.ErrNoRows, "ScheduleUpdate did not return sql.ErrNoRows")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := db.ScheduleList()
+		require.NoError(err, "ScheduleList returned an error: %s", err)
+		require.Len(list, 1, "ScheduleList did not return every schedule")
+		require.Equal(sched.ID, list[0].ID, "ID did not match")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(db.ScheduleDelete(sched.ID), "ScheduleDelete returned an error")
+		_, err := db.ScheduleGet(sched.ID)
+		require.ErrorIs(err, sql.ErrNoRows, "schedule was not deleted")
+		require.ErrorIs(db.ScheduleDelete(sched.ID), sql.ErrNoRows, "ScheduleDelete did not return sql.ErrNoRows")
+	})
+}
+
+func TestSqliteDBConnectors(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	t.Run("create", func(t *testing.T) {
+		conn, err := db.ConnectorCreate(ConnectorData{Name: "deploy", Protocol: "ssh", User: "deploy", Auth: []string{"deploy-key"}})
+		require.NoError(err, "ConnectorCreate returned an error: %s", err)
+		require.NotZero(conn.ID, "ID was not set")
+		require.Equal([]string{"deploy-key"}, conn.Auth, "Auth did not match")
+
+		_, err = db.ConnectorCreate(ConnectorData{Name: "deploy", Protocol: "ssh"})
+		require.ErrorIs(err, ErrRecordExists, "ConnectorCreate did not return ErrRecordExists")
+		_, err = db.ConnectorCreate(ConnectorData{Protocol: "ssh"})
+		require.ErrorIs(err, core.ErrParamEmpty, "ConnectorCreate did not check the name")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		_, err := db.ConnectorCreate(ConnectorData{Name: "backup", Protocol: "ssh", User: "backup"})
+		require.NoError(err, "ConnectorCreate returned an error: %s", err)
+
+		list, err := db.ConnectorList()
+		require.NoError(err, "ConnectorList returned an error: %s", err)
+		require.Len(list, 2, "ConnectorList did not return every connector")
+		require.Equal("backup", list[0].Name, "ConnectorList was not ordered by name")
+		require.Empty(list[0].Auth, "Auth was not empty")
+	})
+
+	t.Run("bindings", func(t *testing.T) {
+		b, err := db.BindingSet(BindingData{Profile: "Web", Group: "prod", Connector: "deploy"})
+		require.NoError(err, "BindingSet returned an error: %s", err)
+		require.NotZero(b.ID, "ID was not set")
+
+		_, err = db.BindingSet(BindingData{Profile: "Web", Group: "prod", Tile: "Backup", Connector: "deploy"})
+		require.NoError(err, "BindingSet returned an error: %s", err)
+		got, err := db.BindingSet(BindingData{Profile: "Web", Group: "prod", Tile: "Backup", Connector: "backup"})
+		require.NoError(err, "BindingSet returned an error: %s", err)
+		require.Equal("backup", got.Connector, "BindingSet did not replace the binding")
+
+		_, err = db.BindingSet(BindingData{Profile: "Web", Group: "prod"})
+		require.ErrorIs(err, core.ErrParamEmpty, "BindingSet did not check the connector")
+
+		list, err := db.BindingList("Web")
+		require.NoError(err, "BindingList returned an error: %s", err)
+		require.Len(list, 2, "BindingList did not return every binding")
+		require.Equal("", list[0].Tile, "BindingList was not ordered by tile")
+		require.Equal("Backup", list[1].Tile, "BindingList was not ordered by tile")
+
+		require.NoError(db.BindingDelete(b.ID), "BindingDelete returned an error")
+		require.ErrorIs(db.BindingDelete(b.ID), sql.ErrNoRows, "BindingDelete did not return sql.ErrNoRows")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(db.ConnectorDelete("backup"), "ConnectorDelete returned an error")
+		_, err := db.ConnectorGetByName("backup")
+		require.ErrorIs(err, sql.ErrNoRows, "connector was not deleted")
+		require.ErrorIs(db.ConnectorDelete("backup"), sql.ErrNoRows, "ConnectorDelete did not return sql.ErrNoRows")
+
+		list, err := db.BindingList("Web")
+		require.NoError(err, "BindingList returned an error: %s", err)
+		require.Empty(list, "ConnectorDelete did not delete its bindings")
+	})
+}
+
+func TestSqliteDBMaintenance(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	now := time.Now()
+	active, err := db.MaintenanceCreate(maintenance.Window{
+		Profile: "Web",
+		Kind:    maintenance.KindGroup,
+		Target:  "Prod",
+		Reason:  "patching",
+		Start:   now.Add(-time.Hour),
+		End:     now.Add(time.Hour),
+	})
+	require.NoError(err, "MaintenanceCreate returned an error: %s", err)
+	require.NotZero(active.ID, "ID was not set")
+
+	_, err = db.MaintenanceCreate(maintenance.Window{Kind: maintenance.KindServer, Target: "web01", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	require.NoError(err, "MaintenanceCreate returned an error: %s", err)
+	_, err = db.MaintenanceCreate(maintenance.Window{Kind: maintenance.KindServer, Target: "web02", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	require.NoError(err, "MaintenanceCreate returned an error: %s", err)
+	_, err = db.MaintenanceCreate(maintenance.Window{Kind: "rack", Target: "r1", Start: now, End: now.Add(time.Hour)})
+	require.ErrorIs(err, maintenance.ErrInvalidWindow, "MaintenanceCreate did not validate the window")
+
+	t.Run("list", func(t *testing.T) {
+		all, err := db.MaintenanceList(maintenance.Filter{})
+		require.NoError(err, "MaintenanceList returned an error: %s", err)
+		require.Len(all, 3, "MaintenanceList did not return every window")
+		require.Equal("web01", all[0].Target, "MaintenanceList was not ordered by start")
+
+		got, err := db.MaintenanceList(maintenance.Filter{Profile: "Web", ActiveAt: now})
+		require.NoError(err, "MaintenanceList returned an error: %s", err)
+		require.Len(got, 1, "MaintenanceList did not filter active windows")
+		require.Equal(active.ID, got[0].ID, "ID did not match")
+		require.Equal("patching", got[0].Reason, "Reason did not match")
+
+		got, err = db.MaintenanceList(maintenance.Filter{Profile: "Other", ActiveAt: now})
+		require.NoError(err, "MaintenanceList returned an error: %s", err)
+		require.Empty(got, "MaintenanceList did not filter by profile")
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		n, err := db.MaintenanceExpire(now)
+		require.NoError(err, "MaintenanceExpire returned an error: %s", err)
+		require.Equal(int64(1), n, "MaintenanceExpire did not delete the ended window")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(db.MaintenanceDelete(active.ID), "MaintenanceDelete returned an error")
+		require.ErrorIs(db.MaintenanceDelete(active.ID), sql.ErrNoRows, "MaintenanceDelete did not return sql.ErrNoRows")
+	})
+}
+
+func TestSqliteDBApprovals(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	web, err := db.ApprovalCreate(approval.NewRequest("Web", "Restart", "Prod", "alice", time.Hour))
+	require.NoError(err, "ApprovalCreate returned an error: %s", err)
+	require.NotZero(web.ID, "ID was not set")
+
+	old := approval.NewRequest("DB", "Failover", "Prod", "alice", time.Hour)
+	old.Created, old.Expires = old.Created.Add(-2*time.Hour), old.Expires.Add(-2*time.Hour)
+	old, err = db.ApprovalCreate(old)
+	require.NoError(err, "ApprovalCreate returned an error: %s", err)
+
+	_, err = db.ApprovalCreate(approval.Request{Profile: "Web"})
+	require.ErrorIs(err, approval.ErrInvalidRequest, "ApprovalCreate did not validate the request")
+
+	t.Run("get and list", func(t *testing.T) {
+		got, err := db.ApprovalGet(web.ID)
+		require.NoError(err, "ApprovalGet returned an error: %s", err)
+		require.Equal("alice", got.Requester, "Requester did not match")
+		require.Equal(approval.StatusPending, got.Status, "Status did not match")
+		require.Nil(got.Decided, "Decided was set")
+		_, err = db.ApprovalGet(99)
+		require.ErrorIs(err, sql.ErrNoRows, "ApprovalGet did not return sql.ErrNoRows")
+
+		all, err := db.ApprovalList(approval.Filter{})
+		require.NoError(err, "ApprovalList returned an error: %s", err)
+		require.Len(all, 2, "ApprovalList did not return every request")
+		require.Equal(old.ID, all[0].ID, "ApprovalList was not newest first")
+
+		got2, err := db.ApprovalList(approval.Filter{Profile: "Web", Status: approval.StatusPending})
+		require.NoError(err, "ApprovalList returned an error: %s", err)
+		require.Len(got2, 1, "ApprovalList did not filter")
+	})
+
+	t.Run("decide", func(t *testing.T) {
+		got, err := db.ApprovalDecide(web.ID, approval.StatusApproved, "bob", time.Now())
+		require.NoError(err, "ApprovalDecide returned an error: %s", err)
+		require.Equal(approval.StatusApproved, got.Status, "Status did not match")
+		require.Equal("bob", got.Approver, "Approver did not match")
+		require.NotNil(got.Decided, "Decided was not set")
+
+		_, err = db.ApprovalDecide(web.ID, approval.StatusRejected, "carol", time.Now())
+		require.ErrorIs(err, approval.ErrNotPending, "ApprovalDecide decided twice")
+		_, err = db.ApprovalDecide(web.ID, "maybe", "carol", time.Now())
+		require.ErrorIs(err, approval.ErrInvalidRequest, "ApprovalDecide allowed an unknown decision")
+		_, err = db.ApprovalDecide(99, approval.StatusApproved, "bob", time.Now())
+		require.ErrorIs(err, sql.ErrNoRows, "ApprovalDecide did not return sql.ErrNoRows")
+
+		got, err = db.ApprovalDecide(old.ID, approval.StatusApproved, "bob", time.Now())
+		require.ErrorIs(err, approval.ErrExpired, "ApprovalDecide did not return ErrExpired")
+		require.Equal(approval.StatusExpired, got.Status, "request was not marked expired")
+		got, err = db.ApprovalGet(old.ID)
+		require.NoError(err, "ApprovalGet returned an error: %s", err)
+		require.Equal(approval.StatusExpired, got.Status, "expired status was not stored")
+		require.Empty(got.Approver, "Approver was set on an expired request")
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		pending, err := db.ApprovalCreate(approval.NewRequest("Web", "Restart", "Prod", "alice", time.Hour))
+		require.NoError(err, "ApprovalCreate returned an error: %s", err)
+
+		n, err := db.ApprovalExpire(time.Now())
+		require.NoError(err, "ApprovalExpire returned an error: %s", err)
+		require.Zero(n, "ApprovalExpire expired a current request")
+		n, err = db.ApprovalExpire(pending.Expires)
+		require.NoError(err, "ApprovalExpire returned an error: %s", err)
+		require.Equal(int64(1), n, "ApprovalExpire did not expire the pending request")
+	})
+}
+
+func TestSqliteDBRuns(t *testing.T) {
+	require := require.New(t)
+	db := TestSqliteCuttleDBSetup(t)
+	defer db.Close()
+	defer DeleteDB(TestCuttleDBName)
+
+	err := db.CuttleMigrate()
+	require.NoError(err, "CuttleMigrate returned an error: %s", err)
+
+	t.Run("record", func(t *testing.T) {
+		runs := []history.Run{
+			{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: history.TriggerManual, User: "admin", Passed: true},
+			{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: history.TriggerSchedule, ScheduleID: 1, Err: "failed"},
+			{Profile: "Web", Tile: "Disk", Group: "Prod", Trigger: history.TriggerSchedule, ScheduleID: 2, Passed: true, Skipped: []string{"web02"}},
+		}
+
+		for _, r := range runs {
+			r.Started = time.Now()
+			r.Duration = 1500 * time.Millisecond
+			got, err := db.RunRecord(r)
+			require.NoError(err, "RunRecord returned an error: %s", err)
+			require.NotZero(got.ID, "ID was not set")
+		}
+
+		_, err := db.RunRecord(history.Run{Trigger: history.TriggerManual})
+		require.ErrorIs(err, history.ErrInvalidRun, "RunRecord did not validate the run")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		runs, err := db.RunList(history.Filter{})
+		require.NoError(err, "RunList returned an error: %s", err)
+		require.Len(runs, 3, "RunList did not return every run")
+		require.Equal("Disk", runs[0].Tile, "runs were not newest first")
+		require.Equal(1500*time.Millisecond, runs[0].Duration, "Duration did not match")
+		require.Equal([]string{"web02"}, runs[0].Skipped, "Skipped did not match")
+		require.Nil(runs[1].Skipped, "Skipped was not empty")
+
+		runs, err = db.RunList(history.Filter{Tile: "Nginx", ScheduleID: 1})
+		require.NoError(err, "RunList returned an error: %s", err)
+		require.Len(runs, 1, "RunList did not filter")
+		require.Equal("failed", runs[0].Err, "Err did not match")
+
+		runs, err = db.RunList(history.Filter{Profile: "Web", Limit: 2})
+		require.NoError(err, "RunList returned an error: %s", err)
+		require.Len(runs, 2, "RunList did not honor the limit")
+	})
+
+	t.Run("old table", func(t *testing.T) {
+		_, err := db.Exec(`DROP TABLE ` + sqlite_tb_runs)
+		require.NoError(err, "DROP TABLE returned an error: %s", err)
+		_, err = db.Exec(`CREATE TABLE ` + sqlite_tb_runs + ` (id INTEGER PRIMARY KEY AUTOINCREMENT, profile VARCHAR(255) NOT NULL, tile VARCHAR(255) NOT NULL, group_name VARCHAR(255) NOT NULL, trigger VARCHAR(32) NOT NULL, username VARCHAR(255) NOT NULL, schedule_id INTEGER NOT NULL, started_at TIMESTAMP NOT NULL, duration INTEGER NOT NULL, passed BOOLEAN NOT NULL, summary TEXT NOT NULL, error TEXT NOT NULL)`)
+		require.NoError(err, "CREATE TABLE returned an error: %s", err)
+		_, err = db.Exec(`INSERT INTO ` + sqlite_tb_runs + ` (profile, tile, group_name, trigger, username, schedule_id, started_at, duration, passed, summary, error) VALUES ('Web', 'Nginx', 'Prod', 'manual', 'admin', 0, CURRENT_TIMESTAMP, 0, TRUE, '', '')`)
+		require.NoError(err, "INSERT returned an error: %s", err)
+
+		require.NoError(RunsMigrate(db), "RunsMigrate did not add the new columns")
+		require.NoError(RunsMigrate(db), "RunsMigrate was not idempotent")
+		_, err = db.RunRecord(history.Run{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: history.TriggerSchedule, ScheduleID: 1, Silenced: true})
+		require.NoError(err, "RunRecord returned an error: %s", err)
+
+		runs, err := db.RunList(history.Filter{})
+		require.NoError(err, "RunList returned an error: %s", err)
+		require.Len(runs, 2, "RunList did not return every run")
+		require.True(runs[0].Silenced, "Silenced did not match")
+		require.False(runs[1].Silenced, "old run was silenced")
+	})
+}
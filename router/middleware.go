@@ -110,37 +110,68 @@ func LoggerMiddleware(logger *core.Logger) Middleware {
 	}
 }
 
-func APIAuthMiddleware(logger *core.Logger, users db.CuttleDB) Middleware {
+// APIAuthMiddleware checks the bearer token in the Authorization header and adds its claims to the
+// request context under ClaimsKey.
+func APIAuthMiddleware(logger *core.Logger, authDB db.AuthDB) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
-				if r.Header.Get("Authorization") == "" {
-					logger.Println("no auth header")
-					err := RenderJSON(w, http.StatusUnauthorized, struct {
-						Error   string
-						Message string
-					}{
-						Error:   "unauthorized",
-						Message: "you need to login",
-					})
-					if err != nil {
-						logger.Printf("AuthMiddlware: response encode failed: %v\n", err)
-					}
+				bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if !ok || bearer == "" {
+					logger.Debugf("APIAuthMiddleware: no bearer token\n")
+					renderAuthError(logger, w, http.StatusUnauthorized, "unauthorized", "you need to login")
 					return
 				}
-				// Do something that fails.
-				//if !something {
-				//	// Return early.
-				//	http.NotFound(w, r)
-				//	return
-				//}
-
-				// Allow original handler to run.
+
+				claims, err := authDB.TokenGet(bearer)
+				if err != nil {
+					logger.Printf("APIAuthMiddleware: %s\n", err)
+					renderAuthError(logger, w, http.StatusUnauthorized, "unauthorized", "you need to login")
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), ClaimsKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+	}
+}
+
+// APIAdminMiddleware only allows admins through. It must run after APIAuthMiddleware.
+// INCOMPLETE: Users only have the permissions of an admin or none until permissions are stored per
+// user.
+func APIAdminMiddleware(logger *core.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				claims, ok := r.Context().Value(ClaimsKey).(*db.Claims)
+				if !ok {
+					renderAuthError(logger, w, http.StatusUnauthorized, "unauthorized", "you need to login")
+					return
+				}
+
+				if !claims.IsAdmin {
+					renderAuthError(logger, w, http.StatusForbidden, "forbidden", "you do not have permission")
+					return
+				}
+
 				next.ServeHTTP(w, r)
 			})
 	}
 }
 
+func renderAuthError(logger *core.Logger, w http.ResponseWriter, code int, e, msg string) {
+	err := RenderJSON(w, code, struct {
+		Error   string
+		Message string
+	}{
+		Error:   e,
+		Message: msg,
+	})
+	if err != nil {
+		logger.Printf("AuthMiddlware: response encode failed: %v\n", err)
+	}
+}
+
 type ContextKey string
 
 const ClaimsKey ContextKey = "claims"
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/stretchr/testify/require"
+)
+
+// testTokens is an AuthDB which only looks up tokens.
+type testTokens struct {
+	db.AuthDB
+	claims map[string]*db.Claims
+}
+
+func (t testTokens) TokenGet(bearer string) (*db.Claims, error) {
+	claims, ok := t.claims[bearer]
+	if !ok {
+		return &db.Claims{}, db.ErrTokenNotFound
+	}
+
+	return claims, nil
+}
+
+func TestMiddlewareAPIAuth(t *testing.T) {
+	require := require.New(t)
+	logger := core.NewLogger(io.Discard, "cuttle: ", 0, false)
+	tokens := testTokens{claims: map[string]*db.Claims{
+		"alice": {Username: "alice"},
+		"admin": {Username: "admin", IsAdmin: true},
+	}}
+
+	var got *db.Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value(ClaimsKey).(*db.Claims)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	auth := APIAuthMiddleware(logger, tokens)
+	admin := APIAdminMiddleware(logger)
+	serve := func(h http.Handler, header string) int {
+		got = nil
+		req := httptest.NewRequest("POST", "/v1/test", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		require.Equal(http.StatusUnauthorized, serve(auth(next), ""), "status did not match")
+		require.Equal(http.StatusUnauthorized, serve(auth(next), "Basic alice"), "status did not match")
+		require.Nil(got, "next handler ran")
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		require.Equal(http.StatusUnauthorized, serve(auth(next), "Bearer mallory"), "status did not match")
+		require.Nil(got, "next handler ran")
+	})
+
+	t.Run("good token", func(t *testing.T) {
+		require.Equal(http.StatusOK, serve(auth(next), "Bearer alice"), "status did not match")
+		require.Equal("alice", got.Username, "claims were not added")
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		require.Equal(http.StatusForbidden, serve(auth(admin(next)), "Bearer alice"), "status did not match")
+		require.Nil(got, "next handler ran")
+		require.Equal(http.StatusOK, serve(auth(admin(next)), "Bearer admin"), "status did not match")
+		require.Equal(http.StatusUnauthorized, serve(admin(next), ""), "status did not match")
+	})
+}
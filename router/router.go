@@ -105,6 +105,23 @@ func (group *RouterGroup) ANY(path string, handler http.Handler, middleware ...M
 }
 
 func (group *RouterGroup) GET(path string, handler http.Handler, middleware ...Middleware) {
+	group.handle("GET", path, handler, middleware)
+}
+
+func (group *RouterGroup) POST(path string, handler http.Handler, middleware ...Middleware) {
+	group.handle("POST", path, handler, middleware)
+}
+
+func (group *RouterGroup) PUT(path string, handler http.Handler, middleware ...Middleware) {
+	group.handle("PUT", path, handler, middleware)
+}
+
+func (group *RouterGroup) DELETE(path string, handler http.Handler, middleware ...Middleware) {
+	group.handle("DELETE", path, handler, middleware)
+}
+
+// handle registers the handler for the method and path.
+func (group *RouterGroup) handle(method, path string, handler http.Handler, middleware []Middleware) {
 	h := group.genHandler(handler, middleware)
 	path = cleanPath(path)
 
@@ -112,7 +129,7 @@ func (group *RouterGroup) GET(path string, handler http.Handler, middleware ...M
 	if mux == nil {
 		mux = group.root.mux
 	}
-	mux.Handle("GET "+cleanPath(group.basePath+"/"+path), h)
+	mux.Handle(method+" "+cleanPath(group.basePath+"/"+path), h)
 }
 
 func (group RouterGroup) genHandler(h http.Handler, middleware []Middleware) http.Handler {
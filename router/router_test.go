@@ -2,6 +2,7 @@ package router
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -146,3 +147,30 @@ func TestRouterGET(t *testing.T) {
 		root.GET("/test2", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), testMiddleware)
 	})
 }
+
+func TestRouterMethods(t *testing.T) {
+	require := require.New(t)
+	mux := http.NewServeMux()
+
+	root, err := NewRouterGroup(mux, "/v1")
+	require.NoError(err, "NewRouterGroup() returned an error: %s", err)
+
+	handler := func(method string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(method)) })
+	}
+
+	root.GET("/item/{id}", handler("GET"))
+	root.POST("/item/{id}", handler("POST"))
+	root.PUT("/item/{id}", handler("PUT"))
+	root.DELETE("/item/{id}", handler("DELETE"), testMiddleware)
+
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/v1/item/1", nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			require.Equal(http.StatusOK, w.Code, "status did not match")
+			require.Equal(method, w.Body.String(), "wrong handler was called")
+		})
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/chadeldridge/cuttle-server/core"
 	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
 )
 
 type HTTPServer struct {
@@ -17,7 +19,14 @@ type HTTPServer struct {
 	Config *core.Config
 	db.CuttleDB
 	db.AuthDB
-	Handler http.Handler
+	Scheduler *scheduler.Scheduler    // Runs scheduled Tiles. nil if scheduling is disabled.
+	Profiles  scheduler.ProfileSource // Looks up Profiles by name as stored. nil if none are loaded.
+	// Looks up Profiles with the Connectors bound in cuttle.db applied. Used to run Tiles. Profiles
+	// is used instead if nil.
+	BoundProfiles scheduler.ProfileSource
+	// Looks up stored AuthMethods by name for bundles. nil if no credentials file is set.
+	Credentials bundle.Credentials
+	Handler     http.Handler
 	// Mux saves the http.ServeMux instance. This provides easier access to the
 	// mux without having to enforce a ref type on HTTPServer.Handler everytime.
 	// We can now use HTTPServer.Mux.Handle() instead of HTTPServer.Handler.(*http.ServeMux).Handle().
@@ -0,0 +1,239 @@
+package approval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+)
+
+// Request statuses.
+const (
+	StatusPending  = "pending"  // Waiting for an approver.
+	StatusApproved = "approved" // Approved and ran.
+	StatusRejected = "rejected" // An approver said no.
+	StatusExpired  = "expired"  // No one decided before Expires.
+)
+
+// DefaultTTL is how long a Request waits for an approver if no TTL is given.
+const DefaultTTL = time.Hour
+
+var (
+	ErrInvalidRequest = fmt.Errorf("invalid approval request")
+	ErrNotPending     = fmt.Errorf("approval request is not pending")
+	ErrExpired        = fmt.Errorf("approval request expired")
+	ErrSelfApproval   = fmt.Errorf("requester cannot approve their own request")
+)
+
+// Request is a run of a Tile which is held until a second user approves it.
+type Request struct {
+	ID        int64      `json:"id"`
+	Profile   string     `json:"profile"`
+	Tile      string     `json:"tile"`
+	Group     string     `json:"group"`
+	Requester string     `json:"requester"`          // Username of who asked for the run.
+	Approver  string     `json:"approver,omitempty"` // Username of who approved or rejected it.
+	Status    string     `json:"status"`
+	Created   time.Time  `json:"created"`
+	Expires   time.Time  `json:"expires"`
+	Decided   *time.Time `json:"decided,omitempty"` // Nil until approved, rejected, or expired.
+}
+
+// NewRequest creates a pending Request which expires after ttl. A ttl of 0 or less uses DefaultTTL.
+func NewRequest(profile, tile, group, requester string, ttl time.Duration) Request {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	now := time.Now()
+	return Request{
+		Profile:   profile,
+		Tile:      tile,
+		Group:     group,
+		Requester: requester,
+		Status:    StatusPending,
+		Created:   now,
+		Expires:   now.Add(ttl),
+	}
+}
+
+// Validate checks that the Request has the fields every record needs.
+func (r Request) Validate() error {
+	if r.Profile == "" || r.Tile == "" || r.Group == "" {
+		return fmt.Errorf("approval.Request.Validate: %w: profile, tile, and group are required", ErrInvalidRequest)
+	}
+
+	if r.Requester == "" {
+		return fmt.Errorf("approval.Request.Validate: %w: requester is required", ErrInvalidRequest)
+	}
+
+	if r.Created.IsZero() || !r.Expires.After(r.Created) {
+		return fmt.Errorf("approval.Request.Validate: %w: expires must be after created", ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// Expired returns true if the Request is still pending at t but should no longer be.
+func (r Request) Expired(t time.Time) bool { return r.Status == StatusPending && !t.Before(r.Expires) }
+
+// Filter selects Requests. Empty fields match everything.
+type Filter struct {
+	Profile string
+	Status  string
+}
+
+// Match returns true if the Request matches the Filter.
+func (f Filter) Match(r Request) bool {
+	return (f.Profile == "" || r.Profile == f.Profile) && (f.Status == "" || r.Status == f.Status)
+}
+
+// Store keeps the approval Requests. db.SqliteDB is the Store used by the server.
+type Store interface {
+	ApprovalCreate(r Request) (Request, error)
+	ApprovalGet(id int64) (Request, error)
+	ApprovalList(filter Filter) ([]Request, error)
+	// ApprovalDecide sets the status and approver of a pending Request. Returns ErrExpired, and
+	// marks it expired, if it expired before at. Returns ErrNotPending if it was already decided.
+	ApprovalDecide(id int64, status, approver string, at time.Time) (Request, error)
+	ApprovalExpire(before time.Time) (int64, error)
+}
+
+// CheckDecision returns ErrInvalidRequest unless status is StatusApproved or StatusRejected and
+// approver is set. Stores call it in ApprovalDecide.
+func CheckDecision(status, approver string) error {
+	if status != StatusApproved && status != StatusRejected {
+		return fmt.Errorf("%w: unknown decision: %q", ErrInvalidRequest, status)
+	}
+
+	if approver == "" {
+		return fmt.Errorf("%w: approver is required", ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// Expire marks the pending Requests which expired every interval until ctx is done. logger may be
+// nil.
+func Expire(ctx context.Context, store Store, interval time.Duration, logger *core.Logger) {
+	if logger == nil {
+		logger = core.NewLogger(io.Discard, "approval: ", 0, false)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := store.ApprovalExpire(time.Now())
+		if err != nil {
+			logger.Printf("approval expire: %v\n", err)
+		} else if n > 0 {
+			logger.Debugf("approval expire: expired %d requests\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List is an in memory Store. Requests are lost when the process exits.
+type List struct {
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewList creates an empty in memory List.
+func NewList() *List { return &List{} }
+
+// ApprovalCreate validates and stores the Request. Returns the Request with its ID set.
+func (l *List) ApprovalCreate(r Request) (Request, error) {
+	if err := r.Validate(); err != nil {
+		return r, fmt.Errorf("approval.List.ApprovalCreate: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.ID = int64(len(l.requests) + 1)
+	l.requests = append(l.requests, r)
+	return r, nil
+}
+
+// ApprovalGet returns the Request. Returns sql.ErrNoRows if it does not exist so the List behaves
+// like the database.
+func (l *List) ApprovalGet(id int64) (Request, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id < 1 || id > int64(len(l.requests)) {
+		return Request{}, fmt.Errorf("approval.List.ApprovalGet: %w", sql.ErrNoRows)
+	}
+
+	return l.requests[id-1], nil
+}
+
+// ApprovalList returns the Requests which match filter, newest first.
+func (l *List) ApprovalList(filter Filter) ([]Request, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var requests []Request
+	for _, r := range l.requests {
+		if filter.Match(r) {
+			requests = append(requests, r)
+		}
+	}
+
+	slices.Reverse(requests)
+	return requests, nil
+}
+
+// ApprovalDecide approves or rejects a pending Request. See Store.
+func (l *List) ApprovalDecide(id int64, status, approver string, at time.Time) (Request, error) {
+	if err := CheckDecision(status, approver); err != nil {
+		return Request{}, fmt.Errorf("approval.List.ApprovalDecide: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id < 1 || id > int64(len(l.requests)) {
+		return Request{}, fmt.Errorf("approval.List.ApprovalDecide: %w", sql.ErrNoRows)
+	}
+
+	r := &l.requests[id-1]
+	if r.Expired(at) {
+		expires := r.Expires
+		r.Status, r.Decided = StatusExpired, &expires
+		return *r, fmt.Errorf("approval.List.ApprovalDecide: %w", ErrExpired)
+	}
+
+	if r.Status != StatusPending {
+		return *r, fmt.Errorf("approval.List.ApprovalDecide: %w: %s", ErrNotPending, r.Status)
+	}
+
+	r.Status, r.Approver, r.Decided = status, approver, &at
+	return *r, nil
+}
+
+// ApprovalExpire marks the pending Requests which expired before the time. Returns how many were
+// marked.
+func (l *List) ApprovalExpire(before time.Time) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var n int64
+	for i := range l.requests {
+		if l.requests[i].Expired(before) {
+			expires := l.requests[i].Expires
+			l.requests[i].Status, l.requests[i].Decided = StatusExpired, &expires
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package approval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApprovalNewRequest(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRequest("Web", "Restart", "Prod", "alice", 0)
+	require.Equal(StatusPending, r.Status, "Status did not match")
+	require.Equal(DefaultTTL, r.Expires.Sub(r.Created), "ttl did not default")
+	require.NoError(r.Validate(), "Validate() returned an error")
+
+	r = NewRequest("Web", "Restart", "Prod", "alice", time.Minute)
+	require.Equal(time.Minute, r.Expires.Sub(r.Created), "ttl did not match")
+	require.False(r.Expired(r.Created), "Expired() returned true when created")
+	require.True(r.Expired(r.Expires), "Expired() returned false at Expires")
+
+	r.Status = StatusApproved
+	require.False(r.Expired(r.Expires), "Expired() returned true for a decided Request")
+}
+
+func TestApprovalRequestJSON(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRequest("Web", "Restart", "Prod", "alice", 0)
+	data, err := json.Marshal(r)
+	require.NoError(err, "json.Marshal() returned an error: %s", err)
+	require.NotContains(string(data), `"decided"`, "pending Request included decided")
+
+	r.Decided = &r.Created
+	data, err = json.Marshal(r)
+	require.NoError(err, "json.Marshal() returned an error: %s", err)
+	require.Contains(string(data), `"decided"`, "decided Request did not include decided")
+}
+
+func TestApprovalRequestValidate(t *testing.T) {
+	require := require.New(t)
+	for name, r := range map[string]Request{
+		"tile":      NewRequest("Web", "", "Prod", "alice", 0),
+		"requester": NewRequest("Web", "Restart", "Prod", "", 0),
+		"expires":   {Profile: "Web", Tile: "Restart", Group: "Prod", Requester: "alice", Created: time.Now()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.ErrorIs(r.Validate(), ErrInvalidRequest, "Validate() did not return ErrInvalidRequest")
+		})
+	}
+}
+
+func TestApprovalList(t *testing.T) {
+	require := require.New(t)
+	l := NewList()
+
+	_, err := l.ApprovalCreate(Request{})
+	require.ErrorIs(err, ErrInvalidRequest, "ApprovalCreate() did not validate")
+
+	web, err := l.ApprovalCreate(NewRequest("Web", "Restart", "Prod", "alice", time.Hour))
+	require.NoError(err, "ApprovalCreate() returned an error: %s", err)
+	require.Equal(int64(1), web.ID, "ID was not set")
+	db, err := l.ApprovalCreate(NewRequest("DB", "Failover", "Prod", "alice", time.Hour))
+	require.NoError(err, "ApprovalCreate() returned an error: %s", err)
+
+	list, err := l.ApprovalList(Filter{})
+	require.NoError(err, "ApprovalList() returned an error: %s", err)
+	require.Equal([]Request{db, web}, list, "ApprovalList() was not newest first")
+	list, err = l.ApprovalList(Filter{Profile: "Web", Status: StatusPending})
+	require.NoError(err, "ApprovalList() returned an error: %s", err)
+	require.Equal([]Request{web}, list, "ApprovalList() did not filter")
+
+	t.Run("decide", func(t *testing.T) {
+		_, err := l.ApprovalDecide(web.ID, StatusPending, "bob", time.Now())
+		require.ErrorIs(err, ErrInvalidRequest, "ApprovalDecide() allowed a pending decision")
+		_, err = l.ApprovalDecide(web.ID, StatusApproved, "", time.Now())
+		require.ErrorIs(err, ErrInvalidRequest, "ApprovalDecide() allowed an empty approver")
+
+		got, err := l.ApprovalDecide(web.ID, StatusApproved, "bob", time.Now())
+		require.NoError(err, "ApprovalDecide() returned an error: %s", err)
+		require.Equal(StatusApproved, got.Status, "Status did not match")
+		require.Equal("bob", got.Approver, "Approver did not match")
+		require.NotNil(got.Decided, "Decided was not set")
+
+		_, err = l.ApprovalDecide(web.ID, StatusRejected, "carol", time.Now())
+		require.ErrorIs(err, ErrNotPending, "ApprovalDecide() decided twice")
+		_, err = l.ApprovalDecide(99, StatusApproved, "bob", time.Now())
+		require.ErrorIs(err, sql.ErrNoRows, "ApprovalDecide() did not return sql.ErrNoRows")
+	})
+
+	t.Run("decide expired", func(t *testing.T) {
+		got, err := l.ApprovalDecide(db.ID, StatusApproved, "bob", db.Expires)
+		require.ErrorIs(err, ErrExpired, "ApprovalDecide() did not return ErrExpired")
+		require.Equal(StatusExpired, got.Status, "Request was not marked expired")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := l.ApprovalGet(web.ID)
+		require.NoError(err, "ApprovalGet() returned an error: %s", err)
+		require.Equal("bob", got.Approver, "ApprovalGet() did not return the decision")
+		_, err = l.ApprovalGet(99)
+		require.ErrorIs(err, sql.ErrNoRows, "ApprovalGet() did not return sql.ErrNoRows")
+	})
+}
+
+func TestApprovalExpire(t *testing.T) {
+	require := require.New(t)
+	l := NewList()
+
+	old := NewRequest("Web", "Restart", "Prod", "alice", time.Hour)
+	old.Created, old.Expires = old.Created.Add(-2*time.Hour), old.Expires.Add(-2*time.Hour)
+	old, err := l.ApprovalCreate(old)
+	require.NoError(err, "ApprovalCreate() returned an error: %s", err)
+	current, err := l.ApprovalCreate(NewRequest("Web", "Restart", "Prod", "alice", time.Hour))
+	require.NoError(err, "ApprovalCreate() returned an error: %s", err)
+
+	// Expire runs once before it checks ctx.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Expire(ctx, l, time.Hour, nil)
+
+	got, err := l.ApprovalGet(old.ID)
+	require.NoError(err, "ApprovalGet() returned an error: %s", err)
+	require.Equal(StatusExpired, got.Status, "Expire() did not expire the old Request")
+	require.NotNil(got.Decided, "Decided was not set")
+	require.Equal(old.Expires, *got.Decided, "Decided was not set to Expires")
+	got, err = l.ApprovalGet(current.ID)
+	require.NoError(err, "ApprovalGet() returned an error: %s", err)
+	require.Equal(StatusPending, got.Status, "Expire() expired a current Request")
+
+	n, err := l.ApprovalExpire(time.Now())
+	require.NoError(err, "ApprovalExpire() returned an error: %s", err)
+	require.Zero(n, "ApprovalExpire() expired a Request twice")
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionRemediate = "remediate"
+	ActionRequest   = "request" // Asked for a run of a Tile which requires approval.
+	ActionApprove   = "approve"
+	ActionReject    = "reject"
+)
+
+// Outcomes of an audited action.
+const (
+	OutcomeSuccess = "success" // The action ran and did what it should.
+	OutcomeFailure = "failure" // The action ran but failed or did not fix the problem.
+	OutcomeDenied  = "denied"  // The user did not have permission to take the action.
+	OutcomeSkipped = "skipped" // The action was not needed.
+	OutcomeStarted = "started" // The action is running. Replaced by AuditFinish.
+)
+
+var (
+	ErrInvalidEntry = fmt.Errorf("invalid audit entry")
+	ErrNotStarted   = fmt.Errorf("audit entry does not exist or is already finished")
+)
+
+// Entry is a single record in the audit log.
+type Entry struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`    // Username of who took the action.
+	Action  string    `json:"action"`  // What was done. ActionRemediate, etc.
+	Profile string    `json:"profile"` // Profile the Tile belongs to. May be empty.
+	Tile    string    `json:"tile"`
+	Server  string    `json:"server"` // Hostname the action was taken on.
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail"` // Free text. Usually the error or test summary.
+}
+
+// Validate checks that the Entry has the fields every record needs.
+func (e Entry) Validate() error {
+	if e.User == "" {
+		return fmt.Errorf("audit.Entry.Validate: %w: user is empty", ErrInvalidEntry)
+	}
+
+	if e.Action == "" {
+		return fmt.Errorf("audit.Entry.Validate: %w: action is empty", ErrInvalidEntry)
+	}
+
+	if e.Outcome == "" {
+		return fmt.Errorf("audit.Entry.Validate: %w: outcome is empty", ErrInvalidEntry)
+	}
+
+	return nil
+}
+
+// Recorder stores audit log entries. db.SqliteDB is the Recorder used by the server. Entries are
+// never deleted and only started entries can be changed, once, by AuditFinish.
+type Recorder interface {
+	AuditRecord(entry Entry) error
+	AuditStart(entry Entry) (int64, error)
+	AuditFinish(id int64, outcome, detail string) error
+	AuditList(limit int) ([]Entry, error)
+}
+
+// ValidateFinish checks the outcome given to AuditFinish.
+func ValidateFinish(outcome string) error {
+	if outcome == "" || outcome == OutcomeStarted {
+		return fmt.Errorf("audit.ValidateFinish: %w: outcome must be a final outcome", ErrInvalidEntry)
+	}
+
+	return nil
+}
+
+// Log is an in memory Recorder. Entries are lost when the process exits.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewLog creates an empty in memory audit Log.
+func NewLog() *Log { return &Log{} }
+
+// AuditRecord validates and stores the entry. Time is set to now if it is zero.
+func (l *Log) AuditRecord(entry Entry) error {
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("audit.Log.AuditRecord: %w", err)
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.ID = int64(len(l.entries) + 1)
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// AuditStart stores the entry with OutcomeStarted and returns its ID for AuditFinish.
+func (l *Log) AuditStart(entry Entry) (int64, error) {
+	entry.Outcome = OutcomeStarted
+	if err := entry.Validate(); err != nil {
+		return 0, fmt.Errorf("audit.Log.AuditStart: %w", err)
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.ID = int64(len(l.entries) + 1)
+	l.entries = append(l.entries, entry)
+	return entry.ID, nil
+}
+
+// AuditFinish sets the outcome and detail of a started entry. Returns ErrNotStarted if the entry
+// does not exist or was already finished.
+func (l *Log) AuditFinish(id int64, outcome, detail string) error {
+	if err := ValidateFinish(outcome); err != nil {
+		return fmt.Errorf("audit.Log.AuditFinish: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id < 1 || id > int64(len(l.entries)) || l.entries[id-1].Outcome != OutcomeStarted {
+		return fmt.Errorf("audit.Log.AuditFinish: %w: %d", ErrNotStarted, id)
+	}
+
+	l.entries[id-1].Outcome = outcome
+	l.entries[id-1].Detail = detail
+	return nil
+}
+
+// AuditList returns up to limit entries, newest first. A limit of 0 or less returns every entry.
+func (l *Log) AuditList(limit int) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := slices.Clone(l.entries)
+	slices.Reverse(entries)
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEntryValidate(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError(Entry{User: "admin", Action: ActionRemediate, Outcome: OutcomeSuccess}.Validate())
+	require.ErrorIs(Entry{Action: ActionRemediate, Outcome: OutcomeSuccess}.Validate(), ErrInvalidEntry, "user was not checked")
+	require.ErrorIs(Entry{User: "admin", Outcome: OutcomeSuccess}.Validate(), ErrInvalidEntry, "action was not checked")
+	require.ErrorIs(Entry{User: "admin", Action: ActionRemediate}.Validate(), ErrInvalidEntry, "outcome was not checked")
+}
+
+func TestAuditLog(t *testing.T) {
+	require := require.New(t)
+	log := NewLog()
+
+	for _, outcome := range []string{OutcomeDenied, OutcomeSuccess, OutcomeFailure} {
+		err := log.AuditRecord(Entry{User: "admin", Action: ActionRemediate, Tile: "Nginx", Outcome: outcome})
+		require.NoError(err, "Log.AuditRecord() returned an error: %s", err)
+	}
+
+	require.Error(log.AuditRecord(Entry{}), "Log.AuditRecord() did not validate the entry")
+
+	entries, err := log.AuditList(0)
+	require.NoError(err, "Log.AuditList() returned an error: %s", err)
+	require.Len(entries, 3, "Log.AuditList() did not return every entry")
+	require.Equal(OutcomeFailure, entries[0].Outcome, "entries were not newest first")
+	require.Equal(int64(3), entries[0].ID, "ID was not set")
+	require.False(entries[0].Time.IsZero(), "Time was not set")
+
+	entries, err = log.AuditList(2)
+	require.NoError(err, "Log.AuditList() returned an error: %s", err)
+	require.Len(entries, 2, "Log.AuditList() did not honor the limit")
+}
+
+func TestAuditLogStartFinish(t *testing.T) {
+	require := require.New(t)
+	log := NewLog()
+
+	id, err := log.AuditStart(Entry{User: "admin", Action: ActionRemediate, Tile: "Nginx"})
+	require.NoError(err, "Log.AuditStart() returned an error: %s", err)
+	entries, err := log.AuditList(0)
+	require.NoError(err, "Log.AuditList() returned an error: %s", err)
+	require.Equal(OutcomeStarted, entries[0].Outcome, "entry was not started")
+
+	require.ErrorIs(log.AuditFinish(id, OutcomeStarted, ""), ErrInvalidEntry, "Log.AuditFinish() accepted started")
+	require.NoError(log.AuditFinish(id, OutcomeSuccess, "done"), "Log.AuditFinish() returned an error")
+	entries, err = log.AuditList(0)
+	require.NoError(err, "Log.AuditList() returned an error: %s", err)
+	require.Len(entries, 1, "Log.AuditFinish() added an entry")
+	require.Equal(OutcomeSuccess, entries[0].Outcome, "outcome was not updated")
+	require.Equal("done", entries[0].Detail, "detail was not updated")
+
+	require.ErrorIs(log.AuditFinish(id, OutcomeFailure, ""), ErrNotStarted, "Log.AuditFinish() changed a finished entry")
+	require.ErrorIs(log.AuditFinish(42, OutcomeFailure, ""), ErrNotStarted, "Log.AuditFinish() found a missing entry")
+}
@@ -10,19 +10,26 @@ type Permissions struct {
 }
 
 var (
-	validMethods = []string{"POST", "GET", "PUT", "DELETE"}
+	validMethods = []string{"POST", "GET", "PUT", "DELETE", "EXECUTE", "APPROVE"}
 	defaultPerms = map[string]bool{
-		"POST":   false, // Create
-		"GET":    false, // Read
-		"PUT":    false, // Update
-		"DELETE": false, // Delete
+		"POST":    false, // Create
+		"GET":     false, // Read
+		"PUT":     false, // Update
+		"DELETE":  false, // Delete
+		"EXECUTE": false, // Run remediation actions. Separate so editing tiles does not allow changing servers.
+		"APPROVE": false, // Approve another user's run of a Tile which requires approval.
 	}
 )
 
 var ErrInvalidMethod = fmt.Errorf("invalid method")
 
 func NewPermissions() Permissions {
-	return Permissions{perms: defaultPerms}
+	perms := make(map[string]bool, len(defaultPerms))
+	for k, v := range defaultPerms {
+		perms[k] = v
+	}
+
+	return Permissions{perms: perms}
 }
 
 func ValidMethods() []string {
@@ -64,20 +71,26 @@ func (p Permissions) Get(method string) (bool, error) {
 	return p.perms[method], nil
 }
 
-func (p Permissions) AllowPost()   { p.perms["POST"] = true }
-func (p Permissions) AllowGet()    { p.perms["GET"] = true }
-func (p Permissions) AllowPut()    { p.perms["PUT"] = true }
-func (p Permissions) AllowDelete() { p.perms["DELETE"] = true }
-
-func (p Permissions) CanCreate() bool { return p.perms["POST"] }
-func (p Permissions) CanRead() bool   { return p.perms["GET"] }
-func (p Permissions) CanUpdate() bool { return p.perms["PUT"] }
-func (p Permissions) CanDelete() bool { return p.perms["DELETE"] }
-
-func (p Permissions) DenyPost()   { p.perms["POST"] = false }
-func (p Permissions) DenyGet()    { p.perms["GET"] = false }
-func (p Permissions) DenyPut()    { p.perms["PUT"] = false }
-func (p Permissions) DenyDelete() { p.perms["DELETE"] = false }
+func (p Permissions) AllowPost()    { p.perms["POST"] = true }
+func (p Permissions) AllowGet()     { p.perms["GET"] = true }
+func (p Permissions) AllowPut()     { p.perms["PUT"] = true }
+func (p Permissions) AllowDelete()  { p.perms["DELETE"] = true }
+func (p Permissions) AllowExecute() { p.perms["EXECUTE"] = true }
+func (p Permissions) AllowApprove() { p.perms["APPROVE"] = true }
+
+func (p Permissions) CanCreate() bool  { return p.perms["POST"] }
+func (p Permissions) CanRead() bool    { return p.perms["GET"] }
+func (p Permissions) CanUpdate() bool  { return p.perms["PUT"] }
+func (p Permissions) CanDelete() bool  { return p.perms["DELETE"] }
+func (p Permissions) CanExecute() bool { return p.perms["EXECUTE"] }
+func (p Permissions) CanApprove() bool { return p.perms["APPROVE"] }
+
+func (p Permissions) DenyPost()    { p.perms["POST"] = false }
+func (p Permissions) DenyGet()     { p.perms["GET"] = false }
+func (p Permissions) DenyPut()     { p.perms["PUT"] = false }
+func (p Permissions) DenyDelete()  { p.perms["DELETE"] = false }
+func (p Permissions) DenyExecute() { p.perms["EXECUTE"] = false }
+func (p Permissions) DenyApprove() { p.perms["APPROVE"] = false }
 
 func (p Permissions) AllowAll() {
 	for k := range p.perms {
@@ -0,0 +1,166 @@
+// Package binding applies the Connectors bound to Groups in the cuttle database to Profiles so each
+// (Tile, server) pair runs with the right credentials.
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+)
+
+// BindingDB is the part of db.CuttleDB which stores Connectors and their bindings.
+type BindingDB interface {
+	ConnectorGetByName(name string) (db.ConnectorData, error)
+	BindingList(profile string) ([]db.BindingData, error)
+}
+
+// ConnectorFromData returns the Bundle form of the stored Connector.
+func ConnectorFromData(data db.ConnectorData) bundle.Connector {
+	return bundle.Connector{Name: data.Name, Protocol: data.Protocol, User: data.User, Auth: data.Auth}
+}
+
+// Apply binds the stored Connectors to the Groups of the Profile. Groups are copied so Profiles
+// shared with other callers are not changed. Credentials are looked up in creds. Every binding
+// which could not be applied is returned. The Connectors are built on every call so use a Source
+// to look Profiles up repeatedly.
+func Apply(p *profiles.Profile, bdb BindingDB, creds bundle.Credentials) error {
+	build := func(name string) (connections.Connector, error) {
+		data, err := bdb.ConnectorGetByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return bundle.NewConnector(ConnectorFromData(data), creds)
+	}
+
+	if err := apply(p, bdb, build); err != nil {
+		return fmt.Errorf("binding.Apply: %w", err)
+	}
+
+	return nil
+}
+
+// apply binds the Connectors returned by build to the Groups of the Profile. build is called once
+// per Connector name.
+func apply(p *profiles.Profile, bdb BindingDB, build func(name string) (connections.Connector, error)) error {
+	bindings, err := bdb.BindingList(p.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	var errs []error
+	p.Groups = maps.Clone(p.Groups)
+	connectors := make(map[string]connections.Connector)
+	for _, b := range bindings {
+		g, ok := p.Groups[b.Group]
+		if !ok {
+			errs = append(errs, fmt.Errorf("binding %d: %w: %s", b.ID, profiles.ErrGroupNotFound, b.Group))
+			continue
+		}
+
+		conn, ok := connectors[b.Connector]
+		if !ok {
+			if conn, err = build(b.Connector); err != nil {
+				errs = append(errs, fmt.Errorf("binding %d: connector %s: %w", b.ID, b.Connector, err))
+				continue
+			}
+
+			connectors[b.Connector] = conn
+		}
+
+		g.TileConnectors = maps.Clone(g.TileConnectors)
+		g.BindConnector(b.Tile, conn)
+		p.Groups[b.Group] = g
+	}
+
+	return errors.Join(errs...)
+}
+
+// Source is a scheduler.ProfileSource which applies the stored bindings to each Profile it looks
+// up. A Profile is not returned if any of its bindings cannot be applied so Tiles never run with
+// the wrong credentials. Connectors are built once and reused until the stored Connector changes
+// or is deleted, so lookups do not open a new ssh-agent connection each time.
+type Source struct {
+	source     scheduler.ProfileSource
+	db         BindingDB
+	creds      bundle.Credentials
+	mu         sync.Mutex
+	connectors map[string]builtConnector // Connectors built by Source.connector, by name.
+}
+
+// builtConnector is a Connector and the stored data it was built from.
+type builtConnector struct {
+	data db.ConnectorData
+	conn connections.Connector
+}
+
+// NewSource creates a Source which looks Profiles up in source. creds may be nil if no stored
+// Connector has auth.
+func NewSource(source scheduler.ProfileSource, bdb BindingDB, creds bundle.Credentials) *Source {
+	return &Source{source: source, db: bdb, creds: creds, connectors: make(map[string]builtConnector)}
+}
+
+func (s *Source) GetProfile(name string) (profiles.Profile, error) {
+	p, err := s.source.GetProfile(name)
+	if err != nil {
+		return p, err
+	}
+
+	if err := apply(&p, s.db, s.connector); err != nil {
+		return p, fmt.Errorf("binding.Source.GetProfile: %w", err)
+	}
+
+	return p, nil
+}
+
+// connector returns the Connector built from the stored Connector with the name. The Connector is
+// rebuilt if the stored one changed and dropped if it was deleted. Groups run with clones of it so
+// the Connector it replaces is closed to release its ssh-agent connections.
+func (s *Source) connector(name string) (connections.Connector, error) {
+	data, err := s.db.ConnectorGetByName(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	built, ok := s.connectors[name]
+	if err != nil {
+		if ok {
+			delete(s.connectors, name)
+			_ = built.conn.Close(true)
+		}
+
+		return nil, err
+	}
+
+	if ok && sameConnector(built.data, data) {
+		return built.conn, nil
+	}
+
+	conn, err := bundle.NewConnector(ConnectorFromData(data), s.creds)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		_ = built.conn.Close(true)
+	}
+
+	s.connectors[name] = builtConnector{data: data, conn: conn}
+	return conn, nil
+}
+
+// sameConnector returns true if a and b build the same Connector.
+func sameConnector(a, b db.ConnectorData) bool {
+	return a.ID == b.ID && a.Protocol == b.Protocol && a.User == b.User && slices.Equal(a.Auth, b.Auth)
+}
@@ -0,0 +1,155 @@
+package binding
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/bundle"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/scheduler"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB is a BindingDB kept in memory.
+type testDB struct {
+	connectors map[string]db.ConnectorData
+	bindings   []db.BindingData
+}
+
+func (t testDB) ConnectorGetByName(name string) (db.ConnectorData, error) {
+	data, ok := t.connectors[name]
+	if !ok {
+		return data, sql.ErrNoRows
+	}
+
+	return data, nil
+}
+
+func (t testDB) BindingList(profile string) ([]db.BindingData, error) {
+	var list []db.BindingData
+	for _, b := range t.bindings {
+		if b.Profile == profile {
+			list = append(list, b)
+		}
+	}
+
+	return list, nil
+}
+
+func testProfile(t *testing.T) profiles.Profile {
+	t.Helper()
+	s, err := connections.NewServer("web01", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(t, err, "NewServer() returned an error: %s", err)
+	conn, err := connections.NewMockConnector("own", "own")
+	require.NoError(t, err, "NewMockConnector() returned an error: %s", err)
+	require.NoError(t, s.SetConnector(&conn))
+
+	p, err := profiles.NewProfile("Web", profiles.NewGroup("web", s))
+	require.NoError(t, err, "NewProfile() returned an error: %s", err)
+	return p
+}
+
+func connectorUser(t *testing.T, p profiles.Profile, group, tile string) string {
+	t.Helper()
+	g, err := p.ResolveGroupFor(group, tile)
+	require.NoError(t, err, "ResolveGroupFor() returned an error: %s", err)
+	return g.Servers[0].Connector.GetUser()
+}
+
+func TestBindingApply(t *testing.T) {
+	require := require.New(t)
+	bdb := testDB{
+		connectors: map[string]db.ConnectorData{
+			"deploy": {Name: "deploy", Protocol: "mock", User: "deploy"},
+			"backup": {Name: "backup", Protocol: "mock", User: "backup"},
+			"keyed":  {Name: "keyed", Protocol: "ssh", User: "keyed", Auth: []string{"key"}},
+		},
+		bindings: []db.BindingData{
+			{ID: 1, Profile: "Web", Group: "web", Connector: "deploy"},
+			{ID: 2, Profile: "Web", Group: "web", Tile: "Backup", Connector: "backup"},
+			{ID: 3, Profile: "Other", Group: "web", Connector: "keyed"},
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		stored := testProfile(t)
+		p := stored
+		require.NoError(Apply(&p, bdb, nil), "Apply() returned an error")
+		require.Equal("deploy", connectorUser(t, p, "web", "Nginx"), "Group default was not bound")
+		require.Equal("backup", connectorUser(t, p, "web", "Backup"), "Tile binding was not bound")
+		require.Equal("own", connectorUser(t, stored, "web", "Backup"), "Apply() changed the stored Profile")
+	})
+
+	t.Run("connector per server", func(t *testing.T) {
+		p := testProfile(t)
+		s, err := connections.NewServer("web02", 0, &bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "NewServer() returned an error: %s", err)
+		g := p.Groups["web"]
+		g.AddServers(s)
+		p.Groups["web"] = g
+
+		require.NoError(Apply(&p, bdb, nil), "Apply() returned an error")
+		resolved, err := p.ResolveGroupFor("web", "Nginx")
+		require.NoError(err, "ResolveGroupFor() returned an error: %s", err)
+		require.Len(resolved.Servers, 2, "servers did not match")
+		require.NotSame(resolved.Servers[0].Connector, resolved.Servers[1].Connector, "servers shared a Connector")
+		require.NotEqual(resolved.Servers[0].PoolKey(), resolved.Servers[1].PoolKey(), "servers shared a pool key")
+	})
+
+	t.Run("missing credential", func(t *testing.T) {
+		p := testProfile(t)
+		p.Name = "Other"
+		require.ErrorIs(Apply(&p, bdb, nil), bundle.ErrMissingCredential, "Apply() did not return ErrMissingCredential")
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		p := testProfile(t)
+		delete(p.Groups, "web")
+		require.ErrorIs(Apply(&p, bdb, nil), profiles.ErrGroupNotFound, "Apply() did not return ErrGroupNotFound")
+	})
+
+	t.Run("missing connector", func(t *testing.T) {
+		p := testProfile(t)
+		bad := testDB{bindings: []db.BindingData{{ID: 1, Profile: "Web", Group: "web", Connector: "gone"}}}
+		require.ErrorIs(Apply(&p, bad, nil), sql.ErrNoRows, "Apply() did not return sql.ErrNoRows")
+	})
+}
+
+func TestBindingSource(t *testing.T) {
+	require := require.New(t)
+	bdb := testDB{
+		connectors: map[string]db.ConnectorData{"deploy": {Name: "deploy", Protocol: "mock", User: "deploy"}},
+		bindings:   []db.BindingData{{ID: 1, Profile: "Web", Group: "web", Connector: "deploy"}},
+	}
+
+	stored := testProfile(t)
+	src := NewSource(scheduler.NewMemoryProfiles(stored), bdb, nil)
+	p, err := src.GetProfile("Web")
+	require.NoError(err, "GetProfile() returned an error: %s", err)
+	require.Equal("deploy", connectorUser(t, p, "web", "Nginx"), "binding was not applied")
+	require.Equal("own", connectorUser(t, stored, "web", "Nginx"), "GetProfile() changed the stored Profile")
+
+	_, err = src.GetProfile("Missing")
+	require.ErrorIs(err, scheduler.ErrNoProfile, "GetProfile() did not return ErrNoProfile")
+
+	t.Run("connector cache", func(t *testing.T) {
+		first := p.Groups["web"].ConnectorFor("Nginx")
+		again, err := src.GetProfile("Web")
+		require.NoError(err, "GetProfile() returned an error: %s", err)
+		require.Same(first, again.Groups["web"].ConnectorFor("Nginx"), "Connector was built again")
+
+		bdb.connectors["deploy"] = db.ConnectorData{Name: "deploy", Protocol: "mock", User: "release"}
+		changed, err := src.GetProfile("Web")
+		require.NoError(err, "GetProfile() returned an error: %s", err)
+		require.NotSame(first, changed.Groups["web"].ConnectorFor("Nginx"), "changed Connector was not rebuilt")
+		require.Equal("release", connectorUser(t, changed, "web", "Nginx"), "changed Connector was not applied")
+
+		delete(bdb.connectors, "deploy")
+		_, err = src.GetProfile("Web")
+		require.ErrorIs(err, sql.ErrNoRows, "GetProfile() did not return sql.ErrNoRows")
+		require.NotContains(src.connectors, "deploy", "deleted Connector was kept")
+	})
+}
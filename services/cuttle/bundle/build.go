@@ -0,0 +1,466 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+)
+
+// Credentials looks up stored AuthMethods by name so Bundles never hold secrets.
+type Credentials interface {
+	GetAuthMethod(name string) (auth connections.AuthMethod, passphrase []byte, err error)
+}
+
+// Validate checks everything in the Bundle except that its credentials exist. Every problem found
+// is returned.
+func (b Bundle) Validate() error {
+	if _, err := b.build(nil, false, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		return fmt.Errorf("bundle.Bundle.Validate: %w", err)
+	}
+
+	return nil
+}
+
+// Normalize validates the Bundle and returns it as Export would write it, with defaults filled in,
+// so it can be diffed against an exported Profile. Servers without an ID are not given one.
+func (b Bundle) Normalize() (Bundle, error) {
+	p, err := b.build(nil, false, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		return b, fmt.Errorf("bundle.Bundle.Normalize: %w", err)
+	}
+
+	n, err := Export(p)
+	if err != nil {
+		return b, fmt.Errorf("bundle.Bundle.Normalize: %w", err)
+	}
+
+	ids := make(map[string]string, len(b.Servers))
+	for _, s := range b.Servers {
+		ids[s.Name] = s.ID
+	}
+
+	for i, s := range n.Servers {
+		n.Servers[i].ID = ids[s.Name]
+	}
+
+	return n, nil
+}
+
+// KeepIDs returns the Bundle with the servers which have no ID given the ID of the server with the
+// same name in from. Use it before importing so existing servers keep their history.
+func (b Bundle) KeepIDs(from Bundle) Bundle {
+	ids := make(map[string]string, len(from.Servers))
+	for _, s := range from.Servers {
+		ids[s.Name] = s.ID
+	}
+
+	b.Servers = slices.Clone(b.Servers)
+	for i, s := range b.Servers {
+		if s.ID == "" {
+			b.Servers[i].ID = ids[s.Name]
+		}
+	}
+
+	return b
+}
+
+// Profile builds the Profile. Credentials are looked up in creds, which may be nil if no Connector
+// has auth. Servers write to the results and logs buffers.
+func (b Bundle) Profile(creds Credentials, results, logs *bytes.Buffer) (profiles.Profile, error) {
+	p, err := b.build(creds, true, results, logs)
+	if err != nil {
+		return p, fmt.Errorf("bundle.Bundle.Profile: %w", err)
+	}
+
+	return p, nil
+}
+
+// ProfileRefs builds the Profile without looking up credentials. Connectors and run_as passwords
+// only keep the names they reference so the Profile can be changed and exported again but not ran.
+func (b Bundle) ProfileRefs(results, logs *bytes.Buffer) (profiles.Profile, error) {
+	p, err := b.build(nil, false, results, logs)
+	if err != nil {
+		return p, fmt.Errorf("bundle.Bundle.ProfileRefs: %w", err)
+	}
+
+	return p, nil
+}
+
+// build creates the Profile and returns every problem joined. Credentials are only looked up if
+// withCreds is true.
+func (b Bundle) build(creds Credentials, withCreds bool, results, logs *bytes.Buffer) (profiles.Profile, error) {
+	var errs []error
+	fail := func(kind, name string, err error) {
+		errs = append(errs, fmt.Errorf("%w: %s %s: %w", ErrInvalidBundle, kind, name, err))
+	}
+
+	if b.Version != Version {
+		errs = append(errs, fmt.Errorf("%w: unsupported version: %d", ErrInvalidBundle, b.Version))
+	}
+
+	p, err := profiles.NewProfile(b.Name)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidBundle, err))
+	}
+
+	connectors := make(map[string]connections.Connector)
+	for _, c := range b.Connectors {
+		if _, ok := connectors[c.Name]; ok {
+			fail("connector", c.Name, errors.New("duplicate name"))
+			continue
+		}
+
+		conn, err := buildConnector(c, creds, withCreds)
+		if err != nil {
+			fail("connector", c.Name, err)
+			continue
+		}
+
+		connectors[c.Name] = conn
+	}
+
+	servers := make(map[string]connections.Server)
+	for _, s := range b.Servers {
+		if _, ok := servers[s.Name]; ok {
+			fail("server", s.Name, errors.New("duplicate name"))
+			continue
+		}
+
+		server, err := buildServer(s, connectors, results, logs)
+		if err != nil {
+			fail("server", s.Name, err)
+			continue
+		}
+
+		servers[s.Name] = server
+		p.Servers = append(p.Servers, server)
+	}
+
+	// Jump servers are set once every server is built since they are servers in the Bundle.
+	for _, c := range b.Connectors {
+		if c.Jump == "" || connectors[c.Name] == nil {
+			continue
+		}
+
+		jump, ok := servers[c.Jump]
+		if !ok {
+			fail("connector", c.Name, fmt.Errorf("jump server not found: %s", c.Jump))
+			continue
+		}
+
+		ssh, ok := connectors[c.Name].(*connections.SSHConnector)
+		if !ok {
+			fail("connector", c.Name, connections.ErrJumpNotSSH)
+			continue
+		}
+
+		if err := ssh.SetJump(&jump); err != nil {
+			fail("connector", c.Name, err)
+		}
+	}
+
+	// Each server gets its own copy of the Connector now that jumps are set.
+	for i, s := range p.Servers {
+		if s.Connector != nil {
+			p.Servers[i].Connector = s.Connector.Clone()
+			servers[s.Name] = p.Servers[i]
+		}
+	}
+
+	for _, g := range b.Groups {
+		if _, ok := p.Groups[g.Name]; ok {
+			fail("group", g.Name, errors.New("duplicate name"))
+			continue
+		}
+
+		group, err := buildGroup(g, servers, connectors)
+		if err != nil {
+			fail("group", g.Name, err)
+			continue
+		}
+
+		p.Groups[g.Name] = group
+	}
+
+	if err := p.ValidateGroups(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidBundle, err))
+	}
+
+	for _, t := range b.Tiles {
+		if _, ok := p.Tiles[t.Name]; ok {
+			fail("tile", t.Name, errors.New("duplicate name"))
+			continue
+		}
+
+		tile, err := buildTile(t, creds, withCreds)
+		if err != nil {
+			fail("tile", t.Name, err)
+			continue
+		}
+
+		p.Tiles[t.Name] = tile
+	}
+
+	return p, errors.Join(errs...)
+}
+
+func buildConnector(c Connector, creds Credentials, withCreds bool) (connections.Connector, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("name - %w", core.ErrParamEmpty)
+	}
+
+	switch connections.StringToProtocol(c.Protocol) {
+	case connections.SSH:
+		conn, err := connections.NewSSHConnector(c.Name, c.User)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range c.Auth {
+			if !withCreds {
+				conn.AuthRefs = append(conn.AuthRefs, ref)
+				continue
+			}
+
+			if creds == nil {
+				return nil, fmt.Errorf("%w: %s", ErrMissingCredential, ref)
+			}
+
+			a, passphrase, err := creds.GetAuthMethod(ref)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrMissingCredential, ref, err)
+			}
+
+			if err := conn.AddAuthMethod(a, passphrase); err != nil {
+				return nil, err
+			}
+		}
+
+		return &conn, nil
+	case connections.MOCK:
+		if len(c.Auth) > 0 || c.Jump != "" {
+			return nil, errors.New("mock connectors do not support auth or jump")
+		}
+
+		conn, err := connections.NewMockConnector(c.Name, c.User)
+		if err != nil {
+			return nil, err
+		}
+
+		return &conn, nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %q", c.Protocol)
+	}
+}
+
+func buildServer(s Server, connectors map[string]connections.Connector, results, logs *bytes.Buffer) (connections.Server, error) {
+	if s.Name == "" {
+		return connections.Server{}, fmt.Errorf("name - %w", core.ErrParamEmpty)
+	}
+
+	server, err := connections.NewServer(s.Hostname, s.Port, results, logs)
+	if err != nil {
+		return server, err
+	}
+
+	if err := server.SetName(s.Name); err != nil {
+		return server, err
+	}
+
+	if s.ID != "" {
+		if err := server.SetID(s.ID); err != nil {
+			return server, err
+		}
+	}
+
+	if s.IP != "" {
+		if err := server.SetIP(s.IP); err != nil {
+			return server, err
+		}
+	}
+
+	if err := server.SetLabels(s.Labels); err != nil {
+		return server, err
+	}
+
+	if s.Connector != "" {
+		conn, ok := connectors[s.Connector]
+		if !ok {
+			return server, fmt.Errorf("connector not found: %s", s.Connector)
+		}
+
+		if err := server.SetConnector(conn); err != nil {
+			return server, err
+		}
+	}
+
+	return server, nil
+}
+
+func buildGroup(g Group, servers map[string]connections.Server, connectors map[string]connections.Connector) (profiles.Group, error) {
+	if g.Name == "" {
+		return profiles.Group{}, fmt.Errorf("name - %w", core.ErrParamEmpty)
+	}
+
+	group := profiles.NewGroup(g.Name)
+	if g.Selector != "" {
+		var err error
+		if group, err = profiles.NewSelectorGroup(g.Name, g.Selector); err != nil {
+			return group, err
+		}
+	}
+
+	group.IncludeGroups(g.Include...)
+	group.IntersectGroups(g.Intersect...)
+	group.ExcludeGroups(g.Exclude...)
+	for _, name := range g.Servers {
+		s, ok := servers[name]
+		if !ok {
+			return group, fmt.Errorf("server not found: %s", name)
+		}
+
+		group.AddServers(s)
+	}
+
+	if g.Connector != "" {
+		conn, ok := connectors[g.Connector]
+		if !ok {
+			return group, fmt.Errorf("connector not found: %s", g.Connector)
+		}
+
+		group.BindConnector("", conn)
+	}
+
+	for _, tile := range sortedKeys(g.TileConnectors) {
+		if tile == "" {
+			return group, errors.New("tile_connectors: tile name was empty")
+		}
+
+		conn, ok := connectors[g.TileConnectors[tile]]
+		if !ok {
+			return group, fmt.Errorf("connector not found: %s", g.TileConnectors[tile])
+		}
+
+		group.BindConnector(tile, conn)
+	}
+
+	return group, nil
+}
+
+func buildTile(t Tile, creds Credentials, withCreds bool) (profiles.Tile, error) {
+	tile := profiles.NewTile(t.Name)
+	if err := tile.SetName(t.Name); err != nil {
+		return tile, err
+	}
+
+	if t.DisplaySize < 0 || t.MaxParallel < 0 {
+		return tile, errors.New("display_size and max_parallel cannot be negative")
+	}
+
+	if t.DisplaySize > 0 {
+		tile.DisplaySize = t.DisplaySize
+	}
+
+	tile.AllMustPass = t.AllMustPass
+	tile.InParallel = t.InParallel
+	tile.MaxParallel = t.MaxParallel
+	tile.RequireApproval = t.RequireApproval
+	for _, cfg := range t.Tests {
+		test, err := tests.Build(cfg)
+		if err != nil {
+			return tile, err
+		}
+
+		if err := loadRunAsPassword(test, creds, withCreds); err != nil {
+			return tile, fmt.Errorf("test %s: %w", test.Name, err)
+		}
+
+		tile.AddTests(test)
+	}
+
+	if err := tile.ValidateFlow(); err != nil {
+		return tile, err
+	}
+
+	if t.Remediation == nil {
+		return tile, nil
+	}
+
+	delay, err := parseDelay(t.Remediation.RecheckDelay)
+	if err != nil {
+		return tile, fmt.Errorf("remediation: %w", err)
+	}
+
+	r := profiles.NewRemediation(t.Remediation.Name)
+	r.RecheckDelay = delay
+	if t.Remediation.RequireConfirm != nil {
+		r.RequireConfirm = *t.Remediation.RequireConfirm
+	}
+
+	for _, cfg := range t.Remediation.Actions {
+		action, err := tests.Build(cfg)
+		if err != nil {
+			return tile, fmt.Errorf("remediation: %w", err)
+		}
+
+		if err := loadRunAsPassword(action, creds, withCreds); err != nil {
+			return tile, fmt.Errorf("remediation: %s: %w", action.Name, err)
+		}
+
+		r.Actions = append(r.Actions, action)
+	}
+
+	return tile, tile.SetRemediation(r)
+}
+
+// loadRunAsPassword looks up the run_as password of an ssh test in creds. Bundles only hold the
+// name of the password. Nothing is looked up unless withCreds is true.
+func loadRunAsPassword(test tests.Test, creds Credentials, withCreds bool) error {
+	ssh, ok := test.Tester.(*tests.SSHTest)
+	if !ok || ssh.RunAs == nil || !ssh.RunAs.PasswordMissing() || !withCreds {
+		return nil
+	}
+
+	ref := ssh.RunAs.Password.Name
+	if creds == nil {
+		return fmt.Errorf("%w: %s", ErrMissingCredential, ref)
+	}
+
+	a, _, err := creds.GetAuthMethod(ref)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrMissingCredential, ref, err)
+	}
+
+	return ssh.SetRunAsPassword(a)
+}
+
+// Validate checks the Connector without looking up its credentials. Jump is not checked since it
+// names a server in a Bundle.
+func (c Connector) Validate() error {
+	if _, err := buildConnector(Connector{Name: c.Name, Protocol: c.Protocol, User: c.User, Auth: c.Auth}, nil, false); err != nil {
+		return fmt.Errorf("bundle.Connector.Validate: %w: %w", ErrInvalidBundle, err)
+	}
+
+	return nil
+}
+
+// NewConnector builds the Connector outside of a Bundle, looking up its credentials in creds. Jump
+// is not supported since there are no Bundle servers to name.
+func NewConnector(c Connector, creds Credentials) (connections.Connector, error) {
+	if c.Jump != "" {
+		return nil, fmt.Errorf("bundle.NewConnector: %w: jump is only supported in a bundle", ErrInvalidBundle)
+	}
+
+	conn, err := buildConnector(c, creds, true)
+	if err != nil {
+		return nil, fmt.Errorf("bundle.NewConnector: %w", err)
+	}
+
+	return conn, nil
+}
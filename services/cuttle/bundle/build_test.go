@@ -0,0 +1,192 @@
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleProfile(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		p := testProfile(t)
+		require.Equal("Web", p.Name, "Name did not match")
+		require.Len(p.Servers, 3, "Servers did not match")
+
+		web01 := p.Servers[1]
+		require.Equal("10.0.0.1", web01.GetIP(), "IP did not match")
+		require.True(web01.UseIP, "UseIP was false")
+		conn, ok := web01.Connector.(*connections.SSHConnector)
+		require.True(ok, "Connector was not an SSHConnector")
+		require.Equal([]string{"deploy-key"}, conn.AuthRefs, "AuthRefs did not match")
+		require.Len(conn.Auth, 1, "Auth did not match")
+		require.Equal([]string{"192.168.1.1"}, conn.JumpChain(), "JumpChain() did not match")
+
+		// Each server has its own copy of the Connector.
+		require.NotSame(conn, p.Servers[2].Connector, "Connector was shared")
+		require.Equal("deploy", p.Servers[2].Connector.(*connections.SSHConnector).Name, "Connector did not match")
+
+		prod, err := p.ResolveGroup("prod")
+		require.NoError(err, "ResolveGroup() returned an error: %s", err)
+		require.Equal(1, prod.Count(), "prod did not match")
+		web, err := p.GetGroup("web")
+		require.NoError(err, "GetGroup() returned an error: %s", err)
+		require.Equal(2, web.Count(), "web did not match")
+
+		prodWeb, err := p.ResolveGroup("prod-web")
+		require.NoError(err, "ResolveGroup() returned an error: %s", err)
+		require.Equal("web01", prodWeb.Servers[0].Name, "prod-web did not match")
+		require.Equal(1, prodWeb.Count(), "prod-web did not match")
+		require.Equal("jump", prodWeb.Servers[0].Connector.GetUser(), "group Connector was not bound")
+		prodWeb, err = p.ResolveGroupFor("prod-web", "Nginx")
+		require.NoError(err, "ResolveGroupFor() returned an error: %s", err)
+		require.Equal("deploy", prodWeb.Servers[0].Connector.(*connections.SSHConnector).Name, "Tile Connector was not bound")
+		require.NotSame(conn, prodWeb.Servers[0].Connector, "Tile Connector was shared")
+
+		tile, err := p.GetTile("Nginx")
+		require.NoError(err, "GetTile() returned an error: %s", err)
+		require.True(tile.InParallel, "InParallel was false")
+		require.Equal(2, tile.MaxParallel, "MaxParallel did not match")
+		require.True(tile.RequireApproval, "RequireApproval was false")
+		require.Len(tile.Tests, 1, "Tests did not match")
+		require.NotNil(tile.Remediation, "Remediation was nil")
+		require.False(tile.Remediation.RequireConfirm, "RequireConfirm was true")
+		require.Equal("5s", tile.Remediation.RecheckDelay.String(), "RecheckDelay did not match")
+	})
+
+	t.Run("missing credential", func(t *testing.T) {
+		b, err := Decode(strings.NewReader(testBundle))
+		require.NoError(err, "Decode() returned an error: %s", err)
+		require.NoError(b.Validate(), "Validate() returned an error")
+
+		_, err = b.Profile(nil, &bytes.Buffer{}, &bytes.Buffer{})
+		require.ErrorIs(err, ErrMissingCredential, "Profile() did not return ErrMissingCredential")
+		_, err = b.Profile(testCreds{}, &bytes.Buffer{}, &bytes.Buffer{})
+		require.ErrorIs(err, ErrMissingCredential, "Profile() did not return ErrMissingCredential")
+	})
+
+	t.Run("refs", func(t *testing.T) {
+		b, err := Decode(strings.NewReader(testBundle))
+		require.NoError(err, "Decode() returned an error: %s", err)
+		normalized, err := b.Normalize()
+		require.NoError(err, "Normalize() returned an error: %s", err)
+
+		p, err := b.ProfileRefs(&bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "ProfileRefs() returned an error: %s", err)
+		require.Empty(p.Servers[1].Connector.(*connections.SSHConnector).Auth, "credentials were looked up")
+
+		exported, err := Export(p)
+		require.NoError(err, "Export() returned an error: %s", err)
+		require.Empty(Diff(normalized, exported), "Profile did not export the same Bundle")
+	})
+}
+
+func TestBundleProfileRunAsPassword(t *testing.T) {
+	require := require.New(t)
+	data := "version: 1\nname: Web\ntiles: [{name: T, tests: [{type: ssh, name: x, args: {cmd: id, run_as: {method: sudo, user: root, password: sudo-pass}}}]}]\n"
+	b, err := Decode(strings.NewReader(data))
+	require.NoError(err, "Decode() returned an error: %s", err)
+	require.NoError(b.Validate(), "Validate() checked the password")
+
+	_, err = b.Profile(testCreds{}, &bytes.Buffer{}, &bytes.Buffer{})
+	require.ErrorIs(err, ErrMissingCredential, "Profile() did not return ErrMissingCredential")
+
+	p, err := b.Profile(testCreds{"sudo-pass": "secret"}, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "Profile() returned an error: %s", err)
+	tile, err := p.GetTile("T")
+	require.NoError(err, "GetTile() returned an error: %s", err)
+	ssh := tile.Tests[0].Tester.(*tests.SSHTest)
+	require.Equal([]byte("secret"), ssh.RunAs.Password.Data, "password was not loaded")
+
+	exported, err := Export(p)
+	require.NoError(err, "Export() returned an error: %s", err)
+	runAs := exported.Tiles[0].Tests[0].Args["run_as"].(map[string]any)
+	require.Equal("sudo-pass", runAs["password"], "password reference was not exported")
+	require.NotContains(fmt.Sprint(exported), "secret", "password was exported")
+}
+
+func TestBundleValidate(t *testing.T) {
+	require := require.New(t)
+
+	for name, data := range map[string]string{
+		"version":           "version: 2\nname: Web\n",
+		"name":              "version: 1\n",
+		"protocol":          "version: 1\nname: Web\nconnectors: [{name: c, protocol: rdp, user: u}]\n",
+		"user":              "version: 1\nname: Web\nconnectors: [{name: c, protocol: ssh}]\n",
+		"duplicate":         "version: 1\nname: Web\nconnectors: [{name: c, protocol: ssh, user: u}, {name: c, protocol: ssh, user: u}]\n",
+		"mock auth":         "version: 1\nname: Web\nconnectors: [{name: c, protocol: mock, user: u, auth: [key]}]\n",
+		"jump":              "version: 1\nname: Web\nconnectors: [{name: c, protocol: ssh, user: u, jump: gw}]\n",
+		"jump loop":         "version: 1\nname: Web\nconnectors: [{name: c, protocol: ssh, user: u, jump: gw}]\nservers: [{name: gw, hostname: gw, connector: c}]\n",
+		"hostname":          "version: 1\nname: Web\nservers: [{name: web01}]\n",
+		"server connector":  "version: 1\nname: Web\nservers: [{name: web01, hostname: web01, connector: c}]\n",
+		"label":             "version: 1\nname: Web\nservers: [{name: web01, hostname: web01, labels: {bad key: x}}]\n",
+		"group server":      "version: 1\nname: Web\ngroups: [{name: web, servers: [web01]}]\n",
+		"selector":          "version: 1\nname: Web\ngroups: [{name: web, selector: 'env in (prod'}]\n",
+		"group ref":         "version: 1\nname: Web\ngroups: [{name: web, include: [east]}]\n",
+		"group cycle":       "version: 1\nname: Web\ngroups: [{name: a, include: [b]}, {name: b, exclude: [a]}]\n",
+		"group connector":   "version: 1\nname: Web\ngroups: [{name: web, connector: c}]\n",
+		"tile connector":    "version: 1\nname: Web\ngroups: [{name: web, tile_connectors: {T: c}}]\n",
+		"test type":         "version: 1\nname: Web\ntiles: [{name: T, tests: [{type: bogus, name: x}]}]\n",
+		"test args":         "version: 1\nname: Web\ntiles: [{name: T, tests: [{type: tcp_open, name: x}]}]\n",
+		"flow":              "version: 1\nname: Web\ntiles: [{name: T, tests: [{type: tcp_open, name: x, args: {port: 80}, flow: {after: [y]}}]}]\n",
+		"max parallel":      "version: 1\nname: Web\ntiles: [{name: T, max_parallel: -1, tests: []}]\n",
+		"remediation":       "version: 1\nname: Web\ntiles: [{name: T, tests: [], remediation: {name: R, actions: []}}]\n",
+		"remediation delay": "version: 1\nname: Web\ntiles: [{name: T, tests: [], remediation: {name: R, recheck_delay: soon, actions: [{type: tcp_open, name: x, args: {port: 80}}]}}]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := Decode(strings.NewReader(data))
+			require.NoError(err, "Decode() returned an error: %s", err)
+			require.ErrorIs(b.Validate(), ErrInvalidBundle, "Validate() did not return ErrInvalidBundle")
+		})
+	}
+
+	t.Run("every problem", func(t *testing.T) {
+		b := Bundle{Version: 1, Name: "Web", Servers: []Server{{Name: "a"}, {Name: "b"}}}
+		err := b.Validate()
+		require.ErrorContains(err, "server a", "error did not include server a")
+		require.ErrorContains(err, "server b", "error did not include server b")
+	})
+}
+
+func TestBundleNormalize(t *testing.T) {
+	require := require.New(t)
+
+	b, err := Decode(strings.NewReader("version: 1\nname: Web\ntiles: [{name: T, tests: [{type: tcp_open, name: x, args: {port: 80}}]}]\n"))
+	require.NoError(err, "Decode() returned an error: %s", err)
+	n, err := b.Normalize()
+	require.NoError(err, "Normalize() returned an error: %s", err)
+	require.Equal(profiles.SmallestTileSize*profiles.DefaultSizeMultiplier, n.Tiles[0].DisplaySize, "DisplaySize was not set")
+	require.Contains(n.Tiles[0].Tests[0].Args, "timeout", "default args were not set")
+
+	exported, err := Export(testProfile(t))
+	require.NoError(err, "Export() returned an error: %s", err)
+	again, err := exported.Normalize()
+	require.NoError(err, "Normalize() returned an error: %s", err)
+	require.Empty(Diff(exported, again), "Normalize() changed an exported Bundle")
+
+	_, err = Bundle{Version: 1}.Normalize()
+	require.ErrorIs(err, ErrInvalidBundle, "Normalize() did not return ErrInvalidBundle")
+}
+
+func TestBundleNewConnector(t *testing.T) {
+	require := require.New(t)
+
+	c := Connector{Name: "deploy", Protocol: "ssh", User: "deploy", Auth: []string{"deploy-key"}}
+	require.NoError(c.Validate(), "Validate() returned an error")
+	conn, err := NewConnector(c, testCreds{"deploy-key": "secret"})
+	require.NoError(err, "NewConnector() returned an error: %s", err)
+	require.Equal("deploy", conn.GetUser(), "User did not match")
+
+	_, err = NewConnector(c, nil)
+	require.ErrorIs(err, ErrMissingCredential, "NewConnector() did not return ErrMissingCredential")
+	_, err = NewConnector(Connector{Name: "c", Protocol: "ssh", User: "u", Jump: "gw"}, nil)
+	require.ErrorIs(err, ErrInvalidBundle, "NewConnector() allowed a jump")
+	require.ErrorIs(Connector{Name: "c", Protocol: "rdp", User: "u"}.Validate(), ErrInvalidBundle, "Validate() allowed rdp")
+}
@@ -0,0 +1,354 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the Bundle document version written by Export.
+const Version = 1
+
+// Document formats.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+var (
+	ErrInvalidBundle     = fmt.Errorf("invalid bundle")
+	ErrUnknownFormat     = fmt.Errorf("unknown bundle format")
+	ErrNotExportable     = fmt.Errorf("profile cannot be exported")
+	ErrMissingCredential = fmt.Errorf("credential not found")
+)
+
+// Bundle is the document form of a Profile. It round trips through YAML and JSON so Profiles can
+// be kept in git and promoted between environments. Credentials are only referenced by name.
+//
+//	version: 1
+//	name: Web
+//	connectors:
+//	  - name: deploy
+//	    protocol: ssh
+//	    user: deploy
+//	    auth: [deploy-key]
+//	servers:
+//	  - name: web01
+//	    hostname: web01.example.com
+//	    labels: {env: prod}
+//	    connector: deploy
+//	groups:
+//	  - name: prod
+//	    selector: env=prod
+//	  - name: prod-web
+//	    include: [web]
+//	    intersect: [prod]
+//	    connector: deploy
+//	    tile_connectors: {Backup: backup}
+//	tiles:
+//	  - name: Nginx
+//	    tests:
+//	      - type: tcp_open
+//	        name: http
+//	        args: {port: 80}
+type Bundle struct {
+	Version    int         `json:"version" yaml:"version"`
+	Name       string      `json:"name" yaml:"name"`
+	Connectors []Connector `json:"connectors,omitempty" yaml:"connectors,omitempty"`
+	Servers    []Server    `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Groups     []Group     `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Tiles      []Tile      `json:"tiles,omitempty" yaml:"tiles,omitempty"`
+}
+
+// Connector references a Connector by name. Auth holds the names of stored AuthMethods.
+type Connector struct {
+	Name     string   `json:"name" yaml:"name"`
+	Protocol string   `json:"protocol" yaml:"protocol"`
+	User     string   `json:"user" yaml:"user"`
+	Auth     []string `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Jump     string   `json:"jump,omitempty" yaml:"jump,omitempty"` // Name of the jump server.
+}
+
+// Server is a server in the Profile inventory. ID is the stable identifier history and maintenance
+// windows refer to. Servers without one get a new ID each time the Bundle is built.
+type Server struct {
+	ID        string            `json:"id,omitempty" yaml:"id,omitempty"`
+	Name      string            `json:"name" yaml:"name"`
+	Hostname  string            `json:"hostname" yaml:"hostname"`
+	IP        string            `json:"ip,omitempty" yaml:"ip,omitempty"` // Set when it differs from Hostname.
+	Port      int               `json:"port,omitempty" yaml:"port,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Connector string            `json:"connector,omitempty" yaml:"connector,omitempty"`
+}
+
+// Group lists its servers by name. Selector picks more servers from the inventory. Include,
+// Intersect, and Exclude name other Groups. See profiles.Profile.ResolveGroup. Connector and
+// TileConnectors name the Connectors its servers run with. See profiles.Group.BindConnector.
+type Group struct {
+	Name           string            `json:"name" yaml:"name"`
+	Servers        []string          `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Selector       string            `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Include        []string          `json:"include,omitempty" yaml:"include,omitempty"`
+	Intersect      []string          `json:"intersect,omitempty" yaml:"intersect,omitempty"`
+	Exclude        []string          `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Connector      string            `json:"connector,omitempty" yaml:"connector,omitempty"`
+	TileConnectors map[string]string `json:"tile_connectors,omitempty" yaml:"tile_connectors,omitempty"` // Tile name to Connector name.
+}
+
+// Tile is a Tile with its tests in their stored form. See tests.TestConfig.
+type Tile struct {
+	Name            string             `json:"name" yaml:"name"`
+	DisplaySize     int                `json:"display_size,omitempty" yaml:"display_size,omitempty"`
+	AllMustPass     bool               `json:"all_must_pass,omitempty" yaml:"all_must_pass,omitempty"`
+	InParallel      bool               `json:"in_parallel,omitempty" yaml:"in_parallel,omitempty"`
+	MaxParallel     int                `json:"max_parallel,omitempty" yaml:"max_parallel,omitempty"`
+	Tests           []tests.TestConfig `json:"tests" yaml:"tests"`
+	Remediation     *Remediation       `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	RequireApproval bool               `json:"require_approval,omitempty" yaml:"require_approval,omitempty"` // Runs wait for an approver.
+}
+
+// Remediation is a Tile Remediation. RequireConfirm defaults to true.
+type Remediation struct {
+	Name           string             `json:"name" yaml:"name"`
+	Actions        []tests.TestConfig `json:"actions" yaml:"actions"`
+	RequireConfirm *bool              `json:"require_confirm,omitempty" yaml:"require_confirm,omitempty"`
+	RecheckDelay   string             `json:"recheck_delay,omitempty" yaml:"recheck_delay,omitempty"`
+}
+
+// Decode reads a YAML or JSON Bundle. Unknown fields are an error so typos are not ignored.
+func Decode(r io.Reader) (Bundle, error) {
+	var b Bundle
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&b); err != nil {
+		if err == io.EOF {
+			return b, fmt.Errorf("bundle.Decode: %w: empty document", ErrInvalidBundle)
+		}
+
+		return b, fmt.Errorf("bundle.Decode: %w: %w", ErrInvalidBundle, err)
+	}
+
+	return b, nil
+}
+
+// Encode writes the Bundle in the format.
+func (b Bundle) Encode(w io.Writer, format string) error {
+	switch format {
+	case FormatYAML, "":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(b); err != nil {
+			return fmt.Errorf("bundle.Bundle.Encode: %w", err)
+		}
+
+		return enc.Close()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(b); err != nil {
+			return fmt.Errorf("bundle.Bundle.Encode: %w", err)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("bundle.Bundle.Encode: %w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// Export creates the Bundle for the Profile. Servers only in a Group are added to the inventory.
+// Every test must be able to be saved. See tests.Configurer.
+func Export(p profiles.Profile) (Bundle, error) {
+	b := Bundle{Version: Version, Name: p.Name}
+	connectors := make(map[string]Connector)
+	addConnector := func(conn connections.Connector) (string, error) {
+		c, err := exportConnector(conn)
+		if err != nil {
+			return "", err
+		}
+
+		if cur, ok := connectors[c.Name]; ok && !equal(cur, c) {
+			return "", fmt.Errorf("%w: connector name %s is used by different connectors", ErrNotExportable, c.Name)
+		}
+
+		if _, ok := connectors[c.Name]; !ok {
+			b.Connectors = append(b.Connectors, c)
+		}
+
+		connectors[c.Name] = c
+		return c.Name, nil
+	}
+
+	servers := slices.Clone(p.Servers)
+	for _, name := range sortedKeys(p.Groups) {
+		for _, s := range p.Groups[name].Servers {
+			if !slices.ContainsFunc(servers, func(cur connections.Server) bool { return cur.Name == s.Name }) {
+				servers = append(servers, s)
+			}
+		}
+	}
+
+	for _, s := range servers {
+		spec := Server{ID: s.ID, Name: s.Name, Hostname: s.Hostname, Port: s.Port, Labels: s.Labels}
+		if s.UseIP && s.IP != nil && s.IP.String() != s.Hostname {
+			spec.IP = s.IP.String()
+		}
+
+		if s.Connector != nil {
+			name, err := addConnector(s.Connector)
+			if err != nil {
+				return b, fmt.Errorf("bundle.Export: %s: %w", s.Name, err)
+			}
+
+			spec.Connector = name
+		}
+
+		b.Servers = append(b.Servers, spec)
+	}
+
+	for _, name := range sortedKeys(p.Groups) {
+		g := p.Groups[name]
+		spec := Group{
+			Name:      g.Name,
+			Selector:  g.Selector.String(),
+			Include:   slices.Clone(g.Include),
+			Intersect: slices.Clone(g.Intersect),
+			Exclude:   slices.Clone(g.Exclude),
+		}
+		for _, s := range g.Servers {
+			spec.Servers = append(spec.Servers, s.Name)
+		}
+
+		if g.Connector != nil {
+			c, err := addConnector(g.Connector)
+			if err != nil {
+				return b, fmt.Errorf("bundle.Export: group %s: %w", g.Name, err)
+			}
+
+			spec.Connector = c
+		}
+
+		for _, tile := range sortedKeys(g.TileConnectors) {
+			c, err := addConnector(g.TileConnectors[tile])
+			if err != nil {
+				return b, fmt.Errorf("bundle.Export: group %s: %w", g.Name, err)
+			}
+
+			if spec.TileConnectors == nil {
+				spec.TileConnectors = make(map[string]string)
+			}
+
+			spec.TileConnectors[tile] = c
+		}
+
+		b.Groups = append(b.Groups, spec)
+	}
+
+	for _, name := range sortedKeys(p.Tiles) {
+		t, err := exportTile(p.Tiles[name])
+		if err != nil {
+			return b, fmt.Errorf("bundle.Export: %w", err)
+		}
+
+		b.Tiles = append(b.Tiles, t)
+	}
+
+	return b, nil
+}
+
+// exportConnector returns the reference for the Connector. Connectors without a name are named
+// after their protocol and user. ("mock-bob")
+func exportConnector(conn connections.Connector) (Connector, error) {
+	c := Connector{Protocol: conn.Protocol().String(), User: conn.GetUser()}
+	ssh, ok := conn.(*connections.SSHConnector)
+	if !ok {
+		c.Name = c.Protocol + "-" + c.User
+		return c, nil
+	}
+
+	if len(ssh.Auth) > len(ssh.AuthRefs) {
+		return c, fmt.Errorf("%w: connector %s has credentials which are not stored AuthMethods", ErrNotExportable, ssh.Name)
+	}
+
+	c.Name = ssh.Name
+	c.Auth = slices.Clone(ssh.AuthRefs)
+	if ssh.Jump != nil {
+		c.Jump = ssh.Jump.Name
+	}
+
+	return c, nil
+}
+
+func exportTile(t profiles.Tile) (Tile, error) {
+	spec := Tile{
+		Name:            t.Name,
+		DisplaySize:     t.DisplaySize,
+		AllMustPass:     t.AllMustPass,
+		InParallel:      t.InParallel,
+		MaxParallel:     t.MaxParallel,
+		Tests:           []tests.TestConfig{},
+		RequireApproval: t.RequireApproval,
+	}
+
+	for _, test := range t.Tests {
+		cfg, err := test.Config()
+		if err != nil {
+			return spec, fmt.Errorf("%w: tile %s: %w", ErrNotExportable, t.Name, err)
+		}
+
+		spec.Tests = append(spec.Tests, cfg)
+	}
+
+	if r := t.Remediation; r != nil {
+		confirm := r.RequireConfirm
+		spec.Remediation = &Remediation{Name: r.Name, Actions: []tests.TestConfig{}, RequireConfirm: &confirm}
+		if r.RecheckDelay > 0 {
+			spec.Remediation.RecheckDelay = r.RecheckDelay.String()
+		}
+
+		for _, action := range r.Actions {
+			cfg, err := action.Config()
+			if err != nil {
+				return spec, fmt.Errorf("%w: tile %s remediation: %w", ErrNotExportable, t.Name, err)
+			}
+
+			spec.Remediation.Actions = append(spec.Remediation.Actions, cfg)
+		}
+	}
+
+	return spec, nil
+}
+
+// parseDelay parses a Remediation RecheckDelay. Empty is 0.
+func parseDelay(s string) (time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// equal compares the JSON form of a and b so args decoded from YAML match args from a Tester.
+func equal(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,229 @@
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundle = `version: 1
+name: Web
+connectors:
+  - name: deploy
+    protocol: ssh
+    user: deploy
+    auth: [deploy-key]
+    jump: bastion
+  - name: bastion
+    protocol: ssh
+    user: jump
+servers:
+  - name: bastion
+    hostname: 192.168.1.1
+    connector: bastion
+  - name: web01
+    hostname: web01.example.com
+    ip: 10.0.0.1
+    port: 2222
+    labels: {env: prod, role: web}
+    connector: deploy
+  - name: web02
+    hostname: web02.example.com
+    labels: {env: dev, role: web}
+    connector: deploy
+groups:
+  - name: prod
+    selector: env=prod
+  - name: web
+    servers: [web01, web02]
+  - name: prod-web
+    include: [web]
+    intersect: [prod]
+    connector: bastion
+    tile_connectors: {Nginx: deploy}
+tiles:
+  - name: Nginx
+    max_parallel: 2
+    in_parallel: true
+    require_approval: true
+    tests:
+      - type: tcp_open
+        name: http
+        must_succeed: true
+        args: {port: 80}
+    remediation:
+      name: Restart nginx
+      actions:
+        - type: tcp_open
+          name: https
+          must_succeed: false
+          args: {port: 443}
+      require_confirm: false
+      recheck_delay: 5s
+`
+
+// testCreds is a Credentials of password AuthMethods.
+type testCreds map[string]string
+
+func (c testCreds) GetAuthMethod(name string) (connections.AuthMethod, []byte, error) {
+	password, ok := c[name]
+	if !ok {
+		return connections.AuthMethod{}, nil, connections.ErrInvalidAuthType
+	}
+
+	a := connections.NewAuthMethod(name)
+	a.SSHPassword(name, []byte(password))
+	return a, nil, nil
+}
+
+func testProfile(t *testing.T) profiles.Profile {
+	t.Helper()
+	b, err := Decode(strings.NewReader(testBundle))
+	require.NoError(t, err, "Decode() returned an error: %s", err)
+
+	p, err := b.Profile(testCreds{"deploy-key": "secret"}, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(t, err, "Profile() returned an error: %s", err)
+	return p
+}
+
+func TestBundleDecode(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		b, err := Decode(strings.NewReader(testBundle))
+		require.NoError(err, "Decode() returned an error: %s", err)
+		require.Equal("Web", b.Name, "Name did not match")
+		require.Len(b.Servers, 3, "Servers did not match")
+		require.Equal(map[string]any{"port": 80}, b.Tiles[0].Tests[0].Args, "Args did not match")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		b, err := Decode(strings.NewReader(`{"version": 1, "name": "Web", "groups": [{"name": "all", "selector": "env"}]}`))
+		require.NoError(err, "Decode() returned an error: %s", err)
+		require.Equal([]Group{{Name: "all", Selector: "env"}}, b.Groups, "Groups did not match")
+	})
+
+	for name, data := range map[string]string{
+		"empty":         "",
+		"unknown field": "version: 1\nname: Web\nservres: []\n",
+		"not a map":     "[1, 2]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(data))
+			require.ErrorIs(err, ErrInvalidBundle, "Decode() did not return ErrInvalidBundle")
+		})
+	}
+}
+
+func TestBundleExport(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("round trip", func(t *testing.T) {
+		p := testProfile(t)
+		b, err := Export(p)
+		require.NoError(err, "Export() returned an error: %s", err)
+
+		web01 := b.Servers[1]
+		require.NotEmpty(web01.ID, "server ID was not exported")
+		require.Equal(Server{
+			ID:        web01.ID,
+			Name:      "web01",
+			Hostname:  "web01.example.com",
+			IP:        "10.0.0.1",
+			Port:      2222,
+			Labels:    map[string]string{"env": "prod", "role": "web"},
+			Connector: "deploy",
+		}, web01, "server did not match")
+		require.Equal([]Connector{
+			{Name: "bastion", Protocol: "ssh", User: "jump"},
+			{Name: "deploy", Protocol: "ssh", User: "deploy", Auth: []string{"deploy-key"}, Jump: "bastion"},
+		}, b.Connectors, "Connectors did not match")
+
+		for _, format := range []string{FormatYAML, FormatJSON} {
+			var buf bytes.Buffer
+			require.NoError(b.Encode(&buf, format), "Encode(%s) returned an error", format)
+			require.NotContains(buf.String(), "secret", "Encode(%s) wrote a credential", format)
+
+			again, err := Decode(&buf)
+			require.NoError(err, "Decode(%s) returned an error: %s", format, err)
+			require.Empty(Diff(b, again), "Diff(%s) was not empty", format)
+
+			p2, err := again.Profile(testCreds{"deploy-key": "secret"}, &bytes.Buffer{}, &bytes.Buffer{})
+			require.NoError(err, "Profile(%s) returned an error: %s", format, err)
+			b2, err := Export(p2)
+			require.NoError(err, "Export(%s) returned an error: %s", format, err)
+			require.Empty(Diff(b, b2), "Diff(%s) was not empty", format)
+			require.Equal(web01.ID, b2.Servers[1].ID, "server ID did not survive %s", format)
+		}
+
+		require.Equal("bastion", b.Groups[1].Connector, "group Connector did not match")
+		require.Equal(map[string]string{"Nginx": "deploy"}, b.Groups[1].TileConnectors, "TileConnectors did not match")
+
+		r := b.Tiles[0].Remediation
+		require.NotNil(r, "Remediation was nil")
+		require.False(*r.RequireConfirm, "RequireConfirm did not match")
+		require.Equal("5s", r.RecheckDelay, "RecheckDelay did not match")
+	})
+
+	t.Run("group only servers", func(t *testing.T) {
+		s, err := connections.NewServer("db01", 0, &bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "NewServer() returned an error: %s", err)
+		conn, err := connections.NewMockConnector("mock", "bob")
+		require.NoError(err, "NewMockConnector() returned an error: %s", err)
+		require.NoError(s.SetConnector(&conn))
+
+		p, err := profiles.NewProfile("DB", profiles.NewGroup("db", s))
+		require.NoError(err, "NewProfile() returned an error: %s", err)
+		b, err := Export(p)
+		require.NoError(err, "Export() returned an error: %s", err)
+		require.Equal([]Server{{ID: s.ID, Name: "db01", Hostname: "db01", Connector: "mock-bob"}}, b.Servers, "Servers did not match")
+		require.Equal([]Group{{Name: "db", Servers: []string{"db01"}}}, b.Groups, "Groups did not match")
+		require.NoError(b.Validate(), "Validate() returned an error")
+	})
+
+	t.Run("not configurable", func(t *testing.T) {
+		p, err := profiles.NewProfile("Mock")
+		require.NoError(err, "NewProfile() returned an error: %s", err)
+		p.Tiles["Mock"] = profiles.NewTile("Mock", tests.Test{Name: "mock", Tester: &tests.MockTest{}})
+		_, err = Export(p)
+		require.ErrorIs(err, ErrNotExportable, "Export() did not return ErrNotExportable")
+	})
+
+	t.Run("raw credentials", func(t *testing.T) {
+		s, err := connections.NewServer("db01", 0, &bytes.Buffer{}, &bytes.Buffer{})
+		require.NoError(err, "NewServer() returned an error: %s", err)
+		conn, err := connections.NewSSHConnector("raw", "bob")
+		require.NoError(err, "NewSSHConnector() returned an error: %s", err)
+		conn.AddPasswordAuth("secret")
+		require.NoError(s.SetConnector(&conn))
+
+		p, err := profiles.NewProfile("DB")
+		require.NoError(err, "NewProfile() returned an error: %s", err)
+		p.AddServers(s)
+		_, err = Export(p)
+		require.ErrorIs(err, ErrNotExportable, "Export() did not return ErrNotExportable")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		err := Bundle{}.Encode(&bytes.Buffer{}, "xml")
+		require.ErrorIs(err, ErrUnknownFormat, "Encode() did not return ErrUnknownFormat")
+	})
+}
+
+func TestBundleParseDelay(t *testing.T) {
+	require := require.New(t)
+
+	d, err := parseDelay(" ")
+	require.NoError(err, "parseDelay() returned an error: %s", err)
+	require.Zero(d, "parseDelay() did not return 0")
+
+	d, err = parseDelay("1m")
+	require.NoError(err, "parseDelay() returned an error: %s", err)
+	require.Equal(time.Minute, d, "parseDelay() did not match")
+}
@@ -0,0 +1,130 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"gopkg.in/yaml.v3"
+)
+
+// Credential is a named AuthMethod in a credentials file. The secret is read from File or Env each
+// time it is looked up so it is never kept in the file itself. ssh_agent credentials may set
+// neither to use SSH_AUTH_SOCK.
+//
+//	credentials:
+//	  - name: deploy-key
+//	    type: ssh_key
+//	    file: /etc/cuttle/keys/deploy
+//	    passphrase_env: DEPLOY_KEY_PASSPHRASE
+//	  - name: sudo-pass
+//	    type: ssh_password
+//	    env: CUTTLE_SUDO_PASS
+type Credential struct {
+	Name          string `json:"name" yaml:"name"`
+	Type          string `json:"type" yaml:"type"` // A connections auth type. ("ssh_key")
+	File          string `json:"file,omitempty" yaml:"file,omitempty"`
+	Env           string `json:"env,omitempty" yaml:"env,omitempty"`
+	PassphraseEnv string `json:"passphrase_env,omitempty" yaml:"passphrase_env,omitempty"`
+}
+
+// FileCredentials is the Credentials of a credentials file, by name.
+type FileCredentials map[string]Credential
+
+// LoadCredentials reads a YAML or JSON credentials file. Unknown fields are an error so typos are
+// not ignored. Secrets are not read until they are looked up.
+func LoadCredentials(r io.Reader) (FileCredentials, error) {
+	var doc struct {
+		Credentials []Credential `json:"credentials" yaml:"credentials"`
+	}
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("bundle.LoadCredentials: %w", err)
+	}
+
+	creds := make(FileCredentials, len(doc.Credentials))
+	var errs []error
+	for _, c := range doc.Credentials {
+		switch {
+		case c.Name == "":
+			errs = append(errs, errors.New("credential name was empty"))
+		case c.Type == "":
+			errs = append(errs, fmt.Errorf("%s: type was empty", c.Name))
+		case c.File != "" && c.Env != "":
+			errs = append(errs, fmt.Errorf("%s: set file or env, not both", c.Name))
+		case c.File == "" && c.Env == "" && c.Type != connections.AuthSSHAgent:
+			errs = append(errs, fmt.Errorf("%s: file or env is required", c.Name))
+		default:
+			if _, ok := creds[c.Name]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate name", c.Name))
+				continue
+			}
+
+			creds[c.Name] = c
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("bundle.LoadCredentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+// GetAuthMethod reads the secret of the named Credential and returns it as an AuthMethod.
+func (c FileCredentials) GetAuthMethod(name string) (connections.AuthMethod, []byte, error) {
+	cred, ok := c[name]
+	if !ok {
+		return connections.AuthMethod{}, nil, fmt.Errorf("bundle.FileCredentials.GetAuthMethod: %w: %s", ErrMissingCredential, name)
+	}
+
+	data, err := cred.secret()
+	if err != nil {
+		return connections.AuthMethod{}, nil, fmt.Errorf("bundle.FileCredentials.GetAuthMethod: %s: %w", name, err)
+	}
+
+	a, err := connections.ParseAuthMethod(db.AuthMethodData{Name: cred.Name, AuthType: cred.Type, Data: data})
+	if err != nil {
+		return a, nil, fmt.Errorf("bundle.FileCredentials.GetAuthMethod: %s: %w", name, err)
+	}
+
+	var passphrase []byte
+	if cred.PassphraseEnv != "" {
+		passphrase = []byte(os.Getenv(cred.PassphraseEnv))
+	}
+
+	return a, passphrase, nil
+}
+
+// secret reads the secret from the file or the environment.
+func (c Credential) secret() (string, error) {
+	switch {
+	case c.File != "":
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			return "", err
+		}
+
+		// Trailing newlines are not part of a password.
+		if c.Type == connections.AuthSSHPassword {
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+
+		return string(data), nil
+	case c.Env != "":
+		v, ok := os.LookupEnv(c.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable is not set: %s", c.Env)
+		}
+
+		return v, nil
+	default:
+		return "", nil
+	}
+}
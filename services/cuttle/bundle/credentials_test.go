@@ -0,0 +1,84 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleLoadCredentials(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	passFile := filepath.Join(dir, "pass")
+	require.NoError(os.WriteFile(passFile, []byte("secret\n"), 0o600))
+	t.Setenv("TEST_CUTTLE_SUDO", "sudo-secret")
+
+	creds, err := LoadCredentials(strings.NewReader(`credentials:
+  - name: deploy-pass
+    type: ssh_password
+    file: ` + passFile + `
+  - name: sudo-pass
+    type: ssh_password
+    env: TEST_CUTTLE_SUDO
+  - name: unset
+    type: ssh_password
+    env: TEST_CUTTLE_UNSET
+  - name: agent
+    type: ssh_agent
+`))
+	require.NoError(err, "LoadCredentials() returned an error: %s", err)
+
+	t.Run("file", func(t *testing.T) {
+		a, _, err := creds.GetAuthMethod("deploy-pass")
+		require.NoError(err, "GetAuthMethod() returned an error: %s", err)
+		require.Equal(connections.AuthSSHPassword, a.AuthType, "AuthType did not match")
+		require.Equal([]byte("secret"), a.Data, "password did not match")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		a, _, err := creds.GetAuthMethod("sudo-pass")
+		require.NoError(err, "GetAuthMethod() returned an error: %s", err)
+		require.Equal([]byte("sudo-secret"), a.Data, "password did not match")
+	})
+
+	t.Run("agent", func(t *testing.T) {
+		a, _, err := creds.GetAuthMethod("agent")
+		require.NoError(err, "GetAuthMethod() returned an error: %s", err)
+		require.Equal(connections.AuthSSHAgent, a.AuthType, "AuthType did not match")
+	})
+
+	t.Run("unset env", func(t *testing.T) {
+		_, _, err := creds.GetAuthMethod("unset")
+		require.ErrorContains(err, "TEST_CUTTLE_UNSET", "GetAuthMethod() did not name the variable")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, _, err := creds.GetAuthMethod("missing")
+		require.ErrorIs(err, ErrMissingCredential, "GetAuthMethod() did not return ErrMissingCredential")
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		b, err := Decode(strings.NewReader("version: 1\nname: Web\nconnectors: [{name: deploy, protocol: ssh, user: deploy, auth: [deploy-pass]}]\n"))
+		require.NoError(err, "Decode() returned an error: %s", err)
+		_, err = b.Profile(creds, nil, nil)
+		require.NoError(err, "Profile() returned an error: %s", err)
+	})
+
+	for name, data := range map[string]string{
+		"no name":       "credentials: [{type: ssh_password, env: X}]",
+		"no type":       "credentials: [{name: a, env: X}]",
+		"no secret":     "credentials: [{name: a, type: ssh_password}]",
+		"both":          "credentials: [{name: a, type: ssh_password, env: X, file: /x}]",
+		"duplicate":     "credentials: [{name: a, type: ssh_password, env: X}, {name: a, type: ssh_password, env: Y}]",
+		"unknown field": "credentials: [{name: a, type: ssh_password, password: hunter2}]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadCredentials(strings.NewReader(data))
+			require.Error(err, "LoadCredentials() did not return an error")
+		})
+	}
+}
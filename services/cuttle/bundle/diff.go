@@ -0,0 +1,95 @@
+package bundle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change operations.
+const (
+	OpAdd    = "+"
+	OpUpdate = "~"
+	OpRemove = "-"
+)
+
+// Change is a single difference between two Bundles.
+type Change struct {
+	Op   string `json:"op"`   // OpAdd, OpUpdate, or OpRemove.
+	Kind string `json:"kind"` // "profile", "connector", "server", "group", or "tile".
+	Name string `json:"name"`
+}
+
+// Changes is the diff of two Bundles.
+type Changes []Change
+
+// Diff returns what changes going from one Bundle to the other. Items are matched by name. Adds
+// and updates are in to's order, then removes in from's order. Diff from an empty Bundle to see
+// what importing a new Profile creates. Normalize Bundles which were not exported first. A server
+// without an ID on one side is given the ID it has on the other so it is not counted as a change.
+func Diff(from, to Bundle) Changes {
+	from, to = from.KeepIDs(to), to.KeepIDs(from)
+	changes := Changes{}
+	switch {
+	case from.Name == "" && to.Name != "":
+		changes = append(changes, Change{Op: OpAdd, Kind: "profile", Name: to.Name})
+	case from.Name != to.Name:
+		changes = append(changes, Change{Op: OpUpdate, Kind: "profile", Name: to.Name})
+	}
+
+	changes = append(changes, diffNamed("connector", from.Connectors, to.Connectors, func(c Connector) string { return c.Name })...)
+	changes = append(changes, diffNamed("server", from.Servers, to.Servers, func(s Server) string { return s.Name })...)
+	changes = append(changes, diffNamed("group", from.Groups, to.Groups, func(g Group) string { return g.Name })...)
+	changes = append(changes, diffNamed("tile", from.Tiles, to.Tiles, func(t Tile) string { return t.Name })...)
+	return changes
+}
+
+func diffNamed[T any](kind string, from, to []T, name func(T) string) Changes {
+	var changes Changes
+	old := make(map[string]T, len(from))
+	for _, v := range from {
+		old[name(v)] = v
+	}
+
+	seen := make(map[string]bool, len(to))
+	for _, v := range to {
+		seen[name(v)] = true
+		cur, ok := old[name(v)]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Op: OpAdd, Kind: kind, Name: name(v)})
+		case !equal(cur, v):
+			changes = append(changes, Change{Op: OpUpdate, Kind: kind, Name: name(v)})
+		}
+	}
+
+	for _, v := range from {
+		if !seen[name(v)] {
+			changes = append(changes, Change{Op: OpRemove, Kind: kind, Name: name(v)})
+		}
+	}
+
+	return changes
+}
+
+// Count returns the number of Changes with the op.
+func (c Changes) Count(op string) int {
+	n := 0
+	for _, change := range c {
+		if change.Op == op {
+			n++
+		}
+	}
+
+	return n
+}
+
+// String returns the Changes as a diff followed by the counts.
+func (c Changes) String() string {
+	var b strings.Builder
+	for _, change := range c {
+		fmt.Fprintf(&b, "%s %s %s\n", change.Op, change.Kind, change.Name)
+	}
+
+	fmt.Fprintf(&b, "%d to add, %d to update, %d to remove\n", c.Count(OpAdd), c.Count(OpUpdate), c.Count(OpRemove))
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package bundle
+
+import (
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleDiff(t *testing.T) {
+	require := require.New(t)
+
+	from := Bundle{
+		Version: 1,
+		Name:    "Web-dev",
+		Servers: []Server{{Name: "web01", Hostname: "web01"}, {Name: "old", Hostname: "old"}},
+		Groups:  []Group{{Name: "web", Servers: []string{"web01"}}},
+		Tiles: []Tile{{Name: "Nginx", Tests: []tests.TestConfig{
+			{Type: "tcp_open", Name: "http", Args: map[string]any{"port": 80, "ports": []string{"a"}}},
+		}}},
+	}
+
+	to := Bundle{
+		Version: 1,
+		Name:    "Web",
+		Servers: []Server{{Name: "web01", Hostname: "10.0.0.1"}, {Name: "web02", Hostname: "web02"}},
+		Groups:  []Group{{Name: "web", Servers: []string{"web01"}}},
+		// Args decoded from YAML have other types but the same values.
+		Tiles: []Tile{{Name: "Nginx", Tests: []tests.TestConfig{
+			{Type: "tcp_open", Name: "http", Args: map[string]any{"port": 80.0, "ports": []any{"a"}}},
+		}}},
+	}
+
+	changes := Diff(from, to)
+	require.Equal(Changes{
+		{Op: OpUpdate, Kind: "profile", Name: "Web"},
+		{Op: OpUpdate, Kind: "server", Name: "web01"},
+		{Op: OpAdd, Kind: "server", Name: "web02"},
+		{Op: OpRemove, Kind: "server", Name: "old"},
+	}, changes, "Diff() did not match")
+	require.Equal(`~ profile Web
+~ server web01
++ server web02
+- server old
+1 to add, 2 to update, 1 to remove
+`, changes.String(), "String() did not match")
+
+	require.Equal(Changes{
+		{Op: OpAdd, Kind: "profile", Name: "Web"},
+		{Op: OpAdd, Kind: "server", Name: "web01"},
+		{Op: OpAdd, Kind: "server", Name: "web02"},
+		{Op: OpAdd, Kind: "group", Name: "web"},
+		{Op: OpAdd, Kind: "tile", Name: "Nginx"},
+	}, Diff(Bundle{}, to), "Diff() from an empty Bundle did not match")
+
+	require.Empty(Diff(to, to), "Diff() of the same Bundle was not empty")
+	require.Equal("0 to add, 0 to update, 0 to remove\n", Diff(to, to).String(), "String() did not match")
+}
+
+func TestBundleDiffServerIDs(t *testing.T) {
+	require := require.New(t)
+	from := Bundle{Name: "Web", Servers: []Server{{ID: "id-1", Name: "web01", Hostname: "web01"}}}
+
+	noID := Bundle{Name: "Web", Servers: []Server{{Name: "web01", Hostname: "web01"}}}
+	require.Empty(Diff(from, noID), "Diff() counted a missing ID as a change")
+	require.Empty(Diff(noID, from), "Diff() counted a new ID as a change")
+	require.Equal("id-1", noID.KeepIDs(from).Servers[0].ID, "KeepIDs() did not keep the ID")
+	require.Empty(noID.Servers[0].ID, "KeepIDs() changed the Bundle it was called on")
+
+	moved := Bundle{Name: "Web", Servers: []Server{{ID: "id-2", Name: "web01", Hostname: "web01"}}}
+	require.Equal(Changes{{Op: OpUpdate, Kind: "server", Name: "web01"}}, Diff(from, moved), "Diff() did not count a new ID")
+	require.Equal("id-2", moved.KeepIDs(from).Servers[0].ID, "KeepIDs() replaced an ID")
+}
@@ -1,14 +1,32 @@
 package connections
 
 import (
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/chadeldridge/cuttle-server/db"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-var ErrInvalidAuthType = fmt.Errorf("invalid auth type")
+const (
+	AuthSSHPassword            = "ssh_password"
+	AuthSSHKey                 = "ssh_key"
+	AuthSSHCert                = "ssh_cert"
+	AuthSSHKeyboardInteractive = "ssh_keyboard_interactive"
+	AuthSSHAgent               = "ssh_agent"
+)
+
+var (
+	ErrInvalidAuthType = fmt.Errorf("invalid auth type")
+	ErrNoAgentSocket   = fmt.Errorf("no ssh-agent socket set and SSH_AUTH_SOCK is empty")
+)
 
 type AuthMethod struct {
 	ID       int
@@ -18,6 +36,13 @@ type AuthMethod struct {
 	Data     []byte
 }
 
+// KeyboardInteractiveAnswer is a scripted answer for keyboard-interactive auth. Prompt is a regex
+// matched against each question the server asks. The Answer of the first matching Prompt is sent.
+type KeyboardInteractiveAnswer struct {
+	Prompt string `json:"prompt"`
+	Answer string `json:"answer"`
+}
+
 func NewAuthMethod(name string) AuthMethod {
 	return AuthMethod{Name: name}
 }
@@ -25,41 +50,147 @@ func NewAuthMethod(name string) AuthMethod {
 func ParseAuthMethod(data db.AuthMethodData) (AuthMethod, error) {
 	a := AuthMethod{ID: data.ID}
 	switch data.AuthType {
-	case "ssh_password":
+	case AuthSSHPassword:
 		a.SSHPassword(data.Name, []byte(data.Data))
 		return a, nil
-	case "ssh_key":
+	case AuthSSHKey:
 		a.SSHKey(data.Name, []byte(data.Data))
 		return a, nil
+	case AuthSSHCert:
+		key, cert := splitCertData([]byte(data.Data))
+		if err := a.SSHCert(data.Name, key, cert); err != nil {
+			return a, fmt.Errorf("connections.ParseAuthMethod: %w", err)
+		}
+
+		return a, nil
+	case AuthSSHKeyboardInteractive:
+		var answers []KeyboardInteractiveAnswer
+		if err := json.Unmarshal([]byte(data.Data), &answers); err != nil {
+			return a, fmt.Errorf("connections.ParseAuthMethod: %w", err)
+		}
+
+		if err := a.SSHKeyboardInteractive(data.Name, answers); err != nil {
+			return a, fmt.Errorf("connections.ParseAuthMethod: %w", err)
+		}
+
+		return a, nil
+	case AuthSSHAgent:
+		a.SSHAgent(data.Name, data.Data)
+		return a, nil
 	default:
 		return a, fmt.Errorf("connections.ParseAuthMethod: auth_type not supported: %s", data.AuthType)
 	}
 }
 
 func (a *AuthMethod) SSHPassword(name string, password []byte) {
-	a.AuthType = "ssh_password"
+	a.Name = name
+	a.AuthType = AuthSSHPassword
 	a.Proto = SSH
 	a.Data = password
 }
 
 func (a *AuthMethod) SSHKey(name string, key []byte) {
-	a.AuthType = "ssh_key"
+	a.Name = name
+	a.AuthType = AuthSSHKey
 	a.Proto = SSH
 	a.Data = key
 }
 
+// SSHCert sets up auth using a user certificate signed by a CA the server trusts. key is the PEM
+// private key the certificate was issued for and cert is the certificate in authorized_keys
+// format ("ssh-ed25519-cert-v01@openssh.com AAAA...").
+func (a *AuthMethod) SSHCert(name string, key, cert []byte) error {
+	if len(key) == 0 {
+		return fmt.Errorf("connections.AuthMethod.SSHCert: key was empty")
+	}
+
+	if _, err := parseCert(cert); err != nil {
+		return fmt.Errorf("connections.AuthMethod.SSHCert: %w", err)
+	}
+
+	a.Name = name
+	a.AuthType = AuthSSHCert
+	a.Proto = SSH
+	a.Data = append(append(append([]byte{}, key...), '\n'), cert...)
+	return nil
+}
+
+// SSHKeyboardInteractive sets up keyboard-interactive auth which answers each question the server
+// asks with the first matching answer. Prompts are compiled here so a bad regex is caught early.
+func (a *AuthMethod) SSHKeyboardInteractive(name string, answers []KeyboardInteractiveAnswer) error {
+	if len(answers) == 0 {
+		return fmt.Errorf("connections.AuthMethod.SSHKeyboardInteractive: answers was empty")
+	}
+
+	for _, ans := range answers {
+		if _, err := regexp.Compile(ans.Prompt); err != nil {
+			return fmt.Errorf("connections.AuthMethod.SSHKeyboardInteractive: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(answers)
+	if err != nil {
+		return fmt.Errorf("connections.AuthMethod.SSHKeyboardInteractive: %w", err)
+	}
+
+	a.Name = name
+	a.AuthType = AuthSSHKeyboardInteractive
+	a.Proto = SSH
+	a.Data = data
+	return nil
+}
+
+// SSHAgent sets up auth using the keys held by an ssh-agent running on the cuttle host. socket is
+// the path to the agent's unix socket. If socket is empty, SSH_AUTH_SOCK is used when connecting.
+func (a *AuthMethod) SSHAgent(name, socket string) {
+	a.Name = name
+	a.AuthType = AuthSSHAgent
+	a.Proto = SSH
+	a.Data = []byte(socket)
+}
+
+// ToSSHAuthMethod converts the AuthMethod into an ssh.AuthMethod. An ssh_agent AuthMethod holds a
+// connection to the agent open. Use SSHConnector.AddAuthMethod so the connection is closed with the
+// Connector.
 func (a AuthMethod) ToSSHAuthMethod(passphrase []byte) (ssh.AuthMethod, error) {
 	switch a.AuthType {
-	case "password":
+	case AuthSSHPassword:
 		// INCOMPLETE: Implement password decryption. Passwords should be encrypted in the database so we have to decrypt them here.
 		return ssh.Password(string(a.Data)), nil
-	case "ssh_key":
-		key, err := ssh.ParsePrivateKeyWithPassphrase(a.Data, passphrase)
+	case AuthSSHKey:
+		key, err := parsePrivateKey(a.Data, passphrase)
 		if err != nil {
 			return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
 		}
 
 		return ssh.PublicKeys(key), nil
+	case AuthSSHCert:
+		keyData, certData := splitCertData(a.Data)
+		key, err := parsePrivateKey(keyData, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+		}
+
+		cert, err := parseCert(certData)
+		if err != nil {
+			return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+		}
+
+		signer, err := ssh.NewCertSigner(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+		}
+
+		return ssh.PublicKeys(signer), nil
+	case AuthSSHKeyboardInteractive:
+		return a.keyboardInteractive()
+	case AuthSSHAgent:
+		ac, err := a.agent()
+		if err != nil {
+			return nil, err
+		}
+
+		return ssh.PublicKeysCallback(ac.Signers), nil
 	default:
 		return nil, ErrInvalidAuthType
 	}
@@ -69,15 +200,27 @@ func (a AuthMethod) ToAuthMethodData(passphrase []byte) (db.AuthMethodData, erro
 	var key string
 
 	switch a.AuthType {
-	case "password":
+	case AuthSSHPassword:
 		// INCOMPLETE: Implement password encryption. Passwords should be encrypted in the database so we have to encrypt them here.
 		key = string(a.Data)
-	case "ssh_key":
-		data, err := ssh.MarshalPrivateKeyWithPassphrase(a.Data, "", passphrase)
+	case AuthSSHKey:
+		data, err := encryptKey(a.Data, passphrase)
+		if err != nil {
+			return db.AuthMethodData{}, fmt.Errorf("connections.AuthMethod.ToAuthMethodData: %w", err)
+		}
+
+		key = string(data)
+	case AuthSSHCert:
+		keyData, certData := splitCertData(a.Data)
+		data, err := encryptKey(keyData, passphrase)
 		if err != nil {
-			return db.AuthMethodData{}, fmt.Errorf("db.AuthMethods.Create: failed to marshal key: %w", err)
+			return db.AuthMethodData{}, fmt.Errorf("connections.AuthMethod.ToAuthMethodData: %w", err)
 		}
-		key = string(pem.EncodeToMemory(data))
+
+		key = string(data) + "\n" + string(certData)
+	case AuthSSHKeyboardInteractive, AuthSSHAgent:
+		// INCOMPLETE: Keyboard-interactive answers may hold passwords and should be encrypted as well.
+		key = string(a.Data)
 	default:
 		return db.AuthMethodData{}, ErrInvalidAuthType
 	}
@@ -89,3 +232,165 @@ func (a AuthMethod) ToAuthMethodData(passphrase []byte) (db.AuthMethodData, erro
 		Data:     key,
 	}, nil
 }
+
+func (a AuthMethod) keyboardInteractive() (ssh.AuthMethod, error) {
+	var answers []KeyboardInteractiveAnswer
+	if err := json.Unmarshal(a.Data, &answers); err != nil {
+		return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+	}
+
+	prompts := make([]*regexp.Regexp, len(answers))
+	for i, ans := range answers {
+		re, err := regexp.Compile(ans.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+		}
+
+		prompts[i] = re
+	}
+
+	return ssh.KeyboardInteractive(
+		func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			replies := make([]string, len(questions))
+			for i, q := range questions {
+				found := false
+				for j, re := range prompts {
+					if re.MatchString(q) {
+						replies[i] = answers[j].Answer
+						found = true
+						break
+					}
+				}
+
+				if !found {
+					return nil, fmt.Errorf("connections.AuthMethod.KeyboardInteractive: no answer for prompt: %s", q)
+				}
+			}
+
+			return replies, nil
+		},
+	), nil
+}
+
+func (a AuthMethod) agent() (*agentConn, error) {
+	socket := string(a.Data)
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+
+	if socket == "" {
+		return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", ErrNoAgentSocket)
+	}
+
+	ac := &agentConn{socket: socket}
+	if err := ac.dial(); err != nil {
+		return nil, fmt.Errorf("connections.AuthMethod.ToSSHAuthMethod: %w", err)
+	}
+
+	return ac, nil
+}
+
+// agentConn is a connection to an ssh-agent. The signers use the connection so it has to stay open
+// until the Connector is done with it. SSHConnector.Close closes it and it is dialed again the next
+// time the signers are needed.
+type agentConn struct {
+	socket string
+	auth   int // Index of the ssh.AuthMethod using the agent in SSHConnector.Auth.
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+func (ac *agentConn) dial() error {
+	conn, err := net.Dial("unix", ac.socket)
+	if err != nil {
+		return err
+	}
+
+	ac.conn = conn
+	return nil
+}
+
+// Signers returns the signers held by the agent.
+func (ac *agentConn) Signers() ([]ssh.Signer, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.conn == nil {
+		if err := ac.dial(); err != nil {
+			return nil, fmt.Errorf("connections.agentConn.Signers: %w", err)
+		}
+	}
+
+	return agent.NewClient(ac.conn).Signers()
+}
+
+// Close closes the connection to the agent.
+func (ac *agentConn) Close() error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.conn == nil {
+		return nil
+	}
+
+	err := ac.conn.Close()
+	ac.conn = nil
+	return err
+}
+
+// parsePrivateKey parses a PEM private key. passphrase is only used if the key is encrypted.
+func parsePrivateKey(key, passphrase []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+
+	return signer, err
+}
+
+// encryptKey returns key as a PEM encoded private key encrypted with passphrase. If key is already
+// encrypted or passphrase is empty, key is returned as is.
+func encryptKey(key, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return key, nil
+	}
+
+	raw, err := ssh.ParseRawPrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return key, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(raw, "", passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+// splitCertData splits the stored ssh_cert data into the PEM private key and the certificate.
+func splitCertData(data []byte) ([]byte, []byte) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, data
+	}
+
+	return data[:len(data)-len(rest)], []byte(strings.TrimSpace(string(rest)))
+}
+
+// parseCert parses a certificate in authorized_keys format.
+func parseCert(data []byte) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not a certificate: %s", pub.Type())
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,340 @@
+package connections
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testGenKey generates an ed25519 key and returns the PEM encoded private key and the ssh.Signer.
+func testGenKey(t *testing.T) ([]byte, ssh.Signer) {
+	require := require.New(t)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err, "ed25519.GenerateKey() returned an error: %s", err)
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(err, "ssh.MarshalPrivateKey() returned an error: %s", err)
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(err, "ssh.NewSignerFromKey() returned an error: %s", err)
+
+	return pem.EncodeToMemory(block), signer
+}
+
+// testSignCert creates a user certificate for key signed by ca and returns it in authorized_keys
+// format.
+func testSignCert(t *testing.T, ca ssh.Signer, key ssh.PublicKey, principal string) []byte {
+	require := require.New(t)
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.UserCert,
+		KeyId:           "cuttle-test",
+		ValidPrincipals: []string{principal},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+
+	require.NoError(cert.SignCert(rand.Reader, ca), "Certificate.SignCert() returned an error")
+	return ssh.MarshalAuthorizedKey(cert)
+}
+
+// testAuthOpen opens a connection to sshd using only the AuthMethod and runs a command.
+func testAuthOpen(t *testing.T, sshd *test_helpers.SSHServer, a AuthMethod, passphrase []byte) error {
+	require := require.New(t)
+	conn, err := NewSSHConnector("auth test", testUser)
+	require.NoError(err, "NewSSHConnector() returned an error: %s", err)
+	require.NoError(conn.AddAuthMethod(a, passphrase), "SSHConnector.AddAuthMethod() returned an error")
+	require.Equal([]string{a.Name}, conn.AuthRefs, "SSHConnector.AuthRefs did not match")
+
+	server := testSSHDServer(t, sshd, "127.0.0.1")
+	server.SetConnector(&conn)
+	if err := conn.Open(server.GetAddr(), server.Buffers); err != nil {
+		return err
+	}
+	defer conn.Close(true)
+
+	return server.Run("echo authed", "line:authed")
+}
+
+func TestAuthMethodsParseAuthMethod(t *testing.T) {
+	require := require.New(t)
+	key, signer := testGenKey(t)
+	_, ca := testGenKey(t)
+	cert := testSignCert(t, ca, signer.PublicKey(), testUser)
+
+	t.Run("ssh_password", func(t *testing.T) {
+		a, err := ParseAuthMethod(db.AuthMethodData{ID: 1, Name: "pass", AuthType: AuthSSHPassword, Data: "secret"})
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(AuthMethod{ID: 1, Name: "pass", AuthType: AuthSSHPassword, Proto: SSH, Data: []byte("secret")}, a)
+	})
+
+	t.Run("ssh_key", func(t *testing.T) {
+		a, err := ParseAuthMethod(db.AuthMethodData{ID: 2, Name: "key", AuthType: AuthSSHKey, Data: string(key)})
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal("key", a.Name, "AuthMethod.Name did not match")
+		require.Equal(key, a.Data, "AuthMethod.Data did not match")
+	})
+
+	t.Run("ssh_cert", func(t *testing.T) {
+		data := string(key) + "\n" + string(cert)
+		a, err := ParseAuthMethod(db.AuthMethodData{ID: 3, Name: "cert", AuthType: AuthSSHCert, Data: data})
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(AuthSSHCert, a.AuthType, "AuthMethod.AuthType did not match")
+		k, c := splitCertData(a.Data)
+		require.Equal(key, k, "key did not match")
+		require.Equal(string(cert[:len(cert)-1]), string(c), "cert did not match")
+	})
+
+	t.Run("ssh_cert bad cert", func(t *testing.T) {
+		data := string(key) + "\nssh-ed25519 not-a-cert"
+		_, err := ParseAuthMethod(db.AuthMethodData{Name: "cert", AuthType: AuthSSHCert, Data: data})
+		require.Error(err, "ParseAuthMethod() did not return an error")
+	})
+
+	t.Run("ssh_keyboard_interactive", func(t *testing.T) {
+		data := `[{"prompt":"(?i)password","answer":"secret"}]`
+		a, err := ParseAuthMethod(db.AuthMethodData{Name: "ki", AuthType: AuthSSHKeyboardInteractive, Data: data})
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(AuthSSHKeyboardInteractive, a.AuthType, "AuthMethod.AuthType did not match")
+		require.JSONEq(data, string(a.Data), "AuthMethod.Data did not match")
+	})
+
+	t.Run("ssh_keyboard_interactive bad prompt", func(t *testing.T) {
+		data := `[{"prompt":"(password","answer":"secret"}]`
+		_, err := ParseAuthMethod(db.AuthMethodData{Name: "ki", AuthType: AuthSSHKeyboardInteractive, Data: data})
+		require.Error(err, "ParseAuthMethod() did not return an error")
+	})
+
+	t.Run("ssh_keyboard_interactive bad json", func(t *testing.T) {
+		_, err := ParseAuthMethod(db.AuthMethodData{Name: "ki", AuthType: AuthSSHKeyboardInteractive, Data: "nope"})
+		require.Error(err, "ParseAuthMethod() did not return an error")
+	})
+
+	t.Run("ssh_agent", func(t *testing.T) {
+		a, err := ParseAuthMethod(db.AuthMethodData{Name: "agent", AuthType: AuthSSHAgent, Data: "/tmp/agent.sock"})
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal([]byte("/tmp/agent.sock"), a.Data, "AuthMethod.Data did not match")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := ParseAuthMethod(db.AuthMethodData{Name: "bad", AuthType: "password", Data: "secret"})
+		require.Error(err, "ParseAuthMethod() did not return an error")
+	})
+}
+
+func TestAuthMethodsToAuthMethodData(t *testing.T) {
+	require := require.New(t)
+	key, signer := testGenKey(t)
+	_, ca := testGenKey(t)
+	cert := testSignCert(t, ca, signer.PublicKey(), testUser)
+	passphrase := []byte("keyP@ss")
+
+	t.Run("ssh_password", func(t *testing.T) {
+		a := NewAuthMethod("pass")
+		a.SSHPassword("pass", testPass)
+		data, err := a.ToAuthMethodData(nil)
+		require.NoError(err, "AuthMethod.ToAuthMethodData() returned an error: %s", err)
+		require.Equal(string(testPass), data.Data, "AuthMethodData.Data did not match")
+
+		got, err := ParseAuthMethod(data)
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(a, got, "AuthMethod did not round trip")
+	})
+
+	t.Run("ssh_key encrypted", func(t *testing.T) {
+		a := NewAuthMethod("key")
+		a.SSHKey("key", key)
+		data, err := a.ToAuthMethodData(passphrase)
+		require.NoError(err, "AuthMethod.ToAuthMethodData() returned an error: %s", err)
+		require.NotEqual(string(key), data.Data, "key was not encrypted")
+
+		got, err := ParseAuthMethod(data)
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		_, err = got.ToSSHAuthMethod(passphrase)
+		require.NoError(err, "AuthMethod.ToSSHAuthMethod() returned an error: %s", err)
+		_, err = got.ToSSHAuthMethod([]byte("wrong"))
+		require.Error(err, "AuthMethod.ToSSHAuthMethod() did not return an error")
+	})
+
+	t.Run("ssh_cert", func(t *testing.T) {
+		a := NewAuthMethod("cert")
+		require.NoError(a.SSHCert("cert", key, cert))
+		data, err := a.ToAuthMethodData(passphrase)
+		require.NoError(err, "AuthMethod.ToAuthMethodData() returned an error: %s", err)
+
+		got, err := ParseAuthMethod(data)
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		_, err = got.ToSSHAuthMethod(passphrase)
+		require.NoError(err, "AuthMethod.ToSSHAuthMethod() returned an error: %s", err)
+	})
+
+	t.Run("ssh_keyboard_interactive", func(t *testing.T) {
+		a := NewAuthMethod("ki")
+		answers := []KeyboardInteractiveAnswer{{Prompt: "Password:", Answer: "secret"}}
+		require.NoError(a.SSHKeyboardInteractive("ki", answers))
+		data, err := a.ToAuthMethodData(nil)
+		require.NoError(err, "AuthMethod.ToAuthMethodData() returned an error: %s", err)
+
+		got, err := ParseAuthMethod(data)
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(a, got, "AuthMethod did not round trip")
+	})
+
+	t.Run("ssh_agent", func(t *testing.T) {
+		a := NewAuthMethod("agent")
+		a.SSHAgent("agent", "/tmp/agent.sock")
+		data, err := a.ToAuthMethodData(nil)
+		require.NoError(err, "AuthMethod.ToAuthMethodData() returned an error: %s", err)
+
+		got, err := ParseAuthMethod(data)
+		require.NoError(err, "ParseAuthMethod() returned an error: %s", err)
+		require.Equal(a, got, "AuthMethod did not round trip")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := AuthMethod{AuthType: "password"}.ToAuthMethodData(nil)
+		require.ErrorIs(err, ErrInvalidAuthType, "AuthMethod.ToAuthMethodData() did not return ErrInvalidAuthType")
+	})
+}
+
+func TestAuthMethodsToSSHAuthMethod(t *testing.T) {
+	require := require.New(t)
+	sshd := test_helpers.NewSSHServer(t, testUser, string(testPass))
+
+	t.Run("ssh_password", func(t *testing.T) {
+		a := NewAuthMethod("pass")
+		a.SSHPassword("pass", testPass)
+		require.NoError(testAuthOpen(t, sshd, a, nil), "password auth failed")
+	})
+
+	t.Run("ssh_key", func(t *testing.T) {
+		key, signer := testGenKey(t)
+		sshd.AuthorizedKeys = []ssh.PublicKey{signer.PublicKey()}
+		defer func() { sshd.AuthorizedKeys = nil }()
+
+		a := NewAuthMethod("key")
+		a.SSHKey("key", key)
+		require.NoError(testAuthOpen(t, sshd, a, nil), "key auth failed")
+	})
+
+	t.Run("ssh_cert", func(t *testing.T) {
+		key, signer := testGenKey(t)
+		_, ca := testGenKey(t)
+		sshd.TrustedCA = ca.PublicKey()
+		defer func() { sshd.TrustedCA = nil }()
+
+		a := NewAuthMethod("cert")
+		require.NoError(a.SSHCert("cert", key, testSignCert(t, ca, signer.PublicKey(), testUser)))
+		require.NoError(testAuthOpen(t, sshd, a, nil), "cert auth failed")
+
+		// A certificate signed by a CA the server does not trust should be rejected.
+		_, other := testGenKey(t)
+		require.NoError(a.SSHCert("cert", key, testSignCert(t, other, signer.PublicKey(), testUser)))
+		require.Error(testAuthOpen(t, sshd, a, nil), "cert auth with untrusted CA did not fail")
+
+		// So should a certificate issued for a different user.
+		require.NoError(a.SSHCert("cert", key, testSignCert(t, ca, signer.PublicKey(), "alice")))
+		require.Error(testAuthOpen(t, sshd, a, nil), "cert auth with wrong principal did not fail")
+	})
+
+	t.Run("ssh_keyboard_interactive", func(t *testing.T) {
+		sshd.Questions = []test_helpers.KeyboardQuestion{
+			{Question: "Password: ", Answer: string(testPass)},
+			{Question: "Verification code: ", Answer: "123456"},
+		}
+		defer func() { sshd.Questions = nil }()
+
+		a := NewAuthMethod("ki")
+		require.NoError(a.SSHKeyboardInteractive("ki", []KeyboardInteractiveAnswer{
+			{Prompt: "(?i)password", Answer: string(testPass)},
+			{Prompt: "(?i)code", Answer: "123456"},
+		}))
+		require.NoError(testAuthOpen(t, sshd, a, nil), "keyboard-interactive auth failed")
+
+		// A question with no scripted answer should fail.
+		require.NoError(a.SSHKeyboardInteractive("ki", []KeyboardInteractiveAnswer{
+			{Prompt: "(?i)password", Answer: string(testPass)},
+		}))
+		require.Error(testAuthOpen(t, sshd, a, nil), "keyboard-interactive auth with missing answer did not fail")
+	})
+
+	t.Run("ssh_agent", func(t *testing.T) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(err, "ed25519.GenerateKey() returned an error: %s", err)
+		signer, err := ssh.NewSignerFromKey(priv)
+		require.NoError(err, "ssh.NewSignerFromKey() returned an error: %s", err)
+		sshd.AuthorizedKeys = []ssh.PublicKey{signer.PublicKey()}
+		defer func() { sshd.AuthorizedKeys = nil }()
+
+		keyring := agent.NewKeyring()
+		require.NoError(keyring.Add(agent.AddedKey{PrivateKey: priv}), "Keyring.Add() returned an error")
+
+		socket := filepath.Join(t.TempDir(), "agent.sock")
+		l, err := net.Listen("unix", socket)
+		require.NoError(err, "net.Listen() returned an error: %s", err)
+		defer l.Close()
+
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+
+				go agent.ServeAgent(keyring, c)
+			}
+		}()
+
+		a := NewAuthMethod("agent")
+		a.SSHAgent("agent", socket)
+		require.NoError(testAuthOpen(t, sshd, a, nil), "agent auth failed")
+
+		t.Setenv("SSH_AUTH_SOCK", socket)
+		a.SSHAgent("agent", "")
+		require.NoError(testAuthOpen(t, sshd, a, nil), "agent auth with SSH_AUTH_SOCK failed")
+
+		conn, err := NewSSHConnector("agent test", testUser)
+		require.NoError(err, "NewSSHConnector() returned an error: %s", err)
+		require.NoError(conn.AddAuthMethod(a, nil), "SSHConnector.AddAuthMethod() returned an error")
+		require.Len(conn.agents, 1, "agent connection was not kept")
+		server := testSSHDServer(t, sshd, "127.0.0.1")
+		server.SetConnector(&conn)
+		for i := 0; i < 2; i++ {
+			require.NoError(conn.Open(server.GetAddr(), server.Buffers), "SSHConnector.Open() returned an error")
+			require.NoError(conn.Close(true), "SSHConnector.Close() returned an error")
+			require.Nil(conn.agents[0].conn, "agent connection was not closed")
+		}
+
+		// Closing a clone must not close the agent connection of the original.
+		clone := conn.Clone().(*SSHConnector)
+		require.Len(clone.agents, 1, "clone did not get an agent connection")
+		require.NotSame(conn.agents[0], clone.agents[0], "clone shares the agent connection")
+		require.NoError(conn.Open(server.GetAddr(), server.Buffers), "SSHConnector.Open() returned an error")
+		require.NoError(clone.Open(server.GetAddr(), server.Buffers), "clone Open() returned an error")
+		require.NoError(clone.Close(true), "clone Close() returned an error")
+		require.Nil(clone.agents[0].conn, "clone agent connection was not closed")
+		require.NotNil(conn.agents[0].conn, "closing the clone closed the original agent connection")
+		require.NoError(conn.Close(true), "SSHConnector.Close() returned an error")
+	})
+
+	t.Run("ssh_agent no socket", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		a := NewAuthMethod("agent")
+		a.SSHAgent("agent", "")
+		_, err := a.ToSSHAuthMethod(nil)
+		require.ErrorIs(err, ErrNoAgentSocket, "AuthMethod.ToSSHAuthMethod() did not return ErrNoAgentSocket")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := AuthMethod{AuthType: "password"}.ToSSHAuthMethod(nil)
+		require.ErrorIs(err, ErrInvalidAuthType, "AuthMethod.ToSSHAuthMethod() did not return ErrInvalidAuthType")
+	})
+}
@@ -14,8 +14,8 @@ var (
 	ErrSessionActive = errors.New("cannot close connection, session active")
 
 	// Run Errors
-	ErrEmtpyCmd = errors.New("cmd is empty")
-	ErrEmtpyExp = errors.New("exp is empty")
+	ErrEmtpyCmd       = errors.New("cmd is empty")
+	ErrExpectMismatch = errors.New("output did not match expect")
 )
 
 type Connector interface {
@@ -43,9 +43,10 @@ type Connector interface {
 	// Connector.Run().
 	TestConnection(bufs Buffers) error
 	// Run executes the given cmd(command) against the server, if exp(expect) != "" performs a
-	// match of expect against the output of the command. The output of command is sent to
-	// Server.Log() and the expect is sent to Server.PrintResults(). Results will either be
-	// "ok" or "failed" with the error.
+	// match of expect against the output of the command. See ParseExpect for the expect format.
+	// The output of command is sent to Server.Log() and the expect is sent to
+	// Server.PrintResults(). Results will either be "ok" or "failed" with the error. Returns
+	// ErrExpectMismatch if the output does not match.
 	// Example:
 	// Connector.Run(server, "echo 'we did it'", "we did it")
 	// Logs Buffer
@@ -58,4 +59,7 @@ type Connector interface {
 	// Close ends the connecton to the server. Setting force to true will close the connection
 	// even if there is an active session.
 	Close(force bool) error
+	// Clone returns a new Connector with the same settings and no connection. A Connector holds a
+	// single connection so each Server needs its own.
+	Clone() Connector
 }
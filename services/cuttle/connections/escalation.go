@@ -0,0 +1,189 @@
+package connections
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	EscalateSudo = "sudo"
+	EscalateSu   = "su"
+
+	// SudoPrompt is passed to sudo with -p so we know exactly what the password prompt looks like.
+	SudoPrompt = "[cuttle-sudo] password: "
+	// RedactedText replaces secrets in logs.
+	RedactedText = "********"
+)
+
+var (
+	ErrEscalationNotSupported = errors.New("connector does not support privilege escalation")
+	ErrInvalidEscalation      = errors.New("invalid escalation")
+	ErrEscalationFailed       = errors.New("privilege escalation failed")
+
+	// su does not let us set the prompt so match the common "Password:" style prompts.
+	suPrompt   = regexp.MustCompile(`(?i)password[^:\n]*:\s*$`)
+	sudoPrompt = regexp.MustCompile(regexp.QuoteMeta(SudoPrompt) + `\s*$`)
+	validUser  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*\$?$`)
+)
+
+// Escalator is implemented by Connectors that can run commands as another user.
+type Escalator interface {
+	// RunAs runs cmd as another user using the Escalation and otherwise behaves like
+	// Connector.Run. The escalation password is never written to the Buffers.
+	RunAs(bufs Buffers, esc Escalation, cmd, exp string) error
+}
+
+// Escalation holds the settings for running a command as another user with sudo or su.
+type Escalation struct {
+	Method   string     // EscalateSudo or EscalateSu. Defaults to EscalateSudo.
+	User     string     // The user to run as. Defaults to "root".
+	Password AuthMethod // An ssh_password AuthMethod to answer the password prompt with. Optional for NOPASSWD sudo.
+}
+
+// PasswordMissing returns true if Password only references a stored AuthMethod by name and the
+// password itself has not been loaded.
+func (e Escalation) PasswordMissing() bool { return e.Password.Name != "" && len(e.Password.Data) == 0 }
+
+// NewEscalation creates an Escalation and validates it.
+func NewEscalation(method, user string, password AuthMethod) (Escalation, error) {
+	e := Escalation{Method: method, User: user, Password: password}
+	if e.Method == "" {
+		e.Method = EscalateSudo
+	}
+
+	if e.User == "" {
+		e.User = "root"
+	}
+
+	return e, e.Validate()
+}
+
+// Validate returns an error if the Escalation cannot be used.
+func (e Escalation) Validate() error {
+	if e.Method != EscalateSudo && e.Method != EscalateSu {
+		return fmt.Errorf("connections.Escalation.Validate: %w: method must be sudo or su: %s", ErrInvalidEscalation, e.Method)
+	}
+
+	if !validUser.MatchString(e.User) {
+		return fmt.Errorf("connections.Escalation.Validate: %w: invalid user: %s", ErrInvalidEscalation, e.User)
+	}
+
+	if e.Password.AuthType != "" && e.Password.AuthType != AuthSSHPassword {
+		return fmt.Errorf("connections.Escalation.Validate: %w: password must be %s", ErrInvalidEscalation, AuthSSHPassword)
+	}
+
+	// The name is saved instead of the password so it has to be set to load the password again.
+	if e.Password.AuthType != "" && e.Password.Name == "" {
+		return fmt.Errorf("connections.Escalation.Validate: %w: password must be a named AuthMethod", ErrInvalidEscalation)
+	}
+
+	return nil
+}
+
+// Wrap returns cmd wrapped in the sudo or su command needed to run it as Escalation.User.
+func (e Escalation) Wrap(cmd string) string {
+	if e.Method == EscalateSu {
+		return fmt.Sprintf("su %s -c %s", shellQuote(e.User), shellQuote(cmd))
+	}
+
+	return fmt.Sprintf("sudo -p %s -u %s -- sh -c %s", shellQuote(SudoPrompt), shellQuote(e.User), shellQuote(cmd))
+}
+
+// String describes the Escalation for logs. "sudo -u root"
+func (e Escalation) String() string {
+	if e.Method == EscalateSu {
+		return "su " + e.User
+	}
+
+	return "sudo -u " + e.User
+}
+
+func (e Escalation) prompt() *regexp.Regexp {
+	if e.Method == EscalateSu {
+		return suPrompt
+	}
+
+	return sudoPrompt
+}
+
+// shellQuote single quotes s so it is passed to the remote shell as a single argument.
+func shellQuote(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+
+// Redact replaces every secret in txt with RedactedText.
+func Redact(txt string, secrets ...[]byte) string {
+	for _, s := range secrets {
+		if len(s) == 0 {
+			continue
+		}
+
+		txt = strings.ReplaceAll(txt, string(s), RedactedText)
+	}
+
+	return txt
+}
+
+// promptWriter captures command output and answers the escalation password prompt. If the prompt
+// shows up again, the password was wrong, so failed is set and abort is called instead of
+// sending the password a second time.
+type promptWriter struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	checked  int // Position in buf we have already looked for a prompt in.
+	prompt   *regexp.Regexp
+	stdin    io.Writer
+	password []byte
+	answered bool
+	failed   bool
+	abort    func()
+}
+
+func (w *promptWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	if !w.prompt.Match(w.buf.Bytes()[w.checked:]) {
+		return len(p), nil
+	}
+
+	w.checked = w.buf.Len()
+	if w.answered || len(w.password) == 0 {
+		w.failed = true
+		w.abort()
+		return len(p), nil
+	}
+
+	w.answered = true
+	if _, err := w.stdin.Write(append(append([]byte{}, w.password...), '\n')); err != nil {
+		w.failed = true
+		w.abort()
+	}
+
+	return len(p), nil
+}
+
+// Output returns the captured output with the password and prompt removed and line endings
+// normalized since a PTY sends "\r\n".
+func (w *promptWriter) Output() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := strings.ReplaceAll(w.buf.String(), "\r\n", "\n")
+	out = Redact(out, w.password)
+	if w.prompt == sudoPrompt {
+		out = strings.ReplaceAll(out, SudoPrompt, "")
+	}
+
+	return out
+}
+
+func (w *promptWriter) Failed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failed
+}
@@ -0,0 +1,185 @@
+package connections
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+const testSudoPass = "sud0P@ss"
+
+// testFakeSudo simulates sudo behind a PTY with echo left on. It prompts for the password up to
+// three times and prints root's id once the right password is given.
+func testFakeSudo(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if !strings.HasPrefix(cmd, "sudo ") && !strings.HasPrefix(cmd, "su ") {
+		fmt.Fprintf(stderr, "not escalated: %s\n", cmd)
+		return 1
+	}
+
+	prompt := SudoPrompt
+	if strings.HasPrefix(cmd, "su ") {
+		prompt = "Password: "
+	}
+
+	r := bufio.NewReader(stdin)
+	for i := 0; i < 3; i++ {
+		fmt.Fprint(stdout, prompt)
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 1
+		}
+
+		fmt.Fprint(stdout, line)
+		if strings.TrimSpace(line) == testSudoPass {
+			fmt.Fprint(stdout, "uid=0(root) gid=0(root)\r\n")
+			return 0
+		}
+
+		fmt.Fprint(stdout, "Sorry, try again.\r\n")
+	}
+
+	return 1
+}
+
+func testEscalation(t *testing.T, method, password string) Escalation {
+	var a AuthMethod
+	if password != "" {
+		a.SSHPassword("sudo", []byte(password))
+	}
+
+	esc, err := NewEscalation(method, "", a)
+	require.NoError(t, err, "NewEscalation() returned an error: %s", err)
+	return esc
+}
+
+func TestEscalationNewEscalation(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		esc, err := NewEscalation("", "", AuthMethod{})
+		require.NoError(err, "NewEscalation() returned an error: %s", err)
+		require.Equal(EscalateSudo, esc.Method, "Method did not default to sudo")
+		require.Equal("root", esc.User, "User did not default to root")
+	})
+
+	t.Run("bad method", func(t *testing.T) {
+		_, err := NewEscalation("doas", "root", AuthMethod{})
+		require.ErrorIs(err, ErrInvalidEscalation, "NewEscalation() did not return ErrInvalidEscalation")
+	})
+
+	t.Run("bad user", func(t *testing.T) {
+		_, err := NewEscalation(EscalateSu, "root; rm -rf /", AuthMethod{})
+		require.ErrorIs(err, ErrInvalidEscalation, "NewEscalation() did not return ErrInvalidEscalation")
+	})
+
+	t.Run("bad password type", func(t *testing.T) {
+		var a AuthMethod
+		a.SSHAgent("agent", "")
+		_, err := NewEscalation(EscalateSudo, "root", a)
+		require.ErrorIs(err, ErrInvalidEscalation, "NewEscalation() did not return ErrInvalidEscalation")
+	})
+
+	t.Run("unnamed password", func(t *testing.T) {
+		a := AuthMethod{AuthType: AuthSSHPassword, Proto: SSH, Data: []byte("secret")}
+		_, err := NewEscalation(EscalateSudo, "root", a)
+		require.ErrorIs(err, ErrInvalidEscalation, "NewEscalation() did not return ErrInvalidEscalation")
+	})
+}
+
+func TestEscalationWrap(t *testing.T) {
+	require := require.New(t)
+	cmd := "cat '/etc/shadow'"
+
+	sudo := Escalation{Method: EscalateSudo, User: "root"}
+	require.Equal(
+		`sudo -p '[cuttle-sudo] password: ' -u 'root' -- sh -c 'cat '\''/etc/shadow'\'''`,
+		sudo.Wrap(cmd),
+		"Escalation.Wrap() did not match",
+	)
+
+	su := Escalation{Method: EscalateSu, User: "postgres"}
+	require.Equal(`su 'postgres' -c 'cat '\''/etc/shadow'\'''`, su.Wrap(cmd), "Escalation.Wrap() did not match")
+}
+
+func TestEscalationRedact(t *testing.T) {
+	require := require.New(t)
+	require.Equal("pass ******** done", Redact("pass secret done", []byte("secret")), "Redact() did not match")
+	require.Equal("nothing", Redact("nothing", nil, []byte{}), "Redact() changed txt")
+}
+
+func TestSSHConnectorRunAs(t *testing.T) {
+	require := require.New(t)
+	Pool = ConnectionPool{}
+	defer Pool.CloseAll()
+
+	sshd := test_helpers.NewSSHServer(t, testUser, string(testPass))
+	sshd.Exec = testFakeSudo
+	server := testSSHDServer(t, sshd, "127.0.0.1")
+	_, err := Pool.Open(server)
+	require.NoError(err, "Pool.Open() returned an error: %s", err)
+
+	t.Run("sudo", func(t *testing.T) {
+		server.Clear()
+		err := server.RunAs(testEscalation(t, EscalateSudo, testSudoPass), "id", "contains:uid=0(root)")
+		require.NoError(err, "Server.RunAs() returned an error: %s", err)
+		require.Contains(GetLastBufferLine(server.Results), "ok", "Server.RunAs() did not match")
+		require.NotContains(server.Logs.String(), testSudoPass, "password was written to the logs")
+		require.NotContains(server.Logs.String(), SudoPrompt, "prompt was written to the logs")
+		require.Contains(server.Logs.String(), "running as sudo -u root", "escalation was not logged")
+		require.Positive(sshd.PTYs(), "no PTY was requested")
+	})
+
+	t.Run("su", func(t *testing.T) {
+		server.Clear()
+		err := server.RunAs(testEscalation(t, EscalateSu, testSudoPass), "id", "contains:uid=0(root)")
+		require.NoError(err, "Server.RunAs() returned an error: %s", err)
+		require.Contains(GetLastBufferLine(server.Results), "ok", "Server.RunAs() did not match")
+		require.NotContains(server.Logs.String(), testSudoPass, "password was written to the logs")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		server.Clear()
+		err := server.RunAs(testEscalation(t, EscalateSudo, testSudoPass), "id", "contains:uid=1000")
+		require.ErrorIs(err, ErrExpectMismatch, "Server.RunAs() did not return ErrExpectMismatch")
+		require.Contains(GetLastBufferLine(server.Results), "failed", "Server.RunAs() did not print failed")
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		server.Clear()
+		err := server.RunAs(testEscalation(t, EscalateSudo, "wrong"), "id", "")
+		require.ErrorIs(err, ErrEscalationFailed, "Server.RunAs() did not return ErrEscalationFailed")
+		require.NotContains(server.Logs.String(), "wrong", "password was written to the logs")
+	})
+
+	t.Run("no password", func(t *testing.T) {
+		server.Clear()
+		err := server.RunAs(testEscalation(t, EscalateSudo, ""), "id", "")
+		require.ErrorIs(err, ErrEscalationFailed, "Server.RunAs() did not return ErrEscalationFailed")
+	})
+
+	t.Run("empty cmd", func(t *testing.T) {
+		err := server.RunAs(testEscalation(t, EscalateSudo, testSudoPass), "", "")
+		require.ErrorIs(err, ErrEmtpyCmd, "Server.RunAs() did not return ErrEmtpyCmd")
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		err := server.RunAs(testEscalation(t, EscalateSudo, testSudoPass), "id", "regex:(")
+		require.ErrorIs(err, ErrInvalidExpect, "Server.RunAs() did not return ErrInvalidExpect")
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		s := Server{Connector: &testNoEscalator{}}
+		err := s.RunAs(testEscalation(t, EscalateSudo, testSudoPass), "id", "")
+		require.ErrorIs(err, ErrEscalationNotSupported, "Server.RunAs() did not return ErrEscalationNotSupported")
+	})
+}
+
+// testNoEscalator is a Connector that does not implement Escalator.
+type testNoEscalator struct{ Connector }
+
+func (testNoEscalator) Protocol() Protocol { return MOCK }
@@ -0,0 +1,442 @@
+package connections
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expect DSL
+//
+// An expect string is made up of one or more matchers. Matchers are written as "type:value". A
+// matcher may be negated by prefixing the type with "!". Anything without a known type prefix is
+// treated as a regex so existing expect strings keep working.
+//
+//	contains:text		Output contains text.
+//	regex:pattern		Output matches the regex pattern.
+//	line:text		Output has a line that is exactly text. Surrounding whitespace is ignored.
+//	num:<op><value>:pattern	The first capture group of pattern (or the whole match if there are
+//				no groups) is a number that satisfies op value. "num:<90:(\d+)%"
+//	json:path<op>value	Output is JSON and the value at path satisfies op value. Path is dot
+//				separated and array elements are addressed by index: "json:disks.0.used<90".
+//				"json:path" on its own checks that path exists.
+//	!type:value		Negate the matcher. "!contains:error", "!regex:fail(ed|ure)"
+//
+// Matchers can be combined with " && " (all of) and " || " (any of). "&&" binds tighter than "||"
+// so "a && b || c" is "(a && b) || c".
+//
+// Supported ops: "==", "!=", "<", "<=", ">", ">=".
+
+const (
+	expectAnd = " && "
+	expectOr  = " || "
+)
+
+var (
+	ErrInvalidExpect = errors.New("invalid expect")
+	ErrInvalidOp     = errors.New("invalid comparison op")
+
+	// Longer ops must come first so "<=" is not read as "<".
+	expectOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+)
+
+// Expect matches the output of a command against what we expect to see.
+type Expect interface {
+	// Match returns true if data satisfies the Expect.
+	Match(data []byte) bool
+	// String returns the expect string the Expect was parsed from.
+	String() string
+}
+
+// ParseExpect parses exp into an Expect. Regexes are compiled here so an invalid expect is caught
+// before anything is ran. An empty exp returns a nil Expect and no error, which means there is
+// nothing to match.
+func ParseExpect(exp string) (Expect, error) {
+	if strings.TrimSpace(exp) == "" {
+		return nil, nil
+	}
+
+	e, err := parseAny(exp)
+	if err != nil {
+		return nil, fmt.Errorf("connections.ParseExpect: %w", err)
+	}
+
+	return e, nil
+}
+
+// ValidateExpect returns an error if exp cannot be parsed into an Expect.
+func ValidateExpect(exp string) error {
+	_, err := ParseExpect(exp)
+	return err
+}
+
+// MatchExpect returns true if e is nil or data satisfies e.
+func MatchExpect(e Expect, data []byte) bool {
+	if e == nil {
+		return true
+	}
+
+	return e.Match(data)
+}
+
+func parseAny(exp string) (Expect, error) {
+	parts := strings.Split(exp, expectOr)
+	if len(parts) == 1 {
+		return parseAll(exp)
+	}
+
+	a := anyExpect{raw: exp}
+	for _, p := range parts {
+		e, err := parseAll(p)
+		if err != nil {
+			return nil, err
+		}
+
+		a.of = append(a.of, e)
+	}
+
+	return a, nil
+}
+
+func parseAll(exp string) (Expect, error) {
+	parts := strings.Split(exp, expectAnd)
+	if len(parts) == 1 {
+		return parseMatcher(exp)
+	}
+
+	a := allExpect{raw: exp}
+	for _, p := range parts {
+		e, err := parseMatcher(p)
+		if err != nil {
+			return nil, err
+		}
+
+		a.of = append(a.of, e)
+	}
+
+	return a, nil
+}
+
+func parseMatcher(exp string) (Expect, error) {
+	if strings.TrimSpace(exp) == "" {
+		return nil, fmt.Errorf("%w: empty matcher in combination", ErrInvalidExpect)
+	}
+
+	kind, value, found := strings.Cut(exp, ":")
+	negate := strings.HasPrefix(kind, "!")
+	if !found || !isExpectType(strings.TrimPrefix(kind, "!")) {
+		// No known type so treat the whole string as a regex.
+		return newRegexExpect(exp, exp)
+	}
+
+	var e Expect
+	var err error
+	switch strings.TrimPrefix(kind, "!") {
+	case "contains":
+		e, err = containsExpect{raw: exp, text: value}, nil
+	case "regex":
+		e, err = newRegexExpect(exp, value)
+	case "line":
+		e, err = lineExpect{raw: exp, line: strings.TrimSpace(value)}, nil
+	case "num":
+		e, err = newNumExpect(exp, value)
+	case "json":
+		e, err = newJSONExpect(exp, value)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if negate {
+		return notExpect{raw: exp, Expect: e}, nil
+	}
+
+	return e, nil
+}
+
+func isExpectType(kind string) bool {
+	switch kind {
+	case "contains", "regex", "line", "num", "json":
+		return true
+	default:
+		return false
+	}
+}
+
+// cutOp splits s on the first comparison op found in s.
+func cutOp(s string) (before, op, after string, found bool) {
+	idx := -1
+	for _, o := range expectOps {
+		i := strings.Index(s, o)
+		if i < 0 {
+			continue
+		}
+
+		// Prefer the op closest to the start of s. On a tie the longer op wins since it is
+		// checked first.
+		if idx < 0 || i < idx {
+			idx = i
+			op = o
+		}
+	}
+
+	if idx < 0 {
+		return s, "", "", false
+	}
+
+	return s[:idx], op, s[idx+len(op):], true
+}
+
+// compareNum returns true if got op want is true.
+func compareNum(got float64, op string, want float64) bool {
+	switch op {
+	case "==":
+		return got == want
+	case "!=":
+		return got != want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	default:
+		return false
+	}
+}
+
+//						//
+//		Matchers			//
+//						//
+
+type containsExpect struct {
+	raw  string
+	text string
+}
+
+func (e containsExpect) Match(data []byte) bool { return bytes.Contains(data, []byte(e.text)) }
+func (e containsExpect) String() string         { return e.raw }
+
+type regexExpect struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+func newRegexExpect(raw, pattern string) (Expect, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpect, err)
+	}
+
+	return regexExpect{raw: raw, re: re}, nil
+}
+
+func (e regexExpect) Match(data []byte) bool { return e.re.Match(data) }
+func (e regexExpect) String() string         { return e.raw }
+
+type lineExpect struct {
+	raw  string
+	line string
+}
+
+func (e lineExpect) Match(data []byte) bool {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		if strings.TrimSpace(s.Text()) == e.line {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e lineExpect) String() string { return e.raw }
+
+type numExpect struct {
+	raw   string
+	op    string
+	value float64
+	re    *regexp.Regexp
+}
+
+func newNumExpect(raw, value string) (Expect, error) {
+	cmp, pattern, found := strings.Cut(value, ":")
+	if !found || pattern == "" {
+		return nil, fmt.Errorf("%w: num expects 'num:<op><value>:<regex>': %s", ErrInvalidExpect, raw)
+	}
+
+	before, op, want, found := cutOp(cmp)
+	if !found || before != "" {
+		return nil, fmt.Errorf("%w: %w: %s", ErrInvalidExpect, ErrInvalidOp, raw)
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(want), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: num value is not a number: %s", ErrInvalidExpect, raw)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpect, err)
+	}
+
+	return numExpect{raw: raw, op: op, value: n, re: re}, nil
+}
+
+func (e numExpect) Match(data []byte) bool {
+	m := e.re.FindSubmatch(data)
+	if m == nil {
+		return false
+	}
+
+	// Use the first capture group if there is one, otherwise use the whole match.
+	captured := m[0]
+	if len(m) > 1 {
+		captured = m[1]
+	}
+
+	got, err := strconv.ParseFloat(strings.TrimSpace(string(captured)), 64)
+	if err != nil {
+		return false
+	}
+
+	return compareNum(got, e.op, e.value)
+}
+
+func (e numExpect) String() string { return e.raw }
+
+type jsonExpect struct {
+	raw   string
+	path  []string
+	op    string
+	value string
+}
+
+func newJSONExpect(raw, value string) (Expect, error) {
+	path, op, want, _ := cutOp(value)
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("%w: json path is empty: %s", ErrInvalidExpect, raw)
+	}
+
+	// Allow quoted string values: json:status=="ok"
+	want = strings.TrimSpace(want)
+	if unquoted, err := strconv.Unquote(want); err == nil {
+		want = unquoted
+	}
+
+	return jsonExpect{raw: raw, path: strings.Split(path, "."), op: op, value: want}, nil
+}
+
+func (e jsonExpect) Match(data []byte) bool {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+
+	got, ok := jsonLookup(doc, e.path)
+	if !ok {
+		return false
+	}
+
+	// No op means we only care that the path exists.
+	if e.op == "" {
+		return true
+	}
+
+	// Compare as numbers when both sides are numbers.
+	if g, ok := got.(float64); ok {
+		if w, err := strconv.ParseFloat(e.value, 64); err == nil {
+			return compareNum(g, e.op, w)
+		}
+	}
+
+	s := fmt.Sprint(got)
+	switch e.op {
+	case "==":
+		return s == e.value
+	case "!=":
+		return s != e.value
+	default:
+		return false
+	}
+}
+
+func (e jsonExpect) String() string { return e.raw }
+
+// jsonLookup walks doc following path. Returns false if any part of path does not exist.
+func jsonLookup(doc any, path []string) (any, bool) {
+	cur := doc
+	for _, p := range path {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[p]
+			if !ok {
+				return nil, false
+			}
+
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+type notExpect struct {
+	raw string
+	Expect
+}
+
+func (e notExpect) Match(data []byte) bool { return !e.Expect.Match(data) }
+func (e notExpect) String() string         { return e.raw }
+
+type anyExpect struct {
+	raw string
+	of  []Expect
+}
+
+func (e anyExpect) Match(data []byte) bool {
+	for _, m := range e.of {
+		if m.Match(data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e anyExpect) String() string { return e.raw }
+
+type allExpect struct {
+	raw string
+	of  []Expect
+}
+
+func (e allExpect) Match(data []byte) bool {
+	for _, m := range e.of {
+		if !m.Match(data) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e allExpect) String() string { return e.raw }
@@ -0,0 +1,138 @@
+package connections
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testMatchExpect(t *testing.T, exp, data string, want bool) {
+	require := require.New(t)
+	e, err := ParseExpect(exp)
+	require.NoError(err, "ParseExpect() returned an error: %s", err)
+	require.Equal(want, MatchExpect(e, []byte(data)), "MatchExpect() returned the wrong result for '%s'", exp)
+}
+
+func TestExpectParseExpect(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("empty", func(t *testing.T) {
+		e, err := ParseExpect("")
+		require.NoError(err, "ParseExpect() returned an error: %s", err)
+		require.Nil(e, "ParseExpect() did not return a nil Expect")
+	})
+
+	t.Run("plain regex", func(t *testing.T) {
+		e, err := ParseExpect("Hello, (World|Bob)!")
+		require.NoError(err, "ParseExpect() returned an error: %s", err)
+		require.IsType(regexExpect{}, e, "ParseExpect() did not return a regexExpect")
+		require.Equal("Hello, (World|Bob)!", e.String(), "Expect.String() did not match")
+	})
+
+	t.Run("unknown prefix", func(t *testing.T) {
+		e, err := ParseExpect("http://test.home")
+		require.NoError(err, "ParseExpect() returned an error: %s", err)
+		require.IsType(regexExpect{}, e, "ParseExpect() did not return a regexExpect")
+	})
+
+	t.Run("negated", func(t *testing.T) {
+		e, err := ParseExpect("!contains:error")
+		require.NoError(err, "ParseExpect() returned an error: %s", err)
+		require.IsType(notExpect{}, e, "ParseExpect() did not return a notExpect")
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		e, err := ParseExpect("contains:a && contains:b || contains:c")
+		require.NoError(err, "ParseExpect() returned an error: %s", err)
+		require.IsType(anyExpect{}, e, "ParseExpect() did not return an anyExpect")
+		require.IsType(allExpect{}, e.(anyExpect).of[0], "first any-of was not an allExpect")
+	})
+
+	bad := map[string]string{
+		"bad regex":        "(si|sa|za|ja|to",
+		"bad typed regex":  "regex:(unclosed",
+		"bad negated":      "!regex:[a-",
+		"num no regex":     "num:<90",
+		"num no op":        "num:90:(\\d+)",
+		"num not a number": "num:<ninety:(\\d+)",
+		"num bad regex":    "num:<90:(\\d+",
+		"json no path":     "json:==ok",
+		"empty in combo":   "contains:a &&  && contains:b",
+	}
+
+	for name, exp := range bad {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseExpect(exp)
+			require.ErrorIs(err, ErrInvalidExpect, "ParseExpect() did not return ErrInvalidExpect")
+		})
+	}
+}
+
+func TestExpectValidateExpect(t *testing.T) {
+	require := require.New(t)
+	require.NoError(ValidateExpect("contains:ok"), "ValidateExpect() returned an error")
+	require.Error(ValidateExpect("regex:("), "ValidateExpect() did not return an error")
+}
+
+func TestExpectMatch(t *testing.T) {
+	out := "Filesystem Size Used Avail Use% Mounted on\n/dev/sda1 20G 15G 5G 75% /\nstatus: running\n"
+
+	t.Run("nil", func(t *testing.T) { testMatchExpect(t, "", out, true) })
+
+	t.Run("regex", func(t *testing.T) {
+		testMatchExpect(t, "status: (running|starting)", out, true)
+		testMatchExpect(t, "regex:status: stopped", out, false)
+		testMatchExpect(t, "!regex:status: stopped", out, true)
+	})
+
+	t.Run("contains", func(t *testing.T) {
+		testMatchExpect(t, "contains:/dev/sda1", out, true)
+		testMatchExpect(t, "contains:/dev/sdb1", out, false)
+		testMatchExpect(t, "!contains:error", out, true)
+		testMatchExpect(t, "!contains:running", out, false)
+	})
+
+	t.Run("line", func(t *testing.T) {
+		testMatchExpect(t, "line:status: running", out, true)
+		testMatchExpect(t, "line:status", out, false)
+		testMatchExpect(t, "!line:status: stopped", out, true)
+	})
+
+	t.Run("num", func(t *testing.T) {
+		testMatchExpect(t, `num:<90:(\d+)% /`, out, true)
+		testMatchExpect(t, `num:<=75:(\d+)% /`, out, true)
+		testMatchExpect(t, `num:>75:(\d+)% /`, out, false)
+		testMatchExpect(t, `num:==75:(\d+)% /`, out, true)
+		testMatchExpect(t, `num:!=75:(\d+)% /`, out, false)
+		testMatchExpect(t, `num:>=20:\d+`, "size 20", true)
+		testMatchExpect(t, `num:<90:(\d+)% /home`, out, false)
+		testMatchExpect(t, `num:<90:(\w+)%`, "abc%", false)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		doc := `{"status": "ok", "disks": [{"name": "sda", "used": 75}], "healthy": true}`
+		testMatchExpect(t, "json:status", doc, true)
+		testMatchExpect(t, "json:missing", doc, false)
+		testMatchExpect(t, `json:status=="ok"`, doc, true)
+		testMatchExpect(t, "json:status==ok", doc, true)
+		testMatchExpect(t, "json:status!=ok", doc, false)
+		testMatchExpect(t, "json:disks.0.used<90", doc, true)
+		testMatchExpect(t, "json:disks.0.used>=90", doc, false)
+		testMatchExpect(t, "json:disks.1.used<90", doc, false)
+		testMatchExpect(t, "json:disks.x.used<90", doc, false)
+		testMatchExpect(t, "json:healthy==true", doc, true)
+		testMatchExpect(t, "json:status<1", doc, false)
+		testMatchExpect(t, "json:status", "not json", false)
+	})
+
+	t.Run("all of", func(t *testing.T) {
+		testMatchExpect(t, "contains:sda1 && line:status: running", out, true)
+		testMatchExpect(t, "contains:sda1 && line:status: stopped", out, false)
+	})
+
+	t.Run("any of", func(t *testing.T) {
+		testMatchExpect(t, "contains:sdb1 || line:status: running", out, true)
+		testMatchExpect(t, "contains:sdb1 || line:status: stopped", out, false)
+		testMatchExpect(t, "contains:sdb1 && contains:sda1 || !contains:error", out, true)
+	})
+}
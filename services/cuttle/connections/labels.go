@@ -0,0 +1,100 @@
+package connections
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxLabelLength = 63
+
+var (
+	ErrInvalidLabel = fmt.Errorf("invalid label")
+
+	// Keys and values start and end with a letter or number. Keys may also contain '/' so they
+	// can be prefixed. (team.example.com/owner)
+	labelKeyRe   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValueRe = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabelKey returns ErrInvalidLabel if key is not a valid label key.
+func ValidateLabelKey(key string) error {
+	if len(key) > maxLabelLength || !labelKeyRe.MatchString(key) {
+		return fmt.Errorf("connections.ValidateLabelKey: %w: key %q", ErrInvalidLabel, key)
+	}
+
+	return nil
+}
+
+// ValidateLabelValue returns ErrInvalidLabel if value is not a valid label value. Values may be
+// empty.
+func ValidateLabelValue(value string) error {
+	if len(value) > maxLabelLength || !labelValueRe.MatchString(value) {
+		return fmt.Errorf("connections.ValidateLabelValue: %w: value %q", ErrInvalidLabel, value)
+	}
+
+	return nil
+}
+
+// SetLabel validates and sets the label on the Server. Labels is copied before it is changed so
+// copies of the Server keep their labels.
+func (s *Server) SetLabel(key, value string) error {
+	if err := ValidateLabelKey(key); err != nil {
+		return fmt.Errorf("connections.Server.SetLabel: %w", err)
+	}
+
+	if err := ValidateLabelValue(value); err != nil {
+		return fmt.Errorf("connections.Server.SetLabel: %w", err)
+	}
+
+	labels := maps.Clone(s.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	labels[key] = value
+	s.Labels = labels
+	return nil
+}
+
+// SetLabels sets each label on the Server. No labels are set if any are invalid.
+func (s *Server) SetLabels(labels map[string]string) error {
+	next := *s
+	for k, v := range labels {
+		if err := next.SetLabel(k, v); err != nil {
+			return err
+		}
+	}
+
+	s.Labels = next.Labels
+	return nil
+}
+
+// RemoveLabel removes the label from the Server.
+func (s *Server) RemoveLabel(key string) {
+	if _, ok := s.Labels[key]; !ok {
+		return
+	}
+
+	labels := maps.Clone(s.Labels)
+	delete(labels, key)
+	s.Labels = labels
+}
+
+// LabelString returns the labels sorted by key. "env=prod,role=db"
+func (s Server) LabelString() string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + s.Labels[k]
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,51 @@
+package connections
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelsValidate(t *testing.T) {
+	require := require.New(t)
+	for _, key := range []string{"env", "role", "team.example.com/owner", "a", "tier-1"} {
+		require.NoError(ValidateLabelKey(key), "ValidateLabelKey(%q) returned an error", key)
+	}
+
+	for _, key := range []string{"", "-env", "env-", "env=prod", "has space", string(make([]byte, 64))} {
+		require.ErrorIs(ValidateLabelKey(key), ErrInvalidLabel, "ValidateLabelKey(%q) did not return ErrInvalidLabel", key)
+	}
+
+	for _, value := range []string{"", "prod", "v1.2.3", "us_east-1"} {
+		require.NoError(ValidateLabelValue(value), "ValidateLabelValue(%q) returned an error", value)
+	}
+
+	for _, value := range []string{"a/b", "prod,db", "(db)", ".prod"} {
+		require.ErrorIs(ValidateLabelValue(value), ErrInvalidLabel, "ValidateLabelValue(%q) did not return ErrInvalidLabel", value)
+	}
+}
+
+func TestLabelsSetLabel(t *testing.T) {
+	require := require.New(t)
+	s := Server{Hostname: "host1"}
+
+	t.Run("set", func(t *testing.T) {
+		require.NoError(s.SetLabel("env", "prod"), "SetLabel() returned an error")
+		require.NoError(s.SetLabel("role", "db"), "SetLabel() returned an error")
+		require.Equal("env=prod,role=db", s.LabelString(), "labels did not match")
+	})
+
+	t.Run("copies keep labels", func(t *testing.T) {
+		cp := s
+		require.NoError(cp.SetLabel("env", "dev"), "SetLabel() returned an error")
+		cp.RemoveLabel("role")
+		require.Equal("env=prod,role=db", s.LabelString(), "copy changed the original labels")
+		require.Equal("env=dev", cp.LabelString(), "copy labels did not match")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(s.SetLabel("bad key", "x"), "SetLabel() did not return an error")
+		require.Error(s.SetLabels(map[string]string{"tier": "1", "bad": "a b"}), "SetLabels() did not return an error")
+		require.NotContains(s.Labels, "tier", "SetLabels() set labels when one was invalid")
+	})
+}
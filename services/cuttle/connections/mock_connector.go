@@ -76,15 +76,25 @@ func (c *MockConnector) CloseSession() error {
 //	Connector Interface Implementation	//
 //						//
 
-func (c MockConnector) IsConnected() bool  { return c.isConnected }
-func (c MockConnector) IsActive() bool     { return c.hasSession }
-func (c MockConnector) Protocol() Protocol { return MockProtocol }
-func (c MockConnector) GetUser() string    { return c.user }
-func (c MockConnector) DefaultPort() int   { return MockDefaultPort }
-func (c MockConnector) IsEmpty() bool      { return c.user == "" }
-func (c MockConnector) IsValid() bool      { return c.user != "" }
-
-func (c MockConnector) Validate() error {
+func (c *MockConnector) IsConnected() bool  { return c.isConnected }
+func (c *MockConnector) IsActive() bool     { return c.hasSession }
+func (c *MockConnector) Protocol() Protocol { return MockProtocol }
+func (c *MockConnector) GetUser() string    { return c.user }
+func (c *MockConnector) DefaultPort() int   { return MockDefaultPort }
+func (c *MockConnector) IsEmpty() bool      { return c.user == "" }
+func (c *MockConnector) IsValid() bool      { return c.user != "" }
+
+func (c *MockConnector) Clone() Connector {
+	return &MockConnector{
+		user:         c.user,
+		connOpenErr:  c.connOpenErr,
+		sessOpenErr:  c.sessOpenErr,
+		connCloseErr: c.connCloseErr,
+		sessCloseErr: c.sessCloseErr,
+	}
+}
+
+func (c *MockConnector) Validate() error {
 	if c.user == "" {
 		return ErrInvalidEmtpyUser
 	}
@@ -105,12 +115,12 @@ func (c *MockConnector) Open(addr string, bufs Buffers) error {
 	return nil
 }
 
-func (c MockConnector) TestConnection(bufs Buffers) error {
+func (c *MockConnector) TestConnection(bufs Buffers) error {
 	expect := "cuttle ok"
 	return c.Run(bufs, fmt.Sprintf("echo '%s'", expect), expect)
 }
 
-func (c MockConnector) Run(bufs Buffers, cmd, exp string) error {
+func (c *MockConnector) Run(bufs Buffers, cmd, exp string) error {
 	if !c.isConnected {
 		return ErrNotConnected
 	}
@@ -120,8 +130,9 @@ func (c MockConnector) Run(bufs Buffers, cmd, exp string) error {
 		return ErrEmtpyCmd
 	}
 
-	if exp == "" {
-		return ErrEmtpyExp
+	expect, err := ParseExpect(exp)
+	if err != nil {
+		return err
 	}
 
 	// We have to split cmd into the command name and args for exec to work. This adds
@@ -138,16 +149,27 @@ func (c MockConnector) Run(bufs Buffers, cmd, exp string) error {
 	// Log the full output of the command.
 	bufs.Log(eventTime, string(out))
 
-	ok := foundExpect(out, exp)
+	ok := MatchExpect(expect, out)
 	if !ok {
 		bufs.PrintResults(eventTime, "failed", nil)
-		return fmt.Errorf("expected '%s' but got '%s'", exp, string(out))
+		return fmt.Errorf("connections.MockConnector.Run: %w: expected '%s' but got '%s'", ErrExpectMismatch, exp, string(out))
 	}
 
 	bufs.PrintResults(eventTime, "ok", nil)
 	return nil
 }
 
+// RunAs validates esc and then runs cmd as the current user since MockConnector runs commands
+// locally. The escalation is only logged.
+func (c *MockConnector) RunAs(bufs Buffers, esc Escalation, cmd, exp string) error {
+	if err := esc.Validate(); err != nil {
+		return err
+	}
+
+	bufs.Log(time.Now(), fmt.Sprintf("running as %s", esc))
+	return c.Run(bufs, cmd, exp)
+}
+
 func (c *MockConnector) Close(force bool) error {
 	if !c.isConnected {
 		return ErrNotConnected
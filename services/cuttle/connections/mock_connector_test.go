@@ -26,6 +26,17 @@ func TestMockConnectorNewMockConnector(t *testing.T) {
 	})
 }
 
+func TestMockConnectorClone(t *testing.T) {
+	require := require.New(t)
+	conn := testNewMockConnector()
+	require.NoError(conn.Open(testHost, Buffers{}), "MockConnector.Open() returned an error")
+
+	clone := conn.Clone()
+	require.Equal(testUser, clone.GetUser(), "user was not copied")
+	require.False(clone.IsConnected(), "connection was copied")
+	require.True(conn.IsConnected(), "Clone() changed the original")
+}
+
 func TestMockConnectorSetUser(t *testing.T) {
 	require := require.New(t)
 	newUser := "george"
@@ -416,6 +427,12 @@ func TestMockConnectorRun(t *testing.T) {
 	t.Run("empty exp", func(t *testing.T) {
 		conn.isConnected = true
 		err := conn.Run(server.Buffers, cmd, "")
+		require.NoError(err, "MockConnector.Run() returned an error: %s", err)
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		conn.isConnected = true
+		err := conn.Run(server.Buffers, cmd, "regex:(unclosed")
 		require.Error(err, "MockConnector.Run() did not return an error")
 	})
 
@@ -3,6 +3,7 @@ package connections
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -12,8 +13,15 @@ var (
 	ErrConnectionFound = errors.New("connection found in pool")
 )
 
+var (
+	poolMu sync.Mutex // Guards Pool, openMu, and Connection.killAt. Not held while connecting.
+	// Held while the Connection for a key opens so servers sharing it only connect once. Jump
+	// hosts open from inside another Open so a single lock for the Pool would deadlock.
+	openMu = make(map[string]*sync.Mutex)
+)
+
 // ConnectionPool holds an array of connections used to setup our shared pool.
-type ConnectionPool map[string]*Connection // map[Open.hostame]Open
+type ConnectionPool map[string]*Connection // map[Server.PoolKey()]Connection
 
 // Connection holds a Server ref and our time to kill for connection cleanup.
 type Connection struct {
@@ -27,9 +35,14 @@ func init() {
 	TTL = 2 // Two minute default TTL
 }
 
-func (p ConnectionPool) Count() int { return len(p) }
+func (p ConnectionPool) Count() int {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	return len(p)
+}
 
-// Open creates a new Connection and adds it to Pool.
+// Open creates a new Connection and adds it to Pool. If the server already has a Connection for
+// the same user, its Connector is set on the server. See Server.PoolKey.
 func (p ConnectionPool) Open(server *Server) (*Connection, error) {
 	conn := &Connection{Server: server}
 	return conn.Open(p)
@@ -40,10 +53,21 @@ func (c *Connection) Open(pool ConnectionPool) (*Connection, error) {
 		return c, errors.New("connections.Pool.Open: hostname was empty")
 	}
 
-	if conn, exists := pool[c.Server.Hostname]; exists {
+	key := c.PoolKey()
+	mu := openLock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	poolMu.Lock()
+	if conn, exists := pool[key]; exists {
 		conn.killAt = time.Now().Add(time.Minute * time.Duration(TTL))
+		poolMu.Unlock()
+		// Use the pooled Connector since the connection may have been opened by another copy of
+		// the Server.
+		c.Server.Connector = conn.Connector
 		return conn, nil
 	}
+	poolMu.Unlock()
 
 	c.killAt = time.Now().Add(time.Minute * time.Duration(TTL))
 	err := c.Connector.Open(c.Server.GetAddr(), c.Server.Buffers)
@@ -51,13 +75,30 @@ func (c *Connection) Open(pool ConnectionPool) (*Connection, error) {
 		return nil, err
 	}
 
-	pool[c.Server.Hostname] = c
+	poolMu.Lock()
+	pool[key] = c
+	poolMu.Unlock()
 	return c, nil
 }
 
+// openLock returns the lock held while the Connection for the key opens.
+func openLock(key string) *sync.Mutex {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	mu, ok := openMu[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		openMu[key] = mu
+	}
+
+	return mu
+}
+
 // GetConnection returns a connection for the server if one exists. Returns nil if no connection is found.
 func (p ConnectionPool) GetConnection(server Server) *Connection {
-	conn, ok := p[server.Hostname]
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	conn, ok := p[server.PoolKey()]
 	if !ok {
 		return nil
 	}
@@ -76,8 +117,11 @@ func (c *Connection) Extend(minutes int) {
 	c.killAt = c.killAt.Add(time.Minute * time.Duration(minutes))
 }
 
-func (p *ConnectionPool) Close(hostname string, force bool) error {
-	conn, exists := Pool[hostname]
+// Close closes the Connection with the key. See Server.PoolKey.
+func (p *ConnectionPool) Close(key string, force bool) error {
+	poolMu.Lock()
+	conn, exists := Pool[key]
+	poolMu.Unlock()
 	if !exists {
 		return nil
 	}
@@ -88,7 +132,9 @@ func (p *ConnectionPool) Close(hostname string, force bool) error {
 // Close closes the connection and removes it from the Pool. If the connection is not in the
 // Pool, Close will return an error and will NOT try to close the connection.
 func (c *Connection) Close(force bool) error {
-	_, exists := Pool[c.Hostname]
+	poolMu.Lock()
+	_, exists := Pool[c.PoolKey()]
+	poolMu.Unlock()
 	if !exists {
 		return errors.New("connections.Connection.Close: Connection not found in Pool")
 	}
@@ -98,26 +144,60 @@ func (c *Connection) Close(force bool) error {
 		return err
 	}
 
-	delete(Pool, c.Hostname)
+	poolMu.Lock()
+	delete(Pool, c.PoolKey())
+	poolMu.Unlock()
 	return err
 }
 
 // CloseAll will force close all connections in the ConnectionPool. This means it will try to close
-// the connection if it it has an active session.
+// the connection if it it has an active session. Connections tunneled through a jump host are
+// closed before the jump host.
 func (p ConnectionPool) CloseAll() error {
 	var errs error
-	for _, c := range p {
-		err := c.Close(true)
-		if err != nil {
-			errs = errors.Join(errs, fmt.Errorf("connections.ConnectionPool.CloseAll: %s", err))
+	for p.Count() > 0 {
+		// Close a copy of the connections since Close removes them from the Pool.
+		poolMu.Lock()
+		conns := make([]*Connection, 0, len(p))
+		for _, c := range p {
+			conns = append(conns, c)
 		}
+		poolMu.Unlock()
+
+		// Once only jump hosts are left, nothing in the Pool depends on them so close them anyway.
+		onlyJumps := true
+		for _, c := range conns {
+			if !c.isJumpHost() {
+				onlyJumps = false
+				break
+			}
+		}
+
+		for _, c := range conns {
+			if c.isJumpHost() && !onlyJumps {
+				continue
+			}
 
-		delete(p, c.Hostname)
+			err := c.Close(true)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("connections.ConnectionPool.CloseAll: %s", err))
+			}
+
+			poolMu.Lock()
+			delete(p, c.PoolKey())
+			poolMu.Unlock()
+		}
 	}
 
 	return errs
 }
 
+// isJumpHost returns true if other connections are tunneled through this one.
+func (c *Connection) isJumpHost() bool {
+	sc, ok := c.Connector.(*SSHConnector)
+	return ok && sc.tunnelCount() > 0
+}
+
 // TimeOut checks the connection to see if it is passed its killAt time. If so it will attempt to
 // close the connection. If a connection is active TimeOut will extend the killAt time by the TTL.
 func (c *Connection) TimeOut() error {
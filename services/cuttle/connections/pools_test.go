@@ -30,7 +30,7 @@ func TestPoolsOpen(t *testing.T) {
 		require.True(time.Now().Before(pConn.killAt), "killAt was before time.Now()")
 
 		conn.isConnected = false
-		delete(Pool, server.Hostname)
+		delete(Pool, server.PoolKey())
 	})
 
 	t.Run("already open", func(t *testing.T) {
@@ -41,8 +41,34 @@ func TestPoolsOpen(t *testing.T) {
 		require.NoError(err, "Pool.Open() returned an error: ", err)
 		require.Equal(pConn, pConn2, "Connection refs were not the same")
 
+		// Another copy of the server runs over the pooled Connector.
+		other := server
+		other.Connector = conn.Clone()
+		_, err = Pool.Open(&other)
+		require.NoError(err, "Pool.Open() returned an error: ", err)
+		require.Same(&conn, other.Connector, "pooled Connector was not used")
+
+		conn.isConnected = false
+		delete(Pool, server.PoolKey())
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		_, err := Pool.Open(&server)
+		require.NoError(err, "Pool.Open() returned an error: ", err)
+
+		// A Connector for another user on the same host gets its own Connection.
+		otherConn := MockConnector{user: "other"}
+		other := server
+		other.Connector = &otherConn
+		_, err = Pool.Open(&other)
+		require.NoError(err, "Pool.Open() returned an error: ", err)
+		require.Same(&otherConn, other.Connector, "pooled Connector was used for another user")
+		require.Equal(2, Pool.Count(), "Pool did not hold a Connection per user")
+		require.Same(&otherConn, Pool.GetConnection(other).Connector, "Connection did not match")
+
 		conn.isConnected = false
-		delete(Pool, server.Hostname)
+		delete(Pool, server.PoolKey())
+		delete(Pool, other.PoolKey())
 	})
 
 	t.Run("empty connector", func(t *testing.T) {
@@ -57,7 +83,7 @@ func TestPoolsOpen(t *testing.T) {
 		require.Error(err, "Pool.Open() returned an error: ", err)
 
 		conn.isConnected = false
-		delete(Pool, server.Hostname)
+		delete(Pool, server.PoolKey())
 	})
 }
 
@@ -77,13 +103,13 @@ func TestPoolsGetConnection(t *testing.T) {
 	}
 
 	t.Run("existing connection", func(t *testing.T) {
-		Pool = ConnectionPool{server.Hostname: &Connection{Server: &server}}
+		Pool = ConnectionPool{server.PoolKey(): &Connection{Server: &server}}
 
 		got := Pool.GetConnection(server)
 		require.NotNil(got, "Pool.GetConnection() returned nil Connection")
 
 		conn.isConnected = false
-		delete(Pool, server.Hostname)
+		delete(Pool, server.PoolKey())
 	})
 
 	t.Run("no connection", func(t *testing.T) {
@@ -203,13 +229,13 @@ func TestPoolsConnectionClose(t *testing.T) {
 
 	t.Run("session active", func(t *testing.T) {
 		pConn := Connection{Server: &server}
-		Pool = ConnectionPool{server.Hostname: &pConn}
+		Pool = ConnectionPool{server.PoolKey(): &pConn}
 		conn.isConnected = true
 		conn.hasSession = true
 
 		err := pConn.Close(false)
 		require.Error(err, "Connection.Close() did not return an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.True(ok, "Connection not found after failed Pool.Close()")
 
 		conn.hasSession = false
@@ -217,13 +243,13 @@ func TestPoolsConnectionClose(t *testing.T) {
 
 	t.Run("connection close error", func(t *testing.T) {
 		pConn := Connection{Server: &server}
-		Pool = ConnectionPool{server.Hostname: &pConn}
+		Pool = ConnectionPool{server.PoolKey(): &pConn}
 		conn.isConnected = true
 		conn.connCloseErr = true
 
 		err := pConn.Close(false)
 		require.Error(err, "Connection.Close() did not return an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection found after Connection.Close()")
 
 		conn.connCloseErr = false
@@ -244,12 +270,12 @@ func TestPoolsConnectionClose(t *testing.T) {
 
 	t.Run("close connection", func(t *testing.T) {
 		pConn := Connection{Server: &server}
-		Pool = ConnectionPool{server.Hostname: &pConn}
+		Pool = ConnectionPool{server.PoolKey(): &pConn}
 		conn.isConnected = true
 
 		err := pConn.Close(false)
 		require.NoError(err, "Connection.Close() returned an error: %s", err)
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection found after close")
 	})
 }
@@ -270,20 +296,20 @@ func TestPoolsConnectionPoolClose(t *testing.T) {
 	}
 
 	pConn := Connection{Server: &server}
-	Pool = ConnectionPool{server.Hostname: &pConn}
+	Pool = ConnectionPool{server.PoolKey(): &pConn}
 	conn.isConnected = true
 
 	t.Run("close connection", func(t *testing.T) {
-		err := Pool.Close(server.Hostname, false)
+		err := Pool.Close(server.PoolKey(), false)
 		require.NoError(err, "Pool.Close() returned an error: %s", err)
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection found after close")
 	})
 
 	t.Run("no connection", func(t *testing.T) {
-		err := Pool.Close(server.Hostname, false)
+		err := Pool.Close(server.PoolKey(), false)
 		require.NoError(err, "Pool.Close() returned an error: %s", err)
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection found after close")
 	})
 }
@@ -304,7 +330,7 @@ func createPool(count int) {
 		}
 
 		pConn := Connection{Server: &server}
-		Pool[server.Hostname] = &pConn
+		Pool[server.PoolKey()] = &pConn
 		conn.isConnected = true
 	}
 }
@@ -315,7 +341,7 @@ func TestPoolsCloseAll(t *testing.T) {
 	createPool(hostCount)
 
 	t.Run("connection error", func(t *testing.T) {
-		Pool["host4"].Server.Connector.(*MockConnector).connCloseErr = true
+		Pool[testUser+"@host4"].Server.Connector.(*MockConnector).connCloseErr = true
 
 		require.Equal(hostCount, Pool.Count(), "Pool connection count did not matched expected amount")
 		err := Pool.CloseAll()
@@ -347,13 +373,13 @@ func TestPoolsTimeOut(t *testing.T) {
 	}
 
 	pConn := Connection{Server: &server, killAt: time.Now().Add(time.Minute * time.Duration(TTL))}
-	Pool = ConnectionPool{server.Hostname: &pConn}
+	Pool = ConnectionPool{server.PoolKey(): &pConn}
 	conn.isConnected = true
 
 	t.Run("not expired", func(t *testing.T) {
 		err := pConn.TimeOut()
 		require.NoError(err, "Connection.TimeOut() returned an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.True(ok, "Connection not found in Pool")
 	})
 
@@ -364,7 +390,7 @@ func TestPoolsTimeOut(t *testing.T) {
 
 		err := pConn.TimeOut()
 		require.Error(err, "Connection.TimeOut() did not return an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.True(ok, "Connection not found in Pool")
 
 		conn.hasSession = false
@@ -375,18 +401,18 @@ func TestPoolsTimeOut(t *testing.T) {
 
 		err := pConn.TimeOut()
 		require.Error(err, "Connection.TimeOut() returned an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection not found in Pool")
 
 		conn.connCloseErr = false
 	})
 
-	Pool = ConnectionPool{server.Hostname: &pConn}
+	Pool = ConnectionPool{server.PoolKey(): &pConn}
 	conn.isConnected = true
 	t.Run("expired", func(t *testing.T) {
 		err := pConn.TimeOut()
 		require.NoError(err, "Connection.TimeOut() returned an error")
-		_, ok := Pool[server.Hostname]
+		_, ok := Pool[server.PoolKey()]
 		require.False(ok, "Connection found in Pool")
 	})
 }
@@ -9,16 +9,20 @@ import (
 	"strconv"
 
 	validator "github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
 )
 
 var validate = validator.New()
 
 type Server struct {
+	ID       string // Stable identifier. Kept when the server is renamed or readdressed. See SetID.
 	Name     string
 	Hostname string
 	IP       net.IP
 	Port     int
 	UseIP    bool
+	Labels   map[string]string // Used by Group selectors. (env=prod, role=db) See SetLabel.
 	Connector
 	Buffers
 }
@@ -27,7 +31,7 @@ type Server struct {
 // be used for results and logs output. If port is set to 0, the default port for the Connector
 // will always be used.
 func NewServer(hostname string, port int, results, logs *bytes.Buffer) (Server, error) {
-	s := Server{}
+	s := Server{ID: uuid.NewString()}
 	if err := s.SetHostname(hostname); err != nil {
 		return s, err
 	}
@@ -75,6 +79,28 @@ func (s Server) Validate() error {
 // See Connector.Run() for more details.
 func (s Server) Run(cmd, exp string) error { return s.Connector.Run(s.Buffers, cmd, exp) }
 
+// RunAs passes cmd and exp on to the Connector to be executed as another user. Returns
+// ErrEscalationNotSupported if the Connector does not implement Escalator. See Escalator.RunAs().
+func (s Server) RunAs(esc Escalation, cmd, exp string) error {
+	e, ok := s.Connector.(Escalator)
+	if !ok {
+		return fmt.Errorf("profiles.Server.RunAs: %w: %s", ErrEscalationNotSupported, s.Connector.Protocol())
+	}
+
+	return e.RunAs(s.Buffers, esc, cmd, exp)
+}
+
+// WithSFTP passes fn on to the Connector to be ran with an SFTP client. Returns ErrSFTPNotSupported
+// if the Connector does not implement SFTPConnector.
+func (s Server) WithSFTP(fn func(client *sftp.Client) error) error {
+	c, ok := s.Connector.(SFTPConnector)
+	if !ok {
+		return fmt.Errorf("profiles.Server.WithSFTP: %w: %s", ErrSFTPNotSupported, s.Connector.Protocol())
+	}
+
+	return c.WithSFTP(s.Buffers, fn)
+}
+
 // TestConnection tries to open a connection to the server and sends an echo command to validate
 // connectivity and basic access.
 func (s Server) TestConnection() error {
@@ -85,6 +111,17 @@ func (s Server) TestConnection() error {
 	return s.Connector.TestConnection(s.Buffers)
 }
 
+// PoolKey returns the key of the Server's Connection in the Pool. Connections are pooled by user
+// and hostname so Connectors for other users on the same host get their own Connection.
+// Returns "user@hostname" or "hostname" if the Server has no Connector or user.
+func (s Server) PoolKey() string {
+	if s.Connector == nil || s.Connector.GetUser() == "" {
+		return s.Hostname
+	}
+
+	return s.Connector.GetUser() + "@" + s.Hostname
+}
+
 // GetAddr returns the host address to use, without a port. Returns "hostname" or "ip".
 func (s Server) GetHostAddr() string {
 	host := s.Hostname
@@ -114,6 +151,26 @@ func (s Server) GetAddr() string {
 // should be used instead of the hostname for connecting to the server.
 func (s *Server) SetUseIP(flag bool) { s.UseIP = flag }
 
+// GetID returns Server.ID, or Server.Name for servers which were not created by NewServer and
+// have no ID.
+func (s Server) GetID() string {
+	if s.ID == "" {
+		return s.Name
+	}
+
+	return s.ID
+}
+
+// SetID sets the stable identifier of the server. Use it to restore an ID which was stored.
+func (s *Server) SetID(id string) error {
+	if id == "" {
+		return errors.New("profiles.Server.SetID: id was empty")
+	}
+
+	s.ID = id
+	return nil
+}
+
 // SetName sets the display name for the server.
 func (s *Server) SetName(name string) error {
 	// INCOMPLETE: Add verification to prevent escape character and other exploits.
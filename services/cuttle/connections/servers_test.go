@@ -95,6 +95,7 @@ func TestServersNewServer(t *testing.T) {
 		require.Equal(testServerWants["good"].Hostname, server.Hostname, "hostname did not match")
 		require.Equal(testServerWants["good"].Hostname, server.Name, "name did not match")
 		require.Equal(testServerWants["good"].Port, server.Port, "port did not match")
+		require.NotEmpty(server.ID, "ID was not set")
 	})
 
 	t.Run("bad hostname", func(t *testing.T) {
@@ -253,6 +254,15 @@ func TestServersGetAddr(t *testing.T) {
 	})
 }
 
+func TestServersPoolKey(t *testing.T) {
+	require := require.New(t)
+	server := Server{Hostname: testHost}
+	require.Equal(testHost, server.PoolKey(), "PoolKey() did not match without a Connector")
+
+	server.Connector = &MockConnector{user: testUser}
+	require.Equal(testUser+"@"+testHost, server.PoolKey(), "PoolKey() did not match")
+}
+
 func TestServersSetUseIP(t *testing.T) {
 	require := require.New(t)
 	server := testNewServer("good")
@@ -269,6 +279,18 @@ func TestServersSetUseIP(t *testing.T) {
 	})
 }
 
+func TestServersSetID(t *testing.T) {
+	require := require.New(t)
+
+	server := testNewServer("good")
+	require.Equal(server.Name, server.GetID(), "GetID() did not fall back to the name")
+	require.NoError(server.SetID("web-1"), "SetID() returned an error")
+	require.Equal("web-1", server.GetID(), "GetID() did not match")
+	require.NoError(server.SetName("renamed"), "SetName() returned an error")
+	require.Equal("web-1", server.GetID(), "ID changed when the server was renamed")
+	require.Error(server.SetID(""), "SetID() did not return an error")
+}
+
 func TestServersSetName(t *testing.T) {
 	require := require.New(t)
 
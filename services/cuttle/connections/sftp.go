@@ -0,0 +1,39 @@
+package connections
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pkg/sftp"
+)
+
+var ErrSFTPNotSupported = errors.New("connector does not support sftp")
+
+// SFTPConnector is implemented by Connectors that can open an SFTP client over their connection.
+type SFTPConnector interface {
+	// WithSFTP opens an SFTP client, passes it to fn, and closes it once fn returns. The connection
+	// is marked active while fn runs so the Pool will not close it out from under the client.
+	// Errors are returned and not printed to bufs so the caller can print a single result.
+	WithSFTP(bufs Buffers, fn func(client *sftp.Client) error) error
+}
+
+// WithSFTP opens an SFTP client over the existing SSH connection. See SFTPConnector.WithSFTP().
+func (c *SSHConnector) WithSFTP(bufs Buffers, fn func(client *sftp.Client) error) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	// The error is only returned. The caller prints the result so the test shows a single line.
+	client, err := sftp.NewClient(c.Client)
+	if err != nil {
+		return fmt.Errorf("connections.SSHConnector.WithSFTP: %w", err)
+	}
+
+	c.addSessions(1)
+	defer func() {
+		client.Close()
+		c.addSessions(-1)
+	}()
+
+	return fn(client)
+}
@@ -0,0 +1,33 @@
+package connections
+
+import (
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHConnectorWithSFTP(t *testing.T) {
+	require := require.New(t)
+	sshd := test_helpers.NewSSHServer(t, testUser, string(testPass))
+	server := testSSHDServer(t, sshd, "127.0.0.1")
+	conn := server.Connector.(*SSHConnector)
+	require.NoError(conn.Open(server.GetAddr(), server.Buffers), "SSHConnector.Open() returned an error")
+
+	t.Run("good", func(t *testing.T) {
+		err := server.WithSFTP(func(client *sftp.Client) error {
+			_, err := client.Getwd()
+			return err
+		})
+		require.NoError(err, "Server.WithSFTP() returned an error: %s", err)
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		// Close the client out from under the connector so the sftp subsystem cannot be started.
+		conn.Client.Close()
+		err := server.WithSFTP(func(client *sftp.Client) error { return nil })
+		require.Error(err, "Server.WithSFTP() did not return an error")
+		require.Empty(server.Results.String(), "Server.WithSFTP() printed a result")
+	})
+}
@@ -2,9 +2,12 @@ package connections
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -15,16 +18,33 @@ const (
 	SSHProtocol    = SSH
 )
 
+var (
+	ErrJumpNotSSH = errors.New("jump server does not use an SSHConnector")
+	ErrJumpLoop   = errors.New("jump chain loops back on itself")
+)
+
+// tunnelMu guards SSHConnector.tunnels since servers tunneled through the same jump host open and
+// close at the same time.
+var tunnelMu sync.Mutex
+
+// sessionMu guards SSHConnector.isConnected and SSHConnector.sessions since copies of a server
+// share the pooled Connector and run commands at the same time.
+var sessionMu sync.Mutex
+
 // SSHConnector impletments the Connector interface for SSH connectivity.
 type SSHConnector struct {
 	Name        string           // A unique name for the connector to make it easier to add to a server.
 	isConnected bool             // Track if we have an active connection to the server.
-	hasSession  bool             // Indicates there's an active session so we don't close the connection on it.
+	sessions    int              // Number of open sessions so we don't close the connection on them.
 	Auth        []ssh.AuthMethod // Each auth method will be tried in turn until one works or all fail.
 	// AuthMethods []AuthMethod     // A list of AuthMethods to be used for authentication.
-	User string // The username to login to the server with.
+	AuthRefs []string      // Names of the AuthMethods added with AddAuthMethod. Exported instead of secrets.
+	User     string        // The username to login to the server with.
+	Jump     *Server       // Optional jump host (bastion) to tunnel the connection through.
+	jumpConn *SSHConnector // The jump Connector we tunneled through so Close can release it.
+	tunnels  int           // Number of connections currently tunneled through this connector.
+	agents   []*agentConn  // Connections to ssh-agents used by Auth. Closed by Close.
 	*ssh.Client
-	*ssh.Session
 }
 
 // NewSSHConnector creates an SSHConnector struct to be used to connect via SSH to a server.
@@ -60,6 +80,61 @@ func (c *SSHConnector) SetUser(username string) error {
 	return nil
 }
 
+// SetJump sets a jump host (bastion) to tunnel through when opening a connection. The jump server
+// must use an SSHConnector and may have its own jump host set to chain multiple hops.
+func (c *SSHConnector) SetJump(jump *Server) error {
+	if jump == nil {
+		return fmt.Errorf("connections.SSHConnector.SetJump: jump was nil")
+	}
+
+	if err := checkJumpChain(c, jump); err != nil {
+		return fmt.Errorf("connections.SSHConnector.SetJump: %w", err)
+	}
+
+	c.Jump = jump
+	return nil
+}
+
+// checkJumpChain walks the chain starting at jump to make sure every hop is ssh and it never loops
+// back on c or itself.
+func checkJumpChain(c *SSHConnector, jump *Server) error {
+	seen := map[*SSHConnector]bool{c: true}
+	for j := jump; j != nil; {
+		jc, ok := j.Connector.(*SSHConnector)
+		if !ok {
+			return fmt.Errorf("%s: %w", j.Hostname, ErrJumpNotSSH)
+		}
+
+		if seen[jc] {
+			return fmt.Errorf("%s: %w", j.Hostname, ErrJumpLoop)
+		}
+
+		seen[jc] = true
+		j = jc.Jump
+	}
+
+	return nil
+}
+
+// ClearJump removes the jump host so the connection is dialed directly.
+func (c *SSHConnector) ClearJump() { c.Jump = nil }
+
+// JumpChain returns the hostnames of the jump hosts in the order they are connected through.
+func (c *SSHConnector) JumpChain() []string {
+	var chain []string
+	for j := c.Jump; j != nil; {
+		chain = append([]string{j.Hostname}, chain...)
+		jc, ok := j.Connector.(*SSHConnector)
+		if !ok {
+			break
+		}
+
+		j = jc.Jump
+	}
+
+	return chain
+}
+
 // AddPasswordAuth adds an AuthMethod using a password.
 func (c *SSHConnector) AddPasswordAuth(password string) {
 	c.Auth = append(c.Auth, ssh.Password(password))
@@ -75,6 +150,37 @@ func (c *SSHConnector) AddKeyAuth(key ssh.Signer) error {
 	return nil
 }
 
+// AddAuthMethod converts the AuthMethod into an ssh.AuthMethod and adds it. passphrase is used to
+// decrypt keys and is ignored by auth types that do not need it.
+func (c *SSHConnector) AddAuthMethod(a AuthMethod, passphrase []byte) error {
+	if a.Proto != SSH {
+		return fmt.Errorf("connections.SSHConnector.AddAuthMethod: %s: %w", a.Name, ErrInvalidAuthType)
+	}
+
+	// Keep the agent connection so Close can release it.
+	if a.AuthType == AuthSSHAgent {
+		ac, err := a.agent()
+		if err != nil {
+			return fmt.Errorf("connections.SSHConnector.AddAuthMethod: %w", err)
+		}
+
+		ac.auth = len(c.Auth)
+		c.agents = append(c.agents, ac)
+		c.Auth = append(c.Auth, ssh.PublicKeysCallback(ac.Signers))
+		c.AuthRefs = append(c.AuthRefs, a.Name)
+		return nil
+	}
+
+	am, err := a.ToSSHAuthMethod(passphrase)
+	if err != nil {
+		return fmt.Errorf("connections.SSHConnector.AddAuthMethod: %w", err)
+	}
+
+	c.Auth = append(c.Auth, am)
+	c.AuthRefs = append(c.AuthRefs, a.Name)
+	return nil
+}
+
 // ParseKey parses the private key into a key signer and sends it to SSHConnector.AddKeyAuth().
 func (c *SSHConnector) ParseKey(privateKey []byte) error {
 	if privateKey == nil || len(privateKey) < 1 {
@@ -130,65 +236,107 @@ func (c *SSHConnector) GenerateAuth() error {
 }
 */
 
-// OpenSession creates a new single command session.
-func (c *SSHConnector) OpenSession(bufs Buffers) error {
+// OpenSession creates a new single command session. Each command gets its own session so copies
+// of a server sharing the connection can run at the same time. Close it with CloseSession.
+func (c *SSHConnector) OpenSession(bufs Buffers) (*ssh.Session, error) {
 	// log.Print(" - Creating session...")
-	if !c.isConnected {
-		return ErrNotConnected
+	if !c.IsConnected() {
+		return nil, ErrNotConnected
 	}
 
 	sess, err := c.NewSession()
 	if err != nil {
 		bufs.Log(time.Now(), err.Error())
 		bufs.PrintResults(time.Now(), "error", err)
-		return err
+		return nil, err
 	}
 
-	c.hasSession = true
-	c.Session = sess
+	c.addSessions(1)
 	// log.Print("done.\n")
-	return nil
+	return sess, nil
 }
 
-// CloseSession closes an open session.
-func (c *SSHConnector) CloseSession() error {
-	// If hasSession is false and there's not Session ref then we have nothing to do.
-	if !c.hasSession && c.Session == nil {
-		return nil
-	}
-
-	c.hasSession = false
-	if c.Session == nil {
+// CloseSession closes a session opened with OpenSession.
+func (c *SSHConnector) CloseSession(sess *ssh.Session) error {
+	if sess == nil {
 		return fmt.Errorf("connections.SSHConnector.CloseSession: no session avaiable")
 	}
 
-	return c.Session.Close()
+	c.addSessions(-1)
+	return sess.Close()
+}
+
+// addSessions adds n to the number of open sessions.
+func (c *SSHConnector) addSessions(n int) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	c.sessions = max(c.sessions+n, 0)
+}
+
+// sessionCount returns the number of open sessions.
+func (c *SSHConnector) sessionCount() int {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return c.sessions
+}
+
+// setConnected sets whether the connection is open.
+func (c *SSHConnector) setConnected(connected bool) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	c.isConnected = connected
 }
 
-// foundExpect returns true if expect matches anywhere in the byte array.
+// foundExpect returns true if expect matches the byte array. See ParseExpect for the expect format.
 func foundExpect(data []byte, expect string) bool {
-	matched, err := regexp.MatchString(expect, string(data))
+	e, err := ParseExpect(expect)
 	if err != nil {
 		log.Printf("connections.SSHConnector.foundExpect: %s", err)
+		return false
 	}
 
-	return matched
-	// m := bytes.Index(data, []byte(expect))
-	// return m > -1
+	return MatchExpect(e, data)
 }
 
 //						//
 //	Connector Interface Implementation	//
 //						//
 
-func (c *SSHConnector) IsConnected() bool  { return c.isConnected }
-func (c *SSHConnector) IsActive() bool     { return c.hasSession }
+func (c *SSHConnector) IsConnected() bool {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return c.isConnected
+}
+
+func (c *SSHConnector) IsActive() bool     { return c.sessionCount() > 0 || c.tunnelCount() > 0 }
 func (c *SSHConnector) Protocol() Protocol { return SSHProtocol }
 func (c *SSHConnector) GetUser() string    { return c.User }
 func (c *SSHConnector) DefaultPort() int   { return SSHDefaultPort }
 func (c *SSHConnector) IsEmpty() bool      { return c.User == "" }
 func (c *SSHConnector) IsValid() bool      { err := c.Validate(); return err == nil }
 
+// Clone returns a copy of the settings without the connection. The auth methods and the Jump
+// server are shared. Each clone gets its own ssh-agent connections so closing one clone does not
+// close the agent for the others.
+func (c *SSHConnector) Clone() Connector {
+	clone := &SSHConnector{
+		Name:     c.Name,
+		Auth:     slices.Clone(c.Auth),
+		AuthRefs: slices.Clone(c.AuthRefs),
+		User:     c.User,
+		Jump:     c.Jump,
+	}
+
+	for _, ac := range c.agents {
+		// Dialed by Signers the first time the clone authenticates.
+		nac := &agentConn{socket: ac.socket, auth: ac.auth}
+		clone.agents = append(clone.agents, nac)
+		clone.Auth[nac.auth] = ssh.PublicKeysCallback(nac.Signers)
+	}
+
+	return clone
+}
+
 func (c SSHConnector) Validate() error {
 	if c.User == "" {
 		return ErrInvalidEmtpyUser
@@ -198,6 +346,17 @@ func (c SSHConnector) Validate() error {
 		return ErrInvalidNoAuthMethod
 	}
 
+	if c.Jump != nil {
+		// Check the chain first since a loop set through the Jump field would never stop recursing.
+		if err := checkJumpChain(&c, c.Jump); err != nil {
+			return err
+		}
+
+		if err := c.Jump.Validate(); err != nil {
+			return fmt.Errorf("jump %s: %w", c.Jump.Hostname, err)
+		}
+	}
+
 	return nil
 }
 
@@ -212,20 +371,68 @@ func (c *SSHConnector) Open(addr string, bufs Buffers) error {
 	}
 
 	// log.Print("Dialing server...")
-	client, err := ssh.Dial("tcp", addr, config)
+	var client *ssh.Client
+	var err error
+	if c.Jump == nil {
+		client, err = ssh.Dial("tcp", addr, config)
+	} else {
+		client, err = c.dialJump(addr, config, bufs)
+	}
 	if err != nil {
 		bufs.Log(time.Now(), err.Error())
 		bufs.PrintResults(time.Now(), "error", err)
 		return err
 	}
 
-	c.isConnected = true
 	c.Client = client
+	c.setConnected(true)
 	// log.Print("done.")
 	// INCOMPLETE: Add a keepalive later. Make sure keepalive is cancelled when the connection is closed.
 	return nil
 }
 
+// dialJump opens the jump host through the Pool, so tunnels to multiple servers share a single
+// connection to the bastion, and then dials addr through it.
+func (c *SSHConnector) dialJump(addr string, config *ssh.ClientConfig, bufs Buffers) (*ssh.Client, error) {
+	chain := strings.Join(append(c.JumpChain(), addr), " -> ")
+	bufs.Log(time.Now(), fmt.Sprintf("connecting via %s", chain))
+
+	jconn, err := Pool.Open(c.Jump)
+	if err != nil {
+		return nil, fmt.Errorf("connections.SSHConnector.Open: jump %s: %w", c.Jump.Hostname, err)
+	}
+
+	// Use the Connector from the Pool since the connection may have been opened by another Server.
+	jc, ok := jconn.Connector.(*SSHConnector)
+	if !ok {
+		return nil, fmt.Errorf("connections.SSHConnector.Open: %s: %w", c.Jump.Hostname, ErrJumpNotSSH)
+	}
+
+	conn, err := jc.Client.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connections.SSHConnector.Open: %s: %w", chain, err)
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connections.SSHConnector.Open: %s: %w", chain, err)
+	}
+
+	tunnelMu.Lock()
+	jc.tunnels++
+	tunnelMu.Unlock()
+	c.jumpConn = jc
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// tunnelCount returns the number of connections currently tunneled through c.
+func (c *SSHConnector) tunnelCount() int {
+	tunnelMu.Lock()
+	defer tunnelMu.Unlock()
+	return c.tunnels
+}
+
 func (c *SSHConnector) TestConnection(bufs Buffers) error {
 	expect := "cuttle ok"
 	return c.run(bufs, fmt.Sprintf("echo '%s'", expect), expect)
@@ -240,25 +447,27 @@ func (c *SSHConnector) run(bufs Buffers, cmd string, exp string) error {
 		return ErrEmtpyCmd
 	}
 
-	if exp == "" {
-		return ErrEmtpyExp
+	// Parse exp before running anything so a bad expect never reaches the server.
+	expect, err := ParseExpect(exp)
+	if err != nil {
+		return err
 	}
 
-	err := c.OpenSession(bufs)
+	sess, err := c.OpenSession(bufs)
 	if err != nil {
 		return err
 	}
 
 	// We have to close the session each time or it will block further command execution.
-	defer c.CloseSession()
+	defer c.CloseSession(sess)
 
 	// Set ssh.Session.Stdout so we capture the output
 	var b bytes.Buffer
-	c.Session.Stdout = &b
+	sess.Stdout = &b
 	eventTime := time.Now()
 
 	// log.Print("   - Running cmd...")
-	err = c.Session.Run(cmd)
+	err = sess.Run(cmd)
 	if err != nil {
 		bufs.Log(eventTime, err.Error())
 		bufs.PrintResults(eventTime, "error", err)
@@ -270,10 +479,85 @@ func (c *SSHConnector) run(bufs Buffers, cmd string, exp string) error {
 	bufs.Log(eventTime, b.String())
 
 	// Match results to the expected results and print
-	ok := foundExpect(b.Bytes(), exp)
+	ok := MatchExpect(expect, b.Bytes())
 	if !ok {
 		bufs.PrintResults(eventTime, "failed", nil)
-		return nil
+		return fmt.Errorf("connections.SSHConnector.Run: %w: %s", ErrExpectMismatch, exp)
+	}
+
+	bufs.PrintResults(eventTime, "ok", nil)
+	return nil
+}
+
+// RunAs runs cmd as esc.User by wrapping it in sudo or su. A PTY is requested since su and some
+// sudoers configs (requiretty) will not prompt without one. The password from esc.Password is sent
+// when the prompt is seen and is redacted from anything written to bufs. If the prompt shows up a
+// second time the password was rejected and ErrEscalationFailed is returned.
+func (c *SSHConnector) RunAs(bufs Buffers, esc Escalation, cmd string, exp string) error {
+	if cmd == "" {
+		return ErrEmtpyCmd
+	}
+
+	if err := esc.Validate(); err != nil {
+		return err
+	}
+
+	expect, err := ParseExpect(exp)
+	if err != nil {
+		return err
+	}
+
+	sess, err := c.OpenSession(bufs)
+	if err != nil {
+		return err
+	}
+	defer c.CloseSession(sess)
+
+	eventTime := time.Now()
+	// Turn off echo so the password is not sent back to us. It is still redacted below in case the
+	// remote ignores the mode.
+	modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err := sess.RequestPty("xterm", 40, 200, modes); err != nil {
+		bufs.Log(eventTime, err.Error())
+		bufs.PrintResults(eventTime, "error", err)
+		return err
+	}
+
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		bufs.Log(eventTime, err.Error())
+		bufs.PrintResults(eventTime, "error", err)
+		return err
+	}
+
+	out := &promptWriter{
+		prompt:   esc.prompt(),
+		stdin:    stdin,
+		password: esc.Password.Data,
+		abort:    func() { sess.Close() },
+	}
+	// A PTY merges stderr into stdout so there is only one stream to watch for the prompt.
+	sess.Stdout = out
+
+	bufs.Log(eventTime, fmt.Sprintf("running as %s", esc))
+	err = sess.Run(esc.Wrap(cmd))
+	if out.Failed() {
+		err = fmt.Errorf("connections.SSHConnector.RunAs: %w: %s", ErrEscalationFailed, esc)
+	}
+
+	if err != nil {
+		bufs.Log(eventTime, out.Output())
+		bufs.Log(eventTime, Redact(err.Error(), esc.Password.Data))
+		bufs.PrintResults(eventTime, "error", err)
+		return err
+	}
+
+	bufs.Log(eventTime, out.Output())
+
+	ok := MatchExpect(expect, []byte(out.Output()))
+	if !ok {
+		bufs.PrintResults(eventTime, "failed", nil)
+		return fmt.Errorf("connections.SSHConnector.RunAs: %w: %s", ErrExpectMismatch, exp)
 	}
 
 	bufs.PrintResults(eventTime, "ok", nil)
@@ -281,16 +565,35 @@ func (c *SSHConnector) run(bufs Buffers, cmd string, exp string) error {
 }
 
 func (c *SSHConnector) Close(force bool) error {
-	if c.hasSession {
-		// If we don't want to foce close the connection return an error.
-		if !force {
-			return ErrSessionActive
-		}
+	// Don't pull the connection out from under servers tunneled through us unless forced.
+	if c.tunnelCount() > 0 && !force {
+		return ErrSessionActive
+	}
+
+	// If we don't want to foce close the connection return an error. Otherwise the open sessions
+	// are closed with the connection.
+	if c.sessionCount() > 0 && !force {
+		return ErrSessionActive
+	}
+
+	// Release our tunnel so the jump host can be closed once nothing else is using it.
+	if c.jumpConn != nil {
+		tunnelMu.Lock()
+		c.jumpConn.tunnels--
+		tunnelMu.Unlock()
+		c.jumpConn = nil
+	}
+
+	c.setConnected(false)
+	var err error
+	// A Connector which was never opened still holds its ssh-agent connections.
+	if c.Client != nil {
+		err = c.Client.Close()
+	}
 
-		// Otherwise force the session closed.
-		c.CloseSession()
+	for _, ac := range c.agents {
+		err = errors.Join(err, ac.Close())
 	}
 
-	c.isConnected = false
-	return c.Client.Close()
+	return err
 }
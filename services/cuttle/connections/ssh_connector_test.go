@@ -2,8 +2,10 @@ package connections
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/chadeldridge/cuttle-server/test_helpers"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ssh"
 )
@@ -210,15 +212,16 @@ func TestSSHConnectorOpenSession(t *testing.T) {
 	require.NoError(err, "SSHConnector.Open() returned an error: %s", err)
 	require.True(conn.isConnected, "failed to open SSHConnector")
 
+	var sess *ssh.Session
 	t.Run("connected", func(t *testing.T) {
-		err := conn.OpenSession(server.Buffers)
+		sess, err = conn.OpenSession(server.Buffers)
 		require.NoError(err, "SSHConnector.OpenSession() returned an error: %s", err)
-		require.True(conn.hasSession, "SSHConnector.hasSession was false")
+		require.Equal(1, conn.sessions, "SSHConnector.sessions did not match")
 	})
 
-	err = conn.CloseSession()
+	err = conn.CloseSession(sess)
 	require.NoError(err, "SSHConnector.CloseSession() returned an error")
-	require.False(conn.hasSession, "failed to close SSHConnector Session")
+	require.Zero(conn.sessions, "failed to close SSHConnector Session")
 
 	err = conn.Close(true)
 	require.NoError(err, "SSHConnector.CloseSession() returned an error", err)
@@ -226,9 +229,9 @@ func TestSSHConnectorOpenSession(t *testing.T) {
 
 	conn = SSHConnector{}
 	t.Run("not connected", func(t *testing.T) {
-		err := conn.OpenSession(server.Buffers)
+		_, err := conn.OpenSession(server.Buffers)
 		require.Error(err, "SSHConnector.OpenSession() did not return an error")
-		require.False(conn.hasSession, "SSHConnector Session openned despite not being connected")
+		require.Zero(conn.sessions, "SSHConnector Session openned despite not being connected")
 	})
 
 	// TODO: Find a way to get ssh.Client.NewSession() to return an error.
@@ -246,34 +249,26 @@ func TestSSHConnectorCloseSession(t *testing.T) {
 	require.NoError(err, "SSHConnector.Open() returned an error: %s", err)
 	require.True(conn.isConnected, "failed to open SSHConnector")
 
-	t.Run("no session", func(t *testing.T) {
-		err = conn.CloseSession()
-		require.NoError(err, "SSHConnector.CloseSession() returned an error: %s", err)
-		require.False(conn.hasSession, "failed to close SSHConnector Session")
-	})
-
-	err = conn.OpenSession(server.Buffers)
+	sess, err := conn.OpenSession(server.Buffers)
 	require.NoError(err, "SSHConnector.OpenSession() returned an error: %s", err)
-	require.True(conn.hasSession, "SSHConnector.hasSession was false")
+	require.Equal(1, conn.sessions, "SSHConnector.sessions did not match")
 
 	t.Run("open session", func(t *testing.T) {
-		err = conn.CloseSession()
+		err = conn.CloseSession(sess)
 		require.NoError(err, "SSHConnector.CloseSession() returned an error")
-		require.False(conn.hasSession, "failed to close SSHConnector Session")
+		require.Zero(conn.sessions, "failed to close SSHConnector Session")
 	})
 
 	t.Run("closed session", func(t *testing.T) {
-		err = conn.CloseSession()
+		err = conn.CloseSession(sess)
 		require.Error(err, "SSHConnector.CloseSession() did not return an error")
-		require.False(conn.hasSession, "failed to close SSHConnector Session")
+		require.Zero(conn.sessions, "failed to close SSHConnector Session")
 	})
 
 	t.Run("nil session", func(t *testing.T) {
-		conn.hasSession = true
-		conn.Session = nil
-		err = conn.CloseSession()
+		err = conn.CloseSession(nil)
 		require.Error(err, "SSHConnector.CloseSession() did not return an error")
-		require.False(conn.hasSession, "failed to close SSHConnector Session")
+		require.Zero(conn.sessions, "failed to close SSHConnector Session")
 	})
 
 	err = conn.Close(true)
@@ -281,6 +276,159 @@ func TestSSHConnectorCloseSession(t *testing.T) {
 	require.False(conn.isConnected, "failed to close SSHConnector")
 }
 
+// testSSHDServer creates a Server, using an SSHConnector, which points at the in-process sshd.
+func testSSHDServer(t *testing.T, sshd *test_helpers.SSHServer, hostname string) *Server {
+	require := require.New(t)
+	conn := testNewSSHConnector()
+	server, err := NewServer(hostname, sshd.Port(), &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "NewServer() returned an error: %s", err)
+	server.User = testUser
+	server.SetConnector(&conn)
+	return &server
+}
+
+func TestSSHConnectorSetJump(t *testing.T) {
+	require := require.New(t)
+	conn := testNewSSHConnector()
+	bastion := testNewSSHConnector()
+	bastionServer := &Server{Hostname: "bastion.home", Connector: &bastion}
+
+	t.Run("nil", func(t *testing.T) {
+		require.Error(conn.SetJump(nil), "SSHConnector.SetJump() did not return an error")
+		require.Nil(conn.Jump, "SSHConnector.Jump was set")
+	})
+
+	t.Run("not ssh", func(t *testing.T) {
+		mock := &Server{Hostname: "mock.home", Connector: &MockConnector{user: testUser}}
+		err := conn.SetJump(mock)
+		require.ErrorIs(err, ErrJumpNotSSH, "SSHConnector.SetJump() did not return ErrJumpNotSSH")
+		require.Nil(conn.Jump, "SSHConnector.Jump was set")
+	})
+
+	t.Run("good", func(t *testing.T) {
+		err := conn.SetJump(bastionServer)
+		require.NoError(err, "SSHConnector.SetJump() returned an error: %s", err)
+		require.Equal(bastionServer, conn.Jump, "SSHConnector.Jump did not match")
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		self := &Server{Hostname: testHost, Connector: &conn}
+		err := bastion.SetJump(self)
+		require.ErrorIs(err, ErrJumpLoop, "SSHConnector.SetJump() did not return ErrJumpLoop")
+		require.Nil(bastion.Jump, "SSHConnector.Jump was set")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		conn.ClearJump()
+		require.Nil(conn.Jump, "SSHConnector.Jump was not cleared")
+	})
+}
+
+func TestSSHConnectorJumpChain(t *testing.T) {
+	require := require.New(t)
+	first := testNewSSHConnector()
+	second := testNewSSHConnector()
+	conn := testNewSSHConnector()
+
+	require.Empty(conn.JumpChain(), "SSHConnector.JumpChain() was not empty")
+
+	require.NoError(second.SetJump(&Server{Hostname: "first.home", Connector: &first}))
+	require.NoError(conn.SetJump(&Server{Hostname: "second.home", Connector: &second}))
+	require.Equal(
+		[]string{"first.home", "second.home"},
+		conn.JumpChain(),
+		"SSHConnector.JumpChain() did not match",
+	)
+}
+
+func TestSSHConnectorOpenJump(t *testing.T) {
+	require := require.New(t)
+	Pool = ConnectionPool{}
+	defer Pool.CloseAll()
+
+	bastionSSHD := test_helpers.NewSSHServerAt(t, "127.0.0.1", testUser, string(testPass))
+	targetSSHD := test_helpers.NewSSHServerAt(t, "127.0.0.2", testUser, string(testPass))
+	bastion := testSSHDServer(t, bastionSSHD, "127.0.0.1")
+
+	t.Run("single hop", func(t *testing.T) {
+		target := testSSHDServer(t, targetSSHD, "127.0.0.2")
+		conn := target.Connector.(*SSHConnector)
+		require.NoError(conn.SetJump(bastion), "SSHConnector.SetJump() returned an error")
+
+		_, err := Pool.Open(target)
+		require.NoError(err, "Pool.Open() returned an error: %s", err)
+		require.Contains(target.Logs.String(), "connecting via 127.0.0.1 -> 127.0.0.2:", "jump chain was not logged")
+		require.Contains(bastionSSHD.Forwards(), targetSSHD.Addr(), "connection was not tunneled through the bastion")
+
+		err = target.Run("echo tunneled", "line:tunneled")
+		require.NoError(err, "Server.Run() returned an error: %s", err)
+		require.Contains(GetLastBufferLine(target.Results), "ok", "Server.Run() did not match")
+
+		// The bastion should refuse to close while a tunnel is using it.
+		bconn := Pool.GetConnection(*bastion)
+		require.NotNil(bconn, "bastion was not added to the Pool")
+		require.True(bconn.IsActive(), "bastion was not active with an open tunnel")
+		require.ErrorIs(bconn.Close(false), ErrSessionActive, "bastion closed with an open tunnel")
+
+		require.NoError(Pool.Close(target.PoolKey(), false), "Pool.Close() returned an error")
+		require.False(bconn.IsActive(), "bastion was still active after the tunnel closed")
+		require.NoError(Pool.Close(bastion.PoolKey(), false), "Pool.Close() returned an error")
+		require.Zero(Pool.Count(), "Pool was not empty")
+	})
+
+	t.Run("reuse bastion", func(t *testing.T) {
+		other := test_helpers.NewSSHServerAt(t, "127.0.0.3", testUser, string(testPass))
+		first := testSSHDServer(t, targetSSHD, "127.0.0.2")
+		second := testSSHDServer(t, other, "127.0.0.3")
+		require.NoError(first.Connector.(*SSHConnector).SetJump(bastion))
+		require.NoError(second.Connector.(*SSHConnector).SetJump(bastion))
+
+		logins := bastionSSHD.Logins()
+		_, err := Pool.Open(first)
+		require.NoError(err, "Pool.Open() returned an error: %s", err)
+		_, err = Pool.Open(second)
+		require.NoError(err, "Pool.Open() returned an error: %s", err)
+		require.Equal(logins+1, bastionSSHD.Logins(), "bastion connection was not reused")
+		require.Equal(2, Pool.GetConnection(*bastion).Connector.(*SSHConnector).tunnels, "tunnel count did not match")
+
+		require.NoError(Pool.CloseAll(), "Pool.CloseAll() returned an error")
+	})
+
+	t.Run("chained", func(t *testing.T) {
+		hopSSHD := test_helpers.NewSSHServerAt(t, "127.0.0.3", testUser, string(testPass))
+		hop := testSSHDServer(t, hopSSHD, "127.0.0.3")
+		target := testSSHDServer(t, targetSSHD, "127.0.0.2")
+		require.NoError(hop.Connector.(*SSHConnector).SetJump(bastion))
+		require.NoError(target.Connector.(*SSHConnector).SetJump(hop))
+
+		_, err := Pool.Open(target)
+		require.NoError(err, "Pool.Open() returned an error: %s", err)
+		require.Contains(
+			target.Logs.String(),
+			"connecting via 127.0.0.1 -> 127.0.0.3 -> 127.0.0.2:",
+			"jump chain was not logged",
+		)
+		require.Contains(hopSSHD.Forwards(), targetSSHD.Addr(), "connection was not tunneled through the hop")
+		require.Equal(3, Pool.Count(), "Pool did not hold every hop")
+
+		err = target.Run("echo chained", "contains:chained")
+		require.NoError(err, "Server.Run() returned an error: %s", err)
+		require.NoError(Pool.CloseAll(), "Pool.CloseAll() returned an error")
+	})
+
+	t.Run("bad jump", func(t *testing.T) {
+		bad := testSSHDServer(t, bastionSSHD, "127.0.0.1")
+		bad.Connector.(*SSHConnector).Auth = []ssh.AuthMethod{ssh.Password("wrong")}
+		target := testSSHDServer(t, targetSSHD, "127.0.0.2")
+		require.NoError(target.Connector.(*SSHConnector).SetJump(bad))
+
+		_, err := Pool.Open(target)
+		require.Error(err, "Pool.Open() did not return an error")
+		require.True(strings.Contains(err.Error(), "jump 127.0.0.1"), "error did not name the jump host")
+		require.Zero(Pool.Count(), "Pool was not empty")
+	})
+}
+
 func TestSSHConnectorFoundExpect(t *testing.T) {
 	require := require.New(t)
 	expect := "my test data"
@@ -296,13 +444,10 @@ func TestSSHConnectorFoundExpect(t *testing.T) {
 		require.False(matched, "SSHConnector.foundExpect() matched non-matching data")
 	})
 
-	/*
-		// TODO: Find a way to get regexp.MatchString to return an error.
-		t.Run("non-matching data", func(t *testing.T) {
-			matched := foundExpect(data, "{(si|sa|za|ja|to)}")
-			require.False(matched, "SSHConnector.foundExpect() matched non-matching data")
-		})
-	*/
+	t.Run("invalid expect", func(t *testing.T) {
+		matched := foundExpect(data, "(si|sa|za|ja|to")
+		require.False(matched, "SSHConnector.foundExpect() matched with an invalid expect")
+	})
 }
 
 //							//
@@ -329,12 +474,12 @@ func TestSSHConnectorIsActive(t *testing.T) {
 	conn := testNewSSHConnector()
 
 	t.Run("has session", func(t *testing.T) {
-		conn.hasSession = true
+		conn.sessions = 1
 		require.True(conn.IsActive(), "SSHConnector.IsActive() returned false")
 	})
 
 	t.Run("no session", func(t *testing.T) {
-		conn.hasSession = false
+		conn.sessions = 0
 		require.False(conn.IsActive(), "SSHConnector.IsActive() returned true")
 	})
 }
@@ -404,6 +549,16 @@ func TestSSHConnectorValidate(t *testing.T) {
 		conn := SSHConnector{User: testUser}
 		require.Error(conn.Validate(), "SSHConnector.Validate() did not return an error")
 	})
+
+	t.Run("jump loop", func(t *testing.T) {
+		first := testNewSSHConnector()
+		second := testNewSSHConnector()
+		bufs := Buffers{Results: &bytes.Buffer{}, Logs: &bytes.Buffer{}}
+		// Set Jump directly to skip the check in SetJump.
+		first.Jump = &Server{Hostname: "second.home", Connector: &second, Buffers: bufs}
+		second.Jump = &Server{Hostname: "first.home", Connector: &first, Buffers: bufs}
+		require.ErrorIs(first.Validate(), ErrJumpLoop, "SSHConnector.Validate() did not return ErrJumpLoop")
+	})
 }
 
 func TestSSHConnectorOpen(t *testing.T) {
@@ -486,6 +641,11 @@ func TestSSHConnectorRun(t *testing.T) {
 
 	t.Run("empty exp", func(t *testing.T) {
 		err := conn.Run(server.Buffers, cmd, "")
+		require.NoError(err, "SSHConnector.Run() returned an error: %s", err)
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		err := conn.Run(server.Buffers, cmd, "regex:(unclosed")
 		require.Error(err, "SSHConnector.Run() did not return an error")
 	})
 
@@ -496,7 +656,7 @@ func TestSSHConnectorRun(t *testing.T) {
 
 	t.Run("bad exp", func(t *testing.T) {
 		err := conn.Run(server.Buffers, cmd, "this won't match")
-		require.NoError(err, "SSHConnector.Run() return an error")
+		require.ErrorIs(err, ErrExpectMismatch, "SSHConnector.Run() did not return ErrExpectMismatch")
 		require.Contains(GetLastBufferLine(server.Results), "failed", "SSHConnector.Run() did not fail match")
 	})
 
@@ -509,6 +669,48 @@ func TestSSHConnectorRun(t *testing.T) {
 	})
 }
 
+func TestSSHConnectorRunMismatch(t *testing.T) {
+	require := require.New(t)
+	Pool = ConnectionPool{}
+	defer Pool.CloseAll()
+
+	sshd := test_helpers.NewSSHServer(t, testUser, string(testPass))
+	server := testSSHDServer(t, sshd, "127.0.0.1")
+	_, err := Pool.Open(server)
+	require.NoError(err, "Pool.Open() returned an error: %s", err)
+
+	err = server.Run("echo testing", "line:testing")
+	require.NoError(err, "Server.Run() returned an error: %s", err)
+	require.Contains(GetLastBufferLine(server.Results), "ok", "Server.Run() did not match")
+
+	err = server.Run("echo testing", "line:other")
+	require.ErrorIs(err, ErrExpectMismatch, "Server.Run() did not return ErrExpectMismatch")
+	require.Contains(GetLastBufferLine(server.Results), "failed", "Server.Run() did not print failed")
+}
+
+func TestSSHConnectorClone(t *testing.T) {
+	require := require.New(t)
+	sshd := test_helpers.NewSSHServer(t, testUser, string(testPass))
+	server := testSSHDServer(t, sshd, "127.0.0.1")
+	conn := server.Connector.(*SSHConnector)
+	require.NoError(conn.Open(server.GetAddr(), server.Buffers), "SSHConnector.Open() returned an error")
+	defer conn.Close(true)
+	require.NoError(conn.SetJump(&Server{Hostname: "bastion.home", Connector: &SSHConnector{User: testUser}}))
+
+	clone := conn.Clone().(*SSHConnector)
+	require.False(clone.IsConnected(), "connection was copied")
+	require.Nil(clone.Client, "client was copied")
+	require.Equal(conn.AuthRefs, clone.AuthRefs, "AuthRefs did not match")
+	require.Same(conn.Jump, clone.Jump, "Jump was not copied")
+
+	// The clone gets its own connection and closing it leaves the original open.
+	clone.ClearJump()
+	require.NoError(clone.Open(server.GetAddr(), server.Buffers), "SSHConnector.Open() returned an error")
+	require.NotSame(conn.Client, clone.Client, "clone used the original's client")
+	require.NoError(clone.Close(true), "SSHConnector.Close() returned an error")
+	require.NoError(conn.Run(server.Buffers, "echo testing", "line:testing"), "original connection was closed")
+}
+
 func TestSSHConnectorClose(t *testing.T) {
 	var res bytes.Buffer
 	var log bytes.Buffer
@@ -522,14 +724,14 @@ func TestSSHConnectorClose(t *testing.T) {
 	require.True(conn.isConnected, "failed to open SSHConnector")
 
 	t.Run("has session", func(t *testing.T) {
-		conn.hasSession = true
+		conn.sessions = 1
 		err := conn.Close(false)
 		require.Error(err, "SSHConnector.Close() did not return an error")
 		require.True(conn.isConnected, "SSHConnector.Close() closed a connection with an open session")
 	})
 
 	t.Run("force close", func(t *testing.T) {
-		conn.hasSession = true
+		conn.sessions = 1
 		err := conn.Close(true)
 		require.NoError(err, "SSHConnector.Close() returned an error: %s", err)
 		require.False(conn.isConnected, "failed to close SSHConnector")
@@ -540,14 +742,14 @@ func TestSSHConnectorClose(t *testing.T) {
 	require.True(conn.isConnected, "failed to open SSHConnector")
 
 	t.Run("open connection", func(t *testing.T) {
-		conn.hasSession = false
+		conn.sessions = 0
 		err = conn.Close(false)
 		require.NoError(err, "SSHConnector.Close() returned an error: %s", err)
 		require.False(conn.isConnected, "failed to close SSHConnector")
 	})
 
 	t.Run("closed connection", func(t *testing.T) {
-		conn.hasSession = false
+		conn.sessions = 0
 		err := conn.Close(false)
 		require.Error(err, "SSHConnector.Close() did not return an error")
 		require.False(conn.isConnected, "failed to close SSHConnector")
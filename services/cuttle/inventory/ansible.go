@@ -0,0 +1,355 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"gopkg.in/yaml.v3"
+)
+
+// Ansible groups which are not made into Groups.
+var ansibleImplicitGroups = []string{"all", "ungrouped"}
+
+// ansibleRangeRe matches a numeric host range. "web[01:10].example.com"
+var ansibleRangeRe = regexp.MustCompile(`\[(\d+):(\d+)\]`)
+
+// ansibleGroup is a group read from either inventory format.
+type ansibleGroup struct {
+	hosts    []Host
+	vars     map[string]string
+	children []string
+}
+
+// ansibleInventory collects the groups of an Ansible inventory then flattens them into an
+// Inventory. Group vars are applied to every host in the group and its children. Host vars win.
+type ansibleInventory struct {
+	order  []string
+	groups map[string]*ansibleGroup
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{groups: make(map[string]*ansibleGroup)}
+}
+
+func (a *ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := a.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		a.groups[name] = g
+		a.order = append(a.order, name)
+	}
+
+	return g
+}
+
+// parents returns every group which has name as a child, directly or through another group.
+// Closer groups are first.
+func (a *ansibleInventory) parents(name string, seen map[string]bool) []string {
+	var parents []string
+	for _, parent := range a.order {
+		if seen[parent] || !slices.Contains(a.groups[parent].children, name) {
+			continue
+		}
+
+		seen[parent] = true
+		parents = append(parents, parent)
+		parents = append(parents, a.parents(parent, seen)...)
+	}
+
+	return parents
+}
+
+func (a *ansibleInventory) inventory() Inventory {
+	var inv Inventory
+	for _, name := range a.order {
+		groups := append([]string{name}, a.parents(name, map[string]bool{name: true})...)
+		for _, h := range a.groups[name].hosts {
+			host := Host{ID: h.ID, Name: h.Name, Hostname: h.Hostname, Port: h.Port, Labels: make(map[string]string)}
+			// Most distant group first so closer group vars and host vars win.
+			for i := len(groups) - 1; i >= 0; i-- {
+				maps.Copy(host.Labels, a.groups[groups[i]].vars)
+			}
+
+			maps.Copy(host.Labels, h.Labels)
+			for _, g := range groups {
+				if !slices.Contains(ansibleImplicitGroups, g) {
+					host.Groups = append(host.Groups, g)
+				}
+			}
+
+			if len(host.Labels) == 0 {
+				host.Labels = nil
+			}
+
+			inv.add(host)
+		}
+	}
+
+	return inv
+}
+
+// ansibleHost builds a Host from the host name and its vars. ansible_host and ansible_port set the
+// address and cuttle_id sets the server ID. Other ansible_ vars are dropped. Vars which are not
+// valid labels are dropped.
+func ansibleHost(name string, vars map[string]string) (Host, error) {
+	h := Host{Name: name}
+	for k, v := range vars {
+		switch k {
+		case "ansible_host", "ansible_ssh_host":
+			h.Hostname = v
+		case "ansible_port", "ansible_ssh_port":
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return h, fmt.Errorf("%w: %s: invalid port: %s", ErrInvalidHost, name, v)
+			}
+
+			h.Port = port
+		case "cuttle_id":
+			h.ID = v
+		}
+	}
+
+	h.Labels = ansibleLabels(vars)
+	return h, nil
+}
+
+// ansibleLabels returns the vars which can be used as labels.
+func ansibleLabels(vars map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range vars {
+		if strings.HasPrefix(k, "ansible_") || k == "cuttle_id" {
+			continue
+		}
+
+		if connections.ValidateLabelKey(k) != nil || connections.ValidateLabelValue(v) != nil {
+			continue
+		}
+
+		labels[k] = v
+	}
+
+	return labels
+}
+
+// expandAnsibleRange expands the first numeric range in the host pattern. Leading zeros are kept.
+// "web[01:03]" is web01, web02, and web03.
+func expandAnsibleRange(pattern string) ([]string, error) {
+	m := ansibleRangeRe.FindStringSubmatchIndex(pattern)
+	if m == nil {
+		return []string{pattern}, nil
+	}
+
+	lo, _ := strconv.Atoi(pattern[m[2]:m[3]])
+	hi, _ := strconv.Atoi(pattern[m[4]:m[5]])
+	if lo > hi || hi-lo > 10000 {
+		return nil, fmt.Errorf("%w: invalid range: %s", ErrInvalidHost, pattern)
+	}
+
+	width := m[3] - m[2]
+	var names []string
+	for i := lo; i <= hi; i++ {
+		more, err := expandAnsibleRange(pattern[:m[0]] + fmt.Sprintf("%0*d", width, i) + pattern[m[1]:])
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, more...)
+	}
+
+	return names, nil
+}
+
+// ParseAnsibleINI reads an Ansible INI inventory. Host vars, [group:vars], [group:children], and
+// numeric host ranges are supported. Group names become Groups and vars become labels.
+func ParseAnsibleINI(r io.Reader) (Inventory, error) {
+	a := newAnsibleInventory()
+	section, kind := "ungrouped", ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: invalid section: %s", n, line)
+			}
+
+			section, kind, _ = strings.Cut(strings.Trim(line, "[]"), ":")
+			if kind != "" && kind != "vars" && kind != "children" {
+				return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: unknown section type: %s", n, kind)
+			}
+
+			a.group(section)
+			continue
+		}
+
+		g := a.group(section)
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: expected key=value: %s", n, line)
+			}
+
+			g.vars[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+		case "children":
+			g.children = append(g.children, line)
+		default:
+			fields := ansibleFields(line)
+			vars := make(map[string]string)
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: expected key=value: %s", n, f)
+				}
+
+				vars[k] = unquote(v)
+			}
+
+			names, err := expandAnsibleRange(fields[0])
+			if err != nil {
+				return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: %w", n, err)
+			}
+
+			for _, name := range names {
+				h, err := ansibleHost(name, vars)
+				if err != nil {
+					return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: line %d: %w", n, err)
+				}
+
+				g.hosts = append(g.hosts, h)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Inventory{}, fmt.Errorf("inventory.ParseAnsibleINI: %w", err)
+	}
+
+	// Group vars only apply through the groups, not as host vars.
+	for _, g := range a.groups {
+		g.vars = ansibleLabels(g.vars)
+	}
+
+	return a.inventory(), nil
+}
+
+// ansibleYAMLGroup is a group in an Ansible YAML inventory.
+type ansibleYAMLGroup struct {
+	Hosts    map[string]map[string]any    `yaml:"hosts"`
+	Vars     map[string]any               `yaml:"vars"`
+	Children map[string]*ansibleYAMLGroup `yaml:"children"`
+}
+
+// ParseAnsibleYAML reads an Ansible YAML inventory. Hosts are sorted by name within each group
+// since YAML maps have no order.
+func ParseAnsibleYAML(r io.Reader) (Inventory, error) {
+	var top map[string]*ansibleYAMLGroup
+	if err := yaml.NewDecoder(r).Decode(&top); err != nil && err != io.EOF {
+		return Inventory{}, fmt.Errorf("inventory.ParseAnsibleYAML: %w", err)
+	}
+
+	a := newAnsibleInventory()
+	for _, name := range sortedKeys(top) {
+		if err := a.addYAMLGroup(name, top[name]); err != nil {
+			return Inventory{}, fmt.Errorf("inventory.ParseAnsibleYAML: %w", err)
+		}
+	}
+
+	return a.inventory(), nil
+}
+
+func (a *ansibleInventory) addYAMLGroup(name string, yg *ansibleYAMLGroup) error {
+	g := a.group(name)
+	if yg == nil {
+		return nil
+	}
+
+	maps.Copy(g.vars, ansibleLabels(stringVars(yg.Vars)))
+	for _, hostName := range sortedKeys(yg.Hosts) {
+		names, err := expandAnsibleRange(hostName)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range names {
+			h, err := ansibleHost(n, stringVars(yg.Hosts[hostName]))
+			if err != nil {
+				return err
+			}
+
+			g.hosts = append(g.hosts, h)
+		}
+	}
+
+	for _, child := range sortedKeys(yg.Children) {
+		if !slices.Contains(g.children, child) {
+			g.children = append(g.children, child)
+		}
+
+		if err := a.addYAMLGroup(child, yg.Children[child]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stringVars keeps the vars which are scalars, as strings.
+func stringVars(vars map[string]any) map[string]string {
+	s := make(map[string]string)
+	for k, v := range vars {
+		switch v.(type) {
+		case string, int, int64, float64, bool:
+			s[k] = fmt.Sprint(v)
+		}
+	}
+
+	return s
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// ansibleFields splits the line on spaces which are not in quotes.
+func ansibleFields(line string) []string {
+	var quote rune
+	return strings.FieldsFunc(line, func(c rune) bool {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			return c == ' ' || c == '\t'
+		}
+
+		return false
+	})
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
@@ -0,0 +1,118 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnsibleExpandRange(t *testing.T) {
+	require := require.New(t)
+
+	names, err := expandAnsibleRange("web[01:03].example.com")
+	require.NoError(err, "expandAnsibleRange() returned an error: %s", err)
+	require.Equal([]string{"web01.example.com", "web02.example.com", "web03.example.com"}, names)
+
+	names, err = expandAnsibleRange("r[1:2]n[8:9]")
+	require.NoError(err, "expandAnsibleRange() returned an error: %s", err)
+	require.Equal([]string{"r1n8", "r1n9", "r2n8", "r2n9"}, names)
+
+	_, err = expandAnsibleRange("web[3:1]")
+	require.ErrorIs(err, ErrInvalidHost, "expandAnsibleRange() did not return ErrInvalidHost")
+}
+
+func TestAnsibleParseINI(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		inv, err := ParseAnsibleINI(strings.NewReader(`
+# Comment
+bastion ansible_host=192.168.1.1
+
+[web]
+web[01:02].example.com env=prod
+web03 ansible_host=10.0.0.3 ansible_port=2222 cuttle_id=web03-id role="front end"
+
+[db]
+db01.example.com
+
+[prod:children]
+web
+db
+
+[prod:vars]
+env=production
+ansible_user=deploy
+`))
+		require.NoError(err, "ParseAnsibleINI() returned an error: %s", err)
+		require.Equal([]Host{
+			{Name: "bastion", Hostname: "192.168.1.1"},
+			{Name: "web01.example.com", Hostname: "web01.example.com", Labels: map[string]string{"env": "prod"}, Groups: []string{"web", "prod"}},
+			{Name: "web02.example.com", Hostname: "web02.example.com", Labels: map[string]string{"env": "prod"}, Groups: []string{"web", "prod"}},
+			{ID: "web03-id", Name: "web03", Hostname: "10.0.0.3", Port: 2222, Labels: map[string]string{"env": "production"}, Groups: []string{"web", "prod"}},
+			{Name: "db01.example.com", Hostname: "db01.example.com", Labels: map[string]string{"env": "production"}, Groups: []string{"db", "prod"}},
+		}, inv.Hosts, "Hosts did not match")
+	})
+
+	for name, data := range map[string]string{
+		"section":   "[web\nweb01",
+		"kind":      "[web:hosts]\nweb01",
+		"vars":      "[web:vars]\nenv",
+		"host var":  "[web]\nweb01 env",
+		"port":      "[web]\nweb01 ansible_port=ssh",
+		"bad range": "[web]\nweb[2:1]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseAnsibleINI(strings.NewReader(data))
+			require.Error(err, "ParseAnsibleINI() did not return an error")
+		})
+	}
+}
+
+func TestAnsibleParseYAML(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		inv, err := ParseAnsibleYAML(strings.NewReader(`
+all:
+  hosts:
+    bastion:
+      ansible_host: 192.168.1.1
+  children:
+    prod:
+      vars:
+        env: production
+        tags: [a, b]
+      children:
+        web:
+          hosts:
+            web[01:02].example.com:
+            web03:
+              ansible_host: 10.0.0.3
+              ansible_port: 2222
+              cuttle_id: web03-id
+              env: prod
+        db:
+          hosts:
+            db01.example.com:
+`))
+		require.NoError(err, "ParseAnsibleYAML() returned an error: %s", err)
+		require.Equal([]Host{
+			{Name: "bastion", Hostname: "192.168.1.1"},
+			{Name: "db01.example.com", Hostname: "db01.example.com", Labels: map[string]string{"env": "production"}, Groups: []string{"db", "prod"}},
+			// Hosts are sorted by their pattern.
+			{ID: "web03-id", Name: "web03", Hostname: "10.0.0.3", Port: 2222, Labels: map[string]string{"env": "prod"}, Groups: []string{"web", "prod"}},
+			{Name: "web01.example.com", Hostname: "web01.example.com", Labels: map[string]string{"env": "production"}, Groups: []string{"web", "prod"}},
+			{Name: "web02.example.com", Hostname: "web02.example.com", Labels: map[string]string{"env": "production"}, Groups: []string{"web", "prod"}},
+		}, inv.Hosts, "Hosts did not match")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseAnsibleYAML(strings.NewReader("all: [web01]"))
+		require.Error(err, "ParseAnsibleYAML() did not return an error")
+
+		_, err = ParseAnsibleYAML(strings.NewReader("web:\n  hosts:\n    web01:\n      ansible_port: ssh"))
+		require.ErrorIs(err, ErrInvalidHost, "ParseAnsibleYAML() did not return ErrInvalidHost")
+	})
+}
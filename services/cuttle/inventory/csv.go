@@ -0,0 +1,131 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseCSV reads a CSV inventory with a header row. The name or hostname column is required.
+//
+//	id        The stable server ID. New servers get one if empty.
+//	name      The display name. Defaults to hostname.
+//	hostname  The address to connect to. Defaults to name.
+//	port      The port to connect to.
+//	groups    Groups the host is in, separated by ';'.
+//	labels    Labels separated by ';'. ("env=prod;role=db")
+//
+// Any other column is a label named after the column. Empty cells are skipped.
+func ParseCSV(r io.Reader) (Inventory, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Inventory{}, nil
+		}
+
+		return Inventory{}, fmt.Errorf("inventory.ParseCSV: %w", err)
+	}
+
+	for i, col := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(col))
+	}
+
+	hasName := false
+	for _, col := range header {
+		hasName = hasName || col == "name" || col == "hostname"
+	}
+
+	if !hasName {
+		return Inventory{}, fmt.Errorf("inventory.ParseCSV: a name or hostname column is required")
+	}
+
+	var inv Inventory
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return inv, fmt.Errorf("inventory.ParseCSV: %w", err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		h, err := csvHost(header, record)
+		if err != nil {
+			return inv, fmt.Errorf("inventory.ParseCSV: line %d: %w", line, err)
+		}
+
+		inv.add(h)
+	}
+
+	return inv, nil
+}
+
+func csvHost(header, record []string) (Host, error) {
+	h := Host{Labels: make(map[string]string)}
+	for i, col := range header {
+		v := strings.TrimSpace(record[i])
+		if v == "" {
+			continue
+		}
+
+		switch col {
+		case "id":
+			h.ID = v
+		case "name":
+			h.Name = v
+		case "hostname":
+			h.Hostname = v
+		case "port":
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return h, fmt.Errorf("%w: invalid port: %s", ErrInvalidHost, v)
+			}
+
+			h.Port = port
+		case "groups":
+			for _, g := range strings.Split(v, ";") {
+				if g = strings.TrimSpace(g); g != "" {
+					h.Groups = append(h.Groups, g)
+				}
+			}
+		case "labels":
+			for _, pair := range strings.Split(v, ";") {
+				k, lv, ok := strings.Cut(pair, "=")
+				if !ok {
+					return h, fmt.Errorf("%w: expected key=value label: %s", ErrInvalidHost, pair)
+				}
+
+				h.Labels[strings.TrimSpace(k)] = strings.TrimSpace(lv)
+			}
+		default:
+			h.Labels[col] = v
+		}
+	}
+
+	if h.Name == "" {
+		h.Name = h.Hostname
+	}
+
+	if h.Name == "" {
+		return h, fmt.Errorf("%w: name and hostname are empty", ErrInvalidHost)
+	}
+
+	if err := validateLabels(h.Labels); err != nil {
+		return h, err
+	}
+
+	if len(h.Labels) == 0 {
+		h.Labels = nil
+	}
+
+	return h, nil
+}
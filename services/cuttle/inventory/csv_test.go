@@ -0,0 +1,49 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVParse(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		inv, err := ParseCSV(strings.NewReader(`ID,Name,Hostname,Port,Groups,Labels,Env
+# Comment
+web01-id,web01,web01.example.com,22,web;prod,role=web;tier=front,prod
+,,db01.example.com,,db,,
+,web02,,,,,
+`))
+		require.NoError(err, "ParseCSV() returned an error: %s", err)
+		require.Equal([]Host{
+			{ID: "web01-id", Name: "web01", Hostname: "web01.example.com", Port: 22, Labels: map[string]string{"role": "web", "tier": "front", "env": "prod"}, Groups: []string{"web", "prod"}},
+			{Name: "db01.example.com", Hostname: "db01.example.com", Groups: []string{"db"}},
+			{Name: "web02", Hostname: "web02"},
+		}, inv.Hosts, "Hosts did not match")
+	})
+
+	t.Run("no name column", func(t *testing.T) {
+		_, err := ParseCSV(strings.NewReader("port,groups\n22,web\n"))
+		require.Error(err, "ParseCSV() did not return an error")
+	})
+
+	for name, data := range map[string]string{
+		"port":   "name,port\nweb01,ssh\n",
+		"label":  "name,labels\nweb01,env\n",
+		"key":    "name,bad key\nweb01,x\n",
+		"empty":  "name,port\n,22\n",
+		"fields": "name,port\nweb01\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(data))
+			require.Error(err, "ParseCSV() did not return an error")
+			if name != "fields" {
+				require.ErrorIs(err, ErrInvalidHost, "ParseCSV() did not return ErrInvalidHost")
+				require.Contains(err.Error(), "line 2", "error did not include the line")
+			}
+		})
+	}
+}
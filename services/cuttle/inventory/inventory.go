@@ -0,0 +1,344 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+)
+
+// Supported inventory formats.
+const (
+	FormatAnsibleINI  = "ansible-ini"
+	FormatAnsibleYAML = "ansible-yaml"
+	FormatCSV         = "csv"
+	FormatSSHConfig   = "ssh-config"
+)
+
+var (
+	ErrUnknownFormat = fmt.Errorf("unknown inventory format")
+	ErrInvalidHost   = fmt.Errorf("invalid host")
+	ErrConflicts     = fmt.Errorf("import has conflicts")
+)
+
+// Formats returns the supported formats.
+func Formats() []string {
+	return []string{FormatAnsibleINI, FormatAnsibleYAML, FormatCSV, FormatSSHConfig}
+}
+
+// Host is a server read from an inventory.
+type Host struct {
+	ID       string            `json:"id,omitempty"` // Stable server ID. New servers get one if empty.
+	Name     string            `json:"name"`         // Display name. (Ansible host, ssh Host alias)
+	Hostname string            `json:"hostname"`     // Address to connect to. Defaults to Name.
+	Port     int               `json:"port,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Groups   []string          `json:"groups,omitempty"`
+}
+
+// Addr returns hostname:port, or just the hostname if the port is not set.
+func (h Host) Addr() string {
+	if h.Port == 0 {
+		return h.Hostname
+	}
+
+	return h.Hostname + ":" + strconv.Itoa(h.Port)
+}
+
+// Inventory is the list of Hosts read from a file, in file order.
+type Inventory struct {
+	Hosts []Host
+}
+
+// add merges the host into the Inventory. A Host seen again with the same Name, hostname, and port
+// is merged so a host listed in more than one Ansible group is only added once.
+func (inv *Inventory) add(h Host) {
+	if h.Hostname == "" {
+		h.Hostname = h.Name
+	}
+
+	for i, cur := range inv.Hosts {
+		if cur.Name != h.Name || cur.Hostname != h.Hostname || cur.Port != h.Port {
+			continue
+		}
+
+		for k, v := range h.Labels {
+			if inv.Hosts[i].Labels == nil {
+				inv.Hosts[i].Labels = make(map[string]string)
+			}
+
+			inv.Hosts[i].Labels[k] = v
+		}
+
+		for _, g := range h.Groups {
+			if !slices.Contains(cur.Groups, g) {
+				inv.Hosts[i].Groups = append(inv.Hosts[i].Groups, g)
+			}
+		}
+
+		return
+	}
+
+	inv.Hosts = append(inv.Hosts, h)
+}
+
+// Parse reads an inventory in the format.
+func Parse(format string, r io.Reader) (Inventory, error) {
+	switch format {
+	case FormatAnsibleINI:
+		return ParseAnsibleINI(r)
+	case FormatAnsibleYAML:
+		return ParseAnsibleYAML(r)
+	case FormatCSV:
+		return ParseCSV(r)
+	case FormatSSHConfig:
+		return ParseSSHConfig(r)
+	default:
+		return Inventory{}, fmt.Errorf("inventory.Parse: %w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// Conflict is a Host which cannot be imported because its hostname is already used.
+type Conflict struct {
+	Host   Host   `json:"host"`
+	With   string `json:"with"` // Name of the server or Host which already has the hostname.
+	Reason string `json:"reason"`
+}
+
+// GroupChange is a Group which is created or gets new servers.
+type GroupChange struct {
+	Name    string   `json:"name"`
+	Created bool     `json:"created"`
+	Add     []string `json:"add"` // Server names added to the Group.
+}
+
+// Plan is the dry run of an import into a Profile. Nothing changes until it is applied.
+type Plan struct {
+	Add       []Host        `json:"add"`
+	Update    []Host        `json:"update"` // Same name as a server in the Profile, new address or labels.
+	Unchanged []Host        `json:"unchanged"`
+	Conflicts []Conflict    `json:"conflicts"`
+	Groups    []GroupChange `json:"groups"`
+}
+
+// NewPlan compares the Inventory to the Profile's servers. Hosts are matched to servers by name.
+// A Host whose hostname is already used by a server or Host with a different name is a conflict.
+func NewPlan(p profiles.Profile, inv Inventory) Plan {
+	plan := Plan{Add: []Host{}, Update: []Host{}, Unchanged: []Host{}, Conflicts: []Conflict{}, Groups: []GroupChange{}}
+	existing := make(map[string]connections.Server)
+	owner := make(map[string]string) // hostname to server name.
+	for _, s := range p.Servers {
+		existing[s.Name] = s
+		owner[s.Hostname] = s.Name
+	}
+
+	imported := make(map[string]bool)
+	for _, h := range inv.Hosts {
+		if name, ok := owner[h.Hostname]; ok && name != h.Name {
+			reason := "hostname is used by an existing server"
+			if _, ok := existing[name]; !ok {
+				reason = "hostname is used by another host in the import"
+			}
+
+			plan.Conflicts = append(plan.Conflicts, Conflict{Host: h, With: name, Reason: reason})
+			continue
+		}
+
+		if imported[h.Name] {
+			plan.Conflicts = append(plan.Conflicts, Conflict{Host: h, With: h.Name, Reason: "name is used by another host in the import"})
+			continue
+		}
+
+		imported[h.Name] = true
+		owner[h.Hostname] = h.Name
+		s, ok := existing[h.Name]
+		switch {
+		case !ok:
+			plan.Add = append(plan.Add, h)
+		case s.Hostname != h.Hostname || s.Port != h.Port || !maps.Equal(s.Labels, h.Labels):
+			plan.Update = append(plan.Update, h)
+		default:
+			plan.Unchanged = append(plan.Unchanged, h)
+		}
+	}
+
+	plan.Groups = planGroups(p, plan)
+	return plan
+}
+
+// planGroups returns the Group changes for the Hosts which are not in conflict.
+func planGroups(p profiles.Profile, plan Plan) []GroupChange {
+	changes := []GroupChange{}
+	index := make(map[string]int)
+	for _, h := range slices.Concat(plan.Add, plan.Update, plan.Unchanged) {
+		for _, name := range h.Groups {
+			g, ok := p.Groups[name]
+			if ok && slices.ContainsFunc(g.Servers, func(s connections.Server) bool { return s.Name == h.Name }) {
+				continue
+			}
+
+			i, seen := index[name]
+			if !seen {
+				i = len(changes)
+				index[name] = i
+				changes = append(changes, GroupChange{Name: name, Created: !ok})
+			}
+
+			changes[i].Add = append(changes[i].Add, h.Name)
+		}
+	}
+
+	return changes
+}
+
+// HasConflicts returns true if any Host is in conflict.
+func (plan Plan) HasConflicts() bool { return len(plan.Conflicts) > 0 }
+
+// String returns the Plan as a diff. '+' is added, '~' is updated, '!' is a conflict.
+func (plan Plan) String() string {
+	var b strings.Builder
+	for _, h := range plan.Add {
+		fmt.Fprintf(&b, "+ server %s (%s)\n", h.Name, h.Addr())
+	}
+
+	for _, h := range plan.Update {
+		fmt.Fprintf(&b, "~ server %s (%s)\n", h.Name, h.Addr())
+	}
+
+	for _, g := range plan.Groups {
+		sign := "~"
+		if g.Created {
+			sign = "+"
+		}
+
+		fmt.Fprintf(&b, "%s group %s: %s\n", sign, g.Name, strings.Join(g.Add, ", "))
+	}
+
+	for _, c := range plan.Conflicts {
+		fmt.Fprintf(&b, "! conflict %s (%s): %s: %s\n", c.Host.Name, c.Host.Addr(), c.Reason, c.With)
+	}
+
+	fmt.Fprintf(&b, "%d to add, %d to update, %d unchanged, %d conflicts\n",
+		len(plan.Add), len(plan.Update), len(plan.Unchanged), len(plan.Conflicts))
+	return b.String()
+}
+
+// Apply makes the changes in the Plan to the Profile. Returns ErrConflicts and changes nothing if
+// the Plan has conflicts. New servers write to the results and logs buffers, have no Connector, and
+// use the Host ID if it is set. Updated servers keep their ID, Connector, and buffers.
+func Apply(p *profiles.Profile, plan Plan, results, logs *bytes.Buffer) error {
+	if plan.HasConflicts() {
+		return fmt.Errorf("inventory.Apply: %w: %d hosts", ErrConflicts, len(plan.Conflicts))
+	}
+
+	// Build every server first so a bad Host changes nothing.
+	servers := make(map[string]connections.Server)
+	for _, h := range plan.Add {
+		s, err := connections.NewServer(h.Hostname, h.Port, results, logs)
+		if err != nil {
+			return fmt.Errorf("inventory.Apply: %w: %s: %w", ErrInvalidHost, h.Name, err)
+		}
+
+		if err := setHost(&s, h); err != nil {
+			return fmt.Errorf("inventory.Apply: %w", err)
+		}
+
+		if h.ID != "" {
+			if err := s.SetID(h.ID); err != nil {
+				return fmt.Errorf("inventory.Apply: %w: %s: %w", ErrInvalidHost, h.Name, err)
+			}
+		}
+
+		servers[h.Name] = s
+	}
+
+	for _, h := range plan.Update {
+		i := slices.IndexFunc(p.Servers, func(s connections.Server) bool { return s.Name == h.Name })
+		if i < 0 {
+			return fmt.Errorf("inventory.Apply: %w: %s: server not found", ErrInvalidHost, h.Name)
+		}
+
+		s := p.Servers[i]
+		// Clear the old address so a move from an IP to a hostname does not keep using the IP.
+		s.IP, s.UseIP = nil, false
+		if err := s.SetHostname(h.Hostname); err != nil {
+			return fmt.Errorf("inventory.Apply: %w: %s: %w", ErrInvalidHost, h.Name, err)
+		}
+
+		if err := setHost(&s, h); err != nil {
+			return fmt.Errorf("inventory.Apply: %w", err)
+		}
+
+		servers[h.Name] = s
+	}
+
+	p.Servers = slices.Clone(p.Servers)
+	for _, h := range slices.Concat(plan.Add, plan.Update) {
+		p.AddServers(servers[h.Name])
+	}
+
+	// Clone so other copies of the Profile are not changed.
+	p.Groups = maps.Clone(p.Groups)
+	if p.Groups == nil {
+		p.Groups = make(map[string]profiles.Group)
+	}
+
+	// Keep the copies of updated servers in each Group current.
+	updated := make(map[string]connections.Server, len(plan.Update))
+	for _, h := range plan.Update {
+		updated[servers[h.Name].GetID()] = servers[h.Name]
+	}
+
+	for name, g := range p.Groups {
+		g.Servers = slices.Clone(g.Servers)
+		for i, s := range g.Servers {
+			if u, ok := updated[s.GetID()]; ok {
+				g.Servers[i] = u
+			}
+		}
+
+		p.Groups[name] = g
+	}
+
+	for _, change := range plan.Groups {
+		g, ok := p.Groups[change.Name]
+		if !ok {
+			g = profiles.NewGroup(change.Name)
+		}
+
+		for _, name := range change.Add {
+			i := slices.IndexFunc(p.Servers, func(s connections.Server) bool { return s.Name == name })
+			if i >= 0 {
+				g.AddServers(p.Servers[i])
+			}
+		}
+
+		p.Groups[change.Name] = g
+	}
+
+	return nil
+}
+
+// setHost sets the name, port, and labels of the Host on the server.
+func setHost(s *connections.Server, h Host) error {
+	if err := s.SetName(h.Name); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidHost, h.Name, err)
+	}
+
+	if err := s.SetPort(h.Port); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidHost, h.Name, err)
+	}
+
+	s.Labels = nil
+	if err := s.SetLabels(h.Labels); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidHost, h.Name, err)
+	}
+
+	return nil
+}
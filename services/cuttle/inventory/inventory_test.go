@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/stretchr/testify/require"
+)
+
+func testProfile(t *testing.T) profiles.Profile {
+	t.Helper()
+	var results, logs bytes.Buffer
+	p, err := profiles.NewProfile("Web")
+	require.NoError(t, err, "NewProfile() returned an error: %s", err)
+
+	web, err := connections.NewServer("web01.example.com", 22, &results, &logs)
+	require.NoError(t, err, "NewServer() returned an error: %s", err)
+	require.NoError(t, web.SetLabels(map[string]string{"env": "prod"}))
+
+	db, err := connections.NewServer("db01.example.com", 0, &results, &logs)
+	require.NoError(t, err, "NewServer() returned an error: %s", err)
+
+	p.AddServers(web, db)
+	require.Empty(t, p.AddGroups(profiles.NewGroup("web", web)))
+	return p
+}
+
+func TestInventoryAdd(t *testing.T) {
+	require := require.New(t)
+
+	var inv Inventory
+	inv.add(Host{Name: "web01", Groups: []string{"web"}})
+	inv.add(Host{Name: "web01", Labels: map[string]string{"env": "prod"}, Groups: []string{"prod", "web"}})
+	inv.add(Host{Name: "web01", Hostname: "10.0.0.1"})
+	require.Equal([]Host{
+		{Name: "web01", Hostname: "web01", Labels: map[string]string{"env": "prod"}, Groups: []string{"web", "prod"}},
+		{Name: "web01", Hostname: "10.0.0.1"},
+	}, inv.Hosts, "Hosts did not match")
+}
+
+func TestInventoryParse(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := Parse("xml", strings.NewReader(""))
+		require.ErrorIs(err, ErrUnknownFormat, "Parse() did not return ErrUnknownFormat")
+	})
+
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			inv, err := Parse(format, strings.NewReader(""))
+			require.NoError(err, "Parse() returned an error: %s", err)
+			require.Empty(inv.Hosts, "Hosts was not empty")
+		})
+	}
+}
+
+func TestInventoryNewPlan(t *testing.T) {
+	require := require.New(t)
+	p := testProfile(t)
+
+	inv := Inventory{Hosts: []Host{
+		{Name: "web01.example.com", Hostname: "web01.example.com", Port: 22, Labels: map[string]string{"env": "prod"}, Groups: []string{"web"}},
+		{Name: "db01.example.com", Hostname: "db01.example.com", Labels: map[string]string{"role": "db"}, Groups: []string{"db"}},
+		{Name: "web02", Hostname: "web02.example.com", Groups: []string{"web"}},
+		{Name: "web1", Hostname: "web01.example.com"},
+		{Name: "web03", Hostname: "web02.example.com"},
+		{Name: "web02", Hostname: "10.0.0.2"},
+	}}
+
+	plan := NewPlan(p, inv)
+	require.Equal([]Host{inv.Hosts[2]}, plan.Add, "Add did not match")
+	require.Equal([]Host{inv.Hosts[1]}, plan.Update, "Update did not match")
+	require.Equal([]Host{inv.Hosts[0]}, plan.Unchanged, "Unchanged did not match")
+	require.Equal([]Conflict{
+		{Host: inv.Hosts[3], With: "web01.example.com", Reason: "hostname is used by an existing server"},
+		{Host: inv.Hosts[4], With: "web02", Reason: "hostname is used by another host in the import"},
+		{Host: inv.Hosts[5], With: "web02", Reason: "name is used by another host in the import"},
+	}, plan.Conflicts, "Conflicts did not match")
+	require.True(plan.HasConflicts(), "HasConflicts() returned false")
+	require.Equal([]GroupChange{
+		{Name: "web", Add: []string{"web02"}},
+		{Name: "db", Created: true, Add: []string{"db01.example.com"}},
+	}, plan.Groups, "Groups did not match")
+
+	require.Equal(`+ server web02 (web02.example.com)
+~ server db01.example.com (db01.example.com)
+~ group web: web02
++ group db: db01.example.com
+! conflict web1 (web01.example.com): hostname is used by an existing server: web01.example.com
+! conflict web03 (web02.example.com): hostname is used by another host in the import: web02
+! conflict web02 (10.0.0.2): name is used by another host in the import: web02
+1 to add, 1 to update, 1 unchanged, 3 conflicts
+`, plan.String(), "String() did not match")
+}
+
+func TestInventoryApply(t *testing.T) {
+	require := require.New(t)
+	var results, logs bytes.Buffer
+
+	t.Run("conflicts", func(t *testing.T) {
+		p := testProfile(t)
+		plan := NewPlan(p, Inventory{Hosts: []Host{{Name: "web1", Hostname: "web01.example.com"}}})
+		err := Apply(&p, plan, &results, &logs)
+		require.ErrorIs(err, ErrConflicts, "Apply() did not return ErrConflicts")
+		require.Len(p.Servers, 2, "Servers changed")
+	})
+
+	t.Run("invalid host", func(t *testing.T) {
+		p := testProfile(t)
+		plan := NewPlan(p, Inventory{Hosts: []Host{
+			{Name: "web02", Hostname: "web02.example.com"},
+			{Name: "bad", Hostname: "bad host"},
+		}})
+		err := Apply(&p, plan, &results, &logs)
+		require.ErrorIs(err, ErrInvalidHost, "Apply() did not return ErrInvalidHost")
+		require.Len(p.Servers, 2, "Servers changed")
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		p := testProfile(t)
+		orig := p
+		inv := Inventory{Hosts: []Host{
+			{ID: "ignored", Name: "web01.example.com", Hostname: "10.0.0.1", Port: 2222, Labels: map[string]string{"env": "dev"}, Groups: []string{"web"}},
+			{ID: "web02-id", Name: "web02", Hostname: "web02.example.com", Labels: map[string]string{"env": "prod"}, Groups: []string{"web", "new"}},
+		}}
+
+		err := Apply(&p, NewPlan(p, inv), &results, &logs)
+		require.NoError(err, "Apply() returned an error: %s", err)
+		require.Len(p.Servers, 3, "Servers did not match")
+
+		web01 := p.Servers[0]
+		require.Equal("web01.example.com", web01.Name, "Name did not match")
+		require.Equal("10.0.0.1", web01.Hostname, "Hostname did not match")
+		require.True(web01.UseIP, "UseIP was false")
+		require.Equal(2222, web01.Port, "Port did not match")
+		require.Equal(map[string]string{"env": "dev"}, web01.Labels, "Labels did not match")
+		require.Equal(orig.Servers[0].ID, web01.ID, "updated server did not keep its ID")
+
+		web02 := p.Servers[2]
+		require.Equal("web02", web02.Name, "Name did not match")
+		require.Equal("web02.example.com", web02.Hostname, "Hostname did not match")
+		require.Equal("web02-id", web02.ID, "new server did not use the Host ID")
+
+		g, err := p.GetGroup("web")
+		require.NoError(err, "GetGroup() returned an error: %s", err)
+		require.Equal(2, g.Count(), "Count() did not match")
+		require.Equal("10.0.0.1", g.Servers[0].Hostname, "group server was not updated")
+		require.Equal("web02", g.Servers[1].Name, "group server was not added")
+
+		g, err = p.GetGroup("new")
+		require.NoError(err, "GetGroup() returned an error: %s", err)
+		require.Equal([]string{"web02"}, []string{g.Servers[0].Name}, "new group did not match")
+
+		// The original Profile's slices were not changed.
+		require.Len(orig.Servers, 2, "original Servers changed")
+		require.Equal("web01.example.com", orig.Servers[0].Hostname, "original server changed")
+		require.NotContains(orig.Groups, "new", "group was added to the original Profile")
+		require.Equal(1, orig.Groups["web"].Count(), "original group changed")
+
+		// Applying the same inventory again changes nothing.
+		plan := NewPlan(p, inv)
+		require.Len(plan.Unchanged, 2, "Unchanged did not match")
+		require.Empty(plan.Groups, "Groups was not empty")
+	})
+}
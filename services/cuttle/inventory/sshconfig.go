@@ -0,0 +1,85 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+// ParseSSHConfig reads the Host blocks of an ssh config file. ("~/.ssh/config") Each alias is a
+// Host. HostName and Port are used. Aliases with wildcards, Match blocks, and Include are skipped.
+func ParseSSHConfig(r io.Reader) (Inventory, error) {
+	var inv Inventory
+	var block []Host // Hosts in the current Host block. nil in a Match block.
+	flush := func() {
+		for _, h := range block {
+			inv.add(h)
+		}
+
+		block = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Keywords are case insensitive and may be separated from the value by '='.
+		key, value, _ := strings.Cut(strings.Replace(line, "=", " ", 1), " ")
+		value = unquote(strings.TrimSpace(value))
+		switch strings.ToLower(key) {
+		case "host":
+			flush()
+			for _, alias := range strings.Fields(value) {
+				if strings.ContainsAny(alias, "*?!") {
+					continue
+				}
+
+				block = append(block, Host{Name: alias})
+			}
+		case "match":
+			flush()
+		case "hostname":
+			for i := range block {
+				block[i].Hostname = value
+			}
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return inv, fmt.Errorf("inventory.ParseSSHConfig: line %d: %w: invalid port: %s", n, ErrInvalidHost, value)
+			}
+
+			for i := range block {
+				block[i].Port = port
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return inv, fmt.Errorf("inventory.ParseSSHConfig: %w", err)
+	}
+
+	flush()
+	return inv, nil
+}
+
+// validateLabels returns an error for the first invalid label.
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if err := connections.ValidateLabelKey(k); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidHost, err)
+		}
+
+		if err := connections.ValidateLabelValue(v); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidHost, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHConfigParse(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("valid", func(t *testing.T) {
+		inv, err := ParseSSHConfig(strings.NewReader(`
+Include config.d/*
+
+Host *
+  User deploy
+
+# Comment
+Host web01 web01-alt
+  HostName web01.example.com
+  Port 2222
+
+host=db01
+  hostname="10.0.0.5"
+
+Host *.internal !bad.internal cache01
+  HOSTNAME cache01.internal
+
+Match host gw
+  HostName 10.0.0.1
+
+Host bastion
+`))
+		require.NoError(err, "ParseSSHConfig() returned an error: %s", err)
+		require.Equal([]Host{
+			{Name: "web01", Hostname: "web01.example.com", Port: 2222},
+			{Name: "web01-alt", Hostname: "web01.example.com", Port: 2222},
+			{Name: "db01", Hostname: "10.0.0.5"},
+			{Name: "cache01", Hostname: "cache01.internal"},
+			{Name: "bastion", Hostname: "bastion"},
+		}, inv.Hosts, "Hosts did not match")
+	})
+
+	t.Run("invalid port", func(t *testing.T) {
+		_, err := ParseSSHConfig(strings.NewReader("Host web01\n  Port ssh\n"))
+		require.ErrorIs(err, ErrInvalidHost, "ParseSSHConfig() did not return ErrInvalidHost")
+		require.Contains(err.Error(), "line 2", "error did not include the line")
+	})
+}
@@ -0,0 +1,160 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/auth"
+	"github.com/chadeldridge/cuttle-server/services/history"
+)
+
+var ErrApprovalRequired = errors.New("tile requires approval")
+
+// ApproveRequest holds who is deciding an approval request and where everything is recorded.
+type ApproveRequest struct {
+	User      string           // Username of the approver. Recorded in the audit log.
+	Perms     auth.Permissions // The approver's permissions on the Profile. Must allow APPROVE.
+	Approvals approval.Store   // Where the approval request is kept. Required.
+	Audit     audit.Recorder   // Where the audit entries are recorded. Required.
+	History   history.Recorder // Where the approved run is recorded. Required to approve.
+	// The approver was warned that servers are in maintenance and wants to continue. See
+	// Profile.Silence.
+	IgnoreMaintenance bool
+}
+
+// RequestRun holds a run of the Tile against the Group until another user approves it with
+// Profile.Approve. The request expires after ttl, or approval.DefaultTTL if ttl is 0. The request
+// is recorded in rec.
+func (p Profile) RequestRun(tileName, groupName, user string, ttl time.Duration, store approval.Store, rec audit.Recorder) (approval.Request, error) {
+	if store == nil || rec == nil {
+		return approval.Request{}, errors.New("profiles.Profile.RequestRun: approval store and audit recorder are required")
+	}
+
+	if _, err := p.GetTile(tileName); err != nil {
+		return approval.Request{}, fmt.Errorf("profiles.Profile.RequestRun: %w", err)
+	}
+
+	if _, err := p.ResolveGroup(groupName); err != nil {
+		return approval.Request{}, fmt.Errorf("profiles.Profile.RequestRun: %w", err)
+	}
+
+	r, err := store.ApprovalCreate(approval.NewRequest(p.Name, tileName, groupName, user, ttl))
+	if err != nil {
+		return r, fmt.Errorf("profiles.Profile.RequestRun: %w", err)
+	}
+
+	err = rec.AuditRecord(audit.Entry{
+		User:    user,
+		Action:  audit.ActionRequest,
+		Profile: p.Name,
+		Tile:    tileName,
+		Outcome: audit.OutcomeSuccess,
+		Detail:  fmt.Sprintf("approval %d: run on %s, expires %s", r.ID, groupName, r.Expires.Format(time.RFC3339)),
+	})
+	if err != nil {
+		return r, fmt.Errorf("profiles.Profile.RequestRun: %w", err)
+	}
+
+	return r, nil
+}
+
+// Approve approves the request and runs its Tile. The approver must have the APPROVE permission
+// and cannot be the requester. The approval, naming both users, is recorded in req.Audit before the
+// Tile runs, and denied attempts are recorded too. The run is recorded in req.History as a manual
+// run by the requester. Unless req.IgnoreMaintenance is set, returns ErrUnderMaintenance, naming the
+// servers, if any are silenced and leaves the request pending. Returns the recorded run and the run
+// error.
+func (p Profile) Approve(id int64, req ApproveRequest) (history.Run, error) {
+	if req.History == nil {
+		return history.Run{}, errors.New("profiles.Profile.Approve: history recorder is nil")
+	}
+
+	r, err := p.decide(id, approval.StatusApproved, req)
+	if err != nil {
+		return history.Run{}, fmt.Errorf("profiles.Profile.Approve: %w", err)
+	}
+
+	run := history.Run{Trigger: history.TriggerManual, User: r.Requester}
+	run, err = p.executeRecorded(r.Tile, r.Group, run, req.History, true)
+	if err != nil {
+		return run, fmt.Errorf("profiles.Profile.Approve: %w", err)
+	}
+
+	return run, nil
+}
+
+// Reject rejects the request so it can no longer be approved. The approver must have the APPROVE
+// permission. A requester can reject their own request to withdraw it.
+func (p Profile) Reject(id int64, req ApproveRequest) (approval.Request, error) {
+	r, err := p.decide(id, approval.StatusRejected, req)
+	if err != nil {
+		return r, fmt.Errorf("profiles.Profile.Reject: %w", err)
+	}
+
+	return r, nil
+}
+
+// decide checks the approver, records the decision in the Store, and audits it.
+func (p Profile) decide(id int64, status string, req ApproveRequest) (approval.Request, error) {
+	if req.Approvals == nil || req.Audit == nil {
+		return approval.Request{}, errors.New("approval store and audit recorder are required")
+	}
+
+	r, err := req.Approvals.ApprovalGet(id)
+	if err != nil {
+		return r, err
+	}
+
+	if r.Profile != p.Name {
+		return r, fmt.Errorf("approval %d is for profile %s", id, r.Profile)
+	}
+
+	entry := audit.Entry{
+		User:    req.User,
+		Action:  audit.ActionApprove,
+		Profile: p.Name,
+		Tile:    r.Tile,
+		Detail:  fmt.Sprintf("approval %d: run on %s requested by %s", id, r.Group, r.Requester),
+	}
+	if status == approval.StatusRejected {
+		entry.Action = audit.ActionReject
+	}
+
+	var denied error
+	switch {
+	case status == approval.StatusRejected && req.User == r.Requester:
+		// Withdrawn by the requester.
+	case !req.Perms.CanApprove():
+		denied = fmt.Errorf("%w: %s cannot approve runs", ErrNotPermitted, req.User)
+	case req.User == r.Requester:
+		denied = fmt.Errorf("%w: %s", approval.ErrSelfApproval, req.User)
+	}
+
+	if denied != nil {
+		entry.Outcome = audit.OutcomeDenied
+		return r, errors.Join(denied, req.Audit.AuditRecord(entry))
+	}
+
+	// Warn before the approved run touches servers in maintenance. The request stays pending.
+	if status == approval.StatusApproved && !req.IgnoreMaintenance {
+		if err := p.CheckMaintenance(r.Group); err != nil {
+			return r, err
+		}
+	}
+
+	r, err = req.Approvals.ApprovalDecide(id, status, req.User, time.Now())
+	if err != nil {
+		return r, err
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	entry.Detail = fmt.Sprintf("approval %d: run on %s requested by %s, %s by %s", id, r.Group, r.Requester, status, req.User)
+	if err := req.Audit.AuditRecord(entry); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,170 @@
+package profiles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/approval"
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/auth"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/stretchr/testify/require"
+)
+
+func testApprovalProfile(t *testing.T) Profile {
+	t.Helper()
+	initGroupTest(t, false)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+
+	restart := testNewTile("Restart")
+	restart.RequireApproval = true
+	return Profile{
+		Name:   "Web",
+		Tiles:  map[string]Tile{"Restart": restart, "Check": testNewTile("Check")},
+		Groups: map[string]Group{"Prod": NewGroup("Prod", testServers...)},
+	}
+}
+
+func testApprovePerms() auth.Permissions {
+	perms := auth.NewPermissions()
+	perms.AllowApprove()
+	return perms
+}
+
+func TestApprovalExecuteRequiresApproval(t *testing.T) {
+	require := require.New(t)
+	profile := testApprovalProfile(t)
+
+	require.ErrorIs(profile.Execute("Restart", "Prod"), ErrApprovalRequired, "Execute() ran a Tile which requires approval")
+	require.NoError(profile.Execute("Check", "Prod"), "Execute() returned an error")
+
+	rec := history.NewLog()
+	run, err := profile.ExecuteRecorded("Restart", "Prod", history.Run{Trigger: history.TriggerSchedule, ScheduleID: 1}, rec)
+	require.ErrorIs(err, ErrApprovalRequired, "ExecuteRecorded() ran a Tile which requires approval")
+	require.NotZero(run.ID, "run was not recorded")
+	require.False(run.Passed, "run passed")
+	require.Empty(run.Summary, "servers were checked")
+}
+
+func TestApprovalProfileApprove(t *testing.T) {
+	require := require.New(t)
+	profile := testApprovalProfile(t)
+	store := approval.NewList()
+	log := audit.NewLog()
+	rec := history.NewLog()
+	req := ApproveRequest{User: "bob", Perms: testApprovePerms(), Approvals: store, Audit: log, History: rec}
+
+	r, err := profile.RequestRun("Restart", "Prod", "alice", time.Hour, store, log)
+	require.NoError(err, "RequestRun() returned an error: %s", err)
+	require.Equal(approval.StatusPending, r.Status, "Status did not match")
+	entries, _ := log.AuditList(0)
+	require.Len(entries, 1, "request was not audited")
+	require.Equal(audit.ActionRequest, entries[0].Action, "Action did not match")
+	require.Equal("alice", entries[0].User, "User did not match")
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := profile.RequestRun("Missing", "Prod", "alice", 0, store, log)
+		require.ErrorContains(err, "tile not found", "RequestRun() did not check the Tile")
+		_, err = profile.RequestRun("Restart", "Missing", "alice", 0, store, log)
+		require.ErrorIs(err, ErrGroupNotFound, "RequestRun() did not return ErrGroupNotFound")
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		noPerms := req
+		noPerms.Perms = auth.NewPermissions()
+		_, err := profile.Approve(r.ID, noPerms)
+		require.ErrorIs(err, ErrNotPermitted, "Approve() did not check the permission")
+
+		self := req
+		self.User = "alice"
+		_, err = profile.Approve(r.ID, self)
+		require.ErrorIs(err, approval.ErrSelfApproval, "Approve() allowed the requester to approve")
+
+		entries, _ := log.AuditList(2)
+		for _, e := range entries {
+			require.Equal(audit.OutcomeDenied, e.Outcome, "denied attempt was not audited")
+		}
+
+		got, err := store.ApprovalGet(r.ID)
+		require.NoError(err, "ApprovalGet() returned an error: %s", err)
+		require.Equal(approval.StatusPending, got.Status, "denied attempt changed the request")
+		require.Zero(results.Len(), "denied attempt ran the Tile")
+	})
+
+	t.Run("under maintenance", func(t *testing.T) {
+		silenced := profile
+		silenced.Silenced = map[string]string{testServers[0].GetID(): "maintenance: patching"}
+		_, err := silenced.Approve(r.ID, req)
+		require.ErrorIs(err, ErrUnderMaintenance, "Approve() did not warn about maintenance")
+		require.ErrorContains(err, testServers[0].Name, "Approve() did not name the server")
+
+		got, err := store.ApprovalGet(r.ID)
+		require.NoError(err, "ApprovalGet() returned an error: %s", err)
+		require.Equal(approval.StatusPending, got.Status, "warning changed the request")
+		require.Zero(results.Len(), "warning ran the Tile")
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		run, err := profile.Approve(r.ID, req)
+		require.NoError(err, "Approve() returned an error: %s", err)
+		require.True(run.Passed, "run did not pass")
+		require.Equal("alice", run.User, "run was not recorded for the requester")
+		require.Equal(history.TriggerManual, run.Trigger, "Trigger did not match")
+
+		entries, _ := log.AuditList(1)
+		require.Equal(audit.ActionApprove, entries[0].Action, "approval was not audited")
+		require.Equal(audit.OutcomeSuccess, entries[0].Outcome, "Outcome did not match")
+		require.Equal("bob", entries[0].User, "approver was not audited")
+		require.Contains(entries[0].Detail, "requested by alice", "requester was not audited")
+
+		_, err = profile.Approve(r.ID, req)
+		require.ErrorIs(err, approval.ErrNotPending, "Approve() ran a request twice")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		old := approval.NewRequest("Web", "Restart", "Prod", "alice", time.Hour)
+		old.Created, old.Expires = old.Created.Add(-2*time.Hour), old.Expires.Add(-2*time.Hour)
+		old, err := store.ApprovalCreate(old)
+		require.NoError(err, "ApprovalCreate() returned an error: %s", err)
+
+		_, err = profile.Approve(old.ID, req)
+		require.ErrorIs(err, approval.ErrExpired, "Approve() ran an expired request")
+	})
+
+	t.Run("other profile", func(t *testing.T) {
+		other := profile
+		other.Name = "DB"
+		_, err := other.Approve(r.ID, req)
+		require.Error(err, "Approve() approved a request for another Profile")
+	})
+}
+
+func TestApprovalProfileReject(t *testing.T) {
+	require := require.New(t)
+	profile := testApprovalProfile(t)
+	store := approval.NewList()
+	log := audit.NewLog()
+	req := ApproveRequest{User: "bob", Perms: testApprovePerms(), Approvals: store, Audit: log}
+
+	r, err := profile.RequestRun("Restart", "Prod", "alice", 0, store, log)
+	require.NoError(err, "RequestRun() returned an error: %s", err)
+	r, err = profile.Reject(r.ID, req)
+	require.NoError(err, "Reject() returned an error: %s", err)
+	require.Equal(approval.StatusRejected, r.Status, "Status did not match")
+
+	entries, _ := log.AuditList(1)
+	require.Equal(audit.ActionReject, entries[0].Action, "rejection was not audited")
+
+	_, err = profile.Approve(r.ID, ApproveRequest{User: "bob", Perms: testApprovePerms(), Approvals: store, Audit: log, History: history.NewLog()})
+	require.ErrorIs(err, approval.ErrNotPending, "Approve() ran a rejected request")
+
+	t.Run("withdraw", func(t *testing.T) {
+		r, err := profile.RequestRun("Restart", "Prod", "alice", 0, store, log)
+		require.NoError(err, "RequestRun() returned an error: %s", err)
+
+		withdraw := ApproveRequest{User: "alice", Perms: auth.NewPermissions(), Approvals: store, Audit: log}
+		r, err = profile.Reject(r.ID, withdraw)
+		require.NoError(err, "Reject() returned an error: %s", err)
+		require.Equal("alice", r.Approver, "withdrawal was not recorded")
+	})
+}
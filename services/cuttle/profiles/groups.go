@@ -2,16 +2,30 @@ package profiles
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
 )
 
-var ErrEndOfList = errors.New("end of list")
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrGroupCycle     = errors.New("group includes itself")
+	ErrServerNotFound = errors.New("server not found")
+)
 
 type Group struct {
-	Name    string
-	Servers []connections.Server
-	state   int
+	Name     string
+	Servers  []connections.Server
+	Selector Selector // Picks more servers from the Profile inventory when resolved. nil for static Groups.
+	// Other Groups in the Profile this Group is made from. See Profile.ResolveGroup.
+	Include   []string // Servers in any of these Groups are added. (union)
+	Intersect []string // Only servers also in every one of these Groups are kept. (intersection)
+	Exclude   []string // Servers in any of these Groups are removed. (exclusion)
+	// Connector every server in the Group runs with. nil keeps each server's own Connector.
+	Connector connections.Connector
+	// Connectors used for specific Tiles instead of Group.Connector, keyed by Tile name.
+	TileConnectors map[string]connections.Connector
 }
 
 // NewGroup creates a new Group object with a name and servers.
@@ -21,6 +35,102 @@ func NewGroup(name string, servers ...connections.Server) Group {
 	return g
 }
 
+// NewSelectorGroup creates a Group whose servers are picked from the Profile inventory by their
+// labels each time it runs. See ParseSelector.
+func NewSelectorGroup(name, selector string) (Group, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return Group{}, fmt.Errorf("profiles.NewSelectorGroup: %w", err)
+	}
+
+	if len(sel) == 0 {
+		return Group{}, fmt.Errorf("profiles.NewSelectorGroup: %w: selector was empty", ErrInvalidSelector)
+	}
+
+	return Group{Name: name, Selector: sel}, nil
+}
+
+// IsDynamic returns true if the Group has a Selector.
+func (g Group) IsDynamic() bool { return g.Selector != nil }
+
+// IsComposite returns true if the Group is made from other Groups.
+func (g Group) IsComposite() bool {
+	return len(g.Include) > 0 || len(g.Intersect) > 0 || len(g.Exclude) > 0
+}
+
+// IncludeGroups adds the servers of the named Groups to this Group when it is resolved.
+func (g *Group) IncludeGroups(names ...string) { g.Include = addNames(g.Include, names) }
+
+// IntersectGroups keeps only the servers which are also in every named Group when it is resolved.
+func (g *Group) IntersectGroups(names ...string) { g.Intersect = addNames(g.Intersect, names) }
+
+// ExcludeGroups removes the servers of the named Groups when it is resolved.
+func (g *Group) ExcludeGroups(names ...string) { g.Exclude = addNames(g.Exclude, names) }
+
+// Groups returns the names of every Group this Group is made from.
+func (g Group) Groups() []string {
+	var names []string
+	for _, name := range slices.Concat(g.Include, g.Intersect, g.Exclude) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Resolve returns a copy of the Group with the inventory servers which match Group.Selector added
+// to Group.Servers. Static Groups are returned as is. Other Groups this Group is made from are not
+// resolved. Use Profile.ResolveGroup.
+func (g Group) Resolve(inventory []connections.Server) Group {
+	if !g.IsDynamic() {
+		return g
+	}
+
+	resolved := Group{
+		Name:           g.Name,
+		Selector:       g.Selector,
+		Include:        g.Include,
+		Intersect:      g.Intersect,
+		Exclude:        g.Exclude,
+		Connector:      g.Connector,
+		TileConnectors: g.TileConnectors,
+	}
+	resolved.Servers = append(slices.Clip(g.Servers), g.Selector.Select(inventory)...)
+	resolved.uniq()
+	return resolved
+}
+
+// BindConnector sets the Connector the Group's servers run the Tile with. An empty tile sets the
+// Group default. A nil Connector removes the binding.
+func (g *Group) BindConnector(tile string, c connections.Connector) {
+	if tile == "" {
+		g.Connector = c
+		return
+	}
+
+	if c == nil {
+		delete(g.TileConnectors, tile)
+		return
+	}
+
+	if g.TileConnectors == nil {
+		g.TileConnectors = make(map[string]connections.Connector)
+	}
+
+	g.TileConnectors[tile] = c
+}
+
+// ConnectorFor returns the Connector bound for the Tile, else the Group default. Returns nil if
+// neither is bound and servers keep their own Connector.
+func (g Group) ConnectorFor(tile string) connections.Connector {
+	if c, ok := g.TileConnectors[tile]; ok && tile != "" {
+		return c
+	}
+
+	return g.Connector
+}
+
 // Count returns the number of servers in the Group.Servers array. Shorthand for Group.ServerCount.
 func (g Group) Count() int { return len(g.Servers) }
 
@@ -45,39 +155,68 @@ func (g *Group) AddServers(servers ...connections.Server) {
 	g.uniq()
 }
 
-// Reset sets the Group.state back to 0. This will cause Group.Next() to return the first element.
-func (g *Group) Reset() { g.state = 0 }
+// List returns a copy of Group.Servers to iterate over. Changes to the copy do not change the
+// Group so it is safe to use while the same Group runs elsewhere.
+func (g Group) List() []connections.Server { return slices.Clone(g.Servers) }
 
-// Next returns the current element and advances Group.state by 1.
-func (g *Group) Next() (*connections.Server, error) {
-	// If state is greater than or equal to the number of elements in Group.Servers then we're
-	// reached the end of the list.
-	if g.state >= len(g.Servers) {
-		g.state = 0
-		return nil, ErrEndOfList
+// GetServer returns the server with the ID. See connections.Server.GetID.
+func (g Group) GetServer(id string) (connections.Server, error) {
+	i := slices.IndexFunc(g.Servers, func(s connections.Server) bool { return s.GetID() == id })
+	if i < 0 {
+		return connections.Server{}, fmt.Errorf("profiles.Group.GetServer: %w: %s", ErrServerNotFound, id)
 	}
 
-	// Get a ref to our current server.
-	s := &(g.Servers[g.state])
-
-	// Advance Group.state so we get the next server the next time we're ran.
-	g.state++
-	return s, nil
+	return g.Servers[i], nil
 }
 
-// uniq removes duplicates from Group.Servers.
+// uniq removes duplicates from Group.Servers. Servers are the same if they have the same ID.
 func (g *Group) uniq() {
 	var newGroup []connections.Server
 	f := make(map[string]bool)
 
 	for _, s := range g.Servers {
-		if _, ok := f[s.Name]; ok {
+		if _, ok := f[s.GetID()]; ok {
 			continue
 		}
 
-		f[s.Name] = true
+		f[s.GetID()] = true
 		newGroup = append(newGroup, s)
 	}
 
 	g.Servers = newGroup
 }
+
+// keep removes the servers for which fn returns false.
+func (g *Group) keep(fn func(connections.Server) bool) {
+	g.Servers = slices.DeleteFunc(slices.Clone(g.Servers), func(s connections.Server) bool { return !fn(s) })
+}
+
+// bind sets a copy of the Connector bound for the Tile on every server. Servers are cloned first
+// so the stored Group's servers are not changed.
+func (g *Group) bind(tile string) {
+	c := g.ConnectorFor(tile)
+	if c == nil {
+		return
+	}
+
+	g.Servers = slices.Clone(g.Servers)
+	for i := range g.Servers {
+		g.Servers[i].Connector = c.Clone()
+	}
+}
+
+// has returns true if a server with the ID is in Group.Servers.
+func (g Group) has(id string) bool {
+	return slices.ContainsFunc(g.Servers, func(s connections.Server) bool { return s.GetID() == id })
+}
+
+// addNames appends the names which are not already in list.
+func addNames(list, names []string) []string {
+	for _, name := range names {
+		if name != "" && !slices.Contains(list, name) {
+			list = append(list, name)
+		}
+	}
+
+	return list
+}
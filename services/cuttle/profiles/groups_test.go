@@ -2,6 +2,7 @@ package profiles
 
 import (
 	"bytes"
+	"sync"
 	"testing"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
@@ -146,37 +147,48 @@ func TestGroupsAddServers(t *testing.T) {
 	})
 }
 
-func TestGroupsReset(t *testing.T) {
+func TestGroupsList(t *testing.T) {
 	initGroupTest(t, false)
 	require := require.New(t)
 	group := Group{Name: name1, Servers: testServers}
 
-	for i := 0; i < 2; i++ {
-		_, err := group.Next()
-		require.NoError(err, "Group.Next() returned an error: %s", err)
+	list := group.List()
+	require.Len(list, group.Count(), "List() did not return every server")
+	for i, s := range list {
+		require.Equal(testServers[i].ID, s.ID, "server ID did not match")
 	}
 
-	group.Reset()
-	s, err := group.Next()
-	require.NoError(err, "Group.Next() returned an error: %s", err)
-	require.Equal(testServers[0].Name, s.Name, "server name did not match")
+	list[0].Name = "changed"
+	require.Equal("host1", group.Servers[0].Name, "List() did not return a copy")
+
+	// Every caller gets its own snapshot so the same Group can be iterated at the same time.
+	var wg sync.WaitGroup
+	counts := make([]int, 4)
+	for i := range counts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range group.List() {
+				counts[i]++
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.Equal([]int{3, 3, 3, 3}, counts, "concurrent List() calls did not see every server")
 }
 
-func TestGroupsNext(t *testing.T) {
+func TestGroupsGetServer(t *testing.T) {
 	initGroupTest(t, false)
 	require := require.New(t)
-	group := Group{Name: name1, Servers: testServers}
+	group := NewGroup(name1, testServers...)
 
-	for i := 0; i <= group.Count(); i++ {
-		s, err := group.Next()
-		if i == group.Count() {
-			require.Equal(ErrEndOfList, err, "did not get 'end of list' error")
-			return
-		}
+	s, err := group.GetServer(testServers[1].ID)
+	require.NoError(err, "GetServer() returned an error: %s", err)
+	require.Equal("host2", s.Name, "server did not match")
 
-		require.NoError(err, "Group.Next() returned an error: %s", err)
-		require.Equal(testServers[i].Name, s.Name, "server name did not match")
-	}
+	_, err = group.GetServer("missing")
+	require.ErrorIs(err, ErrServerNotFound, "GetServer() did not return ErrServerNotFound")
 }
 
 func TestGroupsUniq(t *testing.T) {
@@ -190,7 +202,51 @@ func TestGroupsUniq(t *testing.T) {
 	group.uniq()
 	require.Len(group.Servers, 3, "duplicate servers not removed")
 
+	// Servers are the same by ID, so a renamed copy is still a duplicate.
+	renamed := testServers[1]
+	renamed.Name = "renamed"
+	group.AddServers(renamed)
+	require.Len(group.Servers, 3, "renamed server was not a duplicate")
+
 	for i := range group.Count() {
 		require.Equal(testServers[i].Name, group.Servers[i].Name, "server name did not match")
 	}
 }
+
+func TestGroupsComposite(t *testing.T) {
+	require := require.New(t)
+
+	g := NewGroup(name1)
+	require.False(g.IsComposite(), "IsComposite() returned true")
+
+	g.IncludeGroups("a", "b", "a", "")
+	g.IntersectGroups("c")
+	g.ExcludeGroups("b", "d")
+	require.True(g.IsComposite(), "IsComposite() returned false")
+	require.Equal([]string{"a", "b"}, g.Include, "Include did not match")
+	require.Equal([]string{"c"}, g.Intersect, "Intersect did not match")
+	require.Equal([]string{"b", "d"}, g.Exclude, "Exclude did not match")
+	require.Equal([]string{"a", "b", "c", "d"}, g.Groups(), "Groups() did not match")
+}
+
+func TestGroupsBindConnector(t *testing.T) {
+	require := require.New(t)
+	deploy, err := connections.NewMockConnector("deploy", "deploy")
+	require.NoError(err, "NewMockConnector() returned an error: %s", err)
+	backup, err := connections.NewMockConnector("backup", "backup")
+	require.NoError(err, "NewMockConnector() returned an error: %s", err)
+
+	g := NewGroup(name1)
+	require.Nil(g.ConnectorFor("Tile1"), "ConnectorFor() returned a Connector for an unbound Group")
+
+	g.BindConnector("", &deploy)
+	g.BindConnector("Backup", &backup)
+	require.Equal(&deploy, g.ConnectorFor("Tile1"), "ConnectorFor() did not return the Group default")
+	require.Equal(&deploy, g.ConnectorFor(""), "ConnectorFor() did not return the Group default")
+	require.Equal(&backup, g.ConnectorFor("Backup"), "ConnectorFor() did not return the Tile binding")
+
+	g.BindConnector("Backup", nil)
+	require.Equal(&deploy, g.ConnectorFor("Backup"), "BindConnector() did not remove the Tile binding")
+	g.BindConnector("", nil)
+	require.Nil(g.ConnectorFor("Tile1"), "BindConnector() did not remove the Group default")
+}
@@ -0,0 +1,100 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+)
+
+var ErrUnderMaintenance = errors.New("servers are in maintenance")
+
+// Silence marks the servers covered by the Windows active at now so their checks are skipped. A
+// Group Window covers every server the Group resolves to. Windows for other Profiles or for Groups
+// not in this Profile are ignored. Profile.Silenced is replaced so copies of the Profile are not
+// changed.
+func (p *Profile) Silence(windows []maintenance.Window, now time.Time) {
+	silenced := maps.Clone(p.Silenced)
+	if silenced == nil {
+		silenced = make(map[string]string)
+	}
+
+	mark := func(s connections.Server, w maintenance.Window) {
+		if _, ok := silenced[s.GetID()]; !ok {
+			silenced[s.GetID()] = w.String()
+		}
+	}
+
+	for _, w := range windows {
+		if !w.Active(now) || !w.AppliesTo(p.Name) {
+			continue
+		}
+
+		switch w.Kind {
+		case maintenance.KindGroup:
+			g, err := p.resolveGroup(w.Target, "", nil)
+			if err != nil {
+				continue
+			}
+
+			for _, s := range g.Servers {
+				mark(s, w)
+			}
+		case maintenance.KindServer:
+			for _, s := range p.allServers() {
+				if s.ID == w.Target || s.Name == w.Target {
+					mark(s, w)
+				}
+			}
+		}
+	}
+
+	p.Silenced = silenced
+}
+
+// UnderMaintenance returns the names of the Group's servers which are silenced and why, in Group
+// order. Use it to warn before a manual run touches them.
+func (p Profile) UnderMaintenance(groupName string) ([]string, error) {
+	g, err := p.ResolveGroup(groupName)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.Profile.UnderMaintenance: %w", err)
+	}
+
+	var names []string
+	for _, s := range g.Servers {
+		if why, ok := p.Silenced[s.GetID()]; ok {
+			names = append(names, fmt.Sprintf("%s: %s", s.Name, why))
+		}
+	}
+
+	return names, nil
+}
+
+// CheckMaintenance returns ErrUnderMaintenance, naming the servers and why, if any of the Group's
+// servers are silenced. Manual runs call it to warn the user before touching them.
+func (p Profile) CheckMaintenance(groupName string) error {
+	names, err := p.UnderMaintenance(groupName)
+	if err != nil {
+		return fmt.Errorf("profiles.Profile.CheckMaintenance: %w", err)
+	}
+
+	if len(names) > 0 {
+		return fmt.Errorf("profiles.Profile.CheckMaintenance: %w: %s", ErrUnderMaintenance, strings.Join(names, "; "))
+	}
+
+	return nil
+}
+
+// allServers returns the inventory and every server only in a Group.
+func (p Profile) allServers() []connections.Server {
+	all := NewGroup("", p.Servers...)
+	for _, g := range p.Groups {
+		all.AddServers(g.Servers...)
+	}
+
+	return all.Servers
+}
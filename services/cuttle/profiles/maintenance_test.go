@@ -0,0 +1,127 @@
+package profiles
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesSilence(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	now := time.Now()
+	window := func(profile, kind, target string, start, end time.Duration) maintenance.Window {
+		return maintenance.Window{Profile: profile, Kind: kind, Target: target, Start: now.Add(start), End: now.Add(end)}
+	}
+
+	profile := Profile{
+		Name: "Web",
+		Groups: map[string]Group{
+			"Group1": NewGroup("Group1", testServers[0]),
+			"Group2": NewGroup("Group2", testServers[1:]...),
+		},
+	}
+
+	stored := profile
+	profile.Silence([]maintenance.Window{
+		window("Web", maintenance.KindGroup, "Group1", -time.Hour, time.Hour),
+		window("", maintenance.KindServer, testServers[1].ID, -time.Hour, time.Hour),
+		window("Web", maintenance.KindServer, "host3", time.Hour, 2*time.Hour),
+		window("Other", maintenance.KindServer, "host3", -time.Hour, time.Hour),
+		window("Web", maintenance.KindGroup, "Missing", -time.Hour, time.Hour),
+	}, now)
+
+	require.Len(profile.Silenced, 2, "Silence() did not mark only the active windows")
+	require.Contains(profile.Silenced, testServers[0].ID, "Group window was not applied")
+	require.Contains(profile.Silenced, testServers[1].ID, "server window was not applied")
+	require.Nil(stored.Silenced, "Silence() changed a copy of the Profile")
+
+	names, err := profile.UnderMaintenance("Group2")
+	require.NoError(err, "UnderMaintenance() returned an error: %s", err)
+	require.Len(names, 1, "UnderMaintenance() did not match")
+	require.True(strings.HasPrefix(names[0], "host2: maintenance"), "UnderMaintenance() did not say why")
+
+	_, err = profile.UnderMaintenance("Missing")
+	require.ErrorIs(err, ErrGroupNotFound, "UnderMaintenance() did not return ErrGroupNotFound")
+
+	err = profile.CheckMaintenance("Group2")
+	require.ErrorIs(err, ErrUnderMaintenance, "CheckMaintenance() did not return ErrUnderMaintenance")
+	require.ErrorContains(err, "host2: maintenance", "CheckMaintenance() did not name the server")
+	require.NoError(stored.CheckMaintenance("Group2"), "CheckMaintenance() warned with no servers silenced")
+	require.ErrorIs(profile.CheckMaintenance("Missing"), ErrGroupNotFound, "CheckMaintenance() did not return ErrGroupNotFound")
+
+	t.Run("by name", func(t *testing.T) {
+		p := stored
+		p.Silence([]maintenance.Window{window("Web", maintenance.KindServer, "host3", -time.Hour, time.Hour)}, now)
+		require.Contains(p.Silenced, testServers[2].ID, "server window did not match the name")
+	})
+}
+
+func TestProfilesExecuteSilenced(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+
+	profile := Profile{
+		Name:   "Web",
+		Tiles:  map[string]Tile{"Tile1": testNewTile("Tile1")},
+		Groups: map[string]Group{"Group1": NewGroup("Group1", testServers...)},
+	}
+
+	now := time.Now()
+	profile.Silence([]maintenance.Window{
+		{ID: 7, Kind: maintenance.KindServer, Target: "host2", Reason: "patching", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+	}, now)
+
+	rec := history.NewLog()
+	run, err := profile.ExecuteRecorded("Tile1", "Group1", history.Run{Trigger: history.TriggerManual}, rec)
+	require.NoError(err, "ExecuteRecorded() returned an error: %s", err)
+	require.Equal([]string{"host2"}, run.Skipped, "Skipped did not match")
+	require.False(run.Silenced, "run was silenced while servers still ran")
+	require.Contains(run.Summary, "host2: skipped, maintenance 7 until", "Summary was not annotated")
+	require.Contains(run.Summary, "(patching)", "Summary did not include the reason")
+
+	profile.Silence([]maintenance.Window{
+		{Kind: maintenance.KindGroup, Target: "Group1", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+	}, now)
+	run, err = profile.ExecuteRecorded("Tile1", "Group1", history.Run{Trigger: history.TriggerManual}, rec)
+	require.NoError(err, "ExecuteRecorded() returned an error: %s", err)
+	require.Len(run.Skipped, 3, "every server was not skipped")
+	require.True(run.Silenced, "run was not silenced")
+}
+
+func TestProfilesRemediateUnderMaintenance(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+
+	up := false
+	restart := &testRestart{up: &up, fixes: true}
+	profile := Profile{
+		Name:   "Web",
+		Tiles:  map[string]Tile{"Nginx": testRemediationTile(t, &up, restart)},
+		Groups: map[string]Group{"Group1": NewGroup("Group1", testServers...)},
+	}
+
+	now := time.Now()
+	profile.Silence([]maintenance.Window{
+		{Kind: maintenance.KindServer, Target: "host1", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+	}, now)
+
+	req := RemediateRequest{User: "admin", Perms: testExecutePerms(), Confirmed: true, Audit: audit.NewLog()}
+	_, err := profile.Remediate(context.Background(), "Nginx", "Group1", req)
+	require.ErrorIs(err, ErrUnderMaintenance, "Remediate() did not warn about maintenance")
+	require.ErrorContains(err, "host1", "warning did not name the server")
+	require.Zero(restart.calls, "Remediate() touched a server in maintenance")
+
+	req.IgnoreMaintenance = true
+	res, err := profile.Remediate(context.Background(), "Nginx", "Group1", req)
+	require.NoError(err, "Remediate() returned an error: %s", err)
+	require.Len(res, len(testServers), "a server was not remediated")
+}
@@ -1,15 +1,27 @@
 package profiles
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/history"
 )
 
 // Profile holds the Groups and command Tiles uses to run tests.
 type Profile struct {
-	Name   string
-	Tiles  map[string]Tile  // List of command Tiles that can be run against these server groups.
-	Groups map[string]Group // List of groups to test against.
+	Name    string
+	Tiles   map[string]Tile      // List of command Tiles that can be run against these server groups.
+	Groups  map[string]Group     // List of groups to test against.
+	Servers []connections.Server // Inventory selector Groups pick their servers from.
+	// Servers in maintenance, by server ID, with why. Their checks are skipped. See Silence.
+	Silenced map[string]string
 }
 
 // NewProfile creates a new Profile object with a display Name and at least one Group.
@@ -91,6 +103,56 @@ func (p *Profile) AddGroups(groups ...Group) error {
 	return errs
 }
 
+// AddServers adds the servers to the Profile inventory. A server with the same ID as one already in
+// the inventory replaces it so relabeled or renamed servers can be added again. A new server with
+// the same Name as one in the inventory also replaces it since Names are unique in the inventory.
+func (p *Profile) AddServers(servers ...connections.Server) {
+	for _, server := range servers {
+		i := slices.IndexFunc(p.Servers, func(s connections.Server) bool { return s.GetID() == server.GetID() })
+		if i < 0 {
+			i = slices.IndexFunc(p.Servers, func(s connections.Server) bool { return s.Name == server.Name })
+		}
+
+		if i < 0 {
+			p.Servers = append(p.Servers, server)
+			continue
+		}
+
+		p.Servers[i] = server
+	}
+}
+
+// Select returns the inventory servers which currently match the selector. Use it to preview a
+// selector before creating a Group with it.
+func (p Profile) Select(selector string) ([]connections.Server, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.Profile.Select: %w", err)
+	}
+
+	return sel.Select(p.Servers), nil
+}
+
+// GetServer retrieves the server by ID from the inventory or, for servers only in a Group, from
+// the Groups. See connections.Server.GetID.
+func (p Profile) GetServer(id string) (connections.Server, error) {
+	if id == "" {
+		return connections.Server{}, errors.New("profiles.Profile.GetServer: id was empty")
+	}
+
+	if s, err := NewGroup("", p.Servers...).GetServer(id); err == nil {
+		return s, nil
+	}
+
+	for _, g := range p.Groups {
+		if s, err := g.GetServer(id); err == nil {
+			return s, nil
+		}
+	}
+
+	return connections.Server{}, fmt.Errorf("profiles.Profile.GetServer: %w: %s", ErrServerNotFound, id)
+}
+
 // GetTile retrieves the Tile by name from Profile.Tiles.
 func (p Profile) GetTile(name string) (Tile, error) {
 	var t Tile
@@ -115,30 +177,213 @@ func (p Profile) GetGroup(name string) (Group, error) {
 
 	g, ok := p.Groups[name]
 	if !ok {
-		return g, errors.New("profiles.Profile.GetGroup: group not found")
+		return g, fmt.Errorf("profiles.Profile.GetGroup: %w: %s", ErrGroupNotFound, name)
+	}
+
+	return g, nil
+}
+
+// ResolveGroup retrieves the Group by name and flattens it into the servers it runs against. Its
+// Selector is resolved against the inventory, then the servers of the included Groups are added,
+// then only servers in every intersected Group are kept, then the servers of excluded Groups are
+// removed. A Group with no servers, Selector, or included Groups starts from the servers of its
+// first intersected Group. Returns ErrGroupCycle if the Group is made from itself. Servers run with the Group's
+// default Connector if one is bound. Use ResolveGroupFor to resolve it for a Tile.
+func (p Profile) ResolveGroup(name string) (Group, error) {
+	g, err := p.resolveGroup(name, "", nil)
+	if err != nil {
+		return g, fmt.Errorf("profiles.Profile.ResolveGroup: %w", err)
+	}
+
+	return g, nil
+}
+
+// ResolveGroupFor resolves the Group like ResolveGroup with the Connectors bound for the Tile. A
+// Group's binding applies to every server it resolves to, including those from other Groups, so
+// the outermost bound Group wins. See Group.BindConnector.
+func (p Profile) ResolveGroupFor(name, tile string) (Group, error) {
+	g, err := p.resolveGroup(name, tile, nil)
+	if err != nil {
+		return g, fmt.Errorf("profiles.Profile.ResolveGroupFor: %w", err)
 	}
 
 	return g, nil
 }
 
+// resolveGroup resolves the Group for the tile. path is the Groups being resolved which led to
+// this one.
+func (p Profile) resolveGroup(name, tile string, path []string) (Group, error) {
+	if slices.Contains(path, name) {
+		return Group{}, fmt.Errorf("%w: %s", ErrGroupCycle, strings.Join(append(path, name), " -> "))
+	}
+
+	g, ok := p.Groups[name]
+	if !ok {
+		if len(path) > 0 {
+			return g, fmt.Errorf("%s: %w: %s", path[len(path)-1], ErrGroupNotFound, name)
+		}
+
+		return g, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+
+	resolved := g.Resolve(p.Servers)
+	if !g.IsComposite() {
+		resolved.bind(tile)
+		return resolved, nil
+	}
+
+	path = append(slices.Clip(path), name)
+	sets := make(map[string]Group)
+	for _, other := range g.Groups() {
+		r, err := p.resolveGroup(other, tile, path)
+		if err != nil {
+			return resolved, err
+		}
+
+		sets[other] = r
+	}
+
+	// Clone so the stored Group's servers are not changed.
+	resolved.Servers = slices.Clone(resolved.Servers)
+	for _, other := range g.Include {
+		resolved.AddServers(sets[other].Servers...)
+	}
+
+	// A Group with only intersected Groups starts from the first so it is not always empty.
+	if len(g.Servers) == 0 && !g.IsDynamic() && len(g.Include) == 0 && len(g.Intersect) > 0 {
+		resolved.AddServers(sets[g.Intersect[0]].Servers...)
+	}
+
+	for _, other := range g.Intersect {
+		resolved.keep(func(s connections.Server) bool { return sets[other].has(s.GetID()) })
+	}
+
+	for _, other := range g.Exclude {
+		resolved.keep(func(s connections.Server) bool { return !sets[other].has(s.GetID()) })
+	}
+
+	resolved.bind(tile)
+	return resolved, nil
+}
+
+// ValidateGroups checks that every Group made from other Groups names Groups in the Profile and
+// does not include itself.
+func (p Profile) ValidateGroups() error {
+	var errs []error
+	names := make([]string, 0, len(p.Groups))
+	for name := range p.Groups {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := p.resolveGroup(name, "", nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("profiles.Profile.ValidateGroups: %w", err)
+	}
+
+	return nil
+}
+
 // Execute runs the Tile command against each server in the selected group. Execute also replaces
-// special variables in the command and expect with the appropriate values.
+// special variables in the command and expect with the appropriate values. Silenced servers are
+// skipped. Returns ErrApprovalRequired if the Tile requires approval. See Profile.Approve.
 func (p Profile) Execute(tileName, groupName string) error {
+	if p.needsApproval(tileName) {
+		return fmt.Errorf("profiles.Profile.Execute: %w: %s", ErrApprovalRequired, tileName)
+	}
+
+	_, _, err := p.execute(tileName, groupName)
+	if err != nil {
+		return fmt.Errorf("profiles.Profile.Execute: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteRecorded runs Execute and records the run in rec. run sets who started it: Trigger, and
+// User or ScheduleID. The rest of run is filled in here. Returns the recorded run and the Execute
+// error. A run is recorded even if the tile or group was not found, or the Tile requires approval.
+func (p Profile) ExecuteRecorded(tileName, groupName string, run history.Run, rec history.Recorder) (history.Run, error) {
+	if rec == nil {
+		return run, errors.New("profiles.Profile.ExecuteRecorded: history recorder is nil")
+	}
+
+	run, err := p.executeRecorded(tileName, groupName, run, rec, false)
+	if err != nil {
+		return run, fmt.Errorf("profiles.Profile.ExecuteRecorded: %w", err)
+	}
+
+	return run, nil
+}
+
+// executeRecorded runs the Tile and records the run in rec. Unless approved is true, a Tile which
+// requires approval is not ran and the run is recorded with ErrApprovalRequired.
+func (p Profile) executeRecorded(tileName, groupName string, run history.Run, rec history.Recorder, approved bool) (history.Run, error) {
+	run.Profile, run.Tile, run.Group = p.Name, tileName, groupName
+	run.Started = time.Now()
+	var summaries []TileSummary
+	var skipped []connections.Server
+	var err error
+	if !approved && p.needsApproval(tileName) {
+		err = fmt.Errorf("%w: %s", ErrApprovalRequired, tileName)
+	} else {
+		summaries, skipped, err = p.execute(tileName, groupName)
+	}
+
+	run.Duration = time.Since(run.Started)
+	run.Passed = err == nil
+	run.Silenced = len(skipped) > 0 && len(summaries) == 0
+
+	var lines []string
+	for _, sum := range summaries {
+		lines = append(lines, fmt.Sprintf("%s: %s", sum.Server, sum))
+	}
+
+	for _, s := range skipped {
+		run.Skipped = append(run.Skipped, s.Name)
+		lines = append(lines, fmt.Sprintf("%s: skipped, %s", s.Hostname, p.Silenced[s.GetID()]))
+	}
+
+	run.Summary = strings.Join(lines, "; ")
+	if err != nil {
+		run.Err = err.Error()
+	}
+
+	run, recErr := rec.RunRecord(run)
+	return run, errors.Join(err, recErr)
+}
+
+// needsApproval returns true if the Tile exists and requires approval.
+func (p Profile) needsApproval(tileName string) bool {
+	tile, err := p.GetTile(tileName)
+	return err == nil && tile.RequireApproval
+}
+
+// execute runs the Tile against each server in the Group and returns the summary of each server
+// and the silenced servers which were skipped.
+func (p Profile) execute(tileName, groupName string) ([]TileSummary, []connections.Server, error) {
 	tile, err := p.GetTile(tileName)
 	if err != nil {
-		return fmt.Errorf("profiles.Profile.Execute: %s", err)
+		return nil, nil, err
 	}
 
-	group, err := p.GetGroup(groupName)
+	group, err := p.ResolveGroupFor(groupName, tileName)
 	if err != nil {
-		return fmt.Errorf("profiles.Profile.Execute: %s", err)
+		return nil, nil, err
 	}
 
+	var summaries []TileSummary
+	var skipped []connections.Server
 	var errs error
-	for {
-		server, err := group.Next()
-		if err == ErrEndOfList {
-			break
+	for _, server := range group.List() {
+		if _, ok := p.Silenced[server.GetID()]; ok {
+			skipped = append(skipped, server)
+			continue
 		}
 
 		// INCOMPLETE: Add special variable replacement in the command and expect strings.
@@ -153,12 +398,75 @@ func (p Profile) Execute(tileName, groupName string) error {
 			}
 		*/
 
-		err = tile.Run(*server)
-		if err != nil {
-			errs = errors.Join(errs, err)
-			continue
+		run, done := runServer(server)
+		sum := tile.RunSummary(run)
+		done()
+		summaries = append(summaries, sum)
+		errs = errors.Join(errs, sum.Err)
+	}
+
+	return summaries, skipped, errs
+}
+
+// outputMu guards the Buffers of the Profile's servers while the output of a run is added to them.
+var outputMu sync.Mutex
+
+// runServer returns a copy of the server which writes to its own Buffers so runs of the same
+// server at the same time do not share them. Call done once the run is over to add its output to
+// the server's Buffers.
+func runServer(server connections.Server) (run connections.Server, done func()) {
+	run = server
+	run.Buffers = connections.NewBuffers(server.Hostname, &bytes.Buffer{}, &bytes.Buffer{})
+	run.Buffers.User = server.Buffers.User
+	return run, func() {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		if server.Results != nil {
+			server.Results.Write(run.Results.Bytes())
+		}
+
+		if server.Logs != nil {
+			server.Logs.Write(run.Logs.Bytes())
 		}
 	}
+}
 
-	return errs
+// Remediate runs the Tile's Remediation against each server in the selected group. See
+// Tile.Remediate. Returns the result for each server which got past the permission and
+// confirmation checks. Returns ErrUnderMaintenance, naming the servers, if any are silenced unless
+// req.IgnoreMaintenance is set. Returns ErrApprovalRequired if the Tile requires approval.
+func (p Profile) Remediate(ctx context.Context, tileName, groupName string, req RemediateRequest) ([]RemediationResult, error) {
+	tile, err := p.GetTile(tileName)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.Profile.Remediate: %w", err)
+	}
+
+	group, err := p.ResolveGroupFor(groupName, tileName)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.Profile.Remediate: %w", err)
+	}
+
+	if !req.IgnoreMaintenance {
+		if err := p.CheckMaintenance(groupName); err != nil {
+			return nil, fmt.Errorf("profiles.Profile.Remediate: %w", err)
+		}
+	}
+
+	req.Profile = p.Name
+	var results []RemediationResult
+	var errs error
+	for _, server := range group.List() {
+		run, done := runServer(server)
+		res, err := tile.Remediate(ctx, run, req)
+		done()
+		if errors.Is(err, ErrNoRemediation) || errors.Is(err, ErrNotPermitted) ||
+			errors.Is(err, ErrConfirmationRequired) || errors.Is(err, ErrApprovalRequired) {
+			return nil, fmt.Errorf("profiles.Profile.Remediate: %w", err)
+		}
+
+		results = append(results, res)
+		errs = errors.Join(errs, err)
+	}
+
+	return results, errs
 }
@@ -1,9 +1,13 @@
 package profiles
 
 import (
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
 	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
 	"github.com/stretchr/testify/require"
 )
 
@@ -186,6 +190,38 @@ func TestProfilesGetTile(t *testing.T) {
 	})
 }
 
+func TestProfilesGetServer(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	only := createNewServer(t, "host4", false)
+	profile, err := NewProfile("TestProfile", NewGroup("Group1", only))
+	require.NoError(err, "NewProfile() returned an error: %s", err)
+	profile.AddServers(testServers...)
+
+	s, err := profile.GetServer(testServers[0].ID)
+	require.NoError(err, "GetServer() returned an error: %s", err)
+	require.Equal("host1", s.Name, "server did not match")
+
+	s, err = profile.GetServer(only.ID)
+	require.NoError(err, "GetServer() returned an error: %s", err)
+	require.Equal("host4", s.Name, "group only server was not found")
+
+	_, err = profile.GetServer("missing")
+	require.ErrorIs(err, ErrServerNotFound, "GetServer() did not return ErrServerNotFound")
+	_, err = profile.GetServer("")
+	require.Error(err, "GetServer() did not return an error")
+
+	t.Run("renamed", func(t *testing.T) {
+		renamed := testServers[0]
+		require.NoError(renamed.SetName("web1"))
+		profile.AddServers(renamed)
+		require.Len(profile.Servers, 3, "renamed server was added again")
+		s, err := profile.GetServer(renamed.ID)
+		require.NoError(err, "GetServer() returned an error: %s", err)
+		require.Equal("web1", s.Name, "renamed server did not replace the old one")
+	})
+}
+
 func TestProfilesGetGroup(t *testing.T) {
 	initGroupTest(t, false)
 	require := require.New(t)
@@ -200,7 +236,7 @@ func TestProfilesGetGroup(t *testing.T) {
 
 	t.Run("does not exist", func(t *testing.T) {
 		got, err := profile.GetGroup("missing group")
-		require.Error(err, "GetGroup() did not return an error")
+		require.ErrorIs(err, ErrGroupNotFound, "GetGroup() did not return ErrGroupNotFound")
 		require.Equal(Group{}, got)
 	})
 
@@ -211,6 +247,162 @@ func TestProfilesGetGroup(t *testing.T) {
 	})
 }
 
+// testServerNamesOf returns the names of the servers in the Group.
+func testServerNamesOf(g Group) []string {
+	var names []string
+	for _, s := range g.Servers {
+		names = append(names, s.Name)
+	}
+
+	return names
+}
+
+func TestProfilesResolveGroup(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	host4 := createNewServer(t, "host4", false)
+	require.NoError(host4.SetLabel("env", "prod"))
+	host1, host2, host3 := testServers[0], testServers[1], testServers[2]
+
+	prod, err := NewSelectorGroup("prod", "env=prod")
+	require.NoError(err, "NewSelectorGroup() returned an error: %s", err)
+	prod.AddServers(host1)
+
+	all := NewGroup("all-web")
+	all.IncludeGroups("web-east", "web-west", "web-east")
+	prodWeb := NewGroup("prod-web")
+	prodWeb.IncludeGroups("all-web")
+	prodWeb.IntersectGroups("prod")
+	safe := NewGroup("safe", host4)
+	safe.IncludeGroups("all-web")
+	safe.ExcludeGroups("prod", "drain")
+	eastProd := NewGroup("east-prod")
+	eastProd.IntersectGroups("web-east", "prod")
+
+	profile := Profile{
+		Name:    "TestProfile",
+		Servers: []connections.Server{host4},
+		Groups: map[string]Group{
+			"web-east":  NewGroup("web-east", host1, host2),
+			"web-west":  NewGroup("web-west", host2, host3),
+			"prod":      prod,
+			"drain":     NewGroup("drain", host3),
+			"all-web":   all,
+			"prod-web":  prodWeb,
+			"safe":      safe,
+			"east-prod": eastProd,
+		},
+	}
+
+	for name, want := range map[string][]string{
+		"web-east":  {"host1", "host2"},
+		"prod":      {"host1", "host4"},
+		"all-web":   {"host1", "host2", "host3"},
+		"prod-web":  {"host1"},
+		"safe":      {"host2"},
+		"east-prod": {"host1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g, err := profile.ResolveGroup(name)
+			require.NoError(err, "ResolveGroup() returned an error: %s", err)
+			require.Equal(want, testServerNamesOf(g), "servers did not match")
+		})
+	}
+
+	require.Equal([]string{"web-east", "web-west"}, profile.Groups["all-web"].Include, "Include was not deduplicated")
+	require.Empty(profile.Groups["all-web"].Servers, "ResolveGroup() changed the stored Group")
+	require.Equal([]string{"host4"}, testServerNamesOf(profile.Groups["safe"]), "ResolveGroup() changed the stored Group")
+	require.NoError(profile.ValidateGroups(), "ValidateGroups() returned an error")
+
+	t.Run("execute", func(t *testing.T) {
+		t.Cleanup(func() { results.Reset(); logs.Reset() })
+		profile.Tiles = map[string]Tile{"Tile1": testNewTile("Tile1")}
+		summaries, _, err := profile.execute("Tile1", "all-web")
+		require.NoError(err, "execute() returned an error: %s", err)
+		require.Len(summaries, 3, "execute() did not run on the flattened group")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := profile.ResolveGroup("missing")
+		require.ErrorIs(err, ErrGroupNotFound, "ResolveGroup() did not return ErrGroupNotFound")
+
+		bad := NewGroup("bad")
+		bad.ExcludeGroups("missing")
+		profile.Groups["bad"] = bad
+		t.Cleanup(func() { delete(profile.Groups, "bad") })
+		_, err = profile.ResolveGroup("bad")
+		require.ErrorIs(err, ErrGroupNotFound, "ResolveGroup() did not return ErrGroupNotFound")
+		require.ErrorContains(err, "bad: group not found: missing", "error did not name the group")
+		require.ErrorIs(profile.ValidateGroups(), ErrGroupNotFound, "ValidateGroups() did not return ErrGroupNotFound")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a, b := NewGroup("a"), NewGroup("b")
+		a.IncludeGroups("web-east", "b")
+		b.IntersectGroups("a")
+		profile.Groups["a"], profile.Groups["b"] = a, b
+		t.Cleanup(func() { delete(profile.Groups, "a"); delete(profile.Groups, "b") })
+
+		_, err := profile.ResolveGroup("a")
+		require.ErrorIs(err, ErrGroupCycle, "ResolveGroup() did not return ErrGroupCycle")
+		require.ErrorContains(err, "a -> b -> a", "error did not include the cycle")
+		require.ErrorIs(profile.ValidateGroups(), ErrGroupCycle, "ValidateGroups() did not return ErrGroupCycle")
+	})
+}
+
+func TestProfilesResolveGroupFor(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	deploy, err := connections.NewMockConnector("deploy", "deploy")
+	require.NoError(err, "NewMockConnector() returned an error: %s", err)
+	backup, err := connections.NewMockConnector("backup", "backup")
+	require.NoError(err, "NewMockConnector() returned an error: %s", err)
+
+	web := NewGroup("web", testServers...)
+	web.BindConnector("Backup", &backup)
+	all := NewGroup("all")
+	all.IncludeGroups("web")
+	all.BindConnector("", &deploy)
+	profile := Profile{
+		Name:   "TestProfile",
+		Groups: map[string]Group{"web": web, "all": all},
+	}
+
+	connectorOf := func(g Group) []string {
+		var names []string
+		for _, s := range g.Servers {
+			names = append(names, s.Connector.GetUser())
+		}
+
+		return names
+	}
+
+	t.Run("unbound", func(t *testing.T) {
+		g, err := profile.ResolveGroupFor("web", "Tile1")
+		require.NoError(err, "ResolveGroupFor() returned an error: %s", err)
+		require.Equal([]string{"test", "test", "test"}, connectorOf(g), "servers did not keep their Connector")
+	})
+
+	t.Run("tile binding", func(t *testing.T) {
+		g, err := profile.ResolveGroupFor("web", "Backup")
+		require.NoError(err, "ResolveGroupFor() returned an error: %s", err)
+		require.Equal([]string{"backup", "backup", "backup"}, connectorOf(g), "Tile binding was not used")
+		require.Equal("test", profile.Groups["web"].Servers[0].Connector.GetUser(), "ResolveGroupFor() changed the stored Group")
+		require.NotSame(g.Servers[0].Connector, g.Servers[1].Connector, "servers shared the bound Connector")
+		require.NotSame(&backup, g.Servers[0].Connector, "the bound Connector was not copied")
+	})
+
+	t.Run("outer group wins", func(t *testing.T) {
+		g, err := profile.ResolveGroupFor("all", "Backup")
+		require.NoError(err, "ResolveGroupFor() returned an error: %s", err)
+		require.Equal([]string{"deploy", "deploy", "deploy"}, connectorOf(g), "outer Group binding was not used")
+
+		g, err = profile.ResolveGroup("all")
+		require.NoError(err, "ResolveGroup() returned an error: %s", err)
+		require.Equal([]string{"deploy", "deploy", "deploy"}, connectorOf(g), "Group default was not used")
+	})
+}
+
 func TestProfilesExecute(t *testing.T) {
 	initGroupTest(t, false)
 	require := require.New(t)
@@ -241,3 +433,88 @@ func TestProfilesExecute(t *testing.T) {
 		require.Error(err, "Execute() did not return an error")
 	})
 }
+
+func TestProfilesExecuteConcurrent(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	t.Cleanup(func() {
+		connections.Pool.CloseAll()
+		results.Reset()
+		logs.Reset()
+	})
+
+	// SSHTest opens the servers through the Pool, so runs share the pooled Connectors.
+	sshTest, err := tests.NewSSHTest("Echo", true, "echo ok", "line:ok")
+	require.NoError(err, "NewSSHTest() returned an error: %s", err)
+	parallel := NewTile("Parallel", sshTest, sshTest)
+	parallel.RunInParallel()
+	profile := Profile{
+		Name:   "TestProfile",
+		Tiles:  map[string]Tile{"Echo": NewTile("Echo", sshTest, sshTest), "Parallel": parallel},
+		Groups: map[string]Group{"Group1": {Name: "Group1", Servers: testServers}},
+	}
+
+	const runs = 8
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tile := "Echo"
+			if i%2 == 1 {
+				tile = "Parallel"
+			}
+
+			errs[i] = profile.Execute(tile, "Group1")
+		}()
+	}
+
+	wg.Wait()
+	for i, err := range errs {
+		require.NoError(err, "Execute() run %d returned an error: %s", i, err)
+	}
+
+	// Every run's output is added to the servers' Buffers once it is done.
+	require.Equal(runs*len(testServers), strings.Count(results.String(), "[2 pass]"), "results were lost")
+}
+
+func TestProfilesExecuteRecorded(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+
+	failTile := NewTile("Fail", tests.NewMockTest(true))
+	profile := Profile{
+		Name:   "TestProfile",
+		Tiles:  map[string]Tile{"Tile1": testNewTile("Tile1"), "Fail": failTile},
+		Groups: map[string]Group{"Group1": {Name: "Group1", Servers: testServers}},
+	}
+
+	rec := history.NewLog()
+	t.Run("pass", func(t *testing.T) {
+		run, err := profile.ExecuteRecorded("Tile1", "Group1", history.Run{Trigger: history.TriggerManual, User: "admin"}, rec)
+		require.NoError(err, "ExecuteRecorded() returned an error: %s", err)
+		require.NotZero(run.ID, "run was not recorded")
+		require.True(run.Passed, "run did not pass")
+		require.Equal("TestProfile", run.Profile, "run profile did not match")
+		require.Equal("admin", run.User, "run user did not match")
+		require.Contains(run.Summary, testServers[0].Hostname+": 1 pass", "run summary did not match")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		run, err := profile.ExecuteRecorded("Fail", "Group1", history.Run{Trigger: history.TriggerSchedule, ScheduleID: 7}, rec)
+		require.ErrorIs(err, tests.ErrTestFailed, "ExecuteRecorded() did not return the tile error")
+		require.False(run.Passed, "run passed")
+		require.NotEmpty(run.Err, "run error was not recorded")
+	})
+
+	t.Run("unknown tile", func(t *testing.T) {
+		_, err := profile.ExecuteRecorded("Bogus", "Group1", history.Run{Trigger: history.TriggerManual}, rec)
+		require.Error(err, "ExecuteRecorded() did not return an error")
+	})
+
+	runs, err := rec.RunList(history.Filter{})
+	require.NoError(err, "RunList() returned an error: %s", err)
+	require.Len(runs, 3, "every run was not recorded")
+}
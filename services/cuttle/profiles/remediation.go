@@ -0,0 +1,190 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/auth"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+)
+
+var (
+	ErrNoRemediation        = fmt.Errorf("tile has no remediation")
+	ErrNotPermitted         = fmt.Errorf("not permitted")
+	ErrConfirmationRequired = fmt.Errorf("confirmation required")
+	ErrRemediationFailed    = fmt.Errorf("remediation failed")
+)
+
+// Remediation is an action a Tile can take to fix what its tests check. ("Restart nginx", "Clear
+// /tmp", etc.) It is only ran on request, after the Tile's tests have failed.
+type Remediation struct {
+	Name           string        // Shown on the remediation button. ("Restart nginx")
+	Actions        []tests.Test  // Ran in order. A failed action stops the rest.
+	RequireConfirm bool          // If true, the user must confirm before the actions run. Default true.
+	RecheckDelay   time.Duration // Wait after the actions before running the Tile's tests again.
+}
+
+// NewRemediation creates a new Remediation which requires confirmation.
+func NewRemediation(name string, actions ...tests.Test) Remediation {
+	return Remediation{Name: name, Actions: actions, RequireConfirm: true}
+}
+
+// Validate checks that the Remediation has a name and at least one action.
+func (r Remediation) Validate() error {
+	if r.Name == "" {
+		return errors.New("profiles.Remediation.Validate: name cannot be empty")
+	}
+
+	if len(r.Actions) == 0 {
+		return errors.New("profiles.Remediation.Validate: no actions")
+	}
+
+	if r.RecheckDelay < 0 {
+		return errors.New("profiles.Remediation.Validate: recheck delay cannot be negative")
+	}
+
+	return nil
+}
+
+// SetRemediation validates and sets Tile.Remediation.
+func (t *Tile) SetRemediation(r Remediation) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("profiles.Tile.SetRemediation: %w", err)
+	}
+
+	t.Remediation = &r
+	return nil
+}
+
+// RemediateRequest holds who is asking for a remediation and where it is recorded.
+type RemediateRequest struct {
+	User      string           // Username recorded in the audit log.
+	Perms     auth.Permissions // The user's permissions on the Profile. Must allow EXECUTE.
+	Confirmed bool             // The user confirmed the remediation.
+	// The user was warned that servers are in maintenance and wants to continue. See Profile.Silence.
+	IgnoreMaintenance bool
+	Profile           string         // Profile the Tile belongs to. Set by Profile.Remediate.
+	Audit             audit.Recorder // Where the audit entry is recorded. Required.
+}
+
+// RemediationResult is the outcome of a remediation on a single server.
+type RemediationResult struct {
+	Check   TileSummary // The Tile's tests before the actions ran.
+	Actions TileSummary // Empty if the check passed.
+	Recheck TileSummary // The Tile's tests after the actions ran. Empty if the check passed.
+}
+
+// Needed returns true if the check failed and the actions ran.
+func (r RemediationResult) Needed() bool { return !r.Check.Passed() }
+
+// Remediate runs the Tile's tests and, if they fail, the Remediation actions followed by the
+// Tile's tests again. The user must have the EXECUTE permission, and must have confirmed if the
+// Remediation requires it. Every attempt, including denied and unconfirmed ones, is recorded in
+// req.Audit. The entry is started before the actions run, so a crash still leaves a record, and
+// finished with the result. Returns ErrApprovalRequired without running anything if the Tile
+// requires approval since remediations cannot be approved yet. Returns ErrRemediationFailed if an
+// action fails, or the recheck error if the actions did not fix the problem. If ctx is done during
+// the RecheckDelay, the recheck is skipped and the ctx error is returned.
+func (t Tile) Remediate(ctx context.Context, server connections.Server, req RemediateRequest, args ...tests.TestArg) (RemediationResult, error) {
+	var res RemediationResult
+	if t.Remediation == nil {
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w", ErrNoRemediation)
+	}
+
+	if req.Audit == nil {
+		return res, errors.New("profiles.Tile.Remediate: audit recorder is nil")
+	}
+
+	entry := audit.Entry{
+		User:    req.User,
+		Action:  audit.ActionRemediate,
+		Profile: req.Profile,
+		Tile:    t.Name,
+		Server:  server.Hostname,
+	}
+
+	if !req.Perms.CanExecute() {
+		entry.Outcome = audit.OutcomeDenied
+		entry.Detail = t.Remediation.Name
+		if err := req.Audit.AuditRecord(entry); err != nil {
+			return res, fmt.Errorf("profiles.Tile.Remediate: %w", err)
+		}
+
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w: %s cannot execute remediations", ErrNotPermitted, req.User)
+	}
+
+	if t.RequireApproval {
+		entry.Outcome = audit.OutcomeDenied
+		entry.Detail = t.Remediation.Name + ": approval required"
+		err := fmt.Errorf("%w: %s", ErrApprovalRequired, t.Name)
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w", errors.Join(err, req.Audit.AuditRecord(entry)))
+	}
+
+	if t.Remediation.RequireConfirm && !req.Confirmed {
+		entry.Outcome = audit.OutcomeDenied
+		entry.Detail = t.Remediation.Name + ": not confirmed"
+		err := fmt.Errorf("%w: %s", ErrConfirmationRequired, t.Remediation.Name)
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w", errors.Join(err, req.Audit.AuditRecord(entry)))
+	}
+
+	res.Check = t.RunSummary(server, args...)
+	if res.Check.Passed() {
+		entry.Outcome = audit.OutcomeSkipped
+		entry.Detail = fmt.Sprintf("%s: check passed [%s]", t.Remediation.Name, res.Check)
+		if err := req.Audit.AuditRecord(entry); err != nil {
+			return res, fmt.Errorf("profiles.Tile.Remediate: %w", err)
+		}
+
+		return res, nil
+	}
+
+	entry.Detail = t.Remediation.Name + ": running actions"
+	id, err := req.Audit.AuditStart(entry)
+	if err != nil {
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w", err)
+	}
+
+	actions := Tile{Name: t.Name + " - " + t.Remediation.Name, Tests: t.Remediation.Actions, AllMustPass: true}
+	res.Actions = actions.RunSummary(server, args...)
+	if res.Actions.Err != nil {
+		err = fmt.Errorf("%w: %w", ErrRemediationFailed, res.Actions.Err)
+		entry.Detail = fmt.Sprintf("%s: actions [%s]", t.Remediation.Name, res.Actions)
+	} else if err = recheckWait(ctx, t.Remediation.RecheckDelay); err != nil {
+		entry.Detail = fmt.Sprintf("%s: actions [%s], recheck canceled", t.Remediation.Name, res.Actions)
+	} else {
+		res.Recheck = t.RunSummary(server, args...)
+		err = res.Recheck.Err
+		entry.Detail = fmt.Sprintf("%s: actions [%s], recheck [%s]", t.Remediation.Name, res.Actions, res.Recheck)
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+	}
+
+	if auditErr := req.Audit.AuditFinish(id, entry.Outcome, entry.Detail); auditErr != nil {
+		err = errors.Join(err, auditErr)
+	}
+
+	if err != nil {
+		return res, fmt.Errorf("profiles.Tile.Remediate: %w", err)
+	}
+
+	return res, nil
+}
+
+// recheckWait waits d before the recheck. Returns the ctx error if ctx is done first.
+func recheckWait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
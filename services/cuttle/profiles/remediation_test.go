@@ -0,0 +1,257 @@
+package profiles
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/audit"
+	"github.com/chadeldridge/cuttle-server/services/auth"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/stretchr/testify/require"
+)
+
+// testService fails while the service is down.
+type testService struct{ up *bool }
+
+func (t *testService) Run(server connections.Server, args ...tests.TestArg) error {
+	if !*t.up {
+		return tests.ErrTestFailed
+	}
+
+	return nil
+}
+
+// testRestart brings the service up if fixes is true. If log is set, the outcome of the newest audit
+// entry is kept in outcome while the action runs.
+type testRestart struct {
+	up      *bool
+	fixes   bool
+	calls   int
+	log     *audit.Log
+	outcome string
+}
+
+func (t *testRestart) Run(server connections.Server, args ...tests.TestArg) error {
+	t.calls++
+	*t.up = t.fixes
+	if t.log != nil {
+		if entries, _ := t.log.AuditList(1); len(entries) > 0 {
+			t.outcome = entries[0].Outcome
+		}
+	}
+
+	return nil
+}
+
+func testRemediationTile(t *testing.T, up *bool, restart *testRestart) Tile {
+	tile := NewTile("Nginx", tests.Test{Name: "Nginx Running", MustSucceed: true, Tester: &testService{up: up}})
+	err := tile.SetRemediation(NewRemediation("Restart nginx", tests.Test{Name: "Restart", MustSucceed: true, Tester: restart}))
+	require.NoError(t, err, "Tile.SetRemediation() returned an error: %s", err)
+	return tile
+}
+
+func testExecutePerms() auth.Permissions {
+	perms := auth.NewPermissions()
+	perms.AllowExecute()
+	return perms
+}
+
+func TestRemediationValidate(t *testing.T) {
+	require := require.New(t)
+	action := tests.Test{Name: "Restart", Tester: &testRestart{}}
+
+	require.NoError(NewRemediation("Restart", action).Validate(), "Remediation.Validate() returned an error")
+	require.True(NewRemediation("Restart", action).RequireConfirm, "NewRemediation() did not require confirmation")
+	require.Error(NewRemediation("", action).Validate(), "name was not checked")
+	require.Error(NewRemediation("Restart").Validate(), "actions were not checked")
+
+	tile := NewTile("Nginx")
+	require.Error(tile.SetRemediation(Remediation{Name: "Restart"}), "Tile.SetRemediation() did not validate")
+	require.Nil(tile.Remediation, "invalid Remediation was set")
+}
+
+func TestRemediationRemediate(t *testing.T) {
+	require := require.New(t)
+	server := createNewServer(t, "host1", false)
+	t.Cleanup(server.Buffers.Clear)
+
+	t.Run("fixed", func(t *testing.T) {
+		up := false
+		log := audit.NewLog()
+		restart := &testRestart{up: &up, fixes: true, log: log}
+		res, err := testRemediationTile(t, &up, restart).Remediate(context.Background(), server, RemediateRequest{
+			User:      "admin",
+			Perms:     testExecutePerms(),
+			Confirmed: true,
+			Audit:     log,
+		})
+		require.NoError(err, "Tile.Remediate() returned an error: %s", err)
+		require.True(res.Needed(), "remediation was not needed")
+		require.Equal(1, restart.calls, "action did not run")
+		require.Equal(audit.OutcomeStarted, restart.outcome, "audit entry was not started before the action ran")
+		require.True(res.Recheck.Passed(), "recheck did not pass")
+		require.Contains(server.Results.String(), "(Nginx - Restart nginx) Restart - host1...pass", "action was not in the results")
+
+		entries, _ := log.AuditList(0)
+		require.Len(entries, 1, "audit entry was not recorded")
+		require.Equal(audit.OutcomeSuccess, entries[0].Outcome, "audit outcome did not match")
+		require.Equal("admin", entries[0].User, "audit user did not match")
+		require.Equal("host1", entries[0].Server, "audit server did not match")
+	})
+
+	t.Run("not fixed", func(t *testing.T) {
+		up := false
+		log := audit.NewLog()
+		res, err := testRemediationTile(t, &up, &testRestart{up: &up}).Remediate(context.Background(), server, RemediateRequest{
+			User:      "admin",
+			Perms:     testExecutePerms(),
+			Confirmed: true,
+			Audit:     log,
+		})
+		require.ErrorIs(err, tests.ErrTestFailed, "Tile.Remediate() did not return the recheck error")
+		require.False(res.Recheck.Passed(), "recheck passed")
+
+		entries, _ := log.AuditList(0)
+		require.Equal(audit.OutcomeFailure, entries[0].Outcome, "audit outcome did not match")
+	})
+
+	t.Run("not needed", func(t *testing.T) {
+		up := true
+		restart := &testRestart{up: &up, fixes: true}
+		log := audit.NewLog()
+		res, err := testRemediationTile(t, &up, restart).Remediate(context.Background(), server, RemediateRequest{
+			User:      "admin",
+			Perms:     testExecutePerms(),
+			Confirmed: true,
+			Audit:     log,
+		})
+		require.NoError(err, "Tile.Remediate() returned an error: %s", err)
+		require.False(res.Needed(), "remediation was needed")
+		require.Zero(restart.calls, "action ran when the check passed")
+
+		entries, _ := log.AuditList(0)
+		require.Equal(audit.OutcomeSkipped, entries[0].Outcome, "audit outcome did not match")
+	})
+
+	t.Run("not permitted", func(t *testing.T) {
+		up := false
+		restart := &testRestart{up: &up, fixes: true}
+		log := audit.NewLog()
+		perms := auth.NewPermissions()
+		perms.AllowAll()
+		perms.DenyExecute()
+
+		_, err := testRemediationTile(t, &up, restart).Remediate(context.Background(), server, RemediateRequest{
+			User:      "viewer",
+			Perms:     perms,
+			Confirmed: true,
+			Audit:     log,
+		})
+		require.ErrorIs(err, ErrNotPermitted, "Tile.Remediate() did not return ErrNotPermitted")
+		require.Zero(restart.calls, "action ran without permission")
+
+		entries, _ := log.AuditList(0)
+		require.Len(entries, 1, "denied attempt was not recorded")
+		require.Equal(audit.OutcomeDenied, entries[0].Outcome, "audit outcome did not match")
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		up := false
+		restart := &testRestart{up: &up, fixes: true}
+		log := audit.NewLog()
+		_, err := testRemediationTile(t, &up, restart).Remediate(context.Background(), server, RemediateRequest{
+			User:  "admin",
+			Perms: testExecutePerms(),
+			Audit: log,
+		})
+		require.ErrorIs(err, ErrConfirmationRequired, "Tile.Remediate() did not return ErrConfirmationRequired")
+		require.Zero(restart.calls, "action ran without confirmation")
+
+		entries, _ := log.AuditList(0)
+		require.Len(entries, 1, "unconfirmed attempt was not recorded")
+		require.Equal(audit.OutcomeDenied, entries[0].Outcome, "audit outcome did not match")
+		require.Contains(entries[0].Detail, "not confirmed", "audit detail did not match")
+	})
+
+	t.Run("approval required", func(t *testing.T) {
+		up := false
+		restart := &testRestart{up: &up, fixes: true}
+		tile := testRemediationTile(t, &up, restart)
+		tile.RequireApproval = true
+		log := audit.NewLog()
+		_, err := tile.Remediate(context.Background(), server, RemediateRequest{User: "admin", Perms: testExecutePerms(), Confirmed: true, Audit: log})
+		require.ErrorIs(err, ErrApprovalRequired, "Tile.Remediate() did not return ErrApprovalRequired")
+		require.Zero(restart.calls, "action ran without approval")
+
+		entries, _ := log.AuditList(0)
+		require.Len(entries, 1, "attempt was not recorded")
+		require.Equal(audit.OutcomeDenied, entries[0].Outcome, "audit outcome did not match")
+		require.Contains(entries[0].Detail, "approval required", "audit detail did not match")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		up := false
+		restart := &testRestart{up: &up, fixes: true}
+		tile := testRemediationTile(t, &up, restart)
+		tile.Remediation.RecheckDelay = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		log := audit.NewLog()
+		res, err := tile.Remediate(ctx, server, RemediateRequest{User: "admin", Perms: testExecutePerms(), Confirmed: true, Audit: log})
+		require.ErrorIs(err, context.DeadlineExceeded, "Tile.Remediate() did not return the ctx error")
+		require.Equal(1, restart.calls, "action did not run")
+		require.Empty(res.Recheck.Tests, "recheck ran after ctx was done")
+
+		entries, _ := log.AuditList(0)
+		require.Equal(audit.OutcomeFailure, entries[0].Outcome, "audit outcome did not match")
+		require.Contains(entries[0].Detail, "recheck canceled", "audit detail did not match")
+	})
+
+	t.Run("no remediation", func(t *testing.T) {
+		_, err := NewTile("Nginx").Remediate(context.Background(), server, RemediateRequest{User: "admin", Audit: audit.NewLog()})
+		require.ErrorIs(err, ErrNoRemediation, "Tile.Remediate() did not return ErrNoRemediation")
+	})
+}
+
+func TestRemediationProfileRemediate(t *testing.T) {
+	initGroupTest(t, false)
+	require := require.New(t)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+
+	up := false
+	restart := &testRestart{up: &up, fixes: true}
+	profile := Profile{
+		Name:   "Web",
+		Tiles:  map[string]Tile{"Nginx": testRemediationTile(t, &up, restart)},
+		Groups: map[string]Group{"Group1": {Name: "Group1", Servers: testServers}},
+	}
+
+	log := audit.NewLog()
+	res, err := profile.Remediate(context.Background(), "Nginx", "Group1", RemediateRequest{
+		User:      "admin",
+		Perms:     testExecutePerms(),
+		Confirmed: true,
+		Audit:     log,
+	})
+	require.NoError(err, "Profile.Remediate() returned an error: %s", err)
+	require.Len(res, len(testServers), "a server was not remediated")
+	require.Equal(1, restart.calls, "only the first server should have needed the action")
+
+	entries, _ := log.AuditList(0)
+	require.Len(entries, len(testServers), "an audit entry was not recorded for each server")
+	require.Equal("Web", entries[0].Profile, "audit profile did not match")
+
+	_, err = profile.Remediate(context.Background(), "Nginx", "Group1", RemediateRequest{User: "viewer", Perms: auth.NewPermissions(), Audit: log})
+	require.ErrorIs(err, ErrNotPermitted, "Profile.Remediate() did not return ErrNotPermitted")
+
+	tile := profile.Tiles["Nginx"]
+	tile.RequireApproval = true
+	profile.Tiles = map[string]Tile{"Nginx": tile}
+	calls := restart.calls
+	_, err = profile.Remediate(context.Background(), "Nginx", "Group1", RemediateRequest{User: "admin", Perms: testExecutePerms(), Confirmed: true, Audit: log})
+	require.ErrorIs(err, ErrApprovalRequired, "Profile.Remediate() did not return ErrApprovalRequired")
+	require.Equal(calls, restart.calls, "action ran without approval")
+}
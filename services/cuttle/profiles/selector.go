@@ -0,0 +1,206 @@
+package profiles
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+var ErrInvalidSelector = fmt.Errorf("invalid selector")
+
+// Selector operators.
+const (
+	OpEquals       = "="
+	OpNotEquals    = "!="
+	OpIn           = "in"
+	OpNotIn        = "notin"
+	OpExists       = "exists"
+	OpDoesNotExist = "!"
+)
+
+// Requirement is a single term of a Selector.
+type Requirement struct {
+	Key    string
+	Op     string
+	Values []string // Sorted. One value for = and !=. None for exists and !.
+}
+
+// Matches returns true if the labels meet the Requirement. A != or notin Requirement matches
+// servers without the label.
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Op {
+	case OpEquals, OpIn:
+		return ok && slices.Contains(r.Values, v)
+	case OpNotEquals, OpNotIn:
+		return !ok || !slices.Contains(r.Values, v)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func (r Requirement) String() string {
+	switch r.Op {
+	case OpExists:
+		return r.Key
+	case OpDoesNotExist:
+		return "!" + r.Key
+	case OpIn, OpNotIn:
+		return r.Key + " " + r.Op + " (" + strings.Join(r.Values, ",") + ")"
+	default:
+		return r.Key + r.Op + r.Values[0]
+	}
+}
+
+// Selector picks servers by their labels. Every Requirement must match. An empty Selector matches
+// every server.
+type Selector []Requirement
+
+// ParseSelector parses a comma separated list of requirements.
+//
+//	env=prod            env is prod. == also works.
+//	env!=prod           env is not prod or is not set.
+//	role in (db,cache)  role is db or cache.
+//	role notin (db)     role is not db or is not set.
+//	backup              backup is set.
+//	!backup             backup is not set.
+func ParseSelector(expr string) (Selector, error) {
+	terms, err := splitSelector(expr)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.ParseSelector: %w", err)
+	}
+
+	sel := make(Selector, 0, len(terms))
+	for _, term := range terms {
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("profiles.ParseSelector: %w", err)
+		}
+
+		sel = append(sel, r)
+	}
+
+	return sel, nil
+}
+
+// Matches returns true if the labels meet every Requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Select returns the servers which match the Selector, in order.
+func (s Selector) Select(servers []connections.Server) []connections.Server {
+	var matched []connections.Server
+	for _, server := range servers {
+		if s.Matches(server.Labels) {
+			matched = append(matched, server)
+		}
+	}
+
+	return matched
+}
+
+// String returns the Selector in the form ParseSelector reads.
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, r := range s {
+		terms[i] = r.String()
+	}
+
+	return strings.Join(terms, ",")
+}
+
+// splitSelector splits expr on the commas which are not in parentheses.
+func splitSelector(expr string) ([]string, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, fmt.Errorf("%w: nested parentheses: %s", ErrInvalidSelector, expr)
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unmatched ')': %s", ErrInvalidSelector, expr)
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unmatched '(': %s", ErrInvalidSelector, expr)
+	}
+
+	return append(terms, expr[start:]), nil
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return Requirement{}, fmt.Errorf("%w: empty term", ErrInvalidSelector)
+	}
+
+	var r Requirement
+	switch {
+	case strings.HasPrefix(term, "!") && !strings.Contains(term, "="):
+		r = Requirement{Key: strings.TrimSpace(term[1:]), Op: OpDoesNotExist}
+	case strings.Contains(term, "("):
+		key, rest, _ := strings.Cut(term, "(")
+		fields := strings.Fields(key)
+		if len(fields) != 2 || (fields[1] != OpIn && fields[1] != OpNotIn) || !strings.HasSuffix(rest, ")") {
+			return r, fmt.Errorf("%w: expected 'key in (values)': %s", ErrInvalidSelector, term)
+		}
+
+		r = Requirement{Key: fields[0], Op: fields[1]}
+		for _, v := range strings.Split(strings.TrimSuffix(rest, ")"), ",") {
+			r.Values = append(r.Values, strings.TrimSpace(v))
+		}
+	case strings.Contains(term, "!="):
+		key, value, _ := strings.Cut(term, "!=")
+		r = Requirement{Key: strings.TrimSpace(key), Op: OpNotEquals, Values: []string{strings.TrimSpace(value)}}
+	case strings.Contains(term, "="):
+		key, value, _ := strings.Cut(term, "=")
+		// Allow == as well.
+		value = strings.TrimPrefix(value, "=")
+		r = Requirement{Key: strings.TrimSpace(key), Op: OpEquals, Values: []string{strings.TrimSpace(value)}}
+	default:
+		r = Requirement{Key: term, Op: OpExists}
+	}
+
+	if err := connections.ValidateLabelKey(r.Key); err != nil {
+		return r, fmt.Errorf("%w: %w", ErrInvalidSelector, err)
+	}
+
+	for _, v := range r.Values {
+		if err := connections.ValidateLabelValue(v); err != nil {
+			return r, fmt.Errorf("%w: %w", ErrInvalidSelector, err)
+		}
+	}
+
+	slices.Sort(r.Values)
+	r.Values = slices.Compact(r.Values)
+	return r, nil
+}
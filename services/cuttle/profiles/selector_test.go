@@ -0,0 +1,167 @@
+package profiles
+
+import (
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectorParse(t *testing.T) {
+	require := require.New(t)
+
+	valid := map[string]string{
+		"env=prod":                      "env=prod",
+		"env==prod":                     "env=prod",
+		" env = prod , role != db ":     "env=prod,role!=db",
+		"env=prod,role in (db, cache)":  "env=prod,role in (cache,db)",
+		"role notin (db,db)":            "role notin (db)",
+		"backup,!decommissioned":        "backup,!decommissioned",
+		"team.example.com/owner=ops":    "team.example.com/owner=ops",
+		"env in (prod),role in (a,b,c)": "env in (prod),role in (a,b,c)",
+		"":                              "",
+	}
+
+	for expr, want := range valid {
+		t.Run(expr, func(t *testing.T) {
+			sel, err := ParseSelector(expr)
+			require.NoError(err, "ParseSelector() returned an error: %s", err)
+			require.Equal(want, sel.String(), "String() did not match")
+		})
+	}
+
+	for _, expr := range []string{
+		"env=prod,",
+		"role in db,cache",
+		"role in (db",
+		"role in (db))",
+		"role like (db)",
+		"role in ((db))",
+		"env=prod value",
+		"bad key=x",
+		"env=a/b",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseSelector(expr)
+			require.ErrorIs(err, ErrInvalidSelector, "ParseSelector() did not return ErrInvalidSelector")
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	require := require.New(t)
+	db := map[string]string{"env": "prod", "role": "db", "backup": ""}
+	cache := map[string]string{"env": "prod", "role": "cache"}
+	dev := map[string]string{"env": "dev", "role": "web"}
+
+	tests := map[string][]bool{
+		"env=prod":                    {true, true, false},
+		"env!=prod":                   {false, false, true},
+		"env=prod,role in (db,cache)": {true, true, false},
+		"role notin (db)":             {false, true, true},
+		"backup":                      {true, false, false},
+		"!backup":                     {false, true, true},
+		"region!=us":                  {true, true, true},
+		"region=us":                   {false, false, false},
+		"":                            {true, true, true},
+	}
+
+	for expr, want := range tests {
+		t.Run(expr, func(t *testing.T) {
+			sel, err := ParseSelector(expr)
+			require.NoError(err, "ParseSelector() returned an error: %s", err)
+			got := []bool{sel.Matches(db), sel.Matches(cache), sel.Matches(dev)}
+			require.Equal(want, got, "Matches() did not match")
+		})
+	}
+}
+
+func testLabeledServers(t *testing.T) []connections.Server {
+	labels := map[string]map[string]string{
+		"db1":    {"env": "prod", "role": "db"},
+		"cache1": {"env": "prod", "role": "cache"},
+		"web1":   {"env": "prod", "role": "web"},
+		"dev1":   {"env": "dev", "role": "db"},
+	}
+
+	var servers []connections.Server
+	for _, name := range []string{"db1", "cache1", "web1", "dev1"} {
+		s := createNewServer(t, name, false)
+		require.NoError(t, s.SetLabels(labels[name]), "SetLabels() returned an error")
+		servers = append(servers, s)
+	}
+
+	return servers
+}
+
+func TestSelectorGroup(t *testing.T) {
+	require := require.New(t)
+	t.Cleanup(func() { results.Reset(); logs.Reset() })
+	servers := testLabeledServers(t)
+
+	t.Run("new", func(t *testing.T) {
+		_, err := NewSelectorGroup("Bad", "role in (")
+		require.ErrorIs(err, ErrInvalidSelector, "NewSelectorGroup() did not return ErrInvalidSelector")
+		_, err = NewSelectorGroup("Empty", " ")
+		require.ErrorIs(err, ErrInvalidSelector, "NewSelectorGroup() allowed an empty selector")
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		group, err := NewSelectorGroup("Prod Data", "env=prod,role in (db,cache)")
+		require.NoError(err, "NewSelectorGroup() returned an error: %s", err)
+		require.True(group.IsDynamic(), "IsDynamic() returned false")
+
+		// Static servers are kept and not duplicated.
+		group.AddServers(servers[2], servers[0])
+		resolved := group.Resolve(servers)
+		var names []string
+		for _, s := range resolved.Servers {
+			names = append(names, s.Name)
+		}
+
+		require.Equal([]string{"web1", "db1", "cache1"}, names, "resolved servers did not match")
+		require.Len(group.Servers, 2, "Resolve() changed the Group")
+	})
+
+	t.Run("static", func(t *testing.T) {
+		group := NewGroup("Static", servers[3])
+		require.False(group.IsDynamic(), "IsDynamic() returned true")
+		require.Len(group.Resolve(servers).Servers, 1, "a static Group was resolved")
+	})
+
+	t.Run("execute", func(t *testing.T) {
+		group, err := NewSelectorGroup("DBs", "role=db")
+		require.NoError(err, "NewSelectorGroup() returned an error: %s", err)
+		profile, err := NewProfile("Data", group)
+		require.NoError(err, "NewProfile() returned an error: %s", err)
+		require.NoError(profile.AddTiles(testNewTile("Tile1")), "AddTiles() returned an error")
+
+		// Servers added after the Group are picked up when it runs.
+		profile.AddServers(servers...)
+		results.Reset()
+		require.NoError(profile.Execute("Tile1", "DBs"), "Execute() returned an error")
+		require.Contains(results.String(), "db1", "db1 did not run")
+		require.Contains(results.String(), "dev1", "dev1 did not run")
+		require.NotContains(results.String(), "cache1", "cache1 ran")
+	})
+
+	t.Run("preview", func(t *testing.T) {
+		profile := Profile{Name: "Data"}
+		profile.AddServers(servers...)
+		got, err := profile.Select("env=prod,role!=web")
+		require.NoError(err, "Select() returned an error: %s", err)
+		require.Len(got, 2, "Select() did not match")
+
+		// Relabeled servers replace the old copy.
+		relabeled := servers[2]
+		require.NoError(relabeled.SetLabel("role", "db"))
+		profile.AddServers(relabeled)
+		require.Len(profile.Servers, len(servers), "AddServers() duplicated a server")
+		got, err = profile.Select("env=prod,role!=web")
+		require.NoError(err, "Select() returned an error: %s", err)
+		require.Len(got, 3, "Select() did not use the relabeled server")
+
+		_, err = profile.Select("role in (")
+		require.ErrorIs(err, ErrInvalidSelector, "Select() did not return ErrInvalidSelector")
+	})
+}
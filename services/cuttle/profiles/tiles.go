@@ -1,8 +1,13 @@
 package profiles
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
@@ -28,6 +33,83 @@ type Tile struct {
 	Tests       []tests.Test // List of tests to run.
 	AllMustPass bool         // If true, all tests must pass for the tile to pass. Ignores Test.MustSucceed.
 	InParallel  bool         // If true, all tests will be ran in parallel.
+	MaxParallel int          // Max tests to run at once when InParallel is set. 0 is no limit.
+	Remediation *Remediation // Optional action to fix what the tests check. See Tile.Remediate.
+	// Runs are held until a second user approves them. Scheduled runs of the Tile fail. See
+	// Profile.RequestRun.
+	RequireApproval bool
+}
+
+// Test statuses in a TestSummary.
+const (
+	TestPassed   = "pass"
+	TestFailed   = "fail"
+	TestSkipped  = "skipped"
+	TestCanceled = "canceled"
+)
+
+// TestSummary is the outcome of a single test in a Tile run.
+type TestSummary struct {
+	Name     string
+	Status   string
+	Attempts int           // Number of times the test ran. 0 if it was skipped or canceled.
+	Duration time.Duration // Total time of all attempts.
+	Reason   string        // Why the test was skipped or canceled.
+	Err      error         // The error of the last attempt.
+}
+
+// TileSummary is the outcome of a Tile run on a single server.
+type TileSummary struct {
+	Tile   string
+	Server string
+	Tests  []TestSummary // In Tile.Tests order.
+	Err    error         // The first error of a test which must succeed.
+}
+
+// Passed returns true if no test which must succeed failed.
+func (s TileSummary) Passed() bool { return s.Err == nil }
+
+// Count returns the number of tests with the given status.
+func (s TileSummary) Count(status string) int {
+	n := 0
+	for _, test := range s.Tests {
+		if test.Status == status {
+			n++
+		}
+	}
+
+	return n
+}
+
+// String returns the test counts. "3 pass, 1 fail, 2 canceled"
+func (s TileSummary) String() string {
+	var counts []string
+	for _, status := range []string{TestPassed, TestFailed, TestSkipped, TestCanceled} {
+		if n := s.Count(status); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+
+	return strings.Join(counts, ", ")
+}
+
+// newTestSummary creates a TestSummary from the Result of a test which ran.
+func newTestSummary(test tests.Test, res tests.Result) TestSummary {
+	sum := TestSummary{Name: test.Name, Status: TestPassed, Attempts: len(res.Attempts), Err: res.Err}
+	for _, a := range res.Attempts {
+		sum.Duration += a.Duration
+	}
+
+	switch {
+	case res.Err == nil:
+	case len(res.Attempts) == 0 && errors.Is(res.Err, context.Canceled):
+		sum.Status = TestCanceled
+		sum.Reason = "a test which must succeed failed"
+	default:
+		sum.Status = TestFailed
+	}
+
+	return sum
 }
 
 // DefaultTile creates a new Tile object with several default settings.
@@ -95,7 +177,7 @@ func (t *Tile) AddTests(newTests ...tests.Test) { t.Tests = append(t.Tests, newT
 // RemoveTest removes a test from the Tile.Tests slice.
 func (t *Tile) RemoveTest(test tests.Test) {
 	for i, tileTest := range t.Tests {
-		if tileTest == test {
+		if tileTest.Name == test.Name && tileTest.MustSucceed == test.MustSucceed && tileTest.Tester == test.Tester {
 			t.RemoveTestAt(i)
 			return
 		}
@@ -125,62 +207,240 @@ func (t *Tile) RunInSequence() { t.InParallel = false }
 
 // Run tests in the Tile.Tests slice and return an error if any tests fail.
 func (t Tile) Run(server connections.Server, args ...tests.TestArg) error {
+	return t.RunSummary(server, args...).Err
+}
+
+// RunSummary runs the tests in the Tile.Tests slice and returns the outcome of each test. The
+// results are written to server.Buffers.Results and end with a line for the Tile.
+func (t Tile) RunSummary(server connections.Server, args ...tests.TestArg) TileSummary {
+	sum := TileSummary{Tile: t.Name, Server: server.Hostname, Tests: make([]TestSummary, len(t.Tests))}
 	if t.InParallel {
-		return t.runInParallel(server, args)
+		sum.Err = t.runInParallel(server, args, sum.Tests)
+	} else {
+		sum.Err = t.runInSequence(server, args, sum.Tests)
+	}
+
+	status := TestPassed
+	if sum.Err != nil {
+		status = TestFailed
 	}
 
-	return t.runInSequence(server, args)
+	server.Buffers.PrintResults(
+		time.Now(),
+		fmt.Sprintf("(%s) %s...%s [%s]", t.Name, server.Hostname, status, sum),
+		sum.Err,
+	)
+	return sum
 }
 
-func (t Tile) runInSequence(server connections.Server, args []tests.TestArg) error {
+// ValidateFlow checks the Flow of every test. Flow.After must only name earlier tests in the Tile.
+func (t Tile) ValidateFlow() error {
+	seen := make(map[string]bool, len(t.Tests))
 	for _, test := range t.Tests {
-		err := test.Run(server, args...)
-		if err != nil && test.MustSucceed {
-			server.Buffers.PrintResults(
-				time.Now(),
-				fmt.Sprintf("(%s) %s - %s...fail", t.Name, test.Name, server.Hostname),
-				err,
-			)
-			return err
+		if err := test.Flow.Validate(); err != nil {
+			return fmt.Errorf("profiles.Tile.ValidateFlow: %s: %w", test.Name, err)
 		}
 
-		server.Buffers.PrintResults(
-			time.Now(),
-			fmt.Sprintf("(%s) %s - %s...pass", t.Name, test.Name, server.Hostname),
-			nil,
-		)
+		for _, name := range test.Flow.After {
+			if !seen[name] {
+				return fmt.Errorf("profiles.Tile.ValidateFlow: %s: %w: %s is not an earlier test", test.Name, tests.ErrInvalidFlow, name)
+			}
+		}
+
+		seen[test.Name] = true
 	}
 
-	server.Buffers.PrintResults(time.Now(), fmt.Sprintf("(%s) %s...pass", t.Name, server.Hostname), nil)
 	return nil
 }
 
-func (t Tile) runInParallel(server connections.Server, args []tests.TestArg) error {
-	errs := make(chan error, len(t.Tests))
-	for _, test := range t.Tests {
-		go func(test tests.Test) {
-			errs <- test.Run(server, args...)
-		}(test)
+// runInSequence runs the tests in order following each test's Flow. A failed test which must
+// succeed stops the RunOnSuccess tests after it, but RunOnFailure and RunAlways tests still run.
+// Variables captured by a test are passed to the tests after it. Each test's outcome is stored in
+// summaries. Returns the first error of a test which must succeed.
+func (t Tile) runInSequence(server connections.Server, args []tests.TestArg, summaries []TestSummary) error {
+	if err := t.ValidateFlow(); err != nil {
+		return err
 	}
 
-	for i := 0; i < len(t.Tests); i++ {
-		err := <-errs
-		if err != nil && t.AllMustPass {
+	var tileErr error
+	passed := make(map[string]bool, len(t.Tests)) // Only holds tests which ran.
+	vars := make(map[string]string)
+	for i, test := range t.Tests {
+		if reason := t.skipReason(i, tileErr != nil, passed, vars); reason != "" {
+			summaries[i] = TestSummary{Name: test.Name, Status: TestSkipped, Reason: reason}
 			server.Buffers.PrintResults(
 				time.Now(),
-				fmt.Sprintf("(%s) %s - %s...failed", t.Name, t.Tests[i].Name, server.Hostname),
-				err,
+				fmt.Sprintf("(%s) %s - %s...skipped: %s", t.Name, test.Name, server.Hostname, reason),
+				nil,
 			)
-			return err
+			continue
+		}
+
+		logStart := server.Logs.Len()
+		res := test.RunWithRetry(server, append(slices.Clip(args), tests.VarsArg(vars))...)
+		test.Flow.CaptureVars(server.Logs.Bytes()[logStart:], vars)
+		passed[test.Name] = res.Passed()
+		summaries[i] = newTestSummary(test, res)
+
+		if res.Err != nil {
+			server.Buffers.PrintResults(
+				time.Now(),
+				fmt.Sprintf("(%s) %s - %s...fail%s", t.Name, test.Name, server.Hostname, attemptsNote(test, len(res.Attempts))),
+				res.Err,
+			)
+
+			if tileErr == nil && (test.MustSucceed || t.AllMustPass) {
+				tileErr = res.Err
+			}
+
+			continue
 		}
 
 		server.Buffers.PrintResults(
 			time.Now(),
-			fmt.Sprintf("(%s) %s - %s...pass", t.Name, t.Tests[i].Name, server.Hostname),
+			fmt.Sprintf("(%s) %s - %s...pass%s", t.Name, test.Name, server.Hostname, attemptsNote(test, len(res.Attempts))),
 			nil,
 		)
 	}
 
-	server.Buffers.PrintResults(time.Now(), fmt.Sprintf("(%s) %s...pass", t.Name, server.Hostname), nil)
-	return nil
+	return tileErr
+}
+
+// skipReason returns why the test at index i should be skipped or "" if it should run. stopped is
+// true once a test which must succeed has failed.
+func (t Tile) skipReason(i int, stopped bool, passed map[string]bool, vars map[string]string) string {
+	flow := t.Tests[i].Flow
+	if missing := flow.Missing(vars); len(missing) > 0 {
+		return "variable not set: " + strings.Join(missing, ", ")
+	}
+
+	// Without After a test depends on every earlier test.
+	deps := flow.After
+	if len(deps) == 0 {
+		for _, prev := range t.Tests[:i] {
+			deps = append(deps, prev.Name)
+		}
+	}
+
+	depFailed, depSkipped := false, false
+	for _, name := range deps {
+		ok, ran := passed[name]
+		switch {
+		case !ran:
+			depSkipped = true
+		case !ok:
+			depFailed = true
+		}
+	}
+
+	switch flow.When {
+	case tests.RunAlways:
+		return ""
+	case tests.RunOnFailure:
+		if !depFailed {
+			return "no dependency failed"
+		}
+
+		return ""
+	default:
+		if stopped {
+			return "an earlier test which must succeed failed"
+		}
+
+		// Failed tests which do not have to succeed only stop tests which name them in After.
+		if len(flow.After) > 0 && (depFailed || depSkipped) {
+			return "a dependency did not pass"
+		}
+
+		return ""
+	}
+}
+
+// runInParallel runs the tests at the same time, at most Tile.MaxParallel at once. When a test which
+// must succeed fails, tests which have not started are canceled and running tests stop retrying.
+// Tests never share buffers while running. Their output is written to server.Buffers in Tile.Tests
+// order once every test is done, so each result follows the test it belongs to. Flow is not used.
+// Each test's outcome is stored in summaries. Returns the first error of a test which must succeed.
+func (t Tile) runInParallel(server connections.Server, args []tests.TestArg, summaries []TestSummary) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limit := t.MaxParallel
+	if limit <= 0 || limit > len(t.Tests) {
+		limit = len(t.Tests)
+	}
+
+	var (
+		tileErr error
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, limit)
+		outputs = make([]connections.Buffers, len(t.Tests))
+	)
+
+	for i, test := range t.Tests {
+		// Tests start in order. Once ctx is done the rest are canceled without starting.
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		testServer := server
+		testServer.Buffers = connections.NewBuffers(server.Hostname, &bytes.Buffer{}, &bytes.Buffer{})
+		testServer.Buffers.User = server.Buffers.User
+		outputs[i] = testServer.Buffers
+
+		if ctx.Err() != nil {
+			summaries[i] = newTestSummary(test, tests.Result{Err: ctx.Err()})
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, test tests.Test, testServer connections.Server) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := test.RunContext(ctx, testServer, args...)
+			summary := newTestSummary(test, res)
+
+			mu.Lock()
+			defer mu.Unlock()
+			summaries[i] = summary
+			if summary.Status == TestFailed && tileErr == nil && (test.MustSucceed || t.AllMustPass) {
+				tileErr = res.Err
+				cancel()
+			}
+		}(i, test, testServer)
+	}
+
+	wg.Wait()
+
+	for i, test := range t.Tests {
+		server.Logs.Write(outputs[i].Logs.Bytes())
+		server.Results.Write(outputs[i].Results.Bytes())
+
+		sum := summaries[i]
+		result := fmt.Sprintf("(%s) %s - %s...%s", t.Name, test.Name, server.Hostname, sum.Status)
+		switch sum.Status {
+		case TestCanceled:
+			result += ": " + sum.Reason
+			sum.Err = nil
+		default:
+			result += attemptsNote(test, sum.Attempts)
+		}
+
+		server.Buffers.PrintResults(time.Now(), result, sum.Err)
+	}
+
+	return tileErr
+}
+
+// attemptsNote returns " (attempt 2/3)" when the test needed more than one attempt so a pass on
+// retry stands out from a clean pass.
+func attemptsNote(test tests.Test, attempts int) string {
+	if attempts < 2 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (attempt %d/%d)", attempts, test.Retry.Attempts())
 }
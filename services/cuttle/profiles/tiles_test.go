@@ -1,8 +1,15 @@
 package profiles
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
 	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
 	"github.com/stretchr/testify/require"
 )
@@ -80,3 +87,268 @@ func TestTilesSetSize(t *testing.T) {
 		require.Equal(40, tile.DisplaySize, "displaySize did not match")
 	})
 }
+
+func TestTilesJSON(t *testing.T) {
+	require := require.New(t)
+	tcp, err := tests.NewTCPPortOpen("TCP Test", true, 22, tests.TestArg{Key: "timeout", Value: 4})
+	require.NoError(err, "tests.NewTCPPortOpen() returned an error: %s", err)
+	ssh, err := tests.NewSSHTest("SSH Test", false, "uptime", "contains:load")
+	require.NoError(err, "tests.NewSSHTest() returned an error: %s", err)
+
+	tile := NewTile("Check", tcp, ssh)
+	data, err := json.Marshal(tile)
+	require.NoError(err, "json.Marshal() returned an error: %s", err)
+
+	var got Tile
+	require.NoError(json.Unmarshal(data, &got), "json.Unmarshal() returned an error")
+	require.Equal(tile, got, "Tile did not survive a JSON round trip")
+}
+
+// testFlaky fails the first fails runs then passes.
+type testFlaky struct {
+	fails int
+	calls int
+}
+
+func (t *testFlaky) Run(server connections.Server, args ...tests.TestArg) error {
+	t.calls++
+	if t.calls <= t.fails {
+		return tests.ErrTestFailed
+	}
+
+	return nil
+}
+
+func TestTilesRunRetry(t *testing.T) {
+	require := require.New(t)
+	server := createNewServer(t, "host1", false)
+
+	run := func(fails int, retry tests.Retry) error {
+		test := tests.Test{Name: "Flaky Test", MustSucceed: true, Tester: &testFlaky{fails: fails}}
+		require.NoError(test.SetRetry(retry), "tests.Test.SetRetry() returned an error")
+		server.Buffers.Clear()
+		return NewTile("Retry", test).Run(server)
+	}
+
+	t.Run("pass on retry", func(t *testing.T) {
+		require.NoError(run(1, tests.Retry{MaxAttempts: 2}), "Tile.Run() returned an error")
+		require.Contains(server.Results.String(), "Flaky Test - attempt 1/2...fail", "failed attempt was not in the results")
+		require.Contains(server.Results.String(), "Flaky Test - host1...pass (attempt 2/2)", "retried pass was not marked")
+	})
+
+	t.Run("clean pass", func(t *testing.T) {
+		require.NoError(run(0, tests.Retry{MaxAttempts: 2}), "Tile.Run() returned an error")
+		require.Contains(server.Results.String(), "Flaky Test - host1...pass\n", "clean pass was marked as retried")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		require.ErrorIs(run(3, tests.Retry{MaxAttempts: 2}), tests.ErrTestFailed, "Tile.Run() did not return the error")
+		require.Contains(server.Results.String(), "Flaky Test - host1...fail (attempt 2/2)", "failed test did not show its attempts")
+	})
+}
+
+// testEcho logs out with any captured vars expanded and returns err.
+type testEcho struct {
+	out string
+	err error
+}
+
+func (t *testEcho) Run(server connections.Server, args ...tests.TestArg) error {
+	server.Buffers.Log(time.Now(), tests.ExpandVars(t.out, args))
+	return t.err
+}
+
+func testFlowTest(t *testing.T, name string, mustSucceed bool, out string, err error, flow tests.Flow) tests.Test {
+	test := tests.Test{Name: name, MustSucceed: mustSucceed, Tester: &testEcho{out: out, err: err}}
+	require.NoError(t, test.SetFlow(flow), "tests.Test.SetFlow() returned an error")
+	return test
+}
+
+func TestTilesRunFlow(t *testing.T) {
+	require := require.New(t)
+	server := createNewServer(t, "host1", false)
+
+	run := func(tileTests ...tests.Test) error {
+		server.Buffers.Clear()
+		return NewTile("Flow", tileTests...).Run(server)
+	}
+
+	t.Run("capture", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Status", true, "MainPID=4242", nil, tests.Flow{Capture: []tests.Capture{{Var: "pid", Regex: `MainPID=(\d+)`}}}),
+			testFlowTest(t, "Kill", true, "kill {{Var(pid)}}", nil, tests.Flow{Requires: []string{"pid"}}),
+		)
+		require.NoError(err, "Tile.Run() returned an error")
+		require.Contains(server.Logs.String(), "kill 4242", "captured var was not passed to the next test")
+	})
+
+	t.Run("requires unset", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Status", true, "inactive", nil, tests.Flow{Capture: []tests.Capture{{Var: "pid", Regex: `MainPID=(\d+)`}}}),
+			testFlowTest(t, "Kill", true, "kill {{Var(pid)}}", nil, tests.Flow{Requires: []string{"pid"}}),
+		)
+		require.NoError(err, "Tile.Run() returned an error")
+		require.Contains(server.Results.String(), "Kill - host1...skipped: variable not set: pid", "test was not skipped")
+		require.NotContains(server.Logs.String(), "kill", "skipped test ran")
+	})
+
+	t.Run("must succeed failure", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Check", true, "check", tests.ErrTestFailed, tests.Flow{}),
+			testFlowTest(t, "Next", true, "next", nil, tests.Flow{}),
+			testFlowTest(t, "Fix", false, "fix", nil, tests.Flow{When: tests.RunOnFailure}),
+			testFlowTest(t, "Cleanup", false, "cleanup", nil, tests.Flow{When: tests.RunAlways}),
+		)
+		require.ErrorIs(err, tests.ErrTestFailed, "Tile.Run() did not return the error")
+		results := server.Results.String()
+		require.Contains(results, "Check - host1...fail", "failed test was not reported")
+		require.Contains(results, "Next - host1...skipped", "test after a must succeed failure ran")
+		require.Contains(results, "Fix - host1...pass", "remediation test did not run")
+		require.Contains(results, "Cleanup - host1...pass", "cleanup test did not run")
+		require.NotContains(results, "(Flow) host1...pass", "tile passed")
+	})
+
+	t.Run("after", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Optional", false, "optional", tests.ErrTestFailed, tests.Flow{}),
+			testFlowTest(t, "Dependent", false, "dependent", nil, tests.Flow{After: []string{"Optional"}}),
+			testFlowTest(t, "Independent", true, "independent", nil, tests.Flow{}),
+		)
+		require.NoError(err, "Tile.Run() returned an error")
+		results := server.Results.String()
+		require.Contains(results, "Optional - host1...fail", "failed optional test was not reported")
+		require.Contains(results, "Dependent - host1...skipped: a dependency did not pass", "dependent test ran")
+		require.Contains(results, "Independent - host1...pass", "independent test did not run")
+		require.Contains(results, "(Flow) host1...pass", "tile did not pass")
+	})
+
+	t.Run("remediation not needed", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Check", true, "check", nil, tests.Flow{}),
+			testFlowTest(t, "Fix", false, "fix", nil, tests.Flow{When: tests.RunOnFailure, After: []string{"Check"}}),
+		)
+		require.NoError(err, "Tile.Run() returned an error")
+		require.Contains(server.Results.String(), "Fix - host1...skipped: no dependency failed", "remediation test ran")
+	})
+
+	t.Run("invalid after", func(t *testing.T) {
+		err := run(
+			testFlowTest(t, "Fix", false, "fix", nil, tests.Flow{After: []string{"Check"}}),
+			testFlowTest(t, "Check", true, "check", nil, tests.Flow{}),
+		)
+		require.ErrorIs(err, tests.ErrInvalidFlow, "Tile.Run() did not return ErrInvalidFlow")
+	})
+}
+
+// testSlow waits delay then returns err. It records the most tests running at once in running.
+type testSlow struct {
+	delay   time.Duration
+	err     error
+	running *testRunning
+	calls   atomic.Int32
+}
+
+type testRunning struct {
+	mu       sync.Mutex
+	now, max int
+}
+
+func (t *testSlow) Run(server connections.Server, args ...tests.TestArg) error {
+	t.calls.Add(1)
+	if t.running != nil {
+		t.running.mu.Lock()
+		t.running.now++
+		t.running.max = max(t.running.max, t.running.now)
+		t.running.mu.Unlock()
+		defer func() {
+			t.running.mu.Lock()
+			t.running.now--
+			t.running.mu.Unlock()
+		}()
+	}
+
+	time.Sleep(t.delay)
+	server.Buffers.Log(time.Now(), "done")
+	return t.err
+}
+
+func TestTilesRunInParallel(t *testing.T) {
+	require := require.New(t)
+	server := createNewServer(t, "host1", false)
+	t.Cleanup(server.Buffers.Clear)
+
+	run := func(tile Tile) TileSummary {
+		server.Buffers.Clear()
+		tile.RunInParallel()
+		return tile.RunSummary(server)
+	}
+
+	t.Run("attribution", func(t *testing.T) {
+		sum := run(NewTile("Parallel",
+			tests.Test{Name: "Slow Pass", Tester: &testSlow{delay: 20 * time.Millisecond}},
+			tests.Test{Name: "Fast Fail", Tester: &testSlow{err: tests.ErrTestFailed}},
+		))
+		require.NoError(sum.Err, "a test which does not have to succeed failed the tile")
+		require.Equal(TestPassed, sum.Tests[0].Status, "Slow Pass status did not match")
+		require.Equal(TestFailed, sum.Tests[1].Status, "Fast Fail status did not match")
+		require.Equal(1, sum.Tests[0].Attempts, "Slow Pass attempts did not match")
+		require.GreaterOrEqual(sum.Tests[0].Duration, 20*time.Millisecond, "Slow Pass duration was not recorded")
+
+		results := server.Results.String()
+		require.Contains(results, "Slow Pass - host1...pass\n", "Slow Pass result was not attributed")
+		require.Contains(results, "Fast Fail - host1...fail: "+tests.ErrTestFailed.Error(), "Fast Fail result was not attributed")
+		require.Contains(results, "(Parallel) host1...pass [1 pass, 1 fail]", "tile summary did not match")
+		require.Less(strings.Index(results, "Slow Pass"), strings.Index(results, "Fast Fail"), "results were not in Tile.Tests order")
+		require.Equal(2, strings.Count(server.Logs.String(), "done"), "test logs were not kept")
+	})
+
+	t.Run("max parallel", func(t *testing.T) {
+		running := &testRunning{}
+		tile := NewTile("Parallel")
+		tile.MaxParallel = 2
+		for i := 0; i < 5; i++ {
+			tile.AppendTest(tests.Test{Name: fmt.Sprintf("Test %d", i), Tester: &testSlow{delay: 10 * time.Millisecond, running: running}})
+		}
+
+		sum := run(tile)
+		require.NoError(sum.Err, "RunSummary() returned an error")
+		require.Equal(5, sum.Count(TestPassed), "not every test passed")
+		require.Equal(2, running.max, "MaxParallel was not honored")
+	})
+
+	t.Run("cancel siblings", func(t *testing.T) {
+		queued := &testSlow{}
+		tile := NewTile("Parallel",
+			tests.Test{Name: "Must Pass", MustSucceed: true, Tester: &testSlow{delay: 10 * time.Millisecond, err: tests.ErrTestFailed}},
+			tests.Test{Name: "Running", Tester: &testSlow{delay: 30 * time.Millisecond}},
+			tests.Test{Name: "Queued", Tester: queued},
+		)
+		tile.MaxParallel = 2
+
+		sum := run(tile)
+		require.ErrorIs(sum.Err, tests.ErrTestFailed, "RunSummary() did not return the must succeed error")
+		require.Equal(TestFailed, sum.Tests[0].Status, "Must Pass status did not match")
+		require.Equal(TestPassed, sum.Tests[1].Status, "running test was not waited on")
+		require.Equal(TestCanceled, sum.Tests[2].Status, "queued test was not canceled")
+		require.Zero(queued.calls.Load(), "canceled test ran")
+		require.Contains(server.Results.String(), "Queued - host1...canceled: a test which must succeed failed", "canceled test was not reported")
+		require.Contains(server.Results.String(), "(Parallel) host1...fail [1 pass, 1 fail, 1 canceled]", "tile summary did not match")
+	})
+
+	t.Run("all must pass", func(t *testing.T) {
+		tile := NewTile("Parallel", tests.Test{Name: "Fail", Tester: &testSlow{err: tests.ErrTestFailed}})
+		tile.AllMustPass = true
+		require.ErrorIs(run(tile).Err, tests.ErrTestFailed, "AllMustPass was ignored")
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		test := tests.Test{Name: "Flaky Test", Tester: &testFlaky{fails: 1}}
+		require.NoError(test.SetRetry(tests.Retry{MaxAttempts: 2}), "tests.Test.SetRetry() returned an error")
+
+		sum := run(NewTile("Parallel", test))
+		require.Equal(2, sum.Tests[0].Attempts, "attempts did not match")
+		results := server.Results.String()
+		require.Contains(results, "Flaky Test - attempt 1/2...fail", "failed attempt was not in the results")
+		require.Contains(results, "Flaky Test - host1...pass (attempt 2/2)", "retried pass was not marked")
+	})
+}
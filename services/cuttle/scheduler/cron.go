@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCron = fmt.Errorf("invalid cron expression")
+
+// cronMacros are the supported @ shortcuts.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // Names for min through max. ("jan", "feb", ...)
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is also Sunday. It is folded into 0 when parsed.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Cron is a parsed 5 field cron expression: minute, hour, day of month, month, day of week. Each
+// field supports *, lists (1,15), ranges (1-5), and steps (*/15, 0-30/5). Month and day of week
+// also accept names (jan, mon). The @yearly, @monthly, @weekly, @daily, and @hourly macros are
+// supported. As with cron, when both day fields are set a day matching either one runs.
+type Cron struct {
+	expr    string
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	anyDays bool // Day of month or day of week is *.
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (Cron, error) {
+	c := Cron{expr: expr}
+	spec := strings.ToLower(strings.TrimSpace(expr))
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return c, fmt.Errorf("scheduler.ParseCron: %w: expected %d fields: %s", ErrInvalidCron, len(cronFields), expr)
+	}
+
+	bits := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, field := range cronFields {
+		b, err := field.parse(parts[i])
+		if err != nil {
+			return c, fmt.Errorf("scheduler.ParseCron: %w: %s: %w", ErrInvalidCron, field.name, err)
+		}
+
+		*bits[i] = b
+	}
+
+	// Sunday can be 0 or 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+
+	c.anyDays = parts[2] == "*" || parts[4] == "*"
+	return c, nil
+}
+
+// String returns the expression Cron was parsed from.
+func (c Cron) String() string { return c.expr }
+
+// Next returns the first time after t which matches the Cron. Returns the zero time if nothing
+// matches within 5 years. ("0 0 30 2 *")
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDays {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// parse returns the bitset of values in a single cron field.
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step: %s", item)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range: %s", item)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+
+			// "5/15" runs from 5 to the max.
+			if !hasStep {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// value parses a single number or name in the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if s == name {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value out of range %d-%d: %s", f.min, f.max, s)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronParseCron(t *testing.T) {
+	require := require.New(t)
+
+	for _, expr := range []string{
+		"* * * * *",
+		"*/15 0-6 1,15 * mon-fri",
+		"5/10 * * jan-mar 0",
+		"0 0 * * 7",
+		"@daily",
+		"@HOURLY",
+	} {
+		_, err := ParseCron(expr)
+		require.NoError(err, "ParseCron(%q) returned an error: %s", expr, err)
+	}
+
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * * funday",
+		"@sometimes",
+	} {
+		_, err := ParseCron(expr)
+		require.ErrorIs(err, ErrInvalidCron, "ParseCron(%q) did not return ErrInvalidCron", expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	require := require.New(t)
+	// Wednesday.
+	start := time.Date(2024, time.May, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.May, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.May, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, time.May, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon", time.Date(2024, time.May, 20, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.May, 19, 0, 0, 0, 0, time.UTC)},
+		// Both day fields set runs on either.
+		{"0 12 1 * fri", time.Date(2024, time.May, 17, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			require.NoError(err, "ParseCron() returned an error: %s", err)
+			require.Equal(tc.exp, c.Next(start), "Cron.Next() did not match")
+		})
+	}
+}
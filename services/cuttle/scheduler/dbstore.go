@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/chadeldridge/cuttle-server/db"
+)
+
+// ScheduleDB is the part of db.CuttleDB which stores Schedules.
+type ScheduleDB interface {
+	ScheduleCreate(data db.ScheduleData) (db.ScheduleData, error)
+	ScheduleGet(id int64) (db.ScheduleData, error)
+	ScheduleList() ([]db.ScheduleData, error)
+	ScheduleUpdate(data db.ScheduleData) (db.ScheduleData, error)
+	ScheduleDelete(id int64) error
+}
+
+// DBStore is a Store which keeps Schedules in the database so they survive a restart.
+type DBStore struct {
+	db ScheduleDB
+}
+
+// NewDBStore creates a DBStore using the cuttle database.
+func NewDBStore(sdb ScheduleDB) *DBStore { return &DBStore{db: sdb} }
+
+func (s *DBStore) ScheduleCreate(sched Schedule) (Schedule, error) {
+	data, err := s.db.ScheduleCreate(scheduleToData(sched))
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.DBStore.ScheduleCreate: %w", err)
+	}
+
+	return scheduleFromData(data), nil
+}
+
+func (s *DBStore) ScheduleGet(id int64) (Schedule, error) {
+	data, err := s.db.ScheduleGet(id)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("scheduler.DBStore.ScheduleGet: %w", notFound(err))
+	}
+
+	return scheduleFromData(data), nil
+}
+
+func (s *DBStore) ScheduleList() ([]Schedule, error) {
+	list, err := s.db.ScheduleList()
+	if err != nil {
+		return nil, fmt.Errorf("scheduler.DBStore.ScheduleList: %w", err)
+	}
+
+	scheds := make([]Schedule, len(list))
+	for i, data := range list {
+		scheds[i] = scheduleFromData(data)
+	}
+
+	return scheds, nil
+}
+
+func (s *DBStore) ScheduleUpdate(sched Schedule) (Schedule, error) {
+	data, err := s.db.ScheduleUpdate(scheduleToData(sched))
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.DBStore.ScheduleUpdate: %w", notFound(err))
+	}
+
+	return scheduleFromData(data), nil
+}
+
+func (s *DBStore) ScheduleDelete(id int64) error {
+	if err := s.db.ScheduleDelete(id); err != nil {
+		return fmt.Errorf("scheduler.DBStore.ScheduleDelete: %w", notFound(err))
+	}
+
+	return nil
+}
+
+// notFound converts sql.ErrNoRows into ErrScheduleNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrScheduleNotFound
+	}
+
+	return err
+}
+
+func scheduleToData(s Schedule) db.ScheduleData {
+	return db.ScheduleData{
+		ID:       s.ID,
+		Name:     s.Name,
+		Profile:  s.Profile,
+		Tile:     s.Tile,
+		Group:    s.Group,
+		Cron:     s.Cron,
+		Interval: s.Interval,
+		Jitter:   s.Jitter,
+		Paused:   s.Paused,
+		Created:  s.Created,
+		Updated:  s.Updated,
+	}
+}
+
+func scheduleFromData(d db.ScheduleData) Schedule {
+	return Schedule{
+		ID:       d.ID,
+		Name:     d.Name,
+		Profile:  d.Profile,
+		Tile:     d.Tile,
+		Group:    d.Group,
+		Cron:     d.Cron,
+		Interval: d.Interval,
+		Jitter:   d.Jitter,
+		Paused:   d.Paused,
+		Created:  d.Created,
+		Updated:  d.Updated,
+	}
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/db"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchedulerDBName = "test_scheduler.db"
+
+func testDBSetup(t *testing.T) *db.SqliteDB {
+	require := require.New(t)
+	require.NoError(db.SetDBRoot(db.TestDBRoot), "SetDBRoot returned an error")
+
+	sdb, err := db.NewSqliteDB(testSchedulerDBName)
+	require.NoError(err, "NewSqliteDB returned an error: %s", err)
+	require.NoError(sdb.Open(), "Open returned an error")
+	t.Cleanup(func() { sdb.Close(); db.DeleteDB(testSchedulerDBName) })
+
+	require.NoError(sdb.CuttleMigrate(), "CuttleMigrate returned an error")
+	return sdb
+}
+
+func TestDBStore(t *testing.T) {
+	require := require.New(t)
+	store := NewDBStore(testDBSetup(t))
+
+	sched, err := store.ScheduleCreate(Schedule{Name: "Nightly", Profile: "Web", Tile: "Nginx", Group: "Prod", Cron: "@daily", Jitter: time.Minute})
+	require.NoError(err, "ScheduleCreate() returned an error: %s", err)
+	require.NotZero(sched.ID, "ID was not set")
+	require.Equal(time.Minute, sched.Jitter, "Jitter did not match")
+
+	sched.Paused = true
+	sched, err = store.ScheduleUpdate(sched)
+	require.NoError(err, "ScheduleUpdate() returned an error: %s", err)
+	require.True(sched.Paused, "Paused was not updated")
+
+	list, err := store.ScheduleList()
+	require.NoError(err, "ScheduleList() returned an error: %s", err)
+	require.Len(list, 1, "ScheduleList() did not return every schedule")
+
+	require.NoError(store.ScheduleDelete(sched.ID), "ScheduleDelete() returned an error")
+	_, err = store.ScheduleGet(sched.ID)
+	require.ErrorIs(err, ErrScheduleNotFound, "ScheduleGet() did not return ErrScheduleNotFound")
+	_, err = store.ScheduleUpdate(sched)
+	require.ErrorIs(err, ErrScheduleNotFound, "ScheduleUpdate() did not return ErrScheduleNotFound")
+	require.ErrorIs(store.ScheduleDelete(sched.ID), ErrScheduleNotFound, "ScheduleDelete() did not return ErrScheduleNotFound")
+}
+
+func TestDBStoreRestart(t *testing.T) {
+	require := require.New(t)
+	sdb := testDBSetup(t)
+	tester := &testSlow{}
+	first, _ := testSetup(t, tester)
+	source := first.profiles
+
+	s, err := New(NewDBStore(sdb), source, sdb, nil)
+	require.NoError(err, "New() returned an error: %s", err)
+	sched, err := s.Create(testIntervalSchedule(5 * time.Millisecond))
+	require.NoError(err, "Create() returned an error: %s", err)
+
+	// A new Scheduler on the same database picks the schedule back up.
+	s, err = New(NewDBStore(sdb), source, sdb, nil)
+	require.NoError(err, "New() returned an error: %s", err)
+	require.NoError(s.Start(context.Background()), "Start() returned an error")
+	t.Cleanup(s.Stop)
+
+	require.Eventually(func() bool { return tester.calls.Load() > 0 }, time.Second, time.Millisecond, "stored schedule did not run")
+	require.Eventually(func() bool {
+		runs, _ := sdb.RunList(history.Filter{ScheduleID: sched.ID})
+		return len(runs) > 0
+	}, time.Second, time.Millisecond, "run was not stored")
+}
@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidSchedule  = fmt.Errorf("invalid schedule")
+	ErrScheduleNotFound = fmt.Errorf("schedule not found")
+)
+
+// minInterval is the shortest Schedule.Interval allowed. Lowered in tests.
+var minInterval = 10 * time.Second
+
+// Schedule runs a Tile against a Group on a cron expression or a fixed interval.
+type Schedule struct {
+	ID       int64
+	Name     string
+	Profile  string
+	Tile     string
+	Group    string
+	Cron     string        // Cron expression. See Cron. Cron or Interval must be set, not both.
+	Interval time.Duration // Time between the start of each run.
+	Jitter   time.Duration // Up to this much random delay is added to each run.
+	Paused   bool
+	Created  time.Time
+	Updated  time.Time
+}
+
+// Validate checks the Schedule has a target and exactly one of Cron or Interval.
+func (s Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: name is empty", ErrInvalidSchedule)
+	}
+
+	if s.Profile == "" || s.Tile == "" || s.Group == "" {
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: profile, tile, and group are required", ErrInvalidSchedule)
+	}
+
+	switch {
+	case s.Cron == "" && s.Interval == 0:
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: cron or interval is required", ErrInvalidSchedule)
+	case s.Cron != "" && s.Interval != 0:
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: cron and interval cannot both be set", ErrInvalidSchedule)
+	case s.Cron != "":
+		if _, err := ParseCron(s.Cron); err != nil {
+			return fmt.Errorf("scheduler.Schedule.Validate: %w: %w", ErrInvalidSchedule, err)
+		}
+	case s.Interval < minInterval:
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: interval must be at least %s", ErrInvalidSchedule, minInterval)
+	}
+
+	if s.Jitter < 0 {
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: jitter cannot be negative", ErrInvalidSchedule)
+	}
+
+	if s.Interval > 0 && s.Jitter >= s.Interval {
+		return fmt.Errorf("scheduler.Schedule.Validate: %w: jitter must be less than the interval", ErrInvalidSchedule)
+	}
+
+	return nil
+}
+
+// Next returns when the Schedule should run after last, not counting Jitter. Returns the zero time
+// if the cron expression never matches.
+func (s Schedule) Next(last time.Time) time.Time {
+	if s.Interval > 0 {
+		return last.Add(s.Interval)
+	}
+
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return c.Next(last)
+}
+
+// jitter returns a random delay between 0 and Schedule.Jitter.
+func (s Schedule) jitter() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+
+	return rand.N(s.Jitter)
+}
+
+// scheduleJSON is the API form of Schedule. Durations are strings. ("90s", "5m")
+type scheduleJSON struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Profile  string    `json:"profile"`
+	Tile     string    `json:"tile"`
+	Group    string    `json:"group"`
+	Cron     string    `json:"cron,omitempty"`
+	Interval string    `json:"interval,omitempty"`
+	Jitter   string    `json:"jitter,omitempty"`
+	Paused   bool      `json:"paused"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	j := scheduleJSON{
+		ID:      s.ID,
+		Name:    s.Name,
+		Profile: s.Profile,
+		Tile:    s.Tile,
+		Group:   s.Group,
+		Cron:    s.Cron,
+		Paused:  s.Paused,
+		Created: s.Created,
+		Updated: s.Updated,
+	}
+
+	if s.Interval > 0 {
+		j.Interval = s.Interval.String()
+	}
+
+	if s.Jitter > 0 {
+		j.Jitter = s.Jitter.String()
+	}
+
+	return json.Marshal(j)
+}
+
+func (s *Schedule) UnmarshalJSON(data []byte) error {
+	var j scheduleJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	next := Schedule{
+		ID:      j.ID,
+		Name:    j.Name,
+		Profile: j.Profile,
+		Tile:    j.Tile,
+		Group:   j.Group,
+		Cron:    j.Cron,
+		Paused:  j.Paused,
+		Created: j.Created,
+		Updated: j.Updated,
+	}
+
+	var err error
+	if j.Interval != "" {
+		if next.Interval, err = time.ParseDuration(j.Interval); err != nil {
+			return fmt.Errorf("%w: interval: %w", ErrInvalidSchedule, err)
+		}
+	}
+
+	if j.Jitter != "" {
+		if next.Jitter, err = time.ParseDuration(j.Jitter); err != nil {
+			return fmt.Errorf("%w: jitter: %w", ErrInvalidSchedule, err)
+		}
+	}
+
+	*s = next
+	return nil
+}
+
+// Store persists Schedules. db.SqliteDB is the Store used by the server.
+type Store interface {
+	ScheduleCreate(s Schedule) (Schedule, error)
+	ScheduleGet(id int64) (Schedule, error)
+	ScheduleList() ([]Schedule, error)
+	ScheduleUpdate(s Schedule) (Schedule, error)
+	ScheduleDelete(id int64) error
+}
+
+// MemoryStore is an in memory Store. Schedules are lost when the process exits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	lastID    int64
+	schedules map[int64]Schedule
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{schedules: make(map[int64]Schedule)} }
+
+func (m *MemoryStore) ScheduleCreate(s Schedule) (Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	s.ID = m.lastID
+	s.Created = time.Now()
+	s.Updated = s.Created
+	m.schedules[s.ID] = s
+	return s, nil
+}
+
+func (m *MemoryStore) ScheduleGet(id int64) (Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.schedules[id]
+	if !ok {
+		return s, fmt.Errorf("scheduler.MemoryStore.ScheduleGet: %w", ErrScheduleNotFound)
+	}
+
+	return s, nil
+}
+
+// ScheduleList returns every Schedule ordered by ID.
+func (m *MemoryStore) ScheduleList() ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Schedule, 0, len(m.schedules))
+	for id := int64(1); id <= m.lastID; id++ {
+		if s, ok := m.schedules[id]; ok {
+			list = append(list, s)
+		}
+	}
+
+	return list, nil
+}
+
+func (m *MemoryStore) ScheduleUpdate(s Schedule) (Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.schedules[s.ID]
+	if !ok {
+		return s, fmt.Errorf("scheduler.MemoryStore.ScheduleUpdate: %w", ErrScheduleNotFound)
+	}
+
+	s.Created = old.Created
+	s.Updated = time.Now()
+	m.schedules[s.ID] = s
+	return s, nil
+}
+
+func (m *MemoryStore) ScheduleDelete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.schedules[id]; !ok {
+		return fmt.Errorf("scheduler.MemoryStore.ScheduleDelete: %w", ErrScheduleNotFound)
+	}
+
+	delete(m.schedules, id)
+	return nil
+}
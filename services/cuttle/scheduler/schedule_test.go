@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testSchedule() Schedule {
+	return Schedule{Name: "Nightly", Profile: "Web", Tile: "Nginx", Group: "Prod", Cron: "@daily"}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	require := require.New(t)
+	require.NoError(testSchedule().Validate(), "Schedule.Validate() returned an error")
+
+	interval := testSchedule()
+	interval.Cron, interval.Interval, interval.Jitter = "", time.Minute, 10*time.Second
+	require.NoError(interval.Validate(), "Schedule.Validate() returned an error")
+
+	bad := map[string]func(s *Schedule){
+		"no name":         func(s *Schedule) { s.Name = "" },
+		"no tile":         func(s *Schedule) { s.Tile = "" },
+		"no timing":       func(s *Schedule) { s.Cron = "" },
+		"both timings":    func(s *Schedule) { s.Interval = time.Minute },
+		"bad cron":        func(s *Schedule) { s.Cron = "* * *" },
+		"short interval":  func(s *Schedule) { s.Cron, s.Interval = "", time.Millisecond },
+		"negative jitter": func(s *Schedule) { s.Jitter = -time.Second },
+		"jitter too long": func(s *Schedule) { s.Cron, s.Interval, s.Jitter = "", time.Minute, time.Minute },
+	}
+
+	for name, fn := range bad {
+		t.Run(name, func(t *testing.T) {
+			s := testSchedule()
+			fn(&s)
+			require.ErrorIs(s.Validate(), ErrInvalidSchedule, "Schedule.Validate() did not return ErrInvalidSchedule")
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	require := require.New(t)
+	last := time.Date(2024, time.May, 15, 10, 7, 30, 0, time.UTC)
+
+	require.Equal(time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC), testSchedule().Next(last), "cron Next() did not match")
+	require.Equal(last.Add(time.Minute), Schedule{Interval: time.Minute}.Next(last), "interval Next() did not match")
+
+	s := Schedule{Interval: time.Minute, Jitter: time.Second}
+	for i := 0; i < 20; i++ {
+		j := s.jitter()
+		require.True(j >= 0 && j < time.Second, "jitter was out of range: %s", j)
+	}
+}
+
+func TestScheduleJSON(t *testing.T) {
+	require := require.New(t)
+	s := testSchedule()
+	s.Cron, s.Interval, s.Jitter = "", 90*time.Second, 5*time.Second
+
+	data, err := json.Marshal(s)
+	require.NoError(err, "json.Marshal() returned an error: %s", err)
+	require.Contains(string(data), `"interval":"1m30s"`, "interval was not a duration string")
+	require.Contains(string(data), `"jitter":"5s"`, "jitter was not a duration string")
+
+	var got Schedule
+	require.NoError(json.Unmarshal(data, &got), "json.Unmarshal() returned an error")
+	require.Equal(s, got, "Schedule did not survive a JSON round trip")
+	require.ErrorIs(json.Unmarshal([]byte(`{"interval":"often"}`), &got), ErrInvalidSchedule)
+}
+
+func TestScheduleMemoryStore(t *testing.T) {
+	require := require.New(t)
+	store := NewMemoryStore()
+
+	s, err := store.ScheduleCreate(testSchedule())
+	require.NoError(err, "ScheduleCreate() returned an error: %s", err)
+	require.Equal(int64(1), s.ID, "ID was not set")
+
+	s.Paused = true
+	_, err = store.ScheduleUpdate(s)
+	require.NoError(err, "ScheduleUpdate() returned an error: %s", err)
+
+	got, err := store.ScheduleGet(s.ID)
+	require.NoError(err, "ScheduleGet() returned an error: %s", err)
+	require.True(got.Paused, "update was not stored")
+
+	list, err := store.ScheduleList()
+	require.NoError(err, "ScheduleList() returned an error: %s", err)
+	require.Len(list, 1, "ScheduleList() did not match")
+
+	require.NoError(store.ScheduleDelete(s.ID), "ScheduleDelete() returned an error")
+	_, err = store.ScheduleGet(s.ID)
+	require.ErrorIs(err, ErrScheduleNotFound, "schedule was not deleted")
+	require.ErrorIs(store.ScheduleDelete(s.ID), ErrScheduleNotFound, "ScheduleDelete() did not return ErrScheduleNotFound")
+}
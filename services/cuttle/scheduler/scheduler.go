@@ -0,0 +1,473 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+)
+
+var (
+	ErrAlreadyRunning = fmt.Errorf("schedule is already running")
+	ErrStarted        = fmt.Errorf("scheduler is already started")
+	ErrNoProfile      = fmt.Errorf("profile not found")
+)
+
+// ProfileSource looks up the Profile a Schedule runs against.
+type ProfileSource interface {
+	GetProfile(name string) (profiles.Profile, error)
+}
+
+// Profiles is a ProfileSource backed by a map of Profile names.
+type Profiles map[string]profiles.Profile
+
+func (p Profiles) GetProfile(name string) (profiles.Profile, error) {
+	profile, ok := p[name]
+	if !ok {
+		return profile, fmt.Errorf("scheduler.Profiles.GetProfile: %w: %s", ErrNoProfile, name)
+	}
+
+	return profile, nil
+}
+
+// MemoryProfiles is a ProfileSource which can be changed while the Scheduler runs. Changes are only
+// kept in memory.
+type MemoryProfiles struct {
+	mu       sync.RWMutex
+	profiles Profiles
+}
+
+// NewMemoryProfiles creates a MemoryProfiles with the Profiles.
+func NewMemoryProfiles(ps ...profiles.Profile) *MemoryProfiles {
+	m := &MemoryProfiles{profiles: make(Profiles)}
+	for _, p := range ps {
+		m.profiles[p.Name] = p
+	}
+
+	return m
+}
+
+func (m *MemoryProfiles) GetProfile(name string) (profiles.Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.profiles.GetProfile(name)
+}
+
+// SaveProfile adds the Profile or replaces the Profile with the same name.
+func (m *MemoryProfiles) SaveProfile(p profiles.Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("scheduler.MemoryProfiles.SaveProfile: name - %w", core.ErrParamEmpty)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[p.Name] = p
+	return nil
+}
+
+// Status is a Schedule along with its run state.
+type Status struct {
+	Schedule Schedule  `json:"schedule"`
+	Running  bool      `json:"running"`            // A run is in progress.
+	NextRun  time.Time `json:"next_run,omitempty"` // Zero if paused or the scheduler is not started.
+}
+
+// job tracks a single Schedule. running is shared by scheduled runs and RunNow so they never
+// overlap.
+type job struct {
+	sched   Schedule
+	next    time.Time
+	stop    context.CancelFunc // Stops the loop. nil if the loop is not running.
+	running atomic.Bool
+}
+
+// Scheduler runs Schedules in the background and records every run in the history. A run which
+// is due while the previous run of the same Schedule is still going is skipped.
+type Scheduler struct {
+	store    Store
+	profiles ProfileSource
+	history  history.Recorder
+	logger   *core.Logger
+
+	maintenance maintenance.Store // Optional. Set by SetMaintenance.
+
+	mu   sync.Mutex
+	ctx  context.Context // Set by Start. Loops stop when it is done.
+	jobs map[int64]*job
+	wg   sync.WaitGroup // Loops and runs in progress.
+}
+
+// New creates a Scheduler. Schedules are loaded from store when Start is called.
+func New(store Store, source ProfileSource, rec history.Recorder, logger *core.Logger) (*Scheduler, error) {
+	if store == nil || source == nil || rec == nil {
+		return nil, errors.New("scheduler.New: store, profile source, and history recorder are required")
+	}
+
+	if logger == nil {
+		logger = core.NewLogger(io.Discard, "scheduler: ", 0, false)
+	}
+
+	return &Scheduler{
+		store:    store,
+		profiles: source,
+		history:  rec,
+		logger:   logger,
+		jobs:     make(map[int64]*job),
+	}, nil
+}
+
+// SetMaintenance sets the Store of maintenance Windows. Scheduled runs skip the servers in an active
+// Window and RunNow warns before touching them. Call it before Start.
+func (s *Scheduler) SetMaintenance(store maintenance.Store) { s.maintenance = store }
+
+// Start loads the Schedules from the Store and starts every one which is not paused. The
+// Schedules stop when ctx is done or Stop is called.
+func (s *Scheduler) Start(ctx context.Context) error {
+	list, err := s.store.ScheduleList()
+	if err != nil {
+		return fmt.Errorf("scheduler.Scheduler.Start: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return fmt.Errorf("scheduler.Scheduler.Start: %w", ErrStarted)
+	}
+
+	s.ctx = ctx
+	for _, sched := range list {
+		j := &job{sched: sched}
+		s.jobs[sched.ID] = j
+		s.startLoop(j)
+	}
+
+	return nil
+}
+
+// Stop stops every Schedule and waits for runs in progress to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		s.stopLoop(j)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// List returns the Status of every Schedule in the Store.
+func (s *Scheduler) List() ([]Status, error) {
+	list, err := s.store.ScheduleList()
+	if err != nil {
+		return nil, fmt.Errorf("scheduler.Scheduler.List: %w", err)
+	}
+
+	statuses := make([]Status, len(list))
+	for i, sched := range list {
+		statuses[i] = s.status(sched)
+	}
+
+	return statuses, nil
+}
+
+// Get returns the Status of the Schedule.
+func (s *Scheduler) Get(id int64) (Status, error) {
+	sched, err := s.store.ScheduleGet(id)
+	if err != nil {
+		return Status{}, fmt.Errorf("scheduler.Scheduler.Get: %w", err)
+	}
+
+	return s.status(sched), nil
+}
+
+// Create validates and stores the Schedule, then starts it unless it is paused.
+func (s *Scheduler) Create(sched Schedule) (Schedule, error) {
+	if err := sched.Validate(); err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Create: %w", err)
+	}
+
+	sched, err := s.store.ScheduleCreate(sched)
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Create: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := &job{sched: sched}
+	s.jobs[sched.ID] = j
+	s.startLoop(j)
+	return sched, nil
+}
+
+// Update validates and stores the Schedule, then restarts it with the new settings. A run in
+// progress is not interrupted.
+func (s *Scheduler) Update(sched Schedule) (Schedule, error) {
+	if err := sched.Validate(); err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Update: %w", err)
+	}
+
+	sched, err := s.store.ScheduleUpdate(sched)
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Update: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[sched.ID]
+	if !ok {
+		j = &job{}
+		s.jobs[sched.ID] = j
+	}
+
+	s.stopLoop(j)
+	j.sched = sched
+	s.startLoop(j)
+	return sched, nil
+}
+
+// Delete stops and removes the Schedule. A run in progress is not interrupted.
+func (s *Scheduler) Delete(id int64) error {
+	if err := s.store.ScheduleDelete(id); err != nil {
+		return fmt.Errorf("scheduler.Scheduler.Delete: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		s.stopLoop(j)
+		delete(s.jobs, id)
+	}
+
+	return nil
+}
+
+// Pause stops the Schedule from running until Resume is called. The paused state is stored.
+func (s *Scheduler) Pause(id int64) (Schedule, error) {
+	sched, err := s.setPaused(id, true)
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Pause: %w", err)
+	}
+
+	return sched, nil
+}
+
+// Resume starts a paused Schedule again.
+func (s *Scheduler) Resume(id int64) (Schedule, error) {
+	sched, err := s.setPaused(id, false)
+	if err != nil {
+		return sched, fmt.Errorf("scheduler.Scheduler.Resume: %w", err)
+	}
+
+	return sched, nil
+}
+
+func (s *Scheduler) setPaused(id int64, paused bool) (Schedule, error) {
+	sched, err := s.store.ScheduleGet(id)
+	if err != nil {
+		return sched, err
+	}
+
+	sched.Paused = paused
+	return s.Update(sched)
+}
+
+// RunNow runs the Schedule immediately and waits for it to finish. Paused Schedules can still be
+// ran. Returns ErrAlreadyRunning if a run of the Schedule is in progress. Unless force is true,
+// returns profiles.ErrUnderMaintenance without running if any of the Group's servers are in
+// maintenance. A forced run checks every server.
+func (s *Scheduler) RunNow(id int64, force bool) (history.Run, error) {
+	sched, err := s.store.ScheduleGet(id)
+	if err != nil {
+		return history.Run{}, fmt.Errorf("scheduler.Scheduler.RunNow: %w", err)
+	}
+
+	if !force {
+		names, err := s.UnderMaintenance(sched)
+		if err != nil {
+			return history.Run{}, fmt.Errorf("scheduler.Scheduler.RunNow: %w", err)
+		}
+
+		if len(names) > 0 {
+			return history.Run{}, fmt.Errorf("scheduler.Scheduler.RunNow: %w: %s",
+				profiles.ErrUnderMaintenance, strings.Join(names, ", "))
+		}
+	}
+
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	if !ok {
+		j = &job{sched: sched}
+		s.jobs[id] = j
+	}
+	s.mu.Unlock()
+
+	if !j.running.CompareAndSwap(false, true) {
+		return history.Run{}, fmt.Errorf("scheduler.Scheduler.RunNow: %w", ErrAlreadyRunning)
+	}
+	defer j.running.Store(false)
+
+	run, err := s.execute(sched, false)
+	if err != nil {
+		return run, fmt.Errorf("scheduler.Scheduler.RunNow: %w", err)
+	}
+
+	return run, nil
+}
+
+// UnderMaintenance returns the servers in the Schedule's Group which are in maintenance now and
+// why. A missing Profile or Group returns nothing so RunNow can record the failed run.
+func (s *Scheduler) UnderMaintenance(sched Schedule) ([]string, error) {
+	if s.maintenance == nil {
+		return nil, nil
+	}
+
+	profile, err := s.profiles.GetProfile(sched.Profile)
+	if err != nil {
+		return nil, nil
+	}
+
+	if err := s.silence(&profile); err != nil {
+		return nil, fmt.Errorf("scheduler.Scheduler.UnderMaintenance: %w", err)
+	}
+
+	names, err := profile.UnderMaintenance(sched.Group)
+	if err != nil {
+		return nil, nil
+	}
+
+	return names, nil
+}
+
+// execute runs the Schedule's Tile and records the run. If silence is true the servers in
+// maintenance are skipped.
+func (s *Scheduler) execute(sched Schedule, silence bool) (history.Run, error) {
+	run := history.Run{Trigger: history.TriggerSchedule, ScheduleID: sched.ID}
+	profile, err := s.profiles.GetProfile(sched.Profile)
+	if err != nil {
+		// Record the failure so a missing profile shows up in the history.
+		run.Profile, run.Tile, run.Group = sched.Profile, sched.Tile, sched.Group
+		run.Started = time.Now()
+		run.Err = err.Error()
+		run, recErr := s.history.RunRecord(run)
+		return run, errors.Join(err, recErr)
+	}
+
+	if silence {
+		if err := s.silence(&profile); err != nil {
+			// Better to check servers in maintenance than to skip the run.
+			s.logger.Printf("schedule %d (%s): %s\n", sched.ID, sched.Name, err)
+		}
+	}
+
+	return profile.ExecuteRecorded(sched.Tile, sched.Group, run, s.history)
+}
+
+// silence marks the Profile's servers which are in an active maintenance Window.
+func (s *Scheduler) silence(profile *profiles.Profile) error {
+	if s.maintenance == nil {
+		return nil
+	}
+
+	windows, err := maintenance.Active(s.maintenance, profile.Name)
+	if err != nil {
+		return err
+	}
+
+	profile.Silence(windows, time.Now())
+	return nil
+}
+
+func (s *Scheduler) status(sched Schedule) Status {
+	st := Status{Schedule: sched}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[sched.ID]; ok {
+		st.Running = j.running.Load()
+		if j.stop != nil {
+			st.NextRun = j.next
+		}
+	}
+
+	return st
+}
+
+// startLoop starts the job's loop if the Scheduler is started and the Schedule is not paused.
+// s.mu must be held.
+func (s *Scheduler) startLoop(j *job) {
+	if s.ctx == nil || j.sched.Paused || j.stop != nil {
+		return
+	}
+
+	ctx, stop := context.WithCancel(s.ctx)
+	j.stop = stop
+	s.wg.Add(1)
+	go s.loop(ctx, j, j.sched)
+}
+
+// stopLoop stops the job's loop. s.mu must be held.
+func (s *Scheduler) stopLoop(j *job) {
+	if j.stop == nil {
+		return
+	}
+
+	j.stop()
+	j.stop = nil
+	j.next = time.Time{}
+}
+
+// loop waits for each run time of sched and starts the run unless the last one is still going.
+func (s *Scheduler) loop(ctx context.Context, j *job, sched Schedule) {
+	defer s.wg.Done()
+
+	last := time.Now()
+	for {
+		next := sched.Next(last)
+		if now := time.Now(); !next.IsZero() && next.Before(now) {
+			// We fell behind. Skip the missed runs instead of running them back to back.
+			next = sched.Next(now)
+		}
+
+		if next.IsZero() {
+			s.logger.Printf("schedule %d (%s): no future run time\n", sched.ID, sched.Name)
+			return
+		}
+
+		s.mu.Lock()
+		if ctx.Err() == nil {
+			j.next = next
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next) + sched.jitter())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		last = next
+		if !j.running.CompareAndSwap(false, true) {
+			s.logger.Printf("schedule %d (%s): skipped, the last run is still going\n", sched.ID, sched.Name)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer j.running.Store(false)
+			if _, err := s.execute(sched, true); err != nil {
+				s.logger.Debugf("schedule %d (%s): %s\n", sched.ID, sched.Name, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/profiles"
+	"github.com/chadeldridge/cuttle-server/services/cuttle/tests"
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/chadeldridge/cuttle-server/services/maintenance"
+	"github.com/stretchr/testify/require"
+)
+
+// testSlow counts its runs and the most runs at once.
+type testSlow struct {
+	delay   time.Duration
+	calls   atomic.Int32
+	running atomic.Int32
+	overlap atomic.Bool
+}
+
+func (t *testSlow) Run(server connections.Server, args ...tests.TestArg) error {
+	t.calls.Add(1)
+	if t.running.Add(1) > 1 {
+		t.overlap.Store(true)
+	}
+	defer t.running.Add(-1)
+
+	time.Sleep(t.delay)
+	return nil
+}
+
+func testSetup(t *testing.T, tester tests.Tester) (*Scheduler, *history.Log) {
+	minInterval = time.Millisecond
+	t.Cleanup(func() { minInterval = 10 * time.Second })
+
+	server, err := connections.NewServer("host1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(t, err, "connections.NewServer() returned an error: %s", err)
+
+	source := Profiles{"Web": {
+		Name:   "Web",
+		Tiles:  map[string]profiles.Tile{"Nginx": profiles.NewTile("Nginx", tests.Test{Name: "Slow", Tester: tester})},
+		Groups: map[string]profiles.Group{"Prod": profiles.NewGroup("Prod", server)},
+	}}
+
+	rec := history.NewLog()
+	s, err := New(NewMemoryStore(), source, rec, nil)
+	require.NoError(t, err, "New() returned an error: %s", err)
+	return s, rec
+}
+
+func testIntervalSchedule(interval time.Duration) Schedule {
+	return Schedule{Name: "Often", Profile: "Web", Tile: "Nginx", Group: "Prod", Interval: interval}
+}
+
+func TestSchedulerNew(t *testing.T) {
+	_, err := New(nil, Profiles{}, history.NewLog(), nil)
+	require.Error(t, err, "New() did not return an error")
+}
+
+func TestSchedulerRun(t *testing.T) {
+	require := require.New(t)
+	tester := &testSlow{}
+	s, rec := testSetup(t, tester)
+	require.NoError(s.Start(context.Background()), "Start() returned an error")
+	t.Cleanup(s.Stop)
+	require.ErrorIs(s.Start(context.Background()), ErrStarted, "Start() did not return ErrStarted")
+
+	sched, err := s.Create(testIntervalSchedule(10 * time.Millisecond))
+	require.NoError(err, "Create() returned an error: %s", err)
+
+	require.Eventually(func() bool { return tester.calls.Load() >= 3 }, time.Second, 5*time.Millisecond, "schedule did not run")
+	runs, err := rec.RunList(history.Filter{ScheduleID: sched.ID})
+	require.NoError(err, "RunList() returned an error: %s", err)
+	require.NotEmpty(runs, "scheduled runs were not recorded")
+	require.Equal(history.TriggerSchedule, runs[0].Trigger, "run trigger did not match")
+	require.True(runs[0].Passed, "run did not pass")
+
+	st, err := s.Get(sched.ID)
+	require.NoError(err, "Get() returned an error: %s", err)
+	require.False(st.NextRun.IsZero(), "NextRun was not set")
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	require := require.New(t)
+	tester := &testSlow{delay: 50 * time.Millisecond}
+	s, _ := testSetup(t, tester)
+	require.NoError(s.Start(context.Background()), "Start() returned an error")
+
+	sched, err := s.Create(testIntervalSchedule(5 * time.Millisecond))
+	require.NoError(err, "Create() returned an error: %s", err)
+	require.Eventually(func() bool { st, _ := s.Get(sched.ID); return st.Running }, time.Second, time.Millisecond, "schedule did not run")
+
+	_, err = s.RunNow(sched.ID, false)
+	require.ErrorIs(err, ErrAlreadyRunning, "RunNow() did not return ErrAlreadyRunning")
+
+	time.Sleep(120 * time.Millisecond)
+	s.Stop()
+	require.False(tester.overlap.Load(), "runs overlapped")
+	require.Less(tester.calls.Load(), int32(5), "runs were not skipped while the last run was going")
+}
+
+func TestSchedulerPauseResume(t *testing.T) {
+	require := require.New(t)
+	tester := &testSlow{}
+	s, _ := testSetup(t, tester)
+	require.NoError(s.Start(context.Background()), "Start() returned an error")
+	t.Cleanup(s.Stop)
+
+	sched, err := s.Create(testIntervalSchedule(5 * time.Millisecond))
+	require.NoError(err, "Create() returned an error: %s", err)
+	require.Eventually(func() bool { return tester.calls.Load() > 0 }, time.Second, time.Millisecond, "schedule did not run")
+
+	paused, err := s.Pause(sched.ID)
+	require.NoError(err, "Pause() returned an error: %s", err)
+	require.True(paused.Paused, "Pause() did not set Paused")
+
+	// Let a run in progress finish.
+	require.Eventually(func() bool { st, _ := s.Get(sched.ID); return !st.Running }, time.Second, time.Millisecond)
+	calls := tester.calls.Load()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(calls, tester.calls.Load(), "paused schedule ran")
+
+	st, err := s.Get(sched.ID)
+	require.NoError(err, "Get() returned an error: %s", err)
+	require.True(st.NextRun.IsZero(), "paused schedule has a NextRun")
+
+	_, err = s.Resume(sched.ID)
+	require.NoError(err, "Resume() returned an error: %s", err)
+	require.Eventually(func() bool { return tester.calls.Load() > calls }, time.Second, time.Millisecond, "resumed schedule did not run")
+}
+
+func TestSchedulerStartLoadsStore(t *testing.T) {
+	require := require.New(t)
+	tester := &testSlow{}
+	s, _ := testSetup(t, tester)
+
+	// Created before Start. Only the schedule which is not paused runs.
+	active, err := s.Create(testIntervalSchedule(5 * time.Millisecond))
+	require.NoError(err, "Create() returned an error: %s", err)
+	paused := testIntervalSchedule(5 * time.Millisecond)
+	paused.Paused = true
+	paused, err = s.Create(paused)
+	require.NoError(err, "Create() returned an error: %s", err)
+
+	time.Sleep(20 * time.Millisecond)
+	require.Zero(tester.calls.Load(), "schedule ran before Start()")
+
+	require.NoError(s.Start(context.Background()), "Start() returned an error")
+	t.Cleanup(s.Stop)
+	require.Eventually(func() bool { return tester.calls.Load() > 0 }, time.Second, time.Millisecond, "schedule did not run")
+
+	list, err := s.List()
+	require.NoError(err, "List() returned an error: %s", err)
+	require.Len(list, 2, "List() did not return every schedule")
+	require.Equal(active.ID, list[0].Schedule.ID, "List() was not ordered by ID")
+	require.True(list[1].NextRun.IsZero(), "paused schedule was started")
+}
+
+func TestSchedulerRunNow(t *testing.T) {
+	require := require.New(t)
+	s, rec := testSetup(t, &testSlow{})
+
+	sched, err := s.Create(testIntervalSchedule(time.Hour))
+	require.NoError(err, "Create() returned an error: %s", err)
+
+	run, err := s.RunNow(sched.ID, false)
+	require.NoError(err, "RunNow() returned an error: %s", err)
+	require.True(run.Passed, "run did not pass")
+	require.Equal(sched.ID, run.ScheduleID, "run schedule ID did not match")
+
+	t.Run("missing profile", func(t *testing.T) {
+		bad := testIntervalSchedule(time.Hour)
+		bad.Profile = "Bogus"
+		bad, err := s.Create(bad)
+		require.NoError(err, "Create() returned an error: %s", err)
+
+		_, err = s.RunNow(bad.ID, false)
+		require.Error(err, "RunNow() did not return an error")
+		runs, _ := rec.RunList(history.Filter{ScheduleID: bad.ID})
+		require.Len(runs, 1, "failed run was not recorded")
+		require.False(runs[0].Passed, "failed run passed")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := s.RunNow(99, false)
+		require.ErrorIs(err, ErrScheduleNotFound, "RunNow() did not return ErrScheduleNotFound")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(s.Delete(sched.ID), "Delete() returned an error")
+		_, err := s.Get(sched.ID)
+		require.ErrorIs(err, ErrScheduleNotFound, "schedule was not deleted")
+	})
+}
+
+func TestSchedulerMemoryProfiles(t *testing.T) {
+	require := require.New(t)
+	m := NewMemoryProfiles(profiles.Profile{Name: "Web"})
+
+	p, err := m.GetProfile("Web")
+	require.NoError(err, "GetProfile() returned an error: %s", err)
+	require.Equal("Web", p.Name, "Name did not match")
+
+	_, err = m.GetProfile("DB")
+	require.ErrorIs(err, ErrNoProfile, "GetProfile() did not return ErrNoProfile")
+
+	require.Error(m.SaveProfile(profiles.Profile{}), "SaveProfile() did not return an error")
+	require.NoError(m.SaveProfile(profiles.Profile{Name: "DB"}), "SaveProfile() returned an error")
+	_, err = m.GetProfile("DB")
+	require.NoError(err, "GetProfile() returned an error: %s", err)
+}
+
+func TestSchedulerMaintenance(t *testing.T) {
+	require := require.New(t)
+	tester := &testSlow{}
+	s, rec := testSetup(t, tester)
+	windows := maintenance.NewList()
+	s.SetMaintenance(windows)
+
+	sched, err := s.Create(testIntervalSchedule(time.Hour))
+	require.NoError(err, "Create() returned an error: %s", err)
+	_, err = windows.MaintenanceCreate(maintenance.Window{
+		Profile: "Web",
+		Kind:    maintenance.KindGroup,
+		Target:  "Prod",
+		Reason:  "patching",
+		Start:   time.Now().Add(-time.Minute),
+		End:     time.Now().Add(time.Hour),
+	})
+	require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+
+	t.Run("warn", func(t *testing.T) {
+		names, err := s.UnderMaintenance(sched)
+		require.NoError(err, "UnderMaintenance() returned an error: %s", err)
+		require.Len(names, 1, "UnderMaintenance() did not return the server")
+
+		_, err = s.RunNow(sched.ID, false)
+		require.ErrorIs(err, profiles.ErrUnderMaintenance, "RunNow() did not warn")
+		require.ErrorContains(err, "host1", "RunNow() did not name the server")
+		require.Zero(tester.calls.Load(), "RunNow() ran without force")
+	})
+
+	t.Run("force", func(t *testing.T) {
+		run, err := s.RunNow(sched.ID, true)
+		require.NoError(err, "RunNow() returned an error: %s", err)
+		require.Empty(run.Skipped, "forced run skipped a server")
+		require.Equal(int32(1), tester.calls.Load(), "forced run did not check the server")
+	})
+
+	t.Run("scheduled", func(t *testing.T) {
+		run, err := s.execute(sched, true)
+		require.NoError(err, "execute() returned an error: %s", err)
+		require.Equal([]string{"host1"}, run.Skipped, "scheduled run did not skip the server")
+		require.True(run.Silenced, "scheduled run was not silenced")
+		require.Equal(int32(1), tester.calls.Load(), "scheduled run checked the server")
+
+		runs, err := rec.RunList(history.Filter{ScheduleID: sched.ID})
+		require.NoError(err, "RunList() returned an error: %s", err)
+		require.Len(runs, 2, "runs were not recorded")
+	})
+}
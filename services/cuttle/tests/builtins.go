@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Constructor parameters shared by the built-in Registrations.
+var (
+	portParam = ArgSpec{
+		Key:         "port",
+		Type:        ArgInt,
+		Description: "Port to connect to.",
+		Required:    true,
+		Min:         intPtr(1),
+		Max:         intPtr(65535),
+	}
+	expParam = ArgSpec{
+		Key:         "exp",
+		Type:        ArgString,
+		Description: "Expect string to match. \"contains:\", \"regex:\", or an exact match.",
+	}
+	pathParam = ArgSpec{
+		Key:         "path",
+		Type:        ArgString,
+		Description: "Absolute path to the file on the server.",
+		Required:    true,
+	}
+)
+
+func params(specs ...ArgSpec) ArgSchema { return ArgSchema(specs) }
+
+func init() {
+	for _, reg := range builtins() {
+		if err := Register(reg); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func builtins() []Registration {
+	return []Registration{
+		{
+			Type:        "ping",
+			Description: "Ping the server and check packet loss and round-trip times.",
+			Schema: append(params(ArgSpec{
+				Key:         "success_percent",
+				Type:        ArgFloat,
+				Description: "Fraction of packets which must be received, 0 - 1.",
+				Default:     PingDefaultSuccessPercent,
+			}), PingArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				perc := GetArg(args, "success_percent", float64(PingDefaultSuccessPercent))
+				return NewPingTest(name, mustSucceed, float32(perc), withoutArgs(args, "success_percent")...)
+			},
+		},
+		{
+			Type:        "tcp_open",
+			Description: "Open a full TCP connection to a port.",
+			Schema:      append(params(portParam), TCPArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewTCPPortOpen(name, mustSucceed, GetArg(args, "port", 0), withoutArgs(args, "port")...)
+			},
+		},
+		{
+			Type:        "tcp_half_open",
+			Description: "Check a TCP port with a SYN scan style half open connection.",
+			Schema:      append(params(portParam), TCPArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewTCPPortHalfOpen(name, mustSucceed, GetArg(args, "port", 0), withoutArgs(args, "port")...)
+			},
+		},
+		{
+			Type:        "tcp_banner",
+			Description: "Read the banner of a TCP port, optionally after sending a probe.",
+			Schema:      append(params(portParam, expParam), TCPBannerArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewTCPBannerTest(name, mustSucceed, GetArg(args, "port", 0), GetArg(args, "exp", ""),
+					withoutArgs(args, "port", "exp")...)
+			},
+		},
+		{
+			Type:        "udp_probe",
+			Description: "Send a UDP probe and match the response.",
+			Schema: append(params(portParam,
+				ArgSpec{Key: "probe", Type: ArgBytes, Description: "Payload to send.", Required: true},
+				expParam,
+			), UDPArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewUDPProbeTest(name, mustSucceed, GetArg(args, "port", 0), GetArg[[]byte](args, "probe", nil),
+					GetArg(args, "exp", ""), withoutArgs(args, "port", "probe", "exp")...)
+			},
+		},
+		{
+			Type:        "ssh",
+			Description: "Run a command over SSH and match the output.",
+			Schema: append(params(
+				ArgSpec{Key: "cmd", Type: ArgString, Description: "Command to run on the server.", Required: true},
+				expParam,
+			), SSHArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewSSHTest(name, mustSucceed, GetArg(args, "cmd", ""), GetArg(args, "exp", ""),
+					withoutArgs(args, "cmd", "exp")...)
+			},
+		},
+		{
+			Type:        "dns",
+			Description: "Resolve a record and check the answers.",
+			Schema: append(params(ArgSpec{
+				Key:         "record_type",
+				Type:        ArgString,
+				Description: "Record type to look up.",
+				Required:    true,
+				Options:     []string{DNSTypeA, DNSTypeAAAA, DNSTypeCNAME, DNSTypeMX, DNSTypeTXT, DNSTypeSRV},
+			}), DNSArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewDNSTest(name, mustSucceed, GetArg(args, "record_type", ""), withoutArgs(args, "record_type")...)
+			},
+		},
+		{
+			Type:        "tls_cert",
+			Description: "Check the TLS certificate of a port for expiry, chain, and hostname.",
+			Schema: append(params(ArgSpec{
+				Key:         "port",
+				Type:        ArgInt,
+				Description: "Port to connect to.",
+				Default:     TLSDefaultPort,
+				Min:         intPtr(0),
+				Max:         intPtr(65535),
+			}), TLSCertArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewTLSCertTest(name, mustSucceed, GetArg(args, "port", 0), withoutArgs(args, "port")...)
+			},
+		},
+		{
+			Type:        "file_exists",
+			Description: "Check that a file exists.",
+			Schema:      params(pathParam),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewFileExistsTest(name, mustSucceed, GetArg(args, "path", ""))
+			},
+		},
+		{
+			Type:        "file_checksum",
+			Description: "Compare the hash of a file.",
+			Schema: append(params(pathParam,
+				ArgSpec{Key: "checksum", Type: ArgString, Description: "Expected hex encoded hash.", Required: true},
+			), FileChecksumArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewFileChecksumTest(name, mustSucceed, GetArg(args, "path", ""), GetArg(args, "checksum", ""),
+					withoutArgs(args, "path", "checksum")...)
+			},
+		},
+		{
+			Type:        "file_mode",
+			Description: "Check the permission bits and ownership of a file.",
+			Schema: append(params(pathParam,
+				ArgSpec{Key: "mode", Type: ArgString, Description: "Expected octal permission bits. \"0644\"", Required: true},
+			), FileModeArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				mode, err := strconv.ParseUint(GetArg(args, "mode", ""), 8, 32)
+				if err != nil {
+					return Test{}, fmt.Errorf("%w: mode: not an octal file mode", ErrInvalidArg)
+				}
+
+				return NewFileModeTest(name, mustSucceed, GetArg(args, "path", ""), os.FileMode(mode),
+					withoutArgs(args, "path", "mode")...)
+			},
+		},
+		{
+			Type:        "file_contents",
+			Description: "Compare the contents of a file with a template.",
+			Schema: params(pathParam,
+				ArgSpec{Key: "template", Type: ArgString, Description: "text/template the contents must match.", Required: true},
+			),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewFileContentsTest(name, mustSucceed, GetArg(args, "path", ""), GetArg(args, "template", ""))
+			},
+		},
+		{
+			Type:        "file_tail",
+			Description: "Match the last lines of a file.",
+			Schema: append(params(pathParam,
+				ArgSpec{
+					Key:         "lines",
+					Type:        ArgInt,
+					Description: "Number of lines to read from the end of the file.",
+					Default:     FileDefaultTailLines,
+					Min:         intPtr(0),
+					Max:         intPtr(FileMaxTailLines),
+				},
+				expParam,
+			), FileTailArgs...),
+			Factory: func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+				return NewFileTailTest(name, mustSucceed, GetArg(args, "path", ""), GetArg(args, "lines", 0), GetArg(args, "exp", ""))
+			},
+		},
+	}
+}
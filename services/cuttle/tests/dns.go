@@ -0,0 +1,303 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+const (
+	DNSDefaultTimeout = time.Second * 5
+	DNSDefaultPort    = "53"
+
+	DNSTypeA     = "A"
+	DNSTypeAAAA  = "AAAA"
+	DNSTypeCNAME = "CNAME"
+	DNSTypeMX    = "MX"
+	DNSTypeTXT   = "TXT"
+	DNSTypeSRV   = "SRV"
+)
+
+var (
+	ErrInvalidRecordType = fmt.Errorf("invalid record type")
+	ErrInvalidAnswer     = fmt.Errorf("invalid expected answer")
+)
+
+// DNSTest is a struct that holds the parameters for a DNS test.
+type DNSTest struct {
+	recordType string
+	host       string        // Name to resolve. Empty resolves the server's hostname.
+	resolver   string        // "host:port" of the resolver to use. Empty uses the system resolver.
+	expect     []string      // Answers that must be returned. Empty only checks that there was an answer.
+	exact      bool          // If true, the answers must match expect exactly.
+	maxLatency time.Duration // The lookup must finish within maxLatency. 0 skips the check.
+	timeout    time.Duration
+}
+
+// NewDNSTest creates a new DNS test with the given parameters.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// recordType: One of A, AAAA, CNAME, MX, TXT, or SRV.
+//
+// These TestArg will be evaluated:
+// "lookup": string. The name to resolve. Default is the server's hostname.
+// "resolver": string. "host" or "host:port" of the DNS server to query. Default is the system resolver.
+// "expect": []string. Answers which must be returned. Formats are "10.0.0.1" for A/AAAA,
+//
+//	"target.home" for CNAME, "10 mail.home" for MX, the text for TXT, and
+//	"priority weight port target.home" for SRV.
+//
+// "exact": bool. If true, the answers must match "expect" exactly. Default is false.
+// "max_latency": (int, int64, time.Duration) int/int64 will be converted into time.Millisecond * int.
+// "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
+// "quiet": bool. If true, the answers will not be printed to Buffers.Logs.
+func NewDNSTest(name string, mustSucceed bool, recordType string, args ...TestArg) (Test, error) {
+	args, err := DNSArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewDNSTest: %w", err)
+	}
+
+	t := &DNSTest{
+		recordType: strings.ToUpper(strings.TrimSpace(recordType)),
+		host:       getDNSString(args, "lookup"),
+		exact:      getDNSExact(args),
+		maxLatency: getDNSMaxLatency(args),
+		timeout:    getDNSTimeout(args),
+	}
+
+	switch t.recordType {
+	case DNSTypeA, DNSTypeAAAA, DNSTypeCNAME, DNSTypeMX, DNSTypeTXT, DNSTypeSRV:
+	default:
+		return Test{}, fmt.Errorf("tests.NewDNSTest: %w: %s", ErrInvalidRecordType, recordType)
+	}
+
+	if r := getDNSString(args, "resolver"); r != "" {
+		if _, _, err := net.SplitHostPort(r); err != nil {
+			r = net.JoinHostPort(r, DNSDefaultPort)
+		}
+
+		t.resolver = r
+	}
+
+	for _, e := range getDNSExpect(args) {
+		answer, err := t.normalize(e)
+		if err != nil {
+			return Test{}, fmt.Errorf("tests.NewDNSTest: %w", err)
+		}
+
+		t.expect = append(t.expect, answer)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+func getDNSString(args []TestArg, key string) string {
+	return strings.TrimSpace(GetArg(args, key, ""))
+}
+
+func getDNSExpect(args []TestArg) []string { return GetArg[[]string](args, "expect", nil) }
+
+func getDNSExact(args []TestArg) bool { return GetArg(args, "exact", false) }
+
+func getDNSMaxLatency(args []TestArg) time.Duration { return GetMilliseconds(args, "max_latency") }
+
+func getDNSTimeout(args []TestArg) time.Duration { return GetTimeout(args, DNSDefaultTimeout) }
+
+// normalize validates an expected answer and puts it in the same format lookup returns.
+func (t DNSTest) normalize(answer string) (string, error) {
+	answer = strings.TrimSpace(answer)
+	switch t.recordType {
+	case DNSTypeA, DNSTypeAAAA:
+		ip := net.ParseIP(answer)
+		if ip == nil || (ip.To4() != nil) != (t.recordType == DNSTypeA) {
+			return "", fmt.Errorf("%w: not an %s address: %s", ErrInvalidAnswer, t.recordType, answer)
+		}
+
+		return ip.String(), nil
+	case DNSTypeTXT:
+		return answer, nil
+	case DNSTypeMX:
+		var pref uint16
+		var host string
+		if _, err := fmt.Sscanf(answer, "%d %s", &pref, &host); err != nil {
+			return "", fmt.Errorf("%w: MX must be 'preference host': %s", ErrInvalidAnswer, answer)
+		}
+
+		return fmt.Sprintf("%d %s", pref, dnsName(host)), nil
+	case DNSTypeSRV:
+		var priority, weight, port uint16
+		var target string
+		if _, err := fmt.Sscanf(answer, "%d %d %d %s", &priority, &weight, &port, &target); err != nil {
+			return "", fmt.Errorf("%w: SRV must be 'priority weight port target': %s", ErrInvalidAnswer, answer)
+		}
+
+		return fmt.Sprintf("%d %d %d %s", priority, weight, port, dnsName(target)), nil
+	default:
+		return dnsName(answer), nil
+	}
+}
+
+// dnsName lowercases name and removes the trailing dot so names compare the same either way.
+func dnsName(name string) string { return strings.TrimSuffix(strings.ToLower(name), ".") }
+
+func (t DNSTest) newResolver() *net.Resolver {
+	if t.resolver == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, t.resolver)
+		},
+	}
+}
+
+// lookup resolves name and returns the answers in the same format as normalize.
+func (t DNSTest) lookup(ctx context.Context, r *net.Resolver, name string) ([]string, error) {
+	var answers []string
+	switch t.recordType {
+	case DNSTypeA, DNSTypeAAAA:
+		network := "ip4"
+		if t.recordType == DNSTypeAAAA {
+			network = "ip6"
+		}
+
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case DNSTypeCNAME:
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, dnsName(cname))
+	case DNSTypeMX:
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, dnsName(mx.Host)))
+		}
+	case DNSTypeTXT:
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = txts
+	case DNSTypeSRV:
+		// Passing an empty service and proto looks up name as is. "_ldap._tcp.home"
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, dnsName(srv.Target)))
+		}
+	default:
+		return nil, ErrInvalidRecordType
+	}
+
+	return answers, nil
+}
+
+// Config returns "dns" and the args needed to build the DNSTest again.
+func (t DNSTest) Config() (string, []TestArg) {
+	args := []TestArg{
+		{Key: "record_type", Value: t.recordType},
+		{Key: "exact", Value: t.exact},
+		{Key: "timeout", Value: t.timeout.String()},
+	}
+
+	if t.host != "" {
+		args = append(args, TestArg{Key: "lookup", Value: t.host})
+	}
+
+	if t.resolver != "" {
+		args = append(args, TestArg{Key: "resolver", Value: t.resolver})
+	}
+
+	if len(t.expect) > 0 {
+		args = append(args, TestArg{Key: "expect", Value: t.expect})
+	}
+
+	if t.maxLatency > 0 {
+		args = append(args, TestArg{Key: "max_latency", Value: t.maxLatency.String()})
+	}
+
+	return "dns", args
+}
+
+// Run resolves DNSTest.host, or the server's hostname, and checks the answers and latency.
+// Returns ErrTestFailed if the name does not exist or the answers or latency do not match.
+func (t DNSTest) Run(server connections.Server, args ...TestArg) error {
+	name := t.host
+	if name == "" {
+		name = server.Hostname
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	start := time.Now()
+	answers, err := t.lookup(ctx, t.newResolver(), name)
+	latency := time.Since(start)
+	if err != nil {
+		server.Buffers.Log(start, fmt.Sprintf("DNSTest.Run: %s", err))
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return ErrTestFailed
+		}
+
+		return err
+	}
+
+	if !BeQuiet(args) {
+		server.Buffers.Log(start, fmt.Sprintf("%s %s (%s): %s", name, t.recordType, latency, strings.Join(answers, ", ")))
+	}
+
+	if len(answers) == 0 {
+		server.Buffers.Log(start, fmt.Sprintf("DNSTest.Run: no %s records for %s", t.recordType, name))
+		return ErrTestFailed
+	}
+
+	if t.maxLatency > 0 && latency > t.maxLatency {
+		server.Buffers.Log(start, fmt.Sprintf("DNSTest.Run: latency %s was over %s", latency, t.maxLatency))
+		return ErrTestFailed
+	}
+
+	for _, e := range t.expect {
+		if !slices.Contains(answers, e) {
+			server.Buffers.Log(start, fmt.Sprintf("DNSTest.Run: missing expected answer: %s", e))
+			return ErrTestFailed
+		}
+	}
+
+	if t.exact && len(t.expect) > 0 {
+		for _, a := range answers {
+			if !slices.Contains(t.expect, a) {
+				server.Buffers.Log(start, fmt.Sprintf("DNSTest.Run: unexpected answer: %s", a))
+				return ErrTestFailed
+			}
+		}
+	}
+
+	return nil
+}
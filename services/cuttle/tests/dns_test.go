@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func testDNSServer(t *testing.T) *test_helpers.DNSServer {
+	dns := test_helpers.NewDNSServer(t)
+	dns.AddA("web.cuttle.test", "10.0.0.10")
+	dns.AddA("web.cuttle.test", "10.0.0.11")
+	dns.AddAAAA("web.cuttle.test", "fd00::10")
+	dns.AddCNAME("www.cuttle.test", "web.cuttle.test")
+	dns.AddMX("cuttle.test", 10, "mail.cuttle.test")
+	dns.AddTXT("cuttle.test", "v=spf1 -all")
+	dns.AddSRV("_ldap._tcp.cuttle.test", 0, 100, 389, "ldap.cuttle.test")
+	return dns
+}
+
+func TestDNSNewDNSTest(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		test, err := NewDNSTest("DNS Test", true, "a")
+		require.NoError(err, "NewDNSTest() returned an error: %s", err)
+		require.Equal("DNS Test", test.Name, "NewDNSTest() Name is not 'DNS Test'")
+		require.Equal(DNSTypeA, test.Tester.(*DNSTest).recordType, "NewDNSTest() recordType was not upper cased")
+		require.Empty(test.Tester.(*DNSTest).resolver, "NewDNSTest() resolver was set")
+		require.Equal(DNSDefaultTimeout, test.Tester.(*DNSTest).timeout, "NewDNSTest() timeout was not the default")
+	})
+
+	t.Run("args", func(t *testing.T) {
+		test, err := NewDNSTest("DNS Test", true, DNSTypeMX,
+			TestArg{Key: "lookup", Value: "cuttle.test"},
+			TestArg{Key: "resolver", Value: "10.0.0.53"},
+			TestArg{Key: "expect", Value: []string{"10 Mail.Cuttle.Test."}},
+			TestArg{Key: "max_latency", Value: 250},
+		)
+		require.NoError(err, "NewDNSTest() returned an error: %s", err)
+		dt := test.Tester.(*DNSTest)
+		require.Equal("cuttle.test", dt.host, "NewDNSTest() host did not match")
+		require.Equal("10.0.0.53:53", dt.resolver, "NewDNSTest() resolver did not get the default port")
+		require.Equal([]string{"10 mail.cuttle.test"}, dt.expect, "NewDNSTest() expect was not normalized")
+		require.Equal(250*time.Millisecond, dt.maxLatency, "NewDNSTest() maxLatency did not match")
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		_, err := NewDNSTest("DNS Test", true, "PTR")
+		require.ErrorIs(err, ErrInvalidRecordType, "NewDNSTest() did not return ErrInvalidRecordType")
+	})
+
+	bad := map[string][]string{
+		DNSTypeA:    {"fd00::1"},
+		DNSTypeAAAA: {"10.0.0.1"},
+		DNSTypeMX:   {"mail.cuttle.test"},
+		DNSTypeSRV:  {"0 100 ldap.cuttle.test"},
+	}
+
+	for typ, expect := range bad {
+		t.Run("invalid "+typ+" answer", func(t *testing.T) {
+			_, err := NewDNSTest("DNS Test", true, typ, TestArg{Key: "expect", Value: expect})
+			require.ErrorIs(err, ErrInvalidAnswer, "NewDNSTest() did not return ErrInvalidAnswer")
+		})
+	}
+}
+
+func TestDNSTestRun(t *testing.T) {
+	require := require.New(t)
+	dns := testDNSServer(t)
+	server := testServerSetup(t)
+	resolver := TestArg{Key: "resolver", Value: dns.Addr()}
+
+	run := func(typ string, args ...TestArg) error {
+		test, err := NewDNSTest("DNS Test", true, typ, append(args, resolver)...)
+		require.NoError(err, "NewDNSTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		return test.Run(server)
+	}
+
+	lookup := func(name string) TestArg { return TestArg{Key: "lookup", Value: name} }
+	expect := func(answers ...string) TestArg { return TestArg{Key: "expect", Value: answers} }
+	exact := TestArg{Key: "exact", Value: true}
+
+	t.Run("A", func(t *testing.T) {
+		require.NoError(run(DNSTypeA, lookup("web.cuttle.test"), expect("10.0.0.11")))
+		require.Contains(server.Logs.String(), "10.0.0.10, 10.0.0.11", "answers were not logged")
+		require.NoError(run(DNSTypeA, lookup("web.cuttle.test"), expect("10.0.0.10", "10.0.0.11"), exact))
+		require.ErrorIs(run(DNSTypeA, lookup("web.cuttle.test"), expect("10.0.0.10"), exact), ErrTestFailed)
+		require.ErrorIs(run(DNSTypeA, lookup("web.cuttle.test"), expect("10.0.0.12")), ErrTestFailed)
+	})
+
+	t.Run("AAAA", func(t *testing.T) {
+		require.NoError(run(DNSTypeAAAA, lookup("web.cuttle.test"), expect("fd00:0::10")))
+	})
+
+	t.Run("CNAME", func(t *testing.T) {
+		require.NoError(run(DNSTypeCNAME, lookup("www.cuttle.test"), expect("web.cuttle.test.")))
+		require.NoError(run(DNSTypeA, lookup("www.cuttle.test"), expect("10.0.0.10")))
+	})
+
+	t.Run("MX", func(t *testing.T) {
+		require.NoError(run(DNSTypeMX, lookup("cuttle.test"), expect("10 mail.cuttle.test")))
+		require.ErrorIs(run(DNSTypeMX, lookup("cuttle.test"), expect("20 mail.cuttle.test")), ErrTestFailed)
+	})
+
+	t.Run("TXT", func(t *testing.T) {
+		require.NoError(run(DNSTypeTXT, lookup("cuttle.test"), expect("v=spf1 -all")))
+	})
+
+	t.Run("SRV", func(t *testing.T) {
+		require.NoError(run(DNSTypeSRV, lookup("_ldap._tcp.cuttle.test"), expect("0 100 389 ldap.cuttle.test")))
+	})
+
+	t.Run("server hostname", func(t *testing.T) {
+		dns.AddA(testHost, "10.0.0.20")
+		require.NoError(run(DNSTypeA, expect("10.0.0.20")))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		require.ErrorIs(run(DNSTypeA, lookup("missing.cuttle.test")), ErrTestFailed)
+	})
+
+	t.Run("no records of type", func(t *testing.T) {
+		require.Error(run(DNSTypeMX, lookup("web.cuttle.test")), "DNSTest.Run() did not return an error")
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		test, err := NewDNSTest("DNS Test", true, DNSTypeA, lookup("web.cuttle.test"), resolver)
+		require.NoError(err, "NewDNSTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		require.NoError(test.Run(server, Quiet()))
+		require.Empty(server.Logs.String(), "answers were logged")
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		dns.Delay = 50 * time.Millisecond
+		defer func() { dns.Delay = 0 }()
+		require.ErrorIs(run(DNSTypeTXT, lookup("cuttle.test"), TestArg{Key: "max_latency", Value: 10}), ErrTestFailed)
+		require.Contains(server.Logs.String(), "latency", "latency failure was not logged")
+		require.NoError(run(DNSTypeTXT, lookup("cuttle.test"), TestArg{Key: "max_latency", Value: time.Second}))
+	})
+}
@@ -0,0 +1,427 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/pkg/sftp"
+)
+
+const (
+	FileDefaultAlgorithm = "sha256"
+	FileDefaultTailLines = 10
+	// FileMaxTailLines limits how much of a file FileTest will read for "file_tail".
+	FileMaxTailLines = 10000
+	fileTailChunk    = 4096
+)
+
+var (
+	ErrInvalidAlgorithm = fmt.Errorf("invalid checksum algorithm")
+	ErrInvalidChecksum  = fmt.Errorf("invalid checksum")
+
+	fileHashes = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// FileTest is a struct that holds the parameters for file tests ran over SFTP. The server must use
+// a Connector that implements connections.SFTPConnector.
+type FileTest struct {
+	testType  string
+	path      string
+	algorithm string             // file_checksum: Hash algorithm to use.
+	checksum  string             // file_checksum: Expected hex encoded hash.
+	mode      os.FileMode        // file_mode: Expected permission bits.
+	uid       int                // file_mode: Expected owner uid. -1 skips the check.
+	gid       int                // file_mode: Expected group gid. -1 skips the check.
+	tmpl      *template.Template // file_contents: Template the contents must match.
+	tmplText  string             // file_contents: Source of tmpl. Kept so the test can be saved.
+	lines     int                // file_tail: Number of lines to read from the end of the file.
+	exp       string             // file_tail: Expect string to match against the lines.
+}
+
+// FileTemplateData is passed to the template of a file contents test so the expected contents
+// can differ per server. "ServerName={{ .Hostname }}"
+type FileTemplateData struct {
+	Name     string
+	Hostname string
+	IP       string
+	Port     int
+}
+
+// NewFileExistsTest creates a new Test which checks that path exists on the server.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// path: Absolute path to the file on the server.
+func NewFileExistsTest(name string, mustSucceed bool, path string) (Test, error) {
+	t := &FileTest{testType: "file_exists"}
+	if err := t.setPath(path); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileExistsTest: %w", err)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+// NewFileChecksumTest creates a new Test which hashes path and compares it with checksum.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// path: Absolute path to the file on the server.
+// checksum: The expected hex encoded hash of the file.
+//
+// These TestArg will be evaluated:
+// "algorithm": string. One of md5, sha1, sha256, or sha512. Default is sha256.
+func NewFileChecksumTest(name string, mustSucceed bool, path, checksum string, args ...TestArg) (Test, error) {
+	args, err := FileChecksumArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileChecksumTest: %w", err)
+	}
+
+	t := &FileTest{testType: "file_checksum", algorithm: getFileAlgorithm(args)}
+	if err := t.setPath(path); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileChecksumTest: %w", err)
+	}
+
+	newHash, ok := fileHashes[t.algorithm]
+	if !ok {
+		return Test{}, fmt.Errorf("tests.NewFileChecksumTest: %w: %s", ErrInvalidAlgorithm, t.algorithm)
+	}
+
+	t.checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if b, err := hex.DecodeString(t.checksum); err != nil || len(b) != newHash().Size() {
+		return Test{}, fmt.Errorf("tests.NewFileChecksumTest: %w: not a %s hash", ErrInvalidChecksum, t.algorithm)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+// NewFileModeTest creates a new Test which checks the permission bits and ownership of path.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// path: Absolute path to the file on the server.
+// mode: The expected permission bits. 0644
+//
+// These TestArg will be evaluated:
+// "uid": int. The expected owner uid. Not checked by default.
+// "gid": int. The expected group gid. Not checked by default.
+func NewFileModeTest(name string, mustSucceed bool, path string, mode os.FileMode, args ...TestArg) (Test, error) {
+	args, err := FileModeArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileModeTest: %w", err)
+	}
+
+	t := &FileTest{
+		testType: "file_mode",
+		mode:     mode.Perm(),
+		uid:      getFileID(args, "uid"),
+		gid:      getFileID(args, "gid"),
+	}
+
+	if err := t.setPath(path); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileModeTest: %w", err)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+// NewFileContentsTest creates a new Test which compares the contents of path with tmpl. tmpl is a
+// text/template which is executed with FileTemplateData for the server being tested.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// path: Absolute path to the file on the server.
+// tmpl: The template the contents of the file must match.
+func NewFileContentsTest(name string, mustSucceed bool, path, tmpl string) (Test, error) {
+	t := &FileTest{testType: "file_contents", tmplText: tmpl}
+	if err := t.setPath(path); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileContentsTest: %w", err)
+	}
+
+	var err error
+	t.tmpl, err = template.New(path).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileContentsTest: %w", err)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+// NewFileTailTest creates a new Test which reads the last lines of path and matches exp against
+// them. Useful for checking logs.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// path: Absolute path to the file on the server.
+// lines: Number of lines to read from the end of the file. Defaults to 10, max of 10000.
+// exp: See connections.ParseExpect for the format.
+func NewFileTailTest(name string, mustSucceed bool, path string, lines int, exp string) (Test, error) {
+	if lines <= 0 {
+		lines = FileDefaultTailLines
+	}
+
+	if lines > FileMaxTailLines {
+		return Test{}, fmt.Errorf("tests.NewFileTailTest: lines cannot be more than %d", FileMaxTailLines)
+	}
+
+	t := &FileTest{testType: "file_tail", lines: lines, exp: exp}
+	if err := t.setPath(path); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileTailTest: %w", err)
+	}
+
+	if err := connections.ValidateExpect(exp); err != nil {
+		return Test{}, fmt.Errorf("tests.NewFileTailTest: %w", err)
+	}
+
+	return Test{Name: name, MustSucceed: mustSucceed, Tester: t}, nil
+}
+
+func getFileAlgorithm(args []TestArg) string {
+	v := GetArg(args, "algorithm", "")
+	if v == "" {
+		return FileDefaultAlgorithm
+	}
+
+	return strings.ToLower(v)
+}
+
+func getFileID(args []TestArg, key string) int { return GetArg(args, key, -1) }
+
+func (t *FileTest) setPath(path string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return fmt.Errorf("path cannot be empty or whitespace only")
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path must be absolute: %s", path)
+	}
+
+	t.path = path
+	return nil
+}
+
+// Config returns the registered type of the FileTest and the args needed to build it again.
+func (t FileTest) Config() (string, []TestArg) {
+	args := []TestArg{{Key: "path", Value: t.path}}
+	switch t.testType {
+	case "file_checksum":
+		args = append(args, TestArg{Key: "checksum", Value: t.checksum}, TestArg{Key: "algorithm", Value: t.algorithm})
+	case "file_mode":
+		args = append(args, TestArg{Key: "mode", Value: fmt.Sprintf("%04o", t.mode)})
+		if t.uid >= 0 {
+			args = append(args, TestArg{Key: "uid", Value: t.uid})
+		}
+
+		if t.gid >= 0 {
+			args = append(args, TestArg{Key: "gid", Value: t.gid})
+		}
+	case "file_contents":
+		args = append(args, TestArg{Key: "template", Value: t.tmplText})
+	case "file_tail":
+		args = append(args, TestArg{Key: "lines", Value: t.lines}, TestArg{Key: "exp", Value: t.exp})
+	}
+
+	return t.testType, args
+}
+
+// Run opens the server connection from the Pool and runs the file test over SFTP. Mismatches are
+// logged to the server's Buffers and return ErrTestFailed. {{Var(name)}} in the path and the
+// file_tail expect string is replaced with variables captured by earlier tests in the Tile.
+func (t FileTest) Run(server connections.Server, args ...TestArg) error {
+	t.path = ExpandVars(t.path, args)
+	t.exp = ExpandVars(t.exp, args)
+	_, err := connections.Pool.Open(&server)
+	if err != nil {
+		server.Buffers.Log(time.Now(), fmt.Sprintf("FileTest.Run: %s", err))
+		return ErrTestFailed
+	}
+
+	eventTime := time.Now()
+	err = server.WithSFTP(func(client *sftp.Client) error {
+		switch t.testType {
+		case "file_exists":
+			return t.exists(client)
+		case "file_checksum":
+			return t.checksumMatch(client)
+		case "file_mode":
+			return t.modeMatch(client)
+		case "file_contents":
+			return t.contentsMatch(client, server)
+		case "file_tail":
+			return t.tailMatch(client, server.Buffers, BeQuiet(args))
+		default:
+			return ErrInvalidTestType
+		}
+	})
+
+	if err != nil {
+		server.Buffers.Log(eventTime, fmt.Sprintf("FileTest.Run: %s: %s", t.path, err))
+		server.Buffers.PrintResults(eventTime, "failed", err)
+		return ErrTestFailed
+	}
+
+	server.Buffers.PrintResults(eventTime, "ok", nil)
+	return nil
+}
+
+func (t FileTest) exists(client *sftp.Client) error {
+	_, err := client.Stat(t.path)
+	return err
+}
+
+func (t FileTest) checksumMatch(client *sftp.Client) error {
+	f, err := client.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := fileHashes[t.algorithm]()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if sum != t.checksum {
+		return fmt.Errorf("%s checksum %s did not match %s", t.algorithm, sum, t.checksum)
+	}
+
+	return nil
+}
+
+func (t FileTest) modeMatch(client *sftp.Client) error {
+	info, err := client.Stat(t.path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm() != t.mode {
+		return fmt.Errorf("mode %#o did not match %#o", info.Mode().Perm(), t.mode)
+	}
+
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		if t.uid >= 0 || t.gid >= 0 {
+			return fmt.Errorf("server did not return file ownership")
+		}
+
+		return nil
+	}
+
+	if t.uid >= 0 && int(stat.UID) != t.uid {
+		return fmt.Errorf("uid %d did not match %d", stat.UID, t.uid)
+	}
+
+	if t.gid >= 0 && int(stat.GID) != t.gid {
+		return fmt.Errorf("gid %d did not match %d", stat.GID, t.gid)
+	}
+
+	return nil
+}
+
+func (t FileTest) contentsMatch(client *sftp.Client, server connections.Server) error {
+	var want bytes.Buffer
+	err := t.tmpl.Execute(&want, FileTemplateData{
+		Name:     server.Name,
+		Hostname: server.Hostname,
+		IP:       server.GetIP(),
+		Port:     server.Port,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := client.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Only read one byte past the expected size. Anything bigger does not match anyway.
+	got, err := io.ReadAll(io.LimitReader(f, int64(want.Len())+1))
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(got, want.Bytes()) {
+		return fmt.Errorf("contents did not match the template")
+	}
+
+	return nil
+}
+
+func (t FileTest) tailMatch(client *sftp.Client, bufs connections.Buffers, quiet bool) error {
+	f, err := client.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tail, err := tailFile(f, info.Size(), t.lines)
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		bufs.Log(time.Now(), string(tail))
+	}
+
+	expect, err := connections.ParseExpect(t.exp)
+	if err != nil {
+		return err
+	}
+
+	if !connections.MatchExpect(expect, tail) {
+		return fmt.Errorf("last %d lines did not match '%s'", t.lines, t.exp)
+	}
+
+	return nil
+}
+
+// tailFile reads backwards from the end of f, in chunks, until it has found n lines or reached the
+// start of the file. A trailing newline does not count as a line.
+func tailFile(f io.ReaderAt, size int64, n int) ([]byte, error) {
+	var data []byte
+	offset := size
+	for offset > 0 {
+		chunk := int64(fileTailChunk)
+		if chunk > offset {
+			chunk = offset
+		}
+
+		offset -= chunk
+		buf := make([]byte, chunk)
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		data = append(buf, data...)
+		if bytes.Count(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) >= n {
+			break
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return bytes.Join(lines, []byte("\n")), nil
+}
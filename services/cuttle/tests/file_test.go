@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/chadeldridge/cuttle-server/test_helpers"
+	"github.com/stretchr/testify/require"
+)
+
+const testFilePass = "testUserP@ssw0rd"
+
+// testFileServer starts an in-process sshd with sftp and returns a Server pointed at it.
+func testFileServer(t *testing.T) connections.Server {
+	require := require.New(t)
+	connections.Pool = connections.ConnectionPool{}
+	t.Cleanup(func() { connections.Pool.CloseAll() })
+
+	sshd := test_helpers.NewSSHServer(t, testUser, testFilePass)
+	server, err := connections.NewServer(sshd.Host(), sshd.Port(), &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+	server.User = testUser
+
+	conn, err := connections.NewSSHConnector("sftp", testUser)
+	require.NoError(err, "connections.NewSSHConnector() returned an error: %s", err)
+	conn.AddPasswordAuth(testFilePass)
+	require.NoError(server.SetConnector(&conn), "Server.SetConnector() returned an error")
+	return server
+}
+
+func testWriteFile(t *testing.T, name, data string, mode os.FileMode) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), mode), "os.WriteFile() returned an error")
+	require.NoError(t, os.Chmod(path, mode), "os.Chmod() returned an error")
+	return path
+}
+
+func TestFileNewFileTests(t *testing.T) {
+	require := require.New(t)
+	sum := sha256.Sum256([]byte("data"))
+
+	t.Run("exists", func(t *testing.T) {
+		test, err := NewFileExistsTest("exists", true, "/etc/hosts")
+		require.NoError(err, "NewFileExistsTest() returned an error: %s", err)
+		require.Equal("/etc/hosts", test.Tester.(*FileTest).path, "FileTest.path did not match")
+	})
+
+	t.Run("relative path", func(t *testing.T) {
+		_, err := NewFileExistsTest("exists", true, "etc/hosts")
+		require.Error(err, "NewFileExistsTest() did not return an error")
+	})
+
+	t.Run("empty path", func(t *testing.T) {
+		_, err := NewFileExistsTest("exists", true, " ")
+		require.Error(err, "NewFileExistsTest() did not return an error")
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		test, err := NewFileChecksumTest("sum", true, "/etc/hosts", strings.ToUpper(hex.EncodeToString(sum[:])))
+		require.NoError(err, "NewFileChecksumTest() returned an error: %s", err)
+		require.Equal(FileDefaultAlgorithm, test.Tester.(*FileTest).algorithm, "FileTest.algorithm did not match")
+		require.Equal(hex.EncodeToString(sum[:]), test.Tester.(*FileTest).checksum, "FileTest.checksum was not lowered")
+	})
+
+	t.Run("checksum bad algorithm", func(t *testing.T) {
+		_, err := NewFileChecksumTest("sum", true, "/etc/hosts", "abc", TestArg{Key: "algorithm", Value: "crc32"})
+		require.ErrorIs(err, ErrInvalidAlgorithm, "NewFileChecksumTest() did not return ErrInvalidAlgorithm")
+	})
+
+	t.Run("checksum wrong length", func(t *testing.T) {
+		_, err := NewFileChecksumTest("sum", true, "/etc/hosts", hex.EncodeToString(sum[:]), TestArg{Key: "algorithm", Value: "md5"})
+		require.ErrorIs(err, ErrInvalidChecksum, "NewFileChecksumTest() did not return ErrInvalidChecksum")
+	})
+
+	t.Run("mode", func(t *testing.T) {
+		test, err := NewFileModeTest("mode", true, "/etc/hosts", 0644, TestArg{Key: "uid", Value: 0})
+		require.NoError(err, "NewFileModeTest() returned an error: %s", err)
+		require.Equal(0, test.Tester.(*FileTest).uid, "FileTest.uid did not match")
+		require.Equal(-1, test.Tester.(*FileTest).gid, "FileTest.gid did not default to -1")
+	})
+
+	t.Run("contents bad template", func(t *testing.T) {
+		_, err := NewFileContentsTest("contents", true, "/etc/hostname", "{{ .Hostname ")
+		require.Error(err, "NewFileContentsTest() did not return an error")
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		test, err := NewFileTailTest("tail", true, "/var/log/syslog", 0, "contains:started")
+		require.NoError(err, "NewFileTailTest() returned an error: %s", err)
+		require.Equal(FileDefaultTailLines, test.Tester.(*FileTest).lines, "FileTest.lines did not default")
+	})
+
+	t.Run("tail too many lines", func(t *testing.T) {
+		_, err := NewFileTailTest("tail", true, "/var/log/syslog", FileMaxTailLines+1, "")
+		require.Error(err, "NewFileTailTest() did not return an error")
+	})
+
+	t.Run("tail invalid exp", func(t *testing.T) {
+		_, err := NewFileTailTest("tail", true, "/var/log/syslog", 5, "regex:(")
+		require.ErrorIs(err, connections.ErrInvalidExpect, "NewFileTailTest() did not return ErrInvalidExpect")
+	})
+}
+
+func TestFileTestRun(t *testing.T) {
+	require := require.New(t)
+	server := testFileServer(t)
+	data := "listen 127.0.0.1\nport 8080\n"
+	path := testWriteFile(t, "app.conf", data, 0640)
+
+	run := func(test Test, err error) error {
+		require.NoError(err, "creating the test returned an error: %s", err)
+		server.Buffers.Clear()
+		return test.Run(server)
+	}
+
+	t.Run("exists", func(t *testing.T) {
+		require.NoError(run(NewFileExistsTest("exists", true, path)), "FileTest.Run() returned an error")
+		require.Contains(connections.GetLastBufferLine(server.Results), "ok", "result was not ok")
+		require.ErrorIs(run(NewFileExistsTest("exists", true, path+".missing")), ErrTestFailed)
+		require.Contains(connections.GetLastBufferLine(server.Results), "failed", "result was not failed")
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		sum := sha256.Sum256([]byte(data))
+		require.NoError(run(NewFileChecksumTest("sum", true, path, hex.EncodeToString(sum[:]))))
+
+		other := sha256.Sum256([]byte("other"))
+		require.ErrorIs(run(NewFileChecksumTest("sum", true, path, hex.EncodeToString(other[:]))), ErrTestFailed)
+		require.Contains(server.Logs.String(), "checksum", "mismatch was not logged")
+	})
+
+	t.Run("mode", func(t *testing.T) {
+		uid := TestArg{Key: "uid", Value: os.Getuid()}
+		require.NoError(run(NewFileModeTest("mode", true, path, 0640, uid)))
+		require.ErrorIs(run(NewFileModeTest("mode", true, path, 0644)), ErrTestFailed)
+		require.ErrorIs(run(NewFileModeTest("mode", true, path, 0640, TestArg{Key: "uid", Value: os.Getuid() + 1})), ErrTestFailed)
+	})
+
+	t.Run("contents", func(t *testing.T) {
+		hostPath := testWriteFile(t, "host.conf", fmt.Sprintf("host=%s\n", server.Hostname), 0644)
+		require.NoError(run(NewFileContentsTest("contents", true, path, data)))
+		require.NoError(run(NewFileContentsTest("contents", true, hostPath, "host={{ .Hostname }}\n")))
+		require.ErrorIs(run(NewFileContentsTest("contents", true, path, "listen 127.0.0.1\n")), ErrTestFailed)
+		require.ErrorIs(run(NewFileContentsTest("contents", true, path, "{{ .Missing }}")), ErrTestFailed)
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		var log strings.Builder
+		for i := 1; i <= 2000; i++ {
+			fmt.Fprintf(&log, "line %d\n", i)
+		}
+		logPath := testWriteFile(t, "app.log", log.String(), 0644)
+
+		require.NoError(run(NewFileTailTest("tail", true, logPath, 2, "line:line 1999 && line:line 2000")))
+		require.NotContains(server.Logs.String(), "line 1998", "more than 2 lines were read")
+		require.ErrorIs(run(NewFileTailTest("tail", true, logPath, 2, "line:line 1998")), ErrTestFailed)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		conn, err := connections.NewMockConnector("mock", testUser)
+		require.NoError(err, "connections.NewMockConnector() returned an error: %s", err)
+		mock := testServerSetup(t)
+		mock.SetConnector(&conn)
+
+		test, err := NewFileExistsTest("exists", true, path)
+		require.NoError(err, "NewFileExistsTest() returned an error: %s", err)
+		require.ErrorIs(test.Run(mock), ErrTestFailed, "FileTest.Run() did not return ErrTestFailed")
+		require.Contains(mock.Logs.String(), connections.ErrSFTPNotSupported.Error(), "error was not logged")
+	})
+}
+
+func TestFileTailFile(t *testing.T) {
+	require := require.New(t)
+
+	tests := map[string]struct {
+		data string
+		n    int
+		want string
+	}{
+		"short file":      {"a\nb\n", 5, "a\nb"},
+		"exact":           {"a\nb\nc\n", 2, "b\nc"},
+		"no newline":      {"a\nb\nc", 1, "c"},
+		"empty":           {"", 3, ""},
+		"across chunks":   {strings.Repeat("x", fileTailChunk) + "\nlast\n", 2, strings.Repeat("x", fileTailChunk) + "\nlast"},
+		"single line big": {strings.Repeat("y", fileTailChunk*2+7), 1, strings.Repeat("y", fileTailChunk*2+7)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tailFile(strings.NewReader(tt.data), int64(len(tt.data)), tt.n)
+			require.NoError(err, "tailFile() returned an error: %s", err)
+			require.Equal(tt.want, string(got), "tailFile() did not match")
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RunIf is when a Test runs inside a Tile.
+type RunIf string
+
+const (
+	RunOnSuccess RunIf = ""        // Run until a test which must succeed fails, and only if every test in After passed. The default.
+	RunOnFailure RunIf = "failure" // Run only if a test in After, or any earlier test without After, failed. Used for remediation.
+	RunAlways    RunIf = "always"  // Run no matter what happened before. Used for cleanup.
+)
+
+var (
+	ErrInvalidFlow = fmt.Errorf("invalid flow")
+	ErrUnsafeVar   = fmt.Errorf("variable is not safe to use in a shell command")
+
+	validVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// varPattern matches the {{Var(name)}} placeholders testers expand with captured variables.
+	varPattern = regexp.MustCompile(`\{\{\s*Var\(([A-Za-z_][A-Za-z0-9_]*)\)\s*\}\}`)
+	// shellSafe matches values which mean the same thing to a shell whether they are quoted or not.
+	shellSafe = regexp.MustCompile(`^[A-Za-z0-9_.,:/@%+=-]*$`)
+)
+
+// Flow controls when a Test runs inside a Tile and what it captures for later tests. Flow is only
+// used when the Tile runs its tests in sequence.
+type Flow struct {
+	When     RunIf     `json:"when,omitempty" yaml:"when,omitempty"`
+	After    []string  `json:"after,omitempty" yaml:"after,omitempty"`       // Names of earlier tests in the Tile this test depends on. See RunIf.
+	Requires []string  `json:"requires,omitempty" yaml:"requires,omitempty"` // Variables which must be set or the test is skipped.
+	Capture  []Capture `json:"capture,omitempty" yaml:"capture,omitempty"`   // Variables to capture from the output of the test.
+}
+
+// Capture sets Var to the first submatch of Regex, or the whole match if there are no submatches,
+// in the output a Test writes to Buffers.Logs. Nothing is captured from quiet tests.
+// {Var: "pid", Regex: `MainPID=(\d+)`}
+type Capture struct {
+	Var   string `json:"var" yaml:"var"`
+	Regex string `json:"regex" yaml:"regex"`
+}
+
+// Validate checks When, the variable names, and the capture regexes.
+func (f Flow) Validate() error {
+	switch f.When {
+	case RunOnSuccess, RunOnFailure, RunAlways:
+	default:
+		return fmt.Errorf("tests.Flow.Validate: %w: when must be %s or %s: %s", ErrInvalidFlow, RunOnFailure, RunAlways, f.When)
+	}
+
+	for _, v := range f.Requires {
+		if !validVarName.MatchString(v) {
+			return fmt.Errorf("tests.Flow.Validate: %w: invalid variable name: %s", ErrInvalidFlow, v)
+		}
+	}
+
+	for _, c := range f.Capture {
+		if !validVarName.MatchString(c.Var) {
+			return fmt.Errorf("tests.Flow.Validate: %w: invalid variable name: %s", ErrInvalidFlow, c.Var)
+		}
+
+		if _, err := regexp.Compile(c.Regex); err != nil {
+			return fmt.Errorf("tests.Flow.Validate: %w: %s: %w", ErrInvalidFlow, c.Var, err)
+		}
+	}
+
+	return nil
+}
+
+// IsZero returns true if the Flow has no settings.
+func (f Flow) IsZero() bool {
+	return f.When == RunOnSuccess && len(f.After) == 0 && len(f.Requires) == 0 && len(f.Capture) == 0
+}
+
+// Missing returns the Requires variables which are not set in vars.
+func (f Flow) Missing(vars map[string]string) []string {
+	var missing []string
+	for _, v := range f.Requires {
+		if _, ok := vars[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+
+	return missing
+}
+
+// CaptureVars applies the Captures to output and sets the matches in vars. Captures which do not
+// match are left unset.
+func (f Flow) CaptureVars(output []byte, vars map[string]string) {
+	for _, c := range f.Capture {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			continue
+		}
+
+		m := re.FindSubmatch(output)
+		switch {
+		case m == nil:
+			continue
+		case len(m) > 1:
+			vars[c.Var] = string(m[1])
+		default:
+			vars[c.Var] = string(m[0])
+		}
+	}
+}
+
+// SetFlow validates and sets Test.Flow.
+func (t *Test) SetFlow(f Flow) error {
+	if err := f.Validate(); err != nil {
+		return fmt.Errorf("tests.Test.SetFlow: %w", err)
+	}
+
+	t.Flow = f
+	return nil
+}
+
+// VarsArg returns a "vars" TestArg holding the variables captured by earlier tests in a Tile.
+func VarsArg(vars map[string]string) TestArg { return TestArg{Key: "vars", Value: vars} }
+
+// ExpandVars replaces {{Var(name)}} in s with the value of name from the "vars" TestArg. Unset
+// variables are left as is.
+func ExpandVars(s string, args []TestArg) string {
+	vars := GetArg[map[string]string](args, "vars", nil)
+	if len(vars) == 0 {
+		return s
+	}
+
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		v, ok := vars[varPattern.FindStringSubmatch(m)[1]]
+		if !ok {
+			return m
+		}
+
+		return v
+	})
+}
+
+// ExpandShellVars is ExpandVars for shell commands. Captured variables come from remote output so
+// a value with anything other than letters, digits, and _.,:/@%+=- returns ErrUnsafeVar instead of
+// being put in the command.
+func ExpandShellVars(s string, args []TestArg) (string, error) {
+	vars := GetArg[map[string]string](args, "vars", nil)
+	for _, m := range varPattern.FindAllStringSubmatch(s, -1) {
+		if v, ok := vars[m[1]]; ok && !shellSafe.MatchString(v) {
+			return s, fmt.Errorf("tests.ExpandShellVars: %w: %s: %q", ErrUnsafeVar, m[1], v)
+		}
+	}
+
+	return ExpandVars(s, args), nil
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowValidate(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError(Flow{}.Validate(), "Flow.Validate() returned an error for the zero value")
+	require.NoError(Flow{
+		When:     RunOnFailure,
+		After:    []string{"Check"},
+		Requires: []string{"pid"},
+		Capture:  []Capture{{Var: "pid", Regex: `MainPID=(\d+)`}},
+	}.Validate(), "Flow.Validate() returned an error")
+
+	require.ErrorIs(Flow{When: "sometimes"}.Validate(), ErrInvalidFlow, "when was not checked")
+	require.ErrorIs(Flow{Requires: []string{"not-a-var"}}.Validate(), ErrInvalidFlow, "requires was not checked")
+	require.ErrorIs(Flow{Capture: []Capture{{Var: "1pid", Regex: ".*"}}}.Validate(), ErrInvalidFlow, "capture var was not checked")
+	require.ErrorIs(Flow{Capture: []Capture{{Var: "pid", Regex: "("}}}.Validate(), ErrInvalidFlow, "capture regex was not checked")
+
+	test := NewMockTest(false)
+	require.ErrorIs(test.SetFlow(Flow{When: "sometimes"}), ErrInvalidFlow, "Test.SetFlow() did not validate")
+}
+
+func TestFlowCaptureVars(t *testing.T) {
+	require := require.New(t)
+	flow := Flow{Capture: []Capture{
+		{Var: "pid", Regex: `MainPID=(\d+)`},
+		{Var: "state", Regex: `active|inactive`},
+		{Var: "missing", Regex: `nope`},
+	}}
+
+	vars := map[string]string{"missing": "kept"}
+	flow.CaptureVars([]byte("ActiveState=active\nMainPID=4242\n"), vars)
+	require.Equal(map[string]string{"pid": "4242", "state": "active", "missing": "kept"}, vars, "captured vars did not match")
+	require.Empty(Flow{Requires: []string{"pid", "state"}}.Missing(vars), "Flow.Missing() returned set vars")
+	require.Equal([]string{"port"}, Flow{Requires: []string{"pid", "port"}}.Missing(vars), "Flow.Missing() did not match")
+}
+
+func TestFlowExpandVars(t *testing.T) {
+	require := require.New(t)
+	args := []TestArg{VarsArg(map[string]string{"pid": "4242"})}
+
+	require.Equal("kill -0 4242", ExpandVars("kill -0 {{Var(pid)}}", args), "var was not expanded")
+	require.Equal("kill -0 4242", ExpandVars("kill -0 {{ Var(pid) }}", args), "var with spaces was not expanded")
+	require.Equal("echo {{Var(port)}}", ExpandVars("echo {{Var(port)}}", args), "unset var was changed")
+	require.Equal("echo {{Var(pid)}}", ExpandVars("echo {{Var(pid)}}", nil), "var was expanded without vars")
+}
+
+func TestFlowExpandShellVars(t *testing.T) {
+	require := require.New(t)
+	args := []TestArg{VarsArg(map[string]string{
+		"pid":   "4242",
+		"path":  "/var/run/app-1.pid",
+		"semi":  "1; rm -rf /",
+		"sub":   "$(id)",
+		"quote": "1' || id '",
+	})}
+
+	got, err := ExpandShellVars("kill -0 {{Var(pid)}} && cat {{Var(path)}}", args)
+	require.NoError(err, "ExpandShellVars() returned an error: %s", err)
+	require.Equal("kill -0 4242 && cat /var/run/app-1.pid", got, "vars were not expanded")
+
+	for _, name := range []string{"semi", "sub", "quote"} {
+		_, err := ExpandShellVars("kill -0 '{{Var("+name+")}}'", args)
+		require.ErrorIs(err, ErrUnsafeVar, "ExpandShellVars() allowed %s", name)
+	}
+
+	got, err = ExpandShellVars("echo {{Var(port)}}", args)
+	require.NoError(err, "ExpandShellVars() returned an error for an unset var: %s", err)
+	require.Equal("echo {{Var(port)}}", got, "unset var was changed")
+}
+
+func TestFlowConfig(t *testing.T) {
+	require := require.New(t)
+	flow := Flow{When: RunAlways, Requires: []string{"pid"}, Capture: []Capture{{Var: "pid", Regex: `(\d+)`}}}
+
+	test, err := Build(TestConfig{Type: "ssh", Name: "Cleanup", Args: map[string]any{"cmd": "kill {{Var(pid)}}"}, Flow: &flow})
+	require.NoError(err, "Build() returned an error: %s", err)
+	require.Equal(flow, test.Flow, "Build() did not set the Flow")
+
+	data, err := json.Marshal(test)
+	require.NoError(err, "json.Marshal() returned an error: %s", err)
+	require.Contains(string(data), `"flow":{"when":"always"`, "Flow was not marshalled")
+
+	var got Test
+	require.NoError(json.Unmarshal(data, &got), "json.Unmarshal() returned an error")
+	require.Equal(flow, got.Flow, "Flow did not survive a JSON round trip")
+
+	_, err = Build(TestConfig{Type: "ssh", Args: map[string]any{"cmd": "true"}, Flow: &Flow{When: "later"}})
+	require.ErrorIs(err, ErrInvalidFlow, "Build() did not return ErrInvalidFlow")
+}
@@ -3,6 +3,8 @@ package tests
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
@@ -13,26 +15,67 @@ const (
 	PingDefaultCount          = 1
 	PingDefaultTimeout        = time.Second * 10
 	PingDefaultSuccessPercent = 1
+	PingDefaultNetwork        = "ip"
 )
 
+// PingPrivileged sets the default for the "privileged" TestArg. It is set from
+// core.Config.PingPrivileged at startup. Privileged pings use raw ICMP sockets and require root or
+// CAP_NET_RAW. Unprivileged pings use UDP ICMP sockets which need net.ipv4.ping_group_range on Linux.
+var PingPrivileged = false
+
 // PingTest is a struct that holds the parameters for a Ping test.
 type PingTest struct {
 	successPercent float32
 	count          int
 	timeout        time.Duration
+	network        string        // "ip", "ip4", or "ip6".
+	privileged     bool          // Use raw ICMP instead of UDP ICMP sockets.
+	maxAvgRtt      time.Duration // Fail if the average rtt is over maxAvgRtt. 0 skips the check.
+	maxRtt         time.Duration // Fail if any rtt is over maxRtt. 0 skips the check.
+	maxJitter      time.Duration // Fail if the jitter is over maxJitter. 0 skips the check.
+	quiet          bool          // Do not print the ping output to Buffers.Logs.
+}
+
+// PingStatistics holds the results of a ping. PacketLoss is a percentage from 0 to 100. Jitter is
+// the mean difference between consecutive round-trip times.
+type PingStatistics struct {
+	Addr                  string
+	IPAddr                string
+	PacketsSent           int
+	PacketsRecv           int
+	PacketsRecvDuplicates int
+	PacketLoss            float64
+	Rtts                  []time.Duration
+	MinRtt                time.Duration
+	AvgRtt                time.Duration
+	MaxRtt                time.Duration
+	StdDevRtt             time.Duration
+	Jitter                time.Duration
 }
 
 // NewPingTest creates a new Ping test with the given parameters.
 // name: The name of the test.
 // mustSucceed: If false, the Tile will continue with the test stack if this test fails.
-// successPerc: Must receive packets greater than or equal to successPerc to pass. Float 0 - 1
-//
-//	Defaults to 1 (100%). If 0, the test will only pass if no packets are received.
-//
+// successPerc: Must receive packets greater than or equal to successPerc to pass. Float 0 - 1.
+// Defaults to 1 (100%). If 0, the test will only pass if no packets are received.
 // These TestArg will be evaluated:
 // "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
 // "count": int. Number of packets to send. Default is 1.
-func NewPingTest(name string, mustSucceed bool, successPerc float32, args ...TestArg) Test {
+// "network": string. "ip4" or "ip6" to force the address family. Default is "ip" which uses
+// whichever the hostname resolves to.
+// "privileged": bool. If true, send raw ICMP pings. Default is PingPrivileged.
+// "max_avg_rtt": (int, int64, time.Duration) int/int64 will be converted into time.Millisecond * int.
+// "max_rtt": (int, int64, time.Duration) int/int64 will be converted into time.Millisecond * int.
+// "max_jitter": (int, int64, time.Duration) int/int64 will be converted into time.Millisecond * int.
+// "quiet": bool. If true, the output will not be printed to Buffers.Logs.
+//
+// Returns an error listing every arg which does not match PingArgs.
+func NewPingTest(name string, mustSucceed bool, successPerc float32, args ...TestArg) (Test, error) {
+	args, err := PingArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewPingTest: %w", err)
+	}
+
 	if successPerc < 0 {
 		successPerc = 0
 	}
@@ -48,21 +91,40 @@ func NewPingTest(name string, mustSucceed bool, successPerc float32, args ...Tes
 			successPercent: successPerc,
 			count:          getPingCount(args),
 			timeout:        getPingTimeout(args),
+			network:        getPingNetwork(args),
+			privileged:     getPingPrivileged(args),
+			maxAvgRtt:      GetMilliseconds(args, "max_avg_rtt"),
+			maxRtt:         GetMilliseconds(args, "max_rtt"),
+			maxJitter:      GetMilliseconds(args, "max_jitter"),
+			quiet:          BeQuiet(args),
 		},
-	}
+	}, nil
 }
 
 func getPingCount(args []TestArg) int {
-	v := FindArg(args, "count")
-	if v == nil || v.(int) == 0 {
+	v := GetArg(args, "count", 0)
+	if v == 0 {
 		return PingDefaultCount
 	}
 
-	return v.(int)
+	return v
 }
 
 func getPingTimeout(args []TestArg) time.Duration { return GetTimeout(args, PingDefaultTimeout) }
 
+func getPingNetwork(args []TestArg) string {
+	switch strings.ToLower(GetArg(args, "network", PingDefaultNetwork)) {
+	case "ip4", "ipv4":
+		return "ip4"
+	case "ip6", "ipv6":
+		return "ip6"
+	default:
+		return PingDefaultNetwork
+	}
+}
+
+func getPingPrivileged(args []TestArg) bool { return GetArg(args, "privileged", PingPrivileged) }
+
 func (p PingTest) runPinger(pinger *probing.Pinger, bufs connections.Buffers, quiet bool) error {
 	buf := &bytes.Buffer{}
 
@@ -102,32 +164,137 @@ round-trip min/avg/max/stddev = %v/%v/%v/%v`,
 	return nil
 }
 
-// Ping use a UDP ping using the pro-bing library. Returns nil if successful.
+// NewPingStatistics converts the pro-bing statistics into PingStatistics and calculates jitter.
+func NewPingStatistics(stats *probing.Statistics) PingStatistics {
+	s := PingStatistics{
+		Addr:                  stats.Addr,
+		PacketsSent:           stats.PacketsSent,
+		PacketsRecv:           stats.PacketsRecv,
+		PacketsRecvDuplicates: stats.PacketsRecvDuplicates,
+		PacketLoss:            stats.PacketLoss,
+		Rtts:                  stats.Rtts,
+		MinRtt:                stats.MinRtt,
+		AvgRtt:                stats.AvgRtt,
+		MaxRtt:                stats.MaxRtt,
+		StdDevRtt:             stats.StdDevRtt,
+	}
+
+	if stats.IPAddr != nil {
+		s.IPAddr = stats.IPAddr.String()
+	}
+
+	if len(stats.Rtts) > 1 {
+		var total time.Duration
+		for i := 1; i < len(stats.Rtts); i++ {
+			d := stats.Rtts[i] - stats.Rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+
+			total += d
+		}
+
+		s.Jitter = total / time.Duration(len(stats.Rtts)-1)
+	}
+
+	return s
+}
+
+// Ping pings the server and returns the statistics. Returns an error if the ping could not be
+// ran, not if packets were lost.
 // These TestArg will be evaluated:
-// "quiet": bool. If true, the output will not be printed Buffers.Logs.
-func (p PingTest) Run(server connections.Server, args ...TestArg) error {
-	pinger, err := probing.NewPinger(server.GetHostAddr())
-	if err != nil {
-		return err
+// "quiet": bool. If true, the output will not be printed to Buffers.Logs even if the test was not
+// created with "quiet".
+func (p PingTest) Ping(server connections.Server, args ...TestArg) (PingStatistics, error) {
+	pinger := probing.New(server.GetHostAddr())
+	pinger.SetNetwork(p.network)
+	pinger.SetPrivileged(p.privileged)
+	if err := pinger.Resolve(); err != nil {
+		return PingStatistics{}, err
 	}
 
 	pinger.Count = p.count
 	pinger.Timeout = p.timeout
-	err = p.runPinger(pinger, server.Buffers, BeQuiet(args))
+	err := p.runPinger(pinger, server.Buffers, p.quiet || BeQuiet(args))
 	if err != nil {
-		return err
+		return PingStatistics{}, err
 	}
 
-	rec := float32(pinger.Statistics().PacketsRecv / p.count)
-	if p.successPercent == 0 {
-		if rec > 0 {
-			return ErrTestFailed
-		}
+	return NewPingStatistics(pinger.Statistics()), nil
+}
+
+// Check compares stats against the success percent and rtt thresholds. Returns ErrTestFailed and
+// logs why if any of them are not met.
+func (p PingTest) Check(stats PingStatistics, bufs connections.Buffers) error {
+	var problems []string
+	rec := float32(stats.PacketsRecv) / float32(p.count)
+	if p.successPercent == 0 && rec > 0 {
+		problems = append(problems, fmt.Sprintf("received %d packets, expected none", stats.PacketsRecv))
 	}
 
 	if rec < p.successPercent {
+		problems = append(problems, fmt.Sprintf("received %.0f%% of packets, expected %.0f%%", rec*100, p.successPercent*100))
+	}
+
+	if p.maxAvgRtt > 0 && stats.AvgRtt > p.maxAvgRtt {
+		problems = append(problems, fmt.Sprintf("avg rtt %s was over %s", stats.AvgRtt, p.maxAvgRtt))
+	}
+
+	if p.maxRtt > 0 && stats.MaxRtt > p.maxRtt {
+		problems = append(problems, fmt.Sprintf("max rtt %s was over %s", stats.MaxRtt, p.maxRtt))
+	}
+
+	if p.maxJitter > 0 && stats.Jitter > p.maxJitter {
+		problems = append(problems, fmt.Sprintf("jitter %s was over %s", stats.Jitter, p.maxJitter))
+	}
+
+	if len(problems) > 0 {
+		bufs.Log(time.Now(), fmt.Sprintf("PingTest: %s", strings.Join(problems, ", ")))
 		return ErrTestFailed
 	}
 
 	return nil
 }
+
+// Config returns "ping" and the args needed to build the PingTest again.
+func (p PingTest) Config() (string, []TestArg) {
+	// Format as a float32 so 0.9 is saved as 0.9 and not 0.8999999761581421.
+	perc, _ := strconv.ParseFloat(strconv.FormatFloat(float64(p.successPercent), 'f', -1, 32), 64)
+	args := []TestArg{
+		{Key: "success_percent", Value: perc},
+		{Key: "count", Value: p.count},
+		{Key: "timeout", Value: p.timeout.String()},
+		{Key: "network", Value: p.network},
+		{Key: "privileged", Value: p.privileged},
+	}
+
+	if p.maxAvgRtt > 0 {
+		args = append(args, TestArg{Key: "max_avg_rtt", Value: p.maxAvgRtt.String()})
+	}
+
+	if p.maxRtt > 0 {
+		args = append(args, TestArg{Key: "max_rtt", Value: p.maxRtt.String()})
+	}
+
+	if p.maxJitter > 0 {
+		args = append(args, TestArg{Key: "max_jitter", Value: p.maxJitter.String()})
+	}
+
+	if p.quiet {
+		args = append(args, TestArg{Key: "quiet", Value: true})
+	}
+
+	return "ping", args
+}
+
+// Run pings the server and checks the results. Returns nil if successful.
+// These TestArg will be evaluated:
+// "quiet": bool. If true, the output will not be printed to Buffers.Logs.
+func (p PingTest) Run(server connections.Server, args ...TestArg) error {
+	stats, err := p.Ping(server, args...)
+	if err != nil {
+		return err
+	}
+
+	return p.Check(stats, server.Buffers)
+}
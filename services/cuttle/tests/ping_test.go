@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"net"
 	"testing"
 	"time"
 
@@ -28,42 +29,175 @@ func TestPingNewPingTest(t *testing.T) {
 	perc := float32(1)
 
 	t.Run("success", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, perc)
+		test, err := NewPingTest("Ping Test", true, perc)
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal("Ping Test", test.Name, "NewPingTest() Name is not 'Ping Test'")
 		require.True(test.MustSucceed, "NewPingTest() MustSucceed is not true")
 		require.Equal(perc, test.Tester.(*PingTest).successPercent, "NewPingTest() successPercent is not 1")
 	})
 
 	t.Run("neg successPerc", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, -1.5)
+		test, err := NewPingTest("Ping Test", true, -1.5)
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(float32(0), test.Tester.(*PingTest).successPercent, "NewPingTest() successPerc is not 0")
 	})
 
 	t.Run(">1 successPerc", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, 1.5)
+		test, err := NewPingTest("Ping Test", true, 1.5)
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(float32(1), test.Tester.(*PingTest).successPercent, "NewPingTest() successPerc is not 1")
 	})
 
 	t.Run("set count", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, perc, TestArg{Key: "count", Value: 4})
+		test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "count", Value: 4})
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(4, test.Tester.(*PingTest).count, "NewPingTest() count is not 4")
 	})
 
 	t.Run("count zero", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, perc, TestArg{Key: "count", Value: 0})
+		test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "count", Value: 0})
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(PingDefaultCount, test.Tester.(*PingTest).count, "NewPingTest() count is not 1")
 	})
 
 	t.Run("set timeout", func(t *testing.T) {
 		timeout := time.Second * 4
-		test := NewPingTest("Ping Test", true, perc, TestArg{Key: "timeout", Value: timeout})
+		test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "timeout", Value: timeout})
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(timeout, test.Tester.(*PingTest).timeout, "NewPingTest() timeout did not match")
 	})
 
 	t.Run("timeout zero", func(t *testing.T) {
-		test := NewPingTest("Ping Test", true, perc, TestArg{Key: "timeout", Value: 0})
+		test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "timeout", Value: 0})
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
 		require.Equal(PingDefaultTimeout, test.Tester.(*PingTest).timeout, "NewPingTest() timeout did not match")
 	})
+
+	t.Run("defaults", func(t *testing.T) {
+		test, err := NewPingTest("Ping Test", true, perc)
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
+		require.Equal(PingDefaultNetwork, test.Tester.(*PingTest).network, "NewPingTest() network was not the default")
+		require.Equal(PingPrivileged, test.Tester.(*PingTest).privileged, "NewPingTest() privileged was not the default")
+		require.Zero(test.Tester.(*PingTest).maxAvgRtt, "NewPingTest() maxAvgRtt was set")
+	})
+
+	t.Run("network", func(t *testing.T) {
+		for arg, want := range map[string]string{"ipv6": "ip6", "IP4": "ip4", "ip6": "ip6", "ip": "ip"} {
+			test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "network", Value: arg})
+			require.NoError(err, "NewPingTest() returned an error: %s", err)
+			require.Equal(want, test.Tester.(*PingTest).network, "NewPingTest() network did not match for %s", arg)
+		}
+
+		_, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "network", Value: "bogus"})
+		require.ErrorIs(err, ErrInvalidArg, "NewPingTest() did not return ErrInvalidArg")
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		_, err := NewPingTest("Ping Test", true, perc,
+			TestArg{Key: "count", Value: "4"},
+			TestArg{Key: "privileged", Value: 1},
+			TestArg{Key: "bogus", Value: true},
+		)
+		require.ErrorIs(err, ErrInvalidArg, "NewPingTest() did not return ErrInvalidArg")
+		require.Contains(err.Error(), "count: is string, expected int", "count problem was not reported")
+		require.Contains(err.Error(), "privileged: is int, expected bool", "privileged problem was not reported")
+		require.Contains(err.Error(), "bogus: unknown arg", "unknown arg was not reported")
+	})
+
+	t.Run("privileged", func(t *testing.T) {
+		test, err := NewPingTest("Ping Test", true, perc, TestArg{Key: "privileged", Value: !PingPrivileged})
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
+		require.Equal(!PingPrivileged, test.Tester.(*PingTest).privileged, "NewPingTest() privileged did not match")
+	})
+
+	t.Run("thresholds", func(t *testing.T) {
+		test, err := NewPingTest("Ping Test", true, perc,
+			TestArg{Key: "max_avg_rtt", Value: 50},
+			TestArg{Key: "max_rtt", Value: time.Millisecond * 100},
+			TestArg{Key: "max_jitter", Value: int64(10)},
+		)
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
+		require.Equal(time.Millisecond*50, test.Tester.(*PingTest).maxAvgRtt, "NewPingTest() maxAvgRtt did not match")
+		require.Equal(time.Millisecond*100, test.Tester.(*PingTest).maxRtt, "NewPingTest() maxRtt did not match")
+		require.Equal(time.Millisecond*10, test.Tester.(*PingTest).maxJitter, "NewPingTest() maxJitter did not match")
+	})
+	t.Run("quiet", func(t *testing.T) {
+		test, err := NewPingTest("Ping Test", true, perc, Quiet())
+		require.NoError(err, "NewPingTest() returned an error: %s", err)
+		require.True(test.Tester.(*PingTest).quiet, "NewPingTest() quiet was not set")
+		_, args := test.Tester.(*PingTest).Config()
+		require.True(BeQuiet(args), "PingTest.Config() did not keep quiet")
+	})
+}
+
+func TestPingNewPingStatistics(t *testing.T) {
+	require := require.New(t)
+	ms := time.Millisecond
+
+	t.Run("jitter", func(t *testing.T) {
+		stats := NewPingStatistics(&probing.Statistics{
+			Addr:        "test.home",
+			IPAddr:      &net.IPAddr{IP: net.ParseIP("fd00::1")},
+			PacketsSent: 4,
+			PacketsRecv: 4,
+			Rtts:        []time.Duration{10 * ms, 20 * ms, 14 * ms, 16 * ms},
+			MaxRtt:      20 * ms,
+		})
+
+		require.Equal("fd00::1", stats.IPAddr, "PingStatistics.IPAddr did not match")
+		require.Equal(4, stats.PacketsRecv, "PingStatistics.PacketsRecv did not match")
+		require.Equal(20*ms, stats.MaxRtt, "PingStatistics.MaxRtt did not match")
+		// |20-10| + |14-20| + |16-14| = 18ms over 3 gaps.
+		require.Equal(6*ms, stats.Jitter, "PingStatistics.Jitter did not match")
+	})
+
+	t.Run("single reply", func(t *testing.T) {
+		stats := NewPingStatistics(&probing.Statistics{Rtts: []time.Duration{10 * ms}})
+		require.Zero(stats.Jitter, "PingStatistics.Jitter was not 0")
+		require.Empty(stats.IPAddr, "PingStatistics.IPAddr was not empty")
+	})
+}
+
+func TestPingCheck(t *testing.T) {
+	require := require.New(t)
+	ms := time.Millisecond
+	stats := PingStatistics{PacketsSent: 4, PacketsRecv: 3, AvgRtt: 20 * ms, MaxRtt: 40 * ms, Jitter: 8 * ms}
+
+	check := func(p PingTest) (string, error) {
+		server := testServerSetup(t)
+		err := p.Check(stats, server.Buffers)
+		return server.Logs.String(), err
+	}
+
+	t.Run("partial loss passes", func(t *testing.T) {
+		// 3 of 4 used to be 3/4 == 0 with integer division.
+		_, err := check(PingTest{successPercent: 0.75, count: 4})
+		require.NoError(err, "PingTest.Check() returned an error")
+	})
+
+	t.Run("partial loss fails", func(t *testing.T) {
+		logs, err := check(PingTest{successPercent: 1, count: 4})
+		require.ErrorIs(err, ErrTestFailed, "PingTest.Check() did not return ErrTestFailed")
+		require.Contains(logs, "received 75% of packets, expected 100%", "loss was not logged")
+	})
+
+	t.Run("expect none", func(t *testing.T) {
+		_, err := check(PingTest{successPercent: 0, count: 4})
+		require.ErrorIs(err, ErrTestFailed, "PingTest.Check() did not return ErrTestFailed")
+	})
+
+	t.Run("thresholds pass", func(t *testing.T) {
+		_, err := check(PingTest{successPercent: 0.5, count: 4, maxAvgRtt: 20 * ms, maxRtt: 50 * ms, maxJitter: 10 * ms})
+		require.NoError(err, "PingTest.Check() returned an error")
+	})
+
+	t.Run("thresholds fail", func(t *testing.T) {
+		logs, err := check(PingTest{successPercent: 0.5, count: 4, maxAvgRtt: 10 * ms, maxRtt: 30 * ms, maxJitter: 5 * ms})
+		require.ErrorIs(err, ErrTestFailed, "PingTest.Check() did not return ErrTestFailed")
+		require.Contains(logs, "avg rtt 20ms was over 10ms", "avg rtt was not logged")
+		require.Contains(logs, "max rtt 40ms was over 30ms", "max rtt was not logged")
+		require.Contains(logs, "jitter 8ms was over 5ms", "jitter was not logged")
+	})
 }
 
 func TestPingRunPinger(t *testing.T) {
@@ -138,8 +272,9 @@ func TestPingRun(t *testing.T) {
 
 func TestPingIntegration(t *testing.T) {
 	server := testServerSetup(t)
-	test := NewPingTest("Ping Test", true, 1, Quiet())
-	err := test.Run(server)
+	test, err := NewPingTest("Ping Test", true, 1, Quiet())
+	require.NoError(t, err, "NewPingTest() returned an error: %s", err)
+	err = test.Run(server)
 
 	if test.MustSucceed && err != nil {
 		t.Errorf("Ping() returned an error: %s", err)
@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownTestType   = fmt.Errorf("unknown test type")
+	ErrDuplicateTestType = fmt.Errorf("test type already registered")
+	ErrNotConfigurable   = fmt.Errorf("tester cannot be saved")
+)
+
+// Factory builds a Test from args which have already been parsed with the Registration's Schema.
+type Factory func(name string, mustSucceed bool, args []TestArg) (Test, error)
+
+// Registration is a test type which can be built from a TestConfig.
+type Registration struct {
+	Type        string    // Name used in TestConfig.Type. "ping"
+	Description string    // Short description for clients.
+	Schema      ArgSchema // Every arg the Factory accepts. Constructor parameters are Required.
+	Factory     Factory
+}
+
+// Configurer is implemented by Testers which can be saved as a TestConfig.
+type Configurer interface {
+	// Config returns the registered type name and the args needed to build the Tester again. Values
+	// must survive a JSON or YAML round trip. Durations are strings and []byte are strings.
+	Config() (string, []TestArg)
+}
+
+// TestConfig is the stored form of a Test. Args are checked against the Schema of Type.
+type TestConfig struct {
+	Type        string         `json:"type" yaml:"type"`
+	Name        string         `json:"name" yaml:"name"`
+	MustSucceed bool           `json:"must_succeed" yaml:"must_succeed"`
+	Args        map[string]any `json:"args,omitempty" yaml:"args,omitempty"`
+	Retry       *Retry         `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Flow        *Flow          `json:"flow,omitempty" yaml:"flow,omitempty"`
+}
+
+// Registry maps test type names to the Factory which builds them.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]Registration
+}
+
+// DefaultRegistry holds the built-in test types. Test uses it to marshal and unmarshal itself.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]Registration)}
+}
+
+// Register adds a test type to the Registry. Returns ErrDuplicateTestType if the type is already
+// registered.
+func (r *Registry) Register(reg Registration) error {
+	if reg.Type == "" {
+		return fmt.Errorf("tests.Registry.Register: type cannot be empty")
+	}
+
+	if reg.Factory == nil {
+		return fmt.Errorf("tests.Registry.Register: %s: factory cannot be nil", reg.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.types[reg.Type]; ok {
+		return fmt.Errorf("tests.Registry.Register: %w: %s", ErrDuplicateTestType, reg.Type)
+	}
+
+	r.types[reg.Type] = reg
+	return nil
+}
+
+// Get returns the Registration for typ.
+func (r *Registry) Get(typ string) (Registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reg, ok := r.types[typ]
+	return reg, ok
+}
+
+// Types returns the registered type names in order.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.types))
+	for typ := range r.types {
+		types = append(types, typ)
+	}
+
+	sort.Strings(types)
+	return types
+}
+
+// Schemas returns the Schema of every registered type keyed by type name.
+func (r *Registry) Schemas() map[string]ArgSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schemas := make(map[string]ArgSchema, len(r.types))
+	for typ, reg := range r.types {
+		schemas[typ] = reg.Schema
+	}
+
+	return schemas
+}
+
+// Build checks cfg.Args against the Schema of cfg.Type and builds the Test.
+func (r *Registry) Build(cfg TestConfig) (Test, error) {
+	reg, ok := r.Get(cfg.Type)
+	if !ok {
+		return Test{}, fmt.Errorf("tests.Registry.Build: %w: %s", ErrUnknownTestType, cfg.Type)
+	}
+
+	args, err := reg.Schema.Parse(argsFromMap(cfg.Args))
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.Registry.Build: %s: %w", cfg.Type, err)
+	}
+
+	test, err := reg.Factory(cfg.Name, cfg.MustSucceed, args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.Registry.Build: %s: %w", cfg.Type, err)
+	}
+
+	if cfg.Retry != nil {
+		if err := test.SetRetry(*cfg.Retry); err != nil {
+			return Test{}, fmt.Errorf("tests.Registry.Build: %s: %w", cfg.Type, err)
+		}
+	}
+
+	if cfg.Flow != nil {
+		if err := test.SetFlow(*cfg.Flow); err != nil {
+			return Test{}, fmt.Errorf("tests.Registry.Build: %s: %w", cfg.Type, err)
+		}
+	}
+
+	return test, nil
+}
+
+// Register adds a test type to DefaultRegistry.
+func Register(reg Registration) error { return DefaultRegistry.Register(reg) }
+
+// Build builds a Test from cfg with DefaultRegistry.
+func Build(cfg TestConfig) (Test, error) { return DefaultRegistry.Build(cfg) }
+
+// Config returns the TestConfig the Test can be built again from. Returns ErrNotConfigurable if the
+// Tester does not implement Configurer.
+func (t Test) Config() (TestConfig, error) {
+	c, ok := t.Tester.(Configurer)
+	if !ok {
+		return TestConfig{}, fmt.Errorf("tests.Test.Config: %w: %T", ErrNotConfigurable, t.Tester)
+	}
+
+	typ, args := c.Config()
+	cfg := TestConfig{Type: typ, Name: t.Name, MustSucceed: t.MustSucceed}
+	if t.Retry != (Retry{}) {
+		retry := t.Retry
+		cfg.Retry = &retry
+	}
+
+	if !t.Flow.IsZero() {
+		flow := t.Flow
+		cfg.Flow = &flow
+	}
+
+	if len(args) > 0 {
+		cfg.Args = make(map[string]any, len(args))
+		for _, a := range args {
+			cfg.Args[a.Key] = a.Value
+		}
+	}
+
+	return cfg, nil
+}
+
+func (t Test) MarshalJSON() ([]byte, error) {
+	cfg, err := t.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(cfg)
+}
+
+func (t *Test) UnmarshalJSON(data []byte) error {
+	var cfg TestConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	test, err := Build(cfg)
+	if err != nil {
+		return err
+	}
+
+	*t = test
+	return nil
+}
+
+func (t Test) MarshalYAML() (any, error) { return t.Config() }
+
+func (t *Test) UnmarshalYAML(value *yaml.Node) error {
+	var cfg TestConfig
+	if err := value.Decode(&cfg); err != nil {
+		return err
+	}
+
+	test, err := Build(cfg)
+	if err != nil {
+		return err
+	}
+
+	*t = test
+	return nil
+}
+
+// argsFromMap converts stored args into a TestArg slice sorted by key so errors are reported in a
+// stable order.
+func argsFromMap(m map[string]any) []TestArg {
+	args := make([]TestArg, 0, len(m))
+	for k, v := range m {
+		args = append(args, TestArg{Key: k, Value: v})
+	}
+
+	slices.SortFunc(args, func(a, b TestArg) int { return strings.Compare(a.Key, b.Key) })
+
+	return args
+}
+
+// withoutArgs returns args minus the given keys. Factories use it to strip constructor parameters
+// before passing the rest along as TestArg.
+func withoutArgs(args []TestArg, keys ...string) []TestArg {
+	var rest []TestArg
+	for _, a := range args {
+		if !slices.Contains(keys, a.Key) {
+			rest = append(rest, a)
+		}
+	}
+
+	return rest
+}
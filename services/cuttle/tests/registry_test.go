@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// testRegistryConfigs returns a config for every built-in type.
+func testRegistryConfigs() []TestConfig {
+	return []TestConfig{
+		{Type: "ping", Args: map[string]any{"success_percent": 0.9, "count": 4, "max_rtt": "100ms"}},
+		{Type: "tcp_open", Args: map[string]any{"port": 22, "timeout": 4}},
+		{Type: "tcp_half_open", Args: map[string]any{"port": 22}},
+		{Type: "tcp_banner", Args: map[string]any{"port": 6379, "exp": "contains:+PONG", "probe": "PING\r\n"}},
+		{Type: "udp_probe", Args: map[string]any{"port": 53, "probe": "hi", "read_bytes": 512}},
+		{Type: "ssh", Args: map[string]any{
+			"cmd":      "whoami",
+			"exp":      "root",
+			"hide_cmd": false,
+			"run_as":   map[string]any{"method": connections.EscalateSudo, "user": "root"},
+		}},
+		{Type: "dns", Args: map[string]any{"record_type": "MX", "lookup": "cuttle.test", "expect": []any{"10 mail.cuttle.test"}}},
+		{Type: "tls_cert", Args: map[string]any{"sni": "svc.cuttle.test", "min_days": 30}},
+		{Type: "file_exists", Args: map[string]any{"path": "/etc/hosts"}},
+		{Type: "file_checksum", Args: map[string]any{"path": "/etc/hosts", "checksum": "d41d8cd98f00b204e9800998ecf8427e", "algorithm": "md5"}},
+		{Type: "file_mode", Args: map[string]any{"path": "/etc/hosts", "mode": "0644", "uid": 0}},
+		{Type: "file_contents", Args: map[string]any{"path": "/etc/hostname", "template": "{{ .Hostname }}\n"}},
+		{Type: "file_tail", Args: map[string]any{"path": "/var/log/syslog", "lines": 20, "exp": "contains:started"}},
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	require := require.New(t)
+	r := NewRegistry()
+	factory := func(name string, mustSucceed bool, args []TestArg) (Test, error) {
+		return Test{Name: name, MustSucceed: mustSucceed, Tester: &MockTest{fail: GetArg(args, "fail", false)}}, nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		err := r.Register(Registration{Type: "mock", Schema: ArgSchema{{Key: "fail", Type: ArgBool}}, Factory: factory})
+		require.NoError(err, "Registry.Register() returned an error: %s", err)
+		require.Equal([]string{"mock"}, r.Types(), "Registry.Types() did not match")
+
+		test, err := r.Build(TestConfig{Type: "mock", Name: "Mock", Args: map[string]any{"fail": true}})
+		require.NoError(err, "Registry.Build() returned an error: %s", err)
+		require.ErrorIs(test.Run(connections.Server{}), ErrTestFailed, "built test did not get its args")
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		err := r.Register(Registration{Type: "mock", Factory: factory})
+		require.ErrorIs(err, ErrDuplicateTestType, "Registry.Register() did not return ErrDuplicateTestType")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(r.Register(Registration{Factory: factory}), "Registry.Register() did not return an error")
+		require.Error(r.Register(Registration{Type: "nil"}), "Registry.Register() did not return an error")
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := r.Build(TestConfig{Type: "ping"})
+		require.ErrorIs(err, ErrUnknownTestType, "Registry.Build() did not return ErrUnknownTestType")
+	})
+}
+
+func TestRegistryBuild(t *testing.T) {
+	require := require.New(t)
+
+	for _, cfg := range testRegistryConfigs() {
+		t.Run(cfg.Type, func(t *testing.T) {
+			cfg.Name = "Test " + cfg.Type
+			test, err := Build(cfg)
+			require.NoError(err, "Build() returned an error: %s", err)
+			require.Equal(cfg.Name, test.Name, "Build() Name did not match")
+
+			got, err := test.Config()
+			require.NoError(err, "Test.Config() returned an error: %s", err)
+			require.Equal(cfg.Type, got.Type, "Test.Config() Type did not match")
+		})
+	}
+
+	t.Run("args", func(t *testing.T) {
+		test, err := Build(TestConfig{Type: "ping", Args: map[string]any{"count": float64(3), "timeout": "2s"}})
+		require.NoError(err, "Build() returned an error: %s", err)
+		p := test.Tester.(*PingTest)
+		require.Equal(3, p.count, "count did not match")
+		require.Equal(2*time.Second, p.timeout, "timeout did not match")
+		require.Equal(float32(PingDefaultSuccessPercent), p.successPercent, "successPercent was not the default")
+	})
+
+	t.Run("missing required", func(t *testing.T) {
+		_, err := Build(TestConfig{Type: "file_checksum", Args: map[string]any{"algorithm": 1}})
+		require.ErrorIs(err, ErrInvalidArg, "Build() did not return ErrInvalidArg")
+		require.Contains(err.Error(), "path: required", "missing path was not reported")
+		require.Contains(err.Error(), "checksum: required", "missing checksum was not reported")
+		require.Contains(err.Error(), "algorithm: is int, expected string", "bad algorithm was not reported")
+	})
+
+	t.Run("constructor error", func(t *testing.T) {
+		_, err := Build(TestConfig{Type: "file_mode", Args: map[string]any{"path": "/etc/hosts", "mode": "rw-r--r--"}})
+		require.ErrorIs(err, ErrInvalidArg, "Build() did not return ErrInvalidArg")
+	})
+
+	t.Run("not configurable", func(t *testing.T) {
+		_, err := NewMockTest(false).Config()
+		require.ErrorIs(err, ErrNotConfigurable, "Test.Config() did not return ErrNotConfigurable")
+	})
+}
+
+func TestRegistryMarshal(t *testing.T) {
+	require := require.New(t)
+
+	for _, cfg := range testRegistryConfigs() {
+		cfg.Name = "Test " + cfg.Type
+		cfg.MustSucceed = true
+		test, err := Build(cfg)
+		require.NoError(err, "Build() returned an error: %s", err)
+		exp, err := test.Config()
+		require.NoError(err, "Test.Config() returned an error: %s", err)
+
+		t.Run(cfg.Type+" json", func(t *testing.T) {
+			data, err := json.Marshal(test)
+			require.NoError(err, "json.Marshal() returned an error: %s", err)
+
+			var got Test
+			require.NoError(json.Unmarshal(data, &got), "json.Unmarshal() returned an error")
+			require.Equal(test, got, "JSON round trip did not match")
+		})
+
+		t.Run(cfg.Type+" yaml", func(t *testing.T) {
+			data, err := yaml.Marshal(test)
+			require.NoError(err, "yaml.Marshal() returned an error: %s", err)
+
+			var got Test
+			require.NoError(yaml.Unmarshal(data, &got), "yaml.Unmarshal() returned an error")
+			cfg, err := got.Config()
+			require.NoError(err, "Test.Config() returned an error: %s", err)
+			require.Equal(exp, cfg, "YAML round trip did not match")
+		})
+	}
+
+	t.Run("unknown type", func(t *testing.T) {
+		var got Test
+		err := json.Unmarshal([]byte(`{"type":"bogus","name":"Bogus"}`), &got)
+		require.ErrorIs(err, ErrUnknownTestType, "json.Unmarshal() did not return ErrUnknownTestType")
+	})
+}
@@ -0,0 +1,304 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+
+	// MaxRetryAttempts limits how many times a single Test can be attempted.
+	MaxRetryAttempts = 10
+)
+
+var ErrInvalidRetry = fmt.Errorf("invalid retry")
+
+// retryWait waits d between attempts. Returns false if ctx is done first. Replaced in tests.
+var retryWait = func(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// RetryOn is a set of error kinds a Test will be retried on.
+type RetryOn uint8
+
+const (
+	RetryOnTimeout RetryOn = 1 << iota // The test timed out.
+	RetryOnFailed                      // The test ran but returned ErrTestFailed. An expect mismatch.
+	RetryOnError                       // Any other error. Connection refused, auth failures, etc.
+
+	RetryOnAny = RetryOnTimeout | RetryOnFailed | RetryOnError
+)
+
+var retryOnNames = []struct {
+	on   RetryOn
+	name string
+}{
+	{RetryOnTimeout, "timeout"},
+	{RetryOnFailed, "failed"},
+	{RetryOnError, "error"},
+}
+
+// Retry holds the retry settings of a Test. The zero value runs the test once.
+type Retry struct {
+	MaxAttempts int           // Total attempts including the first. 0 or 1 runs the test once.
+	Backoff     string        // BackoffFixed or BackoffExponential. Defaults to BackoffFixed.
+	Delay       time.Duration // Wait after the first failed attempt.
+	MaxDelay    time.Duration // Caps exponential backoff. 0 is no cap.
+	On          RetryOn       // Error kinds to retry on. 0 retries on any.
+}
+
+// Attempt records a single run of a Test.
+type Attempt struct {
+	Number   int
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Result is the outcome of running a Test with its Retry settings.
+type Result struct {
+	Attempts []Attempt
+	Err      error // The error of the last attempt.
+}
+
+// Passed returns true if the last attempt passed.
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Retried returns true if the Test needed more than one attempt.
+func (r Result) Retried() bool { return len(r.Attempts) > 1 }
+
+// Validate checks the Retry settings.
+func (r Retry) Validate() error {
+	if r.MaxAttempts < 0 || r.MaxAttempts > MaxRetryAttempts {
+		return fmt.Errorf("tests.Retry.Validate: %w: max attempts must be between 0 and %d", ErrInvalidRetry, MaxRetryAttempts)
+	}
+
+	if r.Backoff != "" && r.Backoff != BackoffFixed && r.Backoff != BackoffExponential {
+		return fmt.Errorf("tests.Retry.Validate: %w: backoff must be %s or %s: %s", ErrInvalidRetry, BackoffFixed, BackoffExponential, r.Backoff)
+	}
+
+	if r.Delay < 0 || r.MaxDelay < 0 {
+		return fmt.Errorf("tests.Retry.Validate: %w: delays cannot be negative", ErrInvalidRetry)
+	}
+
+	if r.On&^RetryOnAny != 0 {
+		return fmt.Errorf("tests.Retry.Validate: %w: unknown retry on value: %d", ErrInvalidRetry, r.On)
+	}
+
+	return nil
+}
+
+// Attempts returns the number of times the Test will be attempted. Always at least 1.
+func (r Retry) Attempts() int {
+	if r.MaxAttempts < 1 {
+		return 1
+	}
+
+	return r.MaxAttempts
+}
+
+// ShouldRetry returns true if err is one of the kinds in Retry.On.
+func (r Retry) ShouldRetry(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	on := r.On
+	if on == 0 {
+		on = RetryOnAny
+	}
+
+	return on&ErrorKind(err) != 0
+}
+
+// DelayAfter returns how long to wait after the given failed attempt number.
+func (r Retry) DelayAfter(attempt int) time.Duration {
+	if r.Backoff != BackoffExponential || attempt < 2 {
+		return r.Delay
+	}
+
+	d := r.Delay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if r.MaxDelay > 0 && d >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+
+	return d
+}
+
+// ErrorKind sorts err into RetryOnTimeout, RetryOnFailed, or RetryOnError.
+func ErrorKind(err error) RetryOn {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return RetryOnTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return RetryOnTimeout
+	case errors.Is(err, ErrTestFailed):
+		return RetryOnFailed
+	default:
+		return RetryOnError
+	}
+}
+
+// SetRetry validates and sets Test.Retry.
+func (t *Test) SetRetry(r Retry) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("tests.Test.SetRetry: %w", err)
+	}
+
+	t.Retry = r
+	return nil
+}
+
+// RunWithRetry runs the Test until it passes, the error is not one Retry.On covers, or the attempts
+// run out. When the Test can be retried, every failed attempt is written to server.Buffers.Results
+// so a pass on retry can be told apart from a clean pass.
+func (t Test) RunWithRetry(server connections.Server, args ...TestArg) Result {
+	return t.RunContext(context.Background(), server, args...)
+}
+
+// RunContext is RunWithRetry but gives up once ctx is done. An attempt which has already started
+// is not interrupted. If ctx is done before the first attempt, Result.Err is the ctx error.
+func (t Test) RunContext(ctx context.Context, server connections.Server, args ...TestArg) Result {
+	var res Result
+	max := t.Retry.Attempts()
+	for n := 1; n <= max; n++ {
+		if err := ctx.Err(); err != nil && n == 1 {
+			res.Err = err
+			return res
+		}
+
+		start := time.Now()
+		err := t.Run(server, args...)
+		res.Attempts = append(res.Attempts, Attempt{Number: n, Start: start, Duration: time.Since(start), Err: err})
+		res.Err = err
+		if err == nil {
+			return res
+		}
+
+		if max > 1 {
+			server.Buffers.PrintResults(
+				time.Now(),
+				fmt.Sprintf("%s - attempt %d/%d...fail", t.Name, n, max),
+				err,
+			)
+		}
+
+		if n == max || !t.Retry.ShouldRetry(err) {
+			return res
+		}
+
+		if !retryWait(ctx, t.Retry.DelayAfter(n)) {
+			return res
+		}
+	}
+
+	return res
+}
+
+// retryConfig is the stored form of Retry. Durations are strings and On is a list of names.
+type retryConfig struct {
+	MaxAttempts int      `json:"max_attempts" yaml:"max_attempts"`
+	Backoff     string   `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	Delay       string   `json:"delay,omitempty" yaml:"delay,omitempty"`
+	MaxDelay    string   `json:"max_delay,omitempty" yaml:"max_delay,omitempty"`
+	On          []string `json:"on,omitempty" yaml:"on,omitempty"`
+}
+
+func (r Retry) config() retryConfig {
+	cfg := retryConfig{MaxAttempts: r.MaxAttempts, Backoff: r.Backoff}
+	if r.Delay > 0 {
+		cfg.Delay = r.Delay.String()
+	}
+
+	if r.MaxDelay > 0 {
+		cfg.MaxDelay = r.MaxDelay.String()
+	}
+
+	for _, n := range retryOnNames {
+		if r.On&n.on != 0 {
+			cfg.On = append(cfg.On, n.name)
+		}
+	}
+
+	return cfg
+}
+
+func (r *Retry) fromConfig(cfg retryConfig) error {
+	next := Retry{MaxAttempts: cfg.MaxAttempts, Backoff: cfg.Backoff}
+	var err error
+	if cfg.Delay != "" {
+		if next.Delay, err = time.ParseDuration(cfg.Delay); err != nil {
+			return fmt.Errorf("%w: delay: %w", ErrInvalidRetry, err)
+		}
+	}
+
+	if cfg.MaxDelay != "" {
+		if next.MaxDelay, err = time.ParseDuration(cfg.MaxDelay); err != nil {
+			return fmt.Errorf("%w: max_delay: %w", ErrInvalidRetry, err)
+		}
+	}
+
+	for _, name := range cfg.On {
+		found := false
+		for _, n := range retryOnNames {
+			if n.name == name {
+				next.On |= n.on
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%w: unknown retry on value: %s", ErrInvalidRetry, name)
+		}
+	}
+
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	*r = next
+	return nil
+}
+
+func (r Retry) MarshalJSON() ([]byte, error) { return json.Marshal(r.config()) }
+
+func (r *Retry) UnmarshalJSON(data []byte) error {
+	var cfg retryConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	return r.fromConfig(cfg)
+}
+
+func (r Retry) MarshalYAML() (any, error) { return r.config(), nil }
+
+func (r *Retry) UnmarshalYAML(value *yaml.Node) error {
+	var cfg retryConfig
+	if err := value.Decode(&cfg); err != nil {
+		return err
+	}
+
+	return r.fromConfig(cfg)
+}
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// testFlaky returns errs in order, then nil once they run out.
+type testFlaky struct {
+	errs  []error
+	calls int
+}
+
+func (t *testFlaky) Run(server connections.Server, args ...TestArg) error {
+	t.calls++
+	if t.calls > len(t.errs) {
+		return nil
+	}
+
+	return t.errs[t.calls-1]
+}
+
+func testNoSleep(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	wait := retryWait
+	retryWait = func(ctx context.Context, d time.Duration) bool {
+		slept = append(slept, d)
+		return ctx.Err() == nil
+	}
+
+	t.Cleanup(func() { retryWait = wait })
+	return &slept
+}
+
+func TestRetryValidate(t *testing.T) {
+	require := require.New(t)
+
+	require.NoError(Retry{}.Validate(), "Retry.Validate() returned an error for the zero value")
+	require.NoError(Retry{MaxAttempts: 3, Backoff: BackoffExponential, Delay: time.Second, On: RetryOnTimeout}.Validate())
+	require.ErrorIs(Retry{MaxAttempts: MaxRetryAttempts + 1}.Validate(), ErrInvalidRetry, "max attempts was not checked")
+	require.ErrorIs(Retry{Backoff: "linear"}.Validate(), ErrInvalidRetry, "backoff was not checked")
+	require.ErrorIs(Retry{Delay: -time.Second}.Validate(), ErrInvalidRetry, "delay was not checked")
+	require.ErrorIs(Retry{On: 1 << 7}.Validate(), ErrInvalidRetry, "on was not checked")
+}
+
+func TestRetryDelayAfter(t *testing.T) {
+	require := require.New(t)
+
+	fixed := Retry{Delay: time.Second}
+	require.Equal(time.Second, fixed.DelayAfter(1), "fixed delay did not match")
+	require.Equal(time.Second, fixed.DelayAfter(3), "fixed delay did not match")
+
+	exp := Retry{Backoff: BackoffExponential, Delay: time.Second, MaxDelay: 5 * time.Second}
+	require.Equal(time.Second, exp.DelayAfter(1), "exponential delay did not match")
+	require.Equal(2*time.Second, exp.DelayAfter(2), "exponential delay did not match")
+	require.Equal(4*time.Second, exp.DelayAfter(3), "exponential delay did not match")
+	require.Equal(5*time.Second, exp.DelayAfter(4), "exponential delay was not capped")
+}
+
+func TestRetryErrorKind(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(RetryOnTimeout, ErrorKind(fmt.Errorf("read: %w", os.ErrDeadlineExceeded)), "timeout was not detected")
+	require.Equal(RetryOnFailed, ErrorKind(ErrTestFailed), "ErrTestFailed was not detected")
+	require.Equal(RetryOnError, ErrorKind(fmt.Errorf("connection refused")), "other error was not detected")
+}
+
+func TestRetryRunWithRetry(t *testing.T) {
+	require := require.New(t)
+	server := testServerSetup(t)
+
+	run := func(retry Retry, errs ...error) (Result, *testFlaky) {
+		flaky := &testFlaky{errs: errs}
+		test := Test{Name: "Flaky Test", MustSucceed: true, Tester: flaky}
+		require.NoError(test.SetRetry(retry), "Test.SetRetry() returned an error")
+		server.Buffers.Clear()
+		return test.RunWithRetry(server), flaky
+	}
+
+	t.Run("no retry", func(t *testing.T) {
+		res, flaky := run(Retry{}, ErrTestFailed)
+		require.ErrorIs(res.Err, ErrTestFailed, "RunWithRetry() did not return the error")
+		require.Equal(1, flaky.calls, "test was retried")
+		require.Empty(server.Results.String(), "attempt was written to the results")
+	})
+
+	t.Run("pass on retry", func(t *testing.T) {
+		slept := testNoSleep(t)
+		res, flaky := run(Retry{MaxAttempts: 3, Backoff: BackoffExponential, Delay: 10 * time.Millisecond}, ErrTestFailed, ErrTestFailed)
+		require.True(res.Passed(), "RunWithRetry() did not pass")
+		require.True(res.Retried(), "RunWithRetry() was not marked as retried")
+		require.Equal(3, flaky.calls, "test was not attempted 3 times")
+		require.Len(res.Attempts, 3, "attempts were not recorded")
+		require.ErrorIs(res.Attempts[0].Err, ErrTestFailed, "attempt error was not recorded")
+		require.Nil(res.Attempts[2].Err, "last attempt was not a pass")
+		require.Equal([]time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, *slept, "backoff did not match")
+		require.Contains(server.Results.String(), "Flaky Test - attempt 1/3...fail", "attempt 1 was not written to the results")
+		require.Contains(server.Results.String(), "Flaky Test - attempt 2/3...fail", "attempt 2 was not written to the results")
+	})
+
+	t.Run("clean pass", func(t *testing.T) {
+		res, _ := run(Retry{MaxAttempts: 3})
+		require.True(res.Passed(), "RunWithRetry() did not pass")
+		require.False(res.Retried(), "RunWithRetry() was marked as retried")
+	})
+
+	t.Run("out of attempts", func(t *testing.T) {
+		testNoSleep(t)
+		res, flaky := run(Retry{MaxAttempts: 2}, ErrTestFailed, ErrTestFailed, ErrTestFailed)
+		require.ErrorIs(res.Err, ErrTestFailed, "RunWithRetry() did not return the error")
+		require.Equal(2, flaky.calls, "test was not attempted 2 times")
+	})
+
+	t.Run("only timeouts", func(t *testing.T) {
+		testNoSleep(t)
+		timeout := fmt.Errorf("dial: %w", os.ErrDeadlineExceeded)
+		res, flaky := run(Retry{MaxAttempts: 3, On: RetryOnTimeout}, timeout, ErrTestFailed)
+		require.ErrorIs(res.Err, ErrTestFailed, "RunWithRetry() did not stop on the expect mismatch")
+		require.Equal(2, flaky.calls, "test was retried on an expect mismatch")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		flaky := &testFlaky{errs: []error{ErrTestFailed}}
+		test := Test{Name: "Flaky Test", Tester: flaky, Retry: Retry{MaxAttempts: 3, Delay: time.Hour}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		res := test.RunContext(ctx, server)
+		require.ErrorIs(res.Err, context.Canceled, "RunContext() did not return the ctx error")
+		require.Zero(flaky.calls, "test ran after ctx was canceled")
+	})
+
+	t.Run("canceled during backoff", func(t *testing.T) {
+		flaky := &testFlaky{errs: []error{ErrTestFailed}}
+		test := Test{Name: "Flaky Test", Tester: flaky, Retry: Retry{MaxAttempts: 3, Delay: time.Hour}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		res := test.RunContext(ctx, server)
+		require.ErrorIs(res.Err, ErrTestFailed, "RunContext() did not return the last attempt's error")
+		require.Equal(1, flaky.calls, "test was retried after ctx was done")
+	})
+
+	t.Run("invalid retry", func(t *testing.T) {
+		test := Test{Name: "Flaky Test", Tester: &testFlaky{}}
+		require.ErrorIs(test.SetRetry(Retry{Backoff: "linear"}), ErrInvalidRetry, "Test.SetRetry() did not return ErrInvalidRetry")
+	})
+}
+
+func TestRetryConfig(t *testing.T) {
+	require := require.New(t)
+	retry := Retry{
+		MaxAttempts: 4,
+		Backoff:     BackoffExponential,
+		Delay:       500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		On:          RetryOnTimeout | RetryOnError,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(retry)
+		require.NoError(err, "json.Marshal() returned an error: %s", err)
+		require.JSONEq(`{"max_attempts":4,"backoff":"exponential","delay":"500ms","max_delay":"5s","on":["timeout","error"]}`, string(data))
+
+		var got Retry
+		require.NoError(json.Unmarshal(data, &got), "json.Unmarshal() returned an error")
+		require.Equal(retry, got, "Retry did not survive a JSON round trip")
+		require.ErrorIs(json.Unmarshal([]byte(`{"max_attempts":2,"on":["sometimes"]}`), &got), ErrInvalidRetry)
+	})
+
+	t.Run("test config", func(t *testing.T) {
+		test, err := Build(TestConfig{
+			Type:  "tcp_open",
+			Name:  "TCP Test",
+			Args:  map[string]any{"port": 22},
+			Retry: &retry,
+		})
+		require.NoError(err, "Build() returned an error: %s", err)
+		require.Equal(retry, test.Retry, "Build() did not set the Retry")
+
+		data, err := yaml.Marshal(test)
+		require.NoError(err, "yaml.Marshal() returned an error: %s", err)
+		require.Contains(string(data), "max_delay: 5s", "Retry was not marshalled")
+
+		var got Test
+		require.NoError(yaml.Unmarshal(data, &got), "yaml.Unmarshal() returned an error")
+		require.Equal(retry, got.Retry, "Retry did not survive a YAML round trip")
+	})
+
+	t.Run("invalid test config", func(t *testing.T) {
+		_, err := Build(TestConfig{Type: "tcp_open", Args: map[string]any{"port": 22}, Retry: &Retry{MaxAttempts: -1}})
+		require.ErrorIs(err, ErrInvalidRetry, "Build() did not return ErrInvalidRetry")
+	})
+}
+
+func TestRetrySSHTest(t *testing.T) {
+	require := require.New(t)
+	testNoSleep(t)
+	server := testFileServer(t)
+
+	// The command prints how many times it has ran so it only matches on the second attempt.
+	counter := filepath.Join(t.TempDir(), "count")
+	cmd := fmt.Sprintf("n=$(cat %[1]s 2>/dev/null || echo 0); n=$((n+1)); echo $n > %[1]s; echo $n", counter)
+	run := func(retry Retry) Result {
+		require.NoError(os.RemoveAll(counter), "os.RemoveAll() returned an error")
+		test, err := NewSSHTest("Counter", true, cmd, "line:2")
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
+		require.NoError(test.SetRetry(retry), "Test.SetRetry() returned an error")
+		server.Buffers.Clear()
+		return test.RunWithRetry(server)
+	}
+
+	t.Run("retry on failed", func(t *testing.T) {
+		res := run(Retry{MaxAttempts: 3, On: RetryOnFailed})
+		require.True(res.Passed(), "RunWithRetry() did not pass on retry")
+		require.Len(res.Attempts, 2, "expect mismatch was not retried")
+		require.ErrorIs(res.Attempts[0].Err, ErrTestFailed, "expect mismatch was not ErrTestFailed")
+		require.Contains(server.Results.String(), "Counter - attempt 1/3...fail", "attempt 1 was not written to the results")
+	})
+
+	t.Run("only errors", func(t *testing.T) {
+		res := run(Retry{MaxAttempts: 3, On: RetryOnError})
+		require.ErrorIs(res.Err, ErrTestFailed, "RunWithRetry() did not return ErrTestFailed")
+		require.Len(res.Attempts, 1, "expect mismatch was retried")
+	})
+}
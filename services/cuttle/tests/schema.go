@@ -0,0 +1,352 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+// ArgType is the type of value an ArgSpec accepts. Values are converted to the Go type listed so
+// testers can read them with GetArg without checking for other types.
+type ArgType string
+
+const (
+	ArgBool         ArgType = "bool"         // bool
+	ArgInt          ArgType = "int"          // int. Also accepts int64 and whole float64 from JSON.
+	ArgFloat        ArgType = "float"        // float64. Also accepts float32, int, and int64.
+	ArgString       ArgType = "string"       // string
+	ArgStrings      ArgType = "strings"      // []string. Also accepts []any of strings from JSON.
+	ArgBytes        ArgType = "bytes"        // []byte. Also accepts string.
+	ArgSeconds      ArgType = "seconds"      // time.Duration. Numbers are seconds. Also accepts "5s".
+	ArgMilliseconds ArgType = "milliseconds" // time.Duration. Numbers are milliseconds. Also accepts "250ms".
+	ArgPEM          ArgType = "pem"          // string path to a PEM file, or []byte PEM data.
+	ArgEscalation   ArgType = "escalation"   // connections.Escalation. Also accepts {"method": "sudo", "user": "root", "password": "<auth method name>"}.
+)
+
+var ErrInvalidArg = fmt.Errorf("invalid test arg")
+
+// ArgSpec describes a single TestArg a Tester accepts.
+type ArgSpec struct {
+	Key         string   `json:"key"`
+	Type        ArgType  `json:"type"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"` // Allowed values for ArgString. Compared case insensitively.
+	Min         *int     `json:"min,omitempty"`     // Smallest allowed ArgInt.
+	Max         *int     `json:"max,omitempty"`     // Largest allowed ArgInt.
+}
+
+// ArgSchema is the list of TestArg a Tester accepts. The API serves it so clients can build forms.
+type ArgSchema []ArgSpec
+
+// Find returns the ArgSpec for key.
+func (s ArgSchema) Find(key string) (ArgSpec, bool) {
+	for _, spec := range s {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+
+	return ArgSpec{}, false
+}
+
+// Parse checks every arg against the schema and returns the args with their values converted to
+// the Go type of their ArgType. Every problem, including missing Required args, is reported in the
+// returned error, each wrapping ErrInvalidArg, instead of stopping at the first one.
+func (s ArgSchema) Parse(args []TestArg) ([]TestArg, error) {
+	var errs []error
+	parsed := make([]TestArg, 0, len(args))
+	seen := make(map[string]bool, len(args))
+
+	for _, a := range args {
+		spec, ok := s.Find(a.Key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %s: unknown arg", ErrInvalidArg, a.Key))
+			continue
+		}
+
+		if seen[a.Key] {
+			errs = append(errs, fmt.Errorf("%w: %s: set more than once", ErrInvalidArg, a.Key))
+			continue
+		}
+		seen[a.Key] = true
+
+		v, err := spec.convert(a.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidArg, a.Key, err))
+			continue
+		}
+
+		parsed = append(parsed, TestArg{Key: a.Key, Value: v})
+	}
+
+	for _, spec := range s {
+		if spec.Required && !seen[spec.Key] {
+			errs = append(errs, fmt.Errorf("%w: %s: required", ErrInvalidArg, spec.Key))
+		}
+	}
+
+	return parsed, errors.Join(errs...)
+}
+
+// convert checks value against the spec and returns it as the Go type of spec.Type.
+func (spec ArgSpec) convert(value any) (any, error) {
+	switch spec.Type {
+	case ArgBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case ArgInt:
+		if v, ok := toInt(value); ok {
+			if spec.Min != nil && v < *spec.Min {
+				return nil, fmt.Errorf("must be at least %d", *spec.Min)
+			}
+
+			if spec.Max != nil && v > *spec.Max {
+				return nil, fmt.Errorf("must be at most %d", *spec.Max)
+			}
+
+			return v, nil
+		}
+	case ArgFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		}
+
+		if v, ok := toInt(value); ok {
+			return float64(v), nil
+		}
+	case ArgString:
+		if v, ok := value.(string); ok {
+			if len(spec.Options) > 0 && !slices.ContainsFunc(spec.Options, func(o string) bool { return strings.EqualFold(o, v) }) {
+				return nil, fmt.Errorf("must be one of %s", strings.Join(spec.Options, ", "))
+			}
+
+			return v, nil
+		}
+	case ArgStrings:
+		switch v := value.(type) {
+		case []string:
+			return v, nil
+		case []any:
+			list := make([]string, len(v))
+			for i, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("item %d is %T, expected string", i, item)
+				}
+
+				list[i] = s
+			}
+
+			return list, nil
+		}
+	case ArgBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	case ArgPEM:
+		switch v := value.(type) {
+		case string, []byte:
+			return v, nil
+		}
+	case ArgSeconds, ArgMilliseconds:
+		unit := time.Second
+		if spec.Type == ArgMilliseconds {
+			unit = time.Millisecond
+		}
+
+		d, ok, err := toDuration(value, unit)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			if d < 0 {
+				return nil, fmt.Errorf("cannot be negative")
+			}
+
+			return d, nil
+		}
+	case ArgEscalation:
+		var esc connections.Escalation
+		switch v := value.(type) {
+		case connections.Escalation:
+			esc = v
+		case *connections.Escalation:
+			if v == nil {
+				return nil, fmt.Errorf("cannot be nil")
+			}
+
+			esc = *v
+		case map[string]any:
+			esc.Method, _ = v["method"].(string)
+			esc.User, _ = v["user"].(string)
+			// Only the name of the password is stored. It is loaded with SSHTest.SetRunAsPassword.
+			if ref, _ := v["password"].(string); ref != "" {
+				esc.Password = connections.AuthMethod{Name: ref, AuthType: connections.AuthSSHPassword, Proto: connections.SSH}
+			}
+		default:
+			return nil, fmt.Errorf("is %T, expected %s", value, spec.Type)
+		}
+
+		if err := esc.Validate(); err != nil {
+			return nil, err
+		}
+
+		return esc, nil
+	default:
+		return nil, fmt.Errorf("unsupported arg type %s", spec.Type)
+	}
+
+	return nil, fmt.Errorf("is %T, expected %s", value, spec.Type)
+}
+
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		// JSON numbers are decoded as float64.
+		if v == math.Trunc(v) {
+			return int(v), true
+		}
+	}
+
+	return 0, false
+}
+
+func toDuration(value any, unit time.Duration) (time.Duration, bool, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, false, err
+		}
+
+		return d, true, nil
+	}
+
+	if n, ok := toInt(value); ok {
+		return unit * time.Duration(n), true, nil
+	}
+
+	return 0, false, nil
+}
+
+// GetArg returns the value of key if it is set and is a T. Otherwise def is returned. Use after
+// ArgSchema.Parse so values are already the right type.
+func GetArg[T any](args []TestArg, key string, def T) T {
+	v, ok := FindArg(args, key).(T)
+	if !ok {
+		return def
+	}
+
+	return v
+}
+
+func intPtr(i int) *int { return &i }
+
+// Common args shared by several testers.
+var (
+	quietArg = ArgSpec{
+		Key:         "quiet",
+		Type:        ArgBool,
+		Description: "Do not write output to the logs.",
+		Default:     false,
+	}
+	timeoutArg = func(def time.Duration) ArgSpec {
+		return ArgSpec{Key: "timeout", Type: ArgSeconds, Description: "How long to wait before giving up.", Default: def.String()}
+	}
+	readBytesArg = func(def int) ArgSpec {
+		return ArgSpec{
+			Key:         "read_bytes",
+			Type:        ArgInt,
+			Description: "Max number of bytes to read.",
+			Default:     def,
+			Min:         intPtr(0),
+			Max:         intPtr(TCPMaxReadBytes),
+		}
+	}
+)
+
+var (
+	PingArgs = ArgSchema{
+		timeoutArg(PingDefaultTimeout),
+		{Key: "count", Type: ArgInt, Description: "Number of packets to send.", Default: PingDefaultCount, Min: intPtr(0)},
+		{Key: "network", Type: ArgString, Description: "Address family to use.", Default: PingDefaultNetwork, Options: []string{"ip", "ip4", "ip6", "ipv4", "ipv6"}},
+		{Key: "privileged", Type: ArgBool, Description: "Send raw ICMP pings. Requires root or CAP_NET_RAW."},
+		{Key: "max_avg_rtt", Type: ArgMilliseconds, Description: "Fail if the average round-trip time is over this."},
+		{Key: "max_rtt", Type: ArgMilliseconds, Description: "Fail if any round-trip time is over this."},
+		{Key: "max_jitter", Type: ArgMilliseconds, Description: "Fail if the jitter is over this."},
+		quietArg,
+	}
+
+	TCPArgs = ArgSchema{timeoutArg(TCPDefaultTimeout)}
+
+	TCPBannerArgs = ArgSchema{
+		timeoutArg(TCPDefaultTimeout),
+		{Key: "probe", Type: ArgBytes, Description: "Payload to send before reading."},
+		readBytesArg(TCPDefaultReadBytes),
+		quietArg,
+	}
+
+	UDPArgs = ArgSchema{
+		timeoutArg(UDPDefaultTimeout),
+		readBytesArg(UDPDefaultReadBytes),
+		quietArg,
+	}
+
+	SSHArgs = ArgSchema{
+		{Key: "hide_cmd", Type: ArgBool, Description: "Do not send the command to non-admin users.", Default: true},
+		{Key: "hide_exp", Type: ArgBool, Description: "Do not send the expect string to non-admin users.", Default: true},
+		{Key: "run_as", Type: ArgEscalation, Description: "Run the command as another user with sudo or su."},
+	}
+
+	DNSArgs = ArgSchema{
+		{Key: "lookup", Type: ArgString, Description: "Name to resolve. Defaults to the server's hostname."},
+		{Key: "resolver", Type: ArgString, Description: "host or host:port of the DNS server to query. Defaults to the system resolver."},
+		{Key: "expect", Type: ArgStrings, Description: "Answers which must be returned."},
+		{Key: "exact", Type: ArgBool, Description: "The answers must match expect exactly.", Default: false},
+		{Key: "max_latency", Type: ArgMilliseconds, Description: "Fail if the lookup takes longer than this."},
+		timeoutArg(DNSDefaultTimeout),
+		quietArg,
+	}
+
+	TLSCertArgs = ArgSchema{
+		{Key: "sni", Type: ArgString, Description: "Server name to send and match the certificate against. Defaults to the server's hostname."},
+		{Key: "min_days", Type: ArgInt, Description: "Fail if the certificate expires in less days than this.", Default: TLSDefaultMinDays},
+		{Key: "ca_bundle", Type: ArgPEM, Description: "PEM data, or the path to a PEM file, of the CAs to verify the chain with."},
+		{Key: "verify_chain", Type: ArgBool, Description: "Verify the certificate chain.", Default: true},
+		{Key: "verify_hostname", Type: ArgBool, Description: "Match the certificate against the hostname.", Default: true},
+		timeoutArg(TLSDefaultTimeout),
+		quietArg,
+	}
+
+	FileChecksumArgs = ArgSchema{
+		{Key: "algorithm", Type: ArgString, Description: "Hash algorithm. One of md5, sha1, sha256, or sha512.", Default: FileDefaultAlgorithm},
+	}
+
+	FileModeArgs = ArgSchema{
+		{Key: "uid", Type: ArgInt, Description: "Expected owner uid.", Min: intPtr(0)},
+		{Key: "gid", Type: ArgInt, Description: "Expected group gid.", Min: intPtr(0)},
+	}
+
+	FileTailArgs = ArgSchema{quietArg}
+)
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaParse(t *testing.T) {
+	require := require.New(t)
+	schema := ArgSchema{
+		{Key: "bool", Type: ArgBool},
+		{Key: "int", Type: ArgInt, Min: intPtr(1), Max: intPtr(10)},
+		{Key: "string", Type: ArgString, Options: []string{"a", "b"}},
+		{Key: "strings", Type: ArgStrings},
+		{Key: "bytes", Type: ArgBytes},
+		{Key: "seconds", Type: ArgSeconds},
+		{Key: "ms", Type: ArgMilliseconds},
+		{Key: "pem", Type: ArgPEM},
+		{Key: "run_as", Type: ArgEscalation},
+	}
+
+	t.Run("converts", func(t *testing.T) {
+		args, err := schema.Parse([]TestArg{
+			{Key: "bool", Value: true},
+			{Key: "int", Value: float64(4)},
+			{Key: "string", Value: "B"},
+			{Key: "strings", Value: []any{"x", "y"}},
+			{Key: "bytes", Value: "PING"},
+			{Key: "seconds", Value: int64(5)},
+			{Key: "ms", Value: "250ms"},
+			{Key: "pem", Value: "/etc/ssl/ca.pem"},
+		})
+		require.NoError(err, "ArgSchema.Parse() returned an error: %s", err)
+		require.True(GetArg(args, "bool", false), "bool did not match")
+		require.Equal(4, GetArg(args, "int", 0), "int did not match")
+		require.Equal("B", GetArg(args, "string", ""), "string did not match")
+		require.Equal([]string{"x", "y"}, GetArg[[]string](args, "strings", nil), "strings did not match")
+		require.Equal([]byte("PING"), GetArg[[]byte](args, "bytes", nil), "bytes did not match")
+		require.Equal(5*time.Second, GetArg(args, "seconds", time.Duration(0)), "seconds did not match")
+		require.Equal(250*time.Millisecond, GetArg(args, "ms", time.Duration(0)), "ms did not match")
+		require.Equal("/etc/ssl/ca.pem", GetArg(args, "pem", ""), "pem did not stay a path")
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		args, err := schema.Parse([]TestArg{{Key: "run_as", Value: &connections.Escalation{Method: connections.EscalateSudo, User: "root"}}})
+		require.NoError(err, "ArgSchema.Parse() returned an error: %s", err)
+		require.IsType(connections.Escalation{}, FindArg(args, "run_as"), "run_as was not dereferenced")
+
+		_, err = schema.Parse([]TestArg{{Key: "run_as", Value: connections.Escalation{Method: "doas"}}})
+		require.ErrorIs(err, ErrInvalidArg, "ArgSchema.Parse() did not return ErrInvalidArg")
+	})
+
+	t.Run("reports all problems", func(t *testing.T) {
+		_, err := schema.Parse([]TestArg{
+			{Key: "bool", Value: "yes"},
+			{Key: "int", Value: 11},
+			{Key: "int", Value: 2},
+			{Key: "string", Value: "c"},
+			{Key: "strings", Value: []any{"x", 1}},
+			{Key: "seconds", Value: -1},
+			{Key: "ms", Value: 1.5},
+			{Key: "nope", Value: 1},
+		})
+		require.ErrorIs(err, ErrInvalidArg, "ArgSchema.Parse() did not return ErrInvalidArg")
+		for _, want := range []string{
+			"bool: is string, expected bool",
+			"int: must be at most 10",
+			"int: set more than once",
+			"string: must be one of a, b",
+			"strings: item 1 is int, expected string",
+			"seconds: cannot be negative",
+			"ms: is float64, expected milliseconds",
+			"nope: unknown arg",
+		} {
+			require.Contains(err.Error(), want, "ArgSchema.Parse() did not report %q", want)
+		}
+
+		var joined interface{ Unwrap() []error }
+		require.True(errors.As(err, &joined), "ArgSchema.Parse() did not join the errors")
+		require.Len(joined.Unwrap(), 8, "ArgSchema.Parse() did not report every problem")
+	})
+}
+
+func TestSchemaSchemas(t *testing.T) {
+	require := require.New(t)
+
+	for typ, schema := range DefaultRegistry.Schemas() {
+		seen := map[string]bool{}
+		for _, spec := range schema {
+			require.False(seen[spec.Key], "%s: %s is listed twice", typ, spec.Key)
+			seen[spec.Key] = true
+			require.NotEmpty(spec.Description, "%s: %s has no description", typ, spec.Key)
+		}
+	}
+}
+
+func TestSchemaNoPanics(t *testing.T) {
+	require := require.New(t)
+	// These used to panic with an unchecked type assertion.
+	_, err := NewSSHTest("SSH Test", true, "echo", "", TestArg{Key: "hide_cmd", Value: "false"})
+	require.ErrorIs(err, ErrInvalidArg, "NewSSHTest() did not return ErrInvalidArg")
+
+	_, err = NewTLSCertTest("TLS Test", true, 443, TestArg{Key: "min_days", Value: "14"})
+	require.ErrorIs(err, ErrInvalidArg, "NewTLSCertTest() did not return ErrInvalidArg")
+
+	_, err = NewDNSTest("DNS Test", true, "A", TestArg{Key: "expect", Value: "10.0.0.1"})
+	require.ErrorIs(err, ErrInvalidArg, "NewDNSTest() did not return ErrInvalidArg")
+
+	require.False(BeQuiet([]TestArg{{Key: "quiet", Value: "yes"}}), "BeQuiet() did not ignore a bad value")
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,61 +14,118 @@ type SSHTest struct {
 	HideExp bool   // Whether or not to send the exp value to the client.
 	Cmd     string // Command to run on a remote server.
 	Exp     string // String to match with the results of cmd.
+	// RunAs runs Cmd as another user with sudo or su when set. The server's Connector must
+	// implement connections.Escalator.
+	RunAs *connections.Escalation
 }
 
-// NewSSHTest creates a new SSH test with the given parameters.
+// NewSSHTest creates a new SSH test with the given parameters. Returns an error if exp is not a
+// valid expect string.
 // name: The name of the test.
 // mustSucceed: If false, the Tile will continue with the test stack if this test fails.
 // cmd: The command to run on the server.
-// exp: The expected output of the command.
-//
+// exp: The expected output of the command. See connections.ParseExpect for the format. An
+// empty exp only checks that the command ran successfully.
 // These TestArg will be evaluated:
 // "hide_cmd": bool. If true, the cmd will not be sent to the client. Default is true.
 // "hide_exp": bool. If true, the exp will not be sent to the client. Default is true.
-func NewSSHTest(name string, mustSucceed bool, cmd string, exp string, args ...TestArg) Test {
+// "run_as": connections.Escalation. Run cmd as another user with sudo or su. Default is unset.
+func NewSSHTest(name string, mustSucceed bool, cmd string, exp string, args ...TestArg) (Test, error) {
+	args, err := SSHArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewSSHTest: %w", err)
+	}
+
+	if err := connections.ValidateExpect(exp); err != nil {
+		return Test{}, fmt.Errorf("tests.NewSSHTest: %w", err)
+	}
+
+	tester := &SSHTest{
+		HideCmd: getSSHHideCmd(args),
+		HideExp: getSSHHideExp(args),
+		Cmd:     cmd,
+		Exp:     exp,
+	}
+
+	if esc, ok := FindArg(args, "run_as").(connections.Escalation); ok {
+		if err := tester.SetRunAs(esc); err != nil {
+			return Test{}, fmt.Errorf("tests.NewSSHTest: %w", err)
+		}
+	}
+
 	return Test{
 		Name:        name,
 		MustSucceed: mustSucceed,
-		Tester: &SSHTest{
-			HideCmd: getSSHHideCmd(args),
-			HideExp: getSSHHideExp(args),
-			Cmd:     cmd,
-			Exp:     exp,
-		},
-	}
+		Tester:      tester,
+	}, nil
 }
 
-func getSSHHideCmd(args []TestArg) bool {
-	v := FindArg(args, "hide_cmd")
-	if v == nil {
-		return true
+func getSSHHideCmd(args []TestArg) bool { return GetArg(args, "hide_cmd", true) }
+
+func getSSHHideExp(args []TestArg) bool { return GetArg(args, "hide_exp", true) }
+
+// Config returns "ssh" and the args needed to build the SSHTest again. The RunAs password is saved
+// as the name of its AuthMethod and has to be loaded with SetRunAsPassword once rebuilt.
+func (t SSHTest) Config() (string, []TestArg) {
+	args := []TestArg{
+		{Key: "cmd", Value: t.Cmd},
+		{Key: "exp", Value: t.Exp},
+		{Key: "hide_cmd", Value: t.HideCmd},
+		{Key: "hide_exp", Value: t.HideExp},
 	}
 
-	return v.(bool)
-}
+	if t.RunAs != nil {
+		runAs := map[string]any{"method": t.RunAs.Method, "user": t.RunAs.User}
+		if t.RunAs.Password.Name != "" {
+			runAs["password"] = t.RunAs.Password.Name
+		}
 
-func getSSHHideExp(args []TestArg) bool {
-	v := FindArg(args, "hide_exp")
-	if v == nil {
-		return true
+		args = append(args, TestArg{Key: "run_as", Value: runAs})
 	}
 
-	return v.(bool)
+	return "ssh", args
 }
 
+// Run runs SSHTest.Cmd on the server and matches the output against SSHTest.Exp. Returns
+// ErrTestFailed if the output does not match and the error otherwise. {{Var(name)}} in
+// Cmd and Exp is replaced with variables captured by earlier tests in the Tile. See ExpandShellVars
+// for the values allowed in Cmd.
 func (t SSHTest) Run(server connections.Server, args ...TestArg) error {
-	_, err := connections.Pool.Open(&server)
+	cmd, err := ExpandShellVars(t.Cmd, args)
 	if err != nil {
 		server.Buffers.Log(time.Now(), fmt.Sprintf("SSHTest.Run: %s", err))
-		return ErrTestFailed
+		return fmt.Errorf("tests.SSHTest.Run: %w", err)
 	}
 
-	err = server.Run(t.Cmd, t.Exp)
+	t.Cmd = cmd
+	t.Exp = ExpandVars(t.Exp, args)
+	_, err = connections.Pool.Open(&server)
 	if err != nil {
 		server.Buffers.Log(time.Now(), fmt.Sprintf("SSHTest.Run: %s", err))
+		return fmt.Errorf("tests.SSHTest.Run: %w", err)
+	}
+
+	if t.RunAs != nil && t.RunAs.PasswordMissing() {
+		server.Buffers.Log(time.Now(), fmt.Sprintf("SSHTest.Run: run_as password %s was not loaded", t.RunAs.Password.Name))
 		return ErrTestFailed
 	}
 
+	if t.RunAs != nil {
+		err = server.RunAs(*t.RunAs, t.Cmd, t.Exp)
+	} else {
+		err = server.Run(t.Cmd, t.Exp)
+	}
+
+	if err != nil {
+		server.Buffers.Log(time.Now(), fmt.Sprintf("SSHTest.Run: %s", err))
+		// Only a mismatch is a failed test. Anything else kept the test from running.
+		if errors.Is(err, connections.ErrExpectMismatch) {
+			return ErrTestFailed
+		}
+
+		return fmt.Errorf("tests.SSHTest.Run: %w", err)
+	}
+
 	return nil
 }
 
@@ -90,14 +148,49 @@ func (t *SSHTest) SetCmd(cmd string) error {
 }
 
 // SetExp sets the expect string which will be matches against the output of Tile.cmd after being
-// ran on a server.
+// ran on a server. See connections.ParseExpect for the format.
 func (t *SSHTest) SetExp(exp string) error {
 	exp = strings.TrimSpace(exp)
 	if exp == "" {
-		return fmt.Errorf("profiles.Tile.SetExp: exp cannot be empty or whitespace only")
+		// An empty exp only checks that the command ran successfully.
+		t.Exp = ""
+		return nil
+	}
+
+	if err := connections.ValidateExpect(exp); err != nil {
+		return fmt.Errorf("profiles.Tile.SetExp: %w", err)
 	}
 
 	// INCOMPLETE: Add html safe validation for exp here.
 	t.Exp = exp
 	return nil
 }
+
+// SetRunAs sets the user and method used to run Cmd with elevated privileges.
+func (t *SSHTest) SetRunAs(esc connections.Escalation) error {
+	if err := esc.Validate(); err != nil {
+		return fmt.Errorf("profiles.Tile.SetRunAs: %w", err)
+	}
+
+	t.RunAs = &esc
+	return nil
+}
+
+// SetRunAsPassword sets the password used to answer the RunAs prompt. The AuthMethod must have the
+// name RunAs.Password references.
+func (t *SSHTest) SetRunAsPassword(password connections.AuthMethod) error {
+	if t.RunAs == nil {
+		return fmt.Errorf("profiles.Tile.SetRunAsPassword: run_as is not set")
+	}
+
+	if password.Name != t.RunAs.Password.Name {
+		return fmt.Errorf("profiles.Tile.SetRunAsPassword: expected %s but got %s", t.RunAs.Password.Name, password.Name)
+	}
+
+	esc := *t.RunAs
+	esc.Password = password
+	return t.SetRunAs(esc)
+}
+
+// ClearRunAs removes the run-as settings so Cmd is ran as the connecting user.
+func (t *SSHTest) ClearRunAs() { t.RunAs = nil }
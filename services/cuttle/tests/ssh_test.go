@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
@@ -15,7 +17,8 @@ func TestSSHNewSSHTest(t *testing.T) {
 	require := require.New(t)
 
 	t.Run("basic", func(t *testing.T) {
-		test := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello")
+		test, err := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello")
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
 		require.Equal("Test SSH echo", test.Name, "NewSSHTest() Name is not 'Test SSH echo'")
 		require.True(test.MustSucceed, "NewSSHTest() MustSucceed is not true")
 		require.Equal("echo Hello", test.Tester.(*SSHTest).Cmd, "NewSSHTest() Cmd is not 'echo Hello'")
@@ -25,7 +28,8 @@ func TestSSHNewSSHTest(t *testing.T) {
 	})
 
 	t.Run("show cmd", func(t *testing.T) {
-		test := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello", TestArg{Key: "hide_cmd", Value: false})
+		test, err := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello", TestArg{Key: "hide_cmd", Value: false})
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
 		require.Equal("Test SSH echo", test.Name, "NewSSHTest() Name is not 'Test SSH echo'")
 		require.True(test.MustSucceed, "NewSSHTest() MustSucceed is not true")
 		require.Equal("echo Hello", test.Tester.(*SSHTest).Cmd, "NewSSHTest() Cmd is not 'echo Hello'")
@@ -35,7 +39,8 @@ func TestSSHNewSSHTest(t *testing.T) {
 	})
 
 	t.Run("show exp", func(t *testing.T) {
-		test := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello", TestArg{Key: "hide_exp", Value: false})
+		test, err := NewSSHTest("Test SSH echo", true, "echo Hello", "Hello", TestArg{Key: "hide_exp", Value: false})
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
 		require.Equal("Test SSH echo", test.Name, "NewSSHTest() Name is not 'Test SSH echo'")
 		require.True(test.MustSucceed, "NewSSHTest() MustSucceed is not true")
 		require.Equal("echo Hello", test.Tester.(*SSHTest).Cmd, "NewSSHTest() Cmd is not 'echo Hello'")
@@ -43,6 +48,17 @@ func TestSSHNewSSHTest(t *testing.T) {
 		require.True(test.Tester.(*SSHTest).HideCmd, "NewSSHTest() HideCmd is not true")
 		require.False(test.Tester.(*SSHTest).HideExp, "NewSSHTest() HideExp is not false")
 	})
+
+	t.Run("empty exp", func(t *testing.T) {
+		test, err := NewSSHTest("Test SSH echo", true, "echo Hello", "")
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
+		require.Empty(test.Tester.(*SSHTest).Exp, "NewSSHTest() Exp is not empty")
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		_, err := NewSSHTest("Test SSH echo", true, "echo Hello", "regex:(unclosed")
+		require.Error(err, "NewSSHTest() did not return an error")
+	})
 }
 
 func TestTilesSetHideCmd(t *testing.T) {
@@ -115,16 +131,15 @@ func TestTilesSetExp(t *testing.T) {
 		require.NoError(err, "SetExp() returned an error: %s", err)
 	})
 
-	/*
-		t.Run("invalid", func(t *testing.T) {
-			err := tile.SetExp("invalid expect string")
-			require.Error(err, "SetExp() did not return an error")
-		})
-	*/
+	t.Run("invalid", func(t *testing.T) {
+		err := test.SetExp("num:<90:(unclosed")
+		require.Error(err, "SetExp() did not return an error")
+	})
 
 	t.Run("empty", func(t *testing.T) {
 		err := test.SetExp("")
-		require.Error(err, "SetExp() did not return an error")
+		require.NoError(err, "SetExp() returned an error: %s", err)
+		require.Empty(test.Exp, "SetExp() did not clear Exp")
 	})
 }
 
@@ -148,4 +163,100 @@ func TestSSHTestRun(t *testing.T) {
 		err := test.Run(server)
 		require.Error(err, "SSHTest.Run() did not return an error")
 	})
+
+	t.Run("run as", func(t *testing.T) {
+		test := SSHTest{HideCmd: true, HideExp: true, Cmd: "echo Hello", Exp: "Hello"}
+		require.NoError(test.SetRunAs(connections.Escalation{Method: connections.EscalateSudo, User: "root"}))
+		err := test.Run(server)
+		require.NoError(err, "SSHTest.Run() returned an error: %s", err)
+		require.Contains(server.Logs.String(), "running as sudo -u root", "escalation was not logged")
+	})
+
+	t.Run("run as password not loaded", func(t *testing.T) {
+		test := SSHTest{Cmd: "echo Hello", Exp: "Hello"}
+		esc := connections.Escalation{Method: connections.EscalateSudo, User: "root"}
+		esc.Password = connections.AuthMethod{Name: "sudo-pass", AuthType: connections.AuthSSHPassword, Proto: connections.SSH}
+		require.NoError(test.SetRunAs(esc))
+		require.ErrorIs(test.Run(server), ErrTestFailed, "SSHTest.Run() ran without the password")
+		require.Contains(server.Logs.String(), "run_as password sudo-pass was not loaded", "missing password was not logged")
+	})
+}
+
+func TestSSHTestRunVars(t *testing.T) {
+	require := require.New(t)
+	server := testFileServer(t)
+	marker := filepath.Join(t.TempDir(), "injected")
+
+	t.Run("safe", func(t *testing.T) {
+		test := SSHTest{Cmd: "echo pid={{Var(pid)}}", Exp: "line:pid=4242"}
+		err := test.Run(server, VarsArg(map[string]string{"pid": "4242"}))
+		require.NoError(err, "SSHTest.Run() returned an error: %s", err)
+	})
+
+	for name, value := range map[string]string{
+		"semicolon":    "1; touch " + marker,
+		"substitution": "$(touch " + marker + ")",
+	} {
+		t.Run(name, func(t *testing.T) {
+			test := SSHTest{Cmd: "echo {{Var(pid)}}", Exp: ""}
+			err := test.Run(server, VarsArg(map[string]string{"pid": value}))
+			require.ErrorIs(err, ErrUnsafeVar, "SSHTest.Run() did not return ErrUnsafeVar")
+			require.NoFileExists(marker, "captured value was ran by the shell")
+		})
+	}
+}
+
+func TestSSHTestSetRunAs(t *testing.T) {
+	require := require.New(t)
+	test := SSHTest{}
+
+	t.Run("valid", func(t *testing.T) {
+		err := test.SetRunAs(connections.Escalation{Method: connections.EscalateSu, User: "postgres"})
+		require.NoError(err, "SSHTest.SetRunAs() returned an error: %s", err)
+		require.Equal("postgres", test.RunAs.User, "SSHTest.RunAs.User did not match")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := test.SetRunAs(connections.Escalation{Method: "doas", User: "root"})
+		require.ErrorIs(err, connections.ErrInvalidEscalation, "SSHTest.SetRunAs() did not return ErrInvalidEscalation")
+		require.Equal("postgres", test.RunAs.User, "SSHTest.RunAs was changed")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		test.ClearRunAs()
+		require.Nil(test.RunAs, "SSHTest.RunAs was not cleared")
+	})
+
+	t.Run("password", func(t *testing.T) {
+		var password connections.AuthMethod
+		password.SSHPassword("sudo-pass", []byte("secret"))
+		test, err := NewSSHTest("Test SSH sudo", true, "id", "", TestArg{
+			Key:   "run_as",
+			Value: connections.Escalation{Method: connections.EscalateSudo, User: "root", Password: password},
+		})
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
+
+		cfg, err := test.Config()
+		require.NoError(err, "Test.Config() returned an error: %s", err)
+		require.Equal("sudo-pass", cfg.Args["run_as"].(map[string]any)["password"], "password reference was not saved")
+		require.NotContains(fmt.Sprint(cfg), "secret", "password was saved")
+
+		got, err := Build(cfg)
+		require.NoError(err, "Build() returned an error: %s", err)
+		ssh := got.Tester.(*SSHTest)
+		require.True(ssh.RunAs.PasswordMissing(), "password reference was not restored")
+
+		var other connections.AuthMethod
+		other.SSHPassword("other", []byte("secret"))
+		require.Error(ssh.SetRunAsPassword(other), "SSHTest.SetRunAsPassword() allowed another password")
+		require.NoError(ssh.SetRunAsPassword(password), "SSHTest.SetRunAsPassword() returned an error")
+		require.False(ssh.RunAs.PasswordMissing(), "password was not loaded")
+	})
+
+	t.Run("from args", func(t *testing.T) {
+		esc := connections.Escalation{Method: connections.EscalateSudo, User: "root"}
+		test, err := NewSSHTest("Test SSH sudo", true, "id", "", TestArg{Key: "run_as", Value: esc})
+		require.NoError(err, "NewSSHTest() returned an error: %s", err)
+		require.Equal(esc, *test.Tester.(*SSHTest).RunAs, "NewSSHTest() RunAs did not match")
+	})
 }
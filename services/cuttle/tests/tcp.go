@@ -1,23 +1,34 @@
 package tests
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
 )
 
-const TCPDefaultTimeout = time.Second * 3
+const (
+	TCPDefaultTimeout   = time.Second * 3
+	TCPDefaultReadBytes = 1024
+	// TCPMaxReadBytes limits how much a banner or probe response test will read.
+	TCPMaxReadBytes = 65536
+)
 
 var ErrInvalidTestType = fmt.Errorf("invalid test type")
 
 // TCPTest is a struct that holds the parameters for TCP tests.
 type TCPTest struct {
-	testType string
-	port     string
-	timeout  time.Duration
+	testType  string
+	port      string
+	timeout   time.Duration
+	probe     []byte // banner: Sent after connecting, before reading.
+	readBytes int    // banner: Max number of bytes to read.
+	exp       string // banner: Expect string to match against what was read.
 }
 
 // NewTCPPortHalfOpen creates a new Test for tcp port open with the given parameters.
@@ -26,7 +37,12 @@ type TCPTest struct {
 //
 // These TestArg will be evaluated:
 // "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
-func NewTCPPortHalfOpen(name string, mustSucceed bool, port int, args ...TestArg) Test {
+func NewTCPPortHalfOpen(name string, mustSucceed bool, port int, args ...TestArg) (Test, error) {
+	args, err := TCPArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTCPPortHalfOpen: %w", err)
+	}
+
 	return Test{
 		Name:        name,
 		MustSucceed: mustSucceed,
@@ -35,7 +51,7 @@ func NewTCPPortHalfOpen(name string, mustSucceed bool, port int, args ...TestArg
 			port:     strconv.Itoa(port),
 			timeout:  getTCPTimeout(args),
 		},
-	}
+	}, nil
 }
 
 // NewTCPPortOpen creates a new Test for tcp port open with the given parameters.
@@ -44,7 +60,12 @@ func NewTCPPortHalfOpen(name string, mustSucceed bool, port int, args ...TestArg
 //
 // These TestArg will be evaluated:
 // "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
-func NewTCPPortOpen(name string, mustSucceed bool, port int, args ...TestArg) Test {
+func NewTCPPortOpen(name string, mustSucceed bool, port int, args ...TestArg) (Test, error) {
+	args, err := TCPArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTCPPortOpen: %w", err)
+	}
+
 	return Test{
 		Name:        name,
 		MustSucceed: mustSucceed,
@@ -53,11 +74,88 @@ func NewTCPPortOpen(name string, mustSucceed bool, port int, args ...TestArg) Te
 			port:     strconv.Itoa(port),
 			timeout:  getTCPTimeout(args),
 		},
+	}, nil
+}
+
+// NewTCPBannerTest creates a new Test which connects to port, optionally sends a probe, then reads
+// up to read_bytes and matches exp against what was read. Useful for checking SMTP greetings or a
+// Redis PING/PONG.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// exp: See connections.ParseExpect for the format. An empty exp passes if anything is read.
+//
+// These TestArg will be evaluated:
+// "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
+// "probe": (string, []byte) Payload to send before reading. "PING\r\n"
+// "read_bytes": int. Max number of bytes to read. Default is 1024, max of 65536.
+// "quiet": bool. If true, what was read will not be printed to Buffers.Logs.
+func NewTCPBannerTest(name string, mustSucceed bool, port int, exp string, args ...TestArg) (Test, error) {
+	args, err := TCPBannerArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTCPBannerTest: %w", err)
+	}
+
+	if err := connections.ValidateExpect(exp); err != nil {
+		return Test{}, fmt.Errorf("tests.NewTCPBannerTest: %w", err)
+	}
+
+	readBytes, err := getReadBytes(args, TCPDefaultReadBytes)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTCPBannerTest: %w", err)
 	}
+
+	return Test{
+		Name:        name,
+		MustSucceed: mustSucceed,
+		Tester: &TCPTest{
+			testType:  "banner",
+			port:      strconv.Itoa(port),
+			timeout:   getTCPTimeout(args),
+			probe:     getTCPProbe(args),
+			readBytes: readBytes,
+			exp:       exp,
+		},
+	}, nil
 }
 
 func getTCPTimeout(args []TestArg) time.Duration { return GetTimeout(args, TCPDefaultTimeout) }
 
+func getTCPProbe(args []TestArg) []byte { return GetArg[[]byte](args, "probe", nil) }
+
+// getReadBytes returns the "read_bytes" TestArg or defaultBytes if it is not set. Used by the TCP
+// and UDP tests.
+func getReadBytes(args []TestArg, defaultBytes int) (int, error) {
+	v := GetArg(args, "read_bytes", 0)
+	if v == 0 {
+		return defaultBytes, nil
+	}
+
+	if v < 0 || v > TCPMaxReadBytes {
+		return 0, fmt.Errorf("read_bytes must be between 1 and %d", TCPMaxReadBytes)
+	}
+
+	return v, nil
+}
+
+// Config returns the registered type of the TCPTest and the args needed to build it again.
+func (t TCPTest) Config() (string, []TestArg) {
+	port, _ := strconv.Atoi(t.port)
+	args := []TestArg{{Key: "port", Value: port}, {Key: "timeout", Value: t.timeout.String()}}
+	switch t.testType {
+	case "port_half_open":
+		return "tcp_half_open", args
+	case "banner":
+		args = append(args, TestArg{Key: "exp", Value: t.exp}, TestArg{Key: "read_bytes", Value: t.readBytes})
+		if len(t.probe) > 0 {
+			args = append(args, TestArg{Key: "probe", Value: string(t.probe)})
+		}
+
+		return "tcp_banner", args
+	default:
+		return "tcp_open", args
+	}
+}
+
 // Run evaluates TCPTest.testType and runs the appropriate test, passing along server and args.
 func (t TCPTest) Run(server connections.Server, args ...TestArg) error {
 	switch t.testType {
@@ -65,6 +163,8 @@ func (t TCPTest) Run(server connections.Server, args ...TestArg) error {
 		return PortHalfOpen(t, server, args...)
 	case "port_open":
 		return PortOpen(t, server, args...)
+	case "banner":
+		return Banner(t, server, args...)
 	default:
 		return ErrInvalidTestType
 	}
@@ -99,3 +199,77 @@ func PortOpen(t TCPTest, server connections.Server, args ...TestArg) error {
 
 	return conn.Close()
 }
+
+// Banner connects to the server, sends TCPTest.probe if set, and reads until TCPTest.exp matches,
+// TCPTest.readBytes have been read, the server closes the connection, or the timeout is reached.
+// Returns ErrTestFailed if what was read does not match.
+func Banner(t TCPTest, server connections.Server, args ...TestArg) error {
+	expect, err := connections.ParseExpect(t.exp)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout(
+		"tcp",
+		net.JoinHostPort(server.GetHostAddr(), t.port),
+		t.timeout,
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	eventTime := time.Now()
+	if err := conn.SetDeadline(eventTime.Add(t.timeout)); err != nil {
+		return err
+	}
+
+	if len(t.probe) > 0 {
+		if _, err := conn.Write(t.probe); err != nil {
+			return err
+		}
+	}
+
+	data, err := readUntil(conn, t.readBytes, func(data []byte) bool {
+		return len(data) > 0 && connections.MatchExpect(expect, data)
+	})
+
+	if !BeQuiet(args) {
+		server.Buffers.Log(eventTime, fmt.Sprintf("tcp/%s: %q", t.port, data))
+	}
+
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+
+	if len(data) == 0 || !connections.MatchExpect(expect, data) {
+		server.Buffers.Log(eventTime, fmt.Sprintf("TCPTest.Banner: read did not match '%s'", t.exp))
+		return ErrTestFailed
+	}
+
+	return nil
+}
+
+// readUntil reads from r until done returns true, max bytes have been read, or r returns an error.
+// io.EOF is not returned as an error.
+func readUntil(r io.Reader, max int, done func(data []byte) bool) ([]byte, error) {
+	data := make([]byte, 0, max)
+	buf := make([]byte, max)
+	for len(data) < max {
+		n, err := r.Read(buf[:max-len(data)])
+		data = append(data, buf[:n]...)
+		if n > 0 && done(data) {
+			return data, nil
+		}
+
+		if err == io.EOF {
+			return data, nil
+		}
+
+		if err != nil {
+			return data, err
+		}
+	}
+
+	return data, nil
+}
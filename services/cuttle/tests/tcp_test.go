@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"bufio"
+	"bytes"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
 	"github.com/stretchr/testify/require"
 )
 
@@ -11,7 +15,8 @@ func TestTCPNewTCPPortHalfOpen(t *testing.T) {
 	require := require.New(t)
 
 	t.Run("default timeout", func(t *testing.T) {
-		test := NewTCPPortHalfOpen("TCP Test", true, 22)
+		test, err := NewTCPPortHalfOpen("TCP Test", true, 22)
+		require.NoError(err, "NewTCPPortHalfOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -24,7 +29,8 @@ func TestTCPNewTCPPortHalfOpen(t *testing.T) {
 	})
 
 	t.Run("int timeout", func(t *testing.T) {
-		test := NewTCPPortHalfOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: 4})
+		test, err := NewTCPPortHalfOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: 4})
+		require.NoError(err, "NewTCPPortHalfOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -38,7 +44,8 @@ func TestTCPNewTCPPortHalfOpen(t *testing.T) {
 
 	t.Run("time.Duration timeout", func(t *testing.T) {
 		timeout := time.Second * 4
-		test := NewTCPPortHalfOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: timeout})
+		test, err := NewTCPPortHalfOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: timeout})
+		require.NoError(err, "NewTCPPortHalfOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -55,7 +62,8 @@ func TestTCPNewTCPPortOpen(t *testing.T) {
 	require := require.New(t)
 
 	t.Run("default timeout", func(t *testing.T) {
-		test := NewTCPPortOpen("TCP Test", true, 22)
+		test, err := NewTCPPortOpen("TCP Test", true, 22)
+		require.NoError(err, "NewTCPPortOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -68,7 +76,8 @@ func TestTCPNewTCPPortOpen(t *testing.T) {
 	})
 
 	t.Run("int timeout", func(t *testing.T) {
-		test := NewTCPPortOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: 4})
+		test, err := NewTCPPortOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: 4})
+		require.NoError(err, "NewTCPPortOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -82,7 +91,8 @@ func TestTCPNewTCPPortOpen(t *testing.T) {
 
 	t.Run("time.Duration timeout", func(t *testing.T) {
 		timeout := time.Second * 4
-		test := NewTCPPortOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: timeout})
+		test, err := NewTCPPortOpen("TCP Test", true, 22, TestArg{Key: "timeout", Value: timeout})
+		require.NoError(err, "NewTCPPortOpen() returned an error: %s", err)
 		require.Equal("TCP Test", test.Name, "NewTCPTest() Name is not 'TCP Test'")
 		require.True(test.MustSucceed, "NewTCPTest() MustSucceed is not true")
 		require.Equal(
@@ -197,3 +207,116 @@ func TestTCPPortOpen(t *testing.T) {
 		require.Error(err, "PortOpen() did not return an error")
 	})
 }
+
+// testTCPListener starts a TCP server on 127.0.0.1 which sends greeting, then answers "PING\r\n"
+// with "+PONG\r\n". Returns the port.
+func testTCPListener(t *testing.T, greeting string) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "net.Listen() returned an error: %s", err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte(greeting))
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err == nil && line == "PING\r\n" {
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func testLocalServer(t *testing.T) connections.Server {
+	server, err := connections.NewServer("127.0.0.1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(t, err, "connections.NewServer() returned an error: %s", err)
+	return server
+}
+
+func TestTCPNewTCPBannerTest(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		test, err := NewTCPBannerTest("TCP Test", true, 25, "^220 ")
+		require.NoError(err, "NewTCPBannerTest() returned an error: %s", err)
+		tt := test.Tester.(*TCPTest)
+		require.Equal("banner", tt.testType, "NewTCPBannerTest() testType is not 'banner'")
+		require.Equal("25", tt.port, "NewTCPBannerTest() port is not '25'")
+		require.Equal(TCPDefaultReadBytes, tt.readBytes, "NewTCPBannerTest() readBytes is not the default")
+		require.Nil(tt.probe, "NewTCPBannerTest() probe was set")
+	})
+
+	t.Run("probe", func(t *testing.T) {
+		test, err := NewTCPBannerTest("TCP Test", true, 6379, "contains:+PONG",
+			TestArg{Key: "probe", Value: "PING\r\n"},
+			TestArg{Key: "read_bytes", Value: 16},
+		)
+		require.NoError(err, "NewTCPBannerTest() returned an error: %s", err)
+		require.Equal([]byte("PING\r\n"), test.Tester.(*TCPTest).probe, "NewTCPBannerTest() probe did not match")
+		require.Equal(16, test.Tester.(*TCPTest).readBytes, "NewTCPBannerTest() readBytes did not match")
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		_, err := NewTCPBannerTest("TCP Test", true, 25, "regex:(")
+		require.ErrorIs(err, connections.ErrInvalidExpect, "NewTCPBannerTest() did not return ErrInvalidExpect")
+	})
+
+	t.Run("read_bytes too large", func(t *testing.T) {
+		_, err := NewTCPBannerTest("TCP Test", true, 25, "", TestArg{Key: "read_bytes", Value: TCPMaxReadBytes + 1})
+		require.Error(err, "NewTCPBannerTest() did not return an error")
+	})
+}
+
+func TestTCPBanner(t *testing.T) {
+	require := require.New(t)
+	server := testLocalServer(t)
+	smtp := testTCPListener(t, "220 mail.cuttle.test ESMTP ready\r\n")
+	redis := testTCPListener(t, "")
+	timeout := TestArg{Key: "timeout", Value: time.Millisecond * 200}
+
+	run := func(port int, exp string, args ...TestArg) error {
+		test, err := NewTCPBannerTest("TCP Test", true, port, exp, append(args, timeout)...)
+		require.NoError(err, "NewTCPBannerTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		return test.Run(server)
+	}
+
+	t.Run("greeting", func(t *testing.T) {
+		require.NoError(run(smtp, "^220 .*ESMTP"), "TCPTest.Run() returned an error")
+		require.Contains(server.Logs.String(), "220 mail.cuttle.test ESMTP ready", "banner was not logged")
+	})
+
+	t.Run("greeting mismatch", func(t *testing.T) {
+		require.ErrorIs(run(smtp, "^554 "), ErrTestFailed, "TCPTest.Run() did not return ErrTestFailed")
+	})
+
+	t.Run("read_bytes", func(t *testing.T) {
+		require.NoError(run(smtp, "line:220", TestArg{Key: "read_bytes", Value: 3}), "TCPTest.Run() returned an error")
+		require.NotContains(server.Logs.String(), "mail", "more than read_bytes was read")
+	})
+
+	t.Run("probe", func(t *testing.T) {
+		require.NoError(run(redis, "contains:+PONG", TestArg{Key: "probe", Value: "PING\r\n"}))
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		require.ErrorIs(run(redis, ""), ErrTestFailed, "TCPTest.Run() did not return ErrTestFailed")
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		test, err := NewTCPBannerTest("TCP Test", true, smtp, "^220", timeout)
+		require.NoError(err, "NewTCPBannerTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		require.NoError(test.Run(server, Quiet()))
+		require.Empty(server.Logs.String(), "banner was logged")
+	})
+}
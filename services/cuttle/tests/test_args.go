@@ -30,37 +30,26 @@ func Quiet() TestArg {
 }
 
 // BeQuiet returns true if the "quiet" argument is set to true.
-func BeQuiet(args []TestArg) bool {
-	v := FindArg(args, "quiet")
-	if v == nil {
-		return false
-	}
-
-	return v.(bool)
-}
+func BeQuiet(args []TestArg) bool { return GetArg(args, "quiet", false) }
 
+// GetTimeout returns the "timeout" TestArg as a time.Duration. int/int64 values are converted into
+// time.Second * int. Returns defaultTimeout if it is not set, 0, or not a duration.
 func GetTimeout(args []TestArg, defaultTimeout time.Duration) time.Duration {
-	v := FindArg(args, "timeout")
-	if v == nil {
+	d, ok, err := toDuration(FindArg(args, "timeout"), time.Second)
+	if !ok || err != nil || d == 0 {
 		return defaultTimeout
 	}
 
-	switch any(v).(type) {
-	case int:
-		if v.(int) == 0 {
-			return defaultTimeout
-		}
-
-		return time.Second * time.Duration(v.(int))
-	case int64:
-		if v.(int64) == 0 {
-			return defaultTimeout
-		}
+	return d
+}
 
-		return time.Second * time.Duration(v.(int64))
-	case time.Duration:
-		return v.(time.Duration)
-	default:
-		return defaultTimeout
+// GetMilliseconds returns the value of key as a time.Duration. int/int64 values are converted into
+// time.Millisecond * int. Returns 0 if key is not set.
+func GetMilliseconds(args []TestArg, key string) time.Duration {
+	d, ok, err := toDuration(FindArg(args, key), time.Millisecond)
+	if !ok || err != nil {
+		return 0
 	}
+
+	return d
 }
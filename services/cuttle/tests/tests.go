@@ -11,6 +11,8 @@ var ErrTestFailed = fmt.Errorf("failed")
 type Test struct {
 	Name        string
 	MustSucceed bool
+	Retry       Retry // Retry settings used by RunWithRetry. The zero value runs the test once.
+	Flow        Flow  // When the test runs inside a Tile and what it captures.
 	Tester
 }
 
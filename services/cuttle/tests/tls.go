@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+const (
+	TLSDefaultPort    = 443
+	TLSDefaultTimeout = time.Second * 5
+	TLSDefaultMinDays = 14
+)
+
+var ErrInvalidCABundle = fmt.Errorf("invalid ca bundle")
+
+// TLSCertTest is a struct that holds the parameters for a TLS certificate test.
+type TLSCertTest struct {
+	port           string
+	sni            string         // ServerName to send. Empty uses the server's hostname.
+	minDays        int            // Fail if the certificate expires in less than minDays.
+	roots          *x509.CertPool // CA bundle to verify the chain with. nil uses the system roots.
+	caBundle       string         // The ca_bundle arg roots was loaded from. Kept so the test can be saved.
+	verifyChain    bool
+	verifyHostname bool
+	timeout        time.Duration
+}
+
+// TLSCertInfo is the certificate information TLSCertTest reports.
+type TLSCertInfo struct {
+	Subject  string
+	SANs     []string
+	Issuer   string
+	NotAfter time.Time
+	DaysLeft int
+}
+
+// NewTLSCertTest creates a new TLS certificate test with the given parameters.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// port: The port to connect to. Defaults to 443 if 0.
+//
+// These TestArg will be evaluated:
+// "sni": string. The server name to send and match the certificate against. Default is the server's hostname.
+// "min_days": int. Fail if the certificate expires in less days than min_days. Default is 14.
+// "ca_bundle": (string, []byte) Path to a PEM file or the PEM data of the CAs to verify the chain
+//
+//	with. Strings starting with "-----BEGIN" are treated as PEM data. Default is the system roots.
+//
+// "verify_chain": bool. If false, the chain is not verified. Default is true.
+// "verify_hostname": bool. If false, the hostname is not matched. Default is true.
+// "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
+// "quiet": bool. If true, the certificate details will not be printed to Buffers.Logs.
+func NewTLSCertTest(name string, mustSucceed bool, port int, args ...TestArg) (Test, error) {
+	args, err := TLSCertArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTLSCertTest: %w", err)
+	}
+
+	if port == 0 {
+		port = TLSDefaultPort
+	}
+
+	if port < 1 || port > 65535 {
+		return Test{}, fmt.Errorf("tests.NewTLSCertTest: port out of range: %d", port)
+	}
+
+	roots, err := getTLSRoots(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewTLSCertTest: %w", err)
+	}
+
+	return Test{
+		Name:        name,
+		MustSucceed: mustSucceed,
+		Tester: &TLSCertTest{
+			port:           strconv.Itoa(port),
+			sni:            getTLSSNI(args),
+			minDays:        getTLSMinDays(args),
+			roots:          roots,
+			caBundle:       getTLSCABundle(args),
+			verifyChain:    getTLSBool(args, "verify_chain"),
+			verifyHostname: getTLSBool(args, "verify_hostname"),
+			timeout:        getTLSTimeout(args),
+		},
+	}, nil
+}
+
+func getTLSSNI(args []TestArg) string { return strings.TrimSpace(GetArg(args, "sni", "")) }
+
+func getTLSMinDays(args []TestArg) int { return GetArg(args, "min_days", TLSDefaultMinDays) }
+
+// getTLSBool returns the bool value of key. Defaults to true.
+func getTLSBool(args []TestArg, key string) bool { return GetArg(args, key, true) }
+
+// getTLSCABundle returns the ca_bundle arg as a string. PEM data is kept as is.
+func getTLSCABundle(args []TestArg) string {
+	switch v := FindArg(args, "ca_bundle").(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return ""
+	}
+}
+
+func getTLSRoots(args []TestArg) (*x509.CertPool, error) {
+	var data []byte
+	switch v := FindArg(args, "ca_bundle").(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		data = v
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(v), "-----BEGIN") {
+			data = []byte(v)
+			break
+		}
+
+		var err error
+		data, err = os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCABundle, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %T", ErrInvalidCABundle, v)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no certificates found", ErrInvalidCABundle)
+	}
+
+	return roots, nil
+}
+
+func getTLSTimeout(args []TestArg) time.Duration { return GetTimeout(args, TLSDefaultTimeout) }
+
+// NewTLSCertInfo pulls the details TLSCertTest reports out of cert.
+func NewTLSCertInfo(cert *x509.Certificate) TLSCertInfo {
+	info := TLSCertInfo{
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		NotAfter: cert.NotAfter,
+		DaysLeft: int(time.Until(cert.NotAfter).Hours() / 24),
+	}
+
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	return info
+}
+
+// String returns the certificate details as they are written to the logs.
+func (i TLSCertInfo) String() string {
+	return fmt.Sprintf("subject=%s sans=[%s] issuer=%s not_after=%s days_left=%d",
+		i.Subject, strings.Join(i.SANs, ", "), i.Issuer, i.NotAfter.Format(time.RFC3339), i.DaysLeft)
+}
+
+// Config returns "tls_cert" and the args needed to build the TLSCertTest again.
+func (t TLSCertTest) Config() (string, []TestArg) {
+	port, _ := strconv.Atoi(t.port)
+	args := []TestArg{
+		{Key: "port", Value: port},
+		{Key: "min_days", Value: t.minDays},
+		{Key: "verify_chain", Value: t.verifyChain},
+		{Key: "verify_hostname", Value: t.verifyHostname},
+		{Key: "timeout", Value: t.timeout.String()},
+	}
+
+	if t.sni != "" {
+		args = append(args, TestArg{Key: "sni", Value: t.sni})
+	}
+
+	if t.caBundle != "" {
+		args = append(args, TestArg{Key: "ca_bundle", Value: t.caBundle})
+	}
+
+	return "tls_cert", args
+}
+
+// Run connects to the server and checks the certificate it presents. Returns ErrTestFailed if the
+// certificate expires within minDays, the chain does not verify, or the hostname does not match.
+func (t TLSCertTest) Run(server connections.Server, args ...TestArg) error {
+	name := t.sni
+	if name == "" {
+		name = server.Hostname
+	}
+
+	eventTime := time.Now()
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: t.timeout},
+		// Verification is done below so we can report on the certificate even when it is bad.
+		Config: &tls.Config{ServerName: name, InsecureSkipVerify: true},
+	}
+
+	conn, err := dialer.Dial("tcp", net.JoinHostPort(server.GetHostAddr(), t.port))
+	if err != nil {
+		server.Buffers.Log(eventTime, fmt.Sprintf("TLSCertTest.Run: %s", err))
+		return err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		server.Buffers.Log(eventTime, "TLSCertTest.Run: no certificate presented")
+		return ErrTestFailed
+	}
+
+	leaf := certs[0]
+	info := NewTLSCertInfo(leaf)
+	if !BeQuiet(args) {
+		server.Buffers.Log(eventTime, info.String())
+	}
+
+	failed := false
+	if info.DaysLeft < t.minDays {
+		server.Buffers.Log(eventTime, fmt.Sprintf("TLSCertTest.Run: certificate expires in %d days, less than %d", info.DaysLeft, t.minDays))
+		failed = true
+	}
+
+	if t.verifyChain {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+
+		_, err := leaf.Verify(x509.VerifyOptions{Roots: t.roots, Intermediates: intermediates})
+		if err != nil {
+			server.Buffers.Log(eventTime, fmt.Sprintf("TLSCertTest.Run: chain did not verify: %s", err))
+			failed = true
+		}
+	}
+
+	if t.verifyHostname {
+		if err := leaf.VerifyHostname(name); err != nil {
+			server.Buffers.Log(eventTime, fmt.Sprintf("TLSCertTest.Run: %s", err))
+			failed = true
+		}
+	}
+
+	if failed {
+		return ErrTestFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func testNewCA(t *testing.T) testCA {
+	require := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err, "ecdsa.GenerateKey() returned an error: %s", err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Cuttle Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(err, "x509.CreateCertificate() returned an error: %s", err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(err, "x509.ParseCertificate() returned an error: %s", err)
+
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// testTLSServer starts a TLS listener on 127.0.0.1 with a leaf certificate signed by ca and returns
+// the port.
+func testTLSServer(t *testing.T, ca testCA, notAfter time.Time, dnsNames ...string) int {
+	require := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err, "ecdsa.GenerateKey() returned an error: %s", err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(err, "x509.CreateCertificate() returned an error: %s", err)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	require.NoError(err, "tls.Listen() returned an error: %s", err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestTLSNewTLSCertTest(t *testing.T) {
+	require := require.New(t)
+	ca := testNewCA(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		test, err := NewTLSCertTest("TLS Test", true, 0)
+		require.NoError(err, "NewTLSCertTest() returned an error: %s", err)
+		tt := test.Tester.(*TLSCertTest)
+		require.Equal("443", tt.port, "NewTLSCertTest() port was not the default")
+		require.Equal(TLSDefaultMinDays, tt.minDays, "NewTLSCertTest() minDays was not the default")
+		require.Nil(tt.roots, "NewTLSCertTest() roots was set")
+		require.True(tt.verifyChain, "NewTLSCertTest() verifyChain was not true")
+		require.True(tt.verifyHostname, "NewTLSCertTest() verifyHostname was not true")
+	})
+
+	t.Run("bad port", func(t *testing.T) {
+		_, err := NewTLSCertTest("TLS Test", true, 70000)
+		require.Error(err, "NewTLSCertTest() did not return an error")
+	})
+
+	t.Run("ca bundle file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(os.WriteFile(path, ca.pem, 0600))
+		test, err := NewTLSCertTest("TLS Test", true, 443, TestArg{Key: "ca_bundle", Value: path})
+		require.NoError(err, "NewTLSCertTest() returned an error: %s", err)
+		require.NotNil(test.Tester.(*TLSCertTest).roots, "NewTLSCertTest() roots was not set")
+	})
+
+	t.Run("ca bundle missing file", func(t *testing.T) {
+		_, err := NewTLSCertTest("TLS Test", true, 443, TestArg{Key: "ca_bundle", Value: "/does/not/exist.pem"})
+		require.ErrorIs(err, ErrInvalidCABundle, "NewTLSCertTest() did not return ErrInvalidCABundle")
+	})
+
+	t.Run("ca bundle not pem", func(t *testing.T) {
+		_, err := NewTLSCertTest("TLS Test", true, 443, TestArg{Key: "ca_bundle", Value: []byte("nope")})
+		require.ErrorIs(err, ErrInvalidCABundle, "NewTLSCertTest() did not return ErrInvalidCABundle")
+	})
+}
+
+func TestTLSCertTestRun(t *testing.T) {
+	require := require.New(t)
+	ca := testNewCA(t)
+	good := testTLSServer(t, ca, time.Now().Add(90*24*time.Hour), "svc.cuttle.test")
+	expiring := testTLSServer(t, ca, time.Now().Add(5*24*time.Hour), "svc.cuttle.test")
+
+	server, err := connections.NewServer("127.0.0.1", 0, &bytes.Buffer{}, &bytes.Buffer{})
+	require.NoError(err, "connections.NewServer() returned an error: %s", err)
+
+	bundle := TestArg{Key: "ca_bundle", Value: ca.pem}
+	sni := TestArg{Key: "sni", Value: "svc.cuttle.test"}
+	run := func(port int, args ...TestArg) error {
+		test, err := NewTLSCertTest("TLS Test", true, port, args...)
+		require.NoError(err, "NewTLSCertTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		return test.Run(server)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(run(good, bundle, sni), "TLSCertTest.Run() returned an error")
+		logs := server.Logs.String()
+		require.Contains(logs, "subject=CN=svc.cuttle.test", "subject was not logged")
+		require.Contains(logs, "sans=[svc.cuttle.test, 127.0.0.1]", "SANs were not logged")
+		require.Contains(logs, "issuer=CN=Cuttle Test CA", "issuer was not logged")
+		require.Contains(logs, "days_left=89", "days left was not logged")
+	})
+
+	t.Run("ip hostname", func(t *testing.T) {
+		require.NoError(run(good, bundle), "TLSCertTest.Run() returned an error")
+	})
+
+	t.Run("expiring", func(t *testing.T) {
+		require.ErrorIs(run(expiring, bundle, sni), ErrTestFailed)
+		require.Contains(server.Logs.String(), "expires in 4 days", "expiry failure was not logged")
+		require.NoError(run(expiring, bundle, sni, TestArg{Key: "min_days", Value: 3}))
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		require.ErrorIs(run(good, sni, TestArg{Key: "ca_bundle", Value: testNewCA(t).pem}), ErrTestFailed)
+		require.Contains(server.Logs.String(), "chain did not verify", "chain failure was not logged")
+		require.NoError(run(good, sni, TestArg{Key: "verify_chain", Value: false}))
+	})
+
+	t.Run("hostname mismatch", func(t *testing.T) {
+		other := TestArg{Key: "sni", Value: "other.cuttle.test"}
+		require.ErrorIs(run(good, bundle, other), ErrTestFailed)
+		require.Contains(server.Logs.String(), "other.cuttle.test", "hostname failure was not logged")
+		require.NoError(run(good, bundle, other, TestArg{Key: "verify_hostname", Value: false}))
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		test, err := NewTLSCertTest("TLS Test", true, good, bundle, sni)
+		require.NoError(err, "NewTLSCertTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		require.NoError(test.Run(server, Quiet()))
+		require.Empty(server.Logs.String(), "certificate was logged")
+	})
+
+	t.Run("closed port", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(err, "net.Listen() returned an error: %s", err)
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		require.Error(run(port, bundle), "TLSCertTest.Run() did not return an error")
+	})
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/services/cuttle/connections"
+)
+
+const (
+	UDPDefaultTimeout   = time.Second * 3
+	UDPDefaultReadBytes = 1500
+)
+
+// UDPTest is a struct that holds the parameters for UDP probe tests.
+type UDPTest struct {
+	port      string
+	probe     []byte // Payload sent to the port. UDP needs something to respond to.
+	readBytes int    // Max size of the response datagram to read.
+	exp       string // Expect string to match against the response.
+	timeout   time.Duration
+}
+
+// NewUDPProbeTest creates a new Test which sends probe to port and waits for a response. Useful for
+// checking DNS or other listeners which answer a request. UDP cannot tell an open port from a
+// dropped packet, so a response is required to pass.
+// name: The name of the test.
+// mustSucceed: If false, the Tile will continue with the test stack if this test fails.
+// probe: The payload to send. Cannot be empty.
+// exp: See connections.ParseExpect for the format. An empty exp passes on any response.
+//
+// These TestArg will be evaluated:
+// "timeout": (int, int64, time.Duration) int/int64 will be converted into time.Second * int.
+// "read_bytes": int. Max size of the response to read. Default is 1500, max of 65536.
+// "quiet": bool. If true, the response will not be printed to Buffers.Logs.
+func NewUDPProbeTest(name string, mustSucceed bool, port int, probe []byte, exp string, args ...TestArg) (Test, error) {
+	args, err := UDPArgs.Parse(args)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewUDPProbeTest: %w", err)
+	}
+
+	if len(probe) == 0 {
+		return Test{}, fmt.Errorf("tests.NewUDPProbeTest: probe cannot be empty")
+	}
+
+	if err := connections.ValidateExpect(exp); err != nil {
+		return Test{}, fmt.Errorf("tests.NewUDPProbeTest: %w", err)
+	}
+
+	readBytes, err := getReadBytes(args, UDPDefaultReadBytes)
+	if err != nil {
+		return Test{}, fmt.Errorf("tests.NewUDPProbeTest: %w", err)
+	}
+
+	return Test{
+		Name:        name,
+		MustSucceed: mustSucceed,
+		Tester: &UDPTest{
+			port:      strconv.Itoa(port),
+			probe:     probe,
+			readBytes: readBytes,
+			exp:       exp,
+			timeout:   GetTimeout(args, UDPDefaultTimeout),
+		},
+	}, nil
+}
+
+// Config returns "udp_probe" and the args needed to build the UDPTest again.
+func (t UDPTest) Config() (string, []TestArg) {
+	port, _ := strconv.Atoi(t.port)
+	return "udp_probe", []TestArg{
+		{Key: "port", Value: port},
+		{Key: "probe", Value: string(t.probe)},
+		{Key: "exp", Value: t.exp},
+		{Key: "read_bytes", Value: t.readBytes},
+		{Key: "timeout", Value: t.timeout.String()},
+	}
+}
+
+// Run sends UDPTest.probe to the server and matches the first response against UDPTest.exp.
+// Returns ErrTestFailed if there is no response before the timeout or it does not match.
+func (t UDPTest) Run(server connections.Server, args ...TestArg) error {
+	expect, err := connections.ParseExpect(t.exp)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(server.GetHostAddr(), t.port), t.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	eventTime := time.Now()
+	if err := conn.SetDeadline(eventTime.Add(t.timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(t.probe); err != nil {
+		return err
+	}
+
+	buf := make([]byte, t.readBytes)
+	n, err := conn.Read(buf)
+	if err != nil {
+		// A timeout means nothing answered. A refused connection means we got an ICMP port
+		// unreachable back. Either way the port did not respond like we need it to.
+		var opErr *net.OpError
+		if errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &opErr) {
+			server.Buffers.Log(eventTime, fmt.Sprintf("UDPTest.Run: no response from udp/%s: %s", t.port, err))
+			return ErrTestFailed
+		}
+
+		return err
+	}
+
+	if !BeQuiet(args) {
+		server.Buffers.Log(eventTime, fmt.Sprintf("udp/%s: %q", t.port, buf[:n]))
+	}
+
+	if !connections.MatchExpect(expect, buf[:n]) {
+		server.Buffers.Log(eventTime, fmt.Sprintf("UDPTest.Run: response did not match '%s'", t.exp))
+		return ErrTestFailed
+	}
+
+	return nil
+}
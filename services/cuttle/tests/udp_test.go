@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testUDPListener starts a UDP server on 127.0.0.1 which answers every datagram with reply.
+// Returns the port.
+func testUDPListener(t *testing.T, reply string) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "net.ListenPacket() returned an error: %s", err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			conn.WriteTo(append([]byte(reply), bytes.ToUpper(buf[:n])...), addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestUDPNewUDPProbeTest(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		test, err := NewUDPProbeTest("UDP Test", true, 514, []byte("ping"), "")
+		require.NoError(err, "NewUDPProbeTest() returned an error: %s", err)
+		ut := test.Tester.(*UDPTest)
+		require.Equal("514", ut.port, "NewUDPProbeTest() port is not '514'")
+		require.Equal(UDPDefaultReadBytes, ut.readBytes, "NewUDPProbeTest() readBytes is not the default")
+		require.Equal(UDPDefaultTimeout, ut.timeout, "NewUDPProbeTest() timeout is not the default")
+	})
+
+	t.Run("empty probe", func(t *testing.T) {
+		_, err := NewUDPProbeTest("UDP Test", true, 514, nil, "")
+		require.Error(err, "NewUDPProbeTest() did not return an error")
+	})
+
+	t.Run("invalid exp", func(t *testing.T) {
+		_, err := NewUDPProbeTest("UDP Test", true, 514, []byte("ping"), "regex:(")
+		require.Error(err, "NewUDPProbeTest() did not return an error")
+	})
+}
+
+func TestUDPTestRun(t *testing.T) {
+	require := require.New(t)
+	server := testLocalServer(t)
+	port := testUDPListener(t, "ack:")
+	timeout := TestArg{Key: "timeout", Value: time.Millisecond * 200}
+
+	run := func(port int, exp string, args ...TestArg) error {
+		test, err := NewUDPProbeTest("UDP Test", true, port, []byte("hello"), exp, append(args, timeout)...)
+		require.NoError(err, "NewUDPProbeTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		return test.Run(server)
+	}
+
+	t.Run("response", func(t *testing.T) {
+		require.NoError(run(port, "^ack:HELLO$"), "UDPTest.Run() returned an error")
+		require.Contains(server.Logs.String(), "ack:HELLO", "response was not logged")
+	})
+
+	t.Run("any response", func(t *testing.T) {
+		require.NoError(run(port, ""), "UDPTest.Run() returned an error")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		require.ErrorIs(run(port, "contains:nak"), ErrTestFailed, "UDPTest.Run() did not return ErrTestFailed")
+	})
+
+	t.Run("no listener", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(err, "net.ListenPacket() returned an error: %s", err)
+		closed := conn.LocalAddr().(*net.UDPAddr).Port
+		conn.Close()
+
+		require.ErrorIs(run(closed, ""), ErrTestFailed, "UDPTest.Run() did not return ErrTestFailed")
+		require.Contains(server.Logs.String(), "no response", "missing response was not logged")
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		test, err := NewUDPProbeTest("UDP Test", true, port, []byte("hello"), "", timeout)
+		require.NoError(err, "NewUDPProbeTest() returned an error: %s", err)
+		server.Buffers.Clear()
+		require.NoError(test.Run(server, Quiet()))
+		require.Empty(server.Logs.String(), "response was logged")
+	})
+}
@@ -0,0 +1,116 @@
+package history
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What started a run.
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+)
+
+var ErrInvalidRun = fmt.Errorf("invalid run")
+
+// Run is a single execution of a Tile against a Group, started by a user or a schedule.
+type Run struct {
+	ID         int64         `json:"id"`
+	Profile    string        `json:"profile"`
+	Tile       string        `json:"tile"`
+	Group      string        `json:"group"`
+	Trigger    string        `json:"trigger"`               // TriggerManual or TriggerSchedule.
+	User       string        `json:"user,omitempty"`        // Username for manual runs.
+	ScheduleID int64         `json:"schedule_id,omitempty"` // Schedule for scheduled runs.
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	Passed     bool          `json:"passed"`
+	Summary    string        `json:"summary"` // Test counts for each server. "host1: 2 pass; host2: 1 pass, 1 fail"
+	Err        string        `json:"error,omitempty"`
+	Skipped    []string      `json:"skipped,omitempty"`  // Servers skipped because they are in maintenance.
+	Silenced   bool          `json:"silenced,omitempty"` // Every server was skipped. No alerts are sent.
+}
+
+// Validate checks that the Run has the fields every record needs.
+func (r Run) Validate() error {
+	if r.Profile == "" || r.Tile == "" || r.Group == "" {
+		return fmt.Errorf("history.Run.Validate: %w: profile, tile, and group are required", ErrInvalidRun)
+	}
+
+	switch r.Trigger {
+	case TriggerManual:
+	case TriggerSchedule:
+		if r.ScheduleID == 0 {
+			return fmt.Errorf("history.Run.Validate: %w: scheduled run has no schedule ID", ErrInvalidRun)
+		}
+	default:
+		return fmt.Errorf("history.Run.Validate: %w: unknown trigger: %s", ErrInvalidRun, r.Trigger)
+	}
+
+	return nil
+}
+
+// Filter selects runs from the history. Empty fields match everything.
+type Filter struct {
+	Profile    string
+	Tile       string
+	ScheduleID int64
+	Limit      int // 0 or less returns every match.
+}
+
+// Match returns true if the run matches the Filter. Limit is not checked.
+func (f Filter) Match(r Run) bool {
+	return (f.Profile == "" || f.Profile == r.Profile) &&
+		(f.Tile == "" || f.Tile == r.Tile) &&
+		(f.ScheduleID == 0 || f.ScheduleID == r.ScheduleID)
+}
+
+// Recorder stores the run history. db.SqliteDB is the Recorder used by the server.
+type Recorder interface {
+	RunRecord(run Run) (Run, error)
+	RunList(filter Filter) ([]Run, error)
+}
+
+// Log is an in memory Recorder. Runs are lost when the process exits.
+type Log struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+// NewLog creates an empty in memory history Log.
+func NewLog() *Log { return &Log{} }
+
+// RunRecord validates and stores the run. Returns the run with its ID set.
+func (l *Log) RunRecord(run Run) (Run, error) {
+	if err := run.Validate(); err != nil {
+		return run, fmt.Errorf("history.Log.RunRecord: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	run.ID = int64(len(l.runs) + 1)
+	l.runs = append(l.runs, run)
+	return run, nil
+}
+
+// RunList returns the runs which match filter, newest first.
+func (l *Log) RunList(filter Filter) ([]Run, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var runs []Run
+	for i := len(l.runs) - 1; i >= 0; i-- {
+		run := l.runs[i]
+		if !filter.Match(run) {
+			continue
+		}
+
+		runs = append(runs, run)
+		if filter.Limit > 0 && len(runs) == filter.Limit {
+			break
+		}
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryRunValidate(t *testing.T) {
+	require := require.New(t)
+	run := Run{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: TriggerManual}
+
+	require.NoError(run.Validate(), "Run.Validate() returned an error")
+	require.ErrorIs(Run{Tile: "Nginx", Group: "Prod", Trigger: TriggerManual}.Validate(), ErrInvalidRun, "profile was not checked")
+
+	run.Trigger = TriggerSchedule
+	require.ErrorIs(run.Validate(), ErrInvalidRun, "schedule ID was not checked")
+	run.ScheduleID = 1
+	require.NoError(run.Validate(), "Run.Validate() returned an error")
+
+	run.Trigger = "cron"
+	require.ErrorIs(run.Validate(), ErrInvalidRun, "trigger was not checked")
+}
+
+func TestHistoryLog(t *testing.T) {
+	require := require.New(t)
+	log := NewLog()
+
+	runs := []Run{
+		{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: TriggerManual, User: "admin"},
+		{Profile: "Web", Tile: "Nginx", Group: "Prod", Trigger: TriggerSchedule, ScheduleID: 1},
+		{Profile: "DB", Tile: "Postgres", Group: "Prod", Trigger: TriggerSchedule, ScheduleID: 2},
+	}
+
+	for _, run := range runs {
+		got, err := log.RunRecord(run)
+		require.NoError(err, "Log.RunRecord() returned an error: %s", err)
+		require.NotZero(got.ID, "ID was not set")
+	}
+
+	_, err := log.RunRecord(Run{})
+	require.ErrorIs(err, ErrInvalidRun, "Log.RunRecord() did not validate the run")
+
+	got, err := log.RunList(Filter{})
+	require.NoError(err, "Log.RunList() returned an error: %s", err)
+	require.Len(got, 3, "Log.RunList() did not return every run")
+	require.Equal("Postgres", got[0].Tile, "runs were not newest first")
+
+	got, _ = log.RunList(Filter{Profile: "Web"})
+	require.Len(got, 2, "profile filter did not match")
+
+	got, _ = log.RunList(Filter{ScheduleID: 1})
+	require.Len(got, 1, "schedule filter did not match")
+	require.Equal(TriggerSchedule, got[0].Trigger, "schedule filter returned the wrong run")
+
+	got, _ = log.RunList(Filter{Limit: 1})
+	require.Len(got, 1, "limit was not honored")
+}
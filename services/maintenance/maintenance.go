@@ -0,0 +1,193 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+)
+
+// What a Window covers.
+const (
+	KindServer = "server"
+	KindGroup  = "group"
+)
+
+var ErrInvalidWindow = fmt.Errorf("invalid maintenance window")
+
+// Window puts a server or a Group in maintenance from Start until End. Scheduled checks skip the
+// servers it covers and no alerts are sent for them. Manual runs warn before touching them.
+type Window struct {
+	ID      int64     `json:"id"`
+	Profile string    `json:"profile,omitempty"` // Empty applies to every Profile.
+	Kind    string    `json:"kind"`              // KindServer or KindGroup.
+	Target  string    `json:"target"`            // Server ID or Name, or the Group name.
+	Reason  string    `json:"reason,omitempty"`
+	User    string    `json:"user,omitempty"` // Username of who created the Window.
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// Validate checks that the Window has the fields every record needs.
+func (w Window) Validate() error {
+	if w.Kind != KindServer && w.Kind != KindGroup {
+		return fmt.Errorf("maintenance.Window.Validate: %w: unknown kind: %q", ErrInvalidWindow, w.Kind)
+	}
+
+	if w.Target == "" {
+		return fmt.Errorf("maintenance.Window.Validate: %w: target is required", ErrInvalidWindow)
+	}
+
+	if w.Start.IsZero() || !w.End.After(w.Start) {
+		return fmt.Errorf("maintenance.Window.Validate: %w: end must be after start", ErrInvalidWindow)
+	}
+
+	return nil
+}
+
+// Active returns true if t is in the Window.
+func (w Window) Active(t time.Time) bool { return !t.Before(w.Start) && t.Before(w.End) }
+
+// AppliesTo returns true if the Window covers the Profile.
+func (w Window) AppliesTo(profile string) bool { return w.Profile == "" || w.Profile == profile }
+
+// String describes the Window for run summaries and warnings. "maintenance 3 until 15:04 (patching)"
+func (w Window) String() string {
+	s := fmt.Sprintf("maintenance %d until %s", w.ID, w.End.Format(time.RFC3339))
+	if w.Reason != "" {
+		s += " (" + w.Reason + ")"
+	}
+
+	return s
+}
+
+// Filter selects Windows. Empty fields match everything.
+type Filter struct {
+	Profile  string    // Windows for this Profile and for every Profile.
+	ActiveAt time.Time // Windows active at this time.
+}
+
+// Match returns true if the Window matches the Filter.
+func (f Filter) Match(w Window) bool {
+	return (f.Profile == "" || w.AppliesTo(f.Profile)) && (f.ActiveAt.IsZero() || w.Active(f.ActiveAt))
+}
+
+// Store keeps the maintenance Windows. db.SqliteDB is the Store used by the server.
+type Store interface {
+	MaintenanceCreate(w Window) (Window, error)
+	MaintenanceList(filter Filter) ([]Window, error)
+	MaintenanceDelete(id int64) error
+	MaintenanceExpire(before time.Time) (int64, error)
+}
+
+// Active returns the Windows in store which cover the Profile now.
+func Active(store Store, profile string) ([]Window, error) {
+	windows, err := store.MaintenanceList(Filter{Profile: profile, ActiveAt: time.Now()})
+	if err != nil {
+		return nil, fmt.Errorf("maintenance.Active: %w", err)
+	}
+
+	return windows, nil
+}
+
+// Expire deletes the Windows which have ended every interval until ctx is done. logger may be nil.
+func Expire(ctx context.Context, store Store, interval time.Duration, logger *core.Logger) {
+	if logger == nil {
+		logger = core.NewLogger(io.Discard, "maintenance: ", 0, false)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := store.MaintenanceExpire(time.Now())
+		if err != nil {
+			logger.Printf("maintenance expire: %v\n", err)
+		} else if n > 0 {
+			logger.Debugf("maintenance expire: removed %d ended windows\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List is an in memory Store. Windows are lost when the process exits.
+type List struct {
+	mu      sync.Mutex
+	windows []Window
+	nextID  int64
+}
+
+// NewList creates an empty in memory List.
+func NewList() *List { return &List{} }
+
+// MaintenanceCreate validates and stores the Window. Returns the Window with its ID set.
+func (l *List) MaintenanceCreate(w Window) (Window, error) {
+	if err := w.Validate(); err != nil {
+		return w, fmt.Errorf("maintenance.List.MaintenanceCreate: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	w.ID = l.nextID
+	l.windows = append(l.windows, w)
+	return w, nil
+}
+
+// MaintenanceList returns the Windows which match filter in the order they were created.
+func (l *List) MaintenanceList(filter Filter) ([]Window, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var windows []Window
+	for _, w := range l.windows {
+		if filter.Match(w) {
+			windows = append(windows, w)
+		}
+	}
+
+	return windows, nil
+}
+
+// MaintenanceDelete deletes the Window. Returns sql.ErrNoRows if it does not exist so the List
+// behaves like the database.
+func (l *List) MaintenanceDelete(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.windows {
+		if w.ID == id {
+			l.windows = append(l.windows[:i], l.windows[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("maintenance.List.MaintenanceDelete: %w", sql.ErrNoRows)
+}
+
+// MaintenanceExpire deletes the Windows which ended before the time. Returns how many were deleted.
+func (l *List) MaintenanceExpire(before time.Time) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var n int64
+	kept := l.windows[:0]
+	for _, w := range l.windows {
+		if w.End.After(before) {
+			kept = append(kept, w)
+			continue
+		}
+
+		n++
+	}
+
+	l.windows = kept
+	return n, nil
+}
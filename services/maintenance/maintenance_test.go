@@ -0,0 +1,102 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testWindow(kind, target string, start, end time.Duration) Window {
+	now := time.Now()
+	return Window{Kind: kind, Target: target, Start: now.Add(start), End: now.Add(end)}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	require := require.New(t)
+	require.NoError(testWindow(KindServer, "web01", 0, time.Hour).Validate(), "Validate() returned an error")
+
+	for name, w := range map[string]Window{
+		"kind":   testWindow("rack", "r1", 0, time.Hour),
+		"target": testWindow(KindGroup, "", 0, time.Hour),
+		"end":    testWindow(KindGroup, "web", time.Hour, 0),
+		"start":  {Kind: KindGroup, Target: "web", End: time.Now()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.ErrorIs(w.Validate(), ErrInvalidWindow, "Validate() did not return ErrInvalidWindow")
+		})
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	require := require.New(t)
+	w := testWindow(KindServer, "web01", -time.Hour, time.Hour)
+	require.True(w.Active(time.Now()), "Active() returned false")
+	require.True(w.Active(w.Start), "Active() did not include Start")
+	require.False(w.Active(w.End), "Active() included End")
+	require.False(w.Active(w.Start.Add(-time.Second)), "Active() returned true before Start")
+
+	require.True(w.AppliesTo("Web"), "a Window without a Profile did not apply")
+	w.Profile = "DB"
+	require.False(w.AppliesTo("Web"), "AppliesTo() returned true for another Profile")
+
+	w.ID, w.Reason = 3, "patching"
+	require.Equal("maintenance 3 until "+w.End.Format(time.RFC3339)+" (patching)", w.String(), "String() did not match")
+}
+
+func TestMaintenanceList(t *testing.T) {
+	require := require.New(t)
+	l := NewList()
+
+	_, err := l.MaintenanceCreate(Window{})
+	require.ErrorIs(err, ErrInvalidWindow, "MaintenanceCreate() did not validate")
+
+	now := testWindow(KindServer, "web01", -time.Hour, time.Hour)
+	now.Profile = "Web"
+	now, err = l.MaintenanceCreate(now)
+	require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+	require.Equal(int64(1), now.ID, "ID was not set")
+	later, err := l.MaintenanceCreate(testWindow(KindGroup, "db", time.Hour, 2*time.Hour))
+	require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+	ended, err := l.MaintenanceCreate(testWindow(KindGroup, "db", -2*time.Hour, -time.Hour))
+	require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+
+	all, err := l.MaintenanceList(Filter{})
+	require.NoError(err, "MaintenanceList() returned an error: %s", err)
+	require.Len(all, 3, "MaintenanceList() did not return every Window")
+
+	active, err := Active(l, "Web")
+	require.NoError(err, "Active() returned an error: %s", err)
+	require.Equal([]Window{now}, active, "Active() did not match")
+	active, err = Active(l, "DB")
+	require.NoError(err, "Active() returned an error: %s", err)
+	require.Empty(active, "Active() returned a Window for another Profile")
+
+	n, err := l.MaintenanceExpire(time.Now())
+	require.NoError(err, "MaintenanceExpire() returned an error: %s", err)
+	require.Equal(int64(1), n, "MaintenanceExpire() did not remove the ended Window")
+	all, err = l.MaintenanceList(Filter{})
+	require.NoError(err, "MaintenanceList() returned an error: %s", err)
+	require.Equal([]Window{now, later}, all, "MaintenanceExpire() removed the wrong Windows")
+
+	require.NoError(l.MaintenanceDelete(later.ID), "MaintenanceDelete() returned an error")
+	require.ErrorIs(l.MaintenanceDelete(ended.ID), sql.ErrNoRows, "MaintenanceDelete() did not return sql.ErrNoRows")
+}
+
+func TestMaintenanceExpire(t *testing.T) {
+	require := require.New(t)
+	l := NewList()
+	_, err := l.MaintenanceCreate(testWindow(KindServer, "web01", -2*time.Hour, -time.Hour))
+	require.NoError(err, "MaintenanceCreate() returned an error: %s", err)
+
+	// Expire runs once before it checks ctx.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Expire(ctx, l, time.Hour, nil)
+
+	all, err := l.MaintenanceList(Filter{})
+	require.NoError(err, "MaintenanceList() returned an error: %s", err)
+	require.Empty(all, "Expire() did not remove the ended Window")
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"fmt"
+
+	"github.com/chadeldridge/cuttle-server/core"
+)
+
+// Channel types.
+const (
+	TypeWebhook = "webhook"
+	TypeSlack   = "slack"
+	TypeEmail   = "email"
+)
+
+// ChannelConfig configures a single Channel. Which fields are used depends on Type.
+type ChannelConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"` // TypeWebhook, TypeSlack, or TypeEmail.
+
+	// Webhook and Slack.
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// Email.
+	Addr     string   `json:"addr,omitempty" yaml:"addr,omitempty"` // SMTP server host:port.
+	From     string   `json:"from,omitempty" yaml:"from,omitempty"`
+	To       []string `json:"to,omitempty" yaml:"to,omitempty"`
+	Username string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string   `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// Build creates the Channel.
+func (c ChannelConfig) Build() (Channel, error) {
+	switch c.Type {
+	case TypeWebhook, TypeSlack:
+		format := FormatJSON
+		if c.Type == TypeSlack {
+			format = FormatSlack
+		}
+
+		w, err := NewWebhook(c.Name, c.URL, format)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range c.Headers {
+			w.SetHeader(k, v)
+		}
+
+		return w, nil
+	case TypeEmail:
+		m, err := NewEmail(c.Name, c.Addr, c.From, c.To...)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.Username != "" {
+			m.SetAuth(c.Username, c.Password)
+		}
+
+		return m, nil
+	default:
+		return nil, fmt.Errorf("notify.ChannelConfig.Build: unknown channel type: %s", c.Type)
+	}
+}
+
+// Config is the notification config file.
+//
+//	threshold: 2
+//	channels:
+//	  - name: ops
+//	    type: slack
+//	    url: https://hooks.slack.com/services/...
+//	  - name: oncall
+//	    type: email
+//	    addr: smtp.example.com:587
+//	    from: cuttle@example.com
+//	    to: [oncall@example.com]
+//	rules:
+//	  - profile: "*"
+//	    channels: [ops]
+//	  - profile: Web
+//	    tiles: [Nginx]
+//	    channels: [oncall]
+type Config struct {
+	Threshold int             `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	Channels  []ChannelConfig `json:"channels" yaml:"channels"`
+	Rules     []Rule          `json:"rules" yaml:"rules"`
+}
+
+// LoadConfig reads the YAML or JSON config file.
+func LoadConfig(file string) (Config, error) {
+	var c Config
+	if err := core.ParseYAML(file, &c); err != nil {
+		return c, fmt.Errorf("notify.LoadConfig: %w", err)
+	}
+
+	return c, nil
+}
+
+// Build creates a Notifier with the Channels and Rules in the Config.
+func (c Config) Build(logger *core.Logger) (*Notifier, error) {
+	n := NewNotifier(logger)
+	n.Threshold = c.Threshold
+	for _, cc := range c.Channels {
+		ch, err := cc.Build()
+		if err != nil {
+			return nil, fmt.Errorf("notify.Config.Build: %w", err)
+		}
+
+		if err := n.AddChannel(ch); err != nil {
+			return nil, fmt.Errorf("notify.Config.Build: %w", err)
+		}
+	}
+
+	for _, r := range c.Rules {
+		if err := n.AddRule(r); err != nil {
+			return nil, fmt.Errorf("notify.Config.Build: %w", err)
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigLoad(t *testing.T) {
+	require := require.New(t)
+	file := filepath.Join(t.TempDir(), "notify.yaml")
+	data := `
+threshold: 2
+channels:
+  - name: ops
+    type: slack
+    url: https://hooks.example.com/x
+  - name: hook
+    type: webhook
+    url: https://example.com/cuttle
+    headers:
+      Authorization: Bearer abc
+  - name: oncall
+    type: email
+    addr: smtp.example.com:587
+    from: cuttle@example.com
+    to: [oncall@example.com]
+    username: cuttle
+    password: secret
+rules:
+  - profile: "*"
+    channels: [ops]
+  - profile: Web
+    tiles: [Nginx]
+    channels: [hook, oncall]
+`
+	require.NoError(os.WriteFile(file, []byte(data), 0o600), "failed to write the config")
+
+	c, err := LoadConfig(file)
+	require.NoError(err, "LoadConfig() returned an error: %s", err)
+	require.Len(c.Channels, 3, "channels did not load")
+	require.Equal([]string{"Nginx"}, c.Rules[1].Tiles, "rule tiles did not load")
+
+	n, err := c.Build(nil)
+	require.NoError(err, "Config.Build() returned an error: %s", err)
+	require.Equal(2, n.Threshold, "threshold was not set")
+	require.IsType(&Email{}, n.channels["oncall"], "email channel was not built")
+	require.Equal(FormatSlack, n.channels["ops"].(*Webhook).format, "slack channel did not use the slack format")
+	require.Equal("Bearer abc", n.channels["hook"].(*Webhook).headers["Authorization"], "headers were not set")
+	require.Len(n.rules, 2, "rules were not added")
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "bogus.yaml"))
+		require.Error(err, "LoadConfig() did not return an error")
+	})
+
+	t.Run("bad channel", func(t *testing.T) {
+		_, err := Config{Channels: []ChannelConfig{{Name: "x", Type: "pager"}}}.Build(nil)
+		require.Error(err, "Config.Build() did not return an error")
+	})
+
+	t.Run("bad rule", func(t *testing.T) {
+		_, err := Config{Rules: []Rule{{Channels: []string{"x"}}}}.Build(nil)
+		require.ErrorIs(err, ErrUnknownChannel, "Config.Build() did not return ErrUnknownChannel")
+	})
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+)
+
+// Email sends Events through an SMTP server. STARTTLS is used when the server supports it.
+type Email struct {
+	name string
+	addr string // host:port
+	from string
+	to   []string
+	auth smtp.Auth
+
+	// The bare addresses of from and to sent in MAIL FROM and RCPT TO.
+	fromAddr string
+	toAddrs  []string
+}
+
+// NewEmail creates an Email channel which sends from the from address to each to address.
+func NewEmail(name, addr, from string, to ...string) (*Email, error) {
+	if name == "" {
+		return nil, fmt.Errorf("notify.NewEmail: name - %w", core.ErrParamEmpty)
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("notify.NewEmail: invalid addr: %w", err)
+	}
+
+	if len(to) == 0 {
+		return nil, fmt.Errorf("notify.NewEmail: to - %w", core.ErrParamEmpty)
+	}
+
+	addrs := make([]string, 0, len(to)+1)
+	for _, a := range append([]string{from}, to...) {
+		parsed, err := mail.ParseAddress(a)
+		if err != nil {
+			return nil, fmt.Errorf("notify.NewEmail: invalid address %q: %w", a, err)
+		}
+
+		addrs = append(addrs, parsed.Address)
+	}
+
+	return &Email{name: name, addr: addr, from: from, to: to, fromAddr: addrs[0], toAddrs: addrs[1:]}, nil
+}
+
+func (m *Email) Name() string { return m.name }
+
+// SetAuth sets the username and password used to login with PLAIN auth. net/smtp only sends the
+// password over TLS or to localhost.
+func (m *Email) SetAuth(username, password string) {
+	host, _, _ := net.SplitHostPort(m.addr)
+	m.auth = smtp.PlainAuth("", username, password, host)
+}
+
+// Send emails the Event to every recipient.
+func (m *Email) Send(ctx context.Context, e Event) error {
+	if err := m.send(ctx, m.message(e)); err != nil {
+		return fmt.Errorf("notify.Email.Send: %w: %w", ErrSendFailed, err)
+	}
+
+	return nil
+}
+
+// message builds the email for the Event.
+func (m *Email) message(e Event) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + m.from + "\r\n")
+	b.WriteString("To: " + strings.Join(m.to, ", ") + "\r\n")
+	// Names come from user config. Keep them from adding headers.
+	b.WriteString("Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(e.Subject()) + "\r\n")
+	b.WriteString("Date: " + e.Time.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(e.Text(), "\n", "\r\n") + "\r\n")
+	return []byte(b.String())
+}
+
+// send is smtp.SendMail with a context for the dial and deadline.
+func (m *Email) send(ctx context.Context, msg []byte) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(m.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.fromAddr); err != nil {
+		return err
+	}
+
+	for _, to := range m.toAddrs {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testSMTP is a fake SMTP server. It accepts a single message and sends the envelope and data to
+// the channel.
+type testSMTP struct {
+	addr string
+	msgs chan string
+}
+
+func newTestSMTP(t *testing.T, rejectRcpt bool) *testSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "net.Listen() returned an error: %s", err)
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testSMTP{addr: ln.Addr().String(), msgs: make(chan string, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP test")
+
+		var msg strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "RCPT") && rejectRcpt:
+				reply("550 no such user")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				msg.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+
+					msg.WriteString(data)
+				}
+
+				s.msgs <- msg.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return s
+}
+
+func TestEmailNew(t *testing.T) {
+	require := require.New(t)
+	_, err := NewEmail("oncall", "smtp.example.com:25", "cuttle@example.com", "oncall@example.com")
+	require.NoError(err, "NewEmail() returned an error: %s", err)
+
+	for name, args := range map[string][]string{
+		"no name":  {"", "smtp.example.com:25", "cuttle@example.com", "oncall@example.com"},
+		"no port":  {"oncall", "smtp.example.com", "cuttle@example.com", "oncall@example.com"},
+		"bad from": {"oncall", "smtp.example.com:25", "cuttle", "oncall@example.com"},
+		"no to":    {"oncall", "smtp.example.com:25", "cuttle@example.com"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEmail(args[0], args[1], args[2], args[3:]...)
+			require.Error(err, "NewEmail() did not return an error")
+		})
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	require := require.New(t)
+	e := Event{Kind: EventRecovered, Profile: "Web", Tile: "Nginx", Group: "Prod", Time: time.Now()}
+	e.Run.Summary = "host1: 1 pass"
+
+	t.Run("sent", func(t *testing.T) {
+		srv := newTestSMTP(t, false)
+		m, err := NewEmail("oncall", srv.addr, "cuttle@example.com", "a@example.com", "b@example.com")
+		require.NoError(err, "NewEmail() returned an error: %s", err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(m.Send(ctx, e), "Send() returned an error")
+
+		msg := <-srv.msgs
+		require.Contains(msg, "MAIL FROM:<cuttle@example.com>", "sender did not match")
+		require.Contains(msg, "RCPT TO:<a@example.com>", "first recipient was not sent")
+		require.Contains(msg, "RCPT TO:<b@example.com>", "second recipient was not sent")
+		require.Contains(msg, "Subject: [cuttle] RECOVERED: Web/Nginx on Prod\r\n", "subject did not match")
+		require.Contains(msg, "host1: 1 pass", "body did not match")
+	})
+
+	t.Run("display names", func(t *testing.T) {
+		srv := newTestSMTP(t, false)
+		m, err := NewEmail("oncall", srv.addr, "Cuttle <cuttle@example.com>", "On Call <a@example.com>")
+		require.NoError(err, "NewEmail() returned an error: %s", err)
+		require.NoError(m.Send(context.Background(), e), "Send() returned an error")
+
+		msg := <-srv.msgs
+		require.Contains(msg, "MAIL FROM:<cuttle@example.com>", "sender was not the bare address")
+		require.Contains(msg, "RCPT TO:<a@example.com>", "recipient was not the bare address")
+		require.Contains(msg, "From: Cuttle <cuttle@example.com>\r\n", "from header lost the name")
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		srv := newTestSMTP(t, true)
+		m, err := NewEmail("oncall", srv.addr, "cuttle@example.com", "a@example.com")
+		require.NoError(err, "NewEmail() returned an error: %s", err)
+		require.ErrorIs(m.Send(context.Background(), e), ErrSendFailed, "Send() did not return ErrSendFailed")
+	})
+
+	t.Run("header injection", func(t *testing.T) {
+		m, err := NewEmail("oncall", "smtp.example.com:25", "cuttle@example.com", "a@example.com")
+		require.NoError(err, "NewEmail() returned an error: %s", err)
+
+		bad := e
+		bad.Tile = "Nginx\r\nBcc: evil@example.com"
+		headers, _, _ := strings.Cut(string(m.message(bad)), "\r\n\r\n")
+		require.NotContains(headers, "\r\nBcc:", "a header was injected")
+	})
+}
@@ -0,0 +1,294 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+	"github.com/chadeldridge/cuttle-server/services/history"
+)
+
+// Event kinds.
+const (
+	EventFailing   = "failing"
+	EventRecovered = "recovered"
+)
+
+var (
+	ErrSendFailed     = fmt.Errorf("notification failed to send")
+	ErrUnknownChannel = fmt.Errorf("unknown channel")
+)
+
+// Event is sent when a Tile starts failing against a Group or recovers.
+type Event struct {
+	Kind       string      `json:"kind"` // EventFailing or EventRecovered.
+	Profile    string      `json:"profile"`
+	Tile       string      `json:"tile"`
+	Group      string      `json:"group"`
+	ScheduleID int64       `json:"schedule_id,omitempty"`
+	Time       time.Time   `json:"time"`
+	Run        history.Run `json:"run"` // The run which caused the Event.
+}
+
+// Subject is a one line description of the Event. "[cuttle] FAILING: Web/Nginx on Prod"
+func (e Event) Subject() string {
+	return fmt.Sprintf("[cuttle] %s: %s/%s on %s", strings.ToUpper(e.Kind), e.Profile, e.Tile, e.Group)
+}
+
+// Text is the Subject followed by the run summary and error.
+func (e Event) Text() string {
+	var b strings.Builder
+	b.WriteString(e.Subject())
+	if e.Run.Summary != "" {
+		b.WriteString("\n" + e.Run.Summary)
+	}
+
+	if e.Run.Err != "" {
+		b.WriteString("\nerror: " + e.Run.Err)
+	}
+
+	return b.String()
+}
+
+// Channel delivers Events. Webhook and Email are the built in Channels.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Rule routes the Events of a Profile to Channels. An empty Profile or "*" matches every Profile.
+// An empty Tiles matches every Tile in the Profile.
+type Rule struct {
+	Profile  string   `json:"profile" yaml:"profile"`
+	Tiles    []string `json:"tiles,omitempty" yaml:"tiles,omitempty"`
+	Channels []string `json:"channels" yaml:"channels"`
+}
+
+// Match returns true if the Rule applies to the Event.
+func (r Rule) Match(e Event) bool {
+	if r.Profile != "" && r.Profile != "*" && r.Profile != e.Profile {
+		return false
+	}
+
+	return len(r.Tiles) == 0 || slices.Contains(r.Tiles, e.Tile)
+}
+
+// state is the last known state of a Tile against a Group.
+type state struct {
+	failing bool
+	streak  int // Results in a row which disagree with failing.
+}
+
+// Notifier watches run results and sends an Event on each transition to failing and back. Repeat
+// failures are not sent again. Set Threshold to require more than one result in a row before the
+// state changes so a flapping Tile does not alert on every run. States are kept in memory. Use
+// Recorder.Restore to rebuild them from the run history after a restart.
+type Notifier struct {
+	Threshold int // Results in a row needed to change state. Less than 1 is treated as 1.
+
+	logger   *core.Logger
+	mu       sync.Mutex
+	channels map[string]Channel
+	rules    []Rule
+	states   map[string]*state // Keyed by profile/tile/group.
+}
+
+// NewNotifier creates a Notifier with no Channels or Rules. logger may be nil.
+func NewNotifier(logger *core.Logger) *Notifier {
+	if logger == nil {
+		logger = core.NewLogger(io.Discard, "notify: ", 0, false)
+	}
+
+	return &Notifier{
+		logger:   logger,
+		channels: make(map[string]Channel),
+		states:   make(map[string]*state),
+	}
+}
+
+// AddChannel adds the Channel. Channel names must be unique.
+func (n *Notifier) AddChannel(c Channel) error {
+	if c == nil || c.Name() == "" {
+		return fmt.Errorf("notify.Notifier.AddChannel: channel name - %w", core.ErrParamEmpty)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.channels[c.Name()]; ok {
+		return fmt.Errorf("notify.Notifier.AddChannel: channel already exists: %s", c.Name())
+	}
+
+	n.channels[c.Name()] = c
+	return nil
+}
+
+// AddRule adds the Rule. Every Channel in the Rule must already be added.
+func (n *Notifier) AddRule(r Rule) error {
+	if len(r.Channels) == 0 {
+		return fmt.Errorf("notify.Notifier.AddRule: channels - %w", core.ErrParamEmpty)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range r.Channels {
+		if _, ok := n.channels[name]; !ok {
+			return fmt.Errorf("notify.Notifier.AddRule: %w: %s", ErrUnknownChannel, name)
+		}
+	}
+
+	n.rules = append(n.rules, r)
+	return nil
+}
+
+// Notify records the result of the run and sends an Event to the routed Channels if the Tile
+// changed state. Every Channel is tried. Send errors are joined.
+func (n *Notifier) Notify(ctx context.Context, run history.Run) error {
+	e, ok := n.observe(run)
+	if !ok {
+		return nil
+	}
+
+	var errs []error
+	for _, c := range n.route(e) {
+		if err := c.Send(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("notify.Notifier.Notify: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replays the runs, newest first like history.Recorder.RunList returns them, to rebuild the
+// state of each Tile. No Events are sent.
+func (n *Notifier) Restore(runs []history.Run) {
+	for i := len(runs) - 1; i >= 0; i-- {
+		n.observe(runs[i])
+	}
+}
+
+// observe updates the state of the run's Tile and returns an Event if the state changed. Tiles
+// start out passing so the first passing run does not send a recovery. Silenced runs, where every
+// server was in maintenance, do not change the state.
+func (n *Notifier) observe(run history.Run) (Event, bool) {
+	if run.Silenced {
+		return Event{}, false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := run.Profile + "/" + run.Tile + "/" + run.Group
+	st, ok := n.states[key]
+	if !ok {
+		st = &state{}
+		n.states[key] = st
+	}
+
+	if run.Passed != st.failing {
+		// The result agrees with the current state.
+		st.streak = 0
+		return Event{}, false
+	}
+
+	st.streak++
+	if st.streak < max(n.Threshold, 1) {
+		n.logger.Debugf("%s: %d of %d results needed to change state\n", key, st.streak, max(n.Threshold, 1))
+		return Event{}, false
+	}
+
+	st.failing = !run.Passed
+	st.streak = 0
+	e := Event{
+		Kind:       EventRecovered,
+		Profile:    run.Profile,
+		Tile:       run.Tile,
+		Group:      run.Group,
+		ScheduleID: run.ScheduleID,
+		Time:       time.Now(),
+		Run:        run,
+	}
+
+	if st.failing {
+		e.Kind = EventFailing
+	}
+
+	return e, true
+}
+
+// route returns the Channels the Event goes to. A Channel in more than one matching Rule is only
+// returned once.
+func (n *Notifier) route(e Event) []Channel {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var channels []Channel
+	seen := make(map[string]bool)
+	for _, r := range n.rules {
+		if !r.Match(e) {
+			continue
+		}
+
+		for _, name := range r.Channels {
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			channels = append(channels, n.channels[name])
+		}
+	}
+
+	return channels
+}
+
+// Recorder is a history.Recorder which sends notifications for each run it records. Wrap the
+// Recorder given to the scheduler to alert on failed scheduled runs.
+type Recorder struct {
+	history.Recorder
+	notifier *Notifier
+	timeout  time.Duration
+}
+
+// NewRecorder wraps rec so each recorded run is passed to the Notifier.
+func NewRecorder(rec history.Recorder, notifier *Notifier) *Recorder {
+	return &Recorder{Recorder: rec, notifier: notifier, timeout: 30 * time.Second}
+}
+
+// RunRecord records the run then notifies. A failed notification is logged and does not fail the
+// record.
+func (r *Recorder) RunRecord(run history.Run) (history.Run, error) {
+	run, err := r.Recorder.RunRecord(run)
+	if err != nil {
+		return run, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if err := r.notifier.Notify(ctx, run); err != nil {
+		r.notifier.logger.Printf("%v\n", err)
+	}
+
+	return run, nil
+}
+
+// Restore rebuilds the Notifier states from the last limit runs in the history so a restart does
+// not resend alerts for Tiles which are still failing.
+func (r *Recorder) Restore(limit int) error {
+	runs, err := r.Recorder.RunList(history.Filter{Limit: limit})
+	if err != nil {
+		return fmt.Errorf("notify.Recorder.Restore: %w", err)
+	}
+
+	r.notifier.Restore(runs)
+	return nil
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/chadeldridge/cuttle-server/services/history"
+	"github.com/stretchr/testify/require"
+)
+
+// testChannel keeps every Event it is sent.
+type testChannel struct {
+	name   string
+	err    error
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *testChannel) Name() string { return c.name }
+
+func (c *testChannel) Send(ctx context.Context, e Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+	return c.err
+}
+
+func (c *testChannel) kinds() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var kinds []string
+	for _, e := range c.events {
+		kinds = append(kinds, e.Kind)
+	}
+
+	return kinds
+}
+
+func testRun(profile, tile string, passed bool) history.Run {
+	return history.Run{Profile: profile, Tile: tile, Group: "Prod", Trigger: history.TriggerSchedule, ScheduleID: 1, Passed: passed}
+}
+
+func testNotifier(t *testing.T, threshold int, rules ...Rule) (*Notifier, map[string]*testChannel) {
+	n := NewNotifier(nil)
+	n.Threshold = threshold
+	channels := map[string]*testChannel{}
+	for _, name := range []string{"ops", "web"} {
+		channels[name] = &testChannel{name: name}
+		require.NoError(t, n.AddChannel(channels[name]), "AddChannel() returned an error")
+	}
+
+	for _, r := range rules {
+		require.NoError(t, n.AddRule(r), "AddRule() returned an error")
+	}
+
+	return n, channels
+}
+
+func TestNotifierNotify(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("transitions", func(t *testing.T) {
+		n, ch := testNotifier(t, 0, Rule{Channels: []string{"ops"}})
+		for _, passed := range []bool{true, false, false, false, true, true, false} {
+			require.NoError(n.Notify(context.Background(), testRun("Web", "Nginx", passed)))
+		}
+
+		require.Equal([]string{EventFailing, EventRecovered, EventFailing}, ch["ops"].kinds(), "events did not match")
+		e := ch["ops"].events[0]
+		require.Equal("[cuttle] FAILING: Web/Nginx on Prod", e.Subject(), "Subject() did not match")
+		require.Equal(int64(1), e.ScheduleID, "ScheduleID did not match")
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		n, ch := testNotifier(t, 2, Rule{Profile: "*", Channels: []string{"ops"}})
+		// A single failure or pass in a row is flapping and does not change state.
+		for _, passed := range []bool{false, true, false, true, false, false, true, false, true, true} {
+			require.NoError(n.Notify(context.Background(), testRun("Web", "Nginx", passed)))
+		}
+
+		require.Equal([]string{EventFailing, EventRecovered}, ch["ops"].kinds(), "events did not match")
+	})
+
+	t.Run("separate state", func(t *testing.T) {
+		n, ch := testNotifier(t, 1, Rule{Channels: []string{"ops"}})
+		require.NoError(n.Notify(context.Background(), testRun("Web", "Nginx", false)))
+		require.NoError(n.Notify(context.Background(), testRun("Web", "Disk", false)))
+		require.Len(ch["ops"].events, 2, "tiles did not have separate states")
+	})
+
+	t.Run("silenced", func(t *testing.T) {
+		n, ch := testNotifier(t, 1, Rule{Channels: []string{"ops"}})
+		require.NoError(n.Notify(context.Background(), testRun("Web", "Nginx", false)))
+		// Every server was in maintenance so the run passed without checking anything.
+		silenced := testRun("Web", "Nginx", true)
+		silenced.Silenced = true
+		require.NoError(n.Notify(context.Background(), silenced))
+		require.Equal([]string{EventFailing}, ch["ops"].kinds(), "silenced run changed the state")
+	})
+
+	t.Run("routing", func(t *testing.T) {
+		n, ch := testNotifier(t, 1,
+			Rule{Profile: "*", Channels: []string{"ops"}},
+			Rule{Profile: "Web", Tiles: []string{"Nginx"}, Channels: []string{"ops", "web"}},
+		)
+
+		require.NoError(n.Notify(context.Background(), testRun("Web", "Nginx", false)))
+		require.NoError(n.Notify(context.Background(), testRun("Web", "Disk", false)))
+		require.NoError(n.Notify(context.Background(), testRun("DB", "Nginx", false)))
+		require.Len(ch["ops"].events, 3, "ops did not get every event once")
+		require.Len(ch["web"].events, 1, "web got events which did not match its rule")
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		n, ch := testNotifier(t, 1, Rule{Channels: []string{"ops", "web"}})
+		ch["ops"].err = errors.New("boom")
+		err := n.Notify(context.Background(), testRun("Web", "Nginx", false))
+		require.ErrorContains(err, "ops: boom", "Notify() did not return the send error")
+		require.Len(ch["web"].events, 1, "other channels were not tried")
+	})
+}
+
+func TestNotifierAdd(t *testing.T) {
+	require := require.New(t)
+	n, _ := testNotifier(t, 1)
+	require.Error(n.AddChannel(&testChannel{name: "ops"}), "duplicate channel was added")
+	require.Error(n.AddChannel(&testChannel{}), "unnamed channel was added")
+	require.ErrorIs(n.AddRule(Rule{Channels: []string{"bogus"}}), ErrUnknownChannel, "rule with an unknown channel was added")
+	require.Error(n.AddRule(Rule{Profile: "Web"}), "rule without channels was added")
+}
+
+func TestNotifierRecorder(t *testing.T) {
+	require := require.New(t)
+	n, ch := testNotifier(t, 1, Rule{Channels: []string{"ops"}})
+	ch["ops"].err = errors.New("boom")
+	log := history.NewLog()
+	rec := NewRecorder(log, n)
+
+	run, err := rec.RunRecord(testRun("Web", "Nginx", false))
+	require.NoError(err, "a failed notification failed the record")
+	require.NotZero(run.ID, "run was not recorded")
+	require.Len(ch["ops"].events, 1, "run was not notified")
+
+	runs, _ := rec.RunList(history.Filter{})
+	require.Len(runs, 1, "RunList() was not passed through")
+
+	_, err = rec.RunRecord(history.Run{})
+	require.ErrorIs(err, history.ErrInvalidRun, "record error was not returned")
+	require.Len(ch["ops"].events, 1, "an unrecorded run was notified")
+}
+
+func TestNotifierRestore(t *testing.T) {
+	require := require.New(t)
+	log := history.NewLog()
+	n, ch := testNotifier(t, 1, Rule{Channels: []string{"ops"}})
+	rec := NewRecorder(log, n)
+	_, err := rec.RunRecord(testRun("Web", "Nginx", true))
+	require.NoError(err, "RunRecord() returned an error: %s", err)
+	_, err = rec.RunRecord(testRun("Web", "Nginx", false))
+	require.NoError(err, "RunRecord() returned an error: %s", err)
+	require.Equal([]string{EventFailing}, ch["ops"].kinds(), "failure was not notified")
+
+	// A restart starts with a new Notifier.
+	n, ch = testNotifier(t, 1, Rule{Channels: []string{"ops"}})
+	rec = NewRecorder(log, n)
+	require.NoError(rec.Restore(100), "Restore() returned an error")
+	require.Empty(ch["ops"].events, "Restore() sent an event")
+
+	_, err = rec.RunRecord(testRun("Web", "Nginx", false))
+	require.NoError(err, "RunRecord() returned an error: %s", err)
+	require.Empty(ch["ops"].events, "the failure was sent again after the restart")
+
+	_, err = rec.RunRecord(testRun("Web", "Nginx", true))
+	require.NoError(err, "RunRecord() returned an error: %s", err)
+	require.Equal([]string{EventRecovered}, ch["ops"].kinds(), "recovery was not notified")
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chadeldridge/cuttle-server/core"
+)
+
+// Webhook payload formats.
+const (
+	FormatJSON  = "json"  // The Event as JSON.
+	FormatSlack = "slack" // {"text": "..."} which Slack, Mattermost, and Teams incoming webhooks accept.
+)
+
+// Webhook POSTs Events to a URL.
+type Webhook struct {
+	name    string
+	url     string
+	format  string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhook creates a Webhook. format defaults to FormatJSON.
+func NewWebhook(name, rawURL, format string) (*Webhook, error) {
+	if name == "" {
+		return nil, fmt.Errorf("notify.NewWebhook: name - %w", core.ErrParamEmpty)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("notify.NewWebhook: invalid url: %s", rawURL)
+	}
+
+	switch format {
+	case "":
+		format = FormatJSON
+	case FormatJSON, FormatSlack:
+	default:
+		return nil, fmt.Errorf("notify.NewWebhook: unknown format: %s", format)
+	}
+
+	return &Webhook{
+		name:    name,
+		url:     rawURL,
+		format:  format,
+		headers: make(map[string]string),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (w *Webhook) Name() string { return w.name }
+
+// SetHeader adds a header to every request. ("Authorization", "Bearer ...")
+func (w *Webhook) SetHeader(key, value string) { w.headers[key] = value }
+
+// Send POSTs the Event. Any response other than 2xx is an error.
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	var payload any = e
+	if w.format == FormatSlack {
+		payload = struct {
+			Text string `json:"text"`
+		}{Text: e.Text()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("notify.Webhook.Send: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notify.Webhook.Send: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify.Webhook.Send: %w: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify.Webhook.Send: %w: %s", ErrSendFailed, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testWebhookServer returns a server which sends each request body to the channel.
+func testWebhookServer(t *testing.T, status int) (*httptest.Server, chan *http.Request, chan []byte) {
+	reqs := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reqs <- r
+		bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs, bodies
+}
+
+func TestWebhookNew(t *testing.T) {
+	require := require.New(t)
+	w, err := NewWebhook("ops", "https://hooks.example.com/x", "")
+	require.NoError(err, "NewWebhook() returned an error: %s", err)
+	require.Equal(FormatJSON, w.format, "format did not default to json")
+
+	for name, args := range map[string][3]string{
+		"no name":    {"", "https://hooks.example.com/x", ""},
+		"bad url":    {"ops", "hooks.example.com", ""},
+		"bad scheme": {"ops", "ftp://hooks.example.com", ""},
+		"bad format": {"ops", "https://hooks.example.com", "xml"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewWebhook(args[0], args[1], args[2])
+			require.Error(err, "NewWebhook() did not return an error")
+		})
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	require := require.New(t)
+	e := Event{Kind: EventFailing, Profile: "Web", Tile: "Nginx", Group: "Prod"}
+	e.Run.Summary = "host1: 1 fail"
+
+	t.Run("json", func(t *testing.T) {
+		srv, reqs, bodies := testWebhookServer(t, http.StatusOK)
+		w, err := NewWebhook("ops", srv.URL, FormatJSON)
+		require.NoError(err, "NewWebhook() returned an error: %s", err)
+		w.SetHeader("Authorization", "Bearer abc")
+
+		require.NoError(w.Send(context.Background(), e), "Send() returned an error")
+		req := <-reqs
+		require.Equal(http.MethodPost, req.Method, "method did not match")
+		require.Equal("application/json", req.Header.Get("Content-Type"), "content type did not match")
+		require.Equal("Bearer abc", req.Header.Get("Authorization"), "header was not set")
+
+		var got Event
+		require.NoError(json.Unmarshal(<-bodies, &got), "body was not an Event")
+		require.Equal(EventFailing, got.Kind, "kind did not match")
+		require.Equal("host1: 1 fail", got.Run.Summary, "summary did not match")
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		srv, _, bodies := testWebhookServer(t, http.StatusOK)
+		w, err := NewWebhook("ops", srv.URL, FormatSlack)
+		require.NoError(err, "NewWebhook() returned an error: %s", err)
+
+		require.NoError(w.Send(context.Background(), e), "Send() returned an error")
+		var got map[string]string
+		require.NoError(json.Unmarshal(<-bodies, &got), "body was not json")
+		require.Equal("[cuttle] FAILING: Web/Nginx on Prod\nhost1: 1 fail", got["text"], "text did not match")
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		srv, _, _ := testWebhookServer(t, http.StatusInternalServerError)
+		w, err := NewWebhook("ops", srv.URL, FormatJSON)
+		require.NoError(err, "NewWebhook() returned an error: %s", err)
+		require.ErrorIs(w.Send(context.Background(), e), ErrSendFailed, "Send() did not return ErrSendFailed")
+	})
+}
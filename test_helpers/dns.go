@@ -0,0 +1,186 @@
+package test_helpers
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSServer is a minimal in-process, UDP only, authoritative DNS server used for testing lookups
+// without touching real resolvers. Names that have no records of any type return NXDOMAIN.
+type DNSServer struct {
+	Delay time.Duration // Wait this long before answering each query. Useful for latency tests.
+	conn  net.PacketConn
+
+	mu      sync.Mutex
+	records map[string][]dnsmessage.Resource
+	queries int
+}
+
+// NewDNSServer starts a DNSServer on a random localhost port. The server is closed when the test
+// ends.
+func NewDNSServer(t *testing.T) *DNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "net.ListenPacket() returned an error: %s", err)
+
+	s := &DNSServer{conn: conn, records: make(map[string][]dnsmessage.Resource)}
+	go s.serve()
+	t.Cleanup(func() { s.conn.Close() })
+	return s
+}
+
+// Addr returns the "host:port" the server is listening on.
+func (s *DNSServer) Addr() string { return s.conn.LocalAddr().String() }
+
+// Queries returns the number of queries the server has answered.
+func (s *DNSServer) Queries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+// AddA adds an A record. Panics if ip is not an IPv4 address.
+func (s *DNSServer) AddA(name, ip string) {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	s.add(name, dnsmessage.TypeA, &dnsmessage.AResource{A: a})
+}
+
+// AddAAAA adds an AAAA record.
+func (s *DNSServer) AddAAAA(name, ip string) {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip).To16())
+	s.add(name, dnsmessage.TypeAAAA, &dnsmessage.AAAAResource{AAAA: aaaa})
+}
+
+// AddCNAME adds a CNAME record pointing name at target. A and AAAA queries for name are answered
+// with the CNAME followed by target's records.
+func (s *DNSServer) AddCNAME(name, target string) {
+	s.add(name, dnsmessage.TypeCNAME, &dnsmessage.CNAMEResource{CNAME: mustName(target)})
+}
+
+// AddMX adds an MX record.
+func (s *DNSServer) AddMX(name string, pref uint16, host string) {
+	s.add(name, dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: pref, MX: mustName(host)})
+}
+
+// AddTXT adds a TXT record.
+func (s *DNSServer) AddTXT(name string, txt ...string) {
+	s.add(name, dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: txt})
+}
+
+// AddSRV adds an SRV record.
+func (s *DNSServer) AddSRV(name string, priority, weight, port uint16, target string) {
+	s.add(name, dnsmessage.TypeSRV, &dnsmessage.SRVResource{
+		Priority: priority,
+		Weight:   weight,
+		Port:     port,
+		Target:   mustName(target),
+	})
+}
+
+func (s *DNSServer) add(name string, typ dnsmessage.Type, body dnsmessage.ResourceBody) {
+	n := mustName(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[n.String()] = append(s.records[n.String()], dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: n, Type: typ, Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   body,
+	})
+}
+
+// mustName returns name as a lowercase, fully qualified dnsmessage.Name.
+func mustName(name string) dnsmessage.Name {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	return dnsmessage.MustNewName(name)
+}
+
+func (s *DNSServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		resp, ok := s.answer(buf[:n])
+		if !ok {
+			continue
+		}
+
+		if s.Delay > 0 {
+			time.Sleep(s.Delay)
+		}
+
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+func (s *DNSServer) answer(query []byte) ([]byte, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, false
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 h.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   h.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+
+	name := strings.ToLower(q.Name.String())
+	records, exists := s.records[name]
+	if !exists {
+		msg.Header.RCode = dnsmessage.RCodeNameError
+	}
+
+	// Follow a single CNAME for anything other than a CNAME query like a real resolver would.
+	if q.Type != dnsmessage.TypeCNAME {
+		for _, r := range records {
+			if r.Header.Type == dnsmessage.TypeCNAME {
+				msg.Answers = append(msg.Answers, r)
+				target := r.Body.(*dnsmessage.CNAMEResource).CNAME.String()
+				records = s.records[target]
+				break
+			}
+		}
+	}
+
+	for _, r := range records {
+		if r.Header.Type == q.Type {
+			msg.Answers = append(msg.Answers, r)
+		}
+	}
+
+	resp, err := msg.Pack()
+	if err != nil {
+		return nil, false
+	}
+
+	return resp, true
+}
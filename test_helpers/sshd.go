@@ -0,0 +1,318 @@
+package test_helpers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecHandler runs cmd for an "exec" request and returns the exit status to send to the client.
+type ExecHandler func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// SSHServer is a minimal in-process SSH server used for testing connectors without a real sshd.
+// It supports password, public key, certificate, and keyboard-interactive auth, "pty-req" and
+// "exec" requests, the "sftp" subsystem, and "direct-tcpip" channels so it can be used as a jump host. A PTY is not
+// actually allocated, the request is only accepted and counted.
+type SSHServer struct {
+	User           string
+	Password       string
+	AuthorizedKeys []ssh.PublicKey    // Public keys allowed to login as User.
+	TrustedCA      ssh.PublicKey      // CA allowed to sign user certificates for User.
+	Questions      []KeyboardQuestion // Questions asked during keyboard-interactive auth.
+	Config         *ssh.ServerConfig
+	Exec           ExecHandler // Defaults to running the command with "sh -c".
+	listener       net.Listener
+
+	mu       sync.Mutex
+	logins   int
+	ptys     int
+	forwards []string
+}
+
+// KeyboardQuestion is a keyboard-interactive question and the answer the server expects.
+type KeyboardQuestion struct {
+	Question string
+	Answer   string
+}
+
+// NewSSHServer starts an SSHServer on a random localhost port that accepts user and password. The
+// server is closed when the test ends.
+func NewSSHServer(t *testing.T, user, password string) *SSHServer {
+	return NewSSHServerAt(t, "127.0.0.1", user, password)
+}
+
+// NewSSHServerAt is the same as NewSSHServer but listens on host. Useful for running several
+// servers that need to look like different hosts, such as 127.0.0.2 and 127.0.0.3.
+func NewSSHServerAt(t *testing.T, host, user, password string) *SSHServer {
+	require := require.New(t)
+	s := &SSHServer{User: user, Password: password, Exec: ShellExec}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err, "ed25519.GenerateKey() returned an error: %s", err)
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(err, "ssh.NewSignerFromKey() returned an error: %s", err)
+
+	s.Config = &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == s.User && string(pass) == s.Password {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("password rejected for %s", c.User())
+		},
+		PublicKeyCallback:           s.publicKeyCallback,
+		KeyboardInteractiveCallback: s.keyboardInteractiveCallback,
+	}
+	s.Config.AddHostKey(signer)
+
+	s.listener, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	require.NoError(err, "net.Listen() returned an error: %s", err)
+
+	go s.serve()
+	t.Cleanup(func() { s.listener.Close() })
+	return s
+}
+
+// Addr returns the "host:port" the server is listening on.
+func (s *SSHServer) Addr() string { return s.listener.Addr().String() }
+
+// Host returns the host the server is listening on.
+func (s *SSHServer) Host() string { h, _, _ := net.SplitHostPort(s.Addr()); return h }
+
+// Port returns the port the server is listening on.
+func (s *SSHServer) Port() int {
+	_, p, _ := net.SplitHostPort(s.Addr())
+	port, _ := strconv.Atoi(p)
+	return port
+}
+
+// Logins returns the number of successful SSH handshakes the server has seen.
+func (s *SSHServer) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// PTYs returns the number of "pty-req" requests the server has accepted.
+func (s *SSHServer) PTYs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ptys
+}
+
+// Forwards returns the "host:port" targets of every direct-tcpip channel opened through the server.
+func (s *SSHServer) Forwards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.forwards...)
+}
+
+// ShellExec is the default ExecHandler. It runs cmd locally with "sh -c".
+func ShellExec(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	err := c.Run()
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return 127
+}
+
+func (s *SSHServer) publicKeyCallback(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if c.User() != s.User {
+		return nil, fmt.Errorf("unknown user %s", c.User())
+	}
+
+	if cert, ok := key.(*ssh.Certificate); ok {
+		checker := &ssh.CertChecker{
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return s.TrustedCA != nil && bytes.Equal(auth.Marshal(), s.TrustedCA.Marshal())
+			},
+		}
+
+		return checker.Authenticate(c, cert)
+	}
+
+	for _, k := range s.AuthorizedKeys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("public key rejected for %s", c.User())
+}
+
+func (s *SSHServer) keyboardInteractiveCallback(
+	c ssh.ConnMetadata,
+	client ssh.KeyboardInteractiveChallenge,
+) (*ssh.Permissions, error) {
+	if c.User() != s.User || len(s.Questions) == 0 {
+		return nil, fmt.Errorf("keyboard-interactive rejected for %s", c.User())
+	}
+
+	questions := make([]string, len(s.Questions))
+	echos := make([]bool, len(s.Questions))
+	for i, q := range s.Questions {
+		questions[i] = q.Question
+	}
+
+	answers, err := client(c.User(), "", questions, echos)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, q := range s.Questions {
+		if i >= len(answers) || answers[i] != q.Answer {
+			return nil, fmt.Errorf("keyboard-interactive rejected for %s", c.User())
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *SSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SSHServer) handleConn(conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.Config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+
+	s.mu.Lock()
+	s.logins++
+	s.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		switch newChan.ChannelType() {
+		case "session":
+			go s.handleSession(newChan)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newChan)
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *SSHServer) handleSession(newChan ssh.NewChannel) {
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			s.mu.Lock()
+			s.ptys++
+			s.mu.Unlock()
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+
+			req.Reply(true, nil)
+			status := s.Exec(payload.Command, ch, ch, ch.Stderr())
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		case "subsystem":
+			// Only sftp is supported. It serves the local filesystem so tests should use t.TempDir().
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				return
+			}
+
+			server.Serve()
+			server.Close()
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (s *SSHServer) handleDirectTCPIP(newChan ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+
+	if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, "bad payload")
+		return
+	}
+
+	target := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+	conn, err := net.Dial("tcp", target)
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	s.mu.Lock()
+	s.forwards = append(s.forwards, target)
+	s.mu.Unlock()
+
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+
+	io.Copy(conn, ch)
+	conn.Close()
+	ch.Close()
+}